@@ -418,3 +418,233 @@ func TestBareEvents(t *testing.T) {
 		}
 	}
 }
+
+const tupleDefinition = `[
+	{ "type" : "function", "name" : "static", "constant" : true, "inputs" : [ { "name" : "s", "type" : "tuple", "components" : [ { "name" : "id", "type" : "uint256" }, { "name" : "owner", "type" : "address" } ] } ], "outputs" : [ { "name" : "s", "type" : "tuple", "components" : [ { "name" : "id", "type" : "uint256" }, { "name" : "owner", "type" : "address" } ] } ] },
+	{ "type" : "function", "name" : "dynamic", "constant" : true, "inputs" : [ { "name" : "s", "type" : "tuple", "components" : [ { "name" : "id", "type" : "uint256" }, { "name" : "label", "type" : "string" } ] } ], "outputs" : [ { "name" : "s", "type" : "tuple", "components" : [ { "name" : "id", "type" : "uint256" }, { "name" : "label", "type" : "string" } ] } ] },
+	{ "type" : "function", "name" : "list", "constant" : true, "inputs" : [ { "name" : "s", "type" : "tuple[]", "components" : [ { "name" : "id", "type" : "uint256" }, { "name" : "owner", "type" : "address" } ] } ], "outputs" : [ { "name" : "s", "type" : "tuple[]", "components" : [ { "name" : "id", "type" : "uint256" }, { "name" : "owner", "type" : "address" } ] } ] },
+	{ "type" : "function", "name" : "labels", "constant" : true, "inputs" : [ { "name" : "s", "type" : "tuple[2]", "components" : [ { "name" : "id", "type" : "uint256" }, { "name" : "label", "type" : "string" } ] } ], "outputs" : [ { "name" : "s", "type" : "tuple[2]", "components" : [ { "name" : "id", "type" : "uint256" }, { "name" : "label", "type" : "string" } ] } ] },
+	{ "type" : "function", "name" : "pair", "constant" : true, "outputs" : [ { "name" : "record", "type" : "tuple", "components" : [ { "name" : "id", "type" : "uint256" }, { "name" : "owner", "type" : "address" } ] }, { "name" : "count", "type" : "uint256" } ] }
+]`
+
+func TestTupleSignature(t *testing.T) {
+	abi, err := JSON(strings.NewReader(tupleDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, exp := range map[string]string{
+		"static":  "static((uint256,address))",
+		"dynamic": "dynamic((uint256,string))",
+		"list":    "list((uint256,address)[])",
+	} {
+		if sig := abi.Methods[name].Sig(); sig != exp {
+			t.Errorf("signature mismatch: have %s, want %s", sig, exp)
+		}
+	}
+}
+
+func TestTuplePackUnpack(t *testing.T) {
+	abi, err := JSON(strings.NewReader(tupleDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type record struct {
+		Id    *big.Int
+		Owner common.Address
+	}
+	type labelled struct {
+		Id    *big.Int
+		Label string
+	}
+	owner := common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+
+	tests := []struct {
+		method string
+		input  interface{}
+		output interface{}
+		enc    string
+	}{
+		{
+			"static",
+			record{big.NewInt(1), owner},
+			new(record),
+			"0000000000000000000000000000000000000000000000000000000000000001" +
+				"0000000000000000000000000102030405060708090a0b0c0d0e0f1011121314",
+		},
+		{
+			"dynamic",
+			labelled{big.NewInt(2), "hello"},
+			new(labelled),
+			"0000000000000000000000000000000000000000000000000000000000000020" +
+				"0000000000000000000000000000000000000000000000000000000000000002" +
+				"0000000000000000000000000000000000000000000000000000000000000040" +
+				"0000000000000000000000000000000000000000000000000000000000000005" +
+				"68656c6c6f000000000000000000000000000000000000000000000000000000",
+		},
+		{
+			"labels",
+			[2]labelled{{big.NewInt(1), "a"}, {big.NewInt(2), "b"}},
+			new([2]labelled),
+			"0000000000000000000000000000000000000000000000000000000000000020" +
+				"0000000000000000000000000000000000000000000000000000000000000040" +
+				"00000000000000000000000000000000000000000000000000000000000000c0" +
+				"0000000000000000000000000000000000000000000000000000000000000001" +
+				"0000000000000000000000000000000000000000000000000000000000000040" +
+				"0000000000000000000000000000000000000000000000000000000000000001" +
+				"6100000000000000000000000000000000000000000000000000000000000000" +
+				"0000000000000000000000000000000000000000000000000000000000000002" +
+				"0000000000000000000000000000000000000000000000000000000000000040" +
+				"0000000000000000000000000000000000000000000000000000000000000001" +
+				"6200000000000000000000000000000000000000000000000000000000000000",
+		},
+		{
+			"list",
+			[]record{{big.NewInt(1), owner}, {big.NewInt(2), common.Address{}}},
+			new([]record),
+			"0000000000000000000000000000000000000000000000000000000000000020" +
+				"0000000000000000000000000000000000000000000000000000000000000002" +
+				"0000000000000000000000000000000000000000000000000000000000000001" +
+				"0000000000000000000000000102030405060708090a0b0c0d0e0f1011121314" +
+				"0000000000000000000000000000000000000000000000000000000000000002" +
+				"0000000000000000000000000000000000000000000000000000000000000000",
+		},
+	}
+	for i, test := range tests {
+		packed, err := abi.Pack(test.method, test.input)
+		if err != nil {
+			t.Fatalf("test %d (%s): pack failed: %v", i, test.method, err)
+		}
+		if have, want := common.Bytes2Hex(packed[4:]), test.enc; have != want {
+			t.Errorf("test %d (%s): encoding mismatch:\nhave %s\nwant %s", i, test.method, have, want)
+		}
+		if err := abi.Unpack(test.output, test.method, packed[4:]); err != nil {
+			t.Fatalf("test %d (%s): unpack failed: %v", i, test.method, err)
+		}
+		if have := reflect.ValueOf(test.output).Elem().Interface(); !reflect.DeepEqual(have, test.input) {
+			t.Errorf("test %d (%s): unpack mismatch: have %v, want %v", i, test.method, have, test.input)
+		}
+	}
+}
+
+// Tests that arrays and slices of dynamic elements pack their elements through
+// offsets, like a tuple, and unpack back.
+func TestDynamicArrayPackUnpack(t *testing.T) {
+	const definition = `[
+	{ "type" : "function", "name" : "pair", "constant" : true, "inputs" : [ { "name" : "s", "type" : "string[2]" } ], "outputs" : [ { "name" : "s", "type" : "string[2]" } ] },
+	{ "type" : "function", "name" : "list", "constant" : true, "inputs" : [ { "name" : "s", "type" : "string[]" } ], "outputs" : [ { "name" : "s", "type" : "string[]" } ] }
+]`
+	abi, err := JSON(strings.NewReader(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method string
+		input  interface{}
+		output interface{}
+		enc    string
+	}{
+		{
+			"pair",
+			[2]string{"a", "bc"},
+			new([2]string),
+			"0000000000000000000000000000000000000000000000000000000000000020" +
+				"0000000000000000000000000000000000000000000000000000000000000040" +
+				"0000000000000000000000000000000000000000000000000000000000000080" +
+				"0000000000000000000000000000000000000000000000000000000000000001" +
+				"6100000000000000000000000000000000000000000000000000000000000000" +
+				"0000000000000000000000000000000000000000000000000000000000000002" +
+				"6263000000000000000000000000000000000000000000000000000000000000",
+		},
+		{
+			"list",
+			[]string{"a", "bc"},
+			new([]string),
+			"0000000000000000000000000000000000000000000000000000000000000020" +
+				"0000000000000000000000000000000000000000000000000000000000000002" +
+				"0000000000000000000000000000000000000000000000000000000000000040" +
+				"0000000000000000000000000000000000000000000000000000000000000080" +
+				"0000000000000000000000000000000000000000000000000000000000000001" +
+				"6100000000000000000000000000000000000000000000000000000000000000" +
+				"0000000000000000000000000000000000000000000000000000000000000002" +
+				"6263000000000000000000000000000000000000000000000000000000000000",
+		},
+	}
+	for i, test := range tests {
+		packed, err := abi.Pack(test.method, test.input)
+		if err != nil {
+			t.Fatalf("test %d (%s): pack failed: %v", i, test.method, err)
+		}
+		if have, want := common.Bytes2Hex(packed[4:]), test.enc; have != want {
+			t.Errorf("test %d (%s): encoding mismatch:\nhave %s\nwant %s", i, test.method, have, want)
+		}
+		if err := abi.Unpack(test.output, test.method, packed[4:]); err != nil {
+			t.Fatalf("test %d (%s): unpack failed: %v", i, test.method, err)
+		}
+		if have := reflect.ValueOf(test.output).Elem().Interface(); !reflect.DeepEqual(have, test.input) {
+			t.Errorf("test %d (%s): unpack mismatch: have %v, want %v", i, test.method, have, test.input)
+		}
+	}
+}
+
+func TestTupleMultiReturn(t *testing.T) {
+	abi, err := JSON(strings.NewReader(tupleDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type record struct {
+		Id    *big.Int
+		Owner common.Address
+	}
+	var (
+		owner = common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+		enc   = common.Hex2Bytes("0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000000102030405060708090a0b0c0d0e0f1011121314" +
+			"0000000000000000000000000000000000000000000000000000000000000003")
+		out struct {
+			Record record
+			Count  *big.Int
+		}
+	)
+	if err := abi.Unpack(&out, "pair", enc); err != nil {
+		t.Fatalf("unpack failed: %v", err)
+	}
+	if out.Record.Id.Cmp(big.NewInt(1)) != 0 || out.Record.Owner != owner {
+		t.Errorf("record mismatch: have %v", out.Record)
+	}
+	if out.Count.Cmp(big.NewInt(3)) != 0 {
+		t.Errorf("count mismatch: have %v, want 3", out.Count)
+	}
+}
+
+func TestTupleUnpackInvalidOffsets(t *testing.T) {
+	abi, err := JSON(strings.NewReader(tupleDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type labelled struct {
+		Id    *big.Int
+		Label string
+	}
+	tests := []struct {
+		method string
+		output interface{}
+		enc    string
+	}{
+		// offset of a dynamic tuple that would wrap around when converted to int
+		{"dynamic", new(labelled), "000000000000000000000000000000000000000000000000ffffffffffffffff"},
+		// offset of a dynamic tuple that doesn't fit in 64 bits
+		{"dynamic", new(labelled), "0000000000000000000000000000000100000000000000000000000000000020"},
+		// length of a string inside a tuple that would wrap around
+		{"dynamic", new(labelled), "0000000000000000000000000000000000000000000000000000000000000020" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000040" +
+			"000000000000000000000000000000000000000000000000ffffffffffffffe0"},
+		// offset of an array of dynamic tuples beyond the output
+		{"labels", new([2]labelled), "0000000000000000000000000000000000000000000000007fffffffffffffff"},
+	}
+	for i, test := range tests {
+		if err := abi.Unpack(test.output, test.method, common.Hex2Bytes(test.enc)); err == nil {
+			t.Errorf("test %d (%s): expected an error", i, test.method)
+		}
+	}
+}
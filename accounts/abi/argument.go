@@ -29,18 +29,23 @@ type Argument struct {
 	Indexed bool // indexed is only used by events
 }
 
+// ArgumentMarshaling is the JSON representation of an argument as found in
+// the ABI. Tuple arguments carry their fields in Components.
+type ArgumentMarshaling struct {
+	Name       string
+	Type       string
+	Components []ArgumentMarshaling
+	Indexed    bool
+}
+
 func (a *Argument) UnmarshalJSON(data []byte) error {
-	var extarg struct {
-		Name    string
-		Type    string
-		Indexed bool
-	}
+	var extarg ArgumentMarshaling
 	err := json.Unmarshal(data, &extarg)
 	if err != nil {
 		return fmt.Errorf("argument json err: %v", err)
 	}
 
-	a.Type, err = NewType(extarg.Type)
+	a.Type, err = newType(extarg.Type, extarg.Components)
 	if err != nil {
 		return err
 	}
@@ -2,6 +2,7 @@ package backends
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"errors"
 	"fmt"
 	"math/big"
@@ -13,16 +14,34 @@ import (
 	"github.com/kowala-tech/kUSD/common"
 	"github.com/kowala-tech/kUSD/common/math"
 	"github.com/kowala-tech/kUSD/consensus/tendermint"
+	"github.com/kowala-tech/kUSD/contracts/network/genesis"
 	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/bloombits"
 	"github.com/kowala-tech/kUSD/core/state"
 	"github.com/kowala-tech/kUSD/core/types"
 	"github.com/kowala-tech/kUSD/core/vm"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/event"
+	"github.com/kowala-tech/kUSD/kusd/filters"
 	"github.com/kowala-tech/kUSD/kusddb"
 	"github.com/kowala-tech/kUSD/params"
+	"github.com/kowala-tech/kUSD/rpc"
 )
 
-// This nil assignment ensures compile time that SimulatedBackend implements bind.ContractBackend.
-var _ bind.ContractBackend = (*SimulatedBackend)(nil)
+// These nil assignments ensure compile time that SimulatedBackend implements
+// bind.ContractBackend and the chain access interfaces of package kowala.
+var (
+	_ bind.ContractBackend     = (*SimulatedBackend)(nil)
+	_ kowala.ChainReader       = (*SimulatedBackend)(nil)
+	_ kowala.TransactionReader = (*SimulatedBackend)(nil)
+	_ kowala.LogFilterer       = (*SimulatedBackend)(nil)
+)
+
+// genesisValidatorKey is the key of the voter the network contract registers in
+// its constructor, 0xd6e579085c82329c89fca7a9f012be59028ed53f (see
+// internal/assets). The simulated validator commits every block with it, so the
+// commits are signed by a member of the genesis validator set.
+var genesisValidatorKey, _ = crypto.HexToECDSA("fca939d59ed3b0b69db1faffd2413ae9f6314ae2dc74a9dd2496ab7bdad066f7")
 
 var errBlockNumberUnsupported = errors.New("SimulatedBackend cannot access blocks other than the latest block")
 var errGasEstimationFailed = errors.New("gas required exceeds allowance or always failing transaction")
@@ -37,6 +56,12 @@ type SimulatedBackend struct {
 	pendingBlock *types.Block   // Currently pending block that will be imported on request
 	pendingState *state.StateDB // Currently pending state that will be the active on on request
 
+	validatorKey *ecdsa.PrivateKey // Key of the genesis validator committing every block
+	validator    common.Address    // Address of the validator, used as the coinbase
+	signer       types.Signer      // Signer used to sign the validator's votes
+
+	events *filters.EventSystem // Event system for filtering log events live
+
 	config *params.ChainConfig
 }
 
@@ -47,11 +72,44 @@ func NewSimulatedBackend(alloc core.GenesisAlloc) *SimulatedBackend {
 	genesis := core.Genesis{Config: params.AllProtocolChanges, Alloc: alloc}
 	genesis.MustCommit(database)
 	blockchain, _ := core.NewBlockChain(database, genesis.Config, tendermint.NewFaker(), vm.Config{})
-	backend := &SimulatedBackend{database: database, BlockChain: blockchain, config: genesis.Config}
+
+	backend := &SimulatedBackend{
+		database:     database,
+		BlockChain:   blockchain,
+		validatorKey: genesisValidatorKey,
+		validator:    crypto.PubkeyToAddress(genesisValidatorKey.PublicKey),
+		signer:       types.MakeSigner(genesis.Config, common.Big0),
+		events:       filters.NewEventSystem(new(event.TypeMux), &filterBackend{database, blockchain}, false),
+		config:       genesis.Config,
+	}
 	backend.rollback()
 	return backend
 }
 
+// NewSimulatedBackendWithContracts creates a new binding backend like
+// NewSimulatedBackend, starting from a genesis block that also holds the Kowala
+// system contracts, deployed by the default network owner.
+func NewSimulatedBackendWithContracts(alloc core.GenesisAlloc) *SimulatedBackend {
+	contracts, err := genesis.SystemContracts(genesis.DefaultOwner)
+	if err != nil {
+		panic(err) // This cannot happen unless the system contracts are broken, fail in that case
+	}
+	merged := make(core.GenesisAlloc, len(alloc)+len(contracts))
+	for addr, account := range alloc {
+		merged[addr] = account
+	}
+	for addr, account := range contracts {
+		merged[addr] = account
+	}
+	return NewSimulatedBackend(merged)
+}
+
+// ValidatorAddress returns the address of the simulated validator that commits
+// the blocks and collects their rewards.
+func (b *SimulatedBackend) ValidatorAddress() common.Address {
+	return b.validator
+}
+
 // Commit imports all the pending transactions as a single block and starts a
 // fresh new state.
 func (b *SimulatedBackend) Commit() {
@@ -73,11 +131,38 @@ func (b *SimulatedBackend) Rollback() {
 }
 
 func (b *SimulatedBackend) rollback() {
-	blocks, _ := core.GenerateChain(b.config, b.CurrentBlock(), b.database, 1, func(int, *core.BlockGen) {})
+	b.generatePendingBlock(nil)
+}
+
+// generatePendingBlock creates a new pending block on top of the current one,
+// committed by the simulated validator, and lets gen fill in its contents.
+func (b *SimulatedBackend) generatePendingBlock(gen func(*core.BlockGen)) {
+	parent := b.CurrentBlock()
+	commit := b.commit(parent)
+	blocks, _ := core.GenerateChain(b.config, parent, b.database, 1, func(number int, block *core.BlockGen) {
+		block.SetCoinbase(b.validator)
+		block.SetLastCommit(commit)
+		if gen != nil {
+			gen(block)
+		}
+	})
 	b.pendingBlock = blocks[0]
 	b.pendingState, _ = state.New(b.pendingBlock.Root(), state.NewDatabase(b.database))
 }
 
+// commit creates the commit of the given block, consisting of a single
+// pre-commit vote of the simulated validator.
+func (b *SimulatedBackend) commit(block *types.Block) *types.Commit {
+	vote, err := types.SignVote(types.NewVote(block.Number(), block.Hash(), 0, types.PreCommit), b.signer, b.validatorKey)
+	if err != nil {
+		panic(err) // This cannot happen unless the simulator is wrong, fail in that case
+	}
+	return &types.Commit{
+		PreCommits:     types.Votes{vote},
+		FirstPreCommit: vote,
+	}
+}
+
 // CodeAt returns the code associated with a certain account in the blockchain.
 func (b *SimulatedBackend) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
 	b.mu.Lock()
@@ -133,6 +218,85 @@ func (b *SimulatedBackend) TransactionReceipt(ctx context.Context, txHash common
 	return receipt, nil
 }
 
+// TransactionByHash checks the pending block and the blockchain for a transaction
+// with the given hash. The isPending return value indicates whether the
+// transaction has been committed yet.
+func (b *SimulatedBackend) TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if tx := b.pendingBlock.Transaction(txHash); tx != nil {
+		return tx, true, nil
+	}
+	if tx, _, _, _ := core.GetTransaction(b.database, txHash); tx != nil {
+		return tx, false, nil
+	}
+	return nil, false, kowala.NotFound
+}
+
+// BlockByHash retrieves a committed block with the given hash.
+func (b *SimulatedBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	if block := b.GetBlockByHash(hash); block != nil {
+		return block, nil
+	}
+	return nil, kowala.NotFound
+}
+
+// BlockByNumber retrieves a committed block with the given number. A nil number
+// retrieves the latest block.
+func (b *SimulatedBackend) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	if number == nil {
+		return b.CurrentBlock(), nil
+	}
+	if block := b.GetBlockByNumber(number.Uint64()); block != nil {
+		return block, nil
+	}
+	return nil, kowala.NotFound
+}
+
+// HeaderByHash retrieves the header of a committed block with the given hash.
+func (b *SimulatedBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	if header := b.GetHeaderByHash(hash); header != nil {
+		return header, nil
+	}
+	return nil, kowala.NotFound
+}
+
+// HeaderByNumber retrieves the header of a committed block with the given
+// number. A nil number retrieves the latest header.
+func (b *SimulatedBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if number == nil {
+		return b.CurrentHeader(), nil
+	}
+	if header := b.GetHeaderByNumber(number.Uint64()); header != nil {
+		return header, nil
+	}
+	return nil, kowala.NotFound
+}
+
+// TransactionCount returns the number of transactions in a committed block.
+func (b *SimulatedBackend) TransactionCount(ctx context.Context, blockHash common.Hash) (uint, error) {
+	block, err := b.BlockByHash(ctx, blockHash)
+	if err != nil {
+		return 0, err
+	}
+	return uint(block.Transactions().Len()), nil
+}
+
+// TransactionInBlock returns the transaction at the given index of a committed
+// block.
+func (b *SimulatedBackend) TransactionInBlock(ctx context.Context, blockHash common.Hash, index uint) (*types.Transaction, error) {
+	block, err := b.BlockByHash(ctx, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	if index >= uint(len(txs)) {
+		return nil, kowala.NotFound
+	}
+	return txs[index], nil
+}
+
 // PendingCodeAt returns the code associated with an account in the pending state.
 func (b *SimulatedBackend) PendingCodeAt(ctx context.Context, contract common.Address) ([]byte, error) {
 	b.mu.Lock()
@@ -275,30 +439,120 @@ func (b *SimulatedBackend) SendTransaction(ctx context.Context, tx *types.Transa
 		panic(fmt.Errorf("invalid transaction nonce: got %d, want %d", tx.Nonce(), nonce))
 	}
 
-	blocks, _ := core.GenerateChain(b.config, b.CurrentBlock(), b.database, 1, func(number int, block *core.BlockGen) {
-		for _, tx := range b.pendingBlock.Transactions() {
+	pending := b.pendingBlock.Transactions()
+	b.generatePendingBlock(func(block *core.BlockGen) {
+		for _, tx := range pending {
 			block.AddTx(tx)
 		}
 		block.AddTx(tx)
 	})
-	b.pendingBlock = blocks[0]
-	b.pendingState, _ = state.New(b.pendingBlock.Root(), state.NewDatabase(b.database))
 	return nil
 }
 
+// FilterLogs executes a log filter operation, blocking during execution and
+// returning all the results in one batch.
+func (b *SimulatedBackend) FilterLogs(ctx context.Context, query kowala.FilterQuery) ([]types.Log, error) {
+	// Initialize unset filter boundaries to run from genesis to chain head
+	from := int64(0)
+	if query.FromBlock != nil {
+		from = query.FromBlock.Int64()
+	}
+	to := int64(-1)
+	if query.ToBlock != nil {
+		to = query.ToBlock.Int64()
+	}
+	// Construct and execute the filter
+	filter := filters.New(&filterBackend{b.database, b.BlockChain}, from, to, query.Addresses, query.Topics)
+
+	logs, err := filter.Logs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]types.Log, len(logs))
+	for i, log := range logs {
+		res[i] = *log
+	}
+	return res, nil
+}
+
+// SubscribeFilterLogs creates a background log filtering operation, returning a
+// subscription immediately, which can be used to stream the found events.
+func (b *SimulatedBackend) SubscribeFilterLogs(ctx context.Context, query kowala.FilterQuery, ch chan<- types.Log) (kowala.Subscription, error) {
+	// Subscribe to contract events
+	sink := make(chan []*types.Log)
+
+	sub, err := b.events.SubscribeLogs(filters.FilterCriteria{
+		FromBlock: query.FromBlock,
+		ToBlock:   query.ToBlock,
+		Addresses: query.Addresses,
+		Topics:    query.Topics,
+	}, sink)
+	if err != nil {
+		return nil, err
+	}
+	// Since we're getting logs in batches, we need to flatten them into a plain stream
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case logs := <-sink:
+				for _, log := range logs {
+					select {
+					case ch <- *log:
+					case err := <-sub.Err():
+						return err
+					case <-quit:
+						return nil
+					}
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// SubscribeNewHead subscribes to notifications about the headers of the blocks
+// committed to the simulated chain.
+func (b *SimulatedBackend) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (kowala.Subscription, error) {
+	sink := make(chan *types.Header)
+	sub := b.events.SubscribeNewHeads(sink)
+
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case head := <-sink:
+				select {
+				case ch <- head:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
 // JumpTimeInSeconds adds skip seconds to the clock
 func (b *SimulatedBackend) AdjustTime(adjustment time.Duration) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	blocks, _ := core.GenerateChain(b.config, b.BlockChain.CurrentBlock(), b.database, 1, func(number int, block *core.BlockGen) {
-		for _, tx := range b.pendingBlock.Transactions() {
+
+	pending := b.pendingBlock.Transactions()
+	b.generatePendingBlock(func(block *core.BlockGen) {
+		for _, tx := range pending {
 			block.AddTx(tx)
 		}
 		block.OffsetTime(int64(adjustment.Seconds()))
 	})
-	b.pendingBlock = blocks[0]
-	b.pendingState, _ = state.New(b.pendingBlock.Root(), state.NewDatabase(b.database))
-
 	return nil
 }
 
@@ -315,3 +569,45 @@ func (m callmsg) GasPrice() *big.Int   { return m.CallMsg.GasPrice }
 func (m callmsg) Gas() *big.Int        { return m.CallMsg.Gas }
 func (m callmsg) Value() *big.Int      { return m.CallMsg.Value }
 func (m callmsg) Data() []byte         { return m.CallMsg.Data }
+
+// filterBackend implements filters.Backend to support filtering for logs without
+// taking bloom-bits acceleration structures into account.
+type filterBackend struct {
+	db kusddb.Database
+	bc *core.BlockChain
+}
+
+func (fb *filterBackend) ChainDb() kusddb.Database { return fb.db }
+func (fb *filterBackend) EventMux() *event.TypeMux { panic("not supported") }
+
+func (fb *filterBackend) HeaderByNumber(ctx context.Context, block rpc.BlockNumber) (*types.Header, error) {
+	if block == rpc.LatestBlockNumber {
+		return fb.bc.CurrentHeader(), nil
+	}
+	return fb.bc.GetHeaderByNumber(uint64(block.Int64())), nil
+}
+
+func (fb *filterBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return core.GetBlockReceipts(fb.db, hash, core.GetBlockNumber(fb.db, hash)), nil
+}
+
+func (fb *filterBackend) SubscribeTxPreEvent(ch chan<- core.TxPreEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+func (fb *filterBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
+	return fb.bc.SubscribeChainEvent(ch)
+}
+func (fb *filterBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
+	return fb.bc.SubscribeRemovedLogsEvent(ch)
+}
+func (fb *filterBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
+	return fb.bc.SubscribeLogsEvent(ch)
+}
+
+func (fb *filterBackend) BloomStatus() (uint64, uint64) { return 4096, 0 }
+func (fb *filterBackend) ServiceFilter(ctx context.Context, ms *bloombits.MatcherSession) {
+	panic("not supported")
+}
@@ -0,0 +1,146 @@
+package backends
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	kowala "github.com/kowala-tech/kUSD"
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/contracts/network/genesis"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/crypto"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr    = crypto.PubkeyToAddress(testKey.PublicKey)
+	testBalance = big.NewInt(2e18)
+)
+
+// Tests that every committed block carries a commit of its parent signed by the
+// simulated validator.
+func TestSimulatedBackendCommit(t *testing.T) {
+	sim := NewSimulatedBackend(core.GenesisAlloc{testAddr: {Balance: testBalance}})
+
+	for i := 0; i < 3; i++ {
+		sim.Commit()
+	}
+	signer := types.MakeSigner(sim.config, common.Big0)
+	for i := uint64(1); i <= 3; i++ {
+		block := sim.GetBlockByNumber(i)
+		if block == nil {
+			t.Fatalf("block %d: missing", i)
+		}
+		if block.Coinbase() != sim.ValidatorAddress() {
+			t.Errorf("block %d: coinbase mismatch: have %x, want %x", i, block.Coinbase(), sim.ValidatorAddress())
+		}
+		commit := block.LastCommit()
+		if commit == nil || commit.FirstPreCommit == nil {
+			t.Fatalf("block %d: missing commit", i)
+		}
+		if commit.Hash() != block.LastCommitHash() {
+			t.Errorf("block %d: commit hash mismatch: have %x, want %x", i, commit.Hash(), block.LastCommitHash())
+		}
+		vote := commit.FirstPreCommit
+		if vote.BlockHash() != block.ParentHash() {
+			t.Errorf("block %d: vote hash mismatch: have %x, want %x", i, vote.BlockHash(), block.ParentHash())
+		}
+		from, err := types.VoteSender(signer, vote)
+		if err != nil {
+			t.Fatalf("block %d: failed to recover vote sender: %v", i, err)
+		}
+		if from != sim.ValidatorAddress() {
+			t.Errorf("block %d: vote sender mismatch: have %x, want %x", i, from, sim.ValidatorAddress())
+		}
+	}
+}
+
+// Tests that transactions can be looked up both while pending and once committed.
+func TestSimulatedBackendTransactionByHash(t *testing.T) {
+	sim := NewSimulatedBackend(core.GenesisAlloc{testAddr: {Balance: testBalance}})
+
+	tx, _ := types.SignTx(types.NewTransaction(0, common.Address{0x01}, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil), types.UnprotectedSigner{}, testKey)
+	if err := sim.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatalf("failed to send transaction: %v", err)
+	}
+	if _, pending, err := sim.TransactionByHash(context.Background(), tx.Hash()); err != nil || !pending {
+		t.Fatalf("pending lookup mismatch: pending %v, err %v", pending, err)
+	}
+	sim.Commit()
+	if _, pending, err := sim.TransactionByHash(context.Background(), tx.Hash()); err != nil || pending {
+		t.Fatalf("committed lookup mismatch: pending %v, err %v", pending, err)
+	}
+	if _, _, err := sim.TransactionByHash(context.Background(), common.Hash{0x01}); err != kowala.NotFound {
+		t.Fatalf("unknown lookup error mismatch: have %v, want %v", err, kowala.NotFound)
+	}
+	if receipt, _ := sim.TransactionReceipt(context.Background(), tx.Hash()); receipt == nil {
+		t.Fatalf("missing receipt")
+	}
+}
+
+// Tests that new heads are delivered to subscribers when blocks are committed.
+func TestSimulatedBackendSubscribeNewHead(t *testing.T) {
+	sim := NewSimulatedBackend(core.GenesisAlloc{testAddr: {Balance: testBalance}})
+
+	heads := make(chan *types.Header)
+	sub, err := sim.SubscribeNewHead(context.Background(), heads)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	sim.Commit()
+	select {
+	case head := <-heads:
+		if head.Number.Uint64() != 1 {
+			t.Fatalf("head number mismatch: have %d, want 1", head.Number.Uint64())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("new head timeout")
+	}
+}
+
+// Tests that the system contracts are deployed when requested.
+func TestSimulatedBackendWithContracts(t *testing.T) {
+	sim := NewSimulatedBackendWithContracts(core.GenesisAlloc{testAddr: {Balance: testBalance}})
+
+	contracts, err := genesis.SystemContracts(genesis.DefaultOwner)
+	if err != nil {
+		t.Fatalf("failed to create system contracts: %v", err)
+	}
+	for addr, account := range contracts {
+		code, err := sim.CodeAt(context.Background(), addr, nil)
+		if err != nil {
+			t.Fatalf("failed to retrieve code of %x: %v", addr, err)
+		}
+		if len(code) == 0 || len(code) != len(account.Code) {
+			t.Errorf("code mismatch for %x: have %d bytes, want %d", addr, len(code), len(account.Code))
+		}
+	}
+	balance, _ := sim.BalanceAt(context.Background(), testAddr, nil)
+	if balance.Cmp(testBalance) != 0 {
+		t.Errorf("balance mismatch: have %v, want %v", balance, testBalance)
+	}
+}
+
+// Tests that the blocks are committed by a voter of the network contract, so the
+// commits verify against the genesis validator set.
+func TestSimulatedBackendValidatorIsVoter(t *testing.T) {
+	sim := NewSimulatedBackendWithContracts(core.GenesisAlloc{testAddr: {Balance: testBalance}})
+	sim.Commit()
+
+	// The network contract is the first one the owner deploys
+	stats := crypto.CreateAddress(genesis.DefaultOwner, 0)
+	input := append(crypto.Keccak256([]byte("isVoter(address)"))[:4], common.LeftPadBytes(sim.ValidatorAddress().Bytes(), 32)...)
+
+	out, err := sim.CallContract(context.Background(), kowala.CallMsg{To: &stats, Data: input}, nil)
+	if err != nil {
+		t.Fatalf("failed to call network contract: %v", err)
+	}
+	if len(out) != 32 || out[31] != 1 {
+		t.Fatalf("validator %x is not a voter: %x", sim.ValidatorAddress(), out)
+	}
+}
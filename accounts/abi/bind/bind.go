@@ -24,6 +24,7 @@ import (
 	"bytes"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 	"unicode"
@@ -47,7 +48,10 @@ const (
 // manually maintain hard coded strings that break on runtime.
 func Bind(types []string, abis []string, bytecodes []string, pkg string, lang Lang) (string, error) {
 	// Process each individual contract requested binding
-	contracts := make(map[string]*tmplContract)
+	var (
+		contracts = make(map[string]*tmplContract)
+		structs   = make(map[string]*tmplStruct)
+	)
 
 	for i := 0; i < len(types); i++ {
 		// Parse the actual ABI to generate the binding for
@@ -68,6 +72,31 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 			calls     = make(map[string]*tmplMethod)
 			transacts = make(map[string]*tmplMethod)
 		)
+		// Collect the tuple types in a stable order so generated struct names don't change
+		args := evmABI.Constructor.Inputs
+
+		methods := make([]string, 0, len(evmABI.Methods))
+		for name := range evmABI.Methods {
+			methods = append(methods, name)
+		}
+		sort.Strings(methods)
+		for _, name := range methods {
+			args = append(args, evmABI.Methods[name].Inputs...)
+			args = append(args, evmABI.Methods[name].Outputs...)
+		}
+		events := make([]string, 0, len(evmABI.Events))
+		for name := range evmABI.Events {
+			events = append(events, name)
+		}
+		sort.Strings(events)
+		for _, name := range events {
+			args = append(args, evmABI.Events[name].Inputs...)
+		}
+		for _, arg := range args {
+			if err := bindStructType[lang](arg.Type, structs); err != nil {
+				return "", err
+			}
+		}
 		for _, original := range evmABI.Methods {
 			// Normalize the method for capital cases and non-anonymous inputs/outputs
 			normalized := original
@@ -107,11 +136,14 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 	data := &tmplData{
 		Package:   pkg,
 		Contracts: contracts,
+		Structs:   structs,
 	}
 	buffer := new(bytes.Buffer)
 
 	funcs := map[string]interface{}{
-		"bindtype":     bindType[lang],
+		"bindtype": func(kind abi.Type) string {
+			return bindType[lang](kind, structs)
+		},
 		"namedtype":    namedType[lang],
 		"capitalise":   capitalise,
 		"decapitalise": decapitalise,
@@ -134,7 +166,7 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 
 // bindType is a set of type binders that convert Solidity types to some supported
 // programming language.
-var bindType = map[Lang]func(kind abi.Type) string{
+var bindType = map[Lang]func(kind abi.Type, structs map[string]*tmplStruct) string{
 	LangGo:   bindTypeGo,
 	LangJava: bindTypeJava,
 }
@@ -142,10 +174,19 @@ var bindType = map[Lang]func(kind abi.Type) string{
 // bindTypeGo converts a Solidity type to a Go one. Since there is no clear mapping
 // from all Solidity types to Go ones (e.g. uint17), those that cannot be exactly
 // mapped will use an upscaled type (e.g. *big.Int).
-func bindTypeGo(kind abi.Type) string {
+func bindTypeGo(kind abi.Type, structs map[string]*tmplStruct) string {
 	stringKind := kind.String()
 
 	switch {
+	case kind.T == abi.TupleTy:
+		return structs[stringKind].Name
+
+	case strings.HasPrefix(stringKind, "(") && kind.T == abi.SliceTy:
+		return "[]" + bindTypeGo(*kind.Elem, structs)
+
+	case strings.HasPrefix(stringKind, "(") && kind.T == abi.ArrayTy:
+		return fmt.Sprintf("[%d]", kind.Size) + bindTypeGo(*kind.Elem, structs)
+
 	case strings.HasPrefix(stringKind, "address"):
 		parts := regexp.MustCompile(`address(\[[0-9]*\])?`).FindStringSubmatch(stringKind)
 		if len(parts) != 2 {
@@ -186,7 +227,7 @@ func bindTypeGo(kind abi.Type) string {
 // bindTypeJava converts a Solidity type to a Java one. Since there is no clear mapping
 // from all Solidity types to Java ones (e.g. uint17), those that cannot be exactly
 // mapped will use an upscaled type (e.g. BigDecimal).
-func bindTypeJava(kind abi.Type) string {
+func bindTypeJava(kind abi.Type, structs map[string]*tmplStruct) string {
 	stringKind := kind.String()
 
 	switch {
@@ -254,6 +295,83 @@ func bindTypeJava(kind abi.Type) string {
 	}
 }
 
+// bindStructType is a set of type binders that register the user defined structs
+// (tuples) contained in a Solidity type, so they can be generated alongside the
+// contract bindings.
+var bindStructType = map[Lang]func(kind abi.Type, structs map[string]*tmplStruct) error{
+	LangGo:   bindStructTypeGo,
+	LangJava: bindStructTypeJava,
+}
+
+// bindStructTypeGo registers a Go struct for every distinct tuple type found in
+// kind, including the tuples nested in arrays and in other tuples. Structs are
+// deduplicated by their canonical signature.
+func bindStructTypeGo(kind abi.Type, structs map[string]*tmplStruct) error {
+	switch kind.T {
+	case abi.SliceTy, abi.ArrayTy:
+		return bindStructTypeGo(*kind.Elem, structs)
+
+	case abi.TupleTy:
+		if _, exist := structs[kind.String()]; exist {
+			return nil
+		}
+		fields := make([]*tmplField, len(kind.TupleElems))
+		for i, elem := range kind.TupleElems {
+			if err := bindStructTypeGo(*elem, structs); err != nil {
+				return err
+			}
+			fields[i] = &tmplField{
+				Name:    kind.Type.Field(i).Name,
+				Type:    bindTypeGo(*elem, structs),
+				SolKind: *elem,
+			}
+		}
+		structs[kind.String()] = &tmplStruct{
+			Name:   structName(fields, structs),
+			Fields: fields,
+		}
+	}
+	return nil
+}
+
+// bindStructTypeJava rejects tuple types, which the Java binder doesn't support.
+func bindStructTypeJava(kind abi.Type, structs map[string]*tmplStruct) error {
+	switch kind.T {
+	case abi.SliceTy, abi.ArrayTy:
+		return bindStructTypeJava(*kind.Elem, structs)
+
+	case abi.TupleTy:
+		return fmt.Errorf("tuple type %v can't be bound to Java", kind)
+	}
+	return nil
+}
+
+// structName derives the name of the struct bound to a tuple from the names of
+// its components, e.g. (uint256 id, address owner) becomes IdOwner. Distinct
+// tuples with the same component names are told apart by a numeric suffix.
+func structName(fields []*tmplField, structs map[string]*tmplStruct) string {
+	var name string
+	for _, field := range fields {
+		name += field.Name
+	}
+	taken := func(name string) bool {
+		for _, s := range structs {
+			if s.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+	if !taken(name) {
+		return name
+	}
+	for i := 2; ; i++ {
+		if suffixed := fmt.Sprintf("%s%d", name, i); !taken(suffixed) {
+			return suffixed
+		}
+	}
+}
+
 // namedType is a set of functions that transform language specific types to
 // named versions that my be used inside method names.
 var namedType = map[Lang]func(string, abi.Type) string{
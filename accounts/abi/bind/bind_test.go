@@ -447,6 +447,32 @@ var bindTests = []struct {
 			}
 		`,
 	},
+	// Tests that tuple arguments and returns are bound to generated Go structs
+	{
+		`Structs`,
+		`
+			contract Structs {
+				struct Record { uint256 id; address owner; }
+				function get(Record r) constant returns (Record) { return r; }
+				function set(Record[] rs) {}
+			}
+		`,
+		``,
+		`
+			[
+				{"constant":true,"inputs":[{"name":"r","type":"tuple","components":[{"name":"id","type":"uint256"},{"name":"owner","type":"address"}]}],"name":"get","outputs":[{"name":"","type":"tuple","components":[{"name":"id","type":"uint256"},{"name":"owner","type":"address"}]}],"type":"function"},
+				{"constant":false,"inputs":[{"name":"rs","type":"tuple[]","components":[{"name":"id","type":"uint256"},{"name":"owner","type":"address"}]}],"name":"set","outputs":[],"type":"function"}
+			]
+		`,
+		`
+			record := IdOwner{Id: big.NewInt(1), Owner: common.Address{1}}
+			if record.Id.Cmp(big.NewInt(1)) != 0 || record.Owner != (common.Address{1}) {
+				t.Fatalf("generated struct fields mismatch: %v", record)
+			}
+			var _ func(*bind.CallOpts, IdOwner) (IdOwner, error) = (&StructsCaller{}).Get
+			var _ func(*bind.TransactOpts, []IdOwner) (*types.Transaction, error) = (&StructsTransactor{}).Set
+		`,
+	},
 }
 
 // Tests that packages generated by the binder can be successfully compiled and
@@ -504,3 +530,32 @@ func TestBindings(t *testing.T) {
 		t.Fatalf("failed to run binding test: %v\n%s", err, out)
 	}
 }
+
+// Tests that tuples are bound to Go structs named after their components, and
+// rejected by the binders that don't support them. Unlike TestBindings, this
+// doesn't need to compile the generated code.
+func TestBindStructs(t *testing.T) {
+	const structsABI = `[
+		{"constant":true,"inputs":[{"name":"r","type":"tuple","components":[{"name":"id","type":"uint256"},{"name":"owner","type":"address"}]}],"name":"get","outputs":[{"name":"","type":"tuple","components":[{"name":"id","type":"uint256"},{"name":"owner","type":"address"}]}],"type":"function"},
+		{"constant":false,"inputs":[{"name":"rs","type":"tuple[]","components":[{"name":"id","type":"uint256"},{"name":"owner","type":"address"}]}],"name":"set","outputs":[],"type":"function"},
+		{"constant":false,"inputs":[{"name":"r","type":"tuple","components":[{"name":"id","type":"uint8"},{"name":"owner","type":"address"}]}],"name":"setSmall","outputs":[],"type":"function"}
+	]`
+	code, err := Bind([]string{"Structs"}, []string{structsABI}, []string{""}, "bindtest", LangGo)
+	if err != nil {
+		t.Fatalf("failed to generate binding: %v", err)
+	}
+	for _, want := range []string{
+		"type IdOwner struct {",
+		"type IdOwner2 struct {",
+		"func (_Structs *StructsCaller) Get(opts *bind.CallOpts, r IdOwner) (IdOwner, error) {",
+		"func (_Structs *StructsTransactor) Set(opts *bind.TransactOpts, rs []IdOwner) (*types.Transaction, error) {",
+		"func (_Structs *StructsTransactor) SetSmall(opts *bind.TransactOpts, r IdOwner2) (*types.Transaction, error) {",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated binding misses %q", want)
+		}
+	}
+	if _, err := Bind([]string{"Structs"}, []string{structsABI}, []string{""}, "bindtest", LangJava); err == nil {
+		t.Errorf("Java binder accepted tuple types")
+	}
+}
@@ -22,6 +22,7 @@ import "github.com/kowala-tech/kUSD/accounts/abi"
 type tmplData struct {
 	Package   string                   // Name of the package to place the generated file in
 	Contracts map[string]*tmplContract // List of contracts to generate into this file
+	Structs   map[string]*tmplStruct   // User defined structs (tuples) shared by the contracts
 }
 
 // tmplContract contains the data needed to generate an individual contract binding.
@@ -42,6 +43,21 @@ type tmplMethod struct {
 	Structured bool       // Whether the returns should be accumulated into a contract
 }
 
+// tmplField is a wrapper around a struct field with binding language
+// struct type definition and generated field name.
+type tmplField struct {
+	Name    string   // Field name of the generated struct
+	Type    string   // Field type in the binding language
+	SolKind abi.Type // Raw ABI type information
+}
+
+// tmplStruct is a wrapper around an abi.tuple and contains a struct name
+// derived from the names of its components.
+type tmplStruct struct {
+	Name   string       // Struct name derived from the component names
+	Fields []*tmplField // Struct fields definition depends on the binding language
+}
+
 // tmplSource is language to template mapping containing all the supported
 // programming languages the package can generate to.
 var tmplSource = map[Lang]string{
@@ -57,6 +73,14 @@ const tmplSourceGo = `
 
 package {{.Package}}
 
+{{range $structs := .Structs}}
+	// {{.Name}} is an auto generated low-level Go binding around an user-defined struct.
+	type {{.Name}} struct {
+	{{range $field := .Fields}}
+	{{$field.Name}} {{$field.Type}}{{end}}
+	}
+{{end}}
+
 {{range $contract := .Contracts}}
 	// {{.Type}}ABI is the input ABI used to generate the binding from.
 	const {{.Type}}ABI = "{{.InputABI}}"
@@ -65,20 +65,19 @@ func (e Event) tupleUnpack(v interface{}, output []byte) error {
 		return fmt.Errorf("abi: cannot unmarshal tuple in to %v", typ)
 	}
 
-	j := 0
+	offset := 0
 	for i := 0; i < len(e.Inputs); i++ {
 		input := e.Inputs[i]
 		if input.Indexed {
 			// can't read, continue
 			continue
-		} else if input.Type.T == ArrayTy {
-			// need to move this up because they read sequentially
-			j += input.Type.Size
 		}
-		marshalledValue, err := toGoType((i+j)*32, input.Type, output)
+		marshalledValue, err := toGoType(offset, input.Type, output)
 		if err != nil {
 			return err
 		}
+		// static arrays and tuples are inlined and span multiple words
+		offset += getTypeSize(input.Type)
 		reflectValue := reflect.ValueOf(marshalledValue)
 
 		switch value.Kind() {
@@ -45,9 +45,14 @@ func (method Method) pack(args ...interface{}) ([]byte, error) {
 		return nil, fmt.Errorf("argument count mismatch: %d for %d", len(args), len(method.Inputs))
 	}
 	// variable input is the output appended at the end of packed
-	// output. This is used for strings and bytes types input.
+	// output. This is used for strings, bytes and dynamic tuple types input.
 	var variableInput []byte
 
+	// the head holds static values inline and an offset for every dynamic one
+	headSize := 0
+	for _, input := range method.Inputs {
+		headSize += getTypeSize(input.Type)
+	}
 	var ret []byte
 	for i, a := range args {
 		input := method.Inputs[i]
@@ -57,10 +62,10 @@ func (method Method) pack(args ...interface{}) ([]byte, error) {
 			return nil, fmt.Errorf("`%s` %v", method.Name, err)
 		}
 
-		// check for a slice type (string, bytes, slice)
-		if input.Type.requiresLengthPrefix() {
+		// check for a dynamic type (string, bytes, slice, dynamic tuple)
+		if isDynamicType(input.Type) {
 			// calculate the offset
-			offset := len(method.Inputs)*32 + len(variableInput)
+			offset := headSize + len(variableInput)
 			// set the offset
 			ret = append(ret, packNum(reflect.ValueOf(offset))...)
 			// Append the packed output to the variable input. The variable input
@@ -92,17 +97,15 @@ func (method Method) tupleUnpack(v interface{}, output []byte) error {
 		typ   = value.Type()
 	)
 
-	j := 0
+	offset := 0
 	for i := 0; i < len(method.Outputs); i++ {
 		toUnpack := method.Outputs[i]
-		if toUnpack.Type.T == ArrayTy {
-			// need to move this up because they read sequentially
-			j += toUnpack.Type.Size
-		}
-		marshalledValue, err := toGoType((i+j)*32, toUnpack.Type, output)
+		marshalledValue, err := toGoType(offset, toUnpack.Type, output)
 		if err != nil {
 			return err
 		}
+		// static arrays and tuples are inlined and span multiple words
+		offset += getTypeSize(toUnpack.Type)
 		reflectValue := reflect.ValueOf(marshalledValue)
 
 		switch value.Kind() {
@@ -79,9 +79,64 @@ func set(dst, src reflect.Value, output Argument) error {
 	case dstType.Kind() == reflect.Interface:
 		dst.Set(src)
 	case dstType.Kind() == reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dstType.Elem()))
+		}
 		return set(dst.Elem(), src, output)
+	case dstType.Kind() == reflect.Struct && srcType.Kind() == reflect.Struct:
+		return setStruct(dst, src, output)
+	case dstType.Kind() == reflect.Slice && srcType.Kind() == reflect.Slice:
+		slice := reflect.MakeSlice(dstType, src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			if err := set(slice.Index(i), src.Index(i), output); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+	case dstType.Kind() == reflect.Array && srcType.Kind() == reflect.Array && dst.Len() == src.Len():
+		for i := 0; i < src.Len(); i++ {
+			if err := set(dst.Index(i), src.Index(i), output); err != nil {
+				return err
+			}
+		}
 	default:
 		return fmt.Errorf("abi: cannot unmarshal %v in to %v", src.Type(), dst.Type())
 	}
 	return nil
 }
+
+// setStruct assigns the fields of an unpacked tuple to the fields of a user
+// supplied struct with the same names.
+func setStruct(dst, src reflect.Value, output Argument) error {
+	srcType := src.Type()
+	for i := 0; i < srcType.NumField(); i++ {
+		name := srcType.Field(i).Tag.Get("json")
+		field, err := tupleField(dst, name)
+		if err != nil {
+			return err
+		}
+		if err := set(field, src.Field(i), output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tupleField returns the field of the struct value v that corresponds to the
+// tuple component name. Fields may be matched explicitly with an `abi:"name"`
+// tag, otherwise the capitalised component name is used.
+func tupleField(v reflect.Value, name string) (reflect.Value, error) {
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("abi: cannot use %v as tuple", v.Type())
+	}
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		if typ.Field(i).Tag.Get("abi") == name {
+			return v.Field(i), nil
+		}
+	}
+	if field := v.FieldByName(toFieldName(name)); field.IsValid() {
+		return field, nil
+	}
+	return reflect.Value{}, fmt.Errorf("abi: field %s can't be found in the given value", name)
+}
@@ -37,6 +37,7 @@ const (
 	HashTy
 	FixedPointTy
 	FunctionTy
+	TupleTy
 )
 
 // Type is the reflection of the supported argument type
@@ -48,6 +49,9 @@ type Type struct {
 	Size int
 	T    byte // Our own type checking
 
+	TupleElems    []*Type  // Field types of a tuple
+	TupleRawNames []string // Field names of a tuple as declared in the ABI
+
 	stringKind string // holds the unparsed string for deriving signatures
 }
 
@@ -56,8 +60,15 @@ var (
 	typeRegex = regexp.MustCompile("([a-zA-Z]+)(([0-9]+)(x([0-9]+))?)?")
 )
 
-// NewType creates a new reflection type of abi type given in t.
+// NewType creates a new reflection type of abi type given in t. Tuple types
+// can only be created from a JSON ABI, since they require their components.
 func NewType(t string) (typ Type, err error) {
+	return newType(t, nil)
+}
+
+// newType creates a new reflection type of abi type given in t, using the
+// components to describe the fields of tuple types.
+func newType(t string, components []ArgumentMarshaling) (typ Type, err error) {
 	// check that array brackets are equal if they exist
 	if strings.Count(t, "[") != strings.Count(t, "]") {
 		return Type{}, fmt.Errorf("invalid arg type in abi")
@@ -70,12 +81,16 @@ func NewType(t string) (typ Type, err error) {
 	if strings.Count(t, "[") != 0 {
 		i := strings.LastIndex(t, "[")
 		// recursively embed the type
-		embeddedType, err := NewType(t[:i])
+		embeddedType, err := newType(t[:i], components)
 		if err != nil {
 			return Type{}, err
 		}
 		// grab the last cell and create a type from there
 		sliced := t[i:]
+		// tuples are signed with their expanded field list, not the word tuple
+		if embeddedType.T == TupleTy {
+			typ.stringKind = embeddedType.stringKind + sliced
+		}
 		// grab the slice size with regexp
 		re := regexp.MustCompile("[0-9]+")
 		intz := re.FindAllString(sliced, -1)
@@ -159,6 +174,8 @@ func NewType(t string) (typ Type, err error) {
 			typ.T = FunctionTy
 			typ.Size = 24
 			typ.Type = reflect.ArrayOf(24, reflect.TypeOf(byte(0)))
+		case "tuple":
+			return newTupleType(components)
 		default:
 			return Type{}, fmt.Errorf("unsupported arg type: %s", t)
 		}
@@ -167,6 +184,59 @@ func NewType(t string) (typ Type, err error) {
 	return
 }
 
+// newTupleType creates the reflection type of a tuple from its components. The
+// Go representation of a tuple is an anonymous struct with a capitalised field
+// for every component.
+func newTupleType(components []ArgumentMarshaling) (Type, error) {
+	if len(components) == 0 {
+		return Type{}, fmt.Errorf("abi: tuple type without components")
+	}
+	var (
+		fields   = make([]reflect.StructField, len(components))
+		elems    = make([]*Type, len(components))
+		names    = make([]string, len(components))
+		expanded = make([]string, len(components))
+	)
+	for i, c := range components {
+		name := toFieldName(c.Name)
+		if name == "" {
+			return Type{}, fmt.Errorf("abi: tuple component %d has no usable name", i)
+		}
+		elem, err := newType(c.Type, c.Components)
+		if err != nil {
+			return Type{}, err
+		}
+		fields[i] = reflect.StructField{
+			Name: name,
+			Type: elem.Type,
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s"`, c.Name)),
+		}
+		elems[i] = &elem
+		names[i] = c.Name
+		expanded[i] = elem.String()
+	}
+	return Type{
+		Kind:          reflect.Struct,
+		Type:          reflect.StructOf(fields),
+		T:             TupleTy,
+		TupleElems:    elems,
+		TupleRawNames: names,
+		stringKind:    "(" + strings.Join(expanded, ",") + ")",
+	}, nil
+}
+
+// toFieldName converts a solidity identifier into an exported Go field name,
+// dropping underscores and capitalising the letter that follows them.
+func toFieldName(name string) string {
+	parts := strings.Split(name, "_")
+	for i, part := range parts {
+		if len(part) > 0 {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
 // String implements Stringer
 func (t Type) String() (out string) {
 	return t.stringKind
@@ -181,6 +251,22 @@ func (t Type) pack(v reflect.Value) ([]byte, error) {
 	}
 
 	if t.T == SliceTy || t.T == ArrayTy {
+		// tuple and dynamic elements are laid out as a regular tuple encoding
+		if t.Elem.T == TupleTy || isDynamicType(*t.Elem) {
+			elems := make([]reflect.Value, v.Len())
+			types := make([]*Type, v.Len())
+			for i := range elems {
+				elems[i], types[i] = v.Index(i), t.Elem
+			}
+			packed, err := packTuple(types, elems)
+			if err != nil {
+				return nil, err
+			}
+			if t.T == SliceTy {
+				return append(packNum(reflect.ValueOf(v.Len())), packed...), nil
+			}
+			return packed, nil
+		}
 		var packed []byte
 
 		for i := 0; i < v.Len(); i++ {
@@ -196,9 +282,81 @@ func (t Type) pack(v reflect.Value) ([]byte, error) {
 			return packed, nil
 		}
 	}
+	if t.T == TupleTy {
+		fields := make([]reflect.Value, len(t.TupleElems))
+		for i, name := range t.TupleRawNames {
+			field, err := tupleField(v, name)
+			if err != nil {
+				return nil, err
+			}
+			fields[i] = field
+		}
+		return packTuple(t.TupleElems, fields)
+	}
 	return packElement(t, v), nil
 }
 
+// packTuple packs the given values as the consecutive fields of a tuple. Static
+// fields are placed inline, while dynamic ones are appended after the head and
+// referenced by their offset from the start of the tuple.
+func packTuple(types []*Type, values []reflect.Value) ([]byte, error) {
+	headSize := 0
+	for _, t := range types {
+		headSize += getTypeSize(*t)
+	}
+	var head, tail []byte
+	for i, t := range types {
+		packed, err := t.pack(values[i])
+		if err != nil {
+			return nil, err
+		}
+		if isDynamicType(*t) {
+			head = append(head, packNum(reflect.ValueOf(headSize+len(tail)))...)
+			tail = append(tail, packed...)
+		} else {
+			head = append(head, packed...)
+		}
+	}
+	return append(head, tail...), nil
+}
+
+// isDynamicType returns whether the encoding of t is placed in the tail of its
+// enclosing tuple and referenced by an offset from the head.
+func isDynamicType(t Type) bool {
+	switch t.T {
+	case StringTy, BytesTy, SliceTy:
+		return true
+	case ArrayTy:
+		return isDynamicType(*t.Elem)
+	case TupleTy:
+		for _, elem := range t.TupleElems {
+			if isDynamicType(*elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getTypeSize returns the number of bytes t occupies in the head of its
+// enclosing tuple. Dynamic types only take up a single offset word.
+func getTypeSize(t Type) int {
+	if isDynamicType(t) {
+		return 32
+	}
+	switch t.T {
+	case ArrayTy:
+		return t.Size * getTypeSize(*t.Elem)
+	case TupleTy:
+		size := 0
+		for _, elem := range t.TupleElems {
+			size += getTypeSize(*elem)
+		}
+		return size
+	}
+	return 32
+}
+
 // requireLengthPrefix returns whether the type requires any sort of length
 // prefixing.
 func (t Type) requiresLengthPrefix() bool {
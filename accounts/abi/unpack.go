@@ -112,6 +112,11 @@ func forEachUnpack(t Type, output []byte, start, size int) (interface{}, error)
 	var refSlice reflect.Value
 	slice := output[start : start+size*32]
 
+	// tuple and dynamic elements are encoded as a tuple of their own
+	if t.Elem.T == TupleTy || isDynamicType(*t.Elem) {
+		return forEachTupleUnpack(t, output, start, size)
+	}
+
 	if t.T == SliceTy {
 		// declare our slice
 		refSlice = reflect.MakeSlice(t.Type, size, size)
@@ -139,6 +144,46 @@ func forEachUnpack(t Type, output []byte, start, size int) (interface{}, error)
 	return refSlice.Interface(), nil
 }
 
+// forEachTupleUnpack unpacks a slice or array of tuples or dynamic elements.
+// Static tuples are laid out back to back, while dynamic elements are referenced
+// by offsets relative to the start of the element list.
+func forEachTupleUnpack(t Type, output []byte, start, size int) (interface{}, error) {
+	elemSize := getTypeSize(*t.Elem)
+	if start+elemSize*size > len(output) {
+		return nil, fmt.Errorf("abi: cannot marshal in to go array: offset %d would go over slice boundary (len=%d)", start+elemSize*size, len(output))
+	}
+	var refSlice reflect.Value
+	if t.T == SliceTy {
+		refSlice = reflect.MakeSlice(t.Type, size, size)
+	} else {
+		refSlice = reflect.New(t.Type).Elem()
+	}
+	for i := 0; i < size; i++ {
+		inter, err := toGoType(i*elemSize, *t.Elem, output[start:])
+		if err != nil {
+			return nil, err
+		}
+		refSlice.Index(i).Set(reflect.ValueOf(inter))
+	}
+	return refSlice.Interface(), nil
+}
+
+// forTupleUnpack unpacks the fields of a tuple starting at the beginning of
+// output. Offsets of dynamic fields are relative to the start of the tuple.
+func forTupleUnpack(t Type, output []byte) (interface{}, error) {
+	retval := reflect.New(t.Type).Elem()
+	offset := 0
+	for i, elem := range t.TupleElems {
+		marshalledValue, err := toGoType(offset, *elem, output)
+		if err != nil {
+			return nil, err
+		}
+		retval.Field(i).Set(reflect.ValueOf(marshalledValue))
+		offset += getTypeSize(*elem)
+	}
+	return retval.Interface(), nil
+}
+
 // toGoType parses the output bytes and recursively assigns the value of these bytes
 // into a go type with accordance with the ABI spec.
 func toGoType(index int, t Type, output []byte) (interface{}, error) {
@@ -163,9 +208,26 @@ func toGoType(index int, t Type, output []byte) (interface{}, error) {
 	}
 
 	switch t.T {
+	case TupleTy:
+		if isDynamicType(t) {
+			offset, err := readOffset(index, output)
+			if err != nil {
+				return nil, err
+			}
+			return forTupleUnpack(t, output[offset:])
+		}
+		return forTupleUnpack(t, output[index:])
 	case SliceTy:
 		return forEachUnpack(t, output, begin, end)
 	case ArrayTy:
+		if isDynamicType(t) {
+			// arrays of dynamic elements are packed in the tail, like a tuple
+			offset, err := readOffset(index, output)
+			if err != nil {
+				return nil, err
+			}
+			return forEachUnpack(t, output, offset, t.Size)
+		}
 		return forEachUnpack(t, output, index, t.Size)
 	case StringTy: // variable arrays are written at the end of the return bytes
 		return string(output[begin : begin+end]), nil
@@ -188,17 +250,37 @@ func toGoType(index int, t Type, output []byte) (interface{}, error) {
 	}
 }
 
+// readOffset interprets the 32 byte word at index as an offset into output. The
+// offset is bounds checked before the conversion to int, so that untrusted input
+// can't wrap it around.
+func readOffset(index int, output []byte) (int, error) {
+	word := output[index : index+32]
+	for _, b := range word[:24] {
+		if b != 0 {
+			return 0, fmt.Errorf("abi: cannot marshal in to go type: offset %x would go over slice boundary (len=%d)", word, len(output))
+		}
+	}
+	offset := binary.BigEndian.Uint64(word[24:])
+	if offset > uint64(len(output)) {
+		return 0, fmt.Errorf("abi: cannot marshal in to go type: offset %d would go over slice boundary (len=%d)", offset, len(output))
+	}
+	return int(offset), nil
+}
+
 // interprets a 32 byte slice as an offset and then determines which indice to look to decode the type.
 func lengthPrefixPointsTo(index int, output []byte) (start int, length int, err error) {
-	offset := int(binary.BigEndian.Uint64(output[index+24 : index+32]))
+	offset, err := readOffset(index, output)
+	if err != nil {
+		return 0, 0, err
+	}
 	if offset+32 > len(output) {
-		return 0, 0, fmt.Errorf("abi: cannot marshal in to go slice: offset %d would go over slice boundary (len=%d)", len(output), offset+32)
+		return 0, 0, fmt.Errorf("abi: cannot marshal in to go slice: offset %d would go over slice boundary (len=%d)", offset+32, len(output))
 	}
-	length = int(binary.BigEndian.Uint64(output[offset+24 : offset+32]))
-	if offset+32+length > len(output) {
-		return 0, 0, fmt.Errorf("abi: cannot marshal in to go type: length insufficient %d require %d", len(output), offset+32+length)
+	size := binary.BigEndian.Uint64(output[offset+24 : offset+32])
+	if size > uint64(len(output)-offset-32) {
+		return 0, 0, fmt.Errorf("abi: cannot marshal in to go type: length insufficient %d require %d", len(output), uint64(offset+32)+size)
 	}
-	start = offset + 32
+	start, length = offset+32, int(size)
 
 	//fmt.Printf("LENGTH PREFIX INFO: \nsize: %v\noffset: %v\nstart: %v\n", length, offset, start)
 	return
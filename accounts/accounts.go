@@ -103,6 +103,9 @@ type Wallet interface {
 	// SignVote requests the wallet to sign the given proposal.
 	SignVote(account Account, vote *types.Vote, chainID *big.Int) (*types.Vote, error)
 
+	// SignAnnounce requests the wallet to sign the given validator announcement.
+	SignAnnounce(account Account, announce *types.Announce, chainID *big.Int) (*types.Announce, error)
+
 	// SignHashWithPassphrase requests the wallet to sign the given hash with the
 	// given passphrase as extra authentication information.
 	//
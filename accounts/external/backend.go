@@ -0,0 +1,291 @@
+// Package external implements an account backend delegating all signing to an
+// external signer daemon reachable over RPC.
+package external
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	kowala "github.com/kowala-tech/kUSD"
+	"github.com/kowala-tech/kUSD/accounts"
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/common/hexutil"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/event"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/rlp"
+	"github.com/kowala-tech/kUSD/rpc"
+)
+
+// URLScheme is the protocol scheme prefixing the URLs of external signers.
+const URLScheme = "extapi"
+
+var (
+	// errSignerMismatch is returned if the signer returns a message signed by
+	// another account than the requested one.
+	errSignerMismatch = errors.New("message signed by another account")
+
+	// errMessageMismatch is returned if the signer returns a different message
+	// than the one it was requested to sign.
+	errMessageMismatch = errors.New("signed message differs from the requested one")
+
+	// errTokenTransport is returned if an authentication token is given for a
+	// signer not reached over HTTP.
+	errTokenTransport = errors.New("signer authentication requires an HTTP endpoint")
+)
+
+// ExternalBackend is an account backend wrapping a single external signer.
+type ExternalBackend struct {
+	signers []accounts.Wallet
+}
+
+// NewExternalBackend creates an account backend connected to the external signer
+// listening on the given endpoint (an IPC path or an HTTP/WS URL). A non-empty
+// token is sent as bearer token to a signer requiring authentication over HTTP.
+func NewExternalBackend(endpoint, token string) (*ExternalBackend, error) {
+	signer, err := NewExternalSigner(endpoint, token)
+	if err != nil {
+		return nil, err
+	}
+	return &ExternalBackend{signers: []accounts.Wallet{signer}}, nil
+}
+
+// Wallets implements accounts.Backend, returning the external signer.
+func (eb *ExternalBackend) Wallets() []accounts.Wallet {
+	return eb.signers
+}
+
+// Subscribe implements accounts.Backend. External signers never come and go, so
+// no events are ever delivered.
+func (eb *ExternalBackend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// ExternalSigner implements accounts.Wallet, forwarding all signing requests to
+// a signer daemon. Passphrases are never sent over the wire, the daemon is in
+// charge of unlocking its own keys.
+type ExternalSigner struct {
+	client   *rpc.Client
+	endpoint string
+	status   string
+
+	cache []accounts.Account // Accounts reported by the signer, retrieved lazily
+	lock  sync.RWMutex
+}
+
+// NewExternalSigner connects to the signer daemon listening on endpoint,
+// authenticating with token if not empty. Only HTTP endpoints take a token, IPC
+// endpoints are reachable by local processes only.
+func NewExternalSigner(endpoint, token string) (*ExternalSigner, error) {
+	if token != "" && !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, errTokenTransport
+	}
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		client.SetHeader("Authorization", "Bearer "+token)
+	}
+	return newExternalSigner(client, endpoint)
+}
+
+func newExternalSigner(client *rpc.Client, endpoint string) (*ExternalSigner, error) {
+	signer := &ExternalSigner{
+		client:   client,
+		endpoint: endpoint,
+	}
+	var version string
+	if err := client.Call(&version, "account_version"); err != nil {
+		return nil, fmt.Errorf("external signer unreachable: %v", err)
+	}
+	signer.status = fmt.Sprintf("ok [version=%v]", version)
+	return signer, nil
+}
+
+// URL implements accounts.Wallet, returning the endpoint of the signer.
+func (s *ExternalSigner) URL() accounts.URL {
+	return accounts.URL{Scheme: URLScheme, Path: s.endpoint}
+}
+
+// Status implements accounts.Wallet, returning the signer version reported
+// upon connecting.
+func (s *ExternalSigner) Status() (string, error) {
+	return s.status, nil
+}
+
+// Open implements accounts.Wallet, but is a noop since the connection to the
+// signer is established on creation.
+func (s *ExternalSigner) Open(passphrase string) error { return nil }
+
+// Close implements accounts.Wallet, but is a noop since the backend may still
+// need the connection.
+func (s *ExternalSigner) Close() error { return nil }
+
+// Accounts implements accounts.Wallet, returning the accounts the signer can
+// sign with.
+func (s *ExternalSigner) Accounts() []accounts.Account {
+	s.lock.RLock()
+	cache := s.cache
+	s.lock.RUnlock()
+
+	if cache != nil {
+		return cache
+	}
+	var addrs []common.Address
+	if err := s.client.Call(&addrs, "account_list"); err != nil {
+		log.Warn("Failed to list external signer accounts", "url", s.URL(), "err", err)
+		return nil
+	}
+	accs := make([]accounts.Account, len(addrs))
+	for i, addr := range addrs {
+		accs[i] = accounts.Account{Address: addr, URL: s.URL()}
+	}
+	s.lock.Lock()
+	s.cache = accs
+	s.lock.Unlock()
+
+	return accs
+}
+
+// Contains implements accounts.Wallet, returning whether a particular account
+// is held by the signer.
+func (s *ExternalSigner) Contains(account accounts.Account) bool {
+	for _, acc := range s.Accounts() {
+		if acc.Address == account.Address && (account.URL == (accounts.URL{}) || account.URL == acc.URL) {
+			return true
+		}
+	}
+	return false
+}
+
+// Derive implements accounts.Wallet, but is not supported by external signers.
+func (s *ExternalSigner) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return accounts.Account{}, accounts.ErrNotSupported
+}
+
+// SelfDerive implements accounts.Wallet, but is a noop for external signers.
+func (s *ExternalSigner) SelfDerive(base accounts.DerivationPath, chain kowala.ChainStateReader) {}
+
+// SignHash implements accounts.Wallet, but is not supported: signing arbitrary
+// hashes would allow circumventing the signer's double signing protection.
+func (s *ExternalSigner) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+// SignTx implements accounts.Wallet, requesting the signer to sign the given
+// transaction. The signature is checked to be the account's over the requested
+// transaction, the signer isn't trusted to return what it was asked for.
+func (s *ExternalSigner) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signed := new(types.Transaction)
+	if err := s.sign("account_signTransaction", account, tx, chainID, signed); err != nil {
+		return nil, err
+	}
+	if signed.ProtectedHash(chainID) != tx.ProtectedHash(chainID) {
+		return nil, errMessageMismatch
+	}
+	from, err := types.TxSender(types.NewAndromedaSigner(chainID), signed)
+	if err != nil {
+		return nil, err
+	}
+	if from != account.Address {
+		return nil, errSignerMismatch
+	}
+	return signed, nil
+}
+
+// SignProposal implements accounts.Wallet, requesting the signer to sign the
+// given proposal. Like transactions, the signature is checked before use.
+func (s *ExternalSigner) SignProposal(account accounts.Account, proposal *types.Proposal, chainID *big.Int) (*types.Proposal, error) {
+	signed := new(types.Proposal)
+	if err := s.sign("account_signProposal", account, proposal, chainID, signed); err != nil {
+		return nil, err
+	}
+	if signed.ProtectedHash(chainID) != proposal.ProtectedHash(chainID) {
+		return nil, errMessageMismatch
+	}
+	from, err := types.ProposalSender(types.NewAndromedaSigner(chainID), signed)
+	if err != nil {
+		return nil, err
+	}
+	if from != account.Address {
+		return nil, errSignerMismatch
+	}
+	return signed, nil
+}
+
+// SignVote implements accounts.Wallet, requesting the signer to sign the given
+// vote. Like transactions, the signature is checked before use.
+func (s *ExternalSigner) SignVote(account accounts.Account, vote *types.Vote, chainID *big.Int) (*types.Vote, error) {
+	signed := new(types.Vote)
+	if err := s.sign("account_signVote", account, vote, chainID, signed); err != nil {
+		return nil, err
+	}
+	if signed.ProtectedHash(chainID) != vote.ProtectedHash(chainID) {
+		return nil, errMessageMismatch
+	}
+	from, err := types.VoteSender(types.NewAndromedaSigner(chainID), signed)
+	if err != nil {
+		return nil, err
+	}
+	if from != account.Address {
+		return nil, errSignerMismatch
+	}
+	return signed, nil
+}
+
+// SignAnnounce implements accounts.Wallet, requesting the signer to sign the
+// given validator announcement. Like transactions, the signature is checked
+// before use.
+func (s *ExternalSigner) SignAnnounce(account accounts.Account, announce *types.Announce, chainID *big.Int) (*types.Announce, error) {
+	signed := new(types.Announce)
+	if err := s.sign("account_signAnnounce", account, announce, chainID, signed); err != nil {
+		return nil, err
+	}
+	if signed.ProtectedHash(chainID) != announce.ProtectedHash(chainID) {
+		return nil, errMessageMismatch
+	}
+	from, err := types.AnnounceSender(types.NewAndromedaSigner(chainID), signed)
+	if err != nil {
+		return nil, err
+	}
+	if from != account.Address {
+		return nil, errSignerMismatch
+	}
+	return signed, nil
+}
+
+// SignHashWithPassphrase implements accounts.Wallet, but is not supported since
+// the signer unlocks its own keys.
+func (s *ExternalSigner) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+// SignTxWithPassphrase implements accounts.Wallet, but is not supported since
+// the signer unlocks its own keys.
+func (s *ExternalSigner) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+// sign sends the RLP encoding of msg to the signer and decodes the signed
+// version returned into result.
+func (s *ExternalSigner) sign(method string, account accounts.Account, msg interface{}, chainID *big.Int, result interface{}) error {
+	if !s.Contains(account) {
+		return accounts.ErrUnknownAccount
+	}
+	data, err := rlp.EncodeToBytes(msg)
+	if err != nil {
+		return err
+	}
+	var res hexutil.Bytes
+	if err := s.client.Call(&res, method, account.Address, hexutil.Bytes(data), (*hexutil.Big)(chainID)); err != nil {
+		return err
+	}
+	return rlp.DecodeBytes(res, result)
+}
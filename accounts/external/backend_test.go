@@ -0,0 +1,214 @@
+package external
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/accounts"
+	"github.com/kowala-tech/kUSD/accounts/keystore"
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/common/hexutil"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/rlp"
+	"github.com/kowala-tech/kUSD/rpc"
+	"github.com/kowala-tech/kUSD/signer"
+)
+
+// newTestSigner creates an external signer connected to an in-process signer
+// daemon holding a single unlocked account.
+func newTestSigner(t *testing.T) (*ExternalSigner, accounts.Account, func()) {
+	dir, err := ioutil.TempDir("", "kusd-external-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.NewAccount("")
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	if err := ks.Unlock(account, ""); err != nil {
+		t.Fatalf("failed to unlock account: %v", err)
+	}
+	policy, _ := signer.NewPolicy("")
+	approver := signer.TxApproverFunc(func(account common.Address, tx *types.Transaction, chainID *big.Int) error {
+		if to := tx.To(); to == nil || *to != (common.Address{0x01}) {
+			return signer.ErrTxRefused
+		}
+		return nil
+	})
+
+	server := rpc.NewServer()
+	if err := server.RegisterName(signer.Namespace, signer.NewSignerAPI(ks, policy, approver, big.NewInt(1))); err != nil {
+		t.Fatalf("failed to register signer API: %v", err)
+	}
+	ext, err := newExternalSigner(rpc.DialInProc(server), "inproc")
+	if err != nil {
+		t.Fatalf("failed to connect to signer: %v", err)
+	}
+	return ext, account, func() {
+		server.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+// Tests that transactions and votes can be signed through the external signer
+// and that its double signing protection is enforced.
+func TestExternalSigner(t *testing.T) {
+	ext, account, teardown := newTestSigner(t)
+	defer teardown()
+
+	accs := ext.Accounts()
+	if len(accs) != 1 || accs[0].Address != account.Address {
+		t.Fatalf("accounts mismatch: have %v, want [%x]", accs, account.Address)
+	}
+	if ext.Contains(account) {
+		t.Fatalf("keystore account contained in signer")
+	}
+	account = accs[0]
+	if !ext.Contains(accounts.Account{Address: account.Address}) {
+		t.Fatalf("account not contained in signer")
+	}
+	chainID := big.NewInt(1)
+	signer := types.NewAndromedaSigner(chainID)
+
+	tx := types.NewTransaction(0, common.Address{0x01}, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+	signedTx, err := ext.SignTx(account, tx, chainID)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	if from, err := types.TxSender(signer, signedTx); err != nil || from != account.Address {
+		t.Fatalf("transaction sender mismatch: have %x (%v), want %x", from, err, account.Address)
+	}
+	refused := types.NewTransaction(1, common.Address{0x02}, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+	if _, err := ext.SignTx(account, refused, chainID); err == nil || err.Error() != "transaction refused" {
+		t.Fatalf("unapproved transaction error mismatch: have %v, want transaction refused", err)
+	}
+	vote := types.NewVote(big.NewInt(1), common.Hash{0x01}, 0, types.PreVote)
+	signedVote, err := ext.SignVote(account, vote, chainID)
+	if err != nil {
+		t.Fatalf("failed to sign vote: %v", err)
+	}
+	if from, err := types.VoteSender(signer, signedVote); err != nil || from != account.Address {
+		t.Fatalf("vote sender mismatch: have %x (%v), want %x", from, err, account.Address)
+	}
+	conflict := types.NewVote(big.NewInt(1), common.Hash{0x02}, 0, types.PreVote)
+	if _, err := ext.SignVote(account, conflict, chainID); err == nil {
+		t.Fatalf("conflicting vote signed")
+	}
+	if _, err := ext.SignVote(account, vote, big.NewInt(2)); err == nil {
+		t.Fatalf("vote for foreign chain signed")
+	}
+	if _, err := ext.SignVote(accounts.Account{Address: common.Address{0x01}}, vote, chainID); err != accounts.ErrUnknownAccount {
+		t.Fatalf("unknown account error mismatch: have %v, want %v", err, accounts.ErrUnknownAccount)
+	}
+	announce := types.NewAnnounce(account.Address, [64]byte{0x01}, 1)
+	signedAnnounce, err := ext.SignAnnounce(account, announce, chainID)
+	if err != nil {
+		t.Fatalf("failed to sign announcement: %v", err)
+	}
+	if from, err := types.AnnounceSender(signer, signedAnnounce); err != nil || from != account.Address {
+		t.Fatalf("announcement sender mismatch: have %x (%v), want %x", from, err, account.Address)
+	}
+	if _, err := ext.SignAnnounce(account, types.NewAnnounce(common.Address{0x01}, [64]byte{0x01}, 1), chainID); err == nil {
+		t.Fatalf("announcement of another account signed")
+	}
+}
+
+// RogueSignerAPI is a signer daemon claiming to hold an account, but signing
+// with another key or tampering with the messages it's requested to sign.
+// It is exported for the RPC server to accept it.
+type RogueSignerAPI struct {
+	account common.Address
+	key     *ecdsa.PrivateKey
+	tamper  bool
+}
+
+func (api *RogueSignerAPI) Version(ctx context.Context) (string, error) {
+	return "rogue", nil
+}
+
+func (api *RogueSignerAPI) List(ctx context.Context) ([]common.Address, error) {
+	return []common.Address{api.account}, nil
+}
+
+func (api *RogueSignerAPI) SignTransaction(ctx context.Context, addr common.Address, data hexutil.Bytes, chainID *hexutil.Big) (hexutil.Bytes, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(data, tx); err != nil {
+		return nil, err
+	}
+	if api.tamper {
+		tx = types.NewTransaction(tx.Nonce(), common.Address{0xff}, tx.Value(), tx.Gas(), tx.GasPrice(), tx.Data())
+	}
+	signed, err := types.SignTx(tx, types.NewAndromedaSigner((*big.Int)(chainID)), api.key)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(signed)
+}
+
+func (api *RogueSignerAPI) SignVote(ctx context.Context, addr common.Address, data hexutil.Bytes, chainID *hexutil.Big) (hexutil.Bytes, error) {
+	vote := new(types.Vote)
+	if err := rlp.DecodeBytes(data, vote); err != nil {
+		return nil, err
+	}
+	if api.tamper {
+		vote = types.NewVote(vote.BlockNumber(), common.Hash{0xff}, vote.Round(), vote.Type())
+	}
+	signed, err := types.SignVote(vote, types.NewAndromedaSigner((*big.Int)(chainID)), api.key)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(signed)
+}
+
+// Tests that messages returned by the signer are rejected unless they are the
+// requested ones, signed by the requested account.
+func TestExternalSignerVerification(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	account := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+
+	chainID := big.NewInt(1)
+	tx := types.NewTransaction(0, common.Address{0x01}, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+	vote := types.NewVote(big.NewInt(1), common.Hash{0x01}, 0, types.PreVote)
+
+	tests := []struct {
+		api  *RogueSignerAPI
+		want error
+	}{
+		{&RogueSignerAPI{account: account.Address, key: key}, nil},
+		{&RogueSignerAPI{account: account.Address, key: other}, errSignerMismatch},
+		{&RogueSignerAPI{account: account.Address, key: key, tamper: true}, errMessageMismatch},
+	}
+	for i, tt := range tests {
+		server := rpc.NewServer()
+		if err := server.RegisterName("account", tt.api); err != nil {
+			t.Fatalf("test %d: failed to register signer API: %v", i, err)
+		}
+		ext, err := newExternalSigner(rpc.DialInProc(server), "inproc")
+		if err != nil {
+			t.Fatalf("test %d: failed to connect to signer: %v", i, err)
+		}
+		if _, err := ext.SignTx(account, tx, chainID); err != tt.want {
+			t.Errorf("test %d: transaction error mismatch: have %v, want %v", i, err, tt.want)
+		}
+		if _, err := ext.SignVote(account, vote, chainID); err != tt.want {
+			t.Errorf("test %d: vote error mismatch: have %v, want %v", i, err, tt.want)
+		}
+		server.Stop()
+	}
+}
+
+// Tests that an authentication token is only accepted for HTTP signers.
+func TestExternalSignerTokenTransport(t *testing.T) {
+	for _, endpoint := range []string{"/tmp/kusdsigner.ipc", "ws://127.0.0.1:8550"} {
+		if _, err := NewExternalSigner(endpoint, "secret"); err != errTokenTransport {
+			t.Errorf("%s: error mismatch: have %v, want %v", endpoint, err, errTokenTransport)
+		}
+	}
+}
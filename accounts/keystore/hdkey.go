@@ -0,0 +1,106 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/kowala-tech/kUSD/accounts"
+	"github.com/kowala-tech/kUSD/common/math"
+	"github.com/kowala-tech/kUSD/crypto"
+)
+
+// errInvalidChildKey is returned if a derivation step yields an invalid key. The
+// probability of this is lower than 1 in 2^127, but the spec requires it to be
+// handled.
+var errInvalidChildKey = errors.New("invalid derived key, use the next index")
+
+// hardenedKeyStart is the index of the first hardened child key.
+const hardenedKeyStart = 0x80000000
+
+// masterKeyHMACKey is the HMAC key used to derive the master key from a seed,
+// as mandated by BIP-32.
+var masterKeyHMACKey = []byte("Bitcoin seed")
+
+// extendedKey is a BIP-32 extended private key.
+type extendedKey struct {
+	key       []byte // 32 byte private key
+	chainCode []byte // 32 byte chain code
+}
+
+// newMasterKey derives the BIP-32 master key from a seed.
+func newMasterKey(seed []byte) (*extendedKey, error) {
+	mac := hmac.New(sha512.New, masterKeyHMACKey)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	if !validPrivateKey(sum[:32]) {
+		return nil, errInvalidChildKey
+	}
+	return &extendedKey{key: sum[:32], chainCode: sum[32:]}, nil
+}
+
+// child derives the extended child key at the given index.
+func (k *extendedKey) child(index uint32) (*extendedKey, error) {
+	var data []byte
+	if index >= hardenedKeyStart {
+		data = append([]byte{0x00}, k.key...)
+	} else {
+		priv, err := crypto.ToECDSA(k.key)
+		if err != nil {
+			return nil, err
+		}
+		data = compressPubkey(&priv.PublicKey)
+	}
+	var indexBytes [4]byte
+	binary.BigEndian.PutUint32(indexBytes[:], index)
+	data = append(data, indexBytes[:]...)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	if !validPrivateKey(sum[:32]) {
+		return nil, errInvalidChildKey
+	}
+	child := new(big.Int).SetBytes(sum[:32])
+	child.Add(child, new(big.Int).SetBytes(k.key))
+	child.Mod(child, crypto.S256().Params().N)
+	if child.Sign() == 0 {
+		return nil, errInvalidChildKey
+	}
+	return &extendedKey{key: math.PaddedBigBytes(child, 32), chainCode: sum[32:]}, nil
+}
+
+// deriveKey derives the private key along the given path from a seed.
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	key, err := newMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range path {
+		if key, err = key.child(index); err != nil {
+			return nil, err
+		}
+	}
+	return crypto.ToECDSA(key.key)
+}
+
+// validPrivateKey checks whether a 32 byte big endian number is a valid
+// secp256k1 private key, that is non-zero and lower than the curve order.
+func validPrivateKey(key []byte) bool {
+	k := new(big.Int).SetBytes(key)
+	return k.Sign() > 0 && k.Cmp(crypto.S256().Params().N) < 0
+}
+
+// compressPubkey encodes a public key in the 33 byte compressed format.
+func compressPubkey(pub *ecdsa.PublicKey) []byte {
+	format := byte(0x02)
+	if pub.Y.Bit(0) == 1 {
+		format = 0x03
+	}
+	return append([]byte{format}, math.PaddedBigBytes(pub.X, 32)...)
+}
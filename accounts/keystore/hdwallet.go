@@ -0,0 +1,555 @@
+package keystore
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	kowala "github.com/kowala-tech/kUSD"
+	"github.com/kowala-tech/kUSD/accounts"
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/pborman/uuid"
+	"github.com/tyler-smith/go-bip39"
+)
+
+var (
+	// ErrInvalidMnemonic is returned if a mnemonic fails the BIP-39 word list or
+	// checksum validation.
+	ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+	// ErrMnemonicExists is returned if a mnemonic is imported that the keystore
+	// already holds.
+	ErrMnemonicExists = errors.New("mnemonic already exists")
+)
+
+const (
+	// seedDir is the keystore subdirectory the encrypted mnemonics are stored in,
+	// out of the way of the plain key files.
+	seedDir = "seeds"
+
+	// mnemonicEntropy is the bit size of the entropy of new mnemonics, resulting
+	// in 24 words.
+	mnemonicEntropy = 256
+
+	// seedVersion is the version of the encrypted mnemonic file format.
+	seedVersion = 1
+)
+
+// encryptedSeedJSON is the on disk format of a mnemonic, encrypted with the same
+// scheme as the key files. The derived accounts are kept in plain text, so that
+// they can be listed without decrypting the mnemonic.
+type encryptedSeedJSON struct {
+	Id       string            `json:"id"`
+	Version  int               `json:"version"`
+	Crypto   cryptoJSON        `json:"crypto"`
+	Accounts []seedAccountJSON `json:"accounts"`
+}
+
+type seedAccountJSON struct {
+	Address string `json:"address"`
+	Path    string `json:"path"`
+}
+
+// walletsByURL orders the single-key and HD wallets of the keystore by their
+// location, as the account manager expects backends to.
+type walletsByURL []accounts.Wallet
+
+func (s walletsByURL) Len() int           { return len(s) }
+func (s walletsByURL) Less(i, j int) bool { return s[i].URL().Cmp(s[j].URL()) < 0 }
+func (s walletsByURL) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// hdWallet implements the accounts.Wallet interface for the hierarchical
+// deterministic accounts derived from a BIP-39 mnemonic.
+type hdWallet struct {
+	url      accounts.URL // Location of the encrypted mnemonic file
+	keystore *KeyStore    // Keystore the mnemonic is stored in
+	id       string       // Unique identifier of the mnemonic
+	crypto   cryptoJSON   // Encrypted mnemonic
+
+	seed     []byte                                     // BIP-39 seed while the wallet is open, nil otherwise
+	accounts []accounts.Account                         // List of derivated accounts pinned on the wallet
+	paths    map[common.Address]accounts.DerivationPath // Known derivation paths for signing operations
+
+	deriveQuit chan struct{} // Channel to terminate any running self-derivation
+
+	stateLock sync.RWMutex // Protects read and write access to the wallet struct fields
+}
+
+// loadHDWallet loads an encrypted mnemonic file into a wallet.
+func loadHDWallet(ks *KeyStore, file string) (*hdWallet, error) {
+	blob, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var enc encryptedSeedJSON
+	if err := json.Unmarshal(blob, &enc); err != nil {
+		return nil, err
+	}
+	if enc.Version != seedVersion {
+		return nil, fmt.Errorf("version not supported: %v", enc.Version)
+	}
+	w := &hdWallet{
+		url:      accounts.URL{Scheme: KeyStoreScheme, Path: file},
+		keystore: ks,
+		id:       enc.Id,
+		crypto:   enc.Crypto,
+		paths:    make(map[common.Address]accounts.DerivationPath),
+	}
+	for _, acc := range enc.Accounts {
+		path, err := accounts.ParseDerivationPath(acc.Path)
+		if err != nil {
+			return nil, err
+		}
+		w.pin(common.HexToAddress(acc.Address), path)
+	}
+	return w, nil
+}
+
+// store writes the encrypted mnemonic and the pinned accounts to disk.
+//
+// The caller must hold the state lock.
+func (w *hdWallet) store() error {
+	enc := encryptedSeedJSON{
+		Id:       w.id,
+		Version:  seedVersion,
+		Crypto:   w.crypto,
+		Accounts: make([]seedAccountJSON, len(w.accounts)),
+	}
+	for i, acc := range w.accounts {
+		enc.Accounts[i] = seedAccountJSON{
+			Address: acc.Address.Hex(),
+			Path:    w.paths[acc.Address].String(),
+		}
+	}
+	blob, err := json.Marshal(enc)
+	if err != nil {
+		return err
+	}
+	return writeKeyFile(w.url.Path, blob)
+}
+
+// pin adds an account to the ones tracked by the wallet, reporting whether it
+// was not tracked yet.
+//
+// The caller must hold the state lock.
+func (w *hdWallet) pin(address common.Address, path accounts.DerivationPath) bool {
+	if _, ok := w.paths[address]; ok {
+		return false
+	}
+	w.accounts = append(w.accounts, w.account(address, path))
+	w.paths[address] = path
+	return true
+}
+
+// account assembles the account derived at the given path.
+func (w *hdWallet) account(address common.Address, path accounts.DerivationPath) accounts.Account {
+	return accounts.Account{
+		Address: address,
+		URL:     accounts.URL{Scheme: w.url.Scheme, Path: fmt.Sprintf("%s/%s", w.url.Path, path)},
+	}
+}
+
+// decryptSeed decrypts the mnemonic with the given passphrase and returns the
+// BIP-39 seed generated from it.
+func (w *hdWallet) decryptSeed(passphrase string) ([]byte, error) {
+	mnemonic, err := decryptData(w.crypto, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return bip39.NewSeed(string(mnemonic), ""), nil
+}
+
+// URL implements accounts.Wallet, returning the location of the mnemonic file.
+func (w *hdWallet) URL() accounts.URL {
+	return w.url
+}
+
+// Status implements accounts.Wallet, returning whether the mnemonic is decrypted
+// and accounts can be derived or not.
+func (w *hdWallet) Status() (string, error) {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	if w.seed == nil {
+		return "Closed", nil
+	}
+	return "Open", nil
+}
+
+// Open implements accounts.Wallet, decrypting the mnemonic to allow deriving
+// accounts and signing with them.
+func (w *hdWallet) Open(passphrase string) error {
+	w.stateLock.Lock()
+	if w.seed != nil {
+		w.stateLock.Unlock()
+		return accounts.ErrWalletAlreadyOpen
+	}
+	seed, err := w.decryptSeed(passphrase)
+	if err != nil {
+		w.stateLock.Unlock()
+		return err
+	}
+	w.seed = seed
+	w.stateLock.Unlock()
+
+	w.keystore.updateFeed.Send(accounts.WalletEvent{Wallet: w, Kind: accounts.WalletOpened})
+	return nil
+}
+
+// Close implements accounts.Wallet, wiping the decrypted seed from memory and
+// stopping any running self-derivation.
+func (w *hdWallet) Close() error {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	if w.deriveQuit != nil {
+		close(w.deriveQuit)
+		w.deriveQuit = nil
+	}
+	for i := range w.seed {
+		w.seed[i] = 0
+	}
+	w.seed = nil
+	return nil
+}
+
+// Accounts implements accounts.Wallet, returning the list of accounts pinned to
+// the wallet, regardless of it being open or not.
+func (w *hdWallet) Accounts() []accounts.Account {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	cpy := make([]accounts.Account, len(w.accounts))
+	copy(cpy, w.accounts)
+	return cpy
+}
+
+// Contains implements accounts.Wallet, returning whether a particular account is
+// or is not pinned into this wallet instance.
+func (w *hdWallet) Contains(account accounts.Account) bool {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	path, ok := w.paths[account.Address]
+	if !ok {
+		return false
+	}
+	return account.URL == (accounts.URL{}) || account.URL == w.account(account.Address, path).URL
+}
+
+// Derive implements accounts.Wallet, deriving a new account at the specific
+// derivation path. If pin is set to true, the account will be added to the list
+// of tracked accounts and persisted along the mnemonic.
+func (w *hdWallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	if w.seed == nil {
+		return accounts.Account{}, accounts.ErrWalletClosed
+	}
+	key, err := deriveKey(w.seed, path)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	zeroKey(key)
+
+	if pin && w.pin(address, path) {
+		if err := w.store(); err != nil {
+			return accounts.Account{}, err
+		}
+	}
+	return w.account(address, path), nil
+}
+
+// SelfDerive implements accounts.Wallet, discovering the accounts following base
+// that were used on chain (i.e. have a nonce or balance) and pinning them, along
+// with the first unused one. Discovery runs in the background while the wallet
+// is open. A nil chain state reader stops any running discovery.
+func (w *hdWallet) SelfDerive(base accounts.DerivationPath, chain kowala.ChainStateReader) {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	if w.deriveQuit != nil {
+		close(w.deriveQuit)
+		w.deriveQuit = nil
+	}
+	if chain == nil || w.seed == nil {
+		return
+	}
+	w.deriveQuit = make(chan struct{})
+	go w.selfDerive(base, chain, w.deriveQuit)
+}
+
+// selfDerive derives accounts starting at base until it finds an unused one.
+func (w *hdWallet) selfDerive(base accounts.DerivationPath, chain kowala.ChainStateReader, quit chan struct{}) {
+	path := make(accounts.DerivationPath, len(base))
+	copy(path, base)
+
+	ctx := context.Background()
+	for {
+		select {
+		case <-quit:
+			return
+		default:
+		}
+		account, err := w.Derive(path, false)
+		if err != nil {
+			log.Warn("HD wallet account derivation failed", "url", w.url, "err", err)
+			return
+		}
+		balance, err := chain.BalanceAt(ctx, account.Address, nil)
+		if err != nil {
+			log.Warn("HD wallet balance retrieval failed", "err", err)
+			return
+		}
+		nonce, err := chain.NonceAt(ctx, account.Address, nil)
+		if err != nil {
+			log.Warn("HD wallet nonce retrieval failed", "err", err)
+			return
+		}
+		// Pin the account, stopping at the first unused one
+		if _, err := w.Derive(path, true); err != nil {
+			log.Warn("HD wallet account pinning failed", "url", w.url, "err", err)
+			return
+		}
+		if balance.Sign() == 0 && nonce == 0 {
+			return
+		}
+		log.Debug("HD wallet discovered new account", "address", account.Address, "path", path, "balance", balance, "nonce", nonce)
+
+		next := make(accounts.DerivationPath, len(path))
+		copy(next, path)
+		next[len(next)-1]++
+		path = next
+	}
+}
+
+// signingKey derives the private key of a pinned account from the given seed.
+//
+// The caller must hold the state lock.
+func (w *hdWallet) signingKey(account accounts.Account, seed []byte) (*ecdsa.PrivateKey, error) {
+	path, ok := w.paths[account.Address]
+	if !ok {
+		return nil, accounts.ErrUnknownAccount
+	}
+	if account.URL != (accounts.URL{}) && account.URL != w.account(account.Address, path).URL {
+		return nil, accounts.ErrUnknownAccount
+	}
+	if seed == nil {
+		return nil, accounts.ErrWalletClosed
+	}
+	return deriveKey(seed, path)
+}
+
+// withKey runs fn with the private key of the given account, derived from the
+// seed of the open wallet.
+func (w *hdWallet) withKey(account accounts.Account, fn func(*ecdsa.PrivateKey) error) error {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	key, err := w.signingKey(account, w.seed)
+	if err != nil {
+		return err
+	}
+	defer zeroKey(key)
+	return fn(key)
+}
+
+// withPassphraseKey runs fn with the private key of the given account, derived
+// from the mnemonic decrypted with passphrase.
+func (w *hdWallet) withPassphraseKey(account accounts.Account, passphrase string, fn func(*ecdsa.PrivateKey) error) error {
+	seed, err := w.decryptSeed(passphrase)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for i := range seed {
+			seed[i] = 0
+		}
+	}()
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	key, err := w.signingKey(account, seed)
+	if err != nil {
+		return err
+	}
+	defer zeroKey(key)
+	return fn(key)
+}
+
+// SignHash implements accounts.Wallet, signing the hash with a derived account.
+func (w *hdWallet) SignHash(account accounts.Account, hash []byte) (sig []byte, err error) {
+	err = w.withKey(account, func(key *ecdsa.PrivateKey) error {
+		sig, err = crypto.Sign(hash, key)
+		return err
+	})
+	return sig, err
+}
+
+// SignTx implements accounts.Wallet, signing the transaction with a derived
+// account.
+func (w *hdWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (signed *types.Transaction, err error) {
+	err = w.withKey(account, func(key *ecdsa.PrivateKey) error {
+		signed, err = types.SignTx(tx, types.NewAndromedaSigner(chainID), key)
+		return err
+	})
+	return signed, err
+}
+
+// SignProposal implements accounts.Wallet, signing the proposal with a derived
+// account.
+func (w *hdWallet) SignProposal(account accounts.Account, proposal *types.Proposal, chainID *big.Int) (signed *types.Proposal, err error) {
+	err = w.withKey(account, func(key *ecdsa.PrivateKey) error {
+		signed, err = types.SignProposal(proposal, types.NewAndromedaSigner(chainID), key)
+		return err
+	})
+	return signed, err
+}
+
+// SignVote implements accounts.Wallet, signing the vote with a derived account.
+func (w *hdWallet) SignVote(account accounts.Account, vote *types.Vote, chainID *big.Int) (signed *types.Vote, err error) {
+	err = w.withKey(account, func(key *ecdsa.PrivateKey) error {
+		signed, err = types.SignVote(vote, types.NewAndromedaSigner(chainID), key)
+		return err
+	})
+	return signed, err
+}
+
+// SignAnnounce implements accounts.Wallet, signing the validator announcement
+// with a derived account.
+func (w *hdWallet) SignAnnounce(account accounts.Account, announce *types.Announce, chainID *big.Int) (signed *types.Announce, err error) {
+	err = w.withKey(account, func(key *ecdsa.PrivateKey) error {
+		signed, err = types.SignAnnounce(announce, types.NewAndromedaSigner(chainID), key)
+		return err
+	})
+	return signed, err
+}
+
+// SignHashWithPassphrase implements accounts.Wallet, signing the hash with a
+// derived account, decrypting the mnemonic with the given passphrase.
+func (w *hdWallet) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) (sig []byte, err error) {
+	err = w.withPassphraseKey(account, passphrase, func(key *ecdsa.PrivateKey) error {
+		sig, err = crypto.Sign(hash, key)
+		return err
+	})
+	return sig, err
+}
+
+// SignTxWithPassphrase implements accounts.Wallet, signing the transaction with
+// a derived account, decrypting the mnemonic with the given passphrase.
+func (w *hdWallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (signed *types.Transaction, err error) {
+	err = w.withPassphraseKey(account, passphrase, func(key *ecdsa.PrivateKey) error {
+		signed, err = types.SignTx(tx, types.NewAndromedaSigner(chainID), key)
+		return err
+	})
+	return signed, err
+}
+
+// loadSeeds loads all the encrypted mnemonics from the seed directory.
+func (ks *KeyStore) loadSeeds() {
+	files, err := ioutil.ReadDir(ks.seedDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn("Failed to read mnemonic directory", "path", ks.seedDir, "err", err)
+		}
+		return
+	}
+	for _, fi := range files {
+		if skipKeyFile(fi) {
+			continue
+		}
+		path := filepath.Join(ks.seedDir, fi.Name())
+		wallet, err := loadHDWallet(ks, path)
+		if err != nil {
+			log.Warn("Failed to load mnemonic", "path", path, "err", err)
+			continue
+		}
+		ks.seeds = append(ks.seeds, wallet)
+	}
+}
+
+// NewMnemonic generates a new BIP-39 mnemonic, encrypts it with passphrase and
+// stores it in the keystore. The first account along the default derivation
+// path is pinned to the returned wallet. The mnemonic is returned so it can be
+// backed up; it's never shown again.
+func (ks *KeyStore) NewMnemonic(passphrase string) (string, accounts.Wallet, error) {
+	entropy, err := bip39.NewEntropy(mnemonicEntropy)
+	if err != nil {
+		return "", nil, err
+	}
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return "", nil, err
+	}
+	wallet, err := ks.ImportMnemonic(mnemonic, passphrase)
+	if err != nil {
+		return "", nil, err
+	}
+	return mnemonic, wallet, nil
+}
+
+// ImportMnemonic stores the given BIP-39 mnemonic into the keystore, encrypting
+// it with passphrase. The first account along the default derivation path is
+// pinned to the returned wallet.
+func (ks *KeyStore) ImportMnemonic(mnemonic, passphrase string) (accounts.Wallet, error) {
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, ErrInvalidMnemonic
+	}
+	key, err := deriveKey(bip39.NewSeed(mnemonic, ""), accounts.DefaultBaseDerivationPath)
+	if err != nil {
+		return nil, err
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	zeroKey(key)
+
+	ks.mu.Lock()
+	for _, wallet := range ks.seeds {
+		if wallet.Contains(accounts.Account{Address: address}) {
+			ks.mu.Unlock()
+			return nil, ErrMnemonicExists
+		}
+	}
+	ks.mu.Unlock()
+
+	scryptN, scryptP := StandardScryptN, StandardScryptP
+	if storage, ok := ks.storage.(*keyStorePassphrase); ok {
+		scryptN, scryptP = storage.scryptN, storage.scryptP
+	}
+	enc, err := encryptData([]byte(mnemonic), passphrase, scryptN, scryptP)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.NewRandom()
+	name := fmt.Sprintf("UTC--%s--%s", toISO8601(time.Now().UTC()), id.String())
+
+	wallet := &hdWallet{
+		url:      accounts.URL{Scheme: KeyStoreScheme, Path: filepath.Join(ks.seedDir, name)},
+		keystore: ks,
+		id:       id.String(),
+		crypto:   enc,
+		paths:    make(map[common.Address]accounts.DerivationPath),
+	}
+	wallet.pin(address, accounts.DefaultBaseDerivationPath)
+	if err := wallet.store(); err != nil {
+		return nil, err
+	}
+	ks.mu.Lock()
+	ks.seeds = append(ks.seeds, wallet)
+	ks.mu.Unlock()
+
+	ks.updateFeed.Send(accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletArrived})
+	return wallet, nil
+}
@@ -0,0 +1,113 @@
+package keystore
+
+import (
+	"encoding/hex"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/accounts"
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/crypto"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+// Tests key derivation against the BIP-32 test vector 1.
+func TestHDKeyDerivation(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+
+	tests := []struct {
+		path string
+		key  string
+	}{
+		{"m/0'", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{"m/0'/1/2'/2/1000000000", "471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8"},
+	}
+	for i, tt := range tests {
+		path, err := accounts.ParseDerivationPath(tt.path)
+		if err != nil {
+			t.Fatalf("test %d: failed to parse path: %v", i, err)
+		}
+		key, err := deriveKey(seed, path)
+		if err != nil {
+			t.Fatalf("test %d: failed to derive key: %v", i, err)
+		}
+		if have := hex.EncodeToString(crypto.FromECDSA(key)); have != tt.key {
+			t.Errorf("test %d: key mismatch: have %s, want %s", i, have, tt.key)
+		}
+	}
+}
+
+// Tests that mnemonics can be imported, derive the expected accounts, sign with
+// them and survive a keystore reload.
+func TestHDWallet(t *testing.T) {
+	dir, ks := tmpKeyStore(t, true)
+	defer os.RemoveAll(dir)
+
+	wallet, err := ks.ImportMnemonic(testMnemonic, "foo")
+	if err != nil {
+		t.Fatalf("failed to import mnemonic: %v", err)
+	}
+	if _, err := ks.ImportMnemonic(testMnemonic, "bar"); err != ErrMnemonicExists {
+		t.Fatalf("duplicate import error mismatch: have %v, want %v", err, ErrMnemonicExists)
+	}
+	if _, err := ks.ImportMnemonic("abandon abandon about", "foo"); err != ErrInvalidMnemonic {
+		t.Fatalf("invalid import error mismatch: have %v, want %v", err, ErrInvalidMnemonic)
+	}
+	first := common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94")
+	if accs := wallet.Accounts(); len(accs) != 1 || accs[0].Address != first {
+		t.Fatalf("pinned accounts mismatch: have %v, want %x", accs, first)
+	}
+	// Deriving requires the wallet to be open
+	path, _ := accounts.ParseDerivationPath("m/44'/60'/0'/0/1")
+	if _, err := wallet.Derive(path, true); err != accounts.ErrWalletClosed {
+		t.Fatalf("closed derivation error mismatch: have %v, want %v", err, accounts.ErrWalletClosed)
+	}
+	if err := wallet.Open("bar"); err != ErrDecrypt {
+		t.Fatalf("open error mismatch: have %v, want %v", err, ErrDecrypt)
+	}
+	if err := wallet.Open("foo"); err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	second, err := wallet.Derive(path, true)
+	if err != nil {
+		t.Fatalf("failed to derive account: %v", err)
+	}
+	if !strings.HasPrefix(second.URL.Path, wallet.URL().Path) {
+		t.Errorf("account url %s not within wallet %s", second.URL, wallet.URL())
+	}
+	// Sign with the derived account and check the recovered sender
+	tx := types.NewTransaction(0, first, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+	signed, err := wallet.SignTx(second, tx, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	if from, err := types.TxSender(types.NewAndromedaSigner(big.NewInt(1)), signed); err != nil || from != second.Address {
+		t.Errorf("sender mismatch: have %x (%v), want %x", from, err, second.Address)
+	}
+	wallet.Close()
+	if _, err := wallet.SignTx(second, tx, big.NewInt(1)); err != accounts.ErrWalletClosed {
+		t.Errorf("closed signing error mismatch: have %v, want %v", err, accounts.ErrWalletClosed)
+	}
+	if _, err := wallet.SignTxWithPassphrase(second, "foo", tx, big.NewInt(1)); err != nil {
+		t.Errorf("failed to sign with passphrase: %v", err)
+	}
+	// Reload the keystore and check the pinned accounts
+	ks = NewKeyStore(dir, veryLightScryptN, veryLightScryptP)
+
+	var found accounts.Wallet
+	for _, w := range ks.Wallets() {
+		if w.URL() == wallet.URL() {
+			found = w
+		}
+	}
+	if found == nil {
+		t.Fatalf("wallet %s not reloaded", wallet.URL())
+	}
+	if accs := found.Accounts(); len(accs) != 2 || accs[0].Address != first || accs[1] != second {
+		t.Errorf("reloaded accounts mismatch: have %v", accs)
+	}
+}
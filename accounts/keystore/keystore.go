@@ -30,6 +30,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
@@ -63,6 +64,8 @@ type KeyStore struct {
 	unlocked map[common.Address]*unlocked // Currently unlocked account (decrypted private keys)
 
 	wallets     []accounts.Wallet       // Wallet wrappers around the individual key files
+	seeds       []*hdWallet             // HD wallets around the encrypted mnemonics
+	seedDir     string                  // Directory the encrypted mnemonics are stored in
 	updateFeed  event.Feed              // Event feed to notify wallet additions/removals
 	updateScope event.SubscriptionScope // Subscription scope tracking current live listeners
 	updating    bool                    // Whether the event notification loop is running
@@ -113,10 +116,13 @@ func (ks *KeyStore) init(keydir string) {
 	for i := 0; i < len(accs); i++ {
 		ks.wallets[i] = &keystoreWallet{account: accs[i], keystore: ks}
 	}
+	// Load the HD wallets backed by mnemonics
+	ks.seedDir = filepath.Join(keydir, seedDir)
+	ks.loadSeeds()
 }
 
 // Wallets implements accounts.Backend, returning all single-key wallets from the
-// keystore directory.
+// keystore directory, along with the HD wallets of the stored mnemonics.
 func (ks *KeyStore) Wallets() []accounts.Wallet {
 	// Make sure the list of wallets is in sync with the account cache
 	ks.refreshWallets()
@@ -124,8 +130,12 @@ func (ks *KeyStore) Wallets() []accounts.Wallet {
 	ks.mu.RLock()
 	defer ks.mu.RUnlock()
 
-	cpy := make([]accounts.Wallet, len(ks.wallets))
+	cpy := make([]accounts.Wallet, len(ks.wallets), len(ks.wallets)+len(ks.seeds))
 	copy(cpy, ks.wallets)
+	for _, wallet := range ks.seeds {
+		cpy = append(cpy, wallet)
+	}
+	sort.Sort(walletsByURL(cpy))
 	return cpy
 }
 
@@ -295,6 +305,20 @@ func (ks *KeyStore) SignVote(a accounts.Account, vote *types.Vote, chainID *big.
 	return types.SignVote(vote, types.NewAndromedaSigner(chainID), unlockedKey.PrivateKey)
 }
 
+// SignAnnounce signs the given validator announcement with the requested account.
+func (ks *KeyStore) SignAnnounce(a accounts.Account, announce *types.Announce, chainID *big.Int) (*types.Announce, error) {
+	// Look up the key to sign with and abort if it cannot be found
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	unlockedKey, found := ks.unlocked[a.Address]
+	if !found {
+		return nil, ErrLocked
+	}
+
+	return types.SignAnnounce(announce, types.NewAndromedaSigner(chainID), unlockedKey.PrivateKey)
+}
+
 // SignProposal signs the given proposal with the requested account.
 func (ks *KeyStore) SignProposal(a accounts.Account, proposal *types.Proposal, chainID *big.Int) (*types.Proposal, error) {
 	// Look up the key to sign with and abort if it cannot be found
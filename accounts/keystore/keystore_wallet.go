@@ -118,6 +118,18 @@ func (w *keystoreWallet) SignVote(account accounts.Account, vote *types.Vote, ch
 	return w.keystore.SignVote(account, vote, chainID)
 }
 
+func (w *keystoreWallet) SignAnnounce(account accounts.Account, announce *types.Announce, chainID *big.Int) (*types.Announce, error) {
+	// Make sure the requested account is contained within
+	if account.Address != w.account.Address {
+		return nil, accounts.ErrUnknownAccount
+	}
+	if account.URL != (accounts.URL{}) && account.URL != w.account.URL {
+		return nil, accounts.ErrUnknownAccount
+	}
+	// Account seems valid, request the keystore to sign
+	return w.keystore.SignAnnounce(account, announce, chainID)
+}
+
 // SignHashWithPassphrase implements accounts.Wallet, attempting to sign the
 // given hash with the given account using passphrase as extra authentication.
 func (w *keystoreWallet) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
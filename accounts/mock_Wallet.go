@@ -210,6 +210,29 @@ func (_m *MockWallet) SignTxWithPassphrase(account Account, passphrase string, t
 	return r0, r1
 }
 
+// SignAnnounce provides a mock function with given fields: account, announce, chainID
+func (_m *MockWallet) SignAnnounce(account Account, announce *types.Announce, chainID *big.Int) (*types.Announce, error) {
+	ret := _m.Called(account, announce, chainID)
+
+	var r0 *types.Announce
+	if rf, ok := ret.Get(0).(func(Account, *types.Announce, *big.Int) *types.Announce); ok {
+		r0 = rf(account, announce, chainID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*types.Announce)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(Account, *types.Announce, *big.Int) error); ok {
+		r1 = rf(account, announce, chainID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // SignVote provides a mock function with given fields: account, vote, chainID
 func (_m *MockWallet) SignVote(account Account, vote *types.Vote, chainID *big.Int) (*types.Vote, error) {
 	ret := _m.Called(account, vote, chainID)
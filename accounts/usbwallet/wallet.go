@@ -541,6 +541,12 @@ func (w *wallet) SignVote(account accounts.Account, vote *types.Vote, chainID *b
 	return nil, nil
 }
 
+// SignAnnounce implements accounts.Wallet, however validator announcements are
+// not supported by hardware wallets, so this method always returns an error.
+func (w *wallet) SignAnnounce(account accounts.Account, announce *types.Announce, chainID *big.Int) (*types.Announce, error) {
+	return nil, accounts.ErrNotSupported
+}
+
 // SignHashWithPassphrase implements accounts.Wallet, however signing arbitrary
 // data is not supported for Ledger wallets, so this method will always return
 // an error.
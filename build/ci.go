@@ -75,6 +75,7 @@ var (
 		executablePath("bootnode"),
 		executablePath("evm"),
 		executablePath("kusd"),
+		executablePath("kusdsigner"),
 		executablePath("puppeth"),
 		executablePath("rlpdump"),
 		executablePath("swarm"),
@@ -99,6 +100,10 @@ var (
 			Name:        "kusd",
 			Description: "Ethereum CLI client.",
 		},
+		{
+			Name:        "kusdsigner",
+			Description: "Kowala external signer daemon.",
+		},
 		{
 			Name:        "puppeth",
 			Description: "Ethereum private network manager.",
@@ -0,0 +1,306 @@
+// dnslist is a command-line tool for publishing DNS node lists.
+//
+// A node list lives in a directory holding the list of node records and the
+// tree metadata. The list is either nodes.json, as written by the crawler or
+// by a sync, or nodes.txt, holding one "enr:" record per line:
+//
+//     $ dnslist sign -domain nodes.example.org mylist/ signer.key
+//     enrtree://AM5FCQLWIZX2QFPNJAP7VUERCCRNGRHWZG3YYHIUV7BVDQ5FDPRT2@nodes.example.org
+//
+//     $ dnslist to-txt mylist/ records.json
+//
+// The TXT records in records.json are then deployed to the DNS zone of the
+// domain. Published lists can be downloaded with the sync command:
+//
+//     $ dnslist sync enrtree://AM5FCQLWIZX2QFPNJAP7VUERCCRNGRHWZG3YYHIUV7BVDQ5FDPRT2@nodes.example.org mylist/
+//
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kowala-tech/kUSD/cmd/utils"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/p2p/discover"
+	"github.com/kowala-tech/kUSD/p2p/dnsdisc"
+	"github.com/kowala-tech/kUSD/p2p/enr"
+	"gopkg.in/urfave/cli.v1"
+)
+
+const (
+	infoFile      = "enrtree-info.json"
+	nodesFile     = "nodes.json"
+	nodesTextFile = "nodes.txt"
+)
+
+func main() {
+	app := cli.NewApp()
+	app.Usage = "DNS node list publishing tool"
+	app.Commands = []cli.Command{
+		{
+			Name:      "sign",
+			Usage:     "sign the node list in a directory",
+			ArgsUsage: "<dir> <keyfile>",
+			Action:    signList,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "domain",
+					Usage: "domain name of the list (defaults to the one of the last signature)",
+				},
+				cli.UintFlag{
+					Name:  "seq",
+					Usage: "sequence number of the list (defaults to the last one plus one)",
+				},
+			},
+		},
+		{
+			Name:      "to-txt",
+			Usage:     "create the DNS TXT records of a signed node list",
+			ArgsUsage: "<dir> [<output.json>]",
+			Action:    listToTXT,
+		},
+		{
+			Name:      "sync",
+			Usage:     "download a published node list",
+			ArgsUsage: "<enrtree-url> [<dir>]",
+			Action:    syncList,
+		},
+	}
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// treeInfo is the metadata of a node list, stored next to its nodes.
+type treeInfo struct {
+	URL   string   `json:"url,omitempty"` // enrtree:// URL of the last signature
+	Seq   uint     `json:"seq"`
+	Sig   string   `json:"signature,omitempty"`
+	Links []string `json:"links"`
+}
+
+// nodeJSON is an entry of nodes.json. Other fields written by the crawler are
+// ignored.
+type nodeJSON struct {
+	Record string `json:"record"`
+}
+
+func signList(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	dir := ctx.Args().Get(0)
+	key, err := crypto.LoadECDSA(ctx.Args().Get(1))
+	if err != nil {
+		return fmt.Errorf("can't load signing key: %v", err)
+	}
+	info, err := loadInfo(dir, false)
+	if err != nil {
+		return err
+	}
+	nodes, err := loadNodes(dir)
+	if err != nil {
+		return err
+	}
+	domain := ctx.String("domain")
+	if domain == "" {
+		if info.URL == "" {
+			return fmt.Errorf("no domain given and %s holds no previous signature", infoFile)
+		}
+		if domain, _, err = dnsdisc.ParseURL(info.URL); err != nil {
+			return fmt.Errorf("invalid URL in %s: %v", infoFile, err)
+		}
+	}
+	seq := info.Seq + 1
+	if ctx.IsSet("seq") {
+		seq = ctx.Uint("seq")
+	}
+	tree, err := dnsdisc.MakeTree(seq, nodes, info.Links)
+	if err != nil {
+		return err
+	}
+	url, err := tree.Sign(key, domain)
+	if err != nil {
+		return err
+	}
+	info.URL, info.Seq, info.Sig = url, tree.Seq(), tree.Signature()
+	if err := writeJSON(filepath.Join(dir, infoFile), info); err != nil {
+		return err
+	}
+	fmt.Println(url)
+	return nil
+}
+
+func listToTXT(ctx *cli.Context) error {
+	if ctx.NArg() < 1 || ctx.NArg() > 2 {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	dir := ctx.Args().Get(0)
+	tree, domain, err := loadSignedTree(dir)
+	if err != nil {
+		return err
+	}
+	records := tree.ToTXT(domain)
+	if ctx.NArg() == 2 {
+		return writeJSON(ctx.Args().Get(1), records)
+	}
+	return json.NewEncoder(os.Stdout).Encode(records)
+}
+
+func syncList(ctx *cli.Context) error {
+	if ctx.NArg() < 1 || ctx.NArg() > 2 {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	url := ctx.Args().Get(0)
+	client, err := dnsdisc.NewClient(dnsdisc.Config{})
+	if err != nil {
+		return err
+	}
+	tree, err := client.SyncTree(url)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Synced %s: seq %d, %d nodes, %d links\n", url, tree.Seq(), len(tree.Nodes()), len(tree.Links()))
+	if ctx.NArg() == 1 {
+		return nil
+	}
+	dir := ctx.Args().Get(1)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	info := &treeInfo{URL: url, Seq: tree.Seq(), Sig: tree.Signature(), Links: tree.Links()}
+	sort.Strings(info.Links)
+	if err := writeJSON(filepath.Join(dir, infoFile), info); err != nil {
+		return err
+	}
+	nodes := make(map[string]nodeJSON)
+	for _, r := range tree.Nodes() {
+		id, err := recordID(r)
+		if err != nil {
+			utils.Fatalf("Invalid node record in synced tree: %v", err)
+		}
+		nodes[id.String()] = nodeJSON{Record: dnsdisc.RecordText(r)}
+	}
+	return writeJSON(filepath.Join(dir, nodesFile), nodes)
+}
+
+// loadSignedTree recreates the signed tree of a node list directory, returning
+// it along with its domain.
+func loadSignedTree(dir string) (*dnsdisc.Tree, string, error) {
+	info, err := loadInfo(dir, true)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.URL == "" || info.Sig == "" {
+		return nil, "", fmt.Errorf("node list in %s is not signed", dir)
+	}
+	domain, pubkey, err := dnsdisc.ParseURL(info.URL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid URL in %s: %v", infoFile, err)
+	}
+	nodes, err := loadNodes(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	tree, err := dnsdisc.MakeTree(info.Seq, nodes, info.Links)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := tree.SetSignature(pubkey, info.Sig); err != nil {
+		return nil, "", fmt.Errorf("signature in %s doesn't match the list, sign it again: %v", infoFile, err)
+	}
+	return tree, domain, nil
+}
+
+// loadInfo reads the tree metadata of a node list directory. A missing file
+// yields empty metadata unless it's required.
+func loadInfo(dir string, required bool) (*treeInfo, error) {
+	info := new(treeInfo)
+	path := filepath.Join(dir, infoFile)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return info, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", path, err)
+	}
+	for _, link := range info.Links {
+		if _, _, err := dnsdisc.ParseURL(link); err != nil {
+			return nil, fmt.Errorf("invalid link %q in %s: %v", link, path, err)
+		}
+	}
+	return info, nil
+}
+
+// loadNodes reads the node records of a node list directory, preferring
+// nodes.json over nodes.txt.
+func loadNodes(dir string) ([]*enr.Record, error) {
+	var texts []string
+	if data, err := ioutil.ReadFile(filepath.Join(dir, nodesFile)); err == nil {
+		var nodes map[string]nodeJSON
+		if err := json.Unmarshal(data, &nodes); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", nodesFile, err)
+		}
+		for _, n := range nodes {
+			if n.Record != "" {
+				texts = append(texts, n.Record)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	} else {
+		file, err := os.Open(filepath.Join(dir, nodesTextFile))
+		if err != nil {
+			return nil, fmt.Errorf("no %s or %s in %s", nodesFile, nodesTextFile, dir)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+				texts = append(texts, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	records := make([]*enr.Record, 0, len(texts))
+	for _, text := range texts {
+		r, err := dnsdisc.ParseRecordText(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node record %q: %v", text, err)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// recordID returns the node ID of the key a record was signed with.
+func recordID(r *enr.Record) (discover.NodeID, error) {
+	var pubkey enr.Secp256k1
+	if err := r.Load(&pubkey); err != nil {
+		return discover.NodeID{}, err
+	}
+	return discover.PubkeyID((*ecdsa.PublicKey)(&pubkey)), nil
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/common/hexutil"
+	"github.com/kowala-tech/kUSD/common/math"
+	"github.com/kowala-tech/kUSD/consensus"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/state"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/core/vm"
+	"github.com/kowala-tech/kUSD/kusddb"
+	"github.com/kowala-tech/kUSD/params"
+	"github.com/kowala-tech/kUSD/rlp"
+)
+
+// Prestate is the state the transactions are applied to and the environment of
+// the block they're applied in.
+type Prestate struct {
+	Env stEnv
+	Pre core.GenesisAlloc
+}
+
+// stEnv is the environment of the block, including the Kowala specific fields
+// of the header.
+type stEnv struct {
+	Coinbase       common.Address      `json:"currentCoinbase"`
+	GasLimit       math.HexOrDecimal64 `json:"currentGasLimit"`
+	Number         math.HexOrDecimal64 `json:"currentNumber"`
+	Timestamp      math.HexOrDecimal64 `json:"currentTimestamp"`
+	ParentHash     common.Hash         `json:"parentHash"`
+	ValidatorsHash common.Hash         `json:"validatorsHash"`
+	LastCommitHash common.Hash         `json:"lastCommitHash"`
+	Extra          hexutil.Bytes       `json:"extra"`
+	Ancestors      ancestors           `json:"ancestors"`
+}
+
+// header returns the header of the block, as far as it's known before the
+// transactions are applied.
+func (env *stEnv) header() *types.Header {
+	return &types.Header{
+		ParentHash:     env.ParentHash,
+		Coinbase:       env.Coinbase,
+		ValidatorsHash: env.ValidatorsHash,
+		LastCommitHash: env.LastCommitHash,
+		Number:         new(big.Int).SetUint64(uint64(env.Number)),
+		GasLimit:       new(big.Int).SetUint64(uint64(env.GasLimit)),
+		GasUsed:        new(big.Int),
+		Time:           new(big.Int).SetUint64(uint64(env.Timestamp)),
+		Extra:          env.Extra,
+	}
+}
+
+// ExecutionResult is the outcome of applying the transactions, along with the
+// roots of the block that would include them.
+type ExecutionResult struct {
+	StateRoot   common.Hash    `json:"stateRoot"`
+	TxRoot      common.Hash    `json:"txRoot"`
+	ReceiptRoot common.Hash    `json:"receiptRoot"`
+	Bloom       types.Bloom    `json:"logsBloom"`
+	Receipts    types.Receipts `json:"receipts"`
+	Rejected    []*rejectedTx  `json:"rejected,omitempty"`
+	GasUsed     *hexutil.Big   `json:"gasUsed"`
+}
+
+// rejectedTx is a transaction that couldn't be included in the block.
+type rejectedTx struct {
+	Index int    `json:"index"`
+	Err   string `json:"error"`
+}
+
+// ancestors is the chain context of the block, made of the headers of its most
+// recent ancestors given in the environment. The EVM walks them up from the
+// parent to look up the hashes of BLOCKHASH, which aren't available above the
+// first missing one.
+type ancestors []*types.Header
+
+func (chain ancestors) Engine() consensus.Engine {
+	return nil
+}
+
+func (chain ancestors) GetHeader(hash common.Hash, number uint64) *types.Header {
+	for _, header := range chain {
+		if header.Number.Uint64() == number && header.Hash() == hash {
+			return header
+		}
+	}
+	return nil
+}
+
+// Apply applies the transactions to the prestate the way a block would. The
+// transactions the block couldn't include are skipped and reported in the
+// result. getTracerFn, if given, returns the tracer of a transaction.
+func (pre *Prestate) Apply(vmConfig vm.Config, chainConfig *params.ChainConfig, txs types.Transactions, getTracerFn func(txIndex int, txHash common.Hash) (vm.Tracer, error)) (*state.StateDB, *ExecutionResult, error) {
+	var (
+		db, _    = kusddb.NewMemDatabase()
+		statedb  = MakePreState(db, pre.Pre)
+		header   = pre.Env.header()
+		chain    = pre.Env.Ancestors
+		gaspool  = new(core.GasPool).AddGas(header.GasLimit)
+		included types.Transactions
+		receipts types.Receipts
+		rejected []*rejectedTx
+	)
+	for i, tx := range txs {
+		if getTracerFn != nil {
+			tracer, err := getTracerFn(i, tx.Hash())
+			if err != nil {
+				return nil, nil, err
+			}
+			vmConfig.Debug, vmConfig.Tracer = true, tracer
+		}
+		var (
+			snapshot = statedb.Snapshot()
+			gasLeft  = new(big.Int).Set((*big.Int)(gaspool))
+		)
+		statedb.Prepare(tx.Hash(), common.Hash{}, len(included))
+
+		receipt, _, err := core.ApplyTransaction(chainConfig, chain, &header.Coinbase, gaspool, statedb, header, tx, header.GasUsed, vmConfig)
+		if err != nil {
+			statedb.RevertToSnapshot(snapshot)
+			gaspool = new(core.GasPool).AddGas(gasLeft)
+			rejected = append(rejected, &rejectedTx{i, err.Error()})
+			continue
+		}
+		included = append(included, tx)
+		receipts = append(receipts, receipt)
+	}
+	// Compute the state root the way the consensus engine finalizes blocks
+	root := statedb.IntermediateRoot(true)
+	if _, err := statedb.CommitTo(db, true); err != nil {
+		return nil, nil, fmt.Errorf("could not commit state: %v", err)
+	}
+	result := &ExecutionResult{
+		StateRoot:   root,
+		TxRoot:      types.DeriveSha(included),
+		ReceiptRoot: types.DeriveSha(receipts),
+		Bloom:       types.CreateBloom(receipts),
+		Receipts:    receipts,
+		Rejected:    rejected,
+		GasUsed:     (*hexutil.Big)(header.GasUsed),
+	}
+	return statedb, result, nil
+}
+
+// MakePreState creates a state database holding the accounts of alloc.
+func MakePreState(db kusddb.Database, alloc core.GenesisAlloc) *state.StateDB {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	for addr, account := range alloc {
+		statedb.SetCode(addr, account.Code)
+		statedb.SetNonce(addr, account.Nonce)
+		statedb.AddBalance(addr, account.Balance)
+		for key, value := range account.Storage {
+			statedb.SetState(addr, key, value)
+		}
+	}
+	// Commit and re-open to start with a clean state
+	root, _ := statedb.CommitTo(db, false)
+	statedb, _ = state.New(root, state.NewDatabase(db))
+	return statedb
+}
+
+// dumpAlloc returns the accounts of a committed state database in the format of
+// the prestate, so that the output of a transition can be the input of the next.
+func dumpAlloc(statedb *state.StateDB) (core.GenesisAlloc, error) {
+	alloc := make(core.GenesisAlloc)
+	for addr, dump := range statedb.RawDump().Accounts {
+		balance, ok := new(big.Int).SetString(dump.Balance, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid balance of account %s: %s", addr, dump.Balance)
+		}
+		account := core.GenesisAccount{
+			Code:    common.Hex2Bytes(dump.Code),
+			Balance: balance,
+			Nonce:   dump.Nonce,
+		}
+		if len(dump.Storage) > 0 {
+			account.Storage = make(map[common.Hash]common.Hash, len(dump.Storage))
+		}
+		for key, enc := range dump.Storage {
+			// Storage values are stored RLP encoded, with the leading zeroes trimmed
+			var value []byte
+			if err := rlp.DecodeBytes(common.Hex2Bytes(enc), &value); err != nil {
+				return nil, fmt.Errorf("invalid storage of account %s: %v", addr, err)
+			}
+			account.Storage[common.HexToHash(key)] = common.BytesToHash(value)
+		}
+		alloc[common.HexToAddress(addr)] = account
+	}
+	return alloc, nil
+}
@@ -144,6 +144,7 @@ func init() {
 		disasmCommand,
 		runCommand,
 		stateTestCommand,
+		transitionCommand,
 	}
 }
 
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/core/vm"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/params"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	InputAllocFlag = cli.StringFlag{
+		Name:  "input.alloc",
+		Usage: "`stdin` or file name of where to find the prestate alloc to use",
+		Value: "alloc.json",
+	}
+	InputEnvFlag = cli.StringFlag{
+		Name:  "input.env",
+		Usage: "`stdin` or file name of where to find the prestate env to use",
+		Value: "env.json",
+	}
+	InputTxsFlag = cli.StringFlag{
+		Name:  "input.txs",
+		Usage: "`stdin` or file name of where to find the signed transactions to apply",
+		Value: "txs.json",
+	}
+	OutputBasedirFlag = cli.StringFlag{
+		Name:  "output.basedir",
+		Usage: "directory the output files and traces are written to",
+	}
+	OutputAllocFlag = cli.StringFlag{
+		Name:  "output.alloc",
+		Usage: "`stdout`, `stderr` or file name of where to write the post-state alloc",
+		Value: "alloc.json",
+	}
+	OutputResultFlag = cli.StringFlag{
+		Name:  "output.result",
+		Usage: "`stdout`, `stderr` or file name of where to write the execution result",
+		Value: "result.json",
+	}
+	ChainIDFlag = cli.Int64Flag{
+		Name:  "state.chainid",
+		Usage: "chain identifier of the Andromeda signer",
+		Value: params.MainnetChainConfig.ChainID.Int64(),
+	}
+	TraceFlag = cli.BoolFlag{
+		Name:  "trace",
+		Usage: "write a JSON trace of each included transaction to trace-<index>-<hash>.jsonl in the output directory",
+	}
+)
+
+var transitionCommand = cli.Command{
+	Action: transitionCmd,
+	Name:   "transition",
+	Usage:  "applies transactions to a prestate the way a block would",
+	Description: `
+The transition command applies a list of signed transactions to the prestate
+alloc in the block environment env, and writes the post-state alloc along with
+the result: the state, transaction and receipt roots, the receipts and the
+transactions the block couldn't include.
+
+If any of the inputs is read from stdin, all of them are, as a single JSON
+object with the fields alloc, env and txs.`,
+	Flags: []cli.Flag{
+		InputAllocFlag,
+		InputEnvFlag,
+		InputTxsFlag,
+		OutputBasedirFlag,
+		OutputAllocFlag,
+		OutputResultFlag,
+		ChainIDFlag,
+		TraceFlag,
+	},
+}
+
+// transitionInput is the input of the transition command when read from stdin.
+type transitionInput struct {
+	Alloc core.GenesisAlloc  `json:"alloc"`
+	Env   *stEnv             `json:"env"`
+	Txs   types.Transactions `json:"txs"`
+}
+
+func transitionCmd(ctx *cli.Context) error {
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.GlobalInt(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+
+	var (
+		prestate Prestate
+		txs      types.Transactions
+		baseDir  = ctx.String(OutputBasedirFlag.Name)
+	)
+	allocStr, envStr, txsStr := ctx.String(InputAllocFlag.Name), ctx.String(InputEnvFlag.Name), ctx.String(InputTxsFlag.Name)
+	if allocStr == "stdin" || envStr == "stdin" || txsStr == "stdin" {
+		input := transitionInput{Env: &prestate.Env}
+		if err := json.NewDecoder(os.Stdin).Decode(&input); err != nil {
+			return fmt.Errorf("failed to decode stdin: %v", err)
+		}
+		prestate.Pre, txs = input.Alloc, input.Txs
+	} else {
+		if err := readJSONFile(allocStr, &prestate.Pre); err != nil {
+			return err
+		}
+		if err := readJSONFile(envStr, &prestate.Env); err != nil {
+			return err
+		}
+		if err := readJSONFile(txsStr, &txs); err != nil {
+			return err
+		}
+	}
+	if baseDir != "" {
+		if err := os.MkdirAll(baseDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %v", err)
+		}
+	}
+	// Write a trace file per transaction if requested
+	var (
+		getTracerFn func(int, common.Hash) (vm.Tracer, error)
+		traces      = make(map[int]*os.File)
+	)
+	if ctx.Bool(TraceFlag.Name) {
+		logConfig := &vm.LogConfig{
+			DisableMemory: ctx.GlobalBool(DisableMemoryFlag.Name),
+			DisableStack:  ctx.GlobalBool(DisableStackFlag.Name),
+		}
+		getTracerFn = func(txIndex int, txHash common.Hash) (vm.Tracer, error) {
+			traceFile, err := os.Create(filepath.Join(baseDir, fmt.Sprintf("trace-%d-%v.jsonl", txIndex, txHash.Hex())))
+			if err != nil {
+				return nil, fmt.Errorf("failed to create trace file: %v", err)
+			}
+			traces[txIndex] = traceFile
+			return NewJSONLogger(logConfig, traceFile), nil
+		}
+	}
+	chainConfig := &params.ChainConfig{
+		ChainID:    big.NewInt(ctx.Int64(ChainIDFlag.Name)),
+		Tendermint: new(params.TendermintConfig),
+	}
+	statedb, result, err := prestate.Apply(vm.Config{}, chainConfig, txs, getTracerFn)
+	for _, traceFile := range traces {
+		traceFile.Close()
+	}
+	if err != nil {
+		return err
+	}
+	// Rejected transactions left no trace, drop their empty files
+	for _, tx := range result.Rejected {
+		if traceFile, ok := traces[tx.Index]; ok {
+			if err := os.Remove(traceFile.Name()); err != nil {
+				return fmt.Errorf("failed to remove trace file: %v", err)
+			}
+		}
+	}
+	alloc, err := dumpAlloc(statedb)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(baseDir, ctx.String(OutputAllocFlag.Name), alloc); err != nil {
+		return err
+	}
+	return writeJSON(baseDir, ctx.String(OutputResultFlag.Name), result)
+}
+
+// readJSONFile decodes the JSON content of a file into v.
+func readJSONFile(path string, v interface{}) error {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(src, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+	return nil
+}
+
+// writeJSON writes the indented JSON encoding of v to stdout, stderr or a file
+// in the output directory.
+func writeJSON(baseDir, name string, v interface{}) error {
+	enc, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", name, err)
+	}
+	var out io.Writer
+	switch name {
+	case "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		return ioutil.WriteFile(filepath.Join(baseDir, name), append(enc, '\n'), 0644)
+	}
+	_, err = fmt.Fprintln(out, string(enc))
+	return err
+}
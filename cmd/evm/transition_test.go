@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core"
+)
+
+// Tests that the transition command applies the transactions of the fixture the
+// way a block would: the ones the block can't include are rejected, BLOCKHASH
+// reads the hashes of the ancestors and the roots match the expected ones.
+func TestTransition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "evm-transition")
+	if err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = app.Run([]string{"evm", "transition",
+		"--input.alloc", "testdata/transition/alloc.json",
+		"--input.env", "testdata/transition/env.json",
+		"--input.txs", "testdata/transition/txs.json",
+		"--output.basedir", dir,
+		"--state.chainid", "1",
+		"--trace",
+	})
+	if err != nil {
+		t.Fatalf("transition failed: %v", err)
+	}
+	for _, name := range []string{"result", "alloc"} {
+		var have, want interface{}
+		if err := readJSONFile(filepath.Join(dir, name+".json"), &have); err != nil {
+			t.Fatal(err)
+		}
+		if err := readJSONFile(filepath.Join("testdata", "transition", "exp_"+name+".json"), &want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("%s mismatch:\nhave %v\nwant %v", name, have, want)
+		}
+	}
+	// The contract stores the hashes of the three blocks before the current one
+	var (
+		env   stEnv
+		alloc core.GenesisAlloc
+	)
+	if err := readJSONFile("testdata/transition/env.json", &env); err != nil {
+		t.Fatal(err)
+	}
+	if err := readJSONFile(filepath.Join(dir, "alloc.json"), &alloc); err != nil {
+		t.Fatal(err)
+	}
+	storage := alloc[common.HexToAddress("0xbb")].Storage
+	for i := 0; i < len(env.Ancestors); i++ {
+		want := env.Ancestors[len(env.Ancestors)-1-i].Hash()
+		if have := storage[common.BigToHash(big.NewInt(int64(i)))]; have != want {
+			t.Errorf("BLOCKHASH(NUMBER-%d) mismatch: have %x, want %x", i+1, have, want)
+		}
+	}
+	// Only the included transactions leave a trace
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to list output directory: %v", err)
+	}
+	var traces []string
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), "trace-") {
+			traces = append(traces, file.Name()[:len("trace-0")])
+		}
+	}
+	if want := []string{"trace-0", "trace-1"}; !reflect.DeepEqual(traces, want) {
+		t.Errorf("trace files mismatch: have %v, want %v", traces, want)
+	}
+}
@@ -30,6 +30,11 @@ import (
 )
 
 var (
+	mnemonicFlag = cli.BoolFlag{
+		Name:  "mnemonic",
+		Usage: "Generate a BIP-39 mnemonic to derive HD accounts from",
+	}
+
 	walletCommand = cli.Command{
 		Name:      "wallet",
 		Usage:     "Manage Ethereum presale wallets",
@@ -110,6 +115,7 @@ Print a short summary of all accounts`,
 					utils.KeyStoreDirFlag,
 					utils.PasswordFileFlag,
 					utils.LightKDFFlag,
+					mnemonicFlag,
 				},
 				Description: `
     kusd account new
@@ -118,6 +124,10 @@ Creates a new account and prints the address.
 
 The account is saved in encrypted format, you are prompted for a passphrase.
 
+With --mnemonic, a BIP-39 mnemonic is generated and stored encrypted instead,
+and the first account derived from it along the default path is printed. The
+mnemonic is shown only once, write it down to be able to restore the accounts.
+
 You must remember this passphrase to unlock your account in the future.
 
 For non-interactive use the passphrase can be specified with the --password flag:
@@ -307,6 +317,16 @@ func accountCreate(ctx *cli.Context) error {
 
 	password := getPassPhrase("Your new account is locked with a password. Please give a password. Do not forget this password.", true, 0, utils.MakePasswordList(ctx))
 
+	if ctx.Bool(mnemonicFlag.Name) {
+		ks := keystore.NewKeyStore(keydir, scryptN, scryptP)
+		mnemonic, wallet, err := ks.NewMnemonic(password)
+		if err != nil {
+			utils.Fatalf("Failed to create mnemonic: %v", err)
+		}
+		fmt.Printf("Mnemonic: %s\n", mnemonic)
+		fmt.Printf("Address: {%x}\n", wallet.Accounts()[0].Address)
+		return nil
+	}
 	address, err := keystore.StoreKey(keydir, password, scryptN, scryptP)
 
 	if err != nil {
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"runtime"
 	"strconv"
@@ -17,6 +18,7 @@ import (
 	"github.com/kowala-tech/kUSD/core/types"
 	"github.com/kowala-tech/kUSD/event"
 	"github.com/kowala-tech/kUSD/kusd/downloader"
+	"github.com/kowala-tech/kUSD/kusd/validator"
 	"github.com/kowala-tech/kUSD/kusddb"
 	"github.com/kowala-tech/kUSD/log"
 	"github.com/kowala-tech/kUSD/trie"
@@ -76,6 +78,24 @@ Requires a first argument of the file to write to.
 Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing.`,
+	}
+	exportCheckpointCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportCheckpoint),
+		Name:      "export-checkpoint",
+		Usage:     "Export a signed sync checkpoint into file",
+		ArgsUsage: "<filename> [<blockNum>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+Requires a first argument of the file to write to.
+The optional second argument selects the checkpoint block, which defaults to
+the latest block with a committed child. The checkpoint file holds the block
+number and hash, the validator set registered in the block state and the
+commit of its child by these validators, and can be passed to --checkpoint
+to fast sync new nodes from it.`,
 	}
 	copydbCommand = cli.Command{
 		Action:    utils.MigrateFlags(copyDb),
@@ -349,6 +369,41 @@ func removeDB(ctx *cli.Context) error {
 	return nil
 }
 
+func exportCheckpoint(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack := makeFullNode(ctx)
+	chain, chainDb := utils.MakeChain(ctx, stack)
+	defer chainDb.Close()
+
+	// The commit of the child of a block is stored within its grandchild
+	number := chain.CurrentBlock().NumberU64()
+	if number > 1 {
+		number -= 2
+	}
+	if len(ctx.Args()) > 1 {
+		n, err := strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+		if err != nil {
+			utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
+		}
+		number = n
+	}
+	cp, err := validator.ExportCheckpoint(chain.Config(), chain, number)
+	if err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	if err := ioutil.WriteFile(ctx.Args().First(), data, 0644); err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Exported checkpoint %v\n", cp)
+	return nil
+}
+
 func dump(ctx *cli.Context) error {
 	stack := makeFullNode(ctx)
 	chain, chainDb := utils.MakeChain(ctx, stack)
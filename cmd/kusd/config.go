@@ -129,6 +129,11 @@ func makeFullNode(ctx *cli.Context) *node.Node {
 		utils.RegisterKowalaStatsService(stack, statsUrl)
 	}
 
+	// Add the GraphQL server if requested.
+	if ctx.GlobalBool(utils.GraphQLEnabledFlag.Name) {
+		utils.RegisterGraphQLService(stack)
+	}
+
 	// Add the release oracle service so it boots along with node.
 	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
 		config := release.Config{
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kowala-tech/kUSD/cmd/utils"
+	"github.com/kowala-tech/kUSD/kusd/validator"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	debugCommand = cli.Command{
+		Name:     "debug",
+		Usage:    "Debug the consensus validator",
+		Category: "MISCELLANEOUS COMMANDS",
+		Description: `
+Tools reproducing the behaviour of a consensus validator offline.`,
+		Subcommands: []cli.Command{
+			{
+				Name:      "replay",
+				Usage:     "Replay the recorded consensus state machine of a validator",
+				ArgsUsage: "<traceFile>",
+				Action:    utils.MigrateFlags(replayTrace),
+				Description: `
+    kusd debug replay /path/to/trace.json
+
+runs the consensus state machine of a validator again, on a simulated clock,
+from the trace it recorded with --validate.trace. The consensus messages the
+validator received and the answers of its node are fed back at the time they
+were recorded, printing each state transition of the state machine.
+
+The replay fails at the first divergence from the recording, e.g. once the
+state machine of this build takes another decision on the same inputs.`,
+			},
+		},
+	}
+)
+
+// replayTrace replays a recorded trace of the consensus state machine, printing
+// its state transitions.
+func replayTrace(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	trace, err := os.Open(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Failed to open trace: %v", err)
+	}
+	defer trace.Close()
+
+	run := -1
+	report := func(t validator.Transition) {
+		if t.Run != run {
+			run = t.Run
+			fmt.Printf("Run %d\n", run)
+		}
+		fmt.Printf("%12v  #%-6d round %-3d %s\n", t.Time, t.Number, t.Round, t.State)
+	}
+	if err := validator.Replay(trace, report); err != nil {
+		utils.Fatalf("Replay diverged: %v", err)
+	}
+	fmt.Println("Replay matches the trace")
+	return nil
+}
@@ -41,9 +41,12 @@ var (
 		utils.BootnodesFlag,
 		utils.BootnodesV4Flag,
 		utils.BootnodesV5Flag,
+		utils.DNSListsFlag,
 		utils.DataDirFlag,
 		utils.KeyStoreDirFlag,
 		utils.NoUSBFlag,
+		utils.ExternalSignerFlag,
+		utils.ExternalSignerAuthFlag,
 		utils.DashboardEnabledFlag,
 		utils.DashboardAddrFlag,
 		utils.DashboardPortFlag,
@@ -62,6 +65,7 @@ var (
 		utils.FastSyncFlag,
 		utils.LightModeFlag,
 		utils.SyncModeFlag,
+		utils.CheckpointFlag,
 		utils.LightServFlag,
 		utils.LightPeersFlag,
 		utils.LightKDFFlag,
@@ -74,11 +78,16 @@ var (
 		utils.GasPriceFlag,
 		utils.ValidatorDepositFlag,
 		utils.ValidationEnabledFlag,
+		utils.ValidatorTraceFlag,
 		utils.TargetGasLimitFlag,
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
 		utils.NetrestrictFlag,
+		utils.BehindSentryFlag,
+		utils.PrivatePeerFlag,
+		utils.MsgCaptureFlag,
+		utils.MsgCaptureFilterFlag,
 		utils.NodeKeyFileFlag,
 		utils.NodeKeyHexFlag,
 		utils.DevModeFlag,
@@ -102,6 +111,13 @@ var (
 		utils.RPCListenAddrFlag,
 		utils.RPCPortFlag,
 		utils.RPCApiFlag,
+		utils.RPCAuthFileFlag,
+		utils.GraphQLEnabledFlag,
+		utils.RPCBatchLimitFlag,
+		utils.RPCSizeLimitFlag,
+		utils.RPCRateLimitFlag,
+		utils.RPCRateBurstFlag,
+		utils.RPCSubscriptionLimitFlag,
 		utils.WSEnabledFlag,
 		utils.WSListenAddrFlag,
 		utils.WSPortFlag,
@@ -122,6 +138,7 @@ func init() {
 		initCommand,
 		importCommand,
 		exportCommand,
+		exportCheckpointCommand,
 		copydbCommand,
 		removedbCommand,
 		dumpCommand,
@@ -140,6 +157,8 @@ func init() {
 		licenseCommand,
 		// See config.go
 		dumpConfigCommand,
+		// See debugcmd.go
+		debugCommand,
 	}
 
 	app.Flags = append(app.Flags, nodeFlags...)
@@ -54,10 +54,13 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.DataDirFlag,
 			utils.KeyStoreDirFlag,
 			utils.NoUSBFlag,
+			utils.ExternalSignerFlag,
+			utils.ExternalSignerAuthFlag,
 			utils.NetworkIdFlag,
 			utils.TestnetFlag,
 			utils.DevModeFlag,
 			utils.SyncModeFlag,
+			utils.CheckpointFlag,
 			utils.KowalaStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightServFlag,
@@ -111,6 +114,13 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.RPCListenAddrFlag,
 			utils.RPCPortFlag,
 			utils.RPCApiFlag,
+			utils.RPCAuthFileFlag,
+			utils.GraphQLEnabledFlag,
+			utils.RPCBatchLimitFlag,
+			utils.RPCSizeLimitFlag,
+			utils.RPCRateLimitFlag,
+			utils.RPCRateBurstFlag,
+			utils.RPCSubscriptionLimitFlag,
 			utils.WSEnabledFlag,
 			utils.WSListenAddrFlag,
 			utils.WSPortFlag,
@@ -130,6 +140,7 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.BootnodesFlag,
 			utils.BootnodesV4Flag,
 			utils.BootnodesV5Flag,
+			utils.DNSListsFlag,
 			utils.ListenPortFlag,
 			utils.MaxPeersFlag,
 			utils.MaxPendingPeersFlag,
@@ -137,6 +148,10 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.NoDiscoverFlag,
 			utils.DiscoveryV5Flag,
 			utils.NetrestrictFlag,
+			utils.BehindSentryFlag,
+			utils.PrivatePeerFlag,
+			utils.MsgCaptureFlag,
+			utils.MsgCaptureFilterFlag,
 			utils.NodeKeyFileFlag,
 			utils.NodeKeyHexFlag,
 		},
@@ -146,6 +161,7 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			utils.ValidationEnabledFlag,
 			utils.ValidatorDepositFlag,
+			utils.ValidatorTraceFlag,
 			utils.CoinbaseFlag,
 			utils.TargetGasLimitFlag,
 			utils.GasPriceFlag,
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/kusd"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/p2p"
+	"github.com/kowala-tech/kUSD/p2p/discover"
+	"github.com/kowala-tech/kUSD/p2p/enr"
+	"github.com/kowala-tech/kUSD/rlp"
+)
+
+const (
+	dialTimeout      = 10 * time.Second // Timeout of the TCP connection to a node
+	handshakeTimeout = 10 * time.Second // Timeout of the kusd status exchange
+)
+
+var (
+	errNoStatus = errors.New("no kusd status received")
+	errNotKusd  = errors.New("no kusd protocol in common")
+)
+
+// statusData mirrors the kusd status message.
+type statusData struct {
+	ProtocolVersion uint32
+	NetworkId       uint64
+	BlockNumber     *big.Int
+	CurrentBlock    common.Hash
+	GenesisBlock    common.Hash
+}
+
+// kusdEntry mirrors the "kusd" entry of the node records published by kusd.
+type kusdEntry struct {
+	NetworkID uint64
+	Genesis   common.Hash
+	Role      kusd.NodeRole
+	Rest      []rlp.RawValue `rlp:"tail"`
+}
+
+func (kusdEntry) ENRKey() string { return "kusd" }
+
+// probeResult is the outcome of the handshakes with a node.
+type probeResult struct {
+	node    *discover.Node
+	checked time.Time
+	name    string
+	caps    []p2p.Cap
+	version uint        // negotiated kusd protocol version
+	status  *statusData // nil if the status exchange failed
+	err     error
+}
+
+// crawler walks the discovery DHT and probes the nodes it finds.
+type crawler struct {
+	tab       *discover.Table
+	srv       *p2p.Server
+	inventory nodeSet
+	recheck   time.Duration // minimum time between two probes of a node
+	workers   int
+
+	lock    sync.Mutex
+	pending map[discover.NodeID]chan *probeResult // results of the kusd handshakes in progress
+}
+
+func newCrawler(tab *discover.Table, inventory nodeSet, recheck time.Duration, workers int) *crawler {
+	return &crawler{
+		tab:       tab,
+		inventory: inventory,
+		recheck:   recheck,
+		workers:   workers,
+		pending:   make(map[discover.NodeID]chan *probeResult),
+	}
+}
+
+// protocols returns the kusd protocols spoken by the crawler, one for each
+// version, which only exchange the status message.
+func (c *crawler) protocols() []p2p.Protocol {
+	protos := make([]p2p.Protocol, len(kusd.ProtocolVersions))
+	for i, version := range kusd.ProtocolVersions {
+		version := version
+		protos[i] = p2p.Protocol{
+			Name:    kusd.ProtocolName,
+			Version: version,
+			Length:  kusd.ProtocolLengths[i],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return c.handshake(p, rw, version)
+			},
+		}
+	}
+	return protos
+}
+
+// run crawls the network until the given channel is closed, saving the
+// inventory on every tick of the save channel.
+func (c *crawler) run(quit <-chan struct{}, save <-chan time.Time, write func()) {
+	var (
+		found    = make(chan []*discover.Node)
+		queue    = make(chan *discover.Node)
+		results  = make(chan *probeResult)
+		backlog  []*discover.Node
+		queued   = make(map[discover.NodeID]bool)
+		wg       sync.WaitGroup
+		stopping = make(chan struct{})
+	)
+	// Walk the DHT with lookups of random targets
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			var target discover.NodeID
+			rand.Read(target[:])
+			nodes := c.tab.Lookup(target)
+			select {
+			case found <- nodes:
+			case <-stopping:
+				return
+			}
+		}
+	}()
+	// Probe the discovered nodes concurrently
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range queue {
+				res := c.probe(n)
+				select {
+				case results <- res:
+				case <-stopping:
+					return
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(stopping)
+		close(queue)
+		wg.Wait()
+	}()
+
+	for {
+		var (
+			next     *discover.Node
+			dispatch chan *discover.Node
+		)
+		if len(backlog) > 0 {
+			next, dispatch = backlog[0], queue
+		}
+		select {
+		case nodes := <-found:
+			now := time.Now()
+			for _, n := range nodes {
+				if queued[n.ID] {
+					continue
+				}
+				if !c.inventory.due(n, now, c.recheck) {
+					continue
+				}
+				queued[n.ID] = true
+				backlog = append(backlog, n)
+			}
+		case dispatch <- next:
+			backlog = backlog[1:]
+		case res := <-results:
+			delete(queued, res.node.ID)
+			c.inventory.update(res, c.tab.Record(res.node.ID))
+			log.Debug("Probed node", "id", res.node.ID, "addr", res.node.IP, "name", res.name, "err", res.err)
+		case <-save:
+			write()
+		case <-quit:
+			return
+		}
+	}
+}
+
+// probe connects to a node, running the RLPx and kusd handshakes.
+func (c *crawler) probe(n *discover.Node) *probeResult {
+	res := &probeResult{node: n, checked: time.Now()}
+
+	fd, err := net.DialTimeout("tcp", fmt.Sprintf("%v:%d", n.IP, n.TCP), dialTimeout)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	ch := make(chan *probeResult, 1)
+	c.lock.Lock()
+	c.pending[n.ID] = ch
+	c.lock.Unlock()
+
+	defer func() {
+		c.lock.Lock()
+		delete(c.pending, n.ID)
+		c.lock.Unlock()
+	}()
+	if err := c.srv.SetupConn(fd, 0, n); err != nil {
+		// Nodes without a kusd protocol are rejected after the protocol
+		// handshake, which still tells what they run
+		if mismatch, ok := err.(*p2p.ProtocolMismatchError); ok {
+			res.name, res.caps = mismatch.Name, mismatch.Caps
+			err = errNotKusd
+		}
+		res.err = err
+		return res
+	}
+	timeout := time.NewTimer(2 * handshakeTimeout)
+	defer timeout.Stop()
+
+	select {
+	case handshake := <-ch:
+		handshake.node, handshake.checked = n, res.checked
+		return handshake
+	case <-timeout.C:
+		res.err = errNoStatus
+		return res
+	}
+}
+
+// handshake runs the kusd status exchange with a connected node, delivering
+// its outcome to the pending probe. The status sent back mirrors the one of the
+// remote node, so it doesn't consider the crawler faulty.
+func (c *crawler) handshake(p *p2p.Peer, rw p2p.MsgReadWriter, version uint) error {
+	res := &probeResult{name: p.Name(), caps: p.Caps(), version: version}
+	defer func() {
+		c.lock.Lock()
+		ch := c.pending[p.ID()]
+		c.lock.Unlock()
+		if ch != nil {
+			ch <- res
+		}
+	}()
+
+	status, err := readStatus(rw)
+	if err != nil {
+		res.err = err
+		return err
+	}
+	res.status = status
+	return p2p.Send(rw, kusd.StatusMsg, &statusData{
+		ProtocolVersion: uint32(version),
+		NetworkId:       status.NetworkId,
+		BlockNumber:     new(big.Int),
+		CurrentBlock:    status.GenesisBlock,
+		GenesisBlock:    status.GenesisBlock,
+	})
+}
+
+// readStatus waits for the status message of a node.
+func readStatus(rw p2p.MsgReadWriter) (*statusData, error) {
+	type result struct {
+		status *statusData
+		err    error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			resc <- result{nil, err}
+			return
+		}
+		defer msg.Discard()
+		if msg.Code != kusd.StatusMsg {
+			resc <- result{nil, fmt.Errorf("first message has code %#x, want status", msg.Code)}
+			return
+		}
+		status := new(statusData)
+		if err := msg.Decode(status); err != nil {
+			resc <- result{nil, err}
+			return
+		}
+		resc <- result{status, nil}
+	}()
+	timeout := time.NewTimer(handshakeTimeout)
+	defer timeout.Stop()
+
+	select {
+	case res := <-resc:
+		return res.status, res.err
+	case <-timeout.C:
+		return nil, errNoStatus
+	}
+}
+
+// recordEntry returns the kusd entry of a node record, if it has one.
+func recordEntry(record *enr.Record) (kusdEntry, bool) {
+	var entry kusdEntry
+	if record == nil || record.Load(&entry) != nil {
+		return kusdEntry{}, false
+	}
+	return entry, true
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/kusd"
+	"github.com/kowala-tech/kUSD/p2p"
+)
+
+// startServer runs a listening p2p server speaking the given protocols.
+func startServer(t *testing.T, protocols []p2p.Protocol) *p2p.Server {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &p2p.Server{Config: p2p.Config{
+		PrivateKey:  key,
+		Name:        "test",
+		MaxPeers:    10,
+		NoDiscovery: true,
+		ListenAddr:  "127.0.0.1:0",
+		Protocols:   protocols,
+	}}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start server: %v", err)
+	}
+	return srv
+}
+
+func newTestCrawler(t *testing.T) *crawler {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCrawler(nil, make(nodeSet), time.Hour, 1)
+	c.srv = &p2p.Server{Config: p2p.Config{
+		PrivateKey:  key,
+		Name:        "kusdcrawl",
+		MaxPeers:    10,
+		NoDiscovery: true,
+		Protocols:   c.protocols(),
+	}}
+	if err := c.srv.Start(); err != nil {
+		t.Fatalf("could not start crawler: %v", err)
+	}
+	return c
+}
+
+// Tests that nodes without a kusd protocol are recognised from the protocol
+// handshake, keeping what they announced.
+func TestProbeNotKusd(t *testing.T) {
+	remote := startServer(t, []p2p.Protocol{{
+		Name:    "other",
+		Version: 1,
+		Length:  1,
+		Run:     func(*p2p.Peer, p2p.MsgReadWriter) error { return nil },
+	}})
+	defer remote.Stop()
+	c := newTestCrawler(t)
+	defer c.srv.Stop()
+
+	res := c.probe(remote.Self())
+	if res.err != errNotKusd {
+		t.Fatalf("error mismatch: have %v, want %v", res.err, errNotKusd)
+	}
+	if res.name != "test" || len(res.caps) != 1 || res.caps[0] != (p2p.Cap{Name: "other", Version: 1}) {
+		t.Errorf("handshake mismatch: have %q %v", res.name, res.caps)
+	}
+	c.inventory.update(res, nil)
+	entry := c.inventory[remote.Self().ID]
+	if entry.Error != errNotKusd.Error() || len(entry.Protocols) != 1 || entry.Protocols[0] != "other/1" {
+		t.Errorf("inventory mismatch: have error %q, protocols %v", entry.Error, entry.Protocols)
+	}
+}
+
+// Tests that the status of kusd nodes is exchanged and recorded.
+func TestProbeKusd(t *testing.T) {
+	genesis := common.HexToHash("0x01")
+	version := kusd.ProtocolVersions[0]
+	remote := startServer(t, []p2p.Protocol{{
+		Name:    kusd.ProtocolName,
+		Version: version,
+		Length:  kusd.ProtocolLengths[0],
+		Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+			status := &statusData{
+				ProtocolVersion: uint32(version),
+				NetworkId:       7,
+				BlockNumber:     big.NewInt(42),
+				CurrentBlock:    common.HexToHash("0x02"),
+				GenesisBlock:    genesis,
+			}
+			if err := p2p.Send(rw, kusd.StatusMsg, status); err != nil {
+				return err
+			}
+			_, err := readStatus(rw)
+			return err
+		},
+	}})
+	defer remote.Stop()
+	c := newTestCrawler(t)
+	defer c.srv.Stop()
+
+	res := c.probe(remote.Self())
+	if res.err != nil {
+		t.Fatalf("probe failed: %v", res.err)
+	}
+	if res.version != version {
+		t.Errorf("version mismatch: have %d, want %d", res.version, version)
+	}
+	if res.status == nil || res.status.NetworkId != 7 || res.status.GenesisBlock != genesis || res.status.BlockNumber.Uint64() != 42 {
+		t.Fatalf("status mismatch: have %+v", res.status)
+	}
+	c.inventory.update(res, nil)
+	entry := c.inventory[remote.Self().ID]
+	if entry.Error != "" || entry.NetworkID != 7 || entry.Number != 42 || entry.KusdVersion != version {
+		t.Errorf("inventory mismatch: have %+v", entry)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/kusd"
+	"github.com/kowala-tech/kUSD/p2p/discover"
+	"github.com/kowala-tech/kUSD/p2p/dnsdisc"
+	"github.com/kowala-tech/kUSD/p2p/enr"
+)
+
+// crawledNode is the inventory entry of a node. The record field makes the
+// inventory usable as the node list of a DNS tree.
+type crawledNode struct {
+	Enode  string `json:"enode"`
+	Record string `json:"record,omitempty"`
+
+	FirstSeen time.Time `json:"firstSeen"`
+	LastCheck time.Time `json:"lastCheck"`       // time of the last probe
+	LastSeen  time.Time `json:"lastSeen"`        // time of the last successful probe
+	Error     string    `json:"error,omitempty"` // failure of the last probe
+
+	Name        string       `json:"name,omitempty"`
+	Protocols   []string     `json:"protocols,omitempty"`
+	KusdVersion uint         `json:"kusdVersion,omitempty"`
+	NetworkID   uint64       `json:"networkId,omitempty"`
+	Genesis     *common.Hash `json:"genesis,omitempty"`
+	Head        *common.Hash `json:"head,omitempty"`
+	Number      uint64       `json:"number,omitempty"`
+	Validator   bool         `json:"validator"`
+}
+
+// nodeSet is the inventory of the crawled nodes.
+type nodeSet map[discover.NodeID]*crawledNode
+
+// loadNodeSet reads an inventory written by an earlier run, returning an empty
+// one if the file doesn't exist.
+func loadNodeSet(path string) (nodeSet, error) {
+	ns := make(nodeSet)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ns, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ns); err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+// write stores the inventory in a file.
+func (ns nodeSet) write(path string) error {
+	data, err := json.MarshalIndent(ns, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// due reports whether a node wasn't probed within the recheck interval, adding
+// the node to the inventory if it's new.
+func (ns nodeSet) due(n *discover.Node, now time.Time, recheck time.Duration) bool {
+	entry := ns[n.ID]
+	if entry == nil {
+		ns[n.ID] = &crawledNode{Enode: n.String(), FirstSeen: now}
+		return true
+	}
+	return entry.LastCheck.IsZero() || now.Sub(entry.LastCheck) >= recheck
+}
+
+// update stores the outcome of a probe and the last known record of a node.
+func (ns nodeSet) update(res *probeResult, record *enr.Record) {
+	entry := ns[res.node.ID]
+	if entry == nil {
+		entry = &crawledNode{FirstSeen: res.checked}
+		ns[res.node.ID] = entry
+	}
+	entry.Enode = res.node.String()
+	entry.LastCheck = res.checked
+	if record != nil {
+		entry.Record = dnsdisc.RecordText(record)
+		if kusdRecord, ok := recordEntry(record); ok {
+			entry.Validator = kusdRecord.Role&kusd.RoleValidator != 0
+		}
+	}
+	if res.name != "" {
+		entry.Name = res.name
+		entry.Protocols = entry.Protocols[:0]
+		for _, cap := range res.caps {
+			entry.Protocols = append(entry.Protocols, cap.String())
+		}
+		entry.KusdVersion = res.version
+	}
+	if res.status != nil {
+		genesis, head := res.status.GenesisBlock, res.status.CurrentBlock
+		entry.NetworkID = res.status.NetworkId
+		entry.Genesis, entry.Head = &genesis, &head
+		if res.status.BlockNumber != nil {
+			entry.Number = res.status.BlockNumber.Uint64()
+		}
+	}
+	if res.err != nil {
+		entry.Error = res.err.Error()
+	} else {
+		entry.Error = ""
+		entry.LastSeen = res.checked
+	}
+}
+
+// seeds returns the nodes which answered a probe, used to bootstrap discovery
+// when resuming a crawl.
+func (ns nodeSet) seeds() []*discover.Node {
+	var nodes []*discover.Node
+	for _, entry := range ns {
+		if entry.LastSeen.IsZero() {
+			continue
+		}
+		if n, err := discover.ParseNode(entry.Enode); err == nil {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// nodeList returns the nodes of the given network which answered their last
+// probe and published a node record, in the node list format of a DNS tree.
+func (ns nodeSet) nodeList(networkID uint64) nodeSet {
+	list := make(nodeSet)
+	for id, entry := range ns {
+		if entry.Record != "" && entry.Error == "" && !entry.LastSeen.IsZero() && entry.NetworkID == networkID {
+			list[id] = entry
+		}
+	}
+	return list
+}
@@ -0,0 +1,153 @@
+// kusdcrawl crawls the Kowala network, building an inventory of its nodes.
+//
+// The crawler walks the discovery DHT and connects to every node it finds,
+// running the RLPx and kusd handshakes to learn the client, protocol versions,
+// network and head of the node. Whether a node is a validator is taken from
+// its node record. The inventory is written as JSON and reloaded on the next
+// run, which only probes the nodes not checked within the recheck interval:
+//
+//     $ kusdcrawl -bootnodes enode://... -output nodes.json -timeout 30m
+//
+// The reachable nodes of a network can be written into the directory of a DNS
+// node list, ready to be signed by the dnslist tool:
+//
+//     $ kusdcrawl -output nodes.json -networkid 1 -dnslist mylist/
+//     $ dnslist sign mylist/ signer.key
+//
+package main
+
+import (
+	"crypto/ecdsa"
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kowala-tech/kUSD/cmd/utils"
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/p2p"
+	"github.com/kowala-tech/kUSD/p2p/discover"
+	"github.com/kowala-tech/kUSD/params"
+)
+
+const saveInterval = time.Minute // Time between two writes of the inventory
+
+func main() {
+	var (
+		listenAddr  = flag.String("addr", ":0", "UDP listen address of the discovery table")
+		bootnodes   = flag.String("bootnodes", "", "comma separated enode URLs to bootstrap discovery (defaults to the mainnet bootnodes)")
+		nodeKeyFile = flag.String("nodekey", "", "private key filename (a random key is used if not set)")
+		output      = flag.String("output", "nodes.json", "file of the node inventory, resumed if it exists")
+		timeout     = flag.Duration("timeout", 30*time.Minute, "duration of the crawl (0 crawls until interrupted)")
+		recheck     = flag.Duration("recheck", time.Hour, "minimum time between two probes of a node")
+		workers     = flag.Int("workers", 16, "number of nodes probed concurrently")
+		networkID   = flag.Uint64("networkid", 1, "network of the nodes written to the DNS node list")
+		dnsList     = flag.String("dnslist", "", "directory of a DNS node list to write the reachable nodes into")
+		verbosity   = flag.Int("verbosity", int(log.LvlInfo), "log verbosity (0-9)")
+
+		nodeKey *ecdsa.PrivateKey
+		err     error
+	)
+	flag.Parse()
+
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(*verbosity))
+	log.Root().SetHandler(glogger)
+
+	if *nodeKeyFile != "" {
+		if nodeKey, err = crypto.LoadECDSA(*nodeKeyFile); err != nil {
+			utils.Fatalf("-nodekey: %v", err)
+		}
+	} else if nodeKey, err = crypto.GenerateKey(); err != nil {
+		utils.Fatalf("could not generate key: %v", err)
+	}
+	if *workers < 1 {
+		utils.Fatalf("-workers: need at least one worker")
+	}
+	inventory, err := loadNodeSet(*output)
+	if err != nil {
+		utils.Fatalf("Can't load inventory %s: %v", *output, err)
+	}
+	// Bootstrap discovery from the given nodes and the ones of earlier runs
+	urls := params.MainnetBootnodes
+	if *bootnodes != "" {
+		urls = strings.Split(*bootnodes, ",")
+	}
+	seeds := inventory.seeds()
+	for _, url := range urls {
+		n, err := discover.ParseNode(url)
+		if err != nil {
+			utils.Fatalf("-bootnodes: invalid enode %q: %v", url, err)
+		}
+		seeds = append(seeds, n)
+	}
+	if len(seeds) == 0 {
+		utils.Fatalf("No bootstrap nodes given and no nodes known from earlier runs")
+	}
+	tab, err := discover.ListenUDP(nodeKey, *listenAddr, nil, "", nil)
+	if err != nil {
+		utils.Fatalf("%v", err)
+	}
+	defer tab.Close()
+	if err := tab.SetFallbackNodes(seeds); err != nil {
+		utils.Fatalf("%v", err)
+	}
+	// Run a p2p server without listener and discovery to handshake with nodes
+	c := newCrawler(tab, inventory, *recheck, *workers)
+	c.srv = &p2p.Server{Config: p2p.Config{
+		PrivateKey:  nodeKey,
+		Name:        common.MakeName("kusdcrawl", params.Version),
+		MaxPeers:    2 * *workers,
+		NoDiscovery: true,
+		Protocols:   c.protocols(),
+	}}
+	if err := c.srv.Start(); err != nil {
+		utils.Fatalf("%v", err)
+	}
+	defer c.srv.Stop()
+
+	write := func() {
+		if err := inventory.write(*output); err != nil {
+			log.Error("Failed to write inventory", "file", *output, "err", err)
+			return
+		}
+		log.Info("Wrote inventory", "file", *output, "nodes", len(inventory))
+	}
+	quit := make(chan struct{})
+	go func() {
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(sigc)
+
+		var deadline <-chan time.Time
+		if *timeout > 0 {
+			deadline = time.After(*timeout)
+		}
+		select {
+		case <-sigc:
+			log.Info("Interrupted, stopping crawl")
+		case <-deadline:
+		}
+		close(quit)
+	}()
+	save := time.NewTicker(saveInterval)
+	defer save.Stop()
+
+	log.Info("Crawling network", "seeds", len(seeds), "known", len(inventory), "timeout", *timeout)
+	c.run(quit, save.C, write)
+	write()
+
+	if *dnsList != "" {
+		list := inventory.nodeList(*networkID)
+		path := filepath.Join(*dnsList, "nodes.json")
+		if err := list.write(path); err != nil {
+			utils.Fatalf("Can't write DNS node list: %v", err)
+		}
+		log.Info("Wrote DNS node list", "file", path, "network", *networkID, "nodes", len(list))
+	}
+}
@@ -0,0 +1,249 @@
+// kusdsigner is a standalone signer daemon holding the keys of Kowala accounts
+// and validators outside of the kusd process.
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/kowala-tech/kUSD/accounts/keystore"
+	"github.com/kowala-tech/kUSD/cmd/utils"
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/console"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/internal/debug"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/node"
+	"github.com/kowala-tech/kUSD/rpc"
+	"github.com/kowala-tech/kUSD/signer"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var (
+	// Git SHA1 commit hash of the release (set via linker flags)
+	gitCommit = ""
+	// The app that holds all commands and flags.
+	app = utils.NewApp(gitCommit, "the kowala external signer daemon")
+
+	dataDirFlag = utils.DirectoryFlag{
+		Name:  "datadir",
+		Usage: "Directory for the signer IPC endpoint and signing state",
+		Value: utils.DirectoryString{Value: filepath.Join(node.DefaultDataDir(), "signer")},
+	}
+	keyStoreDirFlag = utils.DirectoryFlag{
+		Name:  "keystore",
+		Usage: "Directory for the keystore",
+		Value: utils.DirectoryString{Value: filepath.Join(node.DefaultDataDir(), "keystore")},
+	}
+	chainIDFlag = cli.Uint64Flag{
+		Name:  "chainid",
+		Usage: "Chain identifier to restrict signing to (0 = any chain)",
+	}
+	ipcPathFlag = cli.StringFlag{
+		Name:  "ipcpath",
+		Usage: "Filename for IPC socket/pipe within the datadir (explicit paths escape it)",
+		Value: "kusdsigner.ipc",
+	}
+	httpEnabledFlag = cli.BoolFlag{
+		Name:  "rpc",
+		Usage: "Enable the HTTP-RPC server",
+	}
+	httpListenAddrFlag = cli.StringFlag{
+		Name:  "rpcaddr",
+		Usage: "HTTP-RPC server listening interface",
+		Value: node.DefaultHTTPHost,
+	}
+	httpPortFlag = cli.IntFlag{
+		Name:  "rpcport",
+		Usage: "HTTP-RPC server listening port",
+		Value: 8550,
+	}
+)
+
+func init() {
+	app.Action = signerd
+	app.HideVersion = true
+	app.Copyright = "Copyright 2013-2017 The go-ethereum Authors"
+	app.Flags = []cli.Flag{
+		dataDirFlag,
+		keyStoreDirFlag,
+		utils.LightKDFFlag,
+		utils.UnlockedAccountFlag,
+		utils.PasswordFileFlag,
+		chainIDFlag,
+		utils.IPCDisabledFlag,
+		ipcPathFlag,
+		httpEnabledFlag,
+		httpListenAddrFlag,
+		httpPortFlag,
+		utils.RPCAuthFileFlag,
+	}
+	app.Flags = append(app.Flags, debug.Flags...)
+
+	app.Before = func(ctx *cli.Context) error {
+		runtime.GOMAXPROCS(runtime.NumCPU())
+		return debug.Setup(ctx)
+	}
+	app.After = func(ctx *cli.Context) error {
+		debug.Exit()
+		console.Stdin.Close() // Resets terminal mode.
+		return nil
+	}
+}
+
+func main() {
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// signerd unlocks the requested accounts and serves the signer API until
+// interrupted.
+func signerd(ctx *cli.Context) error {
+	datadir := ctx.GlobalString(dataDirFlag.Name)
+	if err := os.MkdirAll(datadir, 0700); err != nil {
+		utils.Fatalf("Failed to create data directory: %v", err)
+	}
+	scryptN, scryptP := keystore.StandardScryptN, keystore.StandardScryptP
+	if ctx.GlobalBool(utils.LightKDFFlag.Name) {
+		scryptN, scryptP = keystore.LightScryptN, keystore.LightScryptP
+	}
+	ks := keystore.NewKeyStore(ctx.GlobalString(keyStoreDirFlag.Name), scryptN, scryptP)
+
+	passwords := utils.MakePasswordList(ctx)
+	unlocks := strings.Split(ctx.GlobalString(utils.UnlockedAccountFlag.Name), ",")
+	for i, account := range unlocks {
+		if trimmed := strings.TrimSpace(account); trimmed != "" {
+			unlockAccount(ks, trimmed, i, passwords)
+		}
+	}
+	policy, err := signer.NewPolicy(filepath.Join(datadir, "signstate.json"))
+	if err != nil {
+		utils.Fatalf("Failed to load signing state: %v", err)
+	}
+	var chainID *big.Int
+	if id := ctx.GlobalUint64(chainIDFlag.Name); id != 0 {
+		chainID = new(big.Int).SetUint64(id)
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName(signer.Namespace, signer.NewSignerAPI(ks, policy, new(consoleApprover), chainID)); err != nil {
+		utils.Fatalf("Failed to register signer API: %v", err)
+	}
+	// Start the requested endpoints
+	if !ctx.GlobalBool(utils.IPCDisabledFlag.Name) {
+		endpoint := ctx.GlobalString(ipcPathFlag.Name)
+		if runtime.GOOS == "windows" {
+			endpoint = `\\.\pipe\` + endpoint
+		} else if filepath.Base(endpoint) == endpoint {
+			endpoint = filepath.Join(datadir, endpoint)
+		}
+		listener, err := rpc.CreateIPCListener(endpoint)
+		if err != nil {
+			utils.Fatalf("Failed to start IPC endpoint: %v", err)
+		}
+		defer listener.Close()
+		go server.ServeListener(listener)
+		log.Info("IPC endpoint opened", "url", endpoint)
+	}
+	if ctx.GlobalBool(httpEnabledFlag.Name) {
+		// Anything reaching the port could get transactions signed otherwise
+		path := ctx.GlobalString(utils.RPCAuthFileFlag.Name)
+		if path == "" {
+			utils.Fatalf("The HTTP endpoint requires client authentication, set --%s", utils.RPCAuthFileFlag.Name)
+		}
+		auth, err := rpc.LoadAuthenticator(path)
+		if err != nil {
+			utils.Fatalf("Failed to load RPC authentication: %v", err)
+		}
+		server.SetAuthenticator(auth)
+
+		endpoint := fmt.Sprintf("%s:%d", ctx.GlobalString(httpListenAddrFlag.Name), ctx.GlobalInt(httpPortFlag.Name))
+		listener, err := net.Listen("tcp", endpoint)
+		if err != nil {
+			utils.Fatalf("Failed to start HTTP endpoint: %v", err)
+		}
+		defer listener.Close()
+		go rpc.NewHTTPServer(nil, server).Serve(listener)
+		log.Info("HTTP endpoint opened", "url", fmt.Sprintf("http://%s", endpoint))
+	}
+	// Wait for termination
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt)
+	defer signal.Stop(sigc)
+
+	<-sigc
+	log.Info("Got interrupt, shutting down...")
+	server.Stop()
+	return nil
+}
+
+// unlockAccount tries unlocking the specified account a few times.
+func unlockAccount(ks *keystore.KeyStore, address string, i int, passwords []string) {
+	account, err := utils.MakeAddress(ks, address)
+	if err != nil {
+		utils.Fatalf("Could not list accounts: %v", err)
+	}
+	for trials := 0; trials < 3; trials++ {
+		var password string
+		if i < len(passwords) {
+			password = passwords[i]
+		} else {
+			prompt := fmt.Sprintf("Unlocking account %s | Attempt %d/%d", address, trials+1, 3)
+			if password, err = console.Stdin.PromptPassword(prompt + "\nPassphrase: "); err != nil {
+				utils.Fatalf("Failed to read passphrase: %v", err)
+			}
+		}
+		if err = ks.Unlock(account, password); err == nil {
+			log.Info("Unlocked account", "address", account.Address.Hex())
+			return
+		}
+		if err != keystore.ErrDecrypt || i < len(passwords) {
+			// No need to prompt again if the error is not decryption-related
+			break
+		}
+	}
+	utils.Fatalf("Failed to unlock account %s (%v)", address, err)
+}
+
+// consoleApprover asks the user on the terminal of the signer to confirm every
+// transaction before it's signed, one at a time.
+type consoleApprover struct {
+	lock sync.Mutex
+}
+
+// ApproveTx implements signer.TxApprover, describing the transaction and
+// refusing it unless the user confirms.
+func (a *consoleApprover) ApproveTx(account common.Address, tx *types.Transaction, chainID *big.Int) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	to := "contract creation"
+	if tx.To() != nil {
+		to = tx.To().Hex()
+	}
+	fmt.Println()
+	fmt.Printf("Request to sign a transaction on chain %v\n", chainID)
+	fmt.Printf("  from:      %s\n", account.Hex())
+	fmt.Printf("  to:        %s\n", to)
+	fmt.Printf("  value:     %v wei\n", tx.Value())
+	fmt.Printf("  gas:       %v at %v wei\n", tx.Gas(), tx.GasPrice())
+	fmt.Printf("  nonce:     %d\n", tx.Nonce())
+	fmt.Printf("  data:      %d bytes\n", len(tx.Data()))
+
+	ok, err := console.Stdin.PromptConfirm("Sign the transaction?")
+	if err != nil {
+		return fmt.Errorf("%v: %v", signer.ErrTxRefused, err)
+	}
+	if !ok {
+		return signer.ErrTxRefused
+	}
+	return nil
+}
@@ -18,6 +18,25 @@
 //     $ p2psim node connect node01 node02
 //     Connected node01 to node02
 //
+// It can also host a network of Kowala validators to test the consensus under
+// faults, which the simulated validators inject on request:
+//
+//     $ p2psim consensus --validators 4 &
+//     Serving 4 validators on :8888
+//
+//     $ p2psim node rpc validator00 sim_setDelay 200ms 50ms
+//     $ p2psim node rpc validator01 sim_setLoss 0.1
+//     $ p2psim node rpc validator02 sim_setByzantine true
+//     $ p2psim node rpc validator03 sim_setClockSkew -300ms
+//     $ p2psim node disconnect validator00 validator01
+//     $ p2psim node stop validator03
+//
+//     $ p2psim node rpc validator00 sim_heights
+//     {"validator00":12,"validator01":12,"validator02":11}
+//
+//     $ p2psim node rpc validator00 sim_checkSafety
+//     conflicting blocks at height 7: validator00 committed ..., validator02 committed ...
+//
 package main
 
 import (
@@ -25,11 +44,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"strings"
 	"text/tabwriter"
 
 	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/kusd/simulation"
 	"github.com/kowala-tech/kUSD/p2p"
 	"github.com/kowala-tech/kUSD/p2p/discover"
 	"github.com/kowala-tech/kUSD/p2p/simulations"
@@ -87,6 +108,23 @@ func main() {
 			Usage:  "load a network snapshot from stdin",
 			Action: loadSnapshot,
 		},
+		{
+			Name:   "consensus",
+			Usage:  "serve a simulated network of validators",
+			Action: serveConsensus,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "validators",
+					Value: 4,
+					Usage: "number of validators",
+				},
+				cli.StringFlag{
+					Name:  "addr",
+					Value: ":8888",
+					Usage: "simulation API listening address",
+				},
+			},
+		},
 		{
 			Name:   "node",
 			Usage:  "manage simulation nodes",
@@ -164,7 +202,10 @@ func main() {
 			},
 		},
 	}
-	app.Run(os.Args)
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
 func showNetwork(ctx *cli.Context) error {
@@ -230,6 +271,23 @@ func loadSnapshot(ctx *cli.Context) error {
 	return client.LoadSnapshot(snap)
 }
 
+func serveConsensus(ctx *cli.Context) error {
+	if len(ctx.Args()) != 0 {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	harness, err := simulation.New(ctx.Int("validators"))
+	if err != nil {
+		return err
+	}
+	defer harness.Shutdown()
+
+	if err := harness.Start(); err != nil {
+		return err
+	}
+	fmt.Fprintln(ctx.App.Writer, "Serving", ctx.Int("validators"), "validators on", ctx.String("addr"))
+	return http.ListenAndServe(ctx.String("addr"), simulations.NewServer(harness.Network()))
+}
+
 func listNodes(ctx *cli.Context) error {
 	if len(ctx.Args()) != 0 {
 		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
@@ -372,11 +430,11 @@ func rpcNode(ctx *cli.Context) error {
 		return err
 	}
 	if ctx.Bool("subscribe") {
-		return rpcSubscribe(rpcClient, ctx.App.Writer, method, args[3:]...)
+		return rpcSubscribe(rpcClient, ctx.App.Writer, method, args[2:]...)
 	}
 	var result interface{}
-	params := make([]interface{}, len(args[3:]))
-	for i, v := range args[3:] {
+	params := make([]interface{}, len(args[2:]))
+	for i, v := range args[2:] {
 		params[i] = v
 	}
 	if err := rpcClient.Call(&result, method, params...); err != nil {
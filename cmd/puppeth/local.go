@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/kowala-tech/kUSD/log"
+)
+
+// localServer is the name the docker daemon of the local machine is listed as
+// among the servers, once chosen to deploy to instead of a remote server.
+const localServer = "localhost"
+
+// dialLocal creates a client running commands on the local machine, in a scratch
+// directory. Containers reach the services of other containers through the host
+// ports, so the local machine is addressed by its IP on the docker bridge.
+func dialLocal() (*sshClient, error) {
+	dir := filepath.Join(os.TempDir(), "puppeth")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	logger := log.New("server", localServer)
+	c := &sshClient{
+		server:   localServer,
+		address:  "127.0.0.1",
+		logger:   logger,
+		executor: &localExecutor{dir: dir, logger: logger},
+	}
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	out, err := c.Run("docker network inspect bridge --format '{{(index .IPAM.Config 0).Gateway}}'")
+	if ip := net.ParseIP(string(bytes.TrimSpace(out))); err == nil && ip != nil {
+		c.server, c.address = ip.String(), ip.String()
+	} else {
+		c.logger.Warn("Docker bridge gateway unknown, containers may not reach each other", "err", err)
+	}
+	return c, nil
+}
+
+// localExecutor runs the commands on the local machine, in a working directory.
+type localExecutor struct {
+	dir    string
+	logger log.Logger
+}
+
+// Close is a no-op, there's no connection to terminate.
+func (client *localExecutor) Close() error {
+	return nil
+}
+
+// Run executes a command on the local machine and returns the combined output
+// along with any error status.
+func (client *localExecutor) Run(cmd string) ([]byte, error) {
+	client.logger.Trace("Running command on local machine", "cmd", cmd)
+
+	command := exec.Command("/bin/sh", "-c", cmd)
+	command.Dir = client.dir
+	return command.CombinedOutput()
+}
+
+// Stream executes a command on the local machine and streams all outputs into
+// the stdout and stderr streams.
+func (client *localExecutor) Stream(cmd string) error {
+	client.logger.Trace("Streaming command on local machine", "cmd", cmd)
+
+	command := exec.Command("/bin/sh", "-c", cmd)
+	command.Dir = client.dir
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	return command.Run()
+}
+
+// Upload copies the set of files into the working directory, creating any
+// non-existing folder in the mean time.
+func (client *localExecutor) Upload(files map[string][]byte) ([]byte, error) {
+	for file, content := range files {
+		client.logger.Trace("Copying file to working directory", "file", file, "bytes", len(content))
+
+		path := filepath.Join(client.dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
@@ -462,7 +462,7 @@ func deployDashboard(client *sshClient, network string, port int, vhost string,
 	indexfile := new(bytes.Buffer)
 	template.Must(template.New("").Parse(dashboardContent)).Execute(indexfile, map[string]interface{}{
 		"Network":            network,
-		"NetworkID":          conf.genesis.Config.ChainID,
+		"NetworkID":          conf.Genesis.Config.ChainID,
 		"NetworkTitle":       strings.Title(network),
 		"EthstatsPage":       services["ethstats"],
 		"ExplorerPage":       services["explorer"],
@@ -477,7 +477,7 @@ func deployDashboard(client *sshClient, network string, port int, vhost string,
 	})
 	files[filepath.Join(workdir, "index.html")] = indexfile.Bytes()
 
-	genesis, _ := conf.genesis.MarshalJSON()
+	genesis, _ := conf.Genesis.MarshalJSON()
 	files[filepath.Join(workdir, network+".json")] = genesis
 
 	files[filepath.Join(workdir, "puppeth.png")] = dashboardMascot
@@ -2,35 +2,48 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"math/rand"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"text/template"
 
+	"github.com/kowala-tech/kUSD/accounts/abi"
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/common/hexutil"
+	"github.com/kowala-tech/kUSD/contracts/network"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/state"
+	"github.com/kowala-tech/kUSD/core/vm/runtime"
 	"github.com/kowala-tech/kUSD/log"
 )
 
-// nodeDockerfile is the Dockerfile required to run an Ethereum node.
+// defaultDeposit is the minimum deposit accepted by the network contract, in wei.
+const defaultDeposit = 100000
+
+// nodeDockerfile is the Dockerfile required to run a Kowala node.
 var nodeDockerfile = `
-FROM ethereum/client-go:alpine-develop
+FROM kowalatech/kusd:latest
 
 ADD genesis.json /genesis.json
-{{if .Unlock}}
+{{if .Validator}}
 	ADD signer.json /signer.json
 	ADD signer.pass /signer.pass
 {{end}}
 RUN \
-  echo '/kusd init /genesis.json' > kusd.sh && \{{if .Unlock}}
-	echo 'mkdir -p /root/.ethereum/keystore/ && cp /signer.json /root/.ethereum/keystore/' >> kusd.sh && \{{end}}
-	echo $'/kusd --networkid {{.NetworkID}} --cache 512 --port {{.Port}} --maxpeers {{.Peers}} {{.LightFlag}} --stats \'{{.Stats}}\' {{if .BootV4}}--bootnodesv4 {{.BootV4}}{{end}} {{if .BootV5}}--bootnodesv5 {{.BootV5}}{{end}} {{if .Coinbase}}--coinbase {{.Etherbase}} --mine{{end}}{{if .Unlock}}--unlock 0 --password /signer.pass --mine{{end}} --targetgaslimit {{.GasTarget}} --gasprice {{.GasPrice}}' >> kusd.sh
+  echo '/kusd/kusd init /genesis.json' > kusd.sh && \{{if .Validator}}
+	echo 'mkdir -p /root/.kUSD/keystore/ && cp /signer.json /root/.kUSD/keystore/' >> kusd.sh && \{{end}}
+	echo $'/kusd/kusd --networkid {{.NetworkID}} --cache 512 --port {{.Port}} --maxpeers {{.Peers}} {{.LightFlag}} --stats \'{{.Stats}}\' {{if .BootV4}}--bootnodesv4 {{.BootV4}}{{end}} {{if .BootV5}}--bootnodesv5 {{.BootV5}}{{end}} {{if .Validator}}--coinbase {{.Validator}} --unlock {{.Validator}} --password /signer.pass --validate --deposit {{.Deposit}}{{end}} --targetgaslimit {{.GasTarget}} --gasprice {{.GasPrice}}' >> kusd.sh
 
 ENTRYPOINT ["/bin/sh", "kusd.sh"]
 `
 
 // nodeComposefile is the docker-compose.yml file required to deploy and maintain
-// an Ethereum node (bootnode or miner for now).
+// a Kowala node (bootnode or validator for now).
 var nodeComposefile = `
 version: '2'
 services:
@@ -42,14 +55,15 @@ services:
       - "{{.FullPort}}:{{.FullPort}}/udp"{{if .Light}}
       - "{{.LightPort}}:{{.LightPort}}/udp"{{end}}
     volumes:
-      - {{.Datadir}}:/root/.ethereum
+      - {{.Datadir}}:/root/.kUSD
     environment:
       - FULL_PORT={{.FullPort}}/tcp
       - LIGHT_PORT={{.LightPort}}/udp
       - TOTAL_PEERS={{.TotalPeers}}
       - LIGHT_PEERS={{.LightPeers}}
-      - STATS_NAME={{.Ethstats}}
-      - MINER_NAME={{.Etherbase}}
+      - STATS_NAME={{.Stats}}
+      - VALIDATOR_NAME={{.Validator}}
+      - DEPOSIT={{.Deposit}}
       - GAS_TARGET={{.GasTarget}}
       - GAS_PRICE={{.GasPrice}}
     logging:
@@ -64,8 +78,8 @@ services:
 // docker and docker-compose. If an instance with the specified network name
 // already exists there, it will be overwritten!
 func deployNode(client *sshClient, network string, bootv4, bootv5 []string, config *nodeInfos) ([]byte, error) {
-	kind := "sealnode"
-	if config.keyJSON == "" && config.coinbase == "" {
+	kind := "validator"
+	if config.keyJSON == "" {
 		kind = "bootnode"
 		bootv4 = make([]string, 0)
 		bootv5 = make([]string, 0)
@@ -87,10 +101,10 @@ func deployNode(client *sshClient, network string, bootv4, bootv5 []string, conf
 		"BootV4":    strings.Join(bootv4, ","),
 		"BootV5":    strings.Join(bootv5, ","),
 		"Stats":     config.stats,
-		"Coinbase":  config.coinbase,
+		"Validator": config.validator,
+		"Deposit":   config.deposit,
 		"GasTarget": uint64(1000000 * config.gasTarget),
 		"GasPrice":  uint64(1000000000 * config.gasPrice),
-		"Unlock":    config.keyJSON != "",
 	})
 	files[filepath.Join(workdir, "Dockerfile")] = dockerfile.Bytes()
 
@@ -105,7 +119,8 @@ func deployNode(client *sshClient, network string, bootv4, bootv5 []string, conf
 		"LightPort":  config.portFull + 1,
 		"LightPeers": config.peersLight,
 		"Stats":      config.stats[:strings.Index(config.stats, ":")],
-		"Coinbase":   config.coinbase,
+		"Validator":  config.validator,
+		"Deposit":    config.deposit,
 		"GasTarget":  config.gasTarget,
 		"GasPrice":   config.gasPrice,
 	})
@@ -124,12 +139,12 @@ func deployNode(client *sshClient, network string, bootv4, bootv5 []string, conf
 	}
 	defer client.Run("rm -rf " + workdir)
 
-	// Build and deploy the boot or seal node service
+	// Build and deploy the boot or validator node service
 	return nil, client.Stream(fmt.Sprintf("cd %s && docker-compose -p %s up -d --build", workdir, network))
 }
 
-// nodeInfos is returned from a boot or seal node status check to allow reporting
-// various configuration parameters.
+// nodeInfos is returned from a boot or validator node status check to allow
+// reporting various configuration parameters.
 type nodeInfos struct {
 	genesis    []byte
 	network    int64
@@ -141,7 +156,9 @@ type nodeInfos struct {
 	enodeLight string
 	peersTotal int
 	peersLight int
-	coinbase   string
+	validator  string   // address of the validator account
+	deposit    uint64   // deposit made by the validator if not a genesis voter
+	stake      *big.Int // deposit found in the network contract, nil if not a voter
 	keyJSON    string
 	keyPass    string
 	gasTarget  float64
@@ -154,16 +171,25 @@ func (info *nodeInfos) String() string {
 	if info.peersLight > 0 {
 		discv5 = fmt.Sprintf(", portv5=%d", info.portLight)
 	}
-	return fmt.Sprintf("port=%d%s, datadir=%s, peers=%d, lights=%d, ethstats=%s, gastarget=%0.3f MGas, gasprice=%0.3f GWei",
-		info.portFull, discv5, info.datadir, info.peersTotal, info.peersLight, info.stats, info.gasTarget, info.gasPrice)
+	validator := ""
+	if info.validator != "" {
+		voter := "not a voter"
+		if info.stake != nil {
+			voter = fmt.Sprintf("voter with %v wei at stake", info.stake)
+		}
+		validator = fmt.Sprintf(", validator=%s (%s)", info.validator, voter)
+	}
+	return fmt.Sprintf("port=%d%s, datadir=%s, peers=%d, lights=%d, ethstats=%s%s, gastarget=%0.3f MGas, gasprice=%0.3f GWei",
+		info.portFull, discv5, info.datadir, info.peersTotal, info.peersLight, info.stats, validator, info.gasTarget, info.gasPrice)
 }
 
-// checkNode does a health-check against an boot or seal node server to verify
-// whether it's running, and if yes, whether it's responsive.
+// checkNode does a health-check against an boot or validator node server to
+// verify whether it's running, and if yes, whether it's responsive. Validators
+// are also looked up in the voters of the network contract.
 func checkNode(client *sshClient, network string, boot bool) (*nodeInfos, error) {
 	kind := "bootnode"
 	if !boot {
-		kind = "sealnode"
+		kind = "validator"
 	}
 	// Inspect a possible bootnode container on the host
 	infos, err := inspectContainer(client, fmt.Sprintf("%s_%s_1", network, kind))
@@ -178,10 +204,11 @@ func checkNode(client *sshClient, network string, boot bool) (*nodeInfos, error)
 	lightPeers, _ := strconv.Atoi(infos.envvars["LIGHT_PEERS"])
 	gasTarget, _ := strconv.ParseFloat(infos.envvars["GAS_TARGET"], 64)
 	gasPrice, _ := strconv.ParseFloat(infos.envvars["GAS_PRICE"], 64)
+	deposit, _ := strconv.ParseUint(infos.envvars["DEPOSIT"], 10, 64)
 
 	// Container available, retrieve its node ID and its genesis json
 	var out []byte
-	if out, err = client.Run(fmt.Sprintf("docker exec %s_%s_1 /kusd --exec admin.nodeInfo.id attach", network, kind)); err != nil {
+	if out, err = client.Run(fmt.Sprintf("docker exec %s_%s_1 /kusd/kusd --exec admin.nodeInfo.id attach", network, kind)); err != nil {
 		return nil, ErrServiceUnreachable
 	}
 	id := bytes.Trim(bytes.TrimSpace(out), "\"")
@@ -206,21 +233,141 @@ func checkNode(client *sshClient, network string, boot bool) (*nodeInfos, error)
 	// Assemble and return the useful infos
 	stats := &nodeInfos{
 		genesis:    genesis,
-		datadir:    infos.volumes["/root/.ethereum"],
+		datadir:    infos.volumes["/root/.kUSD"],
 		portFull:   infos.portmap[infos.envvars["FULL_PORT"]],
 		portLight:  infos.portmap[infos.envvars["LIGHT_PORT"]],
 		peersTotal: totalPeers,
 		peersLight: lightPeers,
 		stats:      infos.envvars["STATS_NAME"],
-		coinbase:   infos.envvars["VALIDATOR_NAME"],
+		validator:  infos.envvars["VALIDATOR_NAME"],
+		deposit:    deposit,
 		keyJSON:    keyJSON,
 		keyPass:    keyPass,
 		gasTarget:  gasTarget,
 		gasPrice:   gasPrice,
 	}
+	if stats.validator != "" {
+		container := fmt.Sprintf("%s_%s_1", network, kind)
+		if stats.stake, err = checkVoter(client, container, genesis, common.HexToAddress(stats.validator)); err != nil {
+			log.Warn("Validator voter registration unverifiable", "server", client.server, "err", err)
+		}
+	}
 	stats.enodeFull = fmt.Sprintf("enode://%s@%s:%d", id, client.address, stats.portFull)
 	if stats.portLight != 0 {
 		stats.enodeLight = fmt.Sprintf("enode://%s@%s:%d?discport=%d", id, client.address, stats.portFull, stats.portLight)
 	}
 	return stats, nil
 }
+
+// networkContract returns the address of the network contract in the state of a
+// genesis block, along with that state.
+func networkContract(genesis *core.Genesis) (common.Address, *state.StateDB, error) {
+	_, statedb := genesis.ToBlock()
+	contracts, err := network.GetContracts(statedb)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	if contracts.Network == (common.Address{}) {
+		return common.Address{}, nil, errors.New("no network contract in genesis")
+	}
+	return contracts.Network, statedb, nil
+}
+
+// isGenesisVoter checks whether an account is a voter of the network contract in
+// a genesis block, so it won't deposit once the chain runs.
+func isGenesisVoter(genesis *core.Genesis, addr common.Address) (bool, error) {
+	contract, statedb, err := networkContract(genesis)
+	if err != nil {
+		return false, err
+	}
+	networkABI, err := abi.JSON(strings.NewReader(network.NetworkContractABI))
+	if err != nil {
+		return false, err
+	}
+	input, err := networkABI.Pack("isVoter", addr)
+	if err != nil {
+		return false, err
+	}
+	out, _, err := runtime.Call(contract, input, &runtime.Config{State: statedb})
+	if err != nil {
+		return false, err
+	}
+	var voter bool
+	if err := networkABI.Unpack(&voter, "isVoter", out); err != nil {
+		return false, err
+	}
+	return voter, nil
+}
+
+// checkVoter looks a validator up in the voters of the network contract through
+// the console of a running node, returning its deposit at stake or nil if it's
+// not a voter.
+func checkVoter(client *sshClient, container string, genesisJSON []byte, validator common.Address) (*big.Int, error) {
+	genesis := new(core.Genesis)
+	if err := json.Unmarshal(genesisJSON, genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis: %v", err)
+	}
+	contract, _, err := networkContract(genesis)
+	if err != nil {
+		return nil, err
+	}
+	networkABI, err := abi.JSON(strings.NewReader(network.NetworkContractABI))
+	if err != nil {
+		return nil, err
+	}
+	call := func(method string, args ...interface{}) (string, error) {
+		input, err := networkABI.Pack(method, args...)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("eth.call({to: \"%s\", data: \"%s\"})", contract.Hex(), hexutil.Encode(input)), nil
+	}
+	// Retrieve the number of voters, then all of them in one go
+	countCall, err := call("getVoterCount")
+	if err != nil {
+		return nil, err
+	}
+	out, err := client.Run(fmt.Sprintf("docker exec %s /kusd/kusd --exec '%s' attach", container, countCall))
+	if err != nil {
+		return nil, ErrServiceUnreachable
+	}
+	count := new(big.Int)
+	if err := unpackConsoleOutput(networkABI, &count, "getVoterCount", out); err != nil {
+		return nil, err
+	}
+	if count.Sign() == 0 {
+		return nil, nil
+	}
+	calls := make([]string, count.Int64())
+	for i := range calls {
+		if calls[i], err = call("getVoterAtIndex", big.NewInt(int64(i))); err != nil {
+			return nil, err
+		}
+	}
+	if out, err = client.Run(fmt.Sprintf("docker exec %s /kusd/kusd --exec '[%s].join()' attach", container, strings.Join(calls, ", "))); err != nil {
+		return nil, ErrServiceUnreachable
+	}
+	for _, result := range strings.Split(string(bytes.Trim(bytes.TrimSpace(out), "\"")), ",") {
+		var voter struct {
+			Addr    common.Address
+			Deposit *big.Int
+		}
+		if err := unpackConsoleOutput(networkABI, &voter, "getVoterAtIndex", []byte(result)); err != nil {
+			return nil, err
+		}
+		if voter.Addr == validator {
+			return voter.Deposit, nil
+		}
+	}
+	return nil, nil
+}
+
+// unpackConsoleOutput decodes the result of a contract call printed by the
+// console.
+func unpackConsoleOutput(contractABI abi.ABI, v interface{}, method string, out []byte) error {
+	data, err := hexutil.Decode(string(bytes.Trim(bytes.TrimSpace(out), "\"")))
+	if err != nil {
+		return fmt.Errorf("invalid %s result %q: %v", method, out, err)
+	}
+	return contractABI.Unpack(v, method, data)
+}
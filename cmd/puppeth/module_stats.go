@@ -139,10 +139,8 @@ func checkEthstats(client *sshClient, network string) (*ethstatsInfos, error) {
 		host = client.server
 	}
 	secret := infos.envvars["WS_SECRET"]
-	config := fmt.Sprintf("%s@%s", secret, host)
-	if port != 80 && port != 443 {
-		config += fmt.Sprintf(":%d", port)
-	}
+	config := ethstatsConfig(secret, host, port)
+
 	// Retrieve the IP blacklist
 	banned := strings.Split(infos.envvars["BANNED"], ",")
 
@@ -159,3 +157,13 @@ func checkEthstats(client *sshClient, network string) (*ethstatsInfos, error) {
 		banned: banned,
 	}, nil
 }
+
+// ethstatsConfig assembles the connection string nodes report to an ethstats
+// server with, leaving out the default web ports.
+func ethstatsConfig(secret string, host string, port int) string {
+	config := fmt.Sprintf("%s@%s", secret, host)
+	if port != 80 && port != 443 {
+		config += fmt.Sprintf(":%d", port)
+	}
+	return config
+}
@@ -1,7 +1,25 @@
 // puppeth is a command to assemble and maintain private networks.
+//
+// Besides the interactive wizard, a whole network can be run on the local
+// docker daemon without any questions asked, e.g. for CI:
+//
+//     $ puppeth --network testnet up --validators 4 --password pass.txt
+//     $ puppeth --network testnet status
+//     $ puppeth --network testnet down --purge
+//
+// Networks spanning remote servers can be described declaratively in a JSON spec
+// listing the genesis parameters, the servers and the components on them. The
+// plan command reports the differences between the spec and the deployed network,
+// which the apply command then deploys:
+//
+//     $ puppeth --network testnet plan testnet.json
+//     $ puppeth --network testnet apply testnet.json
+//
 package main
 
 import (
+	"errors"
+	"fmt"
 	"math/rand"
 	"os"
 	"time"
@@ -26,14 +44,127 @@ func main() {
 			Usage: "log level to emit to the screen",
 		},
 	}
-	app.Action = func(c *cli.Context) error {
+	app.Before = func(c *cli.Context) error {
 		// Set up the logger to print everything and the random generator
 		log.Root().SetHandler(log.LvlFilterHandler(log.Lvl(c.Int("loglevel")), log.StreamHandler(os.Stdout, log.TerminalFormat(true))))
 		rand.Seed(time.Now().UnixNano())
-
+		return nil
+	}
+	app.Action = func(c *cli.Context) error {
 		// Start the wizard and relinquish control
 		makeWizard(c.String("network")).run()
 		return nil
 	}
-	app.Run(os.Args)
+	app.Commands = []cli.Command{
+		{
+			Name:  "up",
+			Usage: "start a network on the local docker daemon, creating it if new",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "validators",
+					Value: 4,
+					Usage: "number of validators of a new network",
+				},
+				cli.StringFlag{
+					Name:  "password",
+					Usage: "file holding the password of the validator and faucet keys",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				w, err := localWizard(c)
+				if err != nil {
+					return err
+				}
+				return w.upLocal(c.Int("validators"), c.String("password"))
+			},
+		},
+		{
+			Name:  "status",
+			Usage: "health-check the components of a network on the local docker daemon",
+			Action: func(c *cli.Context) error {
+				w, err := localWizard(c)
+				if err != nil {
+					return err
+				}
+				return w.statusLocal()
+			},
+		},
+		{
+			Name:  "down",
+			Usage: "tear down a network on the local docker daemon",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "purge",
+					Usage: "remove the built images and chain data too",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				w, err := localWizard(c)
+				if err != nil {
+					return err
+				}
+				return w.downLocal(c.Bool("purge"))
+			},
+		},
+		{
+			Name:      "plan",
+			Usage:     "report the changes needed to bring a network in line with a spec",
+			ArgsUsage: "<spec.json|spec.yaml>",
+			Action: func(c *cli.Context) error {
+				w, spec, err := specWizard(c)
+				if err != nil {
+					return err
+				}
+				plan, err := w.planSpec(spec)
+				if err != nil {
+					return err
+				}
+				plan.render()
+				return nil
+			},
+		},
+		{
+			Name:      "apply",
+			Usage:     "deploy the changes needed to bring a network in line with a spec",
+			ArgsUsage: "<spec.json|spec.yaml>",
+			Action: func(c *cli.Context) error {
+				w, spec, err := specWizard(c)
+				if err != nil {
+					return err
+				}
+				return w.applySpec(spec)
+			},
+		},
+	}
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// localWizard creates a wizard for the non-interactive commands, which need the
+// name of the network to administer.
+func localWizard(c *cli.Context) (*wizard, error) {
+	network := c.GlobalString("network")
+	if network == "" {
+		return nil, errors.New("no network name given, set it via --network")
+	}
+	return makeWizard(network), nil
+}
+
+// specWizard creates a wizard for the commands deploying a network spec, loading
+// the spec given as argument.
+func specWizard(c *cli.Context) (*wizard, *networkSpec, error) {
+	if c.NArg() != 1 {
+		return nil, nil, errors.New("a single network spec file expected")
+	}
+	w, err := localWizard(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	spec, err := loadSpec(c.Args().First())
+	if err != nil {
+		return nil, nil, err
+	}
+	return w, spec, nil
 }
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/kowala-tech/kUSD/accounts/keystore"
+	"github.com/kowala-tech/kUSD/common"
+	sysgenesis "github.com/kowala-tech/kUSD/contracts/network/genesis"
+	"github.com/kowala-tech/kUSD/core"
+	"gopkg.in/yaml.v2"
+)
+
+// networkSpec is the declarative description of a network, deployed by the plan
+// and apply commands. Components reference the server hosting them by its label
+// in the servers section.
+type networkSpec struct {
+	Genesis     genesisSpec       `json:"genesis" yaml:"genesis"`
+	Servers     map[string]string `json:"servers" yaml:"servers"`                             // Labels mapped to SSH logins (user@host:port)
+	LocalDocker bool              `json:"localDocker,omitempty" yaml:"localDocker,omitempty"` // Whether localhost is the local docker daemon, not dialed via SSH
+	Nginx       []nginxSpec       `json:"nginx,omitempty" yaml:"nginx,omitempty"`
+	Ethstats    *ethstatsSpec     `json:"ethstats,omitempty" yaml:"ethstats,omitempty"`
+	Bootnodes   []nodeSpec        `json:"bootnodes,omitempty" yaml:"bootnodes,omitempty"`
+	Validators  []nodeSpec        `json:"validators,omitempty" yaml:"validators,omitempty"`
+	Faucet      *faucetSpec       `json:"faucet,omitempty" yaml:"faucet,omitempty"`
+	Dashboard   *dashboardSpec    `json:"dashboard,omitempty" yaml:"dashboard,omitempty"`
+
+	dir string // Directory of the spec file, key files are relative to it
+}
+
+// genesisSpec describes the genesis block of the network. Either an existing
+// genesis file is referenced, or a proof-of-stake one is generated from the
+// parameters. The timestamp is part of the spec to keep the block the same
+// across runs.
+type genesisSpec struct {
+	File       string                 `json:"file,omitempty" yaml:"file,omitempty"`
+	ChainID    uint64                 `json:"chainId,omitempty" yaml:"chainId,omitempty"`
+	Timestamp  uint64                 `json:"timestamp,omitempty" yaml:"timestamp,omitempty"`
+	GasLimit   uint64                 `json:"gasLimit,omitempty" yaml:"gasLimit,omitempty"`
+	ExtraData  string                 `json:"extraData,omitempty" yaml:"extraData,omitempty"`
+	Owner      *common.Address        `json:"owner,omitempty" yaml:"owner,omitempty"` // Owner of the network contracts, the default one if unset
+	Validators []sysgenesis.Validator `json:"validators,omitempty" yaml:"validators,omitempty"`
+	Funds      []common.Address       `json:"funds,omitempty" yaml:"funds,omitempty"`
+}
+
+// nginxSpec describes a reverse-proxy sharing a port between the web services
+// of a server.
+type nginxSpec struct {
+	Server string `json:"server" yaml:"server"`
+	Port   int    `json:"port,omitempty" yaml:"port,omitempty"`
+}
+
+// ethstatsSpec describes the ethstats site all nodes report to.
+type ethstatsSpec struct {
+	Server     string   `json:"server" yaml:"server"`
+	Port       int      `json:"port,omitempty" yaml:"port,omitempty"`
+	Vhost      string   `json:"vhost,omitempty" yaml:"vhost,omitempty"`
+	SecretFile string   `json:"secretFile" yaml:"secretFile"` // File holding the API secret of the nodes
+	Banned     []string `json:"banned,omitempty" yaml:"banned,omitempty"`
+}
+
+// nodeSpec describes a bootnode or a validator. Validators sign with the key in
+// the keyfile, unlocked by the password in the password file.
+type nodeSpec struct {
+	Name       string  `json:"name" yaml:"name"` // Unique name, also reported to ethstats
+	Server     string  `json:"server" yaml:"server"`
+	Port       int     `json:"port" yaml:"port"`
+	Datadir    string  `json:"datadir" yaml:"datadir"`
+	Peers      int     `json:"peers,omitempty" yaml:"peers,omitempty"`
+	LightPeers int     `json:"lightPeers,omitempty" yaml:"lightPeers,omitempty"`
+	Keyfile    string  `json:"keyfile,omitempty" yaml:"keyfile,omitempty"`
+	Password   string  `json:"password,omitempty" yaml:"password,omitempty"`
+	Deposit    uint64  `json:"deposit,omitempty" yaml:"deposit,omitempty"`     // Deposit at stake if not a genesis voter (wei)
+	GasTarget  float64 `json:"gasTarget,omitempty" yaml:"gasTarget,omitempty"` // Gas limit empty blocks target (MGas)
+	GasPrice   float64 `json:"gasPrice,omitempty" yaml:"gasPrice,omitempty"`   // Minimum gas price accepted (GWei)
+}
+
+// faucetSpec describes a faucet granting funds from the account in the keyfile.
+type faucetSpec struct {
+	Server            string `json:"server" yaml:"server"`
+	Port              int    `json:"port,omitempty" yaml:"port,omitempty"`
+	Vhost             string `json:"vhost,omitempty" yaml:"vhost,omitempty"`
+	Datadir           string `json:"datadir" yaml:"datadir"`
+	NodePort          int    `json:"nodePort" yaml:"nodePort"` // devp2p port of the light client of the faucet
+	Keyfile           string `json:"keyfile" yaml:"keyfile"`
+	Password          string `json:"password" yaml:"password"`
+	Amount            int    `json:"amount,omitempty" yaml:"amount,omitempty"`
+	Minutes           int    `json:"minutes,omitempty" yaml:"minutes,omitempty"`
+	Tiers             int    `json:"tiers,omitempty" yaml:"tiers,omitempty"`
+	GithubUser        string `json:"githubUser,omitempty" yaml:"githubUser,omitempty"`
+	GithubTokenFile   string `json:"githubTokenFile,omitempty" yaml:"githubTokenFile,omitempty"`
+	CaptchaToken      string `json:"captchaToken,omitempty" yaml:"captchaToken,omitempty"`
+	CaptchaSecretFile string `json:"captchaSecretFile,omitempty" yaml:"captchaSecretFile,omitempty"`
+	NoAuth            bool   `json:"noauth,omitempty" yaml:"noauth,omitempty"`
+}
+
+// dashboardSpec describes the dashboard listing the services of the network.
+type dashboardSpec struct {
+	Server string `json:"server" yaml:"server"`
+	Port   int    `json:"port,omitempty" yaml:"port,omitempty"`
+	Vhost  string `json:"vhost,omitempty" yaml:"vhost,omitempty"`
+}
+
+// specComponent is a container deployed for a network spec.
+type specComponent struct {
+	label   string // Name of the component in reports
+	server  string // Label of the server hosting the component
+	network string // Network name the component is deployed under
+	service string // Service name of the component container
+}
+
+// nodeNameRegexp matches the names of nodes, which are part of their docker
+// compose project names.
+var nodeNameRegexp = regexp.MustCompile("^[a-z0-9]+$")
+
+// loadSpec reads a network spec from a JSON or YAML file, told apart by the file
+// extension, filling in the defaults of the wizard and validating it.
+func loadSpec(path string) (*networkSpec, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := new(networkSpec)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(blob, spec)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(blob))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec %s: %v", path, err)
+	}
+	spec.dir = filepath.Dir(path)
+	spec.setDefaults()
+
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("invalid spec %s: %v", path, err)
+	}
+	return spec, nil
+}
+
+// setDefaults fills in the values left out of the spec with the defaults the
+// wizard offers.
+func (spec *networkSpec) setDefaults() {
+	for i := range spec.Genesis.Validators {
+		if spec.Genesis.Validators[i].Deposit == nil {
+			spec.Genesis.Validators[i].Deposit = new(big.Int).SetUint64(defaultDeposit)
+		}
+	}
+	for i := range spec.Nginx {
+		if spec.Nginx[i].Port == 0 {
+			spec.Nginx[i].Port = 80
+		}
+	}
+	if spec.Ethstats != nil && spec.Ethstats.Port == 0 {
+		spec.Ethstats.Port = 80
+	}
+	for i := range spec.Bootnodes {
+		if spec.Bootnodes[i].Peers == 0 {
+			spec.Bootnodes[i].Peers = 50
+		}
+	}
+	for i := range spec.Validators {
+		node := &spec.Validators[i]
+		if node.Peers == 0 {
+			node.Peers = 50
+		}
+		if node.Deposit == 0 {
+			node.Deposit = defaultDeposit
+		}
+		if node.GasTarget == 0 {
+			node.GasTarget = 4.7
+		}
+		if node.GasPrice == 0 {
+			node.GasPrice = 18
+		}
+	}
+	if faucet := spec.Faucet; faucet != nil {
+		if faucet.Port == 0 {
+			faucet.Port = 80
+		}
+		if faucet.Amount == 0 {
+			faucet.Amount = 1
+		}
+		if faucet.Minutes == 0 {
+			faucet.Minutes = 1440
+		}
+		if faucet.Tiers == 0 {
+			faucet.Tiers = 3
+		}
+	}
+	if spec.Dashboard != nil && spec.Dashboard.Port == 0 {
+		spec.Dashboard.Port = 80
+	}
+}
+
+// validate checks that the spec describes a deployable network.
+func (spec *networkSpec) validate() error {
+	if spec.Genesis.File == "" && spec.Genesis.ChainID == 0 {
+		return errors.New("genesis needs either a file or a chain ID")
+	}
+	if len(spec.Genesis.ExtraData) > 32 {
+		return errors.New("genesis extra data longer than 32 bytes")
+	}
+	if len(spec.Servers) == 0 {
+		return errors.New("no servers")
+	}
+	// Every component needs a known server, and web services sharing a port
+	// need a reverse-proxy there
+	proxies := make(map[string]int)
+	for _, nginx := range spec.Nginx {
+		if _, ok := proxies[nginx.Server]; ok {
+			return fmt.Errorf("multiple reverse-proxies on server %s", nginx.Server)
+		}
+		proxies[nginx.Server] = nginx.Port
+	}
+	for _, comp := range spec.components("") {
+		if _, ok := spec.Servers[comp.server]; !ok {
+			return fmt.Errorf("%s on unknown server %q", comp.label, comp.server)
+		}
+	}
+	checkVhost := func(service, server, vhost string, port int) error {
+		if vhost != "" && proxies[server] != port {
+			return fmt.Errorf("%s virtual host needs a reverse-proxy on port %d of server %s", service, port, server)
+		}
+		return nil
+	}
+	if stats := spec.Ethstats; stats != nil {
+		if stats.SecretFile == "" {
+			return errors.New("ethstats without secret file")
+		}
+		if err := checkVhost("ethstats", stats.Server, stats.Vhost, stats.Port); err != nil {
+			return err
+		}
+	} else if len(spec.Bootnodes)+len(spec.Validators) > 0 || spec.Faucet != nil {
+		return errors.New("nodes report to ethstats, but none specified")
+	}
+	// Nodes are deployed under their names, which must be unique
+	names := make(map[string]bool)
+	for i, node := range append(append([]nodeSpec{}, spec.Bootnodes...), spec.Validators...) {
+		switch {
+		case !nodeNameRegexp.MatchString(node.Name):
+			return fmt.Errorf("invalid node name %q, only lowercase letters and digits allowed", node.Name)
+		case names[node.Name]:
+			return fmt.Errorf("duplicate node name %q", node.Name)
+		case node.Port == 0:
+			return fmt.Errorf("node %s without port", node.Name)
+		case !filepath.IsAbs(node.Datadir):
+			return fmt.Errorf("node %s datadir %q not an absolute path", node.Name, node.Datadir)
+		case i >= len(spec.Bootnodes) && (node.Keyfile == "" || node.Password == ""):
+			return fmt.Errorf("validator %s without keyfile or password file", node.Name)
+		case i < len(spec.Bootnodes) && node.Keyfile != "":
+			return fmt.Errorf("bootnode %s with keyfile", node.Name)
+		}
+		names[node.Name] = true
+	}
+	if faucet := spec.Faucet; faucet != nil {
+		switch {
+		case faucet.NodePort == 0:
+			return errors.New("faucet without node port")
+		case !filepath.IsAbs(faucet.Datadir):
+			return fmt.Errorf("faucet datadir %q not an absolute path", faucet.Datadir)
+		case faucet.Keyfile == "" || faucet.Password == "":
+			return errors.New("faucet without keyfile or password file")
+		case !faucet.NoAuth && faucet.GithubUser == "":
+			return errors.New("faucet needs a GitHub user to authenticate requests, or noauth")
+		}
+		if err := checkVhost("faucet", faucet.Server, faucet.Vhost, faucet.Port); err != nil {
+			return err
+		}
+	}
+	if dashboard := spec.Dashboard; dashboard != nil {
+		if err := checkVhost("dashboard", dashboard.Server, dashboard.Vhost, dashboard.Port); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// components lists the containers of the spec in deployment order. Nodes are
+// deployed under the network name suffixed with their names, as docker-compose
+// runs a single container of a service per network.
+func (spec *networkSpec) components(network string) []specComponent {
+	var comps []specComponent
+	for _, nginx := range spec.Nginx {
+		comps = append(comps, specComponent{label: "nginx", server: nginx.Server, network: network, service: "nginx"})
+	}
+	if spec.Ethstats != nil {
+		comps = append(comps, specComponent{label: "ethstats", server: spec.Ethstats.Server, network: network, service: "ethstats"})
+	}
+	for _, node := range spec.Bootnodes {
+		comps = append(comps, specComponent{label: "bootnode " + node.Name, server: node.Server, network: network + node.Name, service: "bootnode"})
+	}
+	for _, node := range spec.Validators {
+		comps = append(comps, specComponent{label: "validator " + node.Name, server: node.Server, network: network + node.Name, service: "validator"})
+	}
+	if spec.Faucet != nil {
+		comps = append(comps, specComponent{label: "faucet", server: spec.Faucet.Server, network: network, service: "faucet"})
+	}
+	if spec.Dashboard != nil {
+		comps = append(comps, specComponent{label: "dashboard", server: spec.Dashboard.Server, network: network, service: "dashboard"})
+	}
+	return comps
+}
+
+// makeGenesis loads or generates the genesis block of the spec.
+func (spec *genesisSpec) makeGenesis(dir string) (*core.Genesis, error) {
+	if spec.File != "" {
+		blob, err := ioutil.ReadFile(resolvePath(dir, spec.File))
+		if err != nil {
+			return nil, err
+		}
+		genesis := new(core.Genesis)
+		if err := json.Unmarshal(blob, genesis); err != nil {
+			return nil, fmt.Errorf("invalid genesis file %s: %v", spec.File, err)
+		}
+		if genesis.Config == nil || genesis.Config.ChainID == nil {
+			return nil, fmt.Errorf("genesis file %s without chain ID", spec.File)
+		}
+		return genesis, nil
+	}
+	owner := sysgenesis.DefaultOwner
+	if spec.Owner != nil {
+		owner = *spec.Owner
+	}
+	genesis, err := makeTendermintGenesis(new(big.Int).SetUint64(spec.ChainID), owner, spec.Validators, spec.Funds)
+	if err != nil {
+		return nil, err
+	}
+	genesis.Timestamp = spec.Timestamp
+	if spec.GasLimit != 0 {
+		genesis.GasLimit = spec.GasLimit
+	}
+	genesis.ExtraData = append([]byte(spec.ExtraData), genesis.ExtraData[len(spec.ExtraData):]...)
+	return genesis, nil
+}
+
+// readKey loads an encrypted key along with its password from the given files,
+// returning the address of the key too.
+func readKey(dir, keyfile, passfile string) (string, string, common.Address, error) {
+	keyJSON, err := ioutil.ReadFile(resolvePath(dir, keyfile))
+	if err != nil {
+		return "", "", common.Address{}, err
+	}
+	password, err := ioutil.ReadFile(resolvePath(dir, passfile))
+	if err != nil {
+		return "", "", common.Address{}, err
+	}
+	keyJSON, password = []byte(strings.TrimSpace(string(keyJSON))), []byte(strings.TrimSpace(string(password)))
+
+	key, err := keystore.DecryptKey(keyJSON, string(password))
+	if err != nil {
+		return "", "", common.Address{}, fmt.Errorf("can't decrypt %s: %v", keyfile, err)
+	}
+	return string(keyJSON), string(password), key.Address, nil
+}
+
+// readSecret loads a secret from the given file, keeping it out of the spec. No
+// file means no secret.
+func readSecret(dir, file string) (string, error) {
+	if file == "" {
+		return "", nil
+	}
+	blob, err := ioutil.ReadFile(resolvePath(dir, file))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(blob)), nil
+}
+
+// resolvePath returns path relative to dir, unless it is absolute.
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/log"
+)
+
+const testSpecJSON = `{
+	"genesis": {
+		"chainId": 519374298533,
+		"timestamp": 1500000000,
+		"validators": [
+			{"address": "0x00000000000000000000000000000000000000aa", "deposit": 1000000000000000000000000}
+		],
+		"funds": ["0x0000000000000000000000000000000000000001"]
+	},
+	"servers": {"main": "root@10.0.0.1:22"},
+	"ethstats": {"server": "main", "secretFile": "secret"},
+	"bootnodes": [
+		{"name": "boot", "server": "main", "port": 30303, "datadir": "/data/boot"}
+	]
+}`
+
+const testSpecYAML = `
+genesis:
+  chainId: 519374298533
+  timestamp: 1500000000
+  validators:
+    - address: 0x00000000000000000000000000000000000000aa
+      deposit: 1000000000000000000000000
+  funds:
+    - "0x0000000000000000000000000000000000000001"
+servers:
+  main: root@10.0.0.1:22
+ethstats:
+  server: main
+  secretFile: secret
+bootnodes:
+  - name: boot
+    server: main
+    port: 30303
+    datadir: /data/boot
+`
+
+// writeSpec saves a spec file along with the ethstats secret it references in
+// the given directory.
+func writeSpec(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Tests that JSON and YAML specs describe the very same network, down to the
+// deposits too large for the native integer types.
+func TestLoadSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "puppeth-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fromJSON, err := loadSpec(writeSpec(t, dir, "spec.json", testSpecJSON))
+	if err != nil {
+		t.Fatalf("failed to load JSON spec: %v", err)
+	}
+	fromYAML, err := loadSpec(writeSpec(t, dir, "spec.yaml", testSpecYAML))
+	if err != nil {
+		t.Fatalf("failed to load YAML spec: %v", err)
+	}
+	if !reflect.DeepEqual(fromJSON, fromYAML) {
+		t.Errorf("spec mismatch:\nJSON: %+v\nYAML: %+v", fromJSON, fromYAML)
+	}
+	validator := fromYAML.Genesis.Validators[0]
+	if want := common.HexToAddress("0x00000000000000000000000000000000000000aa"); validator.Address != want {
+		t.Errorf("validator address mismatch: have %x, want %x", validator.Address, want)
+	}
+	if want, _ := new(big.Int).SetString("1000000000000000000000000", 10); validator.Deposit.Cmp(want) != 0 {
+		t.Errorf("validator deposit mismatch: have %v, want %v", validator.Deposit, want)
+	}
+	if fromYAML.Ethstats.Port != 80 {
+		t.Errorf("ethstats port default mismatch: have %d, want 80", fromYAML.Ethstats.Port)
+	}
+	if secret, err := readSecret(fromYAML.dir, fromYAML.Ethstats.SecretFile); err != nil || secret != "s3cr3t" {
+		t.Errorf("secret mismatch: have %q, %v, want %q", secret, err, "s3cr3t")
+	}
+}
+
+func TestLoadSpecInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "puppeth-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name, content, err string
+	}{
+		{"unknown.json", strings.Replace(testSpecJSON, `"secretFile"`, `"secret"`, 1), "unknown field"},
+		{"unknown.yaml", strings.Replace(testSpecYAML, "secretFile:", "secret:", 1), "not found"},
+		{"server.yaml", strings.Replace(testSpecYAML, "server: main", "server: other", 1), "unknown server"},
+		{"name.yaml", strings.Replace(testSpecYAML, "name: boot", "name: Boot", 1), "invalid node name"},
+		{"datadir.yaml", strings.Replace(testSpecYAML, "/data/boot", "data/boot", 1), "not an absolute path"},
+		{"nostats.yaml", testSpecYAML[:strings.Index(testSpecYAML, "ethstats:")] + testSpecYAML[strings.Index(testSpecYAML, "bootnodes:"):], "none specified"},
+	}
+	for _, tt := range tests {
+		_, err := loadSpec(writeSpec(t, dir, tt.name, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error mismatch: have %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+// fakeExecutor stands in for a server, reporting the given containers as running
+// and recording the commands run on it.
+type fakeExecutor struct {
+	running map[string]bool
+	runs    []string
+	streams []string
+	uploads int
+}
+
+func (e *fakeExecutor) Run(cmd string) ([]byte, error) {
+	e.runs = append(e.runs, cmd)
+	if strings.HasPrefix(cmd, "docker inspect ") {
+		if !e.running[strings.TrimPrefix(cmd, "docker inspect ")] {
+			return nil, errors.New("no such container")
+		}
+		return []byte(`[{"State": {"Running": true}}]`), nil
+	}
+	return nil, nil
+}
+
+func (e *fakeExecutor) Stream(cmd string) error {
+	e.streams = append(e.streams, cmd)
+	return nil
+}
+
+func (e *fakeExecutor) Upload(files map[string][]byte) ([]byte, error) {
+	e.uploads++
+	return nil, nil
+}
+
+func (e *fakeExecutor) Close() error {
+	return nil
+}
+
+// newSpecWizard creates a wizard managing the network of a spec on the fake
+// server, keeping its configs in a scratch home directory.
+func newSpecWizard(t *testing.T, home string, server *fakeExecutor) *wizard {
+	os.Setenv("HOME", home)
+
+	w := makeWizard("test")
+	w.dialHook = func(login string) (*sshClient, error) {
+		return &sshClient{server: "10.0.0.1", address: "10.0.0.1", logger: log.New(), executor: server}, nil
+	}
+	return w
+}
+
+func actions(plan *specPlan) string {
+	var steps []string
+	for _, step := range plan.steps {
+		steps = append(steps, fmt.Sprintf("%s:%s", step.label, step.action))
+	}
+	return strings.Join(steps, ",")
+}
+
+// Tests that planning reports the components to deploy without touching the
+// servers or the configs.
+func TestPlanSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "puppeth-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+
+	spec, err := loadSpec(writeSpec(t, dir, "spec.yaml", testSpecYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := new(fakeExecutor)
+	w := newSpecWizard(t, dir, server)
+
+	plan, err := w.planSpec(spec)
+	if err != nil {
+		t.Fatalf("failed to plan spec: %v", err)
+	}
+	if have, want := actions(plan), "ethstats:create,bootnode boot:create"; have != want {
+		t.Errorf("plan mismatch: have %s, want %s", have, want)
+	}
+	if server.uploads > 0 || len(server.streams) > 0 {
+		t.Errorf("plan deployed: %d uploads, streams %v", server.uploads, server.streams)
+	}
+	for _, cmd := range server.runs {
+		if !strings.HasPrefix(cmd, "docker inspect ") {
+			t.Errorf("plan ran %q", cmd)
+		}
+	}
+	if _, err := os.Stat(configPath("test")); !os.IsNotExist(err) {
+		t.Errorf("plan saved the configs: %v", err)
+	}
+}
+
+// Tests that applying a spec deploys its components and records the spec, and
+// that components dropped from the next spec are torn down.
+func TestApplySpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "puppeth-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+
+	if err := os.MkdirAll(filepath.Join(dir, ".puppeth"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := loadSpec(writeSpec(t, dir, "spec.yaml", testSpecYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := new(fakeExecutor)
+	if err := newSpecWizard(t, dir, server).applySpec(spec); err != nil {
+		t.Fatalf("failed to apply spec: %v", err)
+	}
+	want := []string{"docker-compose -p test up -d --build", "docker-compose -p testboot up -d --build"}
+	if len(server.streams) != len(want) {
+		t.Fatalf("deployment mismatch: have %v, want %v", server.streams, want)
+	}
+	for i, cmd := range server.streams {
+		if !strings.HasSuffix(cmd, want[i]) {
+			t.Errorf("deployment %d mismatch: have %q, want %q", i, cmd, want[i])
+		}
+	}
+	w := newSpecWizard(t, dir, server)
+	if err := w.loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if w.conf.Spec == nil || w.conf.Genesis == nil || len(w.conf.Spec.Bootnodes) != 1 {
+		t.Fatalf("applied spec not recorded: %+v", w.conf.Spec)
+	}
+	// Drop the bootnode, which the server reports running
+	next, err := loadSpec(writeSpec(t, dir, "next.yaml", testSpecYAML[:strings.Index(testSpecYAML, "bootnodes:")]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.running = map[string]bool{"testboot_bootnode_1": true}
+	server.runs = nil
+
+	plan, err := w.planSpec(next)
+	if err != nil {
+		t.Fatalf("failed to plan spec: %v", err)
+	}
+	if have, want := actions(plan), "bootnode boot:remove,ethstats:create"; have != want {
+		t.Fatalf("plan mismatch: have %s, want %s", have, want)
+	}
+	if err := plan.steps[0].apply(); err != nil {
+		t.Fatalf("failed to remove bootnode: %v", err)
+	}
+	if have := server.runs[len(server.runs)-1]; have != "docker rm -f testboot_bootnode_1" {
+		t.Errorf("removal mismatch: have %q", have)
+	}
+}
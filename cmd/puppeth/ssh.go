@@ -34,13 +34,33 @@ import (
 )
 
 // sshClient is a small wrapper around Go's SSH client with a few utility methods
-// implemented on top.
+// implemented on top. The commands are run by an executor, which is either the
+// SSH connection or the local machine.
 type sshClient struct {
 	server  string // Server name or IP without port number
 	address string // IP address of the remote server
 	pubkey  []byte // RSA public key to authenticate the server
-	client  *ssh.Client
 	logger  log.Logger
+
+	executor // Runs the commands and uploads on the server
+}
+
+// executor runs commands and uploads files on a server puppeth administers.
+type executor interface {
+	// Run executes a command and returns the combined output along with any
+	// error status.
+	Run(cmd string) ([]byte, error)
+
+	// Stream executes a command and streams all outputs into the local stdout
+	// and stderr streams.
+	Stream(cmd string) error
+
+	// Upload copies the set of files to the working directory of the server,
+	// creating any non-existing folder in the mean time.
+	Upload(files map[string][]byte) ([]byte, error)
+
+	// Close releases the resources of the executor.
+	Close() error
 }
 
 // dial establishes an SSH connection to a remote node using the current user and
@@ -144,11 +164,11 @@ func dial(server string, pubkey []byte) (*sshClient, error) {
 	}
 	// Connection established, return our utility wrapper
 	c := &sshClient{
-		server:  label,
-		address: addr[0],
-		pubkey:  pubkey,
-		client:  client,
-		logger:  logger,
+		server:   label,
+		address:  addr[0],
+		pubkey:   pubkey,
+		logger:   logger,
+		executor: &sshExecutor{client: client, logger: logger},
 	}
 	if err := c.init(); err != nil {
 		client.Close()
@@ -177,14 +197,20 @@ func (client *sshClient) init() error {
 	return nil
 }
 
+// sshExecutor runs the commands on a remote server via SSH.
+type sshExecutor struct {
+	client *ssh.Client
+	logger log.Logger
+}
+
 // Close terminates the connection to an SSH server.
-func (client *sshClient) Close() error {
+func (client *sshExecutor) Close() error {
 	return client.client.Close()
 }
 
 // Run executes a command on the remote server and returns the combined output
 // along with any error status.
-func (client *sshClient) Run(cmd string) ([]byte, error) {
+func (client *sshExecutor) Run(cmd string) ([]byte, error) {
 	// Establish a single command session
 	session, err := client.client.NewSession()
 	if err != nil {
@@ -199,7 +225,7 @@ func (client *sshClient) Run(cmd string) ([]byte, error) {
 
 // Stream executes a command on the remote server and streams all outputs into
 // the local stdout and stderr streams.
-func (client *sshClient) Stream(cmd string) error {
+func (client *sshExecutor) Stream(cmd string) error {
 	// Establish a single command session
 	session, err := client.client.NewSession()
 	if err != nil {
@@ -217,7 +243,7 @@ func (client *sshClient) Stream(cmd string) error {
 
 // Upload copied the set of files to a remote server via SCP, creating any non-
 // existing folder in te mean time.
-func (client *sshClient) Upload(files map[string][]byte) ([]byte, error) {
+func (client *sshExecutor) Upload(files map[string][]byte) ([]byte, error) {
 	// Establish a single command session
 	session, err := client.client.NewSession()
 	if err != nil {
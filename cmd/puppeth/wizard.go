@@ -38,13 +38,17 @@ import (
 // config contains all the configurations needed by puppeth that should be saved
 // between sessions.
 type config struct {
-	path      string        // File containing the configuration values
-	genesis   *core.Genesis // Genesis block to cache for node deploys
-	bootFull  []string      // Bootnodes to always connect to by full nodes
-	bootLight []string      // Bootnodes to always connect to by light nodes
-	stats     string        // Ethstats settings to cache for node deploys
+	path      string   // File containing the configuration values
+	bootFull  []string // Bootnodes to always connect to by full nodes
+	bootLight []string // Bootnodes to always connect to by light nodes
+	stats     string   // Ethstats settings to cache for node deploys
 
+	Genesis *core.Genesis     `json:"genesis,omitempty"` // Genesis block to cache for node deploys
 	Servers map[string][]byte `json:"servers,omitempty"`
+	Local   *localNetwork     `json:"local,omitempty"` // Network started on the local docker daemon
+	Spec    *networkSpec      `json:"spec,omitempty"`  // Network spec applied last
+
+	LocalDocker bool `json:"localDocker,omitempty"` // Whether localServer is the local docker daemon, not dialed via SSH
 }
 
 // servers retrieves an alphabetically sorted list of servers.
@@ -68,6 +72,24 @@ func (c config) flush() {
 	}
 }
 
+// loadConfig loads the configurations of previous runs of the wizard, if any,
+// without dialing any of the servers.
+func (w *wizard) loadConfig() error {
+	w.conf.path = configPath(w.network)
+
+	blob, err := ioutil.ReadFile(w.conf.path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(blob, &w.conf); err != nil {
+			return fmt.Errorf("configuration %s corrupted: %v", w.conf.path, err)
+		}
+	}
+	return nil
+}
+
 type wizard struct {
 	network string // Network name to manage
 	conf    config // Configurations from previous runs
@@ -76,6 +98,8 @@ type wizard struct {
 	services map[string][]string   // Ethereum services known to be running on servers
 
 	in *bufio.Reader // Wrapper around stdin to allow reading user input
+
+	dialHook func(server string) (*sshClient, error) // Hook for testing, dialing the servers of specs
 }
 
 // read reads a single line from stdin, trimming if from spaces.
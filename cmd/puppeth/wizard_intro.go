@@ -41,6 +41,11 @@ func makeWizard(network string) *wizard {
 	}
 }
 
+// configPath returns the file holding the configurations of a network.
+func configPath(network string) string {
+	return filepath.Join(os.Getenv("HOME"), ".puppeth", network)
+}
+
 // run displays some useful infos to the user, starting on the journey of
 // setting up a new or managing an existing Ethereum private network.
 func (w *wizard) run() {
@@ -72,7 +77,7 @@ func (w *wizard) run() {
 	log.Info("Administering Ethereum network", "name", w.network)
 
 	// Load initial configurations and connect to all live servers
-	w.conf.path = filepath.Join(os.Getenv("HOME"), ".puppeth", w.network)
+	w.conf.path = configPath(w.network)
 
 	blob, err := ioutil.ReadFile(w.conf.path)
 	if err != nil {
@@ -80,9 +85,9 @@ func (w *wizard) run() {
 	} else if err := json.Unmarshal(blob, &w.conf); err != nil {
 		log.Crit("Previous configuration corrupted", "path", w.conf.path, "err", err)
 	} else {
-		for server, pubkey := range w.conf.Servers {
+		for server := range w.conf.Servers {
 			log.Info("Dialing previously configured server", "server", server)
-			client, err := dial(server, pubkey)
+			client, err := w.dial(server)
 			if err != nil {
 				log.Error("Previous server unreachable", "server", server, "err", err)
 			}
@@ -95,7 +100,7 @@ func (w *wizard) run() {
 		fmt.Println()
 		fmt.Println("What would you like to do? (default = stats)")
 		fmt.Println(" 1. Show network stats")
-		if w.conf.genesis == nil {
+		if w.conf.Genesis == nil {
 			fmt.Println(" 2. Configure new genesis")
 		} else {
 			fmt.Println(" 2. Save existing genesis")
@@ -119,13 +124,13 @@ func (w *wizard) run() {
 
 		case choice == "2":
 			// If we don't have a genesis, make one
-			if w.conf.genesis == nil {
+			if w.conf.Genesis == nil {
 				w.makeGenesis()
 			} else {
 				// Otherwise just save whatever we currently have
 				fmt.Println()
 				fmt.Printf("Which file to save the genesis into? (default = %s.json)\n", w.network)
-				out, _ := json.MarshalIndent(w.conf.genesis, "", "  ")
+				out, _ := json.MarshalIndent(w.conf.Genesis, "", "  ")
 				if err := ioutil.WriteFile(w.readDefaultString(fmt.Sprintf("%s.json", w.network)), out, 0644); err != nil {
 					log.Error("Failed to save genesis file", "err", err)
 				}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kowala-tech/kUSD/accounts"
+	"github.com/kowala-tech/kUSD/accounts/keystore"
+	"github.com/kowala-tech/kUSD/common"
+	sysgenesis "github.com/kowala-tech/kUSD/contracts/network/genesis"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	localStatsPort     = 3000  // Port of the ethstats site
+	localDashboardPort = 8000  // Port of the dashboard site
+	localFaucetPort    = 8080  // Port of the faucet site
+	localNodePort      = 22334 // devp2p port of the bootnode, the other nodes use the following ones
+)
+
+// localNetwork holds the accounts of a network started on the local docker
+// daemon by the up command, so it can be started again and torn down. Their keys
+// are kept encrypted in a keystore next to the configs, never in the configs.
+type localNetwork struct {
+	Validators []common.Address `json:"validators"`
+	Faucet     common.Address   `json:"faucet"`
+}
+
+// localService is a component of a local network.
+type localService struct {
+	label   string // Name of the component in reports
+	network string // Network name the component is deployed under
+	service string // Service name of the component container
+	check   func() (fmt.Stringer, error)
+}
+
+// localKeystore opens the keystore holding the keys of the local network.
+func (w *wizard) localKeystore() *keystore.KeyStore {
+	return keystore.NewKeyStore(w.conf.path+"-keys", keystore.LightScryptN, keystore.LightScryptP)
+}
+
+// localKey returns the encrypted key of a local network account, checking that
+// the password unlocks it.
+func localKey(ks *keystore.KeyStore, addr common.Address, password string) (string, error) {
+	account, err := ks.Find(accounts.Account{Address: addr})
+	if err != nil {
+		return "", fmt.Errorf("key of %x: %v", addr, err)
+	}
+	keyJSON, err := ioutil.ReadFile(account.URL.Path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := keystore.DecryptKey(keyJSON, password); err != nil {
+		return "", fmt.Errorf("can't unlock key of %x: %v", addr, err)
+	}
+	return string(keyJSON), nil
+}
+
+// readPasswordFile reads the password protecting the keys of the local network
+// from the first line of a file.
+func readPasswordFile(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("no password file for the keys given, set it via --password")
+	}
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("can't read password file: %v", err)
+	}
+	return strings.TrimRight(strings.SplitN(string(blob), "\n", 2)[0], "\r"), nil
+}
+
+// randomSecret returns a random hex string to use as password.
+func randomSecret() string {
+	secret := make([]byte, 16)
+	crand.Read(secret)
+	return hex.EncodeToString(secret)
+}
+
+// loadLocal loads the configurations of previous runs and dials the local docker
+// daemon.
+func (w *wizard) loadLocal() (*sshClient, error) {
+	if err := w.loadConfig(); err != nil {
+		return nil, err
+	}
+	return dialLocal()
+}
+
+// makeLocalNetwork generates the accounts of a local network with the given
+// number of validators, along with its genesis block. The keys are stored in the
+// keystore, encrypted with the given password. All validators are registered at
+// genesis. The network contracts are owned by the default owner, as nodes only
+// find them at the addresses derived from it.
+func (w *wizard) makeLocalNetwork(validators int, password string) error {
+	var (
+		ks     = w.localKeystore()
+		local  = new(localNetwork)
+		voters []sysgenesis.Validator
+		funds  []common.Address
+	)
+	for i := 0; i < validators; i++ {
+		account, err := ks.NewAccount(password)
+		if err != nil {
+			return err
+		}
+		local.Validators = append(local.Validators, account.Address)
+		voters = append(voters, sysgenesis.Validator{Address: account.Address, Deposit: new(big.Int).SetUint64(defaultDeposit)})
+		funds = append(funds, account.Address)
+	}
+	faucet, err := ks.NewAccount(password)
+	if err != nil {
+		return err
+	}
+	local.Faucet = faucet.Address
+	funds = append(funds, faucet.Address)
+
+	genesis, err := makeTendermintGenesis(big.NewInt(int64(rand.Intn(65536))), sysgenesis.DefaultOwner, voters, funds)
+	if err != nil {
+		return err
+	}
+	w.conf.Genesis, w.conf.Local = genesis, local
+	return nil
+}
+
+// localServices lists the components of the local network, in deployment order.
+func (w *wizard) localServices(client *sshClient) []localService {
+	services := []localService{
+		{label: "ethstats", network: w.network, service: "ethstats", check: func() (fmt.Stringer, error) {
+			return checkEthstats(client, w.network)
+		}},
+		{label: "bootnode", network: w.network, service: "bootnode", check: func() (fmt.Stringer, error) {
+			return checkNode(client, w.network, true)
+		}},
+	}
+	for i := range w.conf.Local.Validators {
+		network := w.validatorNetwork(i)
+		services = append(services, localService{
+			label: fmt.Sprintf("validator%d", i+1), network: network, service: "validator", check: func() (fmt.Stringer, error) {
+				return checkNode(client, network, false)
+			},
+		})
+	}
+	return append(services,
+		localService{label: "faucet", network: w.network, service: "faucet", check: func() (fmt.Stringer, error) {
+			return checkFaucet(client, w.network)
+		}},
+		localService{label: "dashboard", network: w.network, service: "dashboard", check: func() (fmt.Stringer, error) {
+			return checkDashboard(client, w.network)
+		}},
+	)
+}
+
+// validatorNetwork returns the network name the i-th local validator is deployed
+// under, as docker-compose runs a single container of a service per network.
+func (w *wizard) validatorNetwork(i int) string {
+	return fmt.Sprintf("%s%d", w.network, i+1)
+}
+
+// localDatadir returns the directory holding the data of a local service.
+func (w *wizard) localDatadir(service string) string {
+	return filepath.Join(w.conf.path+"-data", service)
+}
+
+// upLocal starts the network on the local docker daemon: ethstats, a bootnode,
+// the validators, a faucet and a dashboard. The accounts and genesis block of a
+// new network are generated and saved, an existing one is started again. The
+// keys of the accounts are protected by the password in the given file.
+func (w *wizard) upLocal(validators int, passwordFile string) error {
+	password, err := readPasswordFile(passwordFile)
+	if err != nil {
+		return err
+	}
+	client, err := w.loadLocal()
+	if err != nil {
+		return err
+	}
+	switch {
+	case w.conf.Genesis == nil:
+		if validators < 1 {
+			return errors.New("a network needs at least one validator")
+		}
+		if err := w.makeLocalNetwork(validators, password); err != nil {
+			return err
+		}
+	case w.conf.Local == nil:
+		return fmt.Errorf("network %s was configured by the wizard, keys of its validators unknown", w.network)
+	case validators != len(w.conf.Local.Validators):
+		log.Warn("Keeping validators of existing network", "validators", len(w.conf.Local.Validators))
+	}
+	var (
+		ks         = w.localKeystore()
+		local      = w.conf.Local
+		keys       = make([]string, len(local.Validators))
+		genesis, _ = json.MarshalIndent(w.conf.Genesis, "", "  ")
+		network    = w.conf.Genesis.Config.ChainID.Int64()
+	)
+	for i, addr := range local.Validators {
+		if keys[i], err = localKey(ks, addr, password); err != nil {
+			return err
+		}
+	}
+	faucetKey, err := localKey(ks, local.Faucet, password)
+	if err != nil {
+		return err
+	}
+	w.conf.Servers[localServer], w.conf.LocalDocker = nil, true
+	w.conf.flush()
+
+	// Start the stats page first, all other services report to it. The secret
+	// only lives in the containers, every start deploys them all anew.
+	secret := randomSecret()
+	if out, err := deployStats(client, w.network, localStatsPort, secret, "", []string{client.address}, nil); err != nil {
+		return deployFailure("ethstats", out, err)
+	}
+	w.conf.stats = fmt.Sprintf("%s@%s:%d", secret, client.server, localStatsPort)
+
+	// Start the bootnode and wait for its enode URLs, the other nodes need them
+	boot := &nodeInfos{
+		genesis:    genesis,
+		network:    network,
+		datadir:    w.localDatadir("bootnode"),
+		stats:      "bootnode:" + w.conf.stats,
+		portFull:   localNodePort,
+		peersTotal: 50,
+		peersLight: 25,
+	}
+	if out, err := deployNode(client, w.network, nil, nil, boot); err != nil {
+		return deployFailure("bootnode", out, err)
+	}
+	if boot, err = waitNode(client, w.network, true); err != nil {
+		return fmt.Errorf("bootnode not responding: %v", err)
+	}
+	w.conf.bootFull, w.conf.bootLight = []string{boot.enodeFull}, nil
+	if boot.enodeLight != "" {
+		w.conf.bootLight = []string{boot.enodeLight}
+	}
+
+	// Start the validators, each node taking two ports for full and light peers
+	for i, addr := range local.Validators {
+		infos := &nodeInfos{
+			genesis:    genesis,
+			network:    network,
+			datadir:    w.localDatadir(fmt.Sprintf("validator%d", i+1)),
+			stats:      fmt.Sprintf("validator%d:%s", i+1, w.conf.stats),
+			portFull:   localNodePort + 2*(i+1),
+			peersTotal: 50,
+			validator:  addr.Hex(),
+			keyJSON:    keys[i],
+			keyPass:    password,
+			gasTarget:  4.7,
+			gasPrice:   18,
+		}
+		if out, err := deployNode(client, w.validatorNetwork(i), w.conf.bootFull, w.conf.bootLight, infos); err != nil {
+			return deployFailure(fmt.Sprintf("validator%d", i+1), out, err)
+		}
+	}
+	// Start the faucet, granting funds without authentication
+	faucet := &faucetInfos{
+		node: &nodeInfos{
+			genesis:    genesis,
+			network:    network,
+			datadir:    w.localDatadir("faucet"),
+			stats:      "faucet:" + w.conf.stats,
+			portFull:   localNodePort + 2*(len(local.Validators)+1),
+			peersTotal: 25,
+			keyJSON:    faucetKey,
+			keyPass:    password,
+		},
+		port:    localFaucetPort,
+		amount:  1,
+		minutes: 1440,
+		tiers:   3,
+		noauth:  true,
+	}
+	if out, err := deployFaucet(client, w.network, w.conf.bootLight, faucet); err != nil {
+		return deployFailure("faucet", out, err)
+	}
+	// Start the dashboard listing all of the above
+	pages := map[string]string{
+		"ethstats": fmt.Sprintf("%s:%d", client.server, localStatsPort),
+		"faucet":   fmt.Sprintf("%s:%d", client.server, localFaucetPort),
+	}
+	if out, err := deployDashboard(client, w.network, localDashboardPort, "", pages, &w.conf, true); err != nil {
+		return deployFailure("dashboard", out, err)
+	}
+	log.Info("Waiting for services to finish booting")
+	time.Sleep(3 * time.Second)
+
+	return w.statusLocal()
+}
+
+// statusLocal runs the health-checks of all the components of the local network,
+// failing if any of them isn't healthy.
+func (w *wizard) statusLocal() error {
+	client, err := w.loadLocal()
+	if err != nil {
+		return err
+	}
+	if w.conf.Local == nil {
+		return fmt.Errorf("network %s was not started by the up command", w.network)
+	}
+	stats := tablewriter.NewWriter(os.Stdout)
+	stats.SetHeader([]string{"Service", "Status", "Details"})
+	stats.SetColWidth(100)
+
+	failed := 0
+	for _, service := range w.localServices(client) {
+		infos, err := service.check()
+		if err != nil {
+			stats.Append([]string{service.label, err.Error(), ""})
+			failed++
+			continue
+		}
+		stats.Append([]string{service.label, "online", infos.String()})
+	}
+	stats.Render()
+
+	if failed > 0 {
+		return fmt.Errorf("%d services not healthy", failed)
+	}
+	return nil
+}
+
+// downLocal tears down all components of the local network. Purging removes the
+// built images and the chain data too, the accounts and genesis block are kept
+// to start the network again.
+func (w *wizard) downLocal(purge bool) error {
+	client, err := w.loadLocal()
+	if err != nil {
+		return err
+	}
+	if w.conf.Local == nil {
+		return fmt.Errorf("network %s was not started by the up command", w.network)
+	}
+	services := w.localServices(client)
+	for i := len(services) - 1; i >= 0; i-- {
+		service := services[i]
+		if _, err := inspectContainer(client, fmt.Sprintf("%s_%s_1", service.network, service.service)); err == ErrServiceUnknown {
+			continue
+		}
+		if out, err := tearDown(client, service.network, service.service, purge); err != nil {
+			log.Error("Failed to tear down component", "service", service.label, "err", err)
+			if len(out) > 0 {
+				fmt.Printf("%s\n", out)
+			}
+			continue
+		}
+		log.Info("Torn down component", "service", service.label)
+	}
+	if purge {
+		if err := os.RemoveAll(w.conf.path + "-data"); err != nil {
+			return fmt.Errorf("failed to remove chain data, files written by containers may need root: %v", err)
+		}
+	}
+	return nil
+}
+
+// waitNode runs the health-check of a node until it responds, giving up after a
+// minute.
+func waitNode(client *sshClient, network string, boot bool) (*nodeInfos, error) {
+	var err error
+	for start := time.Now(); time.Since(start) < time.Minute; time.Sleep(time.Second) {
+		var infos *nodeInfos
+		if infos, err = checkNode(client, network, boot); err == nil {
+			return infos, nil
+		}
+	}
+	return nil, err
+}
+
+// deployFailure reports the output of a failed deployment.
+func deployFailure(service string, out []byte, err error) error {
+	if len(out) > 0 {
+		fmt.Printf("%s\n", out)
+	}
+	return fmt.Errorf("failed to deploy %s: %v", service, err)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/log"
+)
+
+// Tests that the keys of a local network are kept in the keystore, encrypted
+// with the given password, and never in the configs.
+func TestMakeLocalNetwork(t *testing.T) {
+	dir, err := ioutil.TempDir("", "puppeth-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := makeWizard("test")
+	w.conf.path = filepath.Join(dir, "test")
+
+	password := "correct horse battery staple"
+	if err := w.makeLocalNetwork(2, password); err != nil {
+		t.Fatalf("failed to make network: %v", err)
+	}
+	w.conf.flush()
+
+	local := w.conf.Local
+	if len(local.Validators) != 2 {
+		t.Fatalf("validator count mismatch: have %d, want 2", len(local.Validators))
+	}
+	// The configs only know the addresses
+	blob, err := ioutil.ReadFile(w.conf.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{password, "ciphertext", "crypto"} {
+		if bytes.Contains(blob, []byte(secret)) {
+			t.Errorf("configs contain %q", secret)
+		}
+	}
+	// The keys unlock with the password only
+	ks := w.localKeystore()
+	for _, addr := range append(local.Validators, local.Faucet) {
+		if _, err := localKey(ks, addr, password); err != nil {
+			t.Errorf("key of %x: %v", addr, err)
+		}
+		if _, err := localKey(ks, addr, "wrong"); err == nil {
+			t.Errorf("key of %x unlocked with wrong password", addr)
+		}
+		if _, ok := w.conf.Genesis.Alloc[addr]; !ok {
+			t.Errorf("account %x not funded at genesis", addr)
+		}
+	}
+}
+
+func TestReadPasswordFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "puppeth-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]string{
+		"foo":              "foo",
+		"foo\n":            "foo",
+		"foo bar\r\nbaz\n": "foo bar",
+	}
+	for content, want := range tests {
+		path := filepath.Join(dir, "password")
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if have, err := readPasswordFile(path); err != nil || have != want {
+			t.Errorf("%q: password mismatch: have %q, %v, want %q", content, have, err, want)
+		}
+	}
+	if _, err := readPasswordFile(""); err == nil {
+		t.Error("missing password file accepted")
+	}
+	if _, err := readPasswordFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("nonexistent password file accepted")
+	}
+}
+
+func TestLocalExecutor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "puppeth-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var e executor = &localExecutor{dir: dir, logger: log.New()}
+	defer e.Close()
+
+	if _, err := e.Upload(map[string][]byte{"a/b.txt": []byte("hello")}); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	out, err := e.Run("cat a/b.txt")
+	if err != nil || string(out) != "hello" {
+		t.Errorf("uploaded file mismatch: have %q, %v", out, err)
+	}
+	if _, err := e.Run("exit 3"); err == nil {
+		t.Error("failing command succeeded")
+	}
+	if err := e.Stream("true"); err != nil {
+		t.Errorf("stream failed: %v", err)
+	}
+}
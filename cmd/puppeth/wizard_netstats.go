@@ -41,14 +41,14 @@ func (w *wizard) networkStats(tips bool) {
 	stats.SetHeader([]string{"Server", "IP", "Status", "Service", "Details"})
 	stats.SetColWidth(100)
 
-	for server, pubkey := range w.conf.Servers {
+	for server := range w.conf.Servers {
 		client := w.servers[server]
 		logger := log.New("server", server)
 		logger.Info("Starting remote server health-check")
 
 		// If the server is not connected, try to connect again
 		if client == nil {
-			conn, err := dial(server, pubkey)
+			conn, err := w.dial(server)
 			if err != nil {
 				logger.Error("Failed to establish remote connection", "err", err)
 				stats.Append([]string{server, "", err.Error(), "", ""})
@@ -89,13 +89,13 @@ func (w *wizard) networkStats(tips bool) {
 				protips.bootLight = append(protips.bootLight, infos.enodeLight)
 			}
 		}
-		logger.Debug("Checking for sealnode availability")
+		logger.Debug("Checking for validator availability")
 		if infos, err := checkNode(client, w.network, false); err != nil {
 			if err != ErrServiceUnknown {
-				services["sealnode"] = err.Error()
+				services["validator"] = err.Error()
 			}
 		} else {
-			services["sealnode"] = infos.String()
+			services["validator"] = infos.String()
 			protips.genesis = string(infos.genesis)
 		}
 		logger.Debug("Checking for faucet availability")
@@ -129,12 +129,12 @@ func (w *wizard) networkStats(tips bool) {
 		}
 	}
 	// If a genesis block was found, load it into our configs
-	if protips.genesis != "" && w.conf.genesis == nil {
+	if protips.genesis != "" && w.conf.Genesis == nil {
 		genesis := new(core.Genesis)
 		if err := json.Unmarshal([]byte(protips.genesis), genesis); err != nil {
 			log.Error("Failed to parse remote genesis", "err", err)
 		} else {
-			w.conf.genesis = genesis
+			w.conf.Genesis = genesis
 			protips.network = genesis.Config.ChainID.Int64()
 		}
 	}
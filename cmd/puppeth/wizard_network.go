@@ -50,6 +50,9 @@ func (w *wizard) manageServers() {
 			client.Close()
 		}
 		delete(w.conf.Servers, server)
+		if server == localServer {
+			w.conf.LocalDocker = false
+		}
 		w.conf.flush()
 
 		log.Info("Disconnected existing server", "server", server)
@@ -68,16 +71,36 @@ func (w *wizard) manageServers() {
 //
 // If connection succeeds, the server is added to the wizards configs!
 func (w *wizard) makeServer() string {
-	fmt.Println()
-	fmt.Println("Please enter remote server's address:")
+	var (
+		input  string
+		client *sshClient
+		err    error
+	)
+	local := false
+	if !w.conf.LocalDocker {
+		fmt.Println()
+		fmt.Println("Deploy to the docker daemon of this machine instead of a remote server (y/n)? (default = no)")
+		local = w.readDefaultString("n") == "y"
+	}
+	if local {
+		// Local deployments run the commands directly, dial to ensure docker is present
+		input = localServer
+		if client, err = dialLocal(); err != nil {
+			log.Error("Local machine not ready for puppeth", "err", err)
+			return ""
+		}
+		w.conf.LocalDocker = true
+	} else {
+		fmt.Println()
+		fmt.Println("Please enter remote server's address:")
 
-	// Read and dial the server to ensure docker is present
-	input := w.readString()
+		// Read and dial the server to ensure docker is present
+		input = w.readString()
 
-	client, err := dial(input, nil)
-	if err != nil {
-		log.Error("Server not ready for puppeth", "err", err)
-		return ""
+		if client, err = dial(input, nil); err != nil {
+			log.Error("Server not ready for puppeth", "err", err)
+			return ""
+		}
 	}
 	// All checks passed, start tracking the server
 	w.servers[input] = client
@@ -87,6 +110,15 @@ func (w *wizard) makeServer() string {
 	return input
 }
 
+// dial connects to a server of the configs, running the commands directly if it
+// is the local docker daemon.
+func (w *wizard) dial(server string) (*sshClient, error) {
+	if server == localServer && w.conf.LocalDocker {
+		return dialLocal()
+	}
+	return dial(server, w.conf.Servers[server])
+}
+
 // selectServer lists the user all the currnetly known servers to choose from,
 // also granting the option to add a new one.
 func (w *wizard) selectServer() string {
@@ -173,7 +205,7 @@ func (w *wizard) deployComponent() {
 	fmt.Println("What would you like to deploy? (recommended order)")
 	fmt.Println(" 1. Ethstats  - Network monitoring tool")
 	fmt.Println(" 2. Bootnode  - Entry point of the network")
-	fmt.Println(" 3. Sealer    - Full node minting new blocks")
+	fmt.Println(" 3. Validator - Full node validating new blocks")
 	fmt.Println(" 4. Wallet    - Browser wallet for quick sends (todo)")
 	fmt.Println(" 5. Faucet    - Crypto faucet to give away funds")
 	fmt.Println(" 6. Dashboard - Website listing above web-services")
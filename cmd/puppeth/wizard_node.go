@@ -21,14 +21,14 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/accounts/keystore"
 	"github.com/kowala-tech/kUSD/log"
 )
 
 // deployNode creates a new node configuration based on some user input.
 func (w *wizard) deployNode(boot bool) {
 	// Do some sanity check before the user wastes time on input
-	if w.conf.genesis == nil {
+	if w.conf.Genesis == nil {
 		log.Error("No genesis block configured")
 		return
 	}
@@ -49,11 +49,11 @@ func (w *wizard) deployNode(boot bool) {
 		if boot {
 			infos = &nodeInfos{portFull: 22334, peersTotal: 512, peersLight: 256}
 		} else {
-			infos = &nodeInfos{portFull: 22334, peersTotal: 50, peersLight: 0, gasTarget: 4.7, gasPrice: 18}
+			infos = &nodeInfos{portFull: 22334, peersTotal: 50, peersLight: 0, deposit: defaultDeposit, gasTarget: 4.7, gasPrice: 18}
 		}
 	}
-	infos.genesis, _ = json.MarshalIndent(w.conf.genesis, "", "  ")
-	infos.network = w.conf.genesis.Config.ChainID.Int64()
+	infos.genesis, _ = json.MarshalIndent(w.conf.Genesis, "", "  ")
+	infos.network = w.conf.Genesis.Config.ChainID.Int64()
 
 	// Figure out where the user wants to store the persistent data
 	fmt.Println()
@@ -90,35 +90,60 @@ func (w *wizard) deployNode(boot bool) {
 	}
 	// If the node is a validator, load up needed credentials
 	if !boot {
-		if w.conf.genesis.Config.Tendermint != nil {
-			// Tendermint based validators only need a coinbase to validate
-			fmt.Println()
-			if infos.coinbase == "" {
-				fmt.Printf("What address should the validator user?\n")
-				for {
-					if address := w.readAddress(); address != nil {
-						infos.coinbase = address.Hex()
-						break
-					}
-				}
+		if infos.keyJSON != "" {
+			if key, err := keystore.DecryptKey([]byte(infos.keyJSON), infos.keyPass); err != nil {
+				infos.keyJSON, infos.keyPass = "", ""
 			} else {
-				fmt.Printf("What address should the miner user? (default = %s)\n", infos.coinbase)
-				infos.coinbase = w.readDefaultAddress(common.HexToAddress(infos.coinbase)).Hex()
+				fmt.Println()
+				fmt.Printf("Reuse previous (%s) validator account (y/n)? (default = yes)\n", key.Address.Hex())
+				if w.readDefaultString("y") != "y" {
+					infos.keyJSON, infos.keyPass = "", ""
+				}
 			}
 		}
+		if infos.keyJSON == "" {
+			fmt.Println()
+			fmt.Println("Please paste the validator's key JSON:")
+			infos.keyJSON = w.readJSON()
 
-		// Establish the gas dynamics to be enforced by the signer
+			fmt.Println()
+			fmt.Println("What's the unlock password for the account? (won't be echoed)")
+			infos.keyPass = w.readPassword()
+		}
+		key, err := keystore.DecryptKey([]byte(infos.keyJSON), infos.keyPass)
+		if err != nil {
+			log.Error("Failed to decrypt key with given passphrase")
+			return
+		}
+		infos.validator = key.Address.Hex()
+
+		// Genesis voters are registered already, all others deposit once synced
+		genesisVoter, err := isGenesisVoter(w.conf.Genesis, key.Address)
+		if err != nil {
+			log.Error("Failed to look up genesis validators", "err", err)
+			return
+		}
+		if genesisVoter {
+			log.Info("Validator is registered in the genesis block, no deposit needed", "address", infos.validator)
+		} else {
+			fmt.Println()
+			fmt.Printf("How much should the validator deposit at stake (wei)? (default = %d)\n", infos.deposit)
+			infos.deposit = uint64(w.readDefaultInt(int(infos.deposit)))
+
+			log.Info("Validator will deposit once synced, make sure the account is funded", "address", infos.validator, "deposit", infos.deposit)
+		}
+		// Establish the gas dynamics to be enforced by the validator
 		fmt.Println()
 		fmt.Printf("What gas limit should empty blocks target (MGas)? (default = %0.3f)\n", infos.gasTarget)
 		infos.gasTarget = w.readDefaultFloat(infos.gasTarget)
 
 		fmt.Println()
-		fmt.Printf("What gas price should the signer require (GWei)? (default = %0.3f)\n", infos.gasPrice)
+		fmt.Printf("What gas price should the validator require (GWei)? (default = %0.3f)\n", infos.gasPrice)
 		infos.gasPrice = w.readDefaultFloat(infos.gasPrice)
 	}
 	// Try to deploy the full node on the host
 	if out, err := deployNode(client, w.network, w.conf.bootFull, w.conf.bootLight, infos); err != nil {
-		log.Error("Failed to deploy Ethereum node container", "err", err)
+		log.Error("Failed to deploy Kowala node container", "err", err)
 		if len(out) > 0 {
 			fmt.Printf("%s\n", out)
 		}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/olekukonko/tablewriter"
+)
+
+// specStep is a change bringing a component of the network in line with the
+// spec.
+type specStep struct {
+	label  string // Name of the component in reports
+	server string // Label of the server hosting the component
+	action string // One of create, update, remove or keep
+	reason string // Differences found by the health-check of the component
+	apply  func() error
+}
+
+// specDiff collects the differences between a deployed component and its spec.
+type specDiff []string
+
+// check records a field if the deployed value differs from the specified one.
+func (diff *specDiff) check(field string, have, want interface{}) {
+	if have != want {
+		*diff = append(*diff, fmt.Sprintf("%s %v => %v", field, have, want))
+	}
+}
+
+// checkSecret records a field if the deployed value differs from the specified
+// one, without reporting the values.
+func (diff *specDiff) checkSecret(field string, have, want string) {
+	if have != want {
+		*diff = append(*diff, field)
+	}
+}
+
+// checkGenesis records the genesis block if the deployed one differs from the
+// specified one.
+func (diff *specDiff) checkGenesis(have []byte, want common.Hash) {
+	genesis := new(core.Genesis)
+	if err := json.Unmarshal(have, genesis); err != nil {
+		*diff = append(*diff, "genesis corrupted")
+		return
+	}
+	if block, _ := genesis.ToBlock(); block.Hash() != want {
+		*diff = append(*diff, "genesis")
+	}
+}
+
+// specPlan holds the steps applying a network spec, in deployment order.
+type specPlan struct {
+	genesis *core.Genesis
+	steps   []*specStep
+}
+
+// changes returns the number of steps changing a component.
+func (plan *specPlan) changes() int {
+	changes := 0
+	for _, step := range plan.steps {
+		if step.action != "keep" {
+			changes++
+		}
+	}
+	return changes
+}
+
+// render prints the steps of the plan in a table.
+func (plan *specPlan) render() {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Service", "Server", "Action", "Details"})
+	table.SetColWidth(100)
+	for _, step := range plan.steps {
+		table.Append([]string{step.label, step.server, step.action, step.reason})
+	}
+	table.Render()
+}
+
+// dialSpec connects to a server of a spec, running the commands directly if it
+// is the local docker daemon.
+func (w *wizard) dialSpec(spec *networkSpec, server string) (*sshClient, error) {
+	if w.dialHook != nil {
+		return w.dialHook(server)
+	}
+	if server == localServer && spec.LocalDocker {
+		return dialLocal()
+	}
+	return dial(server, w.conf.Servers[server])
+}
+
+// planSpec compares the network deployed on the servers of the spec against the
+// spec, returning the steps to bring them in line. Components of the spec applied
+// last that are missing from this one are torn down.
+func (w *wizard) planSpec(spec *networkSpec) (*specPlan, error) {
+	if err := w.loadConfig(); err != nil {
+		return nil, err
+	}
+	genesis, err := spec.Genesis.makeGenesis(spec.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create genesis block: %v", err)
+	}
+	block, _ := genesis.ToBlock()
+	genesisJSON, _ := json.MarshalIndent(genesis, "", "  ")
+
+	// Dial all servers of the spec, remembering their SSH keys. They're only
+	// saved once the spec is applied, planning leaves the configs alone.
+	clients := make(map[string]*sshClient)
+	for label, server := range spec.Servers {
+		client, err := w.dialSpec(spec, server)
+		if err != nil {
+			return nil, fmt.Errorf("server %s unreachable: %v", label, err)
+		}
+		clients[label] = client
+		w.conf.Servers[server] = client.pubkey
+		if server == localServer && spec.LocalDocker {
+			w.conf.LocalDocker = true
+		}
+	}
+
+	plan := &specPlan{genesis: genesis}
+	step := func(comp specComponent, check func() (specDiff, error), deploy func() error) *specStep {
+		step := &specStep{label: comp.label, server: comp.server, apply: deploy}
+		switch diff, err := check(); {
+		case err == ErrServiceUnknown:
+			step.action = "create"
+		case err != nil:
+			step.action, step.reason = "update", err.Error()
+		case len(diff) > 0:
+			step.action, step.reason = "update", strings.Join(diff, ", ")
+		default:
+			step.action = "keep"
+		}
+		plan.steps = append(plan.steps, step)
+		return step
+	}
+	comps := spec.components(w.network)
+
+	// Tear down the components dropped from the spec first, freeing their ports
+	if err := w.planRemovals(plan, spec, comps); err != nil {
+		return nil, err
+	}
+	// Reverse-proxies go first, the web services behind them need them
+	for i, nginx := range spec.Nginx {
+		var (
+			nginx  = nginx
+			client = clients[nginx.Server]
+		)
+		step(comps[i], func() (specDiff, error) {
+			infos, err := checkNginx(client, w.network)
+			if err != nil {
+				return nil, err
+			}
+			var diff specDiff
+			diff.check("port", infos.port, nginx.Port)
+			return diff, nil
+		}, func() error {
+			out, err := deployNginx(client, w.network, nginx.Port)
+			if err != nil {
+				return deployFailure("nginx", out, err)
+			}
+			return nil
+		})
+	}
+	comps = comps[len(spec.Nginx):]
+
+	// Start the stats page next, all nodes report to it. Nodes connected to the
+	// stats page of another configuration have to be updated too.
+	var (
+		stats        string
+		statsChanged bool
+	)
+	if spec.Ethstats != nil {
+		var (
+			ethstats = spec.Ethstats
+			client   = clients[ethstats.Server]
+			host     = ethstats.Vhost
+		)
+		if host == "" {
+			host = client.server
+		}
+		secret, err := readSecret(spec.dir, ethstats.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("ethstats: %v", err)
+		}
+		stats = ethstatsConfig(secret, host, ethstats.Port)
+
+		var trusted []string
+		for _, client := range clients {
+			trusted = append(trusted, client.address)
+		}
+		sort.Strings(trusted)
+
+		step := step(comps[0], func() (specDiff, error) {
+			infos, err := checkEthstats(client, w.network)
+			if err != nil {
+				return nil, err
+			}
+			var diff specDiff
+			diff.check("host", infos.host, host)
+			diff.check("port", infos.port, ethstats.Port)
+			diff.checkSecret("secret", infos.secret, secret)
+			statsChanged = len(diff) > 0
+
+			diff.check("banned", strings.Join(infos.banned, ","), strings.Join(ethstats.Banned, ","))
+			return diff, nil
+		}, func() error {
+			out, err := deployStats(client, w.network, ethstats.Port, secret, ethstats.Vhost, trusted, ethstats.Banned)
+			if err != nil {
+				return deployFailure("ethstats", out, err)
+			}
+			return nil
+		})
+		statsChanged = statsChanged || step.action == "create"
+		comps = comps[1:]
+	}
+	// Nodes other than bootnodes need the enode URLs of the bootnodes, which are
+	// only known once they run
+	var enodes bool
+	bootnodes := func() error {
+		if enodes {
+			return nil
+		}
+		w.conf.bootFull, w.conf.bootLight = nil, nil
+		for i, node := range spec.Bootnodes {
+			infos, err := waitNode(clients[node.Server], w.network+node.Name, true)
+			if err != nil {
+				return fmt.Errorf("bootnode %s not responding: %v", spec.Bootnodes[i].Name, err)
+			}
+			w.conf.bootFull = append(w.conf.bootFull, infos.enodeFull)
+			if infos.enodeLight != "" {
+				w.conf.bootLight = append(w.conf.bootLight, infos.enodeLight)
+			}
+		}
+		enodes = true
+		return nil
+	}
+	nodeStep := func(comp specComponent, node nodeSpec, boot bool) error {
+		var (
+			client = clients[node.Server]
+			infos  = &nodeInfos{
+				genesis:    genesisJSON,
+				network:    genesis.Config.ChainID.Int64(),
+				datadir:    node.Datadir,
+				stats:      node.Name + ":" + stats,
+				portFull:   node.Port,
+				peersTotal: node.Peers,
+				peersLight: node.LightPeers,
+				deposit:    node.Deposit,
+				gasTarget:  node.GasTarget,
+				gasPrice:   node.GasPrice,
+			}
+		)
+		if node.LightPeers > 0 {
+			infos.portLight = node.Port + 1
+		}
+		if !boot {
+			keyJSON, keyPass, address, err := readKey(spec.dir, node.Keyfile, node.Password)
+			if err != nil {
+				return fmt.Errorf("validator %s: %v", node.Name, err)
+			}
+			infos.keyJSON, infos.keyPass, infos.validator = keyJSON, keyPass, address.Hex()
+		}
+		step := step(comp, func() (specDiff, error) {
+			have, err := checkNode(client, comp.network, boot)
+			if err != nil {
+				return nil, err
+			}
+			var diff specDiff
+			diff.checkGenesis(have.genesis, block.Hash())
+			diff.check("port", have.portFull, infos.portFull)
+			diff.check("light port", have.portLight, infos.portLight)
+			diff.check("peers", have.peersTotal, infos.peersTotal)
+			diff.check("lights", have.peersLight, infos.peersLight)
+			diff.check("datadir", have.datadir, infos.datadir)
+			diff.check("ethstats", have.stats, node.Name)
+			diff.check("validator", have.validator, infos.validator)
+			diff.check("deposit", have.deposit, infos.deposit)
+			diff.checkSecret("key", have.keyJSON, infos.keyJSON)
+			diff.checkSecret("password", have.keyPass, infos.keyPass)
+			diff.check("gastarget", have.gasTarget, infos.gasTarget)
+			diff.check("gasprice", have.gasPrice, infos.gasPrice)
+			return diff, nil
+		}, func() error {
+			if !boot {
+				if err := bootnodes(); err != nil {
+					return err
+				}
+			}
+			out, err := deployNode(client, comp.network, w.conf.bootFull, w.conf.bootLight, infos)
+			if err != nil {
+				return deployFailure(comp.label, out, err)
+			}
+			return nil
+		})
+		if step.action == "keep" && statsChanged {
+			step.action, step.reason = "update", "ethstats changed"
+		}
+		return nil
+	}
+	for i, node := range spec.Bootnodes {
+		if err := nodeStep(comps[i], node, true); err != nil {
+			return nil, err
+		}
+	}
+	comps = comps[len(spec.Bootnodes):]
+
+	for i, node := range spec.Validators {
+		if err := nodeStep(comps[i], node, false); err != nil {
+			return nil, err
+		}
+	}
+	comps = comps[len(spec.Validators):]
+
+	// Start the faucet, funding requests through the light client of it
+	if spec.Faucet != nil {
+		var (
+			faucet = spec.Faucet
+			client = clients[faucet.Server]
+			host   = faucet.Vhost
+		)
+		if host == "" {
+			host = client.server
+		}
+		keyJSON, keyPass, _, err := readKey(spec.dir, faucet.Keyfile, faucet.Password)
+		if err != nil {
+			return nil, fmt.Errorf("faucet: %v", err)
+		}
+		githubToken, err := readSecret(spec.dir, faucet.GithubTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("faucet: %v", err)
+		}
+		captchaSecret, err := readSecret(spec.dir, faucet.CaptchaSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("faucet: %v", err)
+		}
+		infos := &faucetInfos{
+			node: &nodeInfos{
+				genesis:  genesisJSON,
+				network:  genesis.Config.ChainID.Int64(),
+				datadir:  faucet.Datadir,
+				stats:    "faucet:" + stats,
+				portFull: faucet.NodePort,
+				keyJSON:  keyJSON,
+				keyPass:  keyPass,
+			},
+			host:          faucet.Vhost,
+			port:          faucet.Port,
+			amount:        faucet.Amount,
+			minutes:       faucet.Minutes,
+			tiers:         faucet.Tiers,
+			githubUser:    faucet.GithubUser,
+			githubToken:   githubToken,
+			captchaToken:  faucet.CaptchaToken,
+			captchaSecret: captchaSecret,
+			noauth:        faucet.NoAuth,
+		}
+		step := step(comps[0], func() (specDiff, error) {
+			have, err := checkFaucet(client, w.network)
+			if err != nil {
+				return nil, err
+			}
+			var diff specDiff
+			diff.checkGenesis(have.node.genesis, block.Hash())
+			diff.check("host", have.host, host)
+			diff.check("port", have.port, infos.port)
+			diff.check("eth port", have.node.portFull, infos.node.portFull)
+			diff.check("datadir", have.node.datadir, infos.node.datadir)
+			diff.check("ethstats", have.node.stats, "faucet")
+			diff.checkSecret("key", have.node.keyJSON, infos.node.keyJSON)
+			diff.checkSecret("password", have.node.keyPass, infos.node.keyPass)
+			diff.check("amount", have.amount, infos.amount)
+			diff.check("minutes", have.minutes, infos.minutes)
+			diff.check("tiers", have.tiers, infos.tiers)
+			diff.check("github", have.githubUser, infos.githubUser)
+			diff.checkSecret("github token", have.githubToken, infos.githubToken)
+			diff.checkSecret("captcha token", have.captchaToken, infos.captchaToken)
+			diff.checkSecret("captcha secret", have.captchaSecret, infos.captchaSecret)
+			diff.check("noauth", have.noauth, infos.noauth)
+			return diff, nil
+		}, func() error {
+			if err := bootnodes(); err != nil {
+				return err
+			}
+			out, err := deployFaucet(client, w.network, w.conf.bootLight, infos)
+			if err != nil {
+				return deployFailure("faucet", out, err)
+			}
+			return nil
+		})
+		if step.action == "keep" && statsChanged {
+			step.action, step.reason = "update", "ethstats changed"
+		}
+		comps = comps[1:]
+	}
+	// Finish with the dashboard, which lists everything above and is updated
+	// whenever any of it changes
+	if spec.Dashboard != nil {
+		var (
+			dashboard = spec.Dashboard
+			client    = clients[dashboard.Server]
+			host      = dashboard.Vhost
+			pages     = make(map[string]string)
+		)
+		if host == "" {
+			host = client.server
+		}
+		page := func(server, vhost string, port int) string {
+			if vhost != "" {
+				return vhost
+			}
+			return fmt.Sprintf("%s:%d", clients[server].server, port)
+		}
+		if spec.Ethstats != nil {
+			pages["ethstats"] = page(spec.Ethstats.Server, spec.Ethstats.Vhost, spec.Ethstats.Port)
+		}
+		if spec.Faucet != nil {
+			pages["faucet"] = page(spec.Faucet.Server, spec.Faucet.Vhost, spec.Faucet.Port)
+		}
+		changes := plan.changes()
+
+		step := step(comps[0], func() (specDiff, error) {
+			infos, err := checkDashboard(client, w.network)
+			if err != nil {
+				return nil, err
+			}
+			var diff specDiff
+			diff.check("host", infos.host, host)
+			diff.check("port", infos.port, dashboard.Port)
+			return diff, nil
+		}, func() error {
+			if err := bootnodes(); err != nil {
+				return err
+			}
+			w.conf.Genesis, w.conf.stats = genesis, stats
+			out, err := deployDashboard(client, w.network, dashboard.Port, dashboard.Vhost, pages, &w.conf, spec.Ethstats != nil)
+			if err != nil {
+				return deployFailure("dashboard", out, err)
+			}
+			return nil
+		})
+		if step.action == "keep" && changes > 0 {
+			step.action, step.reason = "update", "network changed"
+		}
+	}
+	return plan, nil
+}
+
+// planRemovals adds steps tearing down the components of the spec applied last
+// which are not part of the new spec.
+func (w *wizard) planRemovals(plan *specPlan, spec *networkSpec, comps []specComponent) error {
+	if w.conf.Spec == nil {
+		return nil
+	}
+	keep := make(map[string]bool)
+	for _, comp := range comps {
+		keep[spec.Servers[comp.server]+"/"+comp.network+"_"+comp.service] = true
+	}
+	old := w.conf.Spec
+	for _, comp := range old.components(w.network) {
+		server := old.Servers[comp.server]
+		if keep[server+"/"+comp.network+"_"+comp.service] {
+			continue
+		}
+		client, err := w.dialSpec(old, server)
+		if err != nil {
+			log.Warn("Server of dropped component unreachable", "service", comp.label, "server", comp.server, "err", err)
+			continue
+		}
+		if _, err := inspectContainer(client, fmt.Sprintf("%s_%s_1", comp.network, comp.service)); err == ErrServiceUnknown {
+			continue
+		}
+		comp := comp
+		plan.steps = append(plan.steps, &specStep{
+			label:  comp.label,
+			server: comp.server,
+			action: "remove",
+			reason: "dropped from spec",
+			apply: func() error {
+				if out, err := tearDown(client, comp.network, comp.service, false); err != nil {
+					return deployFailure(comp.label, out, err)
+				}
+				return nil
+			},
+		})
+	}
+	return nil
+}
+
+// applySpec deploys the changes needed to bring the network in line with the
+// spec. Components matching the spec already are left alone, so applying the
+// same spec again changes nothing.
+func (w *wizard) applySpec(spec *networkSpec) error {
+	plan, err := w.planSpec(spec)
+	if err != nil {
+		return err
+	}
+	plan.render()
+
+	w.conf.Genesis = plan.genesis
+	w.conf.flush()
+
+	for _, step := range plan.steps {
+		if step.action == "keep" {
+			continue
+		}
+		log.Info("Applying network spec", "service", step.label, "server", step.server, "action", step.action)
+		if err := step.apply(); err != nil {
+			return err
+		}
+	}
+	w.conf.Spec = spec
+	w.conf.flush()
+
+	log.Info("Network in line with spec", "changes", plan.changes())
+	return nil
+}
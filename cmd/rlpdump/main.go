@@ -25,7 +25,9 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/kowala-tech/kUSD/p2p"
 	"github.com/kowala-tech/kUSD/rlp"
 )
 
@@ -33,11 +35,12 @@ var (
 	hexMode = flag.String("hex", "", "dump given hex data")
 	noASCII = flag.Bool("noascii", false, "don't print ASCII strings readably")
 	single  = flag.Bool("single", false, "print only the first element, discard the rest")
+	capture = flag.Bool("capture", false, "dump the records of a p2p message capture file")
 )
 
 func init() {
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "Usage:", os.Args[0], "[-noascii] [-hex <data>] [filename]")
+		fmt.Fprintln(os.Stderr, "Usage:", os.Args[0], "[-noascii] [-capture] [-hex <data>] [filename]")
 		flag.PrintDefaults()
 		fmt.Fprintln(os.Stderr, `
 Dumps RLP data from the given file in readable form.
@@ -74,6 +77,12 @@ func main() {
 		os.Exit(2)
 	}
 
+	if *capture {
+		if err := dumpCapture(r); err != nil {
+			die(err)
+		}
+		return
+	}
 	s := rlp.NewStream(r, 0)
 	for {
 		if err := dump(s, 0); err != nil {
@@ -128,6 +137,33 @@ func dump(s *rlp.Stream, depth int) error {
 	return nil
 }
 
+// dumpCapture prints the records of a p2p message capture, dumping the payload
+// of each message.
+func dumpCapture(r io.Reader) error {
+	cr, err := p2p.NewCaptureReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		rec, err := cr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		dir := "<-"
+		if !rec.Inbound {
+			dir = "->"
+		}
+		when := time.Unix(0, int64(rec.Time)).UTC().Format("2006-01-02 15:04:05.000000")
+		fmt.Printf("%s %s %x %s/%d code %#x, %d bytes\n", when, dir, rec.Peer[:8], rec.Protocol, rec.Version, rec.Code, len(rec.Payload))
+		if err := dump(rlp.NewStream(bytes.NewReader(rec.Payload), 0), 1); err != nil && err != io.EOF {
+			return err
+		}
+		fmt.Println()
+	}
+}
+
 func isASCII(b []byte) bool {
 	for _, c := range b {
 		if c < 32 || c > 126 {
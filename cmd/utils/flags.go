@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/ecdsa"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -18,9 +19,11 @@ import (
 	"github.com/kowala-tech/kUSD/common"
 	"github.com/kowala-tech/kUSD/core"
 	"github.com/kowala-tech/kUSD/core/state"
+	"github.com/kowala-tech/kUSD/core/types"
 	"github.com/kowala-tech/kUSD/core/vm"
 	"github.com/kowala-tech/kUSD/crypto"
 	"github.com/kowala-tech/kUSD/dashboard"
+	"github.com/kowala-tech/kUSD/graphql"
 	"github.com/kowala-tech/kUSD/kusd"
 	"github.com/kowala-tech/kUSD/kusd/downloader"
 	"github.com/kowala-tech/kUSD/kusd/gasprice"
@@ -31,6 +34,7 @@ import (
 	"github.com/kowala-tech/kUSD/p2p"
 	"github.com/kowala-tech/kUSD/p2p/discover"
 	"github.com/kowala-tech/kUSD/p2p/discv5"
+	"github.com/kowala-tech/kUSD/p2p/dnsdisc"
 	"github.com/kowala-tech/kUSD/p2p/nat"
 	"github.com/kowala-tech/kUSD/p2p/netutil"
 	"github.com/kowala-tech/kUSD/params"
@@ -105,6 +109,14 @@ var (
 		Name:  "nousb",
 		Usage: "Disables monitoring for and managine USB hardware wallets",
 	}
+	ExternalSignerFlag = cli.StringFlag{
+		Name:  "signer",
+		Usage: "External signer (IPC path or HTTP/WS URL of a kusdsigner daemon)",
+	}
+	ExternalSignerAuthFlag = cli.StringFlag{
+		Name:  "signerauth",
+		Usage: "File holding the API key or JWT token authenticating to an HTTP external signer",
+	}
 	NetworkIdFlag = cli.Uint64Flag{
 		Name:  "networkid",
 		Usage: "Network identifier (integer, 1=Frontier, 2=Ropsten)",
@@ -138,9 +150,13 @@ var (
 	defaultSyncMode = kusd.DefaultConfig.SyncMode
 	SyncModeFlag    = TextMarshalerFlag{
 		Name:  "syncmode",
-		Usage: `Blockchain sync mode ("fast", "full", or "light")`,
+		Usage: `Blockchain sync mode ("fast", "full", "light" or "snap")`,
 		Value: &defaultSyncMode,
 	}
+	CheckpointFlag = cli.StringFlag{
+		Name:  "checkpoint",
+		Usage: "Trusted block to fast sync an empty chain from, as <number>:<hash> or a signed checkpoint file",
+	}
 
 	LightServFlag = cli.IntFlag{
 		Name:  "lightserv",
@@ -254,6 +270,11 @@ var (
 		// @TODO (rgeraldes) - default could be set to the minimum required
 	}
 
+	ValidatorTraceFlag = cli.StringFlag{
+		Name:  "validate.trace",
+		Usage: "File recording the consensus state machine, to replay it with 'kusd debug replay'",
+	}
+
 	TargetGasLimitFlag = cli.Uint64Flag{
 		Name:  "targetgaslimit",
 		Usage: "Target gas limit sets the artificial target gas floor for the blocks to be proposed",
@@ -339,6 +360,35 @@ var (
 		Usage: "API's offered over the HTTP-RPC interface",
 		Value: "",
 	}
+	RPCAuthFileFlag = cli.StringFlag{
+		Name:  "rpcauth",
+		Usage: "File with the JWT secret and API keys required by the HTTP-RPC and WS-RPC interfaces",
+		Value: "",
+	}
+	GraphQLEnabledFlag = cli.BoolFlag{
+		Name:  "graphql",
+		Usage: "Enable the GraphQL server on the HTTP-RPC interface (/graphql)",
+	}
+	RPCBatchLimitFlag = cli.IntFlag{
+		Name:  "rpcbatchlimit",
+		Usage: "Maximum number of requests in an HTTP-RPC or WS-RPC batch (0 = unlimited)",
+	}
+	RPCSizeLimitFlag = cli.Int64Flag{
+		Name:  "rpcsizelimit",
+		Usage: "Maximum size of HTTP-RPC request bodies and WS-RPC requests in bytes (0 = 128KB)",
+	}
+	RPCRateLimitFlag = cli.Float64Flag{
+		Name:  "rpcratelimit",
+		Usage: "Requests per second an HTTP-RPC or WS-RPC client (API key or IP address) may issue (0 = unlimited)",
+	}
+	RPCRateBurstFlag = cli.IntFlag{
+		Name:  "rpcrateburst",
+		Usage: "Requests an HTTP-RPC or WS-RPC client may issue at once above its rate (0 = rate)",
+	}
+	RPCSubscriptionLimitFlag = cli.IntFlag{
+		Name:  "rpcsublimit",
+		Usage: "Maximum number of subscriptions per WS-RPC connection (0 = unlimited)",
+	}
 	IPCDisabledFlag = cli.BoolFlag{
 		Name:  "ipcdisable",
 		Usage: "Disable the IPC-RPC server",
@@ -411,6 +461,11 @@ var (
 		Usage: "Comma separated enode URLs for P2P v5 discovery bootstrap (light server, light nodes)",
 		Value: "",
 	}
+	DNSListsFlag = cli.StringFlag{
+		Name:  "dnslists",
+		Usage: "Comma separated enrtree URLs of DNS node lists to sync dial candidates from (empty to disable)",
+		Value: "",
+	}
 	NodeKeyFileFlag = cli.StringFlag{
 		Name:  "nodekey",
 		Usage: "P2P node key file",
@@ -436,6 +491,23 @@ var (
 		Name:  "netrestrict",
 		Usage: "Restricts network communication to the given IP networks (CIDR masks)",
 	}
+	BehindSentryFlag = cli.BoolFlag{
+		Name:  "sentry, behind-sentry",
+		Usage: "Hides the node behind sentry nodes (the trusted nodes), disabling discovery and public connections",
+	}
+	MsgCaptureFlag = cli.StringFlag{
+		Name:  "msgcapture",
+		Usage: "File to capture raw p2p messages to for debugging, rotated at 256MB",
+	}
+	MsgCaptureFilterFlag = cli.StringFlag{
+		Name:  "msgcapture.filter",
+		Usage: "Comma separated messages to capture, as kusd message names (VoteMsg) or protocol/code pairs (kusd/0x14)",
+	}
+	PrivatePeerFlag = cli.StringFlag{
+		Name:  "private-peer",
+		Usage: "Comma separated enode URLs of the nodes to act as a sentry for, never disclosed to the network",
+		Value: "",
+	}
 
 	// ATM the url is left to the user and deployment to
 	JSpathFlag = cli.StringFlag{
@@ -532,6 +604,22 @@ func setBootstrapNodes(ctx *cli.Context, cfg *p2p.Config) {
 	}
 }
 
+// setPrivatePeers creates a list of private peer nodes from the command line
+// flags, reverting to pre-configured ones if none have been specified.
+func setPrivatePeers(ctx *cli.Context, cfg *p2p.Config) {
+	if !ctx.GlobalIsSet(PrivatePeerFlag.Name) {
+		return
+	}
+	cfg.PrivatePeers = make([]*discover.Node, 0)
+	for _, url := range strings.Split(ctx.GlobalString(PrivatePeerFlag.Name), ",") {
+		node, err := discover.ParseNode(url)
+		if err != nil {
+			Fatalf("Option %q: invalid enode %q: %v", PrivatePeerFlag.Name, url, err)
+		}
+		cfg.PrivatePeers = append(cfg.PrivatePeers, node)
+	}
+}
+
 // setBootstrapNodesV5 creates a list of bootstrap nodes from the command line
 // flags, reverting to pre-configured ones if none have been specified.
 func setBootstrapNodesV5(ctx *cli.Context, cfg *p2p.Config) {
@@ -560,6 +648,88 @@ func setBootstrapNodesV5(ctx *cli.Context, cfg *p2p.Config) {
 	}
 }
 
+// setDNSLists sets the DNS node lists to sync from the command line flags,
+// reverting to pre-configured ones if none have been specified.
+func setDNSLists(ctx *cli.Context, cfg *p2p.Config) {
+	urls := params.MainnetDNSLists
+	switch {
+	case ctx.GlobalIsSet(DNSListsFlag.Name):
+		urls = nil
+		if list := ctx.GlobalString(DNSListsFlag.Name); list != "" {
+			urls = strings.Split(list, ",")
+		}
+	case ctx.GlobalBool(TestnetFlag.Name):
+		urls = params.TestnetDNSLists
+	case cfg.DNSNodeLists != nil:
+		return // already set, don't apply defaults.
+	}
+
+	cfg.DNSNodeLists = make([]string, 0, len(urls))
+	for _, url := range urls {
+		if _, _, err := dnsdisc.ParseURL(url); err != nil {
+			Fatalf("Option %q: invalid enrtree URL %q: %v", DNSListsFlag.Name, url, err)
+		}
+		cfg.DNSNodeLists = append(cfg.DNSNodeLists, url)
+	}
+}
+
+// kusdMsgCodes maps the names of the kusd messages to their codes, for the
+// message capture filter.
+var kusdMsgCodes = map[string]uint64{
+	"StatusMsg":                     kusd.StatusMsg,
+	"NewBlockHashesMsg":             kusd.NewBlockHashesMsg,
+	"TxMsg":                         kusd.TxMsg,
+	"GetBlockHeadersMsg":            kusd.GetBlockHeadersMsg,
+	"BlockHeadersMsg":               kusd.BlockHeadersMsg,
+	"GetBlockBodiesMsg":             kusd.GetBlockBodiesMsg,
+	"BlockBodiesMsg":                kusd.BlockBodiesMsg,
+	"NewBlockMsg":                   kusd.NewBlockMsg,
+	"GetNodeDataMsg":                kusd.GetNodeDataMsg,
+	"NodeDataMsg":                   kusd.NodeDataMsg,
+	"GetReceiptsMsg":                kusd.GetReceiptsMsg,
+	"ReceiptsMsg":                   kusd.ReceiptsMsg,
+	"ProposalMsg":                   kusd.ProposalMsg,
+	"ProposalPOLMsg":                kusd.ProposalPOLMsg,
+	"VoteMsg":                       kusd.VoteMsg,
+	"ElectionMsg":                   kusd.ElectionMsg,
+	"BlockFragmentMsg":              kusd.BlockFragmentMsg,
+	"ValidatorAnnounceMsg":          kusd.ValidatorAnnounceMsg,
+	"GetAccountRangeMsg":            kusd.GetAccountRangeMsg,
+	"AccountRangeMsg":               kusd.AccountRangeMsg,
+	"GetStorageRangeMsg":            kusd.GetStorageRangeMsg,
+	"StorageRangeMsg":               kusd.StorageRangeMsg,
+	"NewPooledTransactionHashesMsg": kusd.NewPooledTransactionHashesMsg,
+	"GetPooledTransactionsMsg":      kusd.GetPooledTransactionsMsg,
+	"PooledTransactionsMsg":         kusd.PooledTransactionsMsg,
+}
+
+// setMsgCapture sets up the capture of p2p messages from the command line flags.
+func setMsgCapture(ctx *cli.Context, cfg *p2p.Config) {
+	if ctx.GlobalIsSet(MsgCaptureFlag.Name) {
+		cfg.MsgCapture = ctx.GlobalString(MsgCaptureFlag.Name)
+	}
+	if !ctx.GlobalIsSet(MsgCaptureFilterFlag.Name) {
+		return
+	}
+	cfg.MsgCaptureFilter = nil
+	for _, item := range strings.Split(ctx.GlobalString(MsgCaptureFilterFlag.Name), ",") {
+		item = strings.TrimSpace(item)
+		if code, ok := kusdMsgCodes[item]; ok {
+			cfg.MsgCaptureFilter = append(cfg.MsgCaptureFilter, p2p.MsgFilter{Protocol: kusd.ProtocolName, Code: code})
+			continue
+		}
+		parts := strings.Split(item, "/")
+		if len(parts) != 2 {
+			Fatalf("Option %q: invalid message %q", MsgCaptureFilterFlag.Name, item)
+		}
+		code, err := strconv.ParseUint(parts[1], 0, 64)
+		if err != nil {
+			Fatalf("Option %q: invalid message code %q: %v", MsgCaptureFilterFlag.Name, parts[1], err)
+		}
+		cfg.MsgCaptureFilter = append(cfg.MsgCaptureFilter, p2p.MsgFilter{Protocol: parts[0], Code: code})
+	}
+}
+
 // setListenAddress creates a TCP listening address string from set command
 // line flags.
 func setListenAddress(ctx *cli.Context, cfg *p2p.Config) {
@@ -639,6 +809,26 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// setRPCLimits applies the HTTP and WebSocket RPC client limits from the set
+// command line flags.
+func setRPCLimits(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(RPCBatchLimitFlag.Name) {
+		cfg.RPCLimits.MaxBatchSize = ctx.GlobalInt(RPCBatchLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCSizeLimitFlag.Name) {
+		cfg.RPCLimits.MaxRequestSize = ctx.GlobalInt64(RPCSizeLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCRateLimitFlag.Name) {
+		cfg.RPCLimits.RequestRate = ctx.GlobalFloat64(RPCRateLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCRateBurstFlag.Name) {
+		cfg.RPCLimits.RequestBurst = ctx.GlobalInt(RPCRateBurstFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCSubscriptionLimitFlag.Name) {
+		cfg.RPCLimits.MaxSubscriptions = ctx.GlobalInt(RPCSubscriptionLimitFlag.Name)
+	}
+}
+
 // setIPC creates an IPC path configuration from the set command line flags,
 // returning an empty string if IPC was explicitly disabled, or the set path.
 func setIPC(ctx *cli.Context, cfg *node.Config) {
@@ -711,6 +901,31 @@ func setDeposit(ctx *cli.Context, cfg *kusd.Config) {
 	if ctx.GlobalIsSet(ValidatorDepositFlag.Name) {
 		cfg.Deposit = ctx.GlobalUint64(ValidatorDepositFlag.Name)
 	}
+	if ctx.GlobalIsSet(ValidatorTraceFlag.Name) {
+		cfg.ValidatorTrace = ctx.GlobalString(ValidatorTraceFlag.Name)
+	}
+}
+
+// setCheckpoint retrieves the sync checkpoint from the command line flags,
+// either given inline or as the path of a checkpoint file.
+func setCheckpoint(ctx *cli.Context, cfg *kusd.Config) {
+	if !ctx.GlobalIsSet(CheckpointFlag.Name) {
+		return
+	}
+	value := ctx.GlobalString(CheckpointFlag.Name)
+	if cp, err := types.ParseCheckpoint(value); err == nil {
+		cfg.Checkpoint = cp
+		return
+	}
+	data, err := ioutil.ReadFile(value)
+	if err != nil {
+		Fatalf("Option %q: %v", CheckpointFlag.Name, err)
+	}
+	cp := new(types.Checkpoint)
+	if err := json.Unmarshal(data, cp); err != nil {
+		Fatalf("Option %q: invalid checkpoint file: %v", CheckpointFlag.Name, err)
+	}
+	cfg.Checkpoint = cp
 }
 
 // MakePasswordList reads password lines from the file specified by the global --password flag.
@@ -738,6 +953,8 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 	setDiscoveryV5Address(ctx, cfg)
 	setBootstrapNodes(ctx, cfg)
 	setBootstrapNodesV5(ctx, cfg)
+	setDNSLists(ctx, cfg)
+	setMsgCapture(ctx, cfg)
 
 	if ctx.GlobalIsSet(MaxPeersFlag.Name) {
 		cfg.MaxPeers = ctx.GlobalInt(MaxPeersFlag.Name)
@@ -759,6 +976,14 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 		cfg.DiscoveryV5 = true
 	}
 
+	// The flag may be given under any of its names
+	for _, name := range strings.Split(BehindSentryFlag.Name, ",") {
+		if name = strings.TrimSpace(name); ctx.GlobalIsSet(name) {
+			cfg.BehindSentry = ctx.GlobalBool(name)
+		}
+	}
+	setPrivatePeers(ctx, cfg)
+
 	if netrestrict := ctx.GlobalString(NetrestrictFlag.Name); netrestrict != "" {
 		list, err := netutil.ParseNetlist(netrestrict)
 		if err != nil {
@@ -783,6 +1008,10 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setIPC(ctx, cfg)
 	setHTTP(ctx, cfg)
 	setWS(ctx, cfg)
+	if ctx.GlobalIsSet(RPCAuthFileFlag.Name) {
+		cfg.RPCAuthFile = ctx.GlobalString(RPCAuthFileFlag.Name)
+	}
+	setRPCLimits(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 
 	switch {
@@ -803,6 +1032,16 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(NoUSBFlag.Name) {
 		cfg.NoUSB = ctx.GlobalBool(NoUSBFlag.Name)
 	}
+	if ctx.GlobalIsSet(ExternalSignerFlag.Name) {
+		cfg.ExternalSigner = ctx.GlobalString(ExternalSignerFlag.Name)
+	}
+	if file := ctx.GlobalString(ExternalSignerAuthFlag.Name); file != "" {
+		token, err := ioutil.ReadFile(file)
+		if err != nil {
+			Fatalf("Failed to read external signer token: %v", err)
+		}
+		cfg.ExternalSignerToken = strings.TrimSpace(string(token))
+	}
 }
 
 func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
@@ -879,6 +1118,7 @@ func SetKowalaConfig(ctx *cli.Context, stack *node.Node, cfg *kusd.Config) {
 	case ctx.GlobalBool(LightModeFlag.Name):
 		cfg.SyncMode = downloader.LightSync
 	}
+	setCheckpoint(ctx, cfg)
 	if ctx.GlobalIsSet(LightServFlag.Name) {
 		cfg.LightServ = ctx.GlobalInt(LightServFlag.Name)
 	}
@@ -977,6 +1217,20 @@ func RegisterKowalaStatsService(stack *node.Node, url string) {
 	}
 }
 
+// RegisterGraphQLService adds a GraphQL server serving the Kowala data on the
+// HTTP-RPC interface of the given node.
+func RegisterGraphQLService(stack *node.Node) {
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		var kowalaServ *kusd.Kowala
+		if err := ctx.Service(&kowalaServ); err != nil {
+			return nil, err
+		}
+		return graphql.New(kowalaServ.ApiBackend)
+	}); err != nil {
+		Fatalf("Failed to register the GraphQL service: %v", err)
+	}
+}
+
 // SetupNetwork configures the system for either the main net or some test network.
 func SetupNetwork(ctx *cli.Context) {
 	// TODO(fjl): move target gas limit into config
@@ -1,19 +1,23 @@
 package common
 
 import (
+	"errors"
+	"io"
 	"sync"
 
 	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/rlp"
 )
 
-// @TODO (rgeraldes) - add interval validation for the index (Get, Set)
-
 const (
 	word = 64 // 64 bit word
 	div  = 6  // number of right shifts to divide by 64
 	mod  = word - 1
 )
 
+var errInvalidBitArray = errors.New("invalid bit array encoding")
+
+// BitArray is a thread safe fixed size array of bits
 type BitArray struct {
 	bitsMu sync.Mutex
 	nbits  uint64
@@ -33,46 +37,144 @@ func NewBitArray(nbits uint64) *BitArray {
 	}
 }
 
+// Size returns the number of bits of the array
+func (array *BitArray) Size() int {
+	if array == nil {
+		return 0
+	}
+	return int(array.nbits)
+}
+
+// Set sets the bit at index i. Indexes out of range are ignored.
 func (array *BitArray) Set(i int) {
+	if i < 0 || uint64(i) >= array.nbits {
+		return
+	}
 	array.bitsMu.Lock()
-	array.bitsMu.Unlock()
+	defer array.bitsMu.Unlock()
 	array.bits[i>>div] |= uint64(1) << (uint64(i) & mod)
 }
 
-/*
-
-func (array *BitArray) Size() int { return array.nbits }
-
+// Get returns whether the bit at index i is set. Indexes out of range and nil
+// arrays are reported as not set.
 func (array *BitArray) Get(i int) bool {
+	if array == nil || i < 0 || uint64(i) >= array.nbits {
+		return false
+	}
 	array.bitsMu.Lock()
 	defer array.bitsMu.Unlock()
-	return array.bits[i>>div] & (uint64(1) << (i & mod))
+	return array.bits[i>>div]&(uint64(1)<<(uint64(i)&mod)) != 0
 }
 
+// Copy returns a deep copy of the array
+func (array *BitArray) Copy() *BitArray {
+	if array == nil {
+		return nil
+	}
+	array.bitsMu.Lock()
+	defer array.bitsMu.Unlock()
 
+	bits := make([]uint64, len(array.bits))
+	copy(bits, array.bits)
+	return &BitArray{
+		nbits: array.nbits,
+		bits:  bits,
+	}
+}
 
-// @TODO (rgeraldes) - review
+// Sub returns the bits set in the array but not in o. A nil o is treated as an
+// empty array.
+func (array *BitArray) Sub(o *BitArray) *BitArray {
+	result := array.Copy()
+	if result == nil || o == nil {
+		return result
+	}
+	o.bitsMu.Lock()
+	defer o.bitsMu.Unlock()
 
-/*
+	for i := 0; i < len(result.bits) && i < len(o.bits); i++ {
+		result.bits[i] &^= o.bits[i]
+	}
+	return result
+}
 
-func (bA *BitArray) Copy() *BitArray {
-	if bA == nil {
+// IsEmpty returns whether no bit is set
+func (array *BitArray) IsEmpty() bool {
+	if array == nil {
+		return true
+	}
+	array.bitsMu.Lock()
+	defer array.bitsMu.Unlock()
+
+	for _, bits := range array.bits {
+		if bits != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Indexes returns the indexes of the bits set, in ascending order
+func (array *BitArray) Indexes() []int {
+	if array == nil {
 		return nil
 	}
-	bA.mtx.Lock()
-	defer bA.mtx.Unlock()
-	return bA.copy()
+	array.bitsMu.Lock()
+	defer array.bitsMu.Unlock()
+
+	var indexes []int
+	for i := uint64(0); i < array.nbits; i++ {
+		if array.bits[i>>div]&(uint64(1)<<(i&mod)) != 0 {
+			indexes = append(indexes, int(i))
+		}
+	}
+	return indexes
 }
 
-func (bA *BitArray) copy() *BitArray {
-	c := make([]uint64, len(bA.Elems))
-	copy(c, bA.Elems)
-	return &BitArray{
-		Bits:  bA.Bits,
-		Elems: c,
+// bitArrayRLP is the network encoding of a BitArray
+type bitArrayRLP struct {
+	Size uint64
+	Bits []uint64
+}
+
+// EncodeRLP implements rlp.Encoder. A nil array is encoded as a zero sized one.
+func (array *BitArray) EncodeRLP(w io.Writer) error {
+	if array == nil {
+		return rlp.Encode(w, new(bitArrayRLP))
 	}
+	array.bitsMu.Lock()
+	defer array.bitsMu.Unlock()
+	return rlp.Encode(w, &bitArrayRLP{Size: array.nbits, Bits: array.bits})
 }
 
+// DecodeRLP implements rlp.Decoder
+func (array *BitArray) DecodeRLP(s *rlp.Stream) error {
+	var dec bitArrayRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	if dec.Size == 0 && len(dec.Bits) == 0 {
+		array.bitsMu.Lock()
+		defer array.bitsMu.Unlock()
+		array.nbits, array.bits = 0, nil
+		return nil
+	}
+	if dec.Size == 0 || uint64(len(dec.Bits)) != (dec.Size>>div)+1 {
+		return errInvalidBitArray
+	}
+	// Clear the bits beyond the size so they don't leak into the set operations
+	dec.Bits[len(dec.Bits)-1] &= (uint64(1) << (dec.Size & mod)) - 1
+
+	array.bitsMu.Lock()
+	defer array.bitsMu.Unlock()
+	array.nbits, array.bits = dec.Size, dec.Bits
+	return nil
+}
+
+// @TODO (rgeraldes) - review
+
+/*
+
 func (bA *BitArray) copyBits(bits int) *BitArray {
 	c := make([]uint64, (bits+63)/64)
 	copy(c, bA.Elems)
@@ -127,44 +229,6 @@ func (bA *BitArray) Not() *BitArray {
 	return c
 }
 
-func (bA *BitArray) Sub(o *BitArray) *BitArray {
-	if bA == nil {
-		return nil
-	}
-	bA.mtx.Lock()
-	defer bA.mtx.Unlock()
-	if bA.Bits > o.Bits {
-		c := bA.copy()
-		for i := 0; i < len(o.Elems)-1; i++ {
-			c.Elems[i] &= ^c.Elems[i]
-		}
-		i := len(o.Elems) - 1
-		if i >= 0 {
-			for idx := i * 64; idx < o.Bits; idx++ {
-				// NOTE: each individual GetIndex() call to o is safe.
-				c.setIndex(idx, c.getIndex(idx) && !o.GetIndex(idx))
-			}
-		}
-		return c
-	} else {
-		return bA.and(o.Not()) // Note degenerate case where o == nil
-	}
-}
-
-func (bA *BitArray) IsEmpty() bool {
-	if bA == nil {
-		return true // should this be opposite?
-	}
-	bA.mtx.Lock()
-	defer bA.mtx.Unlock()
-	for _, e := range bA.Elems {
-		if e > 0 {
-			return false
-		}
-	}
-	return true
-}
-
 func (bA *BitArray) IsFull() bool {
 	if bA == nil {
 		return true
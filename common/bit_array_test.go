@@ -1,3 +1,88 @@
 package common
 
-// @TODO (rgeraldes) - complete
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/rlp"
+)
+
+func TestBitArraySetGet(t *testing.T) {
+	array := NewBitArray(70)
+	for _, i := range []int{0, 3, 63, 64, 69} {
+		array.Set(i)
+	}
+	array.Set(70) // out of range, ignored
+	array.Set(-1)
+
+	if have, want := array.Indexes(), []int{0, 3, 63, 64, 69}; !reflect.DeepEqual(have, want) {
+		t.Errorf("indexes mismatch: have %v, want %v", have, want)
+	}
+	if array.Get(1) || array.Get(70) || array.Get(-1) {
+		t.Errorf("unset bits reported as set")
+	}
+	if array.Size() != 70 {
+		t.Errorf("size mismatch: have %d, want %d", array.Size(), 70)
+	}
+}
+
+func TestBitArraySub(t *testing.T) {
+	have, want := NewBitArray(10), NewBitArray(10)
+	for _, i := range []int{1, 2, 5, 9} {
+		have.Set(i)
+	}
+	want.Set(2)
+	want.Set(9)
+
+	missing := have.Sub(want)
+	if indexes := missing.Indexes(); !reflect.DeepEqual(indexes, []int{1, 5}) {
+		t.Errorf("difference mismatch: have %v, want %v", indexes, []int{1, 5})
+	}
+	if indexes := have.Sub(nil).Indexes(); len(indexes) != 4 {
+		t.Errorf("difference with nil array mismatch: have %v", indexes)
+	}
+	if !want.Sub(have).IsEmpty() {
+		t.Errorf("difference of a subset not empty")
+	}
+	if have.Indexes()[0] != 1 {
+		t.Errorf("difference modified the source array")
+	}
+}
+
+func TestBitArrayRLP(t *testing.T) {
+	array := NewBitArray(100)
+	array.Set(7)
+	array.Set(99)
+
+	enc, err := rlp.EncodeToBytes(array)
+	if err != nil {
+		t.Fatalf("failed to encode bit array: %v", err)
+	}
+	dec := new(BitArray)
+	if err := rlp.DecodeBytes(enc, dec); err != nil {
+		t.Fatalf("failed to decode bit array: %v", err)
+	}
+	if dec.Size() != 100 || !reflect.DeepEqual(dec.Indexes(), []int{7, 99}) {
+		t.Errorf("decoded bit array mismatch: have %d %v, want 100 [7 99]", dec.Size(), dec.Indexes())
+	}
+	// Bits beyond the size and mismatching lengths are rejected or cleared
+	enc, _ = rlp.EncodeToBytes(&bitArrayRLP{Size: 3, Bits: []uint64{0xff}})
+	if err := rlp.DecodeBytes(enc, dec); err != nil {
+		t.Fatalf("failed to decode bit array: %v", err)
+	}
+	if indexes := dec.Indexes(); !reflect.DeepEqual(indexes, []int{0, 1, 2}) {
+		t.Errorf("straggler bits not cleared: have %v", indexes)
+	}
+	// Nil arrays are decoded as zero sized ones
+	enc, _ = rlp.EncodeToBytes((*BitArray)(nil))
+	if err := rlp.DecodeBytes(enc, dec); err != nil {
+		t.Fatalf("failed to decode nil bit array: %v", err)
+	}
+	if dec.Size() != 0 || !dec.IsEmpty() {
+		t.Errorf("nil bit array decoded with size %d", dec.Size())
+	}
+	enc, _ = rlp.EncodeToBytes(&bitArrayRLP{Size: 3, Bits: []uint64{0, 0}})
+	if err := rlp.DecodeBytes(enc, dec); err != errInvalidBitArray {
+		t.Errorf("decode error mismatch: have %v, want %v", err, errInvalidBitArray)
+	}
+}
@@ -56,6 +56,18 @@ func (b Bytes) String() string {
 	return Encode(b)
 }
 
+// ImplementsGraphQLType returns true if Bytes implements the specified GraphQL type.
+func (b Bytes) ImplementsGraphQLType(name string) bool { return name == "Bytes" }
+
+// UnmarshalGraphQL parses hex encoded bytes from a GraphQL query.
+func (b *Bytes) UnmarshalGraphQL(input interface{}) error {
+	str, ok := input.(string)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for Bytes", input)
+	}
+	return b.UnmarshalText([]byte(str))
+}
+
 // UnmarshalFixedJSON decodes the input as a string with 0x prefix. The length of out
 // determines the required input length. This function is commonly used to implement the
 // UnmarshalJSON method for fixed-size types.
@@ -171,6 +183,28 @@ func (b *Big) String() string {
 	return EncodeBig(b.ToInt())
 }
 
+// ImplementsGraphQLType returns true if Big implements the specified GraphQL type.
+func (b Big) ImplementsGraphQLType(name string) bool { return name == "BigInt" }
+
+// UnmarshalGraphQL parses a hex or decimal big integer from a GraphQL query.
+func (b *Big) UnmarshalGraphQL(input interface{}) error {
+	switch input := input.(type) {
+	case string:
+		if has0xPrefix(input) {
+			return b.UnmarshalText([]byte(input))
+		}
+		if _, ok := b.ToInt().SetString(input, 10); !ok {
+			return fmt.Errorf("invalid BigInt %q", input)
+		}
+		return nil
+	case int32:
+		b.ToInt().SetInt64(int64(input))
+		return nil
+	default:
+		return fmt.Errorf("unexpected type %T for BigInt", input)
+	}
+}
+
 // Uint64 marshals/unmarshals as a JSON string with 0x prefix.
 // The zero value marshals as "0x0".
 type Uint64 uint64
@@ -218,6 +252,33 @@ func (b Uint64) String() string {
 	return EncodeUint64(uint64(b))
 }
 
+// ImplementsGraphQLType returns true if Uint64 implements the specified GraphQL type.
+func (b Uint64) ImplementsGraphQLType(name string) bool { return name == "Long" }
+
+// UnmarshalGraphQL parses a hex or decimal quantity from a GraphQL query.
+func (b *Uint64) UnmarshalGraphQL(input interface{}) error {
+	switch input := input.(type) {
+	case string:
+		if has0xPrefix(input) {
+			return b.UnmarshalText([]byte(input))
+		}
+		n, err := strconv.ParseUint(input, 10, 64)
+		if err != nil {
+			return err
+		}
+		*b = Uint64(n)
+		return nil
+	case int32:
+		if input < 0 {
+			return fmt.Errorf("negative Long %d", input)
+		}
+		*b = Uint64(input)
+		return nil
+	default:
+		return fmt.Errorf("unexpected type %T for Long", input)
+	}
+}
+
 // Uint marshals/unmarshals as a JSON string with 0x prefix.
 // The zero value marshals as "0x0".
 type Uint uint
@@ -0,0 +1,64 @@
+package mclock
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that the timers of a simulated clock fire in order once it runs past
+// them, and only then.
+func TestSimulatedAfter(t *testing.T) {
+	var clock Simulated
+
+	late := clock.After(30 * time.Millisecond)
+	early := clock.After(10 * time.Millisecond)
+	if n := clock.ActiveTimers(); n != 2 {
+		t.Fatalf("active timers mismatch: have %d, want 2", n)
+	}
+	clock.Run(20 * time.Millisecond)
+	if now := clock.Now(); now != AbsTime(20*time.Millisecond) {
+		t.Errorf("time mismatch: have %v, want %v", time.Duration(now), 20*time.Millisecond)
+	}
+	select {
+	case <-early:
+	default:
+		t.Fatal("early timer didn't fire")
+	}
+	select {
+	case <-late:
+		t.Fatal("late timer fired early")
+	default:
+	}
+	clock.Run(10 * time.Millisecond)
+	select {
+	case <-late:
+	default:
+		t.Fatal("late timer didn't fire")
+	}
+	if n := clock.ActiveTimers(); n != 0 {
+		t.Errorf("active timers mismatch: have %d, want 0", n)
+	}
+}
+
+// Tests that a goroutine sleeping on a simulated clock wakes up when the clock
+// runs past its deadline.
+func TestSimulatedSleep(t *testing.T) {
+	var clock Simulated
+
+	done := make(chan AbsTime)
+	go func() {
+		clock.Sleep(time.Second)
+		done <- clock.Now()
+	}()
+	clock.WaitForTimers(1)
+	clock.Run(time.Second)
+
+	select {
+	case now := <-done:
+		if now != AbsTime(time.Second) {
+			t.Errorf("wake up time mismatch: have %v, want %v", time.Duration(now), time.Second)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("sleeper didn't wake up")
+	}
+}
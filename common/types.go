@@ -67,6 +67,18 @@ func (h *Hash) UnmarshalJSON(input []byte) error {
 	return hexutil.UnmarshalFixedJSON(hashT, input, h[:])
 }
 
+// ImplementsGraphQLType returns true if Hash implements the specified GraphQL type.
+func (h Hash) ImplementsGraphQLType(name string) bool { return name == "Bytes32" }
+
+// UnmarshalGraphQL parses a hash in hex syntax from a GraphQL query.
+func (h *Hash) UnmarshalGraphQL(input interface{}) error {
+	str, ok := input.(string)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for Bytes32", input)
+	}
+	return h.UnmarshalText([]byte(str))
+}
+
 // MarshalText returns the hex representation of h.
 func (h Hash) MarshalText() ([]byte, error) {
 	return hexutil.Bytes(h[:]).MarshalText()
@@ -215,6 +227,18 @@ func (a *Address) UnmarshalJSON(input []byte) error {
 	return hexutil.UnmarshalFixedJSON(addressT, input, a[:])
 }
 
+// ImplementsGraphQLType returns true if Address implements the specified GraphQL type.
+func (a Address) ImplementsGraphQLType(name string) bool { return name == "Address" }
+
+// UnmarshalGraphQL parses an address in hex syntax from a GraphQL query.
+func (a *Address) UnmarshalGraphQL(input interface{}) error {
+	str, ok := input.(string)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for Address", input)
+	}
+	return a.UnmarshalText([]byte(str))
+}
+
 // UnprefixedHash allows marshaling an Address without 0x prefix.
 type UnprefixedAddress Address
 
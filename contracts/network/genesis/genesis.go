@@ -0,0 +1,238 @@
+// Package genesis deploys the Kowala system contracts into a genesis allocation.
+package genesis
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/kowala-tech/kUSD/accounts/abi"
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/contracts/network"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/state"
+	"github.com/kowala-tech/kUSD/core/vm"
+	"github.com/kowala-tech/kUSD/core/vm/runtime"
+	"github.com/kowala-tech/kUSD/kusddb"
+)
+
+// DefaultOwner is the owner of the system contracts on the Kowala networks. The
+// address of the network map contract, which the node looks up to find all the
+// other system contracts, is derived from it.
+var DefaultOwner = common.HexToAddress("0x259be75d96876f2ada3d202722523e9cd4dd917d")
+
+// storageTracer records every storage slot written by the contracts being
+// deployed, so their state can be placed in a genesis allocation.
+type storageTracer struct {
+	data map[common.Address]map[common.Hash]common.Hash
+}
+
+func newStorageTracer() *storageTracer {
+	return &storageTracer{
+		data: make(map[common.Address]map[common.Hash]common.Hash, 1024),
+	}
+}
+
+func (t *storageTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if err != nil {
+		return err
+	}
+	if op == vm.SSTORE {
+		s := stack.Data()
+		addrStorage, ok := t.data[contract.Address()]
+		if !ok {
+			addrStorage = make(map[common.Hash]common.Hash, 1024)
+			t.data[contract.Address()] = addrStorage
+		}
+		addrStorage[common.BigToHash(s[len(s)-1])] = common.BigToHash(s[len(s)-2])
+	}
+	return nil
+}
+
+func (t *storageTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+// Validator is an account registered as a voter of the network contract in the
+// genesis block.
+type Validator struct {
+	Address common.Address `json:"address"`
+	Deposit *big.Int       `json:"deposit"` // amount at stake, in wei
+}
+
+// contract is a system contract deployed in the scratch EVM.
+type contract struct {
+	addr    common.Address
+	code    []byte
+	storage map[common.Hash]common.Hash
+}
+
+func create(cfg *runtime.Config, code []byte) (*contract, error) {
+	out, addr, _, err := runtime.Create(code, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &contract{
+		addr:    addr,
+		code:    out,
+		storage: cfg.EVMConfig.Tracer.(*storageTracer).data[addr],
+	}, nil
+}
+
+// SystemContracts deploys the network, mToken, price oracle and network map
+// contracts on behalf of owner and returns their code, storage and balance as
+// genesis accounts. The given validators deposit in the network contract in
+// place of the voter registered by the contract constructor. Neither the owner
+// nor the validators are funded.
+func SystemContracts(owner common.Address, validators ...Validator) (core.GenesisAlloc, error) {
+	db, err := kusddb.NewMemDatabase()
+	if err != nil {
+		return nil, err
+	}
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db))
+	if err != nil {
+		return nil, err
+	}
+	cfg := &runtime.Config{
+		Origin: owner,
+		State:  statedb,
+		EVMConfig: vm.Config{
+			Debug:  true,
+			Tracer: newStorageTracer(),
+		},
+	}
+	// The deployment order is fixed, the contract addresses derive from it
+	networkContract, err := create(cfg, common.FromHex(network.NetworkContractBin))
+	if err != nil {
+		return nil, fmt.Errorf("can't create network contract: %v", err)
+	}
+	mToken, err := create(cfg, common.FromHex(network.MusdContractBin))
+	if err != nil {
+		return nil, fmt.Errorf("can't create mToken contract: %v", err)
+	}
+	oracleABI, err := abi.JSON(strings.NewReader(network.PriceOracleContractABI))
+	if err != nil {
+		return nil, fmt.Errorf("can't parse price oracle contract ABI: %v", err)
+	}
+	oracleParams, err := oracleABI.Pack("",
+		"kUSD", "kUSD", uint8(18), big.NewInt(1000000000000000000),
+		"US Dollar", "USD", uint8(4), big.NewInt(10000),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("can't pack price oracle contract params: %v", err)
+	}
+	oracle, err := create(cfg, append(common.FromHex(network.PriceOracleContractBin), oracleParams...))
+	if err != nil {
+		return nil, fmt.Errorf("can't create price oracle contract: %v", err)
+	}
+	mapABI, err := abi.JSON(strings.NewReader(network.ContractsContractABI))
+	if err != nil {
+		return nil, fmt.Errorf("can't parse network map contract ABI: %v", err)
+	}
+	mapParams, err := mapABI.Pack("", mToken.addr, oracle.addr, networkContract.addr)
+	if err != nil {
+		return nil, fmt.Errorf("can't pack network map contract params: %v", err)
+	}
+	netMap, err := create(cfg, append(common.FromHex(network.ContractsContractBin), mapParams...))
+	if err != nil {
+		return nil, fmt.Errorf("can't create network map contract: %v", err)
+	}
+	if err := registerValidators(cfg, networkContract, validators); err != nil {
+		return nil, err
+	}
+	alloc := make(core.GenesisAlloc)
+	for _, c := range []*contract{networkContract, mToken, oracle, netMap} {
+		alloc[c.addr] = core.GenesisAccount{
+			Code:    c.code,
+			Storage: c.storage,
+			Balance: statedb.GetBalance(c.addr),
+		}
+	}
+	return alloc, nil
+}
+
+// registerValidators withdraws the voters registered by the network contract
+// constructor and makes the deposits of the validators through the contract
+// ABI, so that they are the voters of the genesis block.
+func registerValidators(cfg *runtime.Config, networkContract *contract, validators []Validator) error {
+	if len(validators) == 0 {
+		return nil
+	}
+	networkABI, err := abi.JSON(strings.NewReader(network.NetworkContractABI))
+	if err != nil {
+		return fmt.Errorf("can't parse network contract ABI: %v", err)
+	}
+	input, err := networkABI.Pack("deposit")
+	if err != nil {
+		return fmt.Errorf("can't pack deposit call: %v", err)
+	}
+	if err := withdrawConstructorVoters(cfg, networkContract, networkABI); err != nil {
+		return err
+	}
+	for _, v := range validators {
+		if v.Deposit == nil || v.Deposit.Sign() <= 0 {
+			return fmt.Errorf("genesis validator %x has no deposit", v.Address)
+		}
+		depositCfg := *cfg
+		depositCfg.Origin, depositCfg.Value = v.Address, v.Deposit
+
+		// The deposit is held by the contract, the validator isn't funded
+		cfg.State.AddBalance(v.Address, v.Deposit)
+		if _, _, err := runtime.Call(networkContract.addr, input, &depositCfg); err != nil {
+			return fmt.Errorf("can't register genesis validator %x: %v", v.Address, err)
+		}
+	}
+	return nil
+}
+
+// withdrawConstructorVoters withdraws the voters the network contract registers
+// in its constructor, leaving the given validators the only voters. Nobody runs
+// them on a network of its own, and a voter that never votes counts against the
+// quorum of every election.
+func withdrawConstructorVoters(cfg *runtime.Config, networkContract *contract, networkABI abi.ABI) error {
+	input, err := networkABI.Pack("getVoterCount")
+	if err != nil {
+		return fmt.Errorf("can't pack getVoterCount call: %v", err)
+	}
+	out, _, err := runtime.Call(networkContract.addr, input, cfg)
+	if err != nil {
+		return fmt.Errorf("can't call getVoterCount: %v", err)
+	}
+	count := new(big.Int)
+	if err := networkABI.Unpack(&count, "getVoterCount", out); err != nil {
+		return fmt.Errorf("can't unpack getVoterCount result: %v", err)
+	}
+	withdraw, err := networkABI.Pack("withdraw")
+	if err != nil {
+		return fmt.Errorf("can't pack withdraw call: %v", err)
+	}
+	// A withdrawal moves the last voter into the place of the withdrawn one
+	for i := count.Int64() - 1; i >= 0; i-- {
+		input, err := networkABI.Pack("getVoterAtIndex", big.NewInt(i))
+		if err != nil {
+			return fmt.Errorf("can't pack getVoterAtIndex call: %v", err)
+		}
+		out, _, err := runtime.Call(networkContract.addr, input, cfg)
+		if err != nil {
+			return fmt.Errorf("can't call getVoterAtIndex: %v", err)
+		}
+		var voter struct {
+			Addr    common.Address
+			Deposit *big.Int
+		}
+		if err := networkABI.Unpack(&voter, "getVoterAtIndex", out); err != nil {
+			return fmt.Errorf("can't unpack getVoterAtIndex result: %v", err)
+		}
+		// The constructor never received the deposit it pays back, credit it
+		// so the refund doesn't come out of the deposits of the validators
+		cfg.State.AddBalance(networkContract.addr, voter.Deposit)
+
+		withdrawCfg := *cfg
+		withdrawCfg.Origin = voter.Addr
+		if _, _, err := runtime.Call(networkContract.addr, withdraw, &withdrawCfg); err != nil {
+			return fmt.Errorf("can't withdraw constructor voter %x: %v", voter.Addr, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package genesis
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/accounts/abi"
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/contracts/network"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/vm/runtime"
+)
+
+func TestSystemContractsValidators(t *testing.T) {
+	validators := []Validator{
+		{Address: common.HexToAddress("0x1000000000000000000000000000000000000001"), Deposit: big.NewInt(100000)},
+		{Address: common.HexToAddress("0x1000000000000000000000000000000000000002"), Deposit: big.NewInt(250000)},
+	}
+	alloc, err := SystemContracts(DefaultOwner, validators...)
+	if err != nil {
+		t.Fatalf("can't create system contracts: %v", err)
+	}
+	_, statedb := (&core.Genesis{Alloc: alloc}).ToBlock()
+	contracts, err := network.GetContracts(statedb)
+	if err != nil {
+		t.Fatalf("can't find system contracts: %v", err)
+	}
+	if balance := statedb.GetBalance(contracts.Network); balance.Cmp(big.NewInt(350000)) != 0 {
+		t.Errorf("network contract balance mismatch: have %v, want 350000", balance)
+	}
+	networkABI, err := abi.JSON(strings.NewReader(network.NetworkContractABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(result interface{}, method string, args ...interface{}) {
+		input, err := networkABI.Pack(method, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _, err := runtime.Call(contracts.Network, input, &runtime.Config{State: statedb})
+		if err != nil {
+			t.Fatalf("%s failed: %v", method, err)
+		}
+		if err := networkABI.Unpack(result, method, out); err != nil {
+			t.Fatalf("can't unpack %s result: %v", method, err)
+		}
+	}
+	// The voter of the contract constructor is withdrawn
+	count := new(big.Int)
+	call(&count, "getVoterCount")
+	if count.Int64() != int64(len(validators)) {
+		t.Fatalf("voter count mismatch: have %v, want %d", count, len(validators))
+	}
+	for i, v := range validators {
+		var voter struct {
+			Addr    common.Address
+			Deposit *big.Int
+		}
+		call(&voter, "getVoterAtIndex", big.NewInt(int64(i)))
+		if voter.Addr != v.Address || voter.Deposit.Cmp(v.Deposit) != 0 {
+			t.Errorf("voter %d mismatch: have %x with %v, want %x with %v", i, voter.Addr, voter.Deposit, v.Address, v.Deposit)
+		}
+		var registered bool
+		call(&registered, "isVoter", v.Address)
+		if !registered {
+			t.Errorf("validator %x is not a voter", v.Address)
+		}
+	}
+	investor := common.HexToAddress("0xd6e579085c82329c89fca7a9f012be59028ed53f")
+	var registered bool
+	call(&registered, "isVoter", investor)
+	if registered {
+		t.Errorf("constructor voter %x left registered", investor)
+	}
+}
+
+func TestSystemContractsNoDeposit(t *testing.T) {
+	validators := []Validator{{Address: common.HexToAddress("0x1000000000000000000000000000000000000001")}}
+	if _, err := SystemContracts(DefaultOwner, validators...); err == nil {
+		t.Fatal("validator without deposit accepted")
+	}
+}
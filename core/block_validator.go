@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"math/big"
 
+	"github.com/kowala-tech/kUSD/common"
 	"github.com/kowala-tech/kUSD/common/math"
 	"github.com/kowala-tech/kUSD/consensus"
 	"github.com/kowala-tech/kUSD/core/state"
@@ -32,11 +33,16 @@ import (
 //
 // BlockValidator implements Validator.
 type BlockValidator struct {
-	config *params.ChainConfig // Chain configuration options
-	bc     *BlockChain         // Canonical block chain
-	engine consensus.Engine    // Consensus engine used for validating
+	config     *params.ChainConfig // Chain configuration options
+	bc         *BlockChain         // Canonical block chain
+	engine     consensus.Engine    // Consensus engine used for validating
+	validators ValidatorsFn        // Validator set committing a block, nil to skip commit verification
 }
 
+// ValidatorsFn returns the validator set registered in the state of a block,
+// the validators committing its child.
+type ValidatorsFn func(header *types.Header, statedb *state.StateDB) (*types.ValidatorSet, error)
+
 // NewBlockValidator returns a new block validator which is safe for re-use
 func NewBlockValidator(config *params.ChainConfig, blockchain *BlockChain, engine consensus.Engine) *BlockValidator {
 	validator := &BlockValidator{
@@ -47,6 +53,15 @@ func NewBlockValidator(config *params.ChainConfig, blockchain *BlockChain, engin
 	return validator
 }
 
+// NewCommitValidator returns a block validator that also verifies the commit of
+// the parent block carried by every block against the validator set returned by
+// validators.
+func NewCommitValidator(config *params.ChainConfig, blockchain *BlockChain, engine consensus.Engine, validators ValidatorsFn) *BlockValidator {
+	validator := NewBlockValidator(config, blockchain, engine)
+	validator.validators = validators
+	return validator
+}
+
 // ValidateBody validates the given block's uncles and verifies the the block
 // header's transaction and uncle roots. The headers are assumed to be already
 // validated at this point.
@@ -61,11 +76,47 @@ func (v *BlockValidator) ValidateBody(block *types.Block) error {
 	// Header validity is known at this point, check transactions
 	header := block.Header()
 
-	// @TODO (rgeraldes) - add commit verification + hash
-
 	if hash := types.DeriveSha(block.Transactions()); hash != header.TxHash {
 		return fmt.Errorf("transaction root hash mismatch: have %x, want %x", hash, header.TxHash)
 	}
+	// The genesis block isn't voted on, the first block carries no commit
+	if v.validators != nil && header.Number.Cmp(common.Big1) > 0 {
+		return v.validateCommit(block)
+	}
+	return nil
+}
+
+// validateCommit verifies that the commit carried by block holds the pre-commits
+// of its parent by the validators registered in the state of the grandparent.
+func (v *BlockValidator) validateCommit(block *types.Block) error {
+	commit := block.LastCommit()
+	if hash := commit.Hash(); hash != block.LastCommitHash() {
+		return fmt.Errorf("last commit hash mismatch: have %x, want %x", hash, block.LastCommitHash())
+	}
+	parent := v.bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	// The state preceding a checkpoint is never synchronised, but the checkpoint
+	// block is trusted and its finality proven by the commit of its child
+	if parent.Hash() == GetCheckpointHash(v.bc.chainDb) {
+		return nil
+	}
+	grandparent := v.bc.GetBlock(parent.ParentHash(), parent.NumberU64()-1)
+	if grandparent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	statedb, err := v.bc.StateAt(grandparent.Root())
+	if err != nil {
+		return err
+	}
+	validators, err := v.validators(grandparent.Header(), statedb)
+	if err != nil {
+		return fmt.Errorf("could not load the validator set: %v", err)
+	}
+	if err := validators.VerifyCommit(types.NewAndromedaSigner(v.config.ChainID), parent.Hash(), commit); err != nil {
+		return fmt.Errorf("invalid last commit: %v", err)
+	}
 	return nil
 }
 
@@ -746,6 +746,115 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 	return 0, nil
 }
 
+// InsertCheckpoint anchors the chain at a trusted block whose state was already
+// synchronised, skipping the history before it. The block becomes the new head
+// and the oldest block with a known history, until the history is backfilled
+// via InsertHistory.
+func (bc *BlockChain) InsertCheckpoint(block *types.Block, receipts types.Receipts) error {
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+
+	if _, err := trie.NewSecure(block.Root(), bc.chainDb, 0); err != nil {
+		return fmt.Errorf("checkpoint state missing: %v", err)
+	}
+	SetReceiptsData(bc.config, block, receipts)
+
+	batch := bc.chainDb.NewBatch()
+	if err := WriteBlock(batch, block); err != nil {
+		return fmt.Errorf("failed to write checkpoint block: %v", err)
+	}
+	if err := WriteBlockReceipts(batch, block.Hash(), block.NumberU64(), receipts); err != nil {
+		return fmt.Errorf("failed to write checkpoint receipts: %v", err)
+	}
+	if err := WriteTxLookupEntries(batch, block); err != nil {
+		return fmt.Errorf("failed to write lookup metadata: %v", err)
+	}
+	if err := WriteHistoryTailHash(batch, block.Hash()); err != nil {
+		return fmt.Errorf("failed to write history tail: %v", err)
+	}
+	if err := WriteCheckpointHash(batch, block.Hash()); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	bc.mu.Lock()
+	bc.insert(block)
+	bc.mu.Unlock()
+
+	log.Info("Committed checkpoint block", "number", block.Number(), "hash", block.Hash())
+	return nil
+}
+
+// HistoryTail retrieves the header of the oldest block with a known history if
+// the chain was synchronised from a checkpoint, or nil if the history down to
+// the genesis block is complete.
+func (bc *BlockChain) HistoryTail() *types.Header {
+	hash := GetHistoryTailHash(bc.chainDb)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return bc.GetHeaderByHash(hash)
+}
+
+// InsertHistory backfills the history preceding the history tail with a chain
+// of blocks and their receipts, which must end at the parent of the tail. The
+// blocks are assumed to be verified by the caller.
+func (bc *BlockChain) InsertHistory(blockChain types.Blocks, receiptChain []types.Receipts) error {
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+
+	if len(blockChain) == 0 {
+		return nil
+	}
+	tail := bc.HistoryTail()
+	if tail == nil {
+		return errors.New("chain history already complete")
+	}
+	for i := 1; i < len(blockChain); i++ {
+		if blockChain[i].NumberU64() != blockChain[i-1].NumberU64()+1 || blockChain[i].ParentHash() != blockChain[i-1].Hash() {
+			return fmt.Errorf("non contiguous insert: item %d is #%d [%x…], item %d is #%d [%x…] (parent [%x…])", i-1, blockChain[i-1].NumberU64(),
+				blockChain[i-1].Hash().Bytes()[:4], i, blockChain[i].NumberU64(), blockChain[i].Hash().Bytes()[:4], blockChain[i].ParentHash().Bytes()[:4])
+		}
+	}
+	head, first := blockChain[len(blockChain)-1], blockChain[0]
+	if head.Hash() != tail.ParentHash {
+		return fmt.Errorf("history does not link to tail #%d [%x…]: have #%d [%x…]", tail.Number, tail.Hash().Bytes()[:4], head.Number(), head.Hash().Bytes()[:4])
+	}
+	if first.NumberU64() == 1 && first.ParentHash() != bc.genesisBlock.Hash() {
+		return fmt.Errorf("history does not link to genesis: have parent [%x…]", first.ParentHash().Bytes()[:4])
+	}
+	batch := bc.chainDb.NewBatch()
+	for i, block := range blockChain {
+		SetReceiptsData(bc.config, block, receiptChain[i])
+
+		if err := WriteBlock(batch, block); err != nil {
+			return fmt.Errorf("failed to write block: %v", err)
+		}
+		if err := WriteBlockReceipts(batch, block.Hash(), block.NumberU64(), receiptChain[i]); err != nil {
+			return fmt.Errorf("failed to write block receipts: %v", err)
+		}
+		if err := WriteCanonicalHash(batch, block.Hash(), block.NumberU64()); err != nil {
+			return fmt.Errorf("failed to write canonical hash: %v", err)
+		}
+		if err := WriteTxLookupEntries(batch, block); err != nil {
+			return fmt.Errorf("failed to write lookup metadata: %v", err)
+		}
+	}
+	if err := WriteHistoryTailHash(batch, first.Hash()); err != nil {
+		return fmt.Errorf("failed to write history tail: %v", err)
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	if first.NumberU64() == 1 {
+		DeleteHistoryTailHash(bc.chainDb)
+		log.Info("Chain history complete")
+	}
+	log.Info("Imported historical blocks", "count", len(blockChain), "first", first.Number(), "last", head.Number())
+	return nil
+}
+
 // WriteBlock writes the block to the chain.
 func (bc *BlockChain) WriteBlockAndState(block *types.Block, receipts []*types.Receipt, state *state.StateDB) (status WriteStatus, err error) {
 	bc.wg.Add(1)
@@ -54,6 +54,12 @@ func (b *BlockGen) SetExtra(data []byte) {
 	b.header.Extra = data
 }
 
+// SetLastCommit sets the commit of the parent block carried by the
+// generated block.
+func (b *BlockGen) SetLastCommit(commit *types.Commit) {
+	b.lastCommit = commit
+}
+
 // AddTx adds a transaction to the generated block. If no coinbase has
 // been set, the block's coinbase is set to the zero address.
 //
@@ -31,6 +31,12 @@ var (
 	headBlockKey  = []byte("LastBlock")
 	headFastKey   = []byte("LastFast")
 
+	// historyTailKey tracks the oldest block with a body after a checkpoint sync.
+	historyTailKey = []byte("HistoryTail")
+
+	// checkpointKey tracks the block a checkpoint sync anchored the chain at.
+	checkpointKey = []byte("Checkpoint")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`).
 	headerPrefix        = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	tdSuffix            = []byte("t") // headerPrefix + num (uint64 big endian) + hash + tdSuffix -> td
@@ -129,6 +135,27 @@ func GetHeadFastBlockHash(db DatabaseReader) common.Hash {
 	return common.BytesToHash(data)
 }
 
+// GetHistoryTailHash retrieves the hash of the oldest block whose history was
+// retrieved, if the chain was synchronised from a checkpoint and the blocks
+// before it were not backfilled yet.
+func GetHistoryTailHash(db DatabaseReader) common.Hash {
+	data, _ := db.Get(historyTailKey)
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// GetCheckpointHash retrieves the hash of the block the chain was anchored at
+// by a checkpoint sync, if any.
+func GetCheckpointHash(db DatabaseReader) common.Hash {
+	data, _ := db.Get(checkpointKey)
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
 // GetHeaderRLP retrieves a block header in its raw RLP database encoding, or nil
 // if the header's not found.
 func GetHeaderRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
@@ -342,6 +369,23 @@ func WriteHeadFastBlockHash(db kusddb.Putter, hash common.Hash) error {
 	return nil
 }
 
+// WriteHistoryTailHash stores the hash of the oldest block with a known history.
+func WriteHistoryTailHash(db kusddb.Putter, hash common.Hash) error {
+	if err := db.Put(historyTailKey, hash.Bytes()); err != nil {
+		log.Crit("Failed to store history tail hash", "err", err)
+	}
+	return nil
+}
+
+// WriteCheckpointHash stores the hash of the block a checkpoint sync anchored
+// the chain at.
+func WriteCheckpointHash(db kusddb.Putter, hash common.Hash) error {
+	if err := db.Put(checkpointKey, hash.Bytes()); err != nil {
+		log.Crit("Failed to store checkpoint hash", "err", err)
+	}
+	return nil
+}
+
 // WriteHeader serializes a block header into the database.
 func WriteHeader(db kusddb.Putter, header *types.Header) error {
 	data, err := rlp.EncodeToBytes(header)
@@ -487,6 +531,12 @@ func DeleteTxLookupEntry(db DatabaseDeleter, hash common.Hash) {
 	db.Delete(append(lookupPrefix, hash.Bytes()...))
 }
 
+// DeleteHistoryTailHash removes the history tail marker once the chain history
+// is complete.
+func DeleteHistoryTailHash(db DatabaseDeleter) {
+	db.Delete(historyTailKey)
+}
+
 // PreimageTable returns a Database instance with the key prefix for preimage entries.
 func PreimageTable(db kusddb.Database) kusddb.Database {
 	return kusddb.NewTable(db, preimagePrefix)
@@ -270,6 +270,27 @@ func TestHeadStorage(t *testing.T) {
 	}
 }
 
+// Tests that the history tail of a checkpoint synced chain can be stored and removed.
+func TestHistoryTailStorage(t *testing.T) {
+	db, _ := kusddb.NewMemDatabase()
+
+	block := types.NewBlockWithHeader(&types.Header{Extra: []byte("test block checkpoint")})
+
+	if entry := GetHistoryTailHash(db); entry != (common.Hash{}) {
+		t.Fatalf("Non history tail entry returned: %v", entry)
+	}
+	if err := WriteHistoryTailHash(db, block.Hash()); err != nil {
+		t.Fatalf("Failed to write history tail hash: %v", err)
+	}
+	if entry := GetHistoryTailHash(db); entry != block.Hash() {
+		t.Fatalf("History tail hash mismatch: have %v, want %v", entry, block.Hash())
+	}
+	DeleteHistoryTailHash(db)
+	if entry := GetHistoryTailHash(db); entry != (common.Hash{}) {
+		t.Fatalf("Deleted history tail returned: %v", entry)
+	}
+}
+
 // Tests that positional lookup metadata can be stored and retrieved.
 func TestLookupStorage(t *testing.T) {
 	db, _ := kusddb.NewMemDatabase()
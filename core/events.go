@@ -23,9 +23,12 @@ type NewBlockFragmentEvent struct {
 	Data        *types.BlockFragment
 }
 
-// NewMajorityEvent is posted when there's a majority during a sub election
+// NewMajorityEvent is posted when a 2/3 majority of the validators voted for
+// the same block (or nil) in a sub election
 type NewMajorityEvent struct {
-	winner common.Hash
+	BlockNumber *big.Int
+	Round       uint64
+	Type        types.VoteType
 }
 
 // PendingLogsEvent is posted pre mining and notifies of pending logs.
@@ -0,0 +1,117 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/rlp"
+	"github.com/kowala-tech/kUSD/trie"
+)
+
+var (
+	errUnknownAccount = errors.New("unknown account")
+
+	// maxHash is the last hash of the key space, limiting ranges to the end of a trie.
+	maxHash = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+)
+
+// RangeProver serves the accounts and storage slots of a state to remote peers
+// in contiguous ranges of hashed keys, together with the merkle proofs of the
+// range edges. It reads the ranges by iterating the state tries directly, so
+// serving a range costs a trie traversal rather than a flat database scan.
+//
+// RangeProver is not safe for concurrent use.
+type RangeProver struct {
+	db       trie.Database
+	accounts *trie.Trie
+}
+
+// NewRangeProver opens the account trie of the state with the given root.
+func NewRangeProver(root common.Hash, db trie.Database) (*RangeProver, error) {
+	tr, err := trie.New(root, db)
+	if err != nil {
+		return nil, err
+	}
+	return &RangeProver{db: db, accounts: tr}, nil
+}
+
+// AccountRange retrieves the RLP encoded accounts with hashes starting at
+// origin, until roughly maxBytes of data is gathered or the first account past
+// limit is reached. The returned proof contains the nodes proving the origin
+// and the last account of the range.
+func (p *RangeProver) AccountRange(origin, limit common.Hash, maxBytes uint64) ([]common.Hash, [][]byte, [][]byte, error) {
+	return trieRange(p.accounts, origin, limit, maxBytes)
+}
+
+// StorageRange retrieves the storage slots of the account with the given hash,
+// starting at origin, until roughly maxBytes of data is gathered. The returned
+// proof contains the nodes proving the origin and the last slot of the range.
+func (p *RangeProver) StorageRange(account, origin common.Hash, maxBytes uint64) ([]common.Hash, [][]byte, [][]byte, error) {
+	enc, err := p.accounts.TryGet(account[:])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(enc) == 0 {
+		return nil, nil, nil, errUnknownAccount
+	}
+	var data Account
+	if err := rlp.DecodeBytes(enc, &data); err != nil {
+		return nil, nil, nil, err
+	}
+	tr, err := trie.New(data.Root, p.db)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return trieRange(tr, origin, maxHash, maxBytes)
+}
+
+// trieRange iterates the leaves of a trie starting at origin, collecting them
+// along with the proofs of the range edges. The first leaf past limit is still
+// included, proving that no other leaf lies between limit and the range end.
+func trieRange(tr *trie.Trie, origin, limit common.Hash, maxBytes uint64) ([]common.Hash, [][]byte, [][]byte, error) {
+	var (
+		keys   []common.Hash
+		values [][]byte
+		size   uint64
+	)
+	it := trie.NewIterator(tr.NodeIterator(origin[:]))
+	for size < maxBytes && it.Next() {
+		keys = append(keys, common.BytesToHash(it.Key))
+		values = append(values, common.CopyBytes(it.Value))
+		size += uint64(common.HashLength + len(it.Value))
+
+		if bytes.Compare(it.Key, limit[:]) > 0 {
+			break
+		}
+	}
+	if it.Err != nil {
+		return nil, nil, nil, it.Err
+	}
+	proof := new(proofList)
+	if err := tr.Prove(origin[:], 0, proof); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(keys) > 0 {
+		if err := tr.Prove(keys[len(keys)-1][:], 0, proof); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return keys, values, proof.nodes, nil
+}
+
+// proofList collects the nodes of merkle proofs, skipping the ones shared
+// between several proofs.
+type proofList struct {
+	nodes [][]byte
+}
+
+func (l *proofList) Put(key []byte, value []byte) error {
+	for _, node := range l.nodes {
+		if bytes.Equal(node, value) {
+			return nil
+		}
+	}
+	l.nodes = append(l.nodes, value)
+	return nil
+}
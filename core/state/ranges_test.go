@@ -0,0 +1,122 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/kusddb"
+	"github.com/kowala-tech/kUSD/trie"
+)
+
+// verifyRange checks a range retrieved from a range prover against the trie root,
+// returning whether more entries are available.
+func verifyRange(t *testing.T, root, origin common.Hash, keys []common.Hash, values [][]byte, proof [][]byte) bool {
+	proofDb, _ := kusddb.NewMemDatabase()
+	for _, node := range proof {
+		proofDb.Put(crypto.Keccak256(node), node)
+	}
+	last := origin[:]
+	if len(keys) > 0 && keys[len(keys)-1] != origin {
+		last = keys[len(keys)-1][:]
+	}
+	raw := make([][]byte, len(keys))
+	for i, key := range keys {
+		raw[i] = common.CopyBytes(key[:])
+	}
+	more, err := trie.VerifyRangeProof(root, origin[:], last, raw, values, proofDb)
+	if err != nil {
+		t.Fatalf("range at %x failed to verify: %v", origin, err)
+	}
+	return more
+}
+
+// Tests that the accounts of a state can be retrieved in verifiable ranges.
+func TestAccountRange(t *testing.T) {
+	_, mem, root, accounts := makeTestState()
+
+	prover, err := NewRangeProver(root, mem)
+	if err != nil {
+		t.Fatalf("failed to open range prover: %v", err)
+	}
+	var (
+		origin common.Hash
+		count  int
+	)
+	for {
+		keys, values, proof, err := prover.AccountRange(origin, maxHash, 200)
+		if err != nil {
+			t.Fatalf("failed to retrieve account range: %v", err)
+		}
+		count += len(keys)
+		if !verifyRange(t, root, origin, keys, values, proof) {
+			break
+		}
+		origin = common.BigToHash(new(big.Int).Add(keys[len(keys)-1].Big(), common.Big1))
+	}
+	if count != len(accounts) {
+		t.Errorf("account count mismatch: have %d, want %d", count, len(accounts))
+	}
+}
+
+// Tests that an account range stops at the first account past its limit, which
+// is included to prove the range edge.
+func TestAccountRangeLimit(t *testing.T) {
+	_, mem, root, _ := makeTestState()
+
+	prover, err := NewRangeProver(root, mem)
+	if err != nil {
+		t.Fatalf("failed to open range prover: %v", err)
+	}
+	all, _, _, err := prover.AccountRange(common.Hash{}, maxHash, 1<<20)
+	if err != nil {
+		t.Fatalf("failed to retrieve account range: %v", err)
+	}
+	limit := all[len(all)/2]
+	keys, values, proof, err := prover.AccountRange(common.Hash{}, limit, 1<<20)
+	if err != nil {
+		t.Fatalf("failed to retrieve account range: %v", err)
+	}
+	if len(keys) != len(all)/2+2 {
+		t.Fatalf("account count mismatch: have %d, want %d", len(keys), len(all)/2+2)
+	}
+	if keys[len(keys)-1] != all[len(all)/2+1] {
+		t.Errorf("last account mismatch: have %x, want %x", keys[len(keys)-1], all[len(all)/2+1])
+	}
+	if !verifyRange(t, root, common.Hash{}, keys, values, proof) {
+		t.Errorf("no more accounts reported past the limit")
+	}
+}
+
+// Tests that the storage slots of an account can be retrieved in verifiable ranges.
+func TestStorageRange(t *testing.T) {
+	mem, _ := kusddb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(mem))
+
+	address := common.BytesToAddress([]byte{1})
+	for i := byte(1); i <= 50; i++ {
+		state.SetState(address, common.BytesToHash([]byte{i}), common.BytesToHash([]byte{i, i}))
+	}
+	root, _ := state.CommitTo(mem, false)
+	storageRoot := state.StorageTrie(address).Hash()
+
+	prover, err := NewRangeProver(root, mem)
+	if err != nil {
+		t.Fatalf("failed to open range prover: %v", err)
+	}
+	account := crypto.Keccak256Hash(address[:])
+	keys, values, proof, err := prover.StorageRange(account, common.Hash{}, 4096)
+	if err != nil {
+		t.Fatalf("failed to retrieve storage range: %v", err)
+	}
+	if len(keys) != 50 {
+		t.Errorf("slot count mismatch: have %d, want %d", len(keys), 50)
+	}
+	if verifyRange(t, storageRoot, common.Hash{}, keys, values, proof) {
+		t.Errorf("more slots reported past the full range")
+	}
+	if _, _, _, err := prover.StorageRange(common.Hash{1}, common.Hash{}, 1024); err != errUnknownAccount {
+		t.Errorf("unknown account error mismatch: have %v, want %v", err, errUnknownAccount)
+	}
+}
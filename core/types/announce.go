@@ -0,0 +1,98 @@
+package types
+
+import (
+	"io"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/rlp"
+)
+
+// Announce represents the announcement of a validator, binding its address to
+// the node it runs on. Announcements are relayed across the network so that
+// nodes not directly connected to the validator (e.g. when hidden behind
+// sentries) learn a route towards it.
+type Announce struct {
+	data announcedata
+
+	// cache
+	hash atomic.Value
+	from atomic.Value
+}
+
+type announcedata struct {
+	Address   common.Address // Address of the announced validator
+	Node      [64]byte       // ID of the node the validator runs on, zero if hidden behind sentries
+	Timestamp uint64         // Unix time of the announcement, to discard stale ones
+
+	// signature values
+	V *big.Int
+	R *big.Int
+	S *big.Int
+}
+
+// NewAnnounce returns a new validator announcement
+func NewAnnounce(address common.Address, node [64]byte, timestamp uint64) *Announce {
+	return &Announce{data: announcedata{
+		Address:   address,
+		Node:      node,
+		Timestamp: timestamp,
+		V:         new(big.Int),
+		R:         new(big.Int),
+		S:         new(big.Int),
+	}}
+}
+
+// EncodeRLP implements rlp.Encoder
+func (announce *Announce) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, &announce.data)
+}
+
+// DecodeRLP implements rlp.Decoder
+func (announce *Announce) DecodeRLP(s *rlp.Stream) error {
+	return s.Decode(&announce.data)
+}
+
+func (announce *Announce) Address() common.Address { return announce.data.Address }
+func (announce *Announce) Node() [64]byte          { return announce.data.Node }
+func (announce *Announce) Timestamp() uint64       { return announce.data.Timestamp }
+func (announce *Announce) RawSignatureValues() (*big.Int, *big.Int, *big.Int) {
+	return announce.data.R, announce.data.S, announce.data.V
+}
+
+// Hash hashes the RLP encoding of the announcement.
+// It uniquely identifies the announcement.
+func (announce *Announce) Hash() common.Hash {
+	if hash := announce.hash.Load(); hash != nil {
+		return hash.(common.Hash)
+	}
+	v := rlpHash(announce)
+	announce.hash.Store(v)
+	return v
+}
+
+// ProtectedHash returns the hash to be signed by the validator.
+// It does not uniquely identify the announcement.
+func (announce *Announce) ProtectedHash(chainID *big.Int) common.Hash {
+	return rlpHash([]interface{}{
+		announce.data.Address,
+		announce.data.Node,
+		announce.data.Timestamp,
+		chainID, uint(0), uint(0),
+	})
+}
+
+// WithSignature returns a new announcement with the given signature.
+// This signature needs to be formatted as described in the yellow paper (v+27).
+func (announce *Announce) WithSignature(signer Signer, sig []byte) (*Announce, error) {
+	r, s, v, err := signer.SignatureValues(sig)
+	if err != nil {
+		return nil, err
+	}
+
+	cpy := &Announce{data: announce.data}
+	cpy.data.R, cpy.data.S, cpy.data.V = r, s, v
+
+	return cpy, nil
+}
@@ -115,7 +115,7 @@ func (cmt *Commit) Round() uint64 {
 // Body is a simple (mutable, non-safe) data container for storing and moving
 // a block's data contents (transactions) together.
 type Body struct {
-	LastCommit   *Commit
+	LastCommit   *Commit `rlp:"nil"` // nil for the first block, the genesis not being committed
 	Transactions []*Transaction
 }
 
@@ -138,7 +138,7 @@ type Block struct {
 // "external" block encoding. used for kusd protocol, etc.
 type extblock struct {
 	Header     *Header
-	LastCommit *Commit
+	LastCommit *Commit `rlp:"nil"`
 	Txs        []*Transaction
 }
 
@@ -320,11 +320,7 @@ func (b *Block) WithBody(transactions []*Transaction, lastCommit *Commit) *Block
 	block := &Block{
 		header:       CopyHeader(b.header),
 		transactions: make([]*Transaction, len(transactions)),
-		lastCommit:   &Commit{},
-	}
-
-	if lastCommit != nil {
-		block.lastCommit = lastCommit
+		lastCommit:   lastCommit,
 	}
 
 	copy(block.transactions, transactions)
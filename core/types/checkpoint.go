@@ -0,0 +1,147 @@
+package types
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/kowala-tech/kUSD/common"
+)
+
+var (
+	// ErrMissingCheckpointCommit is returned if a checkpoint is verified without
+	// the commit of its block.
+	ErrMissingCheckpointCommit = errors.New("checkpoint commit missing")
+
+	// ErrCheckpointCommitMismatch is returned if the commit of a checkpoint
+	// doesn't belong to the child of the checkpoint block.
+	ErrCheckpointCommitMismatch = errors.New("checkpoint commit mismatch")
+
+	// ErrCheckpointValidatorsMismatch is returned if the validators carried by a
+	// checkpoint differ from the ones registered in the checkpoint state.
+	ErrCheckpointValidatorsMismatch = errors.New("checkpoint validators mismatch")
+)
+
+// Checkpoint is a trusted block of the chain from which a node can synchronise
+// without processing the history before it, since committed blocks are final.
+//
+// The finality of the block is proven by the commit of its child, signed by the
+// validators registered in the state of the checkpoint block. The state being
+// authenticated by the checkpoint hash, so is the validator set loaded from it
+// once synchronised. A checkpoint file carries the set and the commit as well,
+// so that a commit can be rejected before the state is retrieved; if missing,
+// the commit is retrieved from the network along with the blocks.
+type Checkpoint struct {
+	Number     uint64                 `json:"number"`
+	Hash       common.Hash            `json:"hash"`
+	Validators []*CheckpointValidator `json:"validators,omitempty"`
+	Commit     *Commit                `json:"commit,omitempty"`
+}
+
+// CheckpointValidator is a member of the validator set committing the child of
+// a checkpoint block.
+type CheckpointValidator struct {
+	Address   common.Address   `json:"address"`
+	Deposit   uint64           `json:"deposit"`
+	Signers   []common.Address `json:"signers"`
+	Threshold int              `json:"threshold"`
+}
+
+// NewCheckpoint returns the checkpoint of a block, carrying the validator set
+// registered in its state and the commit of its child.
+func NewCheckpoint(block *Block, validators *ValidatorSet, commit *Commit) *Checkpoint {
+	cp := &Checkpoint{
+		Number:     block.NumberU64(),
+		Hash:       block.Hash(),
+		Validators: make([]*CheckpointValidator, validators.Size()),
+		Commit:     commit,
+	}
+	for i := range cp.Validators {
+		val := validators.AtIndex(i)
+		cp.Validators[i] = &CheckpointValidator{
+			Address:   val.Address(),
+			Deposit:   val.Deposit(),
+			Signers:   val.Signers(),
+			Threshold: val.Threshold(),
+		}
+	}
+	return cp
+}
+
+// ParseCheckpoint parses a checkpoint given as <number>:<hash>.
+func ParseCheckpoint(s string) (*Checkpoint, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid checkpoint %q, want <number>:<hash>", s)
+	}
+	number, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint number %q: %v", parts[0], err)
+	}
+	hash, err := hex.DecodeString(strings.TrimPrefix(parts[1], "0x"))
+	if err != nil || len(hash) != common.HashLength {
+		return nil, fmt.Errorf("invalid checkpoint hash %q", parts[1])
+	}
+	return &Checkpoint{Number: number, Hash: common.BytesToHash(hash)}, nil
+}
+
+// String implements the stringer interface, returning the checkpoint in the
+// format accepted by ParseCheckpoint.
+func (cp *Checkpoint) String() string {
+	return fmt.Sprintf("%d:%s", cp.Number, cp.Hash.Hex())
+}
+
+// ValidatorSet returns the validator set carried by the checkpoint, nil if it
+// carries none.
+func (cp *Checkpoint) ValidatorSet() (*ValidatorSet, error) {
+	if len(cp.Validators) == 0 {
+		return nil, nil
+	}
+	validators := make([]*Validator, len(cp.Validators))
+	for i, val := range cp.Validators {
+		validators[i] = NewMultisigValidator(val.Address, val.Deposit, new(big.Int), val.Signers, val.Threshold)
+	}
+	return NewValidatorSet(validators)
+}
+
+// Verify checks that the commit of the checkpoint finalised child, the child of
+// the checkpoint block, being signed by a 2/3 majority of the validator set
+// registered in the checkpoint state. If the checkpoint carries validators, they
+// must match the given set.
+func (cp *Checkpoint) Verify(signer Signer, validators *ValidatorSet, child *Header) error {
+	if cp.Commit == nil || cp.Commit.First() == nil {
+		return ErrMissingCheckpointCommit
+	}
+	if child.ParentHash != cp.Hash || !child.Number.IsUint64() || child.Number.Uint64() != cp.Number+1 {
+		return ErrCheckpointCommitMismatch
+	}
+	if number := cp.Commit.First().BlockNumber(); number == nil || number.Cmp(child.Number) != 0 {
+		return ErrCheckpointCommitMismatch
+	}
+	if len(cp.Validators) > 0 && !cp.carries(validators) {
+		return ErrCheckpointValidatorsMismatch
+	}
+	return validators.VerifyCommit(signer, child.Hash(), cp.Commit)
+}
+
+// carries reports whether the checkpoint carries the given validator set.
+func (cp *Checkpoint) carries(validators *ValidatorSet) bool {
+	if len(cp.Validators) != validators.Size() {
+		return false
+	}
+	for i, want := range cp.Validators {
+		have := validators.AtIndex(i)
+		if have.Address() != want.Address || have.Deposit() != want.Deposit || have.Threshold() != want.Threshold || len(have.Signers()) != len(want.Signers) {
+			return false
+		}
+		for j, signer := range have.Signers() {
+			if signer != want.Signers[j] {
+				return false
+			}
+		}
+	}
+	return true
+}
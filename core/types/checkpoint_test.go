@@ -0,0 +1,92 @@
+package types
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/crypto"
+)
+
+func TestParseCheckpoint(t *testing.T) {
+	hash := common.HexToHash("0x7b66506a9ebdbf30d32b43c5f15a3b1216269a1ec3a75aa3182b86176a2b1ca7")
+
+	cp, err := ParseCheckpoint("1024:" + hash.Hex())
+	if err != nil {
+		t.Fatalf("failed to parse checkpoint: %v", err)
+	}
+	if cp.Number != 1024 || cp.Hash != hash {
+		t.Errorf("checkpoint mismatch: have %v, want %d:%x", cp, 1024, hash)
+	}
+	if have, err := ParseCheckpoint(cp.String()); err != nil || have.Number != cp.Number || have.Hash != cp.Hash {
+		t.Errorf("checkpoint string not reversible: have %v, %v", have, err)
+	}
+	for _, invalid := range []string{"", "1024", "x:" + hash.Hex(), "1024:0x1234", "1024:" + hash.Hex()[:64] + "zz"} {
+		if _, err := ParseCheckpoint(invalid); err == nil {
+			t.Errorf("invalid checkpoint %q accepted", invalid)
+		}
+	}
+}
+
+// Tests that checkpoints are only accepted if their child is finalised by the
+// validator set of the checkpoint state.
+func TestVerifyCheckpoint(t *testing.T) {
+	signer := NewAndromedaSigner(big.NewInt(1))
+
+	key, _ := crypto.GenerateKey()
+	set, err := NewValidatorSet([]*Validator{NewValidator(crypto.PubkeyToAddress(key.PublicKey), 100, big.NewInt(0))})
+	if err != nil {
+		t.Fatalf("failed to create validator set: %v", err)
+	}
+
+	block := NewBlockWithHeader(&Header{Number: big.NewInt(5)})
+	child := &Header{Number: big.NewInt(6), ParentHash: block.Hash()}
+
+	cp := NewCheckpoint(block, set, nil)
+	if err := cp.Verify(signer, set, child); err != ErrMissingCheckpointCommit {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrMissingCheckpointCommit)
+	}
+	precommit := func(number int64, hash common.Hash) *Commit {
+		vote, err := SignVote(NewVote(big.NewInt(number), hash, 0, PreCommit), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign vote: %v", err)
+		}
+		return &Commit{PreCommits: Votes{vote}, FirstPreCommit: vote}
+	}
+	cp.Commit = precommit(5, cp.Hash)
+	if err := cp.Verify(signer, set, child); err != ErrCheckpointCommitMismatch {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrCheckpointCommitMismatch)
+	}
+	cp.Commit = precommit(6, child.Hash())
+	if err := cp.Verify(signer, set, &Header{Number: big.NewInt(6)}); err != ErrCheckpointCommitMismatch {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrCheckpointCommitMismatch)
+	}
+	if err := cp.Verify(signer, set, child); err != nil {
+		t.Fatalf("valid checkpoint rejected: %v", err)
+	}
+	// The validators carried must match the ones of the checkpoint state
+	other, err := NewValidatorSet([]*Validator{NewMultisigValidator(crypto.PubkeyToAddress(key.PublicKey), 100, big.NewInt(0), []common.Address{crypto.PubkeyToAddress(key.PublicKey)}, 2)})
+	if err != nil {
+		t.Fatalf("failed to create validator set: %v", err)
+	}
+	if err := cp.Verify(signer, other, child); err != ErrCheckpointValidatorsMismatch {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrCheckpointValidatorsMismatch)
+	}
+	// Checkpoint files must survive a JSON round trip
+	enc, err := json.Marshal(cp)
+	if err != nil {
+		t.Fatalf("failed to encode checkpoint: %v", err)
+	}
+	dec := new(Checkpoint)
+	if err := json.Unmarshal(enc, dec); err != nil {
+		t.Fatalf("failed to decode checkpoint: %v", err)
+	}
+	decSet, err := dec.ValidatorSet()
+	if err != nil {
+		t.Fatalf("failed to restore validator set: %v", err)
+	}
+	if err := dec.Verify(signer, decSet, child); err != nil {
+		t.Errorf("decoded checkpoint rejected: %v", err)
+	}
+}
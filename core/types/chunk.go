@@ -132,14 +132,40 @@ func (ds *DataSet) Get(i int) *Chunk {
 }
 
 func (ds *DataSet) Add(chunk *Chunk) {
-	// @TODO (rgeraldes) - validate index
 	// @TODO (rgeraldes) - check hash proof
+	if chunk.Index >= uint64(len(ds.data)) {
+		return
+	}
+	ds.dataMu.Lock()
+	defer ds.dataMu.Unlock()
+
+	if ds.data[chunk.Index] != nil {
+		return
+	}
 	ds.data[chunk.Index] = chunk
 	// @TODO (rgeraldes) - review int vs uint64
 	ds.membership.Set(int(chunk.Index))
 	ds.count++
 }
 
+// Membership returns a copy of the bit array of the data chunks present
+func (ds *DataSet) Membership() *common.BitArray {
+	return ds.membership.Copy()
+}
+
+// Missing returns the data chunks present in the set but not in the given
+// membership bit array.
+func (ds *DataSet) Missing(membership *common.BitArray) []*Chunk {
+	ds.dataMu.Lock()
+	defer ds.dataMu.Unlock()
+
+	var chunks []*Chunk
+	for _, i := range ds.membership.Sub(membership).Indexes() {
+		chunks = append(chunks, ds.data[i])
+	}
+	return chunks
+}
+
 func (ds *DataSet) HasAll() bool {
 	return ds.count == ds.meta.NChunks
 }
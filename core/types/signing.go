@@ -79,6 +79,18 @@ func SignVote(vote *Vote, signer Signer, prv *ecdsa.PrivateKey) (*Vote, error) {
 	return vote.WithSignature(signer, sig)
 }
 
+// SignAnnounce signs the validator announcement using the given signer and
+// private key
+func SignAnnounce(announce *Announce, signer Signer, prv *ecdsa.PrivateKey) (*Announce, error) {
+	h := announce.ProtectedHash(signer.ChainID())
+	sig, err := crypto.Sign(h[:], prv)
+	if err != nil {
+		return nil, err
+	}
+
+	return announce.WithSignature(signer, sig)
+}
+
 func TxSender(signer Signer, tx *Transaction) (common.Address, error) {
 	if sc := tx.from.Load(); sc != nil {
 		sigCache := sc.(sigCache)
@@ -157,6 +169,29 @@ func VoteSender(signer Signer, vote *Vote) (common.Address, error) {
 	return addr, nil
 }
 
+func AnnounceSender(signer Signer, announce *Announce) (common.Address, error) {
+	if sc := announce.from.Load(); sc != nil {
+		sigCache := sc.(sigCache)
+		// If the signer used to derive from in a previous
+		// call is not the same as used current, invalidate
+		// the cache.
+		if sigCache.signer.Equal(signer) {
+			return sigCache.from, nil
+		}
+	}
+
+	V := new(big.Int).Sub(announce.data.V, signer.ChainIDMul())
+	V.Sub(V, big8)
+	addr, err := signer.Sender(announce.ProtectedHash(signer.ChainID()), announce.data.R, announce.data.S, V)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	announce.from.Store(sigCache{signer: signer, from: addr})
+
+	return addr, nil
+}
+
 type Signer interface {
 	// PubilcKey returns the public key derived from the signature
 	Sender(hash common.Hash, R, S, V *big.Int) (common.Address, error)
@@ -2,30 +2,68 @@ package types
 
 import (
 	"container/heap"
+	"errors"
 	"math/big"
 
 	"github.com/kowala-tech/kUSD/common"
 )
 
+var (
+	// ErrUnknownSigner is returned if a consensus message is signed by a key that
+	// doesn't belong to any validator of the set.
+	ErrUnknownSigner = errors.New("signer is not a validator key")
+
+	// ErrInvalidCommitVote is returned if a commit contains a vote that doesn't
+	// pre-commit the committed block.
+	ErrInvalidCommitVote = errors.New("invalid commit vote")
+
+	// ErrInsufficientCommit is returned if a commit doesn't gather the votes of
+	// a 2/3 majority of the validators.
+	ErrInsufficientCommit = errors.New("insufficient commit votes")
+
+	// ErrDuplicateSigner is returned if a key signs for more than one validator,
+	// or for a validator other than the one it is the address of.
+	ErrDuplicateSigner = errors.New("duplicate validator signer")
+)
+
 // Validator represents a consensus validator
 type Validator struct {
 	address common.Address
 	deposit uint64
 	weight  *big.Int
+
+	signers   []common.Address // keys signing consensus messages for the validator
+	threshold int              // number of signers required for a message to count
 }
 
 // NewValidator returns a new validator instance
 func NewValidator(address common.Address, deposit uint64, weight *big.Int) *Validator {
 	return &Validator{
-		address: address,
-		deposit: deposit,
-		weight:  weight,
+		address:   address,
+		deposit:   deposit,
+		weight:    weight,
+		signers:   []common.Address{address},
+		threshold: 1,
 	}
 }
 
-func (val *Validator) Address() common.Address { return val.address }
-func (val *Validator) Deposit() uint64         { return val.deposit }
-func (val *Validator) Weight() *big.Int        { return val.weight }
+// NewMultisigValidator returns a new validator instance whose votes and
+// proposals only count once threshold of the given signers signed them.
+func NewMultisigValidator(address common.Address, deposit uint64, weight *big.Int, signers []common.Address, threshold int) *Validator {
+	return &Validator{
+		address:   address,
+		deposit:   deposit,
+		weight:    weight,
+		signers:   signers,
+		threshold: threshold,
+	}
+}
+
+func (val *Validator) Address() common.Address   { return val.address }
+func (val *Validator) Deposit() uint64           { return val.deposit }
+func (val *Validator) Weight() *big.Int          { return val.weight }
+func (val *Validator) Signers() []common.Address { return val.signers }
+func (val *Validator) Threshold() int            { return val.threshold }
 
 type ValidatorSet struct {
 	validators []*Validator
@@ -33,20 +71,35 @@ type ValidatorSet struct {
 
 	//cache
 	membership map[common.Address]*Validator
+	signers    map[common.Address]*Validator
 }
 
+// NewValidatorSet creates a validator set, failing if a key signs for more than
+// one validator, as its messages could not be told apart.
 // @TODO (rgeraldes) - size needs to be > 0
-func NewValidatorSet(validators []*Validator) *ValidatorSet {
+func NewValidatorSet(validators []*Validator) (*ValidatorSet, error) {
 	set := &ValidatorSet{
 		validators: validators,
 		membership: make(map[common.Address]*Validator, len(validators)),
+		signers:    make(map[common.Address]*Validator, len(validators)),
 	}
 
 	for _, validator := range validators {
 		set.membership[validator.address] = validator
 	}
+	for _, validator := range validators {
+		for _, signer := range validator.signers {
+			if _, ok := set.signers[signer]; ok {
+				return nil, ErrDuplicateSigner
+			}
+			if owner, ok := set.membership[signer]; ok && owner != validator {
+				return nil, ErrDuplicateSigner
+			}
+			set.signers[signer] = validator
+		}
+	}
 
-	return set
+	return set, nil
 }
 
 // Update updates the weight and the proposer based on the set of validators
@@ -87,3 +140,59 @@ func (set *ValidatorSet) Contains(addr common.Address) bool {
 	_, ok := set.membership[addr]
 	return ok
 }
+
+// GetBySigner returns the validator the given key signs for, nil if the key
+// doesn't belong to any validator.
+func (set *ValidatorSet) GetBySigner(signer common.Address) *Validator {
+	return set.signers[signer]
+}
+
+// Quorum returns the number of validators that make up a 2/3 majority.
+func (set *ValidatorSet) Quorum() int {
+	return set.Size()*2/3 + 1
+}
+
+// VerifyCommit checks that commit carries the pre-commits for blockHash of a
+// 2/3 majority of the validators. The vote of a multisig validator only counts
+// if its threshold of signers pre-committed.
+func (set *ValidatorSet) VerifyCommit(signer Signer, blockHash common.Hash, commit *Commit) error {
+	first := commit.First()
+	if first == nil {
+		return ErrInsufficientCommit
+	}
+	if first.Type() != PreCommit || first.BlockHash() != blockHash {
+		return ErrInvalidCommitVote
+	}
+	signatures := make(map[common.Address]map[common.Address]struct{})
+	for _, vote := range commit.Commits() {
+		if vote == nil {
+			continue
+		}
+		if vote.Type() != PreCommit || vote.BlockHash() != blockHash ||
+			vote.BlockNumber().Cmp(first.BlockNumber()) != 0 || vote.Round() != first.Round() {
+			return ErrInvalidCommitVote
+		}
+		from, err := VoteSender(signer, vote)
+		if err != nil {
+			return err
+		}
+		validator := set.GetBySigner(from)
+		if validator == nil {
+			return ErrUnknownSigner
+		}
+		if signatures[validator.address] == nil {
+			signatures[validator.address] = make(map[common.Address]struct{})
+		}
+		signatures[validator.address][from] = struct{}{}
+	}
+	votes := 0
+	for address, signers := range signatures {
+		if len(signers) >= set.membership[address].threshold {
+			votes++
+		}
+	}
+	if votes < set.Quorum() {
+		return ErrInsufficientCommit
+	}
+	return nil
+}
@@ -1,3 +1,97 @@
 package types
 
-// @TODO (rgeraldes) - complete
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/crypto"
+)
+
+// Tests that the votes of multisig validators only count towards a commit once
+// their threshold of signer keys pre-committed.
+func TestVerifyMultisigCommit(t *testing.T) {
+	signer := NewAndromedaSigner(big.NewInt(1))
+
+	keys := make([]*ecdsa.PrivateKey, 4)
+	addrs := make([]common.Address, len(keys))
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	// A 2-of-3 multisig validator and a single key one
+	identity := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	set, err := NewValidatorSet([]*Validator{
+		NewMultisigValidator(identity, 100, big.NewInt(0), addrs[:3], 2),
+		NewValidator(addrs[3], 100, big.NewInt(0)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create validator set: %v", err)
+	}
+	if set.GetBySigner(addrs[1]).Address() != identity {
+		t.Fatalf("signer not mapped to its validator")
+	}
+	block := common.HexToHash("0xdeadbeef")
+	precommit := func(key *ecdsa.PrivateKey, hash common.Hash) *Vote {
+		vote, err := SignVote(NewVote(big.NewInt(1), hash, 0, PreCommit), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign vote: %v", err)
+		}
+		return vote
+	}
+	commit := func(votes ...*Vote) *Commit {
+		return &Commit{PreCommits: votes, FirstPreCommit: votes[0]}
+	}
+
+	tests := []struct {
+		commit *Commit
+		err    error
+	}{
+		// Only one of the multisig keys signed
+		{commit(precommit(keys[0], block), precommit(keys[3], block)), ErrInsufficientCommit},
+		// The same multisig key signed twice
+		{commit(precommit(keys[0], block), precommit(keys[0], block), precommit(keys[3], block)), ErrInsufficientCommit},
+		// Threshold of the multisig keys and the single key signed
+		{commit(precommit(keys[0], block), precommit(keys[2], block), precommit(keys[3], block)), nil},
+		// A key pre-committed a different block
+		{commit(precommit(keys[0], block), precommit(keys[1], common.Hash{}), precommit(keys[3], block)), ErrInvalidCommitVote},
+	}
+	for i, tt := range tests {
+		if err := set.VerifyCommit(signer, block, tt.commit); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// A key outside of the validator set signed
+	outsider, _ := crypto.GenerateKey()
+	if err := set.VerifyCommit(signer, block, commit(precommit(outsider, block))); err != ErrUnknownSigner {
+		t.Errorf("outsider error mismatch: have %v, want %v", err, ErrUnknownSigner)
+	}
+}
+
+// Tests that a validator set can't be created with a key signing for more than
+// one validator.
+func TestValidatorSetDuplicateSigners(t *testing.T) {
+	var (
+		a, b   = common.Address{0x0a}, common.Address{0x0b}
+		k1, k2 = common.Address{0x01}, common.Address{0x02}
+	)
+	tests := []struct {
+		validators []*Validator
+		err        error
+	}{
+		{[]*Validator{NewValidator(a, 100, new(big.Int)), NewMultisigValidator(b, 100, new(big.Int), []common.Address{k1, k2}, 2)}, nil},
+		// A key listed twice by the same validator
+		{[]*Validator{NewMultisigValidator(a, 100, new(big.Int), []common.Address{k1, k1}, 1)}, ErrDuplicateSigner},
+		// A key shared by two validators
+		{[]*Validator{NewMultisigValidator(a, 100, new(big.Int), []common.Address{k1}, 1), NewMultisigValidator(b, 100, new(big.Int), []common.Address{k1, k2}, 1)}, ErrDuplicateSigner},
+		// The address of another validator listed as signer
+		{[]*Validator{NewMultisigValidator(a, 100, new(big.Int), []common.Address{k1}, 1), NewMultisigValidator(b, 100, new(big.Int), []common.Address{a}, 1)}, ErrDuplicateSigner},
+		{[]*Validator{NewValidator(a, 100, new(big.Int)), NewMultisigValidator(b, 100, new(big.Int), []common.Address{k1, a}, 1)}, ErrDuplicateSigner},
+	}
+	for i, tt := range tests {
+		if _, err := NewValidatorSet(tt.validators); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
@@ -99,6 +99,21 @@ func (vote *Vote) DecodeRLP(s *rlp.Stream) error {
 	return err
 }
 
+// MarshalJSON encodes the web3 RPC vote format.
+func (vote *Vote) MarshalJSON() ([]byte, error) {
+	return vote.data.MarshalJSON()
+}
+
+// UnmarshalJSON decodes the web3 RPC vote format.
+func (vote *Vote) UnmarshalJSON(input []byte) error {
+	var dec votedata
+	if err := dec.UnmarshalJSON(input); err != nil {
+		return err
+	}
+	*vote = Vote{data: dec}
+	return nil
+}
+
 func (vote *Vote) BlockNumber() *big.Int  { return vote.data.BlockNumber }
 func (vote *Vote) BlockHash() common.Hash { return vote.data.BlockHash }
 func (vote *Vote) Round() uint64          { return vote.data.Round }
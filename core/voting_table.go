@@ -80,39 +80,50 @@ type VotingTable struct {
 	// events
 	eventMux *event.TypeMux
 
+	// signatures of the validator keys per validator index and block; the vote
+	// of a multisig validator only counts once its threshold of keys signed
+	signatures map[int]map[common.Hash]map[common.Address]*types.Vote
+
 	// cache
-	addressToIndex map[common.Address]int
+	signerToIndex map[common.Address]int
 
 	//maj23         *common.Hash  // First 2/3 majority seen
 	//peerMaj23s map[string]common.Hash // Maj23 for each peer
 }
 
-func NewVotingTable(eventMux *event.TypeMux, signer types.Signer, blockNumber *big.Int, round uint64, voteType types.VoteType, voters *types.ValidatorSet) *VotingTable {
+// NewVotingTable creates the table of the votes of the given type cast by the
+// voters in a round, failing if a key signs for more than one voter.
+func NewVotingTable(eventMux *event.TypeMux, signer types.Signer, blockNumber *big.Int, round uint64, voteType types.VoteType, voters *types.ValidatorSet) (*VotingTable, error) {
 	table := &VotingTable{
 		blockNumber:   blockNumber,
 		round:         round,
 		voteType:      voteType,
 		voters:        voters,
-		received:      common.NewBitArray(uint64(1 /*validators.Size()*/)), // @TODO (rgeraldes)
+		received:      common.NewBitArray(uint64(voters.Size())),
 		votes:         make([]*types.Vote, voters.Size()),
 		sum:           0,
 		all:           make(map[common.Hash]*types.Vote),
 		votesPerBlock: make(map[common.Hash]*Votes, voters.Size()),
 		eventMux:      eventMux,
 		signer:        signer,
-		// @TODO (rgeraldes) - replace with constants
-		quorum:         voters.Size()*2/3 + 1,
-		addressToIndex: make(map[common.Address]int, voters.Size()),
+		quorum:        voters.Quorum(),
+		signatures:    make(map[int]map[common.Hash]map[common.Address]*types.Vote),
+		signerToIndex: make(map[common.Address]int, voters.Size()),
 		//maj23:         nil,
 		//peerMaj23s:    make(map[string]BlockID),
 	}
 
-	// cache voter index
+	// cache voter index of each validator key
 	for i := 0; i < table.voters.Size(); i++ {
-		table.addressToIndex[table.voters.AtIndex(i).Address()] = i
+		for _, signer := range table.voters.AtIndex(i).Signers() {
+			if _, ok := table.signerToIndex[signer]; ok {
+				return nil, types.ErrDuplicateSigner
+			}
+			table.signerToIndex[signer] = i
+		}
 	}
 
-	return table
+	return table, nil
 }
 
 func (table *VotingTable) validateVote(vote *types.Vote, local bool) error {
@@ -160,8 +171,8 @@ func (table *VotingTable) validateVote(vote *types.Vote, local bool) error {
 }
 
 func (table *VotingTable) Add(vote *types.Vote, local bool) (bool, error) {
-	//table.lock.Lock()
-	//defer table.lock.Unlock()
+	table.mtx.Lock()
+	defer table.mtx.Unlock()
 
 	// If the vote is already known, discard it
 	hash := vote.Hash()
@@ -215,21 +226,43 @@ func (table *VotingTable) add(vote *types.Vote) (bool, error) {
 		return false, err
 	}
 
-	index, ok := table.addressToIndex[from]
+	index, ok := table.signerToIndex[from]
 	if !ok {
-		// @TODO (rgeraldes)
+		return false, types.ErrUnknownSigner
 	}
 
-	if vote := table.votes[index]; vote != nil {
+	if counted := table.votes[index]; counted != nil {
 		// @TODO (rgeraldes) - complete conflict code
-	} else {
-		table.votes[index] = vote
-		//table.received.Set(0)
-		table.sum++
+		return false, nil
 	}
 
-	if table.sum == table.quorum {
-		go table.eventMux.Post(NewMajorityEvent{})
+	// gather the signatures of the validator keys for the same block
+	perBlock, ok := table.signatures[index]
+	if !ok {
+		perBlock = make(map[common.Hash]map[common.Address]*types.Vote)
+		table.signatures[index] = perBlock
+	}
+	signers, ok := perBlock[vote.BlockHash()]
+	if !ok {
+		signers = make(map[common.Address]*types.Vote)
+		perBlock[vote.BlockHash()] = signers
+	}
+	if _, ok := signers[from]; ok {
+		return false, nil
+	}
+	signers[from] = vote
+
+	if len(signers) < table.voters.AtIndex(index).Threshold() {
+		return true, nil
+	}
+	table.votes[index] = vote
+	table.received.Set(index)
+	table.sum++
+
+	// the majority is reached once the votes for a single block do, a split
+	// vote lets the sub-election time out instead
+	if table.count(vote.BlockHash()) == table.quorum {
+		go table.eventMux.Post(NewMajorityEvent{BlockNumber: table.blockNumber, Round: table.round, Type: table.voteType})
 	}
 
 	/*
@@ -250,3 +283,81 @@ func (table *VotingTable) add(vote *types.Vote) (bool, error) {
 
 	return true, nil
 }
+
+// count returns the number of validators whose vote for blockHash counted.
+func (table *VotingTable) count(blockHash common.Hash) int {
+	count := 0
+	for _, vote := range table.votes {
+		if vote != nil && vote.BlockHash() == blockHash {
+			count++
+		}
+	}
+	return count
+}
+
+// Majority returns the block hash a 2/3 majority of the validators voted for,
+// false if there's none yet. The zero hash stands for a majority voting nil.
+func (table *VotingTable) Majority() (common.Hash, bool) {
+	table.mtx.Lock()
+	defer table.mtx.Unlock()
+
+	count := make(map[common.Hash]int)
+	for _, vote := range table.votes {
+		if vote == nil {
+			continue
+		}
+		count[vote.BlockHash()]++
+		if count[vote.BlockHash()] >= table.quorum {
+			return vote.BlockHash(), true
+		}
+	}
+	return common.Hash{}, false
+}
+
+// Signatures returns the votes of all the keys that signed for blockHash on
+// behalf of the validators whose vote counted, as required by a commit. The
+// votes are ordered by validator and signer key.
+func (table *VotingTable) Signatures(blockHash common.Hash) types.Votes {
+	table.mtx.Lock()
+	defer table.mtx.Unlock()
+
+	var votes types.Votes
+	for index, vote := range table.votes {
+		if vote == nil || vote.BlockHash() != blockHash {
+			continue
+		}
+		for _, signer := range table.voters.AtIndex(index).Signers() {
+			if signature, ok := table.signatures[index][blockHash][signer]; ok {
+				votes = append(votes, signature)
+			}
+		}
+	}
+	return votes
+}
+
+// Received returns a copy of the bit array of the validators whose vote counted.
+func (table *VotingTable) Received() *common.BitArray {
+	table.mtx.Lock()
+	defer table.mtx.Unlock()
+
+	return table.received.Copy()
+}
+
+// Missing returns the votes that counted locally of the validators not set in
+// the given bit array, including the signatures of all the keys of multisig
+// validators, so that a peer can catch up on the votes it lacks.
+func (table *VotingTable) Missing(received *common.BitArray) types.Votes {
+	table.mtx.Lock()
+	defer table.mtx.Unlock()
+
+	var votes types.Votes
+	for _, index := range table.received.Sub(received).Indexes() {
+		blockHash := table.votes[index].BlockHash()
+		for _, signer := range table.voters.AtIndex(index).Signers() {
+			if signature, ok := table.signatures[index][blockHash][signer]; ok {
+				votes = append(votes, signature)
+			}
+		}
+	}
+	return votes
+}
@@ -0,0 +1,921 @@
+// Package graphql provides a GraphQL interface to Kowala node data.
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/common/hexutil"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/state"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/internal/kusdapi"
+	"github.com/kowala-tech/kUSD/rpc"
+)
+
+// maxBlockRange is the maximum number of blocks a single query may span.
+const maxBlockRange = 1024
+
+var (
+	errMissingState  = errors.New("state not available")
+	errMissingBlock  = errors.New("block not found")
+	errInvalidRange  = errors.New("invalid block range")
+	errRangeTooLarge = fmt.Errorf("block range exceeds %d blocks", maxBlockRange)
+)
+
+// Account represents a Kowala account at a particular block.
+type Account struct {
+	backend     kusdapi.Backend
+	address     common.Address
+	blockNumber rpc.BlockNumber
+}
+
+// getState fetches the state the account is resolved at.
+func (a *Account) getState(ctx context.Context) (*state.StateDB, error) {
+	state, _, err := a.backend.StateAndHeaderByNumber(ctx, a.blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errMissingState
+	}
+	return state, nil
+}
+
+func (a *Account) Address(ctx context.Context) (common.Address, error) {
+	return a.address, nil
+}
+
+func (a *Account) Balance(ctx context.Context) (hexutil.Big, error) {
+	state, err := a.getState(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*state.GetBalance(a.address)), nil
+}
+
+func (a *Account) TransactionCount(ctx context.Context) (hexutil.Uint64, error) {
+	state, err := a.getState(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(state.GetNonce(a.address)), nil
+}
+
+func (a *Account) Code(ctx context.Context) (hexutil.Bytes, error) {
+	state, err := a.getState(ctx)
+	if err != nil {
+		return hexutil.Bytes{}, err
+	}
+	return hexutil.Bytes(state.GetCode(a.address)), nil
+}
+
+func (a *Account) Storage(ctx context.Context, args struct{ Slot common.Hash }) (common.Hash, error) {
+	state, err := a.getState(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return state.GetState(a.address, args.Slot), nil
+}
+
+// Log represents an individual log message. All arguments are mandatory.
+type Log struct {
+	backend     kusdapi.Backend
+	transaction *Transaction
+	log         *types.Log
+}
+
+func (l *Log) Transaction(ctx context.Context) *Transaction {
+	return l.transaction
+}
+
+func (l *Log) Account(ctx context.Context, args BlockNumberArgs) *Account {
+	return &Account{
+		backend:     l.backend,
+		address:     l.log.Address,
+		blockNumber: args.Number(),
+	}
+}
+
+func (l *Log) Index(ctx context.Context) int32 {
+	return int32(l.log.Index)
+}
+
+func (l *Log) Topics(ctx context.Context) []common.Hash {
+	return l.log.Topics
+}
+
+func (l *Log) Data(ctx context.Context) hexutil.Bytes {
+	return hexutil.Bytes(l.log.Data)
+}
+
+// Transaction represents a Kowala transaction. The backend and hash are
+// mandatory, all other fields are lazily resolved.
+type Transaction struct {
+	backend kusdapi.Backend
+	hash    common.Hash
+	tx      *types.Transaction
+	block   *Block
+	index   uint64
+}
+
+// resolve returns the internal transaction object, fetching it from the chain
+// or the transaction pool if needed.
+func (t *Transaction) resolve(ctx context.Context) (*types.Transaction, error) {
+	if t.tx == nil {
+		tx, blockHash, blockNumber, index := core.GetTransaction(t.backend.ChainDb(), t.hash)
+		if tx != nil {
+			number := rpc.BlockNumber(blockNumber)
+			t.tx = tx
+			t.block = &Block{backend: t.backend, num: &number, hash: blockHash}
+			t.index = index
+		} else {
+			t.tx = t.backend.GetPoolTransaction(t.hash)
+		}
+	}
+	return t.tx, nil
+}
+
+func (t *Transaction) Hash(ctx context.Context) common.Hash {
+	return t.hash
+}
+
+func (t *Transaction) InputData(ctx context.Context) (hexutil.Bytes, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil || tx == nil {
+		return hexutil.Bytes{}, err
+	}
+	return hexutil.Bytes(tx.Data()), nil
+}
+
+func (t *Transaction) Gas(ctx context.Context) (hexutil.Big, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil || tx == nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*tx.Gas()), nil
+}
+
+func (t *Transaction) GasPrice(ctx context.Context) (hexutil.Big, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil || tx == nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*tx.GasPrice()), nil
+}
+
+func (t *Transaction) Value(ctx context.Context) (hexutil.Big, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil || tx == nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*tx.Value()), nil
+}
+
+func (t *Transaction) Nonce(ctx context.Context) (hexutil.Uint64, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil || tx == nil {
+		return 0, err
+	}
+	return hexutil.Uint64(tx.Nonce()), nil
+}
+
+func (t *Transaction) To(ctx context.Context, args BlockNumberArgs) (*Account, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	to := tx.To()
+	if to == nil {
+		return nil, nil
+	}
+	return &Account{
+		backend:     t.backend,
+		address:     *to,
+		blockNumber: args.Number(),
+	}, nil
+}
+
+func (t *Transaction) From(ctx context.Context, args BlockNumberArgs) (*Account, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil || tx == nil {
+		return nil, err
+	}
+	from, err := types.TxSender(types.NewAndromedaSigner(tx.ChainID()), tx)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{
+		backend:     t.backend,
+		address:     from,
+		blockNumber: args.Number(),
+	}, nil
+}
+
+func (t *Transaction) Block(ctx context.Context) (*Block, error) {
+	if _, err := t.resolve(ctx); err != nil {
+		return nil, err
+	}
+	return t.block, nil
+}
+
+func (t *Transaction) Index(ctx context.Context) (*int32, error) {
+	if _, err := t.resolve(ctx); err != nil {
+		return nil, err
+	}
+	if t.block == nil {
+		return nil, nil
+	}
+	index := int32(t.index)
+	return &index, nil
+}
+
+// getReceipt returns the receipt associated with this transaction, if any.
+func (t *Transaction) getReceipt(ctx context.Context) (*types.Receipt, error) {
+	if _, err := t.resolve(ctx); err != nil {
+		return nil, err
+	}
+	if t.block == nil {
+		return nil, nil
+	}
+	receipts, err := t.block.resolveReceipts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if t.index >= uint64(len(receipts)) {
+		return nil, nil
+	}
+	return receipts[t.index], nil
+}
+
+func (t *Transaction) Status(ctx context.Context) (*hexutil.Uint64, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	status := hexutil.Uint64(receipt.Status)
+	return &status, nil
+}
+
+func (t *Transaction) GasUsed(ctx context.Context) (*hexutil.Big, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(receipt.GasUsed), nil
+}
+
+func (t *Transaction) CumulativeGasUsed(ctx context.Context) (*hexutil.Big, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(receipt.CumulativeGasUsed), nil
+}
+
+func (t *Transaction) CreatedContract(ctx context.Context, args BlockNumberArgs) (*Account, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil || receipt.ContractAddress == (common.Address{}) {
+		return nil, err
+	}
+	return &Account{
+		backend:     t.backend,
+		address:     receipt.ContractAddress,
+		blockNumber: args.Number(),
+	}, nil
+}
+
+func (t *Transaction) Logs(ctx context.Context) (*[]*Log, error) {
+	receipt, err := t.getReceipt(ctx)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	ret := make([]*Log, 0, len(receipt.Logs))
+	for _, log := range receipt.Logs {
+		ret = append(ret, &Log{
+			backend:     t.backend,
+			transaction: t,
+			log:         log,
+		})
+	}
+	return &ret, nil
+}
+
+// Vote represents a signed consensus vote.
+type Vote struct {
+	backend kusdapi.Backend
+	vote    *types.Vote
+}
+
+func (v *Vote) BlockHash(ctx context.Context) common.Hash {
+	return v.vote.BlockHash()
+}
+
+func (v *Vote) BlockNumber(ctx context.Context) hexutil.Big {
+	return hexutil.Big(*v.vote.BlockNumber())
+}
+
+func (v *Vote) Round(ctx context.Context) hexutil.Uint64 {
+	return hexutil.Uint64(v.vote.Round())
+}
+
+func (v *Vote) Type(ctx context.Context) int32 {
+	return int32(v.vote.Type())
+}
+
+func (v *Vote) Signer(ctx context.Context) (common.Address, error) {
+	return types.VoteSender(types.NewAndromedaSigner(v.backend.ChainConfig().ChainID), v.vote)
+}
+
+// Commit represents the set of pre-commits finalising a block.
+type Commit struct {
+	backend kusdapi.Backend
+	commit  *types.Commit
+}
+
+func (c *Commit) PreCommits(ctx context.Context) []*Vote {
+	votes := make([]*Vote, 0, len(c.commit.PreCommits))
+	for _, vote := range c.commit.PreCommits {
+		if vote != nil {
+			votes = append(votes, &Vote{backend: c.backend, vote: vote})
+		}
+	}
+	return votes
+}
+
+func (c *Commit) FirstPreCommit(ctx context.Context) *Vote {
+	if c.commit.FirstPreCommit == nil {
+		return nil
+	}
+	return &Vote{backend: c.backend, vote: c.commit.FirstPreCommit}
+}
+
+// Block represents a Kowala block. The backend and either the number or the
+// hash are mandatory, all other fields are lazily resolved.
+type Block struct {
+	backend  kusdapi.Backend
+	num      *rpc.BlockNumber
+	hash     common.Hash
+	block    *types.Block
+	receipts []*types.Receipt
+}
+
+// resolve returns the internal block object, fetching it by hash if known and
+// by number otherwise.
+func (b *Block) resolve(ctx context.Context) (*types.Block, error) {
+	if b.block != nil {
+		return b.block, nil
+	}
+	var err error
+	if b.hash != (common.Hash{}) {
+		b.block, err = b.backend.GetBlock(ctx, b.hash)
+	} else {
+		b.block, err = b.backend.BlockByNumber(ctx, *b.num)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if b.block == nil {
+		return nil, errMissingBlock
+	}
+	if b.hash == (common.Hash{}) {
+		b.hash = b.block.Hash()
+	}
+	return b.block, nil
+}
+
+// resolveReceipts returns the receipts of the transactions of the block.
+func (b *Block) resolveReceipts(ctx context.Context) ([]*types.Receipt, error) {
+	if b.receipts == nil {
+		block, err := b.resolve(ctx)
+		if err != nil {
+			return nil, err
+		}
+		receipts, err := b.backend.GetReceipts(ctx, block.Hash())
+		if err != nil {
+			return nil, err
+		}
+		b.receipts = []*types.Receipt(receipts)
+	}
+	return b.receipts, nil
+}
+
+func (b *Block) Number(ctx context.Context) (hexutil.Uint64, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(block.NumberU64()), nil
+}
+
+func (b *Block) Hash(ctx context.Context) (common.Hash, error) {
+	if _, err := b.resolve(ctx); err != nil {
+		return common.Hash{}, err
+	}
+	return b.hash, nil
+}
+
+func (b *Block) Parent(ctx context.Context) (*Block, error) {
+	block, err := b.resolve(ctx)
+	if err != nil || block.NumberU64() == 0 {
+		return nil, err
+	}
+	num := rpc.BlockNumber(block.NumberU64() - 1)
+	return &Block{
+		backend: b.backend,
+		num:     &num,
+		hash:    block.ParentHash(),
+	}, nil
+}
+
+func (b *Block) Coinbase(ctx context.Context, args BlockNumberArgs) (*Account, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{
+		backend:     b.backend,
+		address:     block.Coinbase(),
+		blockNumber: args.Number(),
+	}, nil
+}
+
+func (b *Block) StateRoot(ctx context.Context) (common.Hash, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.Root(), nil
+}
+
+func (b *Block) TransactionsRoot(ctx context.Context) (common.Hash, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.TxHash(), nil
+}
+
+func (b *Block) ReceiptsRoot(ctx context.Context) (common.Hash, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.ReceiptHash(), nil
+}
+
+func (b *Block) ValidatorsHash(ctx context.Context) (common.Hash, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.ValidatorsHash(), nil
+}
+
+func (b *Block) LastCommitHash(ctx context.Context) (common.Hash, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.LastCommitHash(), nil
+}
+
+func (b *Block) LastCommit(ctx context.Context) (*Commit, error) {
+	block, err := b.resolve(ctx)
+	if err != nil || block.LastCommit() == nil {
+		return nil, err
+	}
+	return &Commit{backend: b.backend, commit: block.LastCommit()}, nil
+}
+
+func (b *Block) LogsBloom(ctx context.Context) (hexutil.Bytes, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return hexutil.Bytes{}, err
+	}
+	return hexutil.Bytes(block.Bloom().Bytes()), nil
+}
+
+func (b *Block) GasLimit(ctx context.Context) (hexutil.Big, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*block.GasLimit()), nil
+}
+
+func (b *Block) GasUsed(ctx context.Context) (hexutil.Big, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*block.GasUsed()), nil
+}
+
+func (b *Block) Timestamp(ctx context.Context) (hexutil.Big, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*block.Time()), nil
+}
+
+func (b *Block) ExtraData(ctx context.Context) (hexutil.Bytes, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return hexutil.Bytes{}, err
+	}
+	return hexutil.Bytes(block.Extra()), nil
+}
+
+func (b *Block) TransactionCount(ctx context.Context) (*int32, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	count := int32(len(block.Transactions()))
+	return &count, nil
+}
+
+func (b *Block) Transactions(ctx context.Context) (*[]*Transaction, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*Transaction, 0, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		ret = append(ret, b.transaction(tx, uint64(i)))
+	}
+	return &ret, nil
+}
+
+func (b *Block) TransactionAt(ctx context.Context, args struct{ Index int32 }) (*Transaction, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	if args.Index < 0 || int(args.Index) >= len(txs) {
+		return nil, nil
+	}
+	return b.transaction(txs[args.Index], uint64(args.Index)), nil
+}
+
+// transaction wraps a transaction included in the block.
+func (b *Block) transaction(tx *types.Transaction, index uint64) *Transaction {
+	return &Transaction{
+		backend: b.backend,
+		hash:    tx.Hash(),
+		tx:      tx,
+		block:   b,
+		index:   index,
+	}
+}
+
+func (b *Block) Account(ctx context.Context, args struct{ Address common.Address }) (*Account, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{
+		backend:     b.backend,
+		address:     args.Address,
+		blockNumber: rpc.BlockNumber(block.NumberU64()),
+	}, nil
+}
+
+// BlockFilterCriteria encapsulates criteria passed to a `logs` accessor inside
+// a block.
+type BlockFilterCriteria struct {
+	Addresses *[]common.Address // restricts matches to events created by specific contracts
+
+	// The Topic list restricts matches to particular event topics. Each event has a list
+	// of topics. Topics matches a prefix of that list. An empty element slice matches any
+	// topic. Non-empty elements represent an alternative that matches any of the
+	// contained topics.
+	Topics *[][]common.Hash
+}
+
+func (b *Block) Logs(ctx context.Context, args struct{ Filter BlockFilterCriteria }) ([]*Log, error) {
+	var addresses []common.Address
+	if args.Filter.Addresses != nil {
+		addresses = *args.Filter.Addresses
+	}
+	var topics [][]common.Hash
+	if args.Filter.Topics != nil {
+		topics = *args.Filter.Topics
+	}
+	return b.filterLogs(ctx, addresses, topics)
+}
+
+// filterLogs returns the logs of the block matching the given criteria.
+func (b *Block) filterLogs(ctx context.Context, addresses []common.Address, topics [][]common.Hash) ([]*Log, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*Log{}
+	if !matchBloom(block.Bloom(), addresses, topics) {
+		return ret, nil
+	}
+	receipts, err := b.resolveReceipts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	for i, receipt := range receipts {
+		if i >= len(txs) {
+			break
+		}
+		var tx *Transaction
+		for _, log := range receipt.Logs {
+			if !matchLog(log, addresses, topics) {
+				continue
+			}
+			if tx == nil {
+				tx = b.transaction(txs[i], uint64(i))
+			}
+			ret = append(ret, &Log{backend: b.backend, transaction: tx, log: log})
+		}
+	}
+	return ret, nil
+}
+
+// matchBloom reports whether a bloom filter may contain logs matching the
+// given criteria.
+func matchBloom(bloom types.Bloom, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 {
+		var included bool
+		for _, addr := range addresses {
+			if types.BloomLookup(bloom, addr) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, sub := range topics {
+		included := len(sub) == 0 // empty rule set == wildcard
+		for _, topic := range sub {
+			if types.BloomLookup(bloom, topic) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	return true
+}
+
+// matchLog reports whether a log matches the given criteria.
+func matchLog(log *types.Log, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 {
+		var included bool
+		for _, addr := range addresses {
+			if log.Address == addr {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	if len(topics) > len(log.Topics) {
+		return false
+	}
+	for i, sub := range topics {
+		match := len(sub) == 0 // empty rule set == wildcard
+		for _, topic := range sub {
+			if log.Topics[i] == topic {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
+
+// Pending represents the current pending state.
+type Pending struct {
+	backend kusdapi.Backend
+}
+
+func (p *Pending) TransactionCount(ctx context.Context) (int32, error) {
+	txs, err := p.backend.GetPoolTransactions()
+	return int32(len(txs)), err
+}
+
+func (p *Pending) Transactions(ctx context.Context) (*[]*Transaction, error) {
+	txs, err := p.backend.GetPoolTransactions()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*Transaction, 0, len(txs))
+	for _, tx := range txs {
+		ret = append(ret, &Transaction{
+			backend: p.backend,
+			hash:    tx.Hash(),
+			tx:      tx,
+		})
+	}
+	return &ret, nil
+}
+
+func (p *Pending) Account(ctx context.Context, args struct{ Address common.Address }) *Account {
+	return &Account{
+		backend:     p.backend,
+		address:     args.Address,
+		blockNumber: rpc.PendingBlockNumber,
+	}
+}
+
+// BlockNumberArgs encapsulates arguments to accessors that specify a block number.
+type BlockNumberArgs struct {
+	Block *hexutil.Uint64
+}
+
+// Number returns the provided block number, or rpc.LatestBlockNumber if none
+// was provided.
+func (a BlockNumberArgs) Number() rpc.BlockNumber {
+	if a.Block != nil {
+		return rpc.BlockNumber(*a.Block)
+	}
+	return rpc.LatestBlockNumber
+}
+
+// Resolver is the top-level object in the GraphQL hierarchy.
+type Resolver struct {
+	backend kusdapi.Backend
+}
+
+func (r *Resolver) Account(ctx context.Context, args struct {
+	Address     common.Address
+	BlockNumber *hexutil.Uint64
+}) *Account {
+	blockNumber := rpc.LatestBlockNumber
+	if args.BlockNumber != nil {
+		blockNumber = rpc.BlockNumber(*args.BlockNumber)
+	}
+	return &Account{
+		backend:     r.backend,
+		address:     args.Address,
+		blockNumber: blockNumber,
+	}
+}
+
+func (r *Resolver) Block(ctx context.Context, args struct {
+	Number *hexutil.Uint64
+	Hash   *common.Hash
+}) (*Block, error) {
+	var block *Block
+	switch {
+	case args.Hash != nil:
+		block = &Block{backend: r.backend, hash: *args.Hash}
+	case args.Number != nil:
+		num := rpc.BlockNumber(*args.Number)
+		block = &Block{backend: r.backend, num: &num}
+	default:
+		num := rpc.LatestBlockNumber
+		block = &Block{backend: r.backend, num: &num}
+	}
+	// Resolve the block, returning nil if it doesn't exist
+	if _, err := block.resolve(ctx); err != nil {
+		if err == errMissingBlock {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return block, nil
+}
+
+func (r *Resolver) Blocks(ctx context.Context, args struct {
+	From hexutil.Uint64
+	To   *hexutil.Uint64
+}) ([]*Block, error) {
+	from, to, err := r.blockRange(ctx, &args.From, args.To)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*Block, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		num := rpc.BlockNumber(i)
+		ret = append(ret, &Block{backend: r.backend, num: &num})
+	}
+	return ret, nil
+}
+
+// blockRange resolves an inclusive block range, capping its end to the current
+// chain. The end defaults to the most recent block and the beginning to the end.
+func (r *Resolver) blockRange(ctx context.Context, from, to *hexutil.Uint64) (uint64, uint64, error) {
+	head := r.backend.CurrentBlock().NumberU64()
+
+	end := head
+	if to != nil && uint64(*to) < head {
+		end = uint64(*to)
+	}
+	begin := end
+	if from != nil {
+		begin = uint64(*from)
+	}
+	if begin > end {
+		return 0, 0, errInvalidRange
+	}
+	if end-begin >= maxBlockRange {
+		return 0, 0, errRangeTooLarge
+	}
+	return begin, end, nil
+}
+
+func (r *Resolver) Pending(ctx context.Context) *Pending {
+	return &Pending{r.backend}
+}
+
+func (r *Resolver) Transaction(ctx context.Context, args struct{ Hash common.Hash }) (*Transaction, error) {
+	tx := &Transaction{
+		backend: r.backend,
+		hash:    args.Hash,
+	}
+	// Resolve the transaction; if it doesn't exist, return nil.
+	t, err := tx.resolve(ctx)
+	if err != nil {
+		return nil, err
+	} else if t == nil {
+		return nil, nil
+	}
+	return tx, nil
+}
+
+func (r *Resolver) SendRawTransaction(ctx context.Context, args struct{ Data hexutil.Bytes }) (common.Hash, error) {
+	return kusdapi.NewPublicTransactionPoolAPI(r.backend, new(kusdapi.AddrLocker)).SendRawTransaction(ctx, args.Data)
+}
+
+// FilterCriteria encapsulates the arguments to `logs` on the root resolver object.
+type FilterCriteria struct {
+	FromBlock *hexutil.Uint64   // beginning of the queried range, nil means the end of it
+	ToBlock   *hexutil.Uint64   // end of the range, nil means latest block
+	Addresses *[]common.Address // restricts matches to events created by specific contracts
+
+	// The Topic list restricts matches to particular event topics. Each event has a list
+	// of topics. Topics matches a prefix of that list. An empty element slice matches any
+	// topic. Non-empty elements represent an alternative that matches any of the
+	// contained topics.
+	Topics *[][]common.Hash
+}
+
+func (r *Resolver) Logs(ctx context.Context, args struct{ Filter FilterCriteria }) ([]*Log, error) {
+	from, to, err := r.blockRange(ctx, args.Filter.FromBlock, args.Filter.ToBlock)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []common.Address
+	if args.Filter.Addresses != nil {
+		addresses = *args.Filter.Addresses
+	}
+	var topics [][]common.Hash
+	if args.Filter.Topics != nil {
+		topics = *args.Filter.Topics
+	}
+	// Check the header blooms before retrieving any bodies or receipts
+	ret := []*Log{}
+	for i := from; i <= to; i++ {
+		header, err := r.backend.HeaderByNumber(ctx, rpc.BlockNumber(i))
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			break
+		}
+		if !matchBloom(header.Bloom, addresses, topics) {
+			continue
+		}
+		block := &Block{backend: r.backend, hash: header.Hash()}
+		logs, err := block.filterLogs(ctx, addresses, topics)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, logs...)
+	}
+	return ret, nil
+}
+
+func (r *Resolver) GasPrice(ctx context.Context) (hexutil.Big, error) {
+	price, err := r.backend.SuggestPrice(ctx)
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*price), nil
+}
+
+func (r *Resolver) ProtocolVersion(ctx context.Context) (int32, error) {
+	return int32(r.backend.ProtocolVersion()), nil
+}
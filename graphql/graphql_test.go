@@ -0,0 +1,82 @@
+package graphql
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/common/hexutil"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/internal/kusdapi"
+)
+
+// testBackend answers the queries of the tests, panicking on everything else.
+type testBackend struct {
+	kusdapi.Backend
+}
+
+func (b *testBackend) SuggestPrice(ctx context.Context) (*big.Int, error) { return big.NewInt(42), nil }
+func (b *testBackend) ProtocolVersion() int                               { return 63 }
+func (b *testBackend) CurrentBlock() *types.Block {
+	return types.NewBlockWithHeader(&types.Header{Number: big.NewInt(2000)})
+}
+
+// Tests that the schema binds to the resolvers and that queries are served.
+func TestGraphQLQuery(t *testing.T) {
+	handler, err := newHandler(&testBackend{})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	tests := []struct {
+		query  string
+		result string
+	}{
+		{`{"query": "{ gasPrice protocolVersion }"}`, `{"data":{"gasPrice":"0x2a","protocolVersion":63}}`},
+		{`{"query": "{ account(address: \"0xinvalid\") { address } }"}`, `"errors"`},
+		{`{"query": "{ block { parent { parent { parent { parent { parent { parent { parent { parent { parent { parent { number } } } } } } } } } } } }"}`, `exceeds max depth`},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", "http://localhost/graphql", strings.NewReader(tt.query))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("test %d: status code mismatch: have %d, want %d", i, rec.Code, http.StatusOK)
+		}
+		if !strings.Contains(rec.Body.String(), tt.result) {
+			t.Errorf("test %d: response mismatch: have %s, want %s", i, rec.Body.String(), tt.result)
+		}
+	}
+}
+
+// Tests that block ranges default to the most recent block and are bounded.
+func TestBlockRange(t *testing.T) {
+	r := &Resolver{&testBackend{}}
+	num := func(n uint64) *hexutil.Uint64 { return (*hexutil.Uint64)(&n) }
+
+	tests := []struct {
+		from, to   *hexutil.Uint64
+		begin, end uint64
+		err        error
+	}{
+		{nil, nil, 2000, 2000, nil},
+		{nil, num(1500), 1500, 1500, nil},
+		{num(1000), nil, 1000, 2000, nil},
+		{num(1000), num(3000), 1000, 2000, nil},
+		{num(1500), num(1000), 0, 0, errInvalidRange},
+		{num(0), nil, 0, 0, errRangeTooLarge},
+	}
+	for i, tt := range tests {
+		begin, end, err := r.blockRange(context.Background(), tt.from, tt.to)
+		if err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+			continue
+		}
+		if begin != tt.begin || end != tt.end {
+			t.Errorf("test %d: range mismatch: have [%d, %d], want [%d, %d]", i, begin, end, tt.begin, tt.end)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package graphql
+
+const schema string = `
+    # Bytes32 is a 32 byte binary string, represented as 0x-prefixed hexadecimal.
+    scalar Bytes32
+    # Address is a 20 byte Kowala address, represented as 0x-prefixed hexadecimal.
+    scalar Address
+    # Bytes is an arbitrary length binary string, represented as 0x-prefixed hexadecimal.
+    # An empty byte string is represented as '0x'. Byte strings must have an even number of hexadecimal nybbles.
+    scalar Bytes
+    # BigInt is a large integer. Input is accepted as either a JSON number or as a string.
+    # Strings may be either decimal or 0x-prefixed hexadecimal. Output values are all
+    # 0x-prefixed hexadecimal.
+    scalar BigInt
+    # Long is a 64 bit unsigned integer, output as 0x-prefixed hexadecimal.
+    scalar Long
+
+    schema {
+        query: Query
+        mutation: Mutation
+    }
+
+    # Account is a Kowala account at a particular block.
+    type Account {
+        # Address is the address owning the account.
+        address: Address!
+        # Balance is the balance of the account, in wei.
+        balance: BigInt!
+        # TransactionCount is the number of transactions sent from this account,
+        # or in the case of a contract, the number of contracts created. Otherwise
+        # known as the nonce.
+        transactionCount: Long!
+        # Code contains the smart contract code for this account, if the account
+        # is a (non-self-destructed) contract.
+        code: Bytes!
+        # Storage provides access to the storage of a contract account, indexed
+        # by its 32 byte slot identifier.
+        storage(slot: Bytes32!): Bytes32!
+    }
+
+    # Log is a Kowala event log.
+    type Log {
+        # Index is the index of this log in the block.
+        index: Int!
+        # Account is the account which generated this log - this will always
+        # be a contract account.
+        account(block: Long): Account!
+        # Topics is a list of 0-4 indexed topics for the log.
+        topics: [Bytes32!]!
+        # Data is unindexed data for this log.
+        data: Bytes!
+        # Transaction is the transaction that generated this log entry.
+        transaction: Transaction!
+    }
+
+    # Transaction is a Kowala transaction.
+    type Transaction {
+        # Hash is the hash of this transaction.
+        hash: Bytes32!
+        # Nonce is the nonce of the account this transaction was generated with.
+        nonce: Long!
+        # Index is the index of this transaction in the parent block. This will
+        # be null if the transaction has not yet been mined.
+        index: Int
+        # From is the account that sent this transaction - this will always be
+        # an externally owned account.
+        from(block: Long): Account!
+        # To is the account the transaction was sent to. This is null for
+        # contract-creating transactions.
+        to(block: Long): Account
+        # Value is the value, in wei, sent along with this transaction.
+        value: BigInt!
+        # GasPrice is the price offered to validators for gas, in wei per unit.
+        gasPrice: BigInt!
+        # Gas is the maximum amount of gas this transaction can consume.
+        gas: BigInt!
+        # InputData is the data supplied to the target of the transaction.
+        inputData: Bytes!
+        # Block is the block this transaction was included in. This will be null
+        # if the transaction has not yet been included in a block.
+        block: Block
+
+        # Status is the return status of the transaction. This will be 1 if the
+        # transaction succeeded, or 0 if it failed (due to a revert, or due to
+        # running out of gas). If the transaction has not yet been included in a
+        # block, this field will be null.
+        status: Long
+        # GasUsed is the amount of gas that was used processing this transaction.
+        # If the transaction has not yet been included in a block, this field
+        # will be null.
+        gasUsed: BigInt
+        # CumulativeGasUsed is the total gas used in the block up to and including
+        # this transaction. If the transaction has not yet been included in a
+        # block, this field will be null.
+        cumulativeGasUsed: BigInt
+        # CreatedContract is the account that was created by a contract creation
+        # transaction. If the transaction was not a contract creation transaction,
+        # or it has not yet been included in a block, this field will be null.
+        createdContract(block: Long): Account
+        # Logs is a list of log entries emitted by this transaction. If the
+        # transaction has not yet been included in a block, this field will be
+        # null.
+        logs: [Log!]
+    }
+
+    # Vote is a signed consensus vote of a validator.
+    type Vote {
+        # BlockHash is the hash of the block voted for, zero for a nil vote.
+        blockHash: Bytes32!
+        # BlockNumber is the height the vote was cast at.
+        blockNumber: BigInt!
+        # Round is the consensus round the vote was cast in.
+        round: Long!
+        # Type is the type of the vote: 0 for a pre-vote, 1 for a pre-commit.
+        type: Int!
+        # Signer is the address of the key that signed the vote.
+        signer: Address!
+    }
+
+    # Commit is the set of pre-commits finalising a block.
+    type Commit {
+        # PreCommits are the pre-commits of the validators, ordered by address.
+        preCommits: [Vote!]!
+        # FirstPreCommit is the first pre-commit received for the block.
+        firstPreCommit: Vote
+    }
+
+    # BlockFilterCriteria encapsulates log filter criteria for a filter applied
+    # to a single block.
+    input BlockFilterCriteria {
+        # Addresses is a list of addresses that are of interest. If this list is
+        # empty, results will not be filtered by address.
+        addresses: [Address!]
+        # Topics list restricts matches to particular event topics. Each event
+        # has a list of topics. Topics matches a prefix of that list. An empty
+        # element array matches any topic. Non-empty elements represent an
+        # alternative that matches any of the contained topics.
+        topics: [[Bytes32!]!]
+    }
+
+    # Block is a Kowala block.
+    type Block {
+        # Number is the number of this block, starting at 0 for the genesis block.
+        number: Long!
+        # Hash is the block hash of this block.
+        hash: Bytes32!
+        # Parent is the parent block of this block. This is null for the genesis
+        # block.
+        parent: Block
+        # Coinbase is the account of the validator that proposed this block.
+        coinbase(block: Long): Account!
+        # StateRoot is the hash of the state trie after this block was processed.
+        stateRoot: Bytes32!
+        # TransactionsRoot is the hash of the root of the trie of transactions
+        # in this block.
+        transactionsRoot: Bytes32!
+        # ReceiptsRoot is the hash of the trie of transaction receipts in this
+        # block.
+        receiptsRoot: Bytes32!
+        # ValidatorsHash is the hash of the validator set that proposed and
+        # voted on this block.
+        validatorsHash: Bytes32!
+        # LastCommitHash is the hash of the commit finalising the parent block.
+        lastCommitHash: Bytes32!
+        # LastCommit is the commit finalising the parent block. This is null for
+        # the genesis block.
+        lastCommit: Commit
+        # LogsBloom is a bloom filter that can be used to check if a block may
+        # contain log entries matching a filter.
+        logsBloom: Bytes!
+        # GasLimit is the maximum amount of gas that was available to
+        # transactions in this block.
+        gasLimit: BigInt!
+        # GasUsed is the amount of gas that was used executing transactions in
+        # this block.
+        gasUsed: BigInt!
+        # Timestamp is the unix timestamp at which this block was proposed.
+        timestamp: BigInt!
+        # ExtraData is an arbitrary data field supplied by the proposer.
+        extraData: Bytes!
+        # TransactionCount is the number of transactions in this block.
+        transactionCount: Int
+        # Transactions is a list of transactions associated with this block.
+        transactions: [Transaction!]
+        # TransactionAt returns the transaction at the specified index.
+        transactionAt(index: Int!): Transaction
+        # Logs returns a filtered set of logs from this block.
+        logs(filter: BlockFilterCriteria!): [Log!]!
+        # Account fetches a Kowala account at the current block's state.
+        account(address: Address!): Account!
+    }
+
+    # FilterCriteria encapsulates log filter criteria for searching log entries.
+    input FilterCriteria {
+        # FromBlock is the block at which to start searching, inclusive. Defaults
+        # to the latest block if not supplied.
+        fromBlock: Long
+        # ToBlock is the block at which to stop searching, inclusive. Defaults
+        # to the latest block if not supplied.
+        toBlock: Long
+        # Addresses is a list of addresses that are of interest. If this list is
+        # empty, results will not be filtered by address.
+        addresses: [Address!]
+        # Topics list restricts matches to particular event topics. Each event
+        # has a list of topics. Topics matches a prefix of that list. An empty
+        # element array matches any topic. Non-empty elements represent an
+        # alternative that matches any of the contained topics.
+        topics: [[Bytes32!]!]
+    }
+
+    # Pending represents the current pending state.
+    type Pending {
+        # TransactionCount is the number of transactions in the pending state.
+        transactionCount: Int!
+        # Transactions is a list of transactions in the current pending state.
+        transactions: [Transaction!]
+        # Account fetches a Kowala account for the pending state.
+        account(address: Address!): Account!
+    }
+
+    type Query {
+        # Account fetches a Kowala account at the specified block number.
+        # If blockNumber is not provided, it defaults to the most recent block.
+        account(address: Address!, blockNumber: Long): Account!
+        # Block fetches a Kowala block by number or by hash. If neither is
+        # supplied, the most recent known block is returned.
+        block(number: Long, hash: Bytes32): Block
+        # Blocks returns all the blocks between two numbers, inclusive. If
+        # to is not supplied, it defaults to the most recent known block.
+        blocks(from: Long!, to: Long): [Block!]!
+        # Pending returns the current pending state.
+        pending: Pending!
+        # Transaction returns a transaction specified by its hash.
+        transaction(hash: Bytes32!): Transaction
+        # Logs returns log entries matching the provided filter.
+        logs(filter: FilterCriteria!): [Log!]!
+        # GasPrice returns the node's estimate of a gas price sufficient to
+        # ensure a transaction is included in a block in a timely manner.
+        gasPrice: BigInt!
+        # ProtocolVersion returns the current wire protocol version number.
+        protocolVersion: Int!
+    }
+
+    type Mutation {
+        # SendRawTransaction sends an RLP-encoded transaction to the network.
+        sendRawTransaction(data: Bytes!): Bytes32!
+    }
+`
@@ -0,0 +1,65 @@
+package graphql
+
+import (
+	"net/http"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/kowala-tech/kUSD/internal/kusdapi"
+	"github.com/kowala-tech/kUSD/p2p"
+	"github.com/kowala-tech/kUSD/rpc"
+)
+
+const (
+	// maxQueryDepth is the maximum nesting depth of the fields of a query. Along
+	// with maxBlockRange, it bounds the work a single query can cause.
+	maxQueryDepth = 10
+
+	// maxParallelism is the maximum number of resolvers a query runs at once.
+	maxParallelism = 8
+)
+
+// Service encapsulates a GraphQL server mounted on the HTTP RPC endpoint of
+// the node under /graphql.
+type Service struct {
+	handler http.Handler // Handler serving the GraphQL queries
+}
+
+// New constructs a new GraphQL service resolving its queries through the given
+// backend.
+func New(backend kusdapi.Backend) (*Service, error) {
+	handler, err := newHandler(backend)
+	if err != nil {
+		return nil, err
+	}
+	return &Service{handler: handler}, nil
+}
+
+// newHandler returns a new `http.Handler` that will answer GraphQL queries
+// issued against the backend.
+func newHandler(backend kusdapi.Backend) (http.Handler, error) {
+	s, err := graphqlgo.ParseSchema(schema, &Resolver{backend}, graphqlgo.MaxDepth(maxQueryDepth), graphqlgo.MaxParallelism(maxParallelism))
+	if err != nil {
+		return nil, err
+	}
+	return &relay.Handler{Schema: s}, nil
+}
+
+// Protocols returns the list of protocols exported by this service.
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+// APIs returns the list of APIs exported by this service.
+func (s *Service) APIs() []rpc.API { return nil }
+
+// HTTPHandlers returns the GraphQL handler to mount on the HTTP RPC endpoint.
+func (s *Service) HTTPHandlers() map[string]http.Handler {
+	return map[string]http.Handler{"/graphql": s.handler}
+}
+
+// Start is called after all services have been constructed and the networking
+// layer was also initialized to spawn any goroutines required by the service.
+func (s *Service) Start(server *p2p.Server) error { return nil }
+
+// Stop terminates all goroutines belonging to the service, blocking until they
+// are all terminated.
+func (s *Service) Stop() error { return nil }
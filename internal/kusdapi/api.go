@@ -295,6 +295,17 @@ func (s *PrivateAccountAPI) ImportRawKey(privkey string, password string) (commo
 	return acc.Address, err
 }
 
+// ImportMnemonic stores the given BIP-39 mnemonic into the key directory,
+// encrypting it with the passphrase, and returns the URL of the HD wallet
+// deriving accounts from it.
+func (s *PrivateAccountAPI) ImportMnemonic(mnemonic string, password string) (string, error) {
+	wallet, err := fetchKeystore(s.am).ImportMnemonic(mnemonic, password)
+	if err != nil {
+		return "", err
+	}
+	return wallet.URL().String(), nil
+}
+
 // UnlockAccount will unlock the account associated with the given address with
 // the given password for duration seconds. If duration is nil it will use a
 // default of 300 seconds. It returns an indication if the account was unlocked.
@@ -111,6 +111,17 @@ web3._extend({
 			call: 'admin_removePeer',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'banPeer',
+			call: 'admin_banPeer',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
+		new web3._extend.Method({
+			name: 'unbanPeer',
+			call: 'admin_unbanPeer',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'exportChain',
 			call: 'admin_exportChain',
@@ -158,6 +169,10 @@ web3._extend({
 			name: 'peers',
 			getter: 'admin_peers'
 		}),
+		new web3._extend.Property({
+			name: 'bans',
+			getter: 'admin_bans'
+		}),
 		new web3._extend.Property({
 			name: 'datadir',
 			getter: 'admin_datadir'
@@ -481,6 +496,11 @@ web3._extend({
 			call: 'personal_importRawKey',
 			params: 2
 		}),
+		new web3._extend.Method({
+			name: 'importMnemonic',
+			call: 'personal_importMnemonic',
+			params: 2
+		}),
 		new web3._extend.Method({
 			name: 'sign',
 			call: 'personal_sign',
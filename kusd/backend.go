@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"os"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -29,6 +30,7 @@ import (
 	"github.com/kowala-tech/kUSD/log"
 	"github.com/kowala-tech/kUSD/node"
 	"github.com/kowala-tech/kUSD/p2p"
+	"github.com/kowala-tech/kUSD/p2p/enr"
 	"github.com/kowala-tech/kUSD/params"
 	"github.com/kowala-tech/kUSD/rlp"
 	"github.com/kowala-tech/kUSD/rpc"
@@ -59,13 +61,15 @@ type Kowala struct {
 
 	ApiBackend *KowalaApiBackend
 
-	validator validator.Validator // consensus validator
-	gasPrice  *big.Int
-	coinbase  common.Address
-	deposit   uint64
+	validator      validator.Validator // consensus validator
+	validatorTrace *os.File            // recording of the consensus state machine, if enabled
+	gasPrice       *big.Int
+	coinbase       common.Address
+	deposit        uint64
 
 	networkId     uint64
 	netRPCService *kusdapi.PublicNetAPI
+	p2pServer     *p2p.Server
 
 	lock sync.RWMutex // Protects the variadic fields (e.g. gas price and coinbase)
 }
@@ -121,6 +125,8 @@ func New(ctx *node.ServiceContext, config *Config) (*Kowala, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Blocks are only valid along with the commit of their parent
+	kusd.blockchain.SetValidator(core.NewCommitValidator(kusd.chainConfig, kusd.blockchain, kusd.engine, validator.ValidatorsAt(kusd.chainConfig)))
 	// Rewind the chain in case of an incompatible config upgrade.
 	if compat, ok := genesisErr.(*params.ConfigCompatError); ok {
 		log.Warn("Rewinding chain to upgrade configuration", "err", compat)
@@ -149,10 +155,25 @@ func New(ctx *node.ServiceContext, config *Config) (*Kowala, error) {
 	}
 	kusd.validator = validator.New(walletAccount, kusd, networkContract, kusd.chainConfig, kusd.EventMux(), kusd.engine, vmConfig)
 	kusd.validator.SetExtra(makeExtraData(config.ExtraData))
+	if config.ValidatorTrace != "" {
+		if kusd.validatorTrace, err = os.Create(ctx.ResolvePath(config.ValidatorTrace)); err != nil {
+			return nil, err
+		}
+		kusd.validator.SetTrace(kusd.validatorTrace)
+	}
 
 	if kusd.protocolManager, err = NewProtocolManager(kusd.chainConfig, config.SyncMode, config.NetworkId, kusd.eventMux, kusd.txPool, kusd.engine, kusd.blockchain, chainDb, kusd.validator); err != nil {
 		return nil, err
 	}
+	if config.Checkpoint != nil {
+		if config.SyncMode == downloader.FullSync {
+			log.Warn("Checkpoint ignored in full sync mode", "checkpoint", config.Checkpoint)
+		} else {
+			// Checkpoint commits are verified against the validators of the checkpoint state
+			signer := types.NewAndromedaSigner(kusd.chainConfig.ChainID)
+			kusd.protocolManager.downloader.SetCheckpoint(config.Checkpoint, signer, validator.CheckpointValidators(kusd.chainConfig, chainDb))
+		}
+	}
 
 	return kusd, nil
 }
@@ -352,6 +373,7 @@ func (s *Kowala) StartValidating() error {
 	atomic.StoreUint32(&s.protocolManager.acceptTxs, 1)
 
 	go s.validator.Start(cb, dep)
+	s.updateEnrEntry(true)
 	return nil
 }
 
@@ -359,6 +381,7 @@ func (s *Kowala) StopValidating() {
 	if err := s.validator.Stop(); err != nil {
 		log.Error("Error stopping Consensus", "err", err)
 	}
+	s.updateEnrEntry(false)
 }
 
 func (s *Kowala) IsValidating() bool             { return s.validator.Validating() }
@@ -378,7 +401,14 @@ func (s *Kowala) Downloader() *downloader.Downloader { return s.protocolManager.
 // Protocols implements node.Service, returning all the currently configured
 // network protocols to start.
 func (s *Kowala) Protocols() []p2p.Protocol {
-	return s.protocolManager.SubProtocols
+	protos := make([]p2p.Protocol, len(s.protocolManager.SubProtocols))
+	copy(protos, s.protocolManager.SubProtocols)
+
+	// Advertise the chain and the role of the node in discovery
+	for i := range protos {
+		protos[i].Attributes = []enr.Entry{s.enrEntry(s.IsValidating())}
+	}
+	return protos
 }
 
 // Start implements node.Service, starting all internal goroutines needed by the
@@ -389,6 +419,9 @@ func (s *Kowala) Start(srvr *p2p.Server) error {
 
 	// Start the RPC service
 	s.netRPCService = kusdapi.NewPublicNetAPI(srvr, s.NetVersion())
+	s.lock.Lock()
+	s.p2pServer = srvr
+	s.lock.Unlock()
 
 	// Figure out a max peers count based on the server limits
 	maxPeers := srvr.MaxPeers
@@ -399,6 +432,10 @@ func (s *Kowala) Start(srvr *p2p.Server) error {
 		}
 	}
 	// Start the networking layer and the light server if requested
+	// Validators hidden behind sentries don't disclose their node in announcements
+	if !srvr.BehindSentry {
+		s.protocolManager.self = srvr.Self().ID
+	}
 	s.protocolManager.Start(maxPeers)
 	return nil
 }
@@ -410,6 +447,9 @@ func (s *Kowala) Stop() error {
 	// otherwise it might not be able to finish an election and
 	// could be punished
 	s.StopValidating()
+	if s.validatorTrace != nil {
+		s.validatorTrace.Close()
+	}
 	s.bloomIndexer.Close()
 	s.blockchain.Stop()
 	s.protocolManager.Stop()
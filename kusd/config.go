@@ -6,6 +6,7 @@ import (
 	"github.com/kowala-tech/kUSD/common"
 	"github.com/kowala-tech/kUSD/common/hexutil"
 	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/types"
 	"github.com/kowala-tech/kUSD/kusd/downloader"
 	"github.com/kowala-tech/kUSD/kusd/gasprice"
 )
@@ -36,6 +37,9 @@ type Config struct {
 	NetworkId uint64 // Network ID to use for selecting peers to connect to
 	SyncMode  downloader.SyncMode
 
+	// Trusted block to anchor the fast sync of an empty chain at
+	Checkpoint *types.Checkpoint `toml:"-"`
+
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
@@ -52,6 +56,9 @@ type Config struct {
 	ExtraData []byte         `toml:",omitempty"`
 	GasPrice  *big.Int
 
+	// File recording the consensus state machine for replays, if any
+	ValidatorTrace string `toml:",omitempty"`
+
 	// Transaction pool options
 	TxPool core.TxPoolConfig
 
@@ -0,0 +1,340 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/log"
+)
+
+// maxBackfillBatches is the number of block batches backfilled per invocation,
+// so that the retrieval of old history doesn't hold up the live sync for long.
+const maxBackfillBatches = 16
+
+var (
+	errInvalidCheckpoint       = errors.New("retrieved checkpoint block is invalid")
+	errInvalidCheckpointCommit = errors.New("retrieved checkpoint commit is invalid")
+	errCancelCheckpointFetch   = errors.New("checkpoint download canceled (requested)")
+)
+
+// SetCheckpoint configures a trusted checkpoint from which a fast sync starting
+// with an empty chain is anchored, skipping the history before it. The commit
+// of the checkpoint is verified against the validators returned by validators,
+// loaded from the checkpoint state once synchronised.
+func (d *Downloader) SetCheckpoint(cp *types.Checkpoint, signer types.Signer, validators func(*types.Header) (*types.ValidatorSet, error)) {
+	d.checkpoint, d.checkpointSigner, d.checkpointValidators = cp, signer, validators
+}
+
+// syncCheckpoint retrieves the checkpoint block along with its child and the
+// commit of the child from the peer, downloads the state at the checkpoint root,
+// verifies that the validators registered in it finalised the child and anchors
+// the local chain to the checkpoint block.
+func (d *Downloader) syncCheckpoint(p *peerConnection) error {
+	cp := d.checkpoint
+	p.log.Info("Synchronising from checkpoint", "number", cp.Number, "hash", cp.Hash)
+
+	// Retrieve the checkpoint header and its descendants, the grandchild holding
+	// the commit of the child
+	var headers []*types.Header
+	err := d.fetchCheckpointData(p, func() error {
+		return p.peer.RequestHeadersByNumber(cp.Number, 3, 0, false)
+	}, func(packet dataPack) bool {
+		pack, ok := packet.(*headerPack)
+		if ok {
+			headers = pack.headers
+		}
+		return ok
+	})
+	if err != nil {
+		return err
+	}
+	if len(headers) != 3 || headers[1].ParentHash != headers[0].Hash() || headers[2].ParentHash != headers[1].Hash() {
+		p.log.Debug("Invalid checkpoint headers", "count", len(headers))
+		return errBadPeer
+	}
+	if headers[0].Number.Uint64() != cp.Number || headers[0].Hash() != cp.Hash {
+		p.log.Warn("Peer on a different chain than the checkpoint", "number", headers[0].Number, "hash", headers[0].Hash())
+		return errInvalidCheckpoint
+	}
+	bodies, err := d.fetchBodiesOf(p, []*types.Header{headers[0], headers[2]})
+	if err != nil {
+		return err
+	}
+	verified := *cp
+	if verified.Commit == nil {
+		verified.Commit = bodies[1].LastCommit()
+	}
+	verify := func(validators *types.ValidatorSet) error {
+		err := verified.Verify(d.checkpointSigner, validators, headers[1])
+		switch {
+		case err == nil:
+			return nil
+		case cp.Commit != nil || err == types.ErrCheckpointValidatorsMismatch:
+			return fmt.Errorf("checkpoint rejected: %v", err)
+		default:
+			p.log.Warn("Invalid checkpoint commit", "err", err)
+			return errInvalidCheckpointCommit
+		}
+	}
+	// Reject commits not signed by the validators carried by the checkpoint
+	// before spending a state sync on them
+	trusted, err := cp.ValidatorSet()
+	if err != nil {
+		return fmt.Errorf("checkpoint rejected: %v", err)
+	}
+	if trusted != nil {
+		if err := verify(trusted); err != nil {
+			return err
+		}
+	}
+	receipts, err := d.fetchReceiptsOf(p, headers[:1])
+	if err != nil {
+		return err
+	}
+	root := headers[0].Root
+	log.Info("Synchronising checkpoint state", "number", cp.Number, "root", root)
+
+	sync := d.syncState(root, d.snapSync)
+	defer sync.Cancel()
+
+	select {
+	case <-sync.done:
+		if sync.err != nil {
+			return sync.err
+		}
+	case <-d.cancelCh:
+		return errCancelStateFetch
+	}
+	// The state is authenticated by the checkpoint hash, and so are the
+	// validators registered in it
+	validators, err := d.checkpointValidators(headers[0])
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoint validators: %v", err)
+	}
+	if err := verify(validators); err != nil {
+		return err
+	}
+	log.Info("Checkpoint verified", "number", cp.Number, "validators", validators.Size())
+	return d.blockchain.InsertCheckpoint(bodies[0], receipts[0])
+}
+
+// Backfill retrieves the history preceding the oldest block of a chain that
+// was synchronised from a checkpoint, a few batches at a time. It is a no-op if
+// the history is complete or another sync is running.
+func (d *Downloader) Backfill(id string) error {
+	err := d.backfill(id)
+	switch err {
+	case nil, errBusy:
+	case errTimeout, errBadPeer:
+		log.Warn("History backfill failed, dropping peer", "peer", id, "err", err)
+		d.dropPeer(id, err)
+	default:
+		log.Warn("History backfill failed", "peer", id, "err", err)
+	}
+	return err
+}
+
+func (d *Downloader) backfill(id string) error {
+	if d.blockchain.HistoryTail() == nil {
+		return nil
+	}
+	if !atomic.CompareAndSwapInt32(&d.synchronising, 0, 1) {
+		return errBusy
+	}
+	defer atomic.StoreInt32(&d.synchronising, 0)
+
+	p := d.peers.Peer(id)
+	if p == nil {
+		return errUnknownPeer
+	}
+	d.cancelLock.Lock()
+	d.cancelCh = make(chan struct{})
+	d.cancelPeer = id
+	d.cancelLock.Unlock()
+
+	defer d.Cancel()
+
+	for i := 0; i < maxBackfillBatches; i++ {
+		tail := d.blockchain.HistoryTail()
+		if tail == nil {
+			return nil
+		}
+		if err := d.backfillBatch(p, tail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillBatch retrieves and inserts the batch of blocks right below the
+// history tail. The headers are authenticated by the hash chain leading to the
+// tail, the bodies and receipts by the headers.
+func (d *Downloader) backfillBatch(p *peerConnection, tail *types.Header) error {
+	last := tail.Number.Uint64() - 1
+	from := uint64(1)
+	if last >= uint64(MaxBlockFetch) {
+		from = last - uint64(MaxBlockFetch) + 1
+	}
+	amount := int(last - from + 1)
+
+	var headers []*types.Header
+	err := d.fetchCheckpointData(p, func() error {
+		return p.peer.RequestHeadersByNumber(from, amount, 0, false)
+	}, func(packet dataPack) bool {
+		pack, ok := packet.(*headerPack)
+		if ok {
+			headers = pack.headers
+		}
+		return ok
+	})
+	if err != nil {
+		return err
+	}
+	if len(headers) != amount {
+		p.log.Debug("Incomplete history headers", "have", len(headers), "want", amount)
+		return errBadPeer
+	}
+	for i := 1; i < len(headers); i++ {
+		if headers[i].ParentHash != headers[i-1].Hash() {
+			p.log.Debug("Non contiguous history headers", "number", headers[i].Number)
+			return errBadPeer
+		}
+	}
+	if headers[len(headers)-1].Hash() != tail.ParentHash {
+		p.log.Debug("History headers not linking to tail", "tail", tail.Number)
+		return errBadPeer
+	}
+	blocks, err := d.fetchBodiesOf(p, headers)
+	if err != nil {
+		return err
+	}
+	receipts, err := d.fetchReceiptsOf(p, headers)
+	if err != nil {
+		return err
+	}
+	return d.blockchain.InsertHistory(blocks, receipts)
+}
+
+// fetchBodiesOf retrieves the bodies of a batch of headers from a peer, until
+// all of them are delivered, and assembles the blocks.
+func (d *Downloader) fetchBodiesOf(p *peerConnection, headers []*types.Header) (types.Blocks, error) {
+	blocks := make(types.Blocks, 0, len(headers))
+	for len(blocks) < len(headers) {
+		pending := headers[len(blocks):]
+		if len(pending) > MaxBodyFetch {
+			pending = pending[:MaxBodyFetch]
+		}
+		hashes := make([]common.Hash, len(pending))
+		for i, header := range pending {
+			hashes[i] = header.Hash()
+		}
+		var pack *bodyPack
+		err := d.fetchCheckpointData(p, func() error {
+			return p.peer.RequestBodies(hashes)
+		}, func(packet dataPack) (ok bool) {
+			pack, ok = packet.(*bodyPack)
+			return ok
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(pack.transactions) == 0 || len(pack.transactions) > len(pending) || len(pack.commits) != len(pack.transactions) {
+			p.log.Debug("Invalid block bodies", "count", len(pack.transactions), "requested", len(pending))
+			return nil, errBadPeer
+		}
+		for i, txs := range pack.transactions {
+			header := pending[i]
+			if types.DeriveSha(types.Transactions(txs)) != header.TxHash || commitHash(pack.commits[i]) != header.LastCommitHash {
+				p.log.Debug("Invalid block body", "number", header.Number, "hash", header.Hash())
+				return nil, errBadPeer
+			}
+			blocks = append(blocks, types.NewBlockWithHeader(header).WithBody(txs, pack.commits[i]))
+		}
+	}
+	return blocks, nil
+}
+
+// fetchReceiptsOf retrieves the receipts of a batch of headers from a peer,
+// until all of them are delivered.
+func (d *Downloader) fetchReceiptsOf(p *peerConnection, headers []*types.Header) ([]types.Receipts, error) {
+	receipts := make([]types.Receipts, 0, len(headers))
+	for len(receipts) < len(headers) {
+		pending := headers[len(receipts):]
+		if len(pending) > MaxReceiptFetch {
+			pending = pending[:MaxReceiptFetch]
+		}
+		hashes := make([]common.Hash, len(pending))
+		for i, header := range pending {
+			hashes[i] = header.Hash()
+		}
+		var pack *receiptPack
+		err := d.fetchCheckpointData(p, func() error {
+			return p.peer.RequestReceipts(hashes)
+		}, func(packet dataPack) (ok bool) {
+			pack, ok = packet.(*receiptPack)
+			return ok
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(pack.receipts) == 0 || len(pack.receipts) > len(pending) {
+			p.log.Debug("Invalid block receipts", "count", len(pack.receipts), "requested", len(pending))
+			return nil, errBadPeer
+		}
+		for i, list := range pack.receipts {
+			if types.DeriveSha(types.Receipts(list)) != pending[i].ReceiptHash {
+				p.log.Debug("Invalid block receipts", "number", pending[i].Number, "hash", pending[i].Hash())
+				return nil, errBadPeer
+			}
+			receipts = append(receipts, list)
+		}
+	}
+	return receipts, nil
+}
+
+// fetchCheckpointData sends a single request to a peer and waits for the reply,
+// handing the packets delivered by the peer to accept until it takes one.
+// Packets from other peers or of other types are discarded.
+func (d *Downloader) fetchCheckpointData(p *peerConnection, request func() error, accept func(dataPack) bool) error {
+	if err := request(); err != nil {
+		return err
+	}
+	ttl := d.requestTTL()
+	timeout := time.NewTimer(ttl)
+	defer timeout.Stop()
+
+	for {
+		var packet dataPack
+		select {
+		case <-d.cancelCh:
+			return errCancelCheckpointFetch
+
+		case <-timeout.C:
+			p.log.Debug("Checkpoint data request timed out", "elapsed", ttl)
+			return errTimeout
+
+		case packet = <-d.headerCh:
+		case packet = <-d.bodyCh:
+		case packet = <-d.receiptCh:
+		}
+		if packet.PeerId() != p.id {
+			log.Debug("Received data from incorrect peer", "peer", packet.PeerId())
+			continue
+		}
+		if accept(packet) {
+			return nil
+		}
+	}
+}
+
+// commitHash returns the hash a header commits to for the given block commit.
+func commitHash(commit *types.Commit) common.Hash {
+	if commit == nil {
+		return common.Hash{}
+	}
+	return commit.Hash()
+}
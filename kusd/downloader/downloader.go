@@ -78,8 +78,9 @@ var (
 )
 
 type Downloader struct {
-	mode SyncMode       // Synchronisation mode defining the strategy used (per sync cycle)
-	mux  *event.TypeMux // Event multiplexer to announce sync operation events
+	mode     SyncMode       // Synchronisation mode defining the strategy used (per sync cycle)
+	snapSync bool           // Whether the state of a fast sync is retrieved in ranges (per sync cycle)
+	mux      *event.TypeMux // Event multiplexer to announce sync operation events
 
 	queue   *queue   // Scheduler for selecting the hashes to download
 	peers   *peerSet // Set of active peers from which download can proceed
@@ -88,6 +89,10 @@ type Downloader struct {
 	fsPivotLock  *types.Header // Pivot header on critical section entry (cannot change between retries)
 	fsPivotFails uint32        // Number of subsequent fast sync failures in the critical section
 
+	checkpoint           *types.Checkpoint                                // Trusted block to anchor a fast sync of an empty chain at
+	checkpointSigner     types.Signer                                     // Signer recovering the senders of the checkpoint commit
+	checkpointValidators func(*types.Header) (*types.ValidatorSet, error) // Loads the validators from the synchronised checkpoint state
+
 	rttEstimate   uint64 // Round trip time to target for download requests
 	rttConfidence uint64 // Confidence in the estimated RTT (unit: millionths to allow atomic ops)
 
@@ -120,6 +125,7 @@ type Downloader struct {
 	stateSyncStart chan *stateSync
 	trackStateReq  chan *stateReq
 	stateCh        chan dataPack // [eth/63] Channel receiving inbound node state data
+	snapCh         chan dataPack // Channel receiving inbound account and storage ranges
 
 	// Cancellation and termination
 	cancelPeer string        // Identifier of the peer currently being used as the master (cancel on drop)
@@ -178,6 +184,15 @@ type BlockChain interface {
 
 	// InsertReceiptChain inserts a batch of receipts into the local chain.
 	InsertReceiptChain(types.Blocks, []types.Receipts) (int, error)
+
+	// InsertCheckpoint anchors the local chain at a checkpoint block with a known state.
+	InsertCheckpoint(*types.Block, types.Receipts) error
+
+	// HistoryTail retrieves the oldest block header with a known history, if incomplete.
+	HistoryTail() *types.Header
+
+	// InsertHistory inserts a batch of blocks right below the history tail.
+	InsertHistory(types.Blocks, []types.Receipts) error
 }
 
 // New creates a new downloader to fetch hashes and blocks from remote peers.
@@ -205,6 +220,7 @@ func New(mode SyncMode, stateDb kusddb.Database, mux *event.TypeMux, chain Block
 		headerProcCh:   make(chan []*types.Header, 1),
 		quitCh:         make(chan struct{}),
 		stateCh:        make(chan dataPack),
+		snapCh:         make(chan dataPack),
 		stateSyncStart: make(chan *stateSync),
 		trackStateReq:  make(chan *stateReq),
 	}
@@ -292,6 +308,17 @@ func (d *Downloader) UnregisterPeer(id string) error {
 	return nil
 }
 
+// IsInvalidData reports whether a synchronisation error proves that the peer
+// delivered invalid data, as opposed to it being slow, stalling or lacking the
+// data it advertised.
+func IsInvalidData(err error) bool {
+	switch err {
+	case errBadPeer, errInvalidAncestor, errInvalidChain, errInvalidCheckpoint, errInvalidCheckpointCommit:
+		return true
+	}
+	return false
+}
+
 // Synchronise tries to sync up our local block chain with a remote peer, both
 // adding various sanity checks as well as wrapping it with various log entries.
 func (d *Downloader) Synchronise(id string, head common.Hash, blockNumber *big.Int, mode SyncMode) error {
@@ -302,9 +329,10 @@ func (d *Downloader) Synchronise(id string, head common.Hash, blockNumber *big.I
 
 	case errTimeout, errBadPeer, errStallingPeer,
 		errEmptyHeaderSet, errPeersUnavailable,
-		errInvalidAncestor, errInvalidChain:
+		errInvalidAncestor, errInvalidChain,
+		errInvalidCheckpoint, errInvalidCheckpointCommit:
 		log.Warn("Synchronisation failed, dropping peer", "peer", id, "err", err)
-		d.dropPeer(id)
+		d.dropPeer(id, err)
 
 	default:
 		log.Warn("Synchronisation failed, retrying", "err", err)
@@ -364,8 +392,12 @@ func (d *Downloader) synchronise(id string, hash common.Hash, blockNumber *big.I
 
 	defer d.Cancel() // No matter what, we can't leave the cancel channel open
 
-	// Set the requested sync mode, unless it's forbidden
-	d.mode = mode
+	// Set the requested sync mode, unless it's forbidden. Snap sync is a fast
+	// sync retrieving its state in ranges.
+	d.mode, d.snapSync = mode, false
+	if d.mode == SnapSync {
+		d.mode, d.snapSync = FastSync, true
+	}
 	if d.mode == FastSync && atomic.LoadUint32(&d.fsPivotFails) >= fsCriticalTrials {
 		d.mode = FullSync
 	}
@@ -402,8 +434,15 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, blockNumb
 	}
 	height := latest.Number.Uint64()
 
-	origin, err := d.findAncestor(p, height)
-	if err != nil {
+	// Anchor an empty chain at the checkpoint once the peer has the commit of
+	// its child, and sync the rest block by block
+	var origin uint64
+	if d.mode == FastSync && d.checkpoint != nil && d.blockchain.CurrentBlock().NumberU64() == 0 && height > d.checkpoint.Number+1 {
+		if err := d.syncCheckpoint(p); err != nil {
+			return err
+		}
+		d.mode, origin = FullSync, d.checkpoint.Number
+	} else if origin, err = d.findAncestor(p, height); err != nil {
 		return err
 	}
 	d.syncStatsLock.Lock()
@@ -833,7 +872,7 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
 			// Header retrieval timed out, consider the peer bad and drop
 			p.log.Debug("Header request timed out", "elapsed", ttl)
 			headerTimeoutMeter.Mark(1)
-			d.dropPeer(p.id)
+			d.dropPeer(p.id, errTimeout)
 
 			// Finish the sync gracefully instead of dumping the gathered data though
 			for _, ch := range []chan bool{d.bodyWakeCh, d.receiptWakeCh} {
@@ -846,7 +885,7 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64) error {
 			case d.headerProcCh <- nil:
 			case <-d.cancelCh:
 			}
-			return errBadPeer
+			return errTimeout
 		}
 	}
 }
@@ -1048,7 +1087,7 @@ func (d *Downloader) fetchParts(errCancel error, deliveryCh chan dataPack, deliv
 						setIdle(peer, 0)
 					} else {
 						peer.log.Debug("Stalling delivery, dropping", "type", kind)
-						d.dropPeer(pid)
+						d.dropPeer(pid, errStallingPeer)
 					}
 				}
 			}
@@ -1346,9 +1385,9 @@ func (d *Downloader) importBlockResults(results []*fetchResult) error {
 // processFastSyncContent takes fetch results from the queue and writes them to the
 // database. It also controls the synchronisation of state nodes of the pivot block.
 func (d *Downloader) processFastSyncContent(latest *types.Header) error {
-	// Start syncing state of the reported head block.
+	// Start syncing state of the reported head block, in ranges if snap syncing.
 	// This should get us most of the state of the pivot block.
-	stateSync := d.syncState(latest.Root)
+	stateSync := d.syncState(latest.Root, d.snapSync)
 	defer stateSync.Cancel()
 	go func() {
 		if err := stateSync.Wait(); err != nil {
@@ -1356,11 +1395,19 @@ func (d *Downloader) processFastSyncContent(latest *types.Header) error {
 		}
 	}()
 
-	pivot := d.queue.FastSyncPivot()
+	var (
+		pivot     = d.queue.FastSyncPivot()
+		committed = pivot == 0 // Whether the head state is complete without the head state sync
+	)
 	for {
 		results := d.queue.WaitResults()
 		if len(results) == 0 {
-			return stateSync.Cancel()
+			// The head state sync is superseded by the pivot block commit, or by
+			// the import of every block if there is no pivot
+			if err := stateSync.Cancel(); err != errCancelStateFetch || !committed {
+				return err
+			}
+			return nil
 		}
 		if d.chainInsertHook != nil {
 			d.chainInsertHook(results)
@@ -1374,6 +1421,7 @@ func (d *Downloader) processFastSyncContent(latest *types.Header) error {
 			if err := d.commitPivotBlock(P); err != nil {
 				return err
 			}
+			committed = true
 		}
 		if err := d.importBlockResults(afterP); err != nil {
 			return err
@@ -1435,7 +1483,7 @@ func (d *Downloader) commitPivotBlock(result *fetchResult) error {
 	b := types.NewBlockWithHeader(result.Header).WithBody(result.Transactions, result.Commit)
 	// Sync the pivot block state. This should complete reasonably quickly because
 	// we've already synced up to the reported head block state earlier.
-	if err := d.syncState(b.Root()).Wait(); err != nil {
+	if err := d.syncState(b.Root(), false).Wait(); err != nil {
 		return err
 	}
 	log.Debug("Committing fast sync pivot as new head", "number", b.Number(), "hash", b.Hash())
@@ -1466,6 +1514,16 @@ func (d *Downloader) DeliverNodeData(id string, data [][]byte) (err error) {
 	return d.deliver(id, d.stateCh, &statePack{id, data}, stateInMeter, stateDropMeter)
 }
 
+// DeliverAccountRange injects a range of accounts received from a remote node.
+func (d *Downloader) DeliverAccountRange(id string, hashes []common.Hash, accounts [][]byte, proof [][]byte) (err error) {
+	return d.deliver(id, d.snapCh, &rangePack{id, hashes, accounts, proof}, accountRangeInMeter, accountRangeDropMeter)
+}
+
+// DeliverStorageRange injects a range of storage slots received from a remote node.
+func (d *Downloader) DeliverStorageRange(id string, hashes []common.Hash, slots [][]byte, proof [][]byte) (err error) {
+	return d.deliver(id, d.snapCh, &rangePack{id, hashes, slots, proof}, storageRangeInMeter, storageRangeDropMeter)
+}
+
 // deliver injects a new batch of data received from a remote node.
 func (d *Downloader) deliver(id string, destCh chan dataPack, packet dataPack, inMeter, dropMeter metrics.Meter) (err error) {
 	// Update the delivery metrics for both good and failed deliveries
@@ -1,6 +1,7 @@
 package downloader
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math/big"
@@ -69,7 +70,7 @@ func newTester() *downloadTester {
 		ownHeaders:        map[common.Hash]*types.Header{genesis.Hash(): genesis.Header()},
 		ownBlocks:         map[common.Hash]*types.Block{genesis.Hash(): genesis},
 		ownReceipts:       map[common.Hash]types.Receipts{genesis.Hash(): nil},
-		ownChainTd:        map[common.Hash]*big.Int{genesis.Hash(): genesis.Difficulty()},
+		ownChainTd:        map[common.Hash]*big.Int{genesis.Hash(): genesis.Number()},
 		peerHashes:        make(map[string][]common.Hash),
 		peerHeaders:       make(map[string]map[common.Hash]*types.Header),
 		peerBlocks:        make(map[string]map[common.Hash]*types.Block),
@@ -78,7 +79,7 @@ func newTester() *downloadTester {
 		peerMissingStates: make(map[string]map[common.Hash]bool),
 	}
 	tester.stateDb, _ = kusddb.NewMemDatabase()
-	tester.stateDb.Put(genesis.Root().Bytes(), []byte{0x00})
+	core.GenesisBlockForTesting(tester.stateDb, testAddress, big.NewInt(1000000000))
 
 	tester.downloader = New(FullSync, tester.stateDb, new(event.TypeMux), tester, nil, tester.dropPeer)
 
@@ -87,8 +88,7 @@ func newTester() *downloadTester {
 
 // makeChain creates a chain of n blocks starting at and including parent.
 // the returned hash chain is ordered head->parent. In addition, every 3rd block
-// contains a transaction and every 5th an uncle to allow testing correct block
-// reassembly.
+// contains a transaction to allow testing correct block reassembly.
 func (dl *downloadTester) makeChain(n int, seed byte, parent *types.Block, parentReceipts types.Receipts, heavy bool) ([]common.Hash, map[common.Hash]*types.Header, map[common.Hash]*types.Block, map[common.Hash]types.Receipts) {
 	// Generate the block chain
 	blocks, receipts := core.GenerateChain(params.TestChainConfig, parent, dl.peerDb, n, func(i int, block *core.BlockGen) {
@@ -107,13 +107,6 @@ func (dl *downloadTester) makeChain(n int, seed byte, parent *types.Block, paren
 			}
 			block.AddTx(tx)
 		}
-		// If the block number is a multiple of 5, add a bonus uncle to the block
-		if i > 0 && i%5 == 0 {
-			block.AddUncle(&types.Header{
-				ParentHash: block.PrevBlock(i - 1).Hash(),
-				Number:     big.NewInt(block.Number().Int64() - 1),
-			})
-		}
 	})
 	// Convert the block-chain into a hash-chain and header/block maps
 	hashes := make([]common.Hash, n+1)
@@ -314,7 +307,7 @@ func (dl *downloadTester) InsertHeaderChain(headers []*types.Header, checkFreq i
 		}
 		dl.ownHashes = append(dl.ownHashes, header.Hash())
 		dl.ownHeaders[header.Hash()] = header
-		dl.ownChainTd[header.Hash()] = new(big.Int).Add(dl.ownChainTd[header.ParentHash], header.Difficulty)
+		dl.ownChainTd[header.Hash()] = new(big.Int).Set(header.Number)
 	}
 	return len(headers), nil
 }
@@ -335,8 +328,13 @@ func (dl *downloadTester) InsertChain(blocks types.Blocks) (int, error) {
 			dl.ownHeaders[block.Hash()] = block.Header()
 		}
 		dl.ownBlocks[block.Hash()] = block
-		dl.stateDb.Put(block.Root().Bytes(), []byte{0x00})
-		dl.ownChainTd[block.Hash()] = new(big.Int).Add(dl.ownChainTd[block.ParentHash()], block.Difficulty())
+
+		// Mark the state as present, without clobbering an already synced one
+		// shared with earlier blocks
+		if ok, _ := dl.stateDb.Has(block.Root().Bytes()); !ok {
+			dl.stateDb.Put(block.Root().Bytes(), []byte{0x00})
+		}
+		dl.ownChainTd[block.Hash()] = block.Number()
 	}
 	return len(blocks), nil
 }
@@ -359,6 +357,28 @@ func (dl *downloadTester) InsertReceiptChain(blocks types.Blocks, receipts []typ
 	return len(blocks), nil
 }
 
+// InsertCheckpoint anchors the simulated chain at a checkpoint block.
+func (dl *downloadTester) InsertCheckpoint(block *types.Block, receipts types.Receipts) error {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.ownHashes = append(dl.ownHashes, block.Hash())
+	dl.ownHeaders[block.Hash()] = block.Header()
+	dl.ownBlocks[block.Hash()] = block
+	dl.ownReceipts[block.Hash()] = receipts
+	return nil
+}
+
+// HistoryTail reports the simulated chain history as complete.
+func (dl *downloadTester) HistoryTail() *types.Header {
+	return nil
+}
+
+// InsertHistory rejects history, which is never missing in the simulated chain.
+func (dl *downloadTester) InsertHistory(blocks types.Blocks, receipts []types.Receipts) error {
+	return errors.New("chain history already complete")
+}
+
 // Rollback removes some recently added elements from the chain.
 func (dl *downloadTester) Rollback(hashes []common.Hash) {
 	dl.lock.Lock()
@@ -402,11 +422,11 @@ func (dl *downloadTester) newSlowPeer(id string, version int, hashes []common.Ha
 		genesis := hashes[len(hashes)-1]
 		if header := headers[genesis]; header != nil {
 			dl.peerHeaders[id][genesis] = header
-			dl.peerChainTds[id][genesis] = header.Difficulty
+			dl.peerChainTds[id][genesis] = new(big.Int).Set(header.Number)
 		}
 		if block := blocks[genesis]; block != nil {
 			dl.peerBlocks[id][genesis] = block
-			dl.peerChainTds[id][genesis] = block.Difficulty()
+			dl.peerChainTds[id][genesis] = block.Number()
 		}
 
 		for i := len(hashes) - 2; i >= 0; i-- {
@@ -415,13 +435,13 @@ func (dl *downloadTester) newSlowPeer(id string, version int, hashes []common.Ha
 			if header, ok := headers[hash]; ok {
 				dl.peerHeaders[id][hash] = header
 				if _, ok := dl.peerHeaders[id][header.ParentHash]; ok {
-					dl.peerChainTds[id][hash] = new(big.Int).Add(header.Difficulty, dl.peerChainTds[id][header.ParentHash])
+					dl.peerChainTds[id][hash] = new(big.Int).Set(header.Number)
 				}
 			}
 			if block, ok := blocks[hash]; ok {
 				dl.peerBlocks[id][hash] = block
 				if _, ok := dl.peerBlocks[id][block.ParentHash()]; ok {
-					dl.peerChainTds[id][hash] = new(big.Int).Add(block.Difficulty(), dl.peerChainTds[id][block.ParentHash()])
+					dl.peerChainTds[id][hash] = block.Number()
 				}
 			}
 			if receipt, ok := receipts[hash]; ok {
@@ -433,7 +453,7 @@ func (dl *downloadTester) newSlowPeer(id string, version int, hashes []common.Ha
 }
 
 // dropPeer simulates a hard peer removal from the connection pool.
-func (dl *downloadTester) dropPeer(id string) {
+func (dl *downloadTester) dropPeer(id string, reason error) {
 	dl.lock.Lock()
 	defer dl.lock.Unlock()
 
@@ -535,15 +555,15 @@ func (dlp *downloadTesterPeer) RequestBodies(hashes []common.Hash) error {
 	blocks := dlp.dl.peerBlocks[dlp.id]
 
 	transactions := make([][]*types.Transaction, 0, len(hashes))
-	uncles := make([][]*types.Header, 0, len(hashes))
+	commits := make([]*types.Commit, 0, len(hashes))
 
 	for _, hash := range hashes {
 		if block, ok := blocks[hash]; ok {
 			transactions = append(transactions, block.Transactions())
-			uncles = append(uncles, block.Uncles())
+			commits = append(commits, block.LastCommit())
 		}
 	}
-	go dlp.dl.downloader.DeliverBodies(dlp.id, transactions, uncles)
+	go dlp.dl.downloader.DeliverBodies(dlp.id, transactions, commits)
 
 	return nil
 }
@@ -592,6 +612,89 @@ func (dlp *downloadTesterPeer) RequestNodeData(hashes []common.Hash) error {
 	return nil
 }
 
+// RequestAccountRange constructs a getAccountRange method associated with a
+// particular peer in the download tester, serving ranges of the accounts of
+// the tester state.
+func (dlp *downloadTesterPeer) RequestAccountRange(root common.Hash, origin common.Hash, limit common.Hash, bytes uint64) error {
+	dlp.waitDelay()
+
+	dlp.dl.lock.RLock()
+	defer dlp.dl.lock.RUnlock()
+
+	var hashes []common.Hash
+	var accounts, proof [][]byte
+	if prover, err := state.NewRangeProver(root, dlp.dl.peerDb); err == nil {
+		hashes, accounts, proof, _ = prover.AccountRange(origin, limit, bytes)
+	}
+	go dlp.dl.downloader.DeliverAccountRange(dlp.id, hashes, accounts, proof)
+
+	return nil
+}
+
+// RequestStorageRange constructs a getStorageRange method associated with a
+// particular peer in the download tester, serving ranges of the storage slots
+// of the tester state.
+func (dlp *downloadTesterPeer) RequestStorageRange(root common.Hash, account common.Hash, origin common.Hash, bytes uint64) error {
+	dlp.waitDelay()
+
+	dlp.dl.lock.RLock()
+	defer dlp.dl.lock.RUnlock()
+
+	var hashes []common.Hash
+	var slots, proof [][]byte
+	if prover, err := state.NewRangeProver(root, dlp.dl.peerDb); err == nil {
+		hashes, slots, proof, _ = prover.StorageRange(account, origin, bytes)
+	}
+	go dlp.dl.downloader.DeliverStorageRange(dlp.id, hashes, slots, proof)
+
+	return nil
+}
+
+// rangeTestPeer wraps a download tester peer, counting the state ranges and
+// nodes requested from it. If bad is set, it corrupts the accounts it serves.
+type rangeTestPeer struct {
+	Peer
+	tester *downloadTester
+	id     string
+	bad    bool
+
+	ranges int32 // Number of state ranges requested
+	nodes  int32 // Number of state nodes requested
+}
+
+func (p *rangeTestPeer) RequestAccountRange(root common.Hash, origin common.Hash, limit common.Hash, bytes uint64) error {
+	atomic.AddInt32(&p.ranges, 1)
+	if !p.bad {
+		return p.Peer.RequestAccountRange(root, origin, limit, bytes)
+	}
+	p.tester.lock.RLock()
+	defer p.tester.lock.RUnlock()
+
+	prover, err := state.NewRangeProver(root, p.tester.peerDb)
+	if err != nil {
+		return err
+	}
+	hashes, accounts, proof, err := prover.AccountRange(origin, limit, bytes)
+	if err != nil {
+		return err
+	}
+	if len(accounts) > 0 {
+		accounts[0] = append(common.CopyBytes(accounts[0]), 0x00)
+	}
+	go p.tester.downloader.DeliverAccountRange(p.id, hashes, accounts, proof)
+	return nil
+}
+
+func (p *rangeTestPeer) RequestStorageRange(root common.Hash, account common.Hash, origin common.Hash, bytes uint64) error {
+	atomic.AddInt32(&p.ranges, 1)
+	return p.Peer.RequestStorageRange(root, account, origin, bytes)
+}
+
+func (p *rangeTestPeer) RequestNodeData(hashes []common.Hash) error {
+	atomic.AddInt32(&p.nodes, int32(len(hashes)))
+	return p.Peer.RequestNodeData(hashes)
+}
+
 // assertOwnChain checks if the local chain contains the correct number of items
 // of the various chain components.
 func assertOwnChain(t *testing.T, tester *downloadTester, length int) {
@@ -653,12 +756,13 @@ func assertOwnForkedChain(t *testing.T, tester *downloadTester, common int, leng
 // Tests that simple synchronization against a canonical chain works correctly.
 // In this test common ancestor lookup should be short circuited and not require
 // binary searching.
-func TestCanonicalSynchronisation62(t *testing.T)      { testCanonicalSynchronisation(t, 62, FullSync) }
-func TestCanonicalSynchronisation63Full(t *testing.T)  { testCanonicalSynchronisation(t, 63, FullSync) }
-func TestCanonicalSynchronisation63Fast(t *testing.T)  { testCanonicalSynchronisation(t, 63, FastSync) }
-func TestCanonicalSynchronisation64Full(t *testing.T)  { testCanonicalSynchronisation(t, 64, FullSync) }
-func TestCanonicalSynchronisation64Fast(t *testing.T)  { testCanonicalSynchronisation(t, 64, FastSync) }
-func TestCanonicalSynchronisation64Light(t *testing.T) { testCanonicalSynchronisation(t, 64, LightSync) }
+func TestCanonicalSynchronisation1(t *testing.T)      { testCanonicalSynchronisation(t, 1, FullSync) }
+func TestCanonicalSynchronisation2Full(t *testing.T)  { testCanonicalSynchronisation(t, 2, FullSync) }
+func TestCanonicalSynchronisation2Fast(t *testing.T)  { testCanonicalSynchronisation(t, 2, FastSync) }
+func TestCanonicalSynchronisation3Full(t *testing.T)  { testCanonicalSynchronisation(t, 3, FullSync) }
+func TestCanonicalSynchronisation3Fast(t *testing.T)  { testCanonicalSynchronisation(t, 3, FastSync) }
+func TestCanonicalSynchronisation3Light(t *testing.T) { testCanonicalSynchronisation(t, 3, LightSync) }
+func TestCanonicalSynchronisation3Snap(t *testing.T)  { testCanonicalSynchronisation(t, 3, SnapSync) }
 
 func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -681,11 +785,11 @@ func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 
 // Tests that if a large batch of blocks are being downloaded, it is throttled
 // until the cached blocks are retrieved.
-func TestThrottling62(t *testing.T)     { testThrottling(t, 62, FullSync) }
-func TestThrottling63Full(t *testing.T) { testThrottling(t, 63, FullSync) }
-func TestThrottling63Fast(t *testing.T) { testThrottling(t, 63, FastSync) }
-func TestThrottling64Full(t *testing.T) { testThrottling(t, 64, FullSync) }
-func TestThrottling64Fast(t *testing.T) { testThrottling(t, 64, FastSync) }
+func TestThrottling1(t *testing.T)     { testThrottling(t, 1, FullSync) }
+func TestThrottling2Full(t *testing.T) { testThrottling(t, 2, FullSync) }
+func TestThrottling2Fast(t *testing.T) { testThrottling(t, 2, FastSync) }
+func TestThrottling3Full(t *testing.T) { testThrottling(t, 3, FullSync) }
+func TestThrottling3Fast(t *testing.T) { testThrottling(t, 3, FastSync) }
 
 func testThrottling(t *testing.T, protocol int, mode SyncMode) {
 	tester := newTester()
@@ -766,12 +870,12 @@ func testThrottling(t *testing.T, protocol int, mode SyncMode) {
 // Tests that simple synchronization against a forked chain works correctly. In
 // this test common ancestor lookup should *not* be short circuited, and a full
 // binary search should be executed.
-func TestForkedSync62(t *testing.T)      { testForkedSync(t, 62, FullSync) }
-func TestForkedSync63Full(t *testing.T)  { testForkedSync(t, 63, FullSync) }
-func TestForkedSync63Fast(t *testing.T)  { testForkedSync(t, 63, FastSync) }
-func TestForkedSync64Full(t *testing.T)  { testForkedSync(t, 64, FullSync) }
-func TestForkedSync64Fast(t *testing.T)  { testForkedSync(t, 64, FastSync) }
-func TestForkedSync64Light(t *testing.T) { testForkedSync(t, 64, LightSync) }
+func TestForkedSync1(t *testing.T)      { testForkedSync(t, 1, FullSync) }
+func TestForkedSync2Full(t *testing.T)  { testForkedSync(t, 2, FullSync) }
+func TestForkedSync2Fast(t *testing.T)  { testForkedSync(t, 2, FastSync) }
+func TestForkedSync3Full(t *testing.T)  { testForkedSync(t, 3, FullSync) }
+func TestForkedSync3Fast(t *testing.T)  { testForkedSync(t, 3, FastSync) }
+func TestForkedSync3Light(t *testing.T) { testForkedSync(t, 3, LightSync) }
 
 func testForkedSync(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -801,12 +905,12 @@ func testForkedSync(t *testing.T, protocol int, mode SyncMode) {
 
 // Tests that synchronising against a much shorter but much heavyer fork works
 // corrently and is not dropped.
-func TestHeavyForkedSync62(t *testing.T)      { testHeavyForkedSync(t, 62, FullSync) }
-func TestHeavyForkedSync63Full(t *testing.T)  { testHeavyForkedSync(t, 63, FullSync) }
-func TestHeavyForkedSync63Fast(t *testing.T)  { testHeavyForkedSync(t, 63, FastSync) }
-func TestHeavyForkedSync64Full(t *testing.T)  { testHeavyForkedSync(t, 64, FullSync) }
-func TestHeavyForkedSync64Fast(t *testing.T)  { testHeavyForkedSync(t, 64, FastSync) }
-func TestHeavyForkedSync64Light(t *testing.T) { testHeavyForkedSync(t, 64, LightSync) }
+func TestHeavyForkedSync1(t *testing.T)      { testHeavyForkedSync(t, 1, FullSync) }
+func TestHeavyForkedSync2Full(t *testing.T)  { testHeavyForkedSync(t, 2, FullSync) }
+func TestHeavyForkedSync2Fast(t *testing.T)  { testHeavyForkedSync(t, 2, FastSync) }
+func TestHeavyForkedSync3Full(t *testing.T)  { testHeavyForkedSync(t, 3, FullSync) }
+func TestHeavyForkedSync3Fast(t *testing.T)  { testHeavyForkedSync(t, 3, FastSync) }
+func TestHeavyForkedSync3Light(t *testing.T) { testHeavyForkedSync(t, 3, LightSync) }
 
 func testHeavyForkedSync(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -837,12 +941,12 @@ func testHeavyForkedSync(t *testing.T, protocol int, mode SyncMode) {
 // Tests that chain forks are contained within a certain interval of the current
 // chain head, ensuring that malicious peers cannot waste resources by feeding
 // long dead chains.
-func TestBoundedForkedSync62(t *testing.T)      { testBoundedForkedSync(t, 62, FullSync) }
-func TestBoundedForkedSync63Full(t *testing.T)  { testBoundedForkedSync(t, 63, FullSync) }
-func TestBoundedForkedSync63Fast(t *testing.T)  { testBoundedForkedSync(t, 63, FastSync) }
-func TestBoundedForkedSync64Full(t *testing.T)  { testBoundedForkedSync(t, 64, FullSync) }
-func TestBoundedForkedSync64Fast(t *testing.T)  { testBoundedForkedSync(t, 64, FastSync) }
-func TestBoundedForkedSync64Light(t *testing.T) { testBoundedForkedSync(t, 64, LightSync) }
+func TestBoundedForkedSync1(t *testing.T)      { testBoundedForkedSync(t, 1, FullSync) }
+func TestBoundedForkedSync2Full(t *testing.T)  { testBoundedForkedSync(t, 2, FullSync) }
+func TestBoundedForkedSync2Fast(t *testing.T)  { testBoundedForkedSync(t, 2, FastSync) }
+func TestBoundedForkedSync3Full(t *testing.T)  { testBoundedForkedSync(t, 3, FullSync) }
+func TestBoundedForkedSync3Fast(t *testing.T)  { testBoundedForkedSync(t, 3, FastSync) }
+func TestBoundedForkedSync3Light(t *testing.T) { testBoundedForkedSync(t, 3, LightSync) }
 
 func testBoundedForkedSync(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -872,12 +976,12 @@ func testBoundedForkedSync(t *testing.T, protocol int, mode SyncMode) {
 // Tests that chain forks are contained within a certain interval of the current
 // chain head for short but heavy forks too. These are a bit special because they
 // take different ancestor lookup paths.
-func TestBoundedHeavyForkedSync62(t *testing.T)      { testBoundedHeavyForkedSync(t, 62, FullSync) }
-func TestBoundedHeavyForkedSync63Full(t *testing.T)  { testBoundedHeavyForkedSync(t, 63, FullSync) }
-func TestBoundedHeavyForkedSync63Fast(t *testing.T)  { testBoundedHeavyForkedSync(t, 63, FastSync) }
-func TestBoundedHeavyForkedSync64Full(t *testing.T)  { testBoundedHeavyForkedSync(t, 64, FullSync) }
-func TestBoundedHeavyForkedSync64Fast(t *testing.T)  { testBoundedHeavyForkedSync(t, 64, FastSync) }
-func TestBoundedHeavyForkedSync64Light(t *testing.T) { testBoundedHeavyForkedSync(t, 64, LightSync) }
+func TestBoundedHeavyForkedSync1(t *testing.T)      { testBoundedHeavyForkedSync(t, 1, FullSync) }
+func TestBoundedHeavyForkedSync2Full(t *testing.T)  { testBoundedHeavyForkedSync(t, 2, FullSync) }
+func TestBoundedHeavyForkedSync2Fast(t *testing.T)  { testBoundedHeavyForkedSync(t, 2, FastSync) }
+func TestBoundedHeavyForkedSync3Full(t *testing.T)  { testBoundedHeavyForkedSync(t, 3, FullSync) }
+func TestBoundedHeavyForkedSync3Fast(t *testing.T)  { testBoundedHeavyForkedSync(t, 3, FastSync) }
+func TestBoundedHeavyForkedSync3Light(t *testing.T) { testBoundedHeavyForkedSync(t, 3, LightSync) }
 
 func testBoundedHeavyForkedSync(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -906,7 +1010,7 @@ func testBoundedHeavyForkedSync(t *testing.T, protocol int, mode SyncMode) {
 
 // Tests that an inactive downloader will not accept incoming block headers and
 // bodies.
-func TestInactiveDownloader62(t *testing.T) {
+func TestInactiveDownloader1(t *testing.T) {
 	t.Parallel()
 
 	tester := newTester()
@@ -916,14 +1020,14 @@ func TestInactiveDownloader62(t *testing.T) {
 	if err := tester.downloader.DeliverHeaders("bad peer", []*types.Header{}); err != errNoSyncActive {
 		t.Errorf("error mismatch: have %v, want %v", err, errNoSyncActive)
 	}
-	if err := tester.downloader.DeliverBodies("bad peer", [][]*types.Transaction{}, [][]*types.Header{}); err != errNoSyncActive {
+	if err := tester.downloader.DeliverBodies("bad peer", [][]*types.Transaction{}, []*types.Commit{}); err != errNoSyncActive {
 		t.Errorf("error mismatch: have %v, want %v", err, errNoSyncActive)
 	}
 }
 
 // Tests that an inactive downloader will not accept incoming block headers,
 // bodies and receipts.
-func TestInactiveDownloader63(t *testing.T) {
+func TestInactiveDownloader2(t *testing.T) {
 	t.Parallel()
 
 	tester := newTester()
@@ -933,7 +1037,7 @@ func TestInactiveDownloader63(t *testing.T) {
 	if err := tester.downloader.DeliverHeaders("bad peer", []*types.Header{}); err != errNoSyncActive {
 		t.Errorf("error mismatch: have %v, want %v", err, errNoSyncActive)
 	}
-	if err := tester.downloader.DeliverBodies("bad peer", [][]*types.Transaction{}, [][]*types.Header{}); err != errNoSyncActive {
+	if err := tester.downloader.DeliverBodies("bad peer", [][]*types.Transaction{}, []*types.Commit{}); err != errNoSyncActive {
 		t.Errorf("error mismatch: have %v, want %v", err, errNoSyncActive)
 	}
 	if err := tester.downloader.DeliverReceipts("bad peer", [][]*types.Receipt{}); err != errNoSyncActive {
@@ -942,12 +1046,12 @@ func TestInactiveDownloader63(t *testing.T) {
 }
 
 // Tests that a canceled download wipes all previously accumulated state.
-func TestCancel62(t *testing.T)      { testCancel(t, 62, FullSync) }
-func TestCancel63Full(t *testing.T)  { testCancel(t, 63, FullSync) }
-func TestCancel63Fast(t *testing.T)  { testCancel(t, 63, FastSync) }
-func TestCancel64Full(t *testing.T)  { testCancel(t, 64, FullSync) }
-func TestCancel64Fast(t *testing.T)  { testCancel(t, 64, FastSync) }
-func TestCancel64Light(t *testing.T) { testCancel(t, 64, LightSync) }
+func TestCancel1(t *testing.T)      { testCancel(t, 1, FullSync) }
+func TestCancel2Full(t *testing.T)  { testCancel(t, 2, FullSync) }
+func TestCancel2Fast(t *testing.T)  { testCancel(t, 2, FastSync) }
+func TestCancel3Full(t *testing.T)  { testCancel(t, 3, FullSync) }
+func TestCancel3Fast(t *testing.T)  { testCancel(t, 3, FastSync) }
+func TestCancel3Light(t *testing.T) { testCancel(t, 3, LightSync) }
 
 func testCancel(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -983,12 +1087,12 @@ func testCancel(t *testing.T, protocol int, mode SyncMode) {
 }
 
 // Tests that synchronisation from multiple peers works as intended (multi thread sanity test).
-func TestMultiSynchronisation62(t *testing.T)      { testMultiSynchronisation(t, 62, FullSync) }
-func TestMultiSynchronisation63Full(t *testing.T)  { testMultiSynchronisation(t, 63, FullSync) }
-func TestMultiSynchronisation63Fast(t *testing.T)  { testMultiSynchronisation(t, 63, FastSync) }
-func TestMultiSynchronisation64Full(t *testing.T)  { testMultiSynchronisation(t, 64, FullSync) }
-func TestMultiSynchronisation64Fast(t *testing.T)  { testMultiSynchronisation(t, 64, FastSync) }
-func TestMultiSynchronisation64Light(t *testing.T) { testMultiSynchronisation(t, 64, LightSync) }
+func TestMultiSynchronisation1(t *testing.T)      { testMultiSynchronisation(t, 1, FullSync) }
+func TestMultiSynchronisation2Full(t *testing.T)  { testMultiSynchronisation(t, 2, FullSync) }
+func TestMultiSynchronisation2Fast(t *testing.T)  { testMultiSynchronisation(t, 2, FastSync) }
+func TestMultiSynchronisation3Full(t *testing.T)  { testMultiSynchronisation(t, 3, FullSync) }
+func TestMultiSynchronisation3Fast(t *testing.T)  { testMultiSynchronisation(t, 3, FastSync) }
+func TestMultiSynchronisation3Light(t *testing.T) { testMultiSynchronisation(t, 3, LightSync) }
 
 func testMultiSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -1013,12 +1117,12 @@ func testMultiSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 
 // Tests that synchronisations behave well in multi-version protocol environments
 // and not wreak havoc on other nodes in the network.
-func TestMultiProtoSynchronisation62(t *testing.T)      { testMultiProtoSync(t, 62, FullSync) }
-func TestMultiProtoSynchronisation63Full(t *testing.T)  { testMultiProtoSync(t, 63, FullSync) }
-func TestMultiProtoSynchronisation63Fast(t *testing.T)  { testMultiProtoSync(t, 63, FastSync) }
-func TestMultiProtoSynchronisation64Full(t *testing.T)  { testMultiProtoSync(t, 64, FullSync) }
-func TestMultiProtoSynchronisation64Fast(t *testing.T)  { testMultiProtoSync(t, 64, FastSync) }
-func TestMultiProtoSynchronisation64Light(t *testing.T) { testMultiProtoSync(t, 64, LightSync) }
+func TestMultiProtoSynchronisation1(t *testing.T)      { testMultiProtoSync(t, 1, FullSync) }
+func TestMultiProtoSynchronisation2Full(t *testing.T)  { testMultiProtoSync(t, 2, FullSync) }
+func TestMultiProtoSynchronisation2Fast(t *testing.T)  { testMultiProtoSync(t, 2, FastSync) }
+func TestMultiProtoSynchronisation3Full(t *testing.T)  { testMultiProtoSync(t, 3, FullSync) }
+func TestMultiProtoSynchronisation3Fast(t *testing.T)  { testMultiProtoSync(t, 3, FastSync) }
+func TestMultiProtoSynchronisation3Light(t *testing.T) { testMultiProtoSync(t, 3, LightSync) }
 
 func testMultiProtoSync(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -1031,9 +1135,9 @@ func testMultiProtoSync(t *testing.T, protocol int, mode SyncMode) {
 	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
 
 	// Create peers of every type
-	tester.newPeer("peer 62", 62, hashes, headers, blocks, nil)
-	tester.newPeer("peer 63", 63, hashes, headers, blocks, receipts)
-	tester.newPeer("peer 64", 64, hashes, headers, blocks, receipts)
+	tester.newPeer("peer 1", 1, hashes, headers, blocks, nil)
+	tester.newPeer("peer 2", 2, hashes, headers, blocks, receipts)
+	tester.newPeer("peer 3", 3, hashes, headers, blocks, receipts)
 
 	// Synchronise with the requested peer and make sure all blocks were retrieved
 	if err := tester.sync(fmt.Sprintf("peer %d", protocol), nil, mode); err != nil {
@@ -1042,7 +1146,7 @@ func testMultiProtoSync(t *testing.T, protocol int, mode SyncMode) {
 	assertOwnChain(t, tester, targetBlocks+1)
 
 	// Check that no peers have been dropped off
-	for _, version := range []int{62, 63, 64} {
+	for _, version := range []int{1, 2, 3} {
 		peer := fmt.Sprintf("peer %d", version)
 		if _, ok := tester.peerHashes[peer]; !ok {
 			t.Errorf("%s dropped", peer)
@@ -1052,12 +1156,12 @@ func testMultiProtoSync(t *testing.T, protocol int, mode SyncMode) {
 
 // Tests that if a block is empty (e.g. header only), no body request should be
 // made, and instead the header should be assembled into a whole block in itself.
-func TestEmptyShortCircuit62(t *testing.T)      { testEmptyShortCircuit(t, 62, FullSync) }
-func TestEmptyShortCircuit63Full(t *testing.T)  { testEmptyShortCircuit(t, 63, FullSync) }
-func TestEmptyShortCircuit63Fast(t *testing.T)  { testEmptyShortCircuit(t, 63, FastSync) }
-func TestEmptyShortCircuit64Full(t *testing.T)  { testEmptyShortCircuit(t, 64, FullSync) }
-func TestEmptyShortCircuit64Fast(t *testing.T)  { testEmptyShortCircuit(t, 64, FastSync) }
-func TestEmptyShortCircuit64Light(t *testing.T) { testEmptyShortCircuit(t, 64, LightSync) }
+func TestEmptyShortCircuit1(t *testing.T)      { testEmptyShortCircuit(t, 1, FullSync) }
+func TestEmptyShortCircuit2Full(t *testing.T)  { testEmptyShortCircuit(t, 2, FullSync) }
+func TestEmptyShortCircuit2Fast(t *testing.T)  { testEmptyShortCircuit(t, 2, FastSync) }
+func TestEmptyShortCircuit3Full(t *testing.T)  { testEmptyShortCircuit(t, 3, FullSync) }
+func TestEmptyShortCircuit3Fast(t *testing.T)  { testEmptyShortCircuit(t, 3, FastSync) }
+func TestEmptyShortCircuit3Light(t *testing.T) { testEmptyShortCircuit(t, 3, LightSync) }
 
 func testEmptyShortCircuit(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -1088,7 +1192,7 @@ func testEmptyShortCircuit(t *testing.T, protocol int, mode SyncMode) {
 	// Validate the number of block bodies that should have been requested
 	bodiesNeeded, receiptsNeeded := 0, 0
 	for _, block := range blocks {
-		if mode != LightSync && block != tester.genesis && (len(block.Transactions()) > 0 || len(block.Uncles()) > 0) {
+		if mode != LightSync && block != tester.genesis && (len(block.Transactions()) > 0 || block.LastCommitHash() != (common.Hash{})) {
 			bodiesNeeded++
 		}
 	}
@@ -1107,12 +1211,12 @@ func testEmptyShortCircuit(t *testing.T, protocol int, mode SyncMode) {
 
 // Tests that headers are enqueued continuously, preventing malicious nodes from
 // stalling the downloader by feeding gapped header chains.
-func TestMissingHeaderAttack62(t *testing.T)      { testMissingHeaderAttack(t, 62, FullSync) }
-func TestMissingHeaderAttack63Full(t *testing.T)  { testMissingHeaderAttack(t, 63, FullSync) }
-func TestMissingHeaderAttack63Fast(t *testing.T)  { testMissingHeaderAttack(t, 63, FastSync) }
-func TestMissingHeaderAttack64Full(t *testing.T)  { testMissingHeaderAttack(t, 64, FullSync) }
-func TestMissingHeaderAttack64Fast(t *testing.T)  { testMissingHeaderAttack(t, 64, FastSync) }
-func TestMissingHeaderAttack64Light(t *testing.T) { testMissingHeaderAttack(t, 64, LightSync) }
+func TestMissingHeaderAttack1(t *testing.T)      { testMissingHeaderAttack(t, 1, FullSync) }
+func TestMissingHeaderAttack2Full(t *testing.T)  { testMissingHeaderAttack(t, 2, FullSync) }
+func TestMissingHeaderAttack2Fast(t *testing.T)  { testMissingHeaderAttack(t, 2, FastSync) }
+func TestMissingHeaderAttack3Full(t *testing.T)  { testMissingHeaderAttack(t, 3, FullSync) }
+func TestMissingHeaderAttack3Fast(t *testing.T)  { testMissingHeaderAttack(t, 3, FastSync) }
+func TestMissingHeaderAttack3Light(t *testing.T) { testMissingHeaderAttack(t, 3, LightSync) }
 
 func testMissingHeaderAttack(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -1142,12 +1246,12 @@ func testMissingHeaderAttack(t *testing.T, protocol int, mode SyncMode) {
 
 // Tests that if requested headers are shifted (i.e. first is missing), the queue
 // detects the invalid numbering.
-func TestShiftedHeaderAttack62(t *testing.T)      { testShiftedHeaderAttack(t, 62, FullSync) }
-func TestShiftedHeaderAttack63Full(t *testing.T)  { testShiftedHeaderAttack(t, 63, FullSync) }
-func TestShiftedHeaderAttack63Fast(t *testing.T)  { testShiftedHeaderAttack(t, 63, FastSync) }
-func TestShiftedHeaderAttack64Full(t *testing.T)  { testShiftedHeaderAttack(t, 64, FullSync) }
-func TestShiftedHeaderAttack64Fast(t *testing.T)  { testShiftedHeaderAttack(t, 64, FastSync) }
-func TestShiftedHeaderAttack64Light(t *testing.T) { testShiftedHeaderAttack(t, 64, LightSync) }
+func TestShiftedHeaderAttack1(t *testing.T)      { testShiftedHeaderAttack(t, 1, FullSync) }
+func TestShiftedHeaderAttack2Full(t *testing.T)  { testShiftedHeaderAttack(t, 2, FullSync) }
+func TestShiftedHeaderAttack2Fast(t *testing.T)  { testShiftedHeaderAttack(t, 2, FastSync) }
+func TestShiftedHeaderAttack3Full(t *testing.T)  { testShiftedHeaderAttack(t, 3, FullSync) }
+func TestShiftedHeaderAttack3Fast(t *testing.T)  { testShiftedHeaderAttack(t, 3, FastSync) }
+func TestShiftedHeaderAttack3Light(t *testing.T) { testShiftedHeaderAttack(t, 3, LightSync) }
 
 func testShiftedHeaderAttack(t *testing.T, protocol int, mode SyncMode) {
 	tester := newTester()
@@ -1177,9 +1281,9 @@ func testShiftedHeaderAttack(t *testing.T, protocol int, mode SyncMode) {
 // Tests that upon detecting an invalid header, the recent ones are rolled back
 // for various failure scenarios. Afterwards a full sync is attempted to make
 // sure no state was corrupted.
-func TestInvalidHeaderRollback63Fast(t *testing.T)  { testInvalidHeaderRollback(t, 63, FastSync) }
-func TestInvalidHeaderRollback64Fast(t *testing.T)  { testInvalidHeaderRollback(t, 64, FastSync) }
-func TestInvalidHeaderRollback64Light(t *testing.T) { testInvalidHeaderRollback(t, 64, LightSync) }
+func TestInvalidHeaderRollback2Fast(t *testing.T)  { testInvalidHeaderRollback(t, 2, FastSync) }
+func TestInvalidHeaderRollback3Fast(t *testing.T)  { testInvalidHeaderRollback(t, 3, FastSync) }
+func TestInvalidHeaderRollback3Light(t *testing.T) { testInvalidHeaderRollback(t, 3, LightSync) }
 
 func testInvalidHeaderRollback(t *testing.T, protocol int, mode SyncMode) {
 	tester := newTester()
@@ -1267,12 +1371,12 @@ func testInvalidHeaderRollback(t *testing.T, protocol int, mode SyncMode) {
 
 // Tests that a peer advertising an high TD doesn't get to stall the downloader
 // afterwards by not sending any useful hashes.
-func TestHighTDStarvationAttack62(t *testing.T)      { testHighTDStarvationAttack(t, 62, FullSync) }
-func TestHighTDStarvationAttack63Full(t *testing.T)  { testHighTDStarvationAttack(t, 63, FullSync) }
-func TestHighTDStarvationAttack63Fast(t *testing.T)  { testHighTDStarvationAttack(t, 63, FastSync) }
-func TestHighTDStarvationAttack64Full(t *testing.T)  { testHighTDStarvationAttack(t, 64, FullSync) }
-func TestHighTDStarvationAttack64Fast(t *testing.T)  { testHighTDStarvationAttack(t, 64, FastSync) }
-func TestHighTDStarvationAttack64Light(t *testing.T) { testHighTDStarvationAttack(t, 64, LightSync) }
+func TestHighTDStarvationAttack1(t *testing.T)      { testHighTDStarvationAttack(t, 1, FullSync) }
+func TestHighTDStarvationAttack2Full(t *testing.T)  { testHighTDStarvationAttack(t, 2, FullSync) }
+func TestHighTDStarvationAttack2Fast(t *testing.T)  { testHighTDStarvationAttack(t, 2, FastSync) }
+func TestHighTDStarvationAttack3Full(t *testing.T)  { testHighTDStarvationAttack(t, 3, FullSync) }
+func TestHighTDStarvationAttack3Fast(t *testing.T)  { testHighTDStarvationAttack(t, 3, FastSync) }
+func TestHighTDStarvationAttack3Light(t *testing.T) { testHighTDStarvationAttack(t, 3, LightSync) }
 
 func testHighTDStarvationAttack(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -1289,9 +1393,9 @@ func testHighTDStarvationAttack(t *testing.T, protocol int, mode SyncMode) {
 }
 
 // Tests that misbehaving peers are disconnected, whilst behaving ones are not.
-func TestBlockHeaderAttackerDropping62(t *testing.T) { testBlockHeaderAttackerDropping(t, 62) }
-func TestBlockHeaderAttackerDropping63(t *testing.T) { testBlockHeaderAttackerDropping(t, 63) }
-func TestBlockHeaderAttackerDropping64(t *testing.T) { testBlockHeaderAttackerDropping(t, 64) }
+func TestBlockHeaderAttackerDropping1(t *testing.T) { testBlockHeaderAttackerDropping(t, 1) }
+func TestBlockHeaderAttackerDropping2(t *testing.T) { testBlockHeaderAttackerDropping(t, 2) }
+func TestBlockHeaderAttackerDropping3(t *testing.T) { testBlockHeaderAttackerDropping(t, 3) }
 
 func testBlockHeaderAttackerDropping(t *testing.T, protocol int) {
 	// Define the disconnection requirement for individual hash fetch errors
@@ -1345,12 +1449,12 @@ func testBlockHeaderAttackerDropping(t *testing.T, protocol int) {
 
 // Tests that synchronisation progress (origin block number, current block number
 // and highest block number) is tracked and updated correctly.
-func TestSyncProgress62(t *testing.T)      { testSyncProgress(t, 62, FullSync) }
-func TestSyncProgress63Full(t *testing.T)  { testSyncProgress(t, 63, FullSync) }
-func TestSyncProgress63Fast(t *testing.T)  { testSyncProgress(t, 63, FastSync) }
-func TestSyncProgress64Full(t *testing.T)  { testSyncProgress(t, 64, FullSync) }
-func TestSyncProgress64Fast(t *testing.T)  { testSyncProgress(t, 64, FastSync) }
-func TestSyncProgress64Light(t *testing.T) { testSyncProgress(t, 64, LightSync) }
+func TestSyncProgress1(t *testing.T)      { testSyncProgress(t, 1, FullSync) }
+func TestSyncProgress2Full(t *testing.T)  { testSyncProgress(t, 2, FullSync) }
+func TestSyncProgress2Fast(t *testing.T)  { testSyncProgress(t, 2, FastSync) }
+func TestSyncProgress3Full(t *testing.T)  { testSyncProgress(t, 3, FullSync) }
+func TestSyncProgress3Fast(t *testing.T)  { testSyncProgress(t, 3, FastSync) }
+func TestSyncProgress3Light(t *testing.T) { testSyncProgress(t, 3, LightSync) }
 
 func testSyncProgress(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -1418,12 +1522,12 @@ func testSyncProgress(t *testing.T, protocol int, mode SyncMode) {
 // Tests that synchronisation progress (origin block number and highest block
 // number) is tracked and updated correctly in case of a fork (or manual head
 // revertal).
-func TestForkedSyncProgress62(t *testing.T)      { testForkedSyncProgress(t, 62, FullSync) }
-func TestForkedSyncProgress63Full(t *testing.T)  { testForkedSyncProgress(t, 63, FullSync) }
-func TestForkedSyncProgress63Fast(t *testing.T)  { testForkedSyncProgress(t, 63, FastSync) }
-func TestForkedSyncProgress64Full(t *testing.T)  { testForkedSyncProgress(t, 64, FullSync) }
-func TestForkedSyncProgress64Fast(t *testing.T)  { testForkedSyncProgress(t, 64, FastSync) }
-func TestForkedSyncProgress64Light(t *testing.T) { testForkedSyncProgress(t, 64, LightSync) }
+func TestForkedSyncProgress1(t *testing.T)      { testForkedSyncProgress(t, 1, FullSync) }
+func TestForkedSyncProgress2Full(t *testing.T)  { testForkedSyncProgress(t, 2, FullSync) }
+func TestForkedSyncProgress2Fast(t *testing.T)  { testForkedSyncProgress(t, 2, FastSync) }
+func TestForkedSyncProgress3Full(t *testing.T)  { testForkedSyncProgress(t, 3, FullSync) }
+func TestForkedSyncProgress3Fast(t *testing.T)  { testForkedSyncProgress(t, 3, FastSync) }
+func TestForkedSyncProgress3Light(t *testing.T) { testForkedSyncProgress(t, 3, LightSync) }
 
 func testForkedSyncProgress(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -1494,12 +1598,12 @@ func testForkedSyncProgress(t *testing.T, protocol int, mode SyncMode) {
 // Tests that if synchronisation is aborted due to some failure, then the progress
 // origin is not updated in the next sync cycle, as it should be considered the
 // continuation of the previous sync and not a new instance.
-func TestFailedSyncProgress62(t *testing.T)      { testFailedSyncProgress(t, 62, FullSync) }
-func TestFailedSyncProgress63Full(t *testing.T)  { testFailedSyncProgress(t, 63, FullSync) }
-func TestFailedSyncProgress63Fast(t *testing.T)  { testFailedSyncProgress(t, 63, FastSync) }
-func TestFailedSyncProgress64Full(t *testing.T)  { testFailedSyncProgress(t, 64, FullSync) }
-func TestFailedSyncProgress64Fast(t *testing.T)  { testFailedSyncProgress(t, 64, FastSync) }
-func TestFailedSyncProgress64Light(t *testing.T) { testFailedSyncProgress(t, 64, LightSync) }
+func TestFailedSyncProgress1(t *testing.T)      { testFailedSyncProgress(t, 1, FullSync) }
+func TestFailedSyncProgress2Full(t *testing.T)  { testFailedSyncProgress(t, 2, FullSync) }
+func TestFailedSyncProgress2Fast(t *testing.T)  { testFailedSyncProgress(t, 2, FastSync) }
+func TestFailedSyncProgress3Full(t *testing.T)  { testFailedSyncProgress(t, 3, FullSync) }
+func TestFailedSyncProgress3Fast(t *testing.T)  { testFailedSyncProgress(t, 3, FastSync) }
+func TestFailedSyncProgress3Light(t *testing.T) { testFailedSyncProgress(t, 3, LightSync) }
 
 func testFailedSyncProgress(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -1571,12 +1675,12 @@ func testFailedSyncProgress(t *testing.T, protocol int, mode SyncMode) {
 
 // Tests that if an attacker fakes a chain height, after the attack is detected,
 // the progress height is successfully reduced at the next sync invocation.
-func TestFakedSyncProgress62(t *testing.T)      { testFakedSyncProgress(t, 62, FullSync) }
-func TestFakedSyncProgress63Full(t *testing.T)  { testFakedSyncProgress(t, 63, FullSync) }
-func TestFakedSyncProgress63Fast(t *testing.T)  { testFakedSyncProgress(t, 63, FastSync) }
-func TestFakedSyncProgress64Full(t *testing.T)  { testFakedSyncProgress(t, 64, FullSync) }
-func TestFakedSyncProgress64Fast(t *testing.T)  { testFakedSyncProgress(t, 64, FastSync) }
-func TestFakedSyncProgress64Light(t *testing.T) { testFakedSyncProgress(t, 64, LightSync) }
+func TestFakedSyncProgress1(t *testing.T)      { testFakedSyncProgress(t, 1, FullSync) }
+func TestFakedSyncProgress2Full(t *testing.T)  { testFakedSyncProgress(t, 2, FullSync) }
+func TestFakedSyncProgress2Fast(t *testing.T)  { testFakedSyncProgress(t, 2, FastSync) }
+func TestFakedSyncProgress3Full(t *testing.T)  { testFakedSyncProgress(t, 3, FullSync) }
+func TestFakedSyncProgress3Fast(t *testing.T)  { testFakedSyncProgress(t, 3, FastSync) }
+func TestFakedSyncProgress3Light(t *testing.T) { testFakedSyncProgress(t, 3, LightSync) }
 
 func testFakedSyncProgress(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -1649,12 +1753,12 @@ func testFakedSyncProgress(t *testing.T, protocol int, mode SyncMode) {
 
 // This test reproduces an issue where unexpected deliveries would
 // block indefinitely if they arrived at the right time.
-func TestDeliverHeadersHang62(t *testing.T)      { testDeliverHeadersHang(t, 62, FullSync) }
-func TestDeliverHeadersHang63Full(t *testing.T)  { testDeliverHeadersHang(t, 63, FullSync) }
-func TestDeliverHeadersHang63Fast(t *testing.T)  { testDeliverHeadersHang(t, 63, FastSync) }
-func TestDeliverHeadersHang64Full(t *testing.T)  { testDeliverHeadersHang(t, 64, FullSync) }
-func TestDeliverHeadersHang64Fast(t *testing.T)  { testDeliverHeadersHang(t, 64, FastSync) }
-func TestDeliverHeadersHang64Light(t *testing.T) { testDeliverHeadersHang(t, 64, LightSync) }
+func TestDeliverHeadersHang1(t *testing.T)      { testDeliverHeadersHang(t, 1, FullSync) }
+func TestDeliverHeadersHang2Full(t *testing.T)  { testDeliverHeadersHang(t, 2, FullSync) }
+func TestDeliverHeadersHang2Fast(t *testing.T)  { testDeliverHeadersHang(t, 2, FastSync) }
+func TestDeliverHeadersHang3Full(t *testing.T)  { testDeliverHeadersHang(t, 3, FullSync) }
+func TestDeliverHeadersHang3Fast(t *testing.T)  { testDeliverHeadersHang(t, 3, FastSync) }
+func TestDeliverHeadersHang3Light(t *testing.T) { testDeliverHeadersHang(t, 3, LightSync) }
 
 type floodingTestPeer struct {
 	peer   Peer
@@ -1674,6 +1778,12 @@ func (ftp *floodingTestPeer) RequestReceipts(hashes []common.Hash) error {
 func (ftp *floodingTestPeer) RequestNodeData(hashes []common.Hash) error {
 	return ftp.peer.RequestNodeData(hashes)
 }
+func (ftp *floodingTestPeer) RequestAccountRange(root common.Hash, origin common.Hash, limit common.Hash, bytes uint64) error {
+	return ftp.peer.RequestAccountRange(root, origin, limit, bytes)
+}
+func (ftp *floodingTestPeer) RequestStorageRange(root common.Hash, account common.Hash, origin common.Hash, bytes uint64) error {
+	return ftp.peer.RequestStorageRange(root, account, origin, bytes)
+}
 
 func (ftp *floodingTestPeer) RequestHeadersByNumber(from uint64, count, skip int, reverse bool) error {
 	deliveriesDone := make(chan struct{}, 500)
@@ -1726,10 +1836,10 @@ func testDeliverHeadersHang(t *testing.T, protocol int, mode SyncMode) {
 
 // Tests that if fast sync aborts in the critical section, it can restart a few
 // times before giving up.
-func TestFastCriticalRestartsFail63(t *testing.T) { testFastCriticalRestarts(t, 63, false) }
-func TestFastCriticalRestartsFail64(t *testing.T) { testFastCriticalRestarts(t, 64, false) }
-func TestFastCriticalRestartsCont63(t *testing.T) { testFastCriticalRestarts(t, 63, true) }
-func TestFastCriticalRestartsCont64(t *testing.T) { testFastCriticalRestarts(t, 64, true) }
+func TestFastCriticalRestartsFail2(t *testing.T) { testFastCriticalRestarts(t, 2, false) }
+func TestFastCriticalRestartsFail3(t *testing.T) { testFastCriticalRestarts(t, 3, false) }
+func TestFastCriticalRestartsCont2(t *testing.T) { testFastCriticalRestarts(t, 2, true) }
+func TestFastCriticalRestartsCont3(t *testing.T) { testFastCriticalRestarts(t, 3, true) }
 
 func testFastCriticalRestarts(t *testing.T, protocol int, progress bool) {
 	tester := newTester()
@@ -1742,7 +1852,7 @@ func testFastCriticalRestarts(t *testing.T, protocol int, progress bool) {
 	// Create a tester peer with a critical section header missing (force failures)
 	tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
 	delete(tester.peerHeaders["peer"], hashes[fsMinFullBlocks-1])
-	tester.downloader.dropPeer = func(id string) {} // We reuse the same "faulty" peer throughout the test
+	tester.downloader.dropPeer = func(id string, reason error) {} // We reuse the same "faulty" peer throughout the test
 
 	// Remove all possible pivot state roots and slow down replies (test failure resets later)
 	for i := 0; i < fsPivotInterval; i++ {
@@ -1804,3 +1914,82 @@ func testFastCriticalRestarts(t *testing.T, protocol int, progress bool) {
 	// completed using a single mode of operation, whereas fast-then-slow can result
 	// in arbitrary intermediate state that's not cleanly verifiable.
 }
+
+// Tests that snap sync retrieves the state in ranges spread across the peers
+// serving them, dropping the peers serving invalid ranges, and leaves only the
+// contract code to the trie node scheduler.
+func TestSnapStateSync(t *testing.T) {
+	defer func(bytes uint64) { snapRangeBytes = bytes }(snapRangeBytes)
+	snapRangeBytes = 1024
+
+	tester := newTester()
+	defer tester.terminate()
+
+	// Create a state of many accounts, some of them contracts with storage
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(tester.peerDb))
+	for i := 0; i < 1000; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i + 1)))
+		statedb.AddBalance(addr, big.NewInt(int64(i+1)))
+		if i%100 == 0 {
+			statedb.SetCode(addr, []byte{byte(i / 100), 0x01})
+			for j := 0; j < 50; j++ {
+				statedb.SetState(addr, common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(int64(i+j+1))))
+			}
+		}
+	}
+	root, err := statedb.CommitTo(tester.peerDb, false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	// Serve the state from a few peers, the first one corrupting its ranges
+	peers := make([]*rangeTestPeer, 4)
+	for i := range peers {
+		id := fmt.Sprintf("peer %d", i)
+		if err := tester.newPeer(id, snapProtocol, tester.ownHashes, tester.ownHeaders, tester.ownBlocks, nil); err != nil {
+			t.Fatalf("failed to register %s: %v", id, err)
+		}
+		peers[i] = &rangeTestPeer{Peer: tester.downloader.peers.peers[id].peer, tester: tester, id: id, bad: i == 0}
+		tester.downloader.peers.peers[id].peer = peers[i]
+	}
+	// Deliveries are only accepted while a sync cycle is running
+	tester.downloader.cancelCh = make(chan struct{})
+
+	if err := tester.downloader.syncState(root, true).Wait(); err != nil {
+		t.Fatalf("failed to sync state: %v", err)
+	}
+	// Check that the state was entirely retrieved
+	synced, err := state.New(root, state.NewDatabase(tester.stateDb))
+	if err != nil {
+		t.Fatalf("failed to open synced state: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i + 1)))
+		if have, want := synced.GetBalance(addr), statedb.GetBalance(addr); have.Cmp(want) != 0 {
+			t.Fatalf("account %d: balance mismatch: have %v, want %v", i, have, want)
+		}
+		if have, want := synced.GetCode(addr), statedb.GetCode(addr); !bytes.Equal(have, want) {
+			t.Fatalf("account %d: code mismatch: have %x, want %x", i, have, want)
+		}
+		for j := 0; j < 50; j++ {
+			key := common.BigToHash(big.NewInt(int64(j)))
+			if have, want := synced.GetState(addr, key), statedb.GetState(addr, key); have != want {
+				t.Fatalf("account %d: slot %d mismatch: have %x, want %x", i, j, have, want)
+			}
+		}
+	}
+	// Check that the ranges were spread across the honest peers, that the bad
+	// one was dropped, and that only the code was retrieved node by node
+	if _, ok := tester.peerHashes[peers[0].id]; ok {
+		t.Errorf("peer serving invalid ranges not dropped")
+	}
+	var nodes int32
+	for _, peer := range peers[1:] {
+		if ranges := atomic.LoadInt32(&peer.ranges); ranges == 0 {
+			t.Errorf("%s: no state ranges requested", peer.id)
+		}
+		nodes += atomic.LoadInt32(&peer.nodes)
+	}
+	if nodes != 10 {
+		t.Errorf("state node count mismatch: have %d, want %d", nodes, 10)
+	}
+}
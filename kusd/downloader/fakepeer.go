@@ -5,6 +5,7 @@ import (
 
 	"github.com/kowala-tech/kUSD/common"
 	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/state"
 	"github.com/kowala-tech/kUSD/core/types"
 	"github.com/kowala-tech/kUSD/kusddb"
 )
@@ -142,3 +143,27 @@ func (p *FakePeer) RequestNodeData(hashes []common.Hash) error {
 	p.dl.DeliverNodeData(p.id, data)
 	return nil
 }
+
+// RequestAccountRange implements downloader.Peer, returning a range of the
+// accounts of the specified state, served from the local database.
+func (p *FakePeer) RequestAccountRange(root common.Hash, origin common.Hash, limit common.Hash, bytes uint64) error {
+	var hashes []common.Hash
+	var accounts, proof [][]byte
+	if prover, err := state.NewRangeProver(root, p.db); err == nil {
+		hashes, accounts, proof, _ = prover.AccountRange(origin, limit, bytes)
+	}
+	p.dl.DeliverAccountRange(p.id, hashes, accounts, proof)
+	return nil
+}
+
+// RequestStorageRange implements downloader.Peer, returning a range of the
+// storage slots of the specified account, served from the local database.
+func (p *FakePeer) RequestStorageRange(root common.Hash, account common.Hash, origin common.Hash, bytes uint64) error {
+	var hashes []common.Hash
+	var slots, proof [][]byte
+	if prover, err := state.NewRangeProver(root, p.db); err == nil {
+		hashes, slots, proof, _ = prover.StorageRange(account, origin, bytes)
+	}
+	p.dl.DeliverStorageRange(p.id, hashes, slots, proof)
+	return nil
+}
@@ -24,4 +24,9 @@ var (
 
 	stateInMeter   = metrics.NewMeter("eth/downloader/states/in")
 	stateDropMeter = metrics.NewMeter("eth/downloader/states/drop")
+
+	accountRangeInMeter   = metrics.NewMeter("eth/downloader/accounts/in")
+	accountRangeDropMeter = metrics.NewMeter("eth/downloader/accounts/drop")
+	storageRangeInMeter   = metrics.NewMeter("eth/downloader/storage/in")
+	storageRangeDropMeter = metrics.NewMeter("eth/downloader/storage/drop")
 )
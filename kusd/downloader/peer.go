@@ -71,6 +71,8 @@ type Peer interface {
 	RequestBodies([]common.Hash) error
 	RequestReceipts([]common.Hash) error
 	RequestNodeData([]common.Hash) error
+	RequestAccountRange(root common.Hash, origin common.Hash, limit common.Hash, bytes uint64) error
+	RequestStorageRange(root common.Hash, account common.Hash, origin common.Hash, bytes uint64) error
 }
 
 // lightPeerWrapper wraps a LightPeer struct, stubbing out the Peer-only methods.
@@ -94,6 +96,12 @@ func (w *lightPeerWrapper) RequestReceipts([]common.Hash) error {
 func (w *lightPeerWrapper) RequestNodeData([]common.Hash) error {
 	panic("RequestNodeData not supported in light client mode sync")
 }
+func (w *lightPeerWrapper) RequestAccountRange(common.Hash, common.Hash, common.Hash, uint64) error {
+	panic("RequestAccountRange not supported in light client mode sync")
+}
+func (w *lightPeerWrapper) RequestStorageRange(common.Hash, common.Hash, common.Hash, uint64) error {
+	panic("RequestStorageRange not supported in light client mode sync")
+}
 
 // newPeerConnection creates a new downloader peer.
 func newPeerConnection(id string, version int, peer Peer, logger log.Logger) *peerConnection {
@@ -444,7 +452,7 @@ func (ps *peerSet) HeaderIdlePeers() ([]*peerConnection, int) {
 		defer p.lock.RUnlock()
 		return p.headerThroughput
 	}
-	return ps.idlePeers(1, 1, idle, throughput)
+	return ps.idlePeers(1, 64, idle, throughput)
 }
 
 // BodyIdlePeers retrieves a flat list of all the currently body-idle peers within
@@ -458,7 +466,7 @@ func (ps *peerSet) BodyIdlePeers() ([]*peerConnection, int) {
 		defer p.lock.RUnlock()
 		return p.blockThroughput
 	}
-	return ps.idlePeers(1, 1, idle, throughput)
+	return ps.idlePeers(1, 64, idle, throughput)
 }
 
 // ReceiptIdlePeers retrieves a flat list of all the currently receipt-idle peers
@@ -472,7 +480,7 @@ func (ps *peerSet) ReceiptIdlePeers() ([]*peerConnection, int) {
 		defer p.lock.RUnlock()
 		return p.receiptThroughput
 	}
-	return ps.idlePeers(1, 1, idle, throughput)
+	return ps.idlePeers(1, 64, idle, throughput)
 }
 
 // NodeDataIdlePeers retrieves a flat list of all the currently node-data-idle
@@ -486,7 +494,7 @@ func (ps *peerSet) NodeDataIdlePeers() ([]*peerConnection, int) {
 		defer p.lock.RUnlock()
 		return p.stateThroughput
 	}
-	return ps.idlePeers(1, 1, idle, throughput)
+	return ps.idlePeers(1, 64, idle, throughput)
 }
 
 // idlePeers retrieves a flat list of all currently idle peers satisfying the
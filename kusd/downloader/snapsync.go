@@ -0,0 +1,361 @@
+package downloader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/state"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/kusddb"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/rlp"
+	"github.com/kowala-tech/kUSD/trie"
+)
+
+const (
+	snapAccountChunks = 16 // Number of account trie chunks retrievable concurrently from different peers
+	snapProtocol      = 3  // Minimum protocol version of the peers serving state ranges
+)
+
+var (
+	snapRangeBytes = uint64(512 * 1024) // Soft limit on the size of a requested state range
+
+	errBadStorageRange = errors.New("storage trie root mismatch")
+
+	emptyCode = crypto.Keccak256Hash(nil)
+	maxHash   = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+)
+
+// rangeTask is a contiguous part of a trie, retrieved range by range from one
+// peer at a time during a snap sync. Different tasks are retrieved concurrently
+// from different peers.
+type rangeTask struct {
+	root    common.Hash // Root of the trie the task is part of
+	account common.Hash // Hash of the account owning the storage trie, zero for the account trie
+	origin  common.Hash // Hash of the next entry to retrieve
+	limit   common.Hash // Hash of the last entry of the task
+	trie    *trie.Trie  // Trie rebuilt from the retrieved entries
+	size    int         // Size of the entries not yet flushed into the database
+}
+
+// rangeReq is a range of a task requested from a peer.
+type rangeReq struct {
+	task     *rangeTask
+	peer     *peerConnection
+	deadline time.Time
+}
+
+// rangeProcessor processes the verified entries of a task retrieved in a range,
+// done being set once the task is complete.
+type rangeProcessor func(task *rangeTask, hashes []common.Hash, values [][]byte, done bool) error
+
+// snapSync retrieves the accounts of the state in contiguous ranges, verifying
+// each range against the state root with the merkle proofs of its edges, and
+// rebuilds the account and storage tries locally. The account trie is split in
+// chunks and the storage tries are retrieved one per peer, so that the ranges
+// are requested from all peers serving them at once. Whatever can't be
+// retrieved in ranges (contract code, storage tries failing to complete, or the
+// entire state if the account trie doesn't) is left for the trie node scheduler
+// to heal.
+func (s *stateSync) snapSync() error {
+	start := time.Now()
+
+	accounts, err := trie.New(common.Hash{}, s.d.stateDB)
+	if err != nil {
+		return err
+	}
+	var (
+		storages []*rangeTask
+		codes    = make(map[common.Hash]struct{})
+		count    int
+		size     int
+	)
+	processAccounts := func(task *rangeTask, hashes []common.Hash, values [][]byte, done bool) error {
+		for i, hash := range hashes {
+			var account state.Account
+			if err := rlp.DecodeBytes(values[i], &account); err != nil {
+				return fmt.Errorf("invalid account %x: %v", hash, err)
+			}
+			accounts.Update(hash[:], values[i])
+			if account.Root != types.EmptyRootHash {
+				storages = append(storages, &rangeTask{root: account.Root, account: hash, limit: maxHash})
+			}
+			if hash := common.BytesToHash(account.CodeHash); hash != emptyCode {
+				codes[hash] = struct{}{}
+			}
+			size += common.HashLength + len(values[i])
+		}
+		count += len(hashes)
+		log.Debug("Imported account range", "count", len(hashes), "total", count)
+
+		// Flush the trie every now and then to keep memory use bounded
+		if size >= kusddb.IdealBatchSize {
+			if _, err := s.commitTrie(accounts); err != nil {
+				return err
+			}
+			size = 0
+		}
+		return nil
+	}
+	if left, err := s.fetchRanges(splitAccounts(s.root, snapAccountChunks), processAccounts); err != nil {
+		return err
+	} else if len(left) > 0 {
+		log.Warn("Snap sync aborted, healing state", "accounts", count, "chunks", len(left))
+		return nil
+	}
+	root, err := s.commitTrie(accounts)
+	if err != nil {
+		return err
+	}
+	if root != s.root {
+		log.Warn("Snap synced state root mismatch, healing state", "have", root, "want", s.root)
+		return nil
+	}
+	// The account trie is complete, retrieve the storage tries
+	var heal []common.Hash
+	processStorage := func(task *rangeTask, hashes []common.Hash, values [][]byte, done bool) error {
+		if task.trie == nil {
+			tr, err := trie.New(common.Hash{}, s.d.stateDB)
+			if err != nil {
+				return err
+			}
+			task.trie = tr
+		}
+		for i, hash := range hashes {
+			task.trie.Update(hash[:], values[i])
+			task.size += common.HashLength + len(values[i])
+		}
+		if !done && task.size < kusddb.IdealBatchSize {
+			return nil
+		}
+		root, err := s.commitTrie(task.trie)
+		if err != nil {
+			return err
+		}
+		task.size = 0
+		if done && root != task.root {
+			log.Debug("Snap synced storage root mismatch", "account", task.account, "have", root, "want", task.root)
+			heal = append(heal, task.root)
+		}
+		return nil
+	}
+	left, err := s.fetchRanges(storages, processStorage)
+	if err != nil {
+		return err
+	}
+	for _, task := range left {
+		heal = append(heal, task.root)
+	}
+	log.Info("Imported state ranges", "accounts", count, "storage", len(storages)-len(heal), "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// Reschedule the healing of whatever is still missing
+	s.sched = state.NewStateSync(s.root, s.d.stateDB)
+	for hash := range codes {
+		s.sched.AddRawEntry(hash, 64, common.Hash{})
+	}
+	for _, root := range heal {
+		s.sched.AddSubTrie(root, 64, common.Hash{}, nil)
+	}
+	return nil
+}
+
+// splitAccounts splits the key space of the account trie with the given root
+// into n chunks of equal size.
+func splitAccounts(root common.Hash, n int) []*rangeTask {
+	var (
+		tasks = make([]*rangeTask, n)
+		step  = new(big.Int).Div(maxHash.Big(), big.NewInt(int64(n)))
+		next  = new(big.Int)
+	)
+	for i := range tasks {
+		tasks[i] = &rangeTask{root: root, origin: common.BigToHash(next), limit: maxHash}
+		next.Add(next, step)
+		if i < n-1 {
+			tasks[i].limit = common.BigToHash(next)
+			next.Add(next, common.Big1)
+		}
+	}
+	return tasks
+}
+
+// fetchRanges retrieves the given tasks range by range, assigning them to the
+// idle peers serving state ranges. Peers returning invalid ranges are dropped,
+// ones lacking the state or timing out are skipped for the rest of the sync.
+// The verified ranges are handed to process, in the order they arrive. It
+// returns the tasks left incomplete once no peer is left to serve them.
+func (s *stateSync) fetchRanges(tasks []*rangeTask, process rangeProcessor) ([]*rangeTask, error) {
+	var (
+		queue   = append([]*rangeTask(nil), tasks...)
+		pending = make(map[string]*rangeReq)
+	)
+	for len(queue) > 0 || len(pending) > 0 {
+		// Assign the queued tasks to the idle peers
+		for _, p := range s.snapPeers() {
+			if len(queue) == 0 {
+				break
+			}
+			if _, busy := pending[p.id]; busy {
+				continue
+			}
+			if err := s.requestRange(p, queue[0]); err != nil {
+				s.snapFailed[p.id] = struct{}{}
+				continue
+			}
+			pending[p.id] = &rangeReq{task: queue[0], peer: p, deadline: time.Now().Add(s.d.requestTTL())}
+			queue = queue[1:]
+		}
+		if len(pending) == 0 {
+			return queue, nil
+		}
+		// Wait for a requested range to arrive, or the earliest request to time out
+		var deadline time.Time
+		for _, req := range pending {
+			if deadline.IsZero() || req.deadline.Before(deadline) {
+				deadline = req.deadline
+			}
+		}
+		timeout := time.NewTimer(deadline.Sub(time.Now()))
+
+		select {
+		case pack := <-s.ranges:
+			timeout.Stop()
+
+			req := pending[pack.peerId]
+			if req == nil {
+				log.Debug("Unrequested state range", "peer", pack.peerId, "len", pack.Items())
+				continue
+			}
+			delete(pending, pack.peerId)
+
+			done, err := s.processRange(req, pack, process)
+			if err != nil {
+				return nil, err
+			}
+			if !done {
+				queue = append(queue, req.task)
+			}
+
+		case <-timeout.C:
+			now := time.Now()
+			for id, req := range pending {
+				if req.deadline.After(now) {
+					continue
+				}
+				req.peer.log.Debug("State range request timed out")
+				s.snapFailed[id] = struct{}{}
+				delete(pending, id)
+				queue = append(queue, req.task)
+			}
+
+		case <-s.cancel:
+			timeout.Stop()
+			return nil, errCancelStateFetch
+		}
+	}
+	return nil, nil
+}
+
+// requestRange requests the next range of a task from a peer.
+func (s *stateSync) requestRange(p *peerConnection, task *rangeTask) error {
+	if task.account == (common.Hash{}) {
+		return p.peer.RequestAccountRange(s.root, task.origin, task.limit, snapRangeBytes)
+	}
+	return p.peer.RequestStorageRange(s.root, task.account, task.origin, snapRangeBytes)
+}
+
+// processRange verifies a range delivered for a request against the root of
+// the task, processing its entries and advancing the task past them. It returns
+// whether the task is complete, which is not the case if the range is rejected.
+func (s *stateSync) processRange(req *rangeReq, pack *rangePack, process rangeProcessor) (bool, error) {
+	task := req.task
+	if len(pack.hashes) == 0 && len(pack.proof) == 0 {
+		req.peer.log.Debug("Peer lacks state range", "root", s.root)
+		s.snapFailed[req.peer.id] = struct{}{}
+		return false, nil
+	}
+	more, err := verifyRange(task.root, task.origin, pack)
+	if err != nil {
+		req.peer.log.Warn("Invalid state range, dropping peer", "err", err)
+		s.snapFailed[req.peer.id] = struct{}{}
+		s.d.dropPeer(req.peer.id, errBadPeer)
+		return false, nil
+	}
+	// Discard the entries past the task, only retrieved to prove its end
+	hashes, values := pack.hashes, pack.values
+	for i, hash := range hashes {
+		if bytes.Compare(hash[:], task.limit[:]) > 0 {
+			hashes, values, more = hashes[:i], values[:i], false
+			break
+		}
+	}
+	done := !more || !nextHash(&task.origin, hashes) || bytes.Compare(task.origin[:], task.limit[:]) > 0
+	return done, process(task, hashes, values, done)
+}
+
+// snapPeers returns the peers serving state ranges that didn't fail to yet.
+func (s *stateSync) snapPeers() []*peerConnection {
+	var peers []*peerConnection
+	for _, p := range s.d.peers.AllPeers() {
+		if _, failed := s.snapFailed[p.id]; !failed && p.version >= snapProtocol {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// commitTrie writes a rebuilt trie into the state database.
+func (s *stateSync) commitTrie(tr *trie.Trie) (common.Hash, error) {
+	batch := s.d.stateDB.NewBatch()
+	root, err := tr.CommitTo(batch)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := batch.Write(); err != nil {
+		return common.Hash{}, fmt.Errorf("DB write error: %v", err)
+	}
+	return root, nil
+}
+
+// verifyRange checks that a state range starting at origin is a contiguous part
+// of the trie with the given root, returning whether more entries follow it.
+func verifyRange(root, origin common.Hash, pack *rangePack) (bool, error) {
+	if len(pack.hashes) != len(pack.values) {
+		return false, fmt.Errorf("range hash/value count mismatch: %d != %d", len(pack.hashes), len(pack.values))
+	}
+	// Proof nodes are keyed by their locally computed hashes, so that no node
+	// can be passed off as another one
+	proof, _ := kusddb.NewMemDatabase()
+	for _, node := range pack.proof {
+		proof.Put(crypto.Keccak256(node), node)
+	}
+	keys := make([][]byte, len(pack.hashes))
+	for i, hash := range pack.hashes {
+		keys[i] = common.CopyBytes(hash[:])
+	}
+	last := origin[:]
+	if n := len(keys); n > 0 && !bytes.Equal(keys[n-1], last) {
+		last = keys[n-1]
+	}
+	return trie.VerifyRangeProof(root, origin[:], last, keys, pack.values, proof)
+}
+
+// nextHash moves origin past the last hash of a range, returning false if the
+// range already reached the end of the key space.
+func nextHash(origin *common.Hash, hashes []common.Hash) bool {
+	if len(hashes) == 0 {
+		return false
+	}
+	next := hashes[len(hashes)-1]
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i]++; next[i] != 0 {
+			*origin = next
+			return true
+		}
+	}
+	return false
+}
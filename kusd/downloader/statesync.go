@@ -41,9 +41,10 @@ type stateSyncStats struct {
 	pending    uint64 // Number of still pending state entries
 }
 
-// syncState starts downloading state with the given root hash.
-func (d *Downloader) syncState(root common.Hash) *stateSync {
-	s := newStateSync(d, root)
+// syncState starts downloading state with the given root hash, retrieving it in
+// account and storage ranges first if snap is set.
+func (d *Downloader) syncState(root common.Hash, snap bool) *stateSync {
+	s := newStateSync(d, root, snap)
 	select {
 	case d.stateSyncStart <- s:
 	case <-d.quitCh:
@@ -64,6 +65,8 @@ func (d *Downloader) stateFetcher() {
 			}
 		case <-d.stateCh:
 			// Ignore state responses while no sync is running.
+		case <-d.snapCh:
+			// Ignore state ranges while no sync is running.
 		case <-d.quitCh:
 			return
 		}
@@ -133,6 +136,14 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 			finished = append(finished, req)
 			delete(active, pack.PeerId())
 
+		// Handle incoming state ranges, while the sync is retrieving them:
+		case pack := <-d.snapCh:
+			select {
+			case s.ranges <- pack.(*rangePack):
+			case <-s.snapDone:
+				log.Debug("Unrequested state range", "peer", pack.PeerId(), "len", pack.Items())
+			}
+
 		// Handle dropped peer connections:
 		case p := <-peerDrop:
 			// Skip if no request is currently pending
@@ -193,7 +204,13 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 // stateSync schedules requests for downloading a particular state trie defined
 // by a given state root.
 type stateSync struct {
-	d *Downloader // Downloader instance to access and manage current peerset
+	d    *Downloader // Downloader instance to access and manage current peerset
+	root common.Hash // State root being synchronised
+
+	snap       bool                // Whether to retrieve the state in ranges before healing it
+	ranges     chan *rangePack     // Channel receiving the state ranges requested
+	snapDone   chan struct{}       // Channel closed once no more state ranges are requested
+	snapFailed map[string]struct{} // Peers that failed to serve a state range
 
 	sched  *trie.TrieSync             // State trie sync scheduler defining the tasks
 	keccak hash.Hash                  // Keccak256 hasher to verify deliveries with
@@ -217,15 +234,20 @@ type stateTask struct {
 
 // newStateSync creates a new state trie download scheduler. This method does not
 // yet start the sync. The user needs to call run to initiate.
-func newStateSync(d *Downloader, root common.Hash) *stateSync {
+func newStateSync(d *Downloader, root common.Hash, snap bool) *stateSync {
 	return &stateSync{
-		d:       d,
-		sched:   state.NewStateSync(root, d.stateDB),
-		keccak:  sha3.NewKeccak256(),
-		tasks:   make(map[common.Hash]*stateTask),
-		deliver: make(chan *stateReq),
-		cancel:  make(chan struct{}),
-		done:    make(chan struct{}),
+		d:          d,
+		root:       root,
+		snap:       snap,
+		ranges:     make(chan *rangePack),
+		snapDone:   make(chan struct{}),
+		snapFailed: make(map[string]struct{}),
+		sched:      state.NewStateSync(root, d.stateDB),
+		keccak:     sha3.NewKeccak256(),
+		tasks:      make(map[common.Hash]*stateTask),
+		deliver:    make(chan *stateReq),
+		cancel:     make(chan struct{}),
+		done:       make(chan struct{}),
 	}
 }
 
@@ -233,7 +255,13 @@ func newStateSync(d *Downloader, root common.Hash) *stateSync {
 // it finishes, and finally notifying any goroutines waiting for the loop to
 // finish.
 func (s *stateSync) run() {
-	s.err = s.loop()
+	if s.snap {
+		s.err = s.snapSync()
+	}
+	close(s.snapDone)
+	if s.err == nil {
+		s.err = s.loop()
+	}
 	close(s.done)
 }
 
@@ -282,7 +310,7 @@ func (s *stateSync) loop() error {
 				// 2 items are the minimum requested, if even that times out, we've no use of
 				// this peer at the moment.
 				log.Warn("Stalling state sync, dropping peer", "peer", req.peer.id)
-				s.d.dropPeer(req.peer.id)
+				s.d.dropPeer(req.peer.id, errStallingPeer)
 			}
 			// Process all the received blobs and check for stale delivery
 			stale, err := s.process(req)
@@ -3,11 +3,13 @@ package downloader
 import (
 	"fmt"
 
+	"github.com/kowala-tech/kUSD/common"
 	"github.com/kowala-tech/kUSD/core/types"
 )
 
-// peerDropFn is a callback type for dropping a peer detected as malicious.
-type peerDropFn func(id string)
+// peerDropFn is a callback type for dropping a peer detected as malicious, along
+// with the error the peer caused.
+type peerDropFn func(id string, reason error)
 
 // dataPack is a data message returned by a peer for some query.
 type dataPack interface {
@@ -64,3 +66,16 @@ type statePack struct {
 func (p *statePack) PeerId() string { return p.peerId }
 func (p *statePack) Items() int     { return len(p.states) }
 func (p *statePack) Stats() string  { return fmt.Sprintf("%d", len(p.states)) }
+
+// rangePack is a contiguous range of state entries (accounts or storage slots)
+// returned by a peer, along with the merkle proofs of its edges.
+type rangePack struct {
+	peerId string
+	hashes []common.Hash
+	values [][]byte
+	proof  [][]byte
+}
+
+func (p *rangePack) PeerId() string { return p.peerId }
+func (p *rangePack) Items() int     { return len(p.hashes) }
+func (p *rangePack) Stats() string  { return fmt.Sprintf("%d", len(p.hashes)) }
@@ -0,0 +1,72 @@
+package kusd
+
+import (
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/p2p/enr"
+	"github.com/kowala-tech/kUSD/rlp"
+)
+
+// NodeRole is a bit set of the services a node provides to the network.
+type NodeRole uint
+
+const (
+	RoleValidator   NodeRole = 1 << iota // Node takes part in the consensus elections
+	RoleLightServer                      // Node serves light clients
+)
+
+// kusdEntry is the "kusd" entry in the node record, advertising the chain served
+// by the node and its role on the network.
+type kusdEntry struct {
+	NetworkID uint64
+	Genesis   common.Hash
+	Role      NodeRole
+
+	// Ignore additional fields (for forward compatibility).
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// ENRKey implements enr.Entry.
+func (e kusdEntry) ENRKey() string {
+	return "kusd"
+}
+
+// nodeFilter accepts the dial candidates whose node record advertises the same
+// network and genesis as the local chain.
+func (pm *ProtocolManager) nodeFilter(record *enr.Record) bool {
+	var entry kusdEntry
+	if err := record.Load(&entry); err != nil {
+		return false
+	}
+	return entry.NetworkID == pm.networkID && entry.Genesis == pm.blockchain.Genesis().Hash()
+}
+
+// enrEntry assembles the kusd entry of the local node record.
+func (s *Kowala) enrEntry(validating bool) kusdEntry {
+	entry := kusdEntry{
+		NetworkID: s.networkId,
+		Genesis:   s.blockchain.Genesis().Hash(),
+	}
+	if validating {
+		entry.Role |= RoleValidator
+	}
+	if s.config.LightServ > 0 {
+		entry.Role |= RoleLightServer
+	}
+	return entry
+}
+
+// updateEnrEntry republishes the kusd entry of the local node record after a
+// change in the role of the node.
+func (s *Kowala) updateEnrEntry(validating bool) {
+	s.lock.RLock()
+	srvr := s.p2pServer
+	s.lock.RUnlock()
+
+	if srvr == nil {
+		return
+	}
+	if err := srvr.SetRecordEntries(s.enrEntry(validating)); err != nil {
+		log.Warn("Failed to update node record", "err", err)
+	}
+}
@@ -24,4 +24,11 @@ var (
 	headerFilterOutMeter = metrics.NewMeter("eth/fetcher/filter/headers/out")
 	bodyFilterInMeter    = metrics.NewMeter("eth/fetcher/filter/bodies/in")
 	bodyFilterOutMeter   = metrics.NewMeter("eth/fetcher/filter/bodies/out")
+
+	txAnnounceInMeter    = metrics.NewMeter("eth/fetcher/tx/announces/in")
+	txAnnounceKnownMeter = metrics.NewMeter("eth/fetcher/tx/announces/known")
+	txAnnounceDOSMeter   = metrics.NewMeter("eth/fetcher/tx/announces/dos")
+	txBroadcastInMeter   = metrics.NewMeter("eth/fetcher/tx/broadcasts/in")
+	txFetchMeter         = metrics.NewMeter("eth/fetcher/tx/fetch")
+	txFetchTimeoutMeter  = metrics.NewMeter("eth/fetcher/tx/fetch/timeouts")
 )
@@ -0,0 +1,299 @@
+package fetcher
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/log"
+)
+
+const (
+	txArriveTimeout = 500 * time.Millisecond // Time allowance before an announced transaction is explicitly requested
+	txFetchTimeout  = 5 * time.Second        // Maximum allotted time to return an explicitly requested transaction
+	txAnnounceLimit = 4096                   // Maximum number of unique transactions a peer may have announced
+	txFetchLimit    = 256                    // Maximum number of transactions requested from a peer at once
+)
+
+// txPresenceFn is a callback type for checking whether a transaction is already
+// known locally.
+type txPresenceFn func(common.Hash) bool
+
+// txAdderFn is a callback type to add a batch of transactions to the local pool.
+type txAdderFn func([]*types.Transaction) []error
+
+// txRequesterFn is a callback type for sending a pooled transaction retrieval
+// request to a peer.
+type txRequesterFn func(peer string, hashes []common.Hash) error
+
+// txAnnounce is the hash notification of the availability of a transaction at a
+// peer, or a pending retrieval request of it.
+type txAnnounce struct {
+	origin string    // Identifier of the peer originating the notification
+	time   time.Time // Timestamp of the announcement or of the request
+}
+
+// txNotification is a batch of transaction hashes announced by a peer.
+type txNotification struct {
+	origin string
+	hashes []common.Hash
+	time   time.Time
+}
+
+// TxFetcher is responsible for accumulating transaction announcements from
+// various peers and retrieving the transactions which aren't broadcast to the
+// local node in full shortly after.
+type TxFetcher struct {
+	// Various event channels
+	notify  chan *txNotification
+	deliver chan []common.Hash
+	drop    chan string
+	quit    chan struct{}
+
+	// Announce states
+	announces map[string]int                // Per peer announce counts to prevent memory exhaustion
+	announced map[common.Hash][]*txAnnounce // Announced transactions with all the peers announcing them
+	fetching  map[common.Hash]*txAnnounce   // Announced transactions, currently fetching
+
+	// Callbacks
+	hasTx    txPresenceFn  // Checks whether a transaction is already in the local pool
+	addTxs   txAdderFn     // Injects a batch of transactions into the pool
+	fetchTxs txRequesterFn // Requests a batch of transactions from a peer
+
+	// Testing hooks
+	fetchingHook func(string, []common.Hash) // Method to call upon starting a transaction fetch
+}
+
+// NewTxFetcher creates a transaction fetcher to retrieve transactions based on
+// hash announcements.
+func NewTxFetcher(hasTx txPresenceFn, addTxs txAdderFn, fetchTxs txRequesterFn) *TxFetcher {
+	return &TxFetcher{
+		notify:    make(chan *txNotification),
+		deliver:   make(chan []common.Hash),
+		drop:      make(chan string),
+		quit:      make(chan struct{}),
+		announces: make(map[string]int),
+		announced: make(map[common.Hash][]*txAnnounce),
+		fetching:  make(map[common.Hash]*txAnnounce),
+		hasTx:     hasTx,
+		addTxs:    addTxs,
+		fetchTxs:  fetchTxs,
+	}
+}
+
+// Start boots up the announcement based transaction retrieval, accepting and
+// processing hash notifications until termination requested.
+func (f *TxFetcher) Start() {
+	go f.loop()
+}
+
+// Stop terminates the announcement based transaction retrieval, canceling all
+// pending operations.
+func (f *TxFetcher) Stop() {
+	close(f.quit)
+}
+
+// Notify announces the fetcher of the availability of a batch of transactions
+// at a peer.
+func (f *TxFetcher) Notify(peer string, hashes []common.Hash, time time.Time) error {
+	select {
+	case f.notify <- &txNotification{origin: peer, hashes: hashes, time: time}:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Enqueue imports a batch of transactions received from a peer, either broadcast
+// or explicitly requested, into the pool and stops tracking their announcements.
+func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction) error {
+	txBroadcastInMeter.Mark(int64(len(txs)))
+
+	f.addTxs(txs)
+
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	select {
+	case f.deliver <- hashes:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Drop forgets the announcements of a disconnected peer, rescheduling the
+// retrieval of the transactions it was asked for from other announcers.
+func (f *TxFetcher) Drop(peer string) error {
+	select {
+	case f.drop <- peer:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Loop is the main transaction fetcher loop, checking and processing various
+// notification events.
+func (f *TxFetcher) loop() {
+	fetchTimer := time.NewTimer(0)
+
+	for {
+		select {
+		case <-f.quit:
+			// Fetcher terminating, abort all operations
+			return
+
+		case notification := <-f.notify:
+			// Transactions were announced, make sure the peer isn't DOSing us
+			txAnnounceInMeter.Mark(int64(len(notification.hashes)))
+
+			for _, hash := range notification.hashes {
+				if f.announces[notification.origin] >= txAnnounceLimit {
+					log.Debug("Peer exceeded outstanding transaction announces", "peer", notification.origin, "limit", txAnnounceLimit)
+					txAnnounceDOSMeter.Mark(1)
+					break
+				}
+				if f.announcedBy(hash, notification.origin) {
+					continue
+				}
+				if f.hasTx(hash) {
+					txAnnounceKnownMeter.Mark(1)
+					continue
+				}
+				f.announces[notification.origin]++
+				f.announced[hash] = append(f.announced[hash], &txAnnounce{origin: notification.origin, time: notification.time})
+			}
+			f.reschedule(fetchTimer)
+
+		case hashes := <-f.deliver:
+			// Transactions arrived, stop tracking their announcements
+			for _, hash := range hashes {
+				f.forgetHash(hash)
+			}
+
+		case peer := <-f.drop:
+			// A peer disconnected, reschedule whatever it was asked for
+			for hash := range f.announced {
+				f.forgetAnnounce(hash, peer)
+			}
+			delete(f.announces, peer)
+			f.reschedule(fetchTimer)
+
+		case <-fetchTimer.C:
+			// Give up on the requests timing out, letting another announcer serve them
+			for hash, request := range f.fetching {
+				if time.Since(request.time) > txFetchTimeout {
+					log.Trace("Transaction retrieval timed out", "peer", request.origin, "hash", hash)
+					txFetchTimeoutMeter.Mark(1)
+					f.forgetAnnounce(hash, request.origin)
+				}
+			}
+			// Request the transactions which didn't arrive in time by other means
+			request := make(map[string][]common.Hash)
+
+			for hash, announces := range f.announced {
+				if _, ok := f.fetching[hash]; ok {
+					continue
+				}
+				if time.Since(announces[0].time) <= txArriveTimeout-gatherSlack {
+					continue
+				}
+				if f.hasTx(hash) {
+					f.forgetHash(hash)
+					continue
+				}
+				// Pick a random peer to retrieve from, keeping the others as fallbacks
+				announce := announces[rand.Intn(len(announces))]
+				if len(request[announce.origin]) >= txFetchLimit {
+					continue
+				}
+				request[announce.origin] = append(request[announce.origin], hash)
+				f.fetching[hash] = &txAnnounce{origin: announce.origin, time: time.Now()}
+			}
+			// Send out all transaction requests
+			for peer, hashes := range request {
+				log.Trace("Fetching announced transactions", "peer", peer, "count", len(hashes))
+				if f.fetchingHook != nil {
+					f.fetchingHook(peer, hashes)
+				}
+				txFetchMeter.Mark(int64(len(hashes)))
+				go f.fetchTxs(peer, hashes)
+			}
+			// Schedule the next fetch or timeout check if transactions are still pending
+			f.reschedule(fetchTimer)
+		}
+	}
+}
+
+// reschedule resets the specified fetch timer to the next announce arrival or
+// request timeout.
+func (f *TxFetcher) reschedule(fetch *time.Timer) {
+	if len(f.announced) == 0 {
+		return
+	}
+	next := time.Now().Add(txFetchTimeout)
+	for hash, announces := range f.announced {
+		deadline := announces[0].time.Add(txArriveTimeout)
+		if request, ok := f.fetching[hash]; ok {
+			deadline = request.time.Add(txFetchTimeout)
+		}
+		if deadline.Before(next) {
+			next = deadline
+		}
+	}
+	fetch.Reset(next.Sub(time.Now()))
+}
+
+// announcedBy checks whether a peer already announced a transaction.
+func (f *TxFetcher) announcedBy(hash common.Hash, peer string) bool {
+	for _, announce := range f.announced[hash] {
+		if announce.origin == peer {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetAnnounce removes the announcement of a transaction by a peer, canceling
+// any pending retrieval from it, and forgets the transaction entirely if no
+// other peer announced it.
+func (f *TxFetcher) forgetAnnounce(hash common.Hash, peer string) {
+	if request := f.fetching[hash]; request != nil && request.origin == peer {
+		delete(f.fetching, hash)
+	}
+	announces := f.announced[hash]
+	for i, announce := range announces {
+		if announce.origin == peer {
+			announces = append(announces[:i], announces[i+1:]...)
+			f.decAnnounces(peer)
+			break
+		}
+	}
+	if len(announces) == 0 {
+		delete(f.announced, hash)
+		delete(f.fetching, hash)
+		return
+	}
+	f.announced[hash] = announces
+}
+
+// forgetHash removes all traces of a transaction announcement from the fetcher's
+// internal state.
+func (f *TxFetcher) forgetHash(hash common.Hash) {
+	for _, announce := range f.announced[hash] {
+		f.decAnnounces(announce.origin)
+	}
+	delete(f.announced, hash)
+	delete(f.fetching, hash)
+}
+
+// decAnnounces decrements the outstanding announce count of a peer.
+func (f *TxFetcher) decAnnounces(peer string) {
+	f.announces[peer]--
+	if f.announces[peer] <= 0 {
+		delete(f.announces, peer)
+	}
+}
@@ -0,0 +1,205 @@
+package fetcher
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/types"
+)
+
+// txFetcherTester is a test simulator for mocking out the local transaction pool
+// and the remote peers serving announced transactions.
+type txFetcherTester struct {
+	fetcher *TxFetcher
+
+	pool  map[common.Hash]*types.Transaction            // Transactions in the local pool
+	peers map[string]map[common.Hash]*types.Transaction // Transactions served by each peer
+
+	lock sync.RWMutex
+}
+
+// newTxTester creates a new transaction fetcher test mocker.
+func newTxTester() *txFetcherTester {
+	tester := &txFetcherTester{
+		pool:  make(map[common.Hash]*types.Transaction),
+		peers: make(map[string]map[common.Hash]*types.Transaction),
+	}
+	tester.fetcher = NewTxFetcher(tester.hasTx, tester.addTxs, tester.fetchTxs)
+	tester.fetcher.Start()
+
+	return tester
+}
+
+// hasTx checks whether a transaction is in the simulated pool.
+func (t *txFetcherTester) hasTx(hash common.Hash) bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	_, ok := t.pool[hash]
+	return ok
+}
+
+// addTxs injects transactions into the simulated pool.
+func (t *txFetcherTester) addTxs(txs []*types.Transaction) []error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, tx := range txs {
+		t.pool[tx.Hash()] = tx
+	}
+	return make([]error, len(txs))
+}
+
+// fetchTxs serves a transaction request from the transactions of a peer,
+// silently ignoring the request if the peer doesn't respond.
+func (t *txFetcherTester) fetchTxs(peer string, hashes []common.Hash) error {
+	t.lock.RLock()
+	var txs []*types.Transaction
+	for _, hash := range hashes {
+		if tx, ok := t.peers[peer][hash]; ok {
+			txs = append(txs, tx)
+		}
+	}
+	t.lock.RUnlock()
+
+	if len(txs) > 0 {
+		go t.fetcher.Enqueue(peer, txs)
+	}
+	return nil
+}
+
+// makeTxs creates a batch of unique transactions and their hashes.
+func makeTxs(n int) ([]*types.Transaction, []common.Hash) {
+	txs := make([]*types.Transaction, n)
+	hashes := make([]common.Hash, n)
+	for i := 0; i < n; i++ {
+		txs[i] = types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+		hashes[i] = txs[i].Hash()
+	}
+	return txs, hashes
+}
+
+// serve makes a peer respond to retrievals of the given transactions.
+func (t *txFetcherTester) serve(peer string, txs []*types.Transaction) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.peers[peer] = make(map[common.Hash]*types.Transaction)
+	for _, tx := range txs {
+		t.peers[peer][tx.Hash()] = tx
+	}
+}
+
+// verifyPooled waits until all the transactions are in the simulated pool.
+func verifyPooled(t *testing.T, tester *txFetcherTester, hashes []common.Hash, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for {
+		pooled := 0
+		for _, hash := range hashes {
+			if tester.hasTx(hash) {
+				pooled++
+			}
+		}
+		if pooled == len(hashes) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pooled transaction count mismatch: have %d, want %d", pooled, len(hashes))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Tests that announced transactions are retrieved from the announcing peer.
+func TestTxAnnounceRetrieval(t *testing.T) {
+	tester := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs, hashes := makeTxs(16)
+	tester.serve("valid", txs)
+
+	tester.fetcher.Notify("valid", hashes, time.Now().Add(-txArriveTimeout))
+	verifyPooled(t, tester, hashes, time.Second)
+}
+
+// Tests that transactions broadcast in full while waiting for their arrival are
+// not requested from their announcers.
+func TestTxAnnounceBroadcastArrival(t *testing.T) {
+	tester := newTxTester()
+	defer tester.fetcher.Stop()
+
+	fetched := make(chan []common.Hash, 1)
+	tester.fetcher.fetchingHook = func(peer string, hashes []common.Hash) { fetched <- hashes }
+
+	txs, hashes := makeTxs(4)
+	tester.fetcher.Notify("announcer", hashes, time.Now())
+	tester.fetcher.Enqueue("broadcaster", txs)
+
+	select {
+	case hashes := <-fetched:
+		t.Fatalf("broadcast transactions fetched: %v", hashes)
+	case <-time.After(2 * txArriveTimeout):
+	}
+	verifyPooled(t, tester, hashes, 0)
+}
+
+// Tests that transactions not delivered by their announcer in time are retrieved
+// from another peer announcing them.
+func TestTxAnnounceTimeoutRetry(t *testing.T) {
+	tester := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs, hashes := makeTxs(4)
+	tester.serve("valid", txs)
+
+	// Announce by a silent peer first, only requesting from it
+	tester.fetcher.Notify("silent", hashes, time.Now().Add(-txArriveTimeout))
+	time.Sleep(2 * gatherSlack)
+	tester.fetcher.Notify("valid", hashes, time.Now())
+
+	// Fast forward the timeout of the pending requests
+	time.Sleep(txFetchTimeout)
+	verifyPooled(t, tester, hashes, 2*time.Second)
+}
+
+// Tests that dropping a peer reschedules the retrievals pending with it.
+func TestTxAnnounceDroppedPeer(t *testing.T) {
+	tester := newTxTester()
+	defer tester.fetcher.Stop()
+
+	txs, hashes := makeTxs(4)
+	tester.serve("valid", txs)
+
+	tester.fetcher.Notify("silent", hashes, time.Now().Add(-txArriveTimeout))
+	time.Sleep(2 * gatherSlack)
+	tester.fetcher.Notify("valid", hashes, time.Now())
+	tester.fetcher.Drop("silent")
+
+	verifyPooled(t, tester, hashes, time.Second)
+}
+
+// Tests that a peer can't announce more transactions than the fetcher tracks.
+func TestTxAnnounceDOSProtection(t *testing.T) {
+	tester := newTxTester()
+	defer tester.fetcher.Stop()
+
+	var requested int
+	var lock sync.Mutex
+	tester.fetcher.fetchingHook = func(peer string, hashes []common.Hash) {
+		lock.Lock()
+		requested += len(hashes)
+		lock.Unlock()
+	}
+	_, hashes := makeTxs(txAnnounceLimit + 64)
+	tester.fetcher.Notify("attacker", hashes, time.Now().Add(-txArriveTimeout))
+
+	time.Sleep(time.Second)
+	lock.Lock()
+	defer lock.Unlock()
+	if requested != txAnnounceLimit {
+		t.Fatalf("requested transaction count mismatch: have %d, want %d", requested, txAnnounceLimit)
+	}
+}
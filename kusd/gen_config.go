@@ -8,6 +8,7 @@ import (
 	"github.com/kowala-tech/kUSD/common"
 	"github.com/kowala-tech/kUSD/common/hexutil"
 	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/types"
 	"github.com/kowala-tech/kUSD/kusd/downloader"
 	"github.com/kowala-tech/kUSD/kusd/gasprice"
 )
@@ -19,16 +20,18 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               uint64
 		SyncMode                downloader.SyncMode
-		LightServ               int  `toml:",omitempty"`
-		LightPeers              int  `toml:",omitempty"`
-		MaxPeers                int  `toml:"-"`
-		SkipBcVersionCheck      bool `toml:"-"`
-		DatabaseHandles         int  `toml:"-"`
+		Checkpoint              *types.Checkpoint `toml:"-"`
+		LightServ               int               `toml:",omitempty"`
+		LightPeers              int               `toml:",omitempty"`
+		MaxPeers                int               `toml:"-"`
+		SkipBcVersionCheck      bool              `toml:"-"`
+		DatabaseHandles         int               `toml:"-"`
 		DatabaseCache           int
 		Coinbase                common.Address `toml:",omitempty"`
 		Deposit                 uint64         `toml:",omitempty"`
 		ExtraData               hexutil.Bytes  `toml:",omitempty"`
 		GasPrice                *big.Int
+		ValidatorTrace          string `toml:",omitempty"`
 		TxPool                  core.TxPoolConfig
 		GPO                     gasprice.Config
 		EnablePreimageRecording bool
@@ -38,6 +41,7 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.Genesis = c.Genesis
 	enc.NetworkId = c.NetworkId
 	enc.SyncMode = c.SyncMode
+	enc.Checkpoint = c.Checkpoint
 	enc.LightServ = c.LightServ
 	enc.LightPeers = c.LightPeers
 	enc.MaxPeers = c.MaxPeers
@@ -48,6 +52,7 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.Deposit = c.Deposit
 	enc.ExtraData = c.ExtraData
 	enc.GasPrice = c.GasPrice
+	enc.ValidatorTrace = c.ValidatorTrace
 	enc.TxPool = c.TxPool
 	enc.GPO = c.GPO
 	enc.EnablePreimageRecording = c.EnablePreimageRecording
@@ -60,16 +65,18 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               *uint64
 		SyncMode                *downloader.SyncMode
-		LightServ               *int  `toml:",omitempty"`
-		LightPeers              *int  `toml:",omitempty"`
-		MaxPeers                *int  `toml:"-"`
-		SkipBcVersionCheck      *bool `toml:"-"`
-		DatabaseHandles         *int  `toml:"-"`
+		Checkpoint              *types.Checkpoint `toml:"-"`
+		LightServ               *int              `toml:",omitempty"`
+		LightPeers              *int              `toml:",omitempty"`
+		MaxPeers                *int              `toml:"-"`
+		SkipBcVersionCheck      *bool             `toml:"-"`
+		DatabaseHandles         *int              `toml:"-"`
 		DatabaseCache           *int
 		Coinbase                *common.Address `toml:",omitempty"`
 		Deposit                 *uint64         `toml:",omitempty"`
 		ExtraData               hexutil.Bytes   `toml:",omitempty"`
 		GasPrice                *big.Int
+		ValidatorTrace          *string `toml:",omitempty"`
 		TxPool                  *core.TxPoolConfig
 		GPO                     *gasprice.Config
 		EnablePreimageRecording *bool
@@ -88,6 +95,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.SyncMode != nil {
 		c.SyncMode = *dec.SyncMode
 	}
+	if dec.Checkpoint != nil {
+		c.Checkpoint = dec.Checkpoint
+	}
 	if dec.LightServ != nil {
 		c.LightServ = *dec.LightServ
 	}
@@ -118,6 +128,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.GasPrice != nil {
 		c.GasPrice = dec.GasPrice
 	}
+	if dec.ValidatorTrace != nil {
+		c.ValidatorTrace = *dec.ValidatorTrace
+	}
 	if dec.TxPool != nil {
 		c.TxPool = *dec.TxPool
 	}
@@ -0,0 +1,289 @@
+package kusd
+
+import (
+	"math"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/kusd/validator"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/p2p/discover"
+	"github.com/kowala-tech/kUSD/params"
+)
+
+const (
+	announceInterval = 5 * time.Minute  // Interval between the announcements of a local validator
+	announceCheck    = 10 * time.Second // Interval between checks whether the local node started validating
+	announceExpiry   = 15 * time.Minute // Age after which validator announcements are discarded
+
+	maxSeenConsensus = 4096 // Maximum consensus message hashes to remember for deduplication
+	maxAnnounces     = 1024 // Maximum number of validators to track announcements of
+
+	// consensusRelayWindow is the distance from the local chain head within
+	// which consensus messages are relayed. Messages for older or far future
+	// blocks are only delivered to the local validator.
+	consensusRelayWindow = 2
+)
+
+// validatorSetFn is a callback type for loading the validator set committing
+// the child of a block.
+type validatorSetFn func(block *types.Block) (*types.ValidatorSet, error)
+
+// gossip tracks the consensus messages and validator announcements already
+// seen by the local node, so each of them is processed and relayed only once.
+// Only the messages signed by the keys of the current validators are accepted.
+type gossip struct {
+	seen      *lru.Cache                         // Hashes of the consensus messages already seen
+	announces map[common.Address]*types.Announce // Latest announcement of each validator
+	lock      sync.Mutex                         // Protects the announcements
+
+	loadValidators validatorSetFn      // Loads the validator set of a chain head
+	validators     *types.ValidatorSet // Validator set of the last chain head seen
+	validatorsHead common.Hash         // Hash of the chain head the validator set is of
+	validatorsLock sync.Mutex          // Protects the validator set
+}
+
+// validatorsAt returns the function loading the validator set committing the
+// child of a block of the given chain.
+func validatorsAt(config *params.ChainConfig, chain *core.BlockChain) validatorSetFn {
+	validators := validator.ValidatorsAt(config)
+	return func(block *types.Block) (*types.ValidatorSet, error) {
+		statedb, err := chain.StateAt(block.Root())
+		if err != nil {
+			return nil, err
+		}
+		return validators(block.Header(), statedb)
+	}
+}
+
+// newGossip creates a new consensus gossip tracker, accepting the messages of
+// the validator sets loaded by loadValidators.
+func newGossip(loadValidators validatorSetFn) *gossip {
+	seen, _ := lru.New(maxSeenConsensus)
+	return &gossip{
+		seen:           seen,
+		announces:      make(map[common.Address]*types.Announce),
+		loadValidators: loadValidators,
+	}
+}
+
+// isValidator returns whether the given key signs for a member of the validator
+// set committing the child of head. The set is loaded once per chain head, the
+// keys are rejected if it can't be loaded.
+func (g *gossip) isValidator(head *types.Block, signer common.Address) bool {
+	g.validatorsLock.Lock()
+	defer g.validatorsLock.Unlock()
+
+	if g.validators == nil || g.validatorsHead != head.Hash() {
+		validators, err := g.loadValidators(head)
+		if err != nil {
+			log.Warn("Failed to load the validator set", "number", head.Number(), "hash", head.Hash(), "err", err)
+			return false
+		}
+		g.validators, g.validatorsHead = validators, head.Hash()
+	}
+	return g.validators.GetBySigner(signer) != nil
+}
+
+// markSeen marks a consensus message as seen, returning whether it is new.
+func (g *gossip) markSeen(hash common.Hash) bool {
+	seen, _ := g.seen.ContainsOrAdd(hash, struct{}{})
+	return !seen
+}
+
+// addAnnounce records a validator announcement, returning whether it is newer
+// than the one already known for the validator.
+func (g *gossip) addAnnounce(announce *types.Announce, now time.Time) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	known := g.announces[announce.Address()]
+	if known != nil && known.Timestamp() >= announce.Timestamp() {
+		return false
+	}
+	if known == nil && len(g.announces) >= maxAnnounces {
+		g.expire(now)
+		if len(g.announces) >= maxAnnounces {
+			return false
+		}
+	}
+	g.announces[announce.Address()] = announce
+	return true
+}
+
+// announcements retrieves the fresh validator announcements known.
+func (g *gossip) announcements(now time.Time) []*types.Announce {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.expire(now)
+
+	announces := make([]*types.Announce, 0, len(g.announces))
+	for _, announce := range g.announces {
+		announces = append(announces, announce)
+	}
+	return announces
+}
+
+// expire drops the stale validator announcements. The method expects the lock
+// to be held.
+func (g *gossip) expire(now time.Time) {
+	for address, announce := range g.announces {
+		if !freshAnnounce(announce, now) {
+			delete(g.announces, address)
+		}
+	}
+}
+
+// freshAnnounce returns whether a validator announcement is recent enough to
+// be accepted and relayed.
+func freshAnnounce(announce *types.Announce, now time.Time) bool {
+	created := time.Unix(int64(announce.Timestamp()), 0)
+	return now.Sub(created) < announceExpiry && created.Sub(now) < announceExpiry
+}
+
+// validating returns whether the local node is taking part in the consensus.
+func (pm *ProtocolManager) validating() bool {
+	return pm.validator != nil && pm.validator.Validating()
+}
+
+// relayable returns whether consensus messages for the given block number are
+// worth relaying, i.e. whether the block is close to the local chain head.
+func (pm *ProtocolManager) relayable(number *big.Int) bool {
+	if number == nil || !number.IsUint64() {
+		return false
+	}
+	head, n := pm.blockchain.CurrentBlock().NumberU64(), number.Uint64()
+	return n+consensusRelayWindow > head && n <= head+consensusRelayWindow
+}
+
+// relayTargets selects the peers to relay a consensus message to out of the
+// ones not knowing about it yet: all the peers leading to validators and the
+// square root of the remaining ones, to keep the message spreading through
+// nodes not aware of any validator.
+func relayTargets(peers []*peer) []*peer {
+	var routes, others []*peer
+	for _, p := range peers {
+		if p.IsRoute() {
+			routes = append(routes, p)
+		} else {
+			others = append(others, p)
+		}
+	}
+	return append(routes, others[:int(math.Sqrt(float64(len(others))))]...)
+}
+
+// isValidator returns whether the given key signs for a member of the current
+// validator set. Consensus messages of other keys are neither processed nor
+// relayed.
+func (pm *ProtocolManager) isValidator(signer common.Address) bool {
+	return pm.gossip.isValidator(pm.blockchain.CurrentBlock(), signer)
+}
+
+// announce signs a fresh announcement of the local validator and propagates it
+// to all peers.
+func (pm *ProtocolManager) announce() error {
+	announce, err := pm.validator.SignAnnounce(types.NewAnnounce(pm.validator.Address(), pm.self, uint64(time.Now().Unix())))
+	if err != nil {
+		return err
+	}
+
+	pm.gossip.addAnnounce(announce, time.Now())
+	peers := pm.peers.PeersWithoutAnnounce(announce.Hash())
+	for _, peer := range peers {
+		peer.SendValidatorAnnounces([]*types.Announce{announce})
+	}
+	log.Debug("Announced validator", "address", announce.Address, "recipients", len(peers))
+	return nil
+}
+
+// announceLoop periodically announces the local validator to the network while
+// it takes part in the consensus.
+func (pm *ProtocolManager) announceLoop() {
+	ticker := time.NewTicker(announceCheck)
+	defer ticker.Stop()
+
+	var last time.Time // Time of the last announcement, zero if not validating
+	for {
+		select {
+		case <-ticker.C:
+			if !pm.validating() {
+				last = time.Time{}
+				continue
+			}
+			if time.Since(last) < announceInterval {
+				continue
+			}
+			if err := pm.announce(); err != nil {
+				log.Warn("Failed to announce validator", "err", err)
+				continue
+			}
+			last = time.Now()
+
+		case <-pm.quitSync:
+			return
+		}
+	}
+}
+
+// handleAnnounces processes a batch of validator announcements received from a
+// remote peer, recording the validators reachable through the peer and relaying
+// the new announcements to the rest of the network.
+func (pm *ProtocolManager) handleAnnounces(p *peer, announces []*types.Announce) error {
+	now := time.Now()
+	for i, announce := range announces {
+		if announce == nil {
+			return errResp(ErrDecode, "announcement %d is nil", i)
+		}
+		signer, err := types.AnnounceSender(pm.signer, announce)
+		if err != nil {
+			return errResp(ErrInvalidAnnouncement, "announcement %d: %v", i, err)
+		}
+		if signer != announce.Address() {
+			return errResp(ErrInvalidAnnouncement, "announcement %d: signed by %x, not %x", i, signer, announce.Address())
+		}
+		hash := announce.Hash()
+		p.MarkAnnounce(hash)
+
+		// Stale announcements may be in flight for a while, skip them silently
+		if !freshAnnounce(announce, now) {
+			continue
+		}
+		// Skip our own announcements bouncing back
+		if pm.validating() && announce.Address() == pm.validator.Address() {
+			continue
+		}
+		// Announcements of former or would-be validators are neither stored nor
+		// relayed, they'd let anyone attract the consensus traffic
+		if !pm.isValidator(announce.Address()) {
+			continue
+		}
+		p.AddRoute(announce.Address(), discover.NodeID(announce.Node()) == p.ID())
+
+		if !pm.gossip.addAnnounce(announce, now) {
+			continue
+		}
+		for _, peer := range pm.peers.PeersWithoutAnnounce(hash) {
+			if peer != p {
+				peer.SendValidatorAnnounces([]*types.Announce{announce})
+			}
+		}
+	}
+	return nil
+}
+
+// syncAnnounces sends the fresh validator announcements known to a newly
+// connected peer, so it learns the routes towards the validators right away.
+func (pm *ProtocolManager) syncAnnounces(p *peer) {
+	if p.version < kusd2 {
+		return
+	}
+	if announces := pm.gossip.announcements(time.Now()); len(announces) > 0 {
+		p.SendValidatorAnnounces(announces)
+	}
+}
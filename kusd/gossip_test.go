@@ -0,0 +1,104 @@
+package kusd
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/p2p"
+	"github.com/kowala-tech/kUSD/p2p/discover"
+)
+
+// Tests that consensus messages are only accepted from the keys of the validator
+// set of the chain head, which is loaded once per head.
+func TestGossipValidators(t *testing.T) {
+	var (
+		key, _   = crypto.GenerateKey()
+		signer   = crypto.PubkeyToAddress(key.PublicKey)
+		other, _ = crypto.GenerateKey()
+		loads    int
+		fail     bool
+	)
+	g := newGossip(func(block *types.Block) (*types.ValidatorSet, error) {
+		loads++
+		if fail {
+			return nil, errors.New("state unavailable")
+		}
+		validator := types.NewMultisigValidator(common.Address{0x01}, 0, new(big.Int), []common.Address{signer}, 1)
+		return types.NewValidatorSet([]*types.Validator{validator})
+	})
+	head := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+	if !g.isValidator(head, signer) {
+		t.Errorf("validator key rejected")
+	}
+	if g.isValidator(head, crypto.PubkeyToAddress(other.PublicKey)) {
+		t.Errorf("non-validator key accepted")
+	}
+	if loads != 1 {
+		t.Errorf("validator set loads mismatch: have %d, want %d", loads, 1)
+	}
+	fail = true
+	if g.isValidator(types.NewBlockWithHeader(&types.Header{Number: big.NewInt(2)}), signer) {
+		t.Errorf("key accepted without a validator set")
+	}
+}
+
+// Tests that only newer and fresh announcements of a validator are recorded.
+func TestGossipAnnounces(t *testing.T) {
+	var (
+		g       = newGossip(nil)
+		now     = time.Now()
+		key, _  = crypto.GenerateKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+	)
+	first := types.NewAnnounce(address, [64]byte{}, uint64(now.Unix()))
+	if !g.addAnnounce(first, now) {
+		t.Fatalf("first announcement rejected")
+	}
+	if g.addAnnounce(types.NewAnnounce(address, [64]byte{}, first.Timestamp()), now) {
+		t.Errorf("duplicate announcement accepted")
+	}
+	if !g.addAnnounce(types.NewAnnounce(address, [64]byte{}, first.Timestamp()+1), now) {
+		t.Errorf("newer announcement rejected")
+	}
+	if announces := g.announcements(now); len(announces) != 1 {
+		t.Errorf("announcement count mismatch: have %d, want %d", len(announces), 1)
+	}
+	if announces := g.announcements(now.Add(announceExpiry + time.Minute)); len(announces) != 0 {
+		t.Errorf("stale announcements retained: %d", len(announces))
+	}
+	if !g.markSeen(first.Hash()) || g.markSeen(first.Hash()) {
+		t.Errorf("consensus message deduplication failed")
+	}
+}
+
+// Tests that consensus messages are relayed to all validator routes and a
+// subset of the remaining peers.
+func TestRelayTargets(t *testing.T) {
+	var peers []*peer
+	for i := 0; i < 10; i++ {
+		peers = append(peers, newPeer(kusd1, p2p.NewPeer(discover.NodeID{byte(i)}, "", nil), nil))
+	}
+	key1, _ := crypto.GenerateKey()
+	key2, _ := crypto.GenerateKey()
+	peers[2].AddRoute(crypto.PubkeyToAddress(key1.PublicKey), true)
+	peers[5].AddRoute(crypto.PubkeyToAddress(key2.PublicKey), false)
+
+	targets := relayTargets(peers)
+	if len(targets) != 2+2 { // 2 routes + sqrt(8)
+		t.Fatalf("target count mismatch: have %d, want %d", len(targets), 4)
+	}
+	if targets[0] != peers[2] || targets[1] != peers[5] {
+		t.Errorf("validator routes not targeted first")
+	}
+	if peers[2].Validator() != crypto.PubkeyToAddress(key1.PublicKey) {
+		t.Errorf("direct validator not recorded")
+	}
+	if peers[5].Validator() != (common.Address{}) {
+		t.Errorf("relayed validator recorded as direct")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/kowala-tech/kUSD/common"
 	"github.com/kowala-tech/kUSD/consensus"
 	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/state"
 	"github.com/kowala-tech/kUSD/core/types"
 	"github.com/kowala-tech/kUSD/event"
 	"github.com/kowala-tech/kUSD/kusd/downloader"
@@ -30,6 +31,9 @@ const (
 	softResponseLimit = 2 * 1024 * 1024 // Target maximum size of returned blocks, headers or node data.
 	estHeaderRlpSize  = 500             // Approximate size of an RLP encoded block header
 
+	// maxPooledTxServe is the maximum number of transactions served per request.
+	maxPooledTxServe = 256
+
 	// txChanSize is the size of channel listening to TxPreEvent.
 	// The number is referenced from the size of tx pool.
 	txChanSize = 4096
@@ -43,15 +47,45 @@ var (
 // not compatible (low protocol version restrictions and high requirements).
 var errIncompatibleConfig = errors.New("incompatible configuration")
 
+// protocolError is a violation of the kusd protocol by a remote peer.
+type protocolError struct {
+	code errCode
+	msg  string
+}
+
+func (e *protocolError) Error() string {
+	return fmt.Sprintf("%v - %v", e.code, e.msg)
+}
+
 func errResp(code errCode, format string, v ...interface{}) error {
-	return fmt.Errorf("%v - %v", code, fmt.Sprintf(format, v...))
+	return &protocolError{code: code, msg: fmt.Sprintf(format, v...)}
+}
+
+// misbehaviorPenalty returns the reputation penalty a remote peer deserves for
+// the given error, zero if the error is not a protocol violation. Peers of
+// another network or genesis are merely disconnected, as honest nodes may be
+// misconfigured.
+func misbehaviorPenalty(err error) int {
+	perr, ok := err.(*protocolError)
+	if !ok {
+		return 0
+	}
+	switch perr.code {
+	case ErrSuspendedPeer:
+		return p2p.PenaltyFatal
+	case ErrMsgTooLarge, ErrDecode, ErrInvalidMsgCode, ErrNoStatusMsg, ErrExtraStatusMsg, ErrInvalidAnnouncement, ErrInvalidSignature:
+		return p2p.PenaltyMajor
+	}
+	return 0
 }
 
 type ProtocolManager struct {
 	networkID uint64
 
 	fastSync  uint32 // Flag whether fast sync is enabled (gets disabled if we already have blocks)
+	snapSync  uint32 // Flag whether the state of a fast sync is retrieved in ranges
 	acceptTxs uint32 // Flag whether we're considered synchronised (enables transaction processing)
+	synced    uint32 // Flag whether the initial sync is done (validators wait for it)
 
 	txpool      txPool
 	blockchain  *core.BlockChain
@@ -61,8 +95,12 @@ type ProtocolManager struct {
 
 	downloader *downloader.Downloader
 	fetcher    *fetcher.Fetcher
+	txFetcher  *fetcher.TxFetcher
 	validator  validator.Validator
 	peers      *peerSet
+	gossip     *gossip
+	signer     types.Signer    // Signer to verify the consensus messages with
+	self       discover.NodeID // ID of the local node announced by the local validator, zero if hidden
 
 	SubProtocols []p2p.Protocol
 
@@ -96,19 +134,24 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		validator:   validator,
 		chainconfig: config,
 		peers:       newPeerSet(),
+		gossip:      newGossip(validatorsAt(config, blockchain)),
+		signer:      types.NewAndromedaSigner(config.ChainID),
 		newPeerCh:   make(chan *peer),
 		noMorePeers: make(chan struct{}),
 		txsyncCh:    make(chan *txsync),
 		quitSync:    make(chan struct{}),
 	}
 	// Figure out whether to allow fast sync or not
-	if mode == downloader.FastSync && blockchain.CurrentBlock().NumberU64() > 0 {
+	if (mode == downloader.FastSync || mode == downloader.SnapSync) && blockchain.CurrentBlock().NumberU64() > 0 {
 		log.Warn("Blockchain not empty, fast sync disabled")
 		mode = downloader.FullSync
 	}
-	if mode == downloader.FastSync {
+	if mode == downloader.FastSync || mode == downloader.SnapSync {
 		manager.fastSync = uint32(1)
 	}
+	if mode == downloader.SnapSync {
+		manager.snapSync = uint32(1)
+	}
 	// Initiate a sub-protocol for every implemented version we can handle
 	manager.SubProtocols = make([]p2p.Protocol, 0, len(ProtocolVersions))
 	for i, version := range ProtocolVersions {
@@ -138,13 +181,21 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 				}
 				return nil
 			},
+			NodeFilter: manager.nodeFilter,
 		})
 	}
 	if len(manager.SubProtocols) == 0 {
 		return nil, errIncompatibleConfig
 	}
 	// Construct the different synchronisation mechanisms
-	manager.downloader = downloader.New(mode, chaindb, manager.eventMux, blockchain, nil, manager.removePeer)
+	manager.downloader = downloader.New(mode, chaindb, manager.eventMux, blockchain, nil, func(id string, reason error) {
+		// Slow or stalling peers may be honest, only invalid data is a violation
+		penalty := p2p.PenaltyMinor
+		if downloader.IsInvalidData(reason) {
+			penalty = p2p.PenaltyMajor
+		}
+		manager.suspendPeer(id, penalty, fmt.Sprintf("failed synchronisation: %v", reason))
+	})
 
 	verifyHeader := func(header *types.Header) error {
 		return engine.VerifyHeader(blockchain, header, true)
@@ -161,7 +212,20 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		atomic.StoreUint32(&manager.acceptTxs, 1) // Mark initial sync done on any fetcher import
 		return manager.blockchain.InsertChain(blocks)
 	}
-	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, verifyHeader, manager.BroadcastBlock, heighter, inserter, manager.removePeer)
+	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, verifyHeader, manager.BroadcastBlock, heighter, inserter, func(id string) {
+		manager.suspendPeer(id, p2p.PenaltyFatal, "invalid block propagation")
+	})
+	hasTx := func(hash common.Hash) bool {
+		return txpool.Get(hash) != nil
+	}
+	fetchTxs := func(id string, hashes []common.Hash) error {
+		p := manager.peers.Peer(id)
+		if p == nil {
+			return errNotRegistered
+		}
+		return p.RequestPooledTransactions(hashes)
+	}
+	manager.txFetcher = fetcher.NewTxFetcher(hasTx, txpool.AddRemotes, fetchTxs)
 
 	return manager, nil
 }
@@ -176,6 +240,7 @@ func (pm *ProtocolManager) removePeer(id string) {
 
 	// Unregister the peer from the downloader and Kowala peer set
 	pm.downloader.UnregisterPeer(id)
+	pm.txFetcher.Drop(id)
 	if err := pm.peers.Unregister(id); err != nil {
 		log.Error("Peer removal failed", "peer", id, "err", err)
 	}
@@ -185,10 +250,20 @@ func (pm *ProtocolManager) removePeer(id string) {
 	}
 }
 
+// suspendPeer penalizes the reputation of a peer detected as misbehaving by the
+// downloader or the fetcher, and removes it.
+func (pm *ProtocolManager) suspendPeer(id string, penalty int, reason string) {
+	if peer := pm.peers.Peer(id); peer != nil {
+		peer.Peer.Misbehaved(penalty, errResp(ErrSuspendedPeer, "%s", reason))
+	}
+	pm.removePeer(id)
+}
+
 func (pm *ProtocolManager) Start(maxPeers int) {
 	pm.maxPeers = maxPeers
 
-	// broadcast transactions
+	// broadcast and retrieve transactions
+	pm.txFetcher.Start()
 	pm.txCh = make(chan core.TxPreEvent, txChanSize)
 	pm.txSub = pm.txpool.SubscribeTxPreEvent(pm.txCh)
 	go pm.txBroadcastLoop()
@@ -205,6 +280,10 @@ func (pm *ProtocolManager) Start(maxPeers int) {
 		// broadcast votes
 		pm.voteSub = pm.eventMux.Subscribe(core.NewVoteEvent{})
 		go pm.voteBroadcastLoop()
+
+		// announce the local validator and its round state
+		go pm.announceLoop()
+		go pm.roundStateLoop()
 	}
 
 	// start sync handlers
@@ -217,6 +296,7 @@ func (pm *ProtocolManager) Stop() {
 
 	pm.txSub.Unsubscribe()         // quits txBroadcastLoop
 	pm.minedBlockSub.Unsubscribe() // quits blockBroadcastLoop
+	pm.txFetcher.Stop()
 
 	if pm.validator != nil {
 		pm.proposalSub.Unsubscribe() // quits proposalBroadcastLoop
@@ -258,6 +338,9 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	blockNumber, head, genesis := pm.blockchain.Status()
 	if err := p.Handshake(pm.networkID, blockNumber, head, genesis); err != nil {
 		p.Log().Debug("Kowala handshake failed", "err", err)
+		if penalty := misbehaviorPenalty(err); penalty > 0 {
+			p.Peer.Misbehaved(penalty, err)
+		}
 		return err
 	}
 	if rw, ok := p.rw.(*meteredMsgReadWriter); ok {
@@ -278,6 +361,9 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	// after this will be sent via broadcasts.
 	pm.syncTransactions(p)
 
+	// Propagate the known validator announcements, including our own
+	pm.syncAnnounces(p)
+
 	// @TODO (rgeraldes) - review
 
 	/*
@@ -305,6 +391,9 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	for {
 		if err := pm.handleMsg(p); err != nil {
 			p.Log().Debug("Kowala message handling failed", "err", err)
+			if penalty := misbehaviorPenalty(err); penalty > 0 {
+				p.Peer.Misbehaved(penalty, err)
+			}
 			return err
 		}
 	}
@@ -521,6 +610,60 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			log.Debug("Failed to deliver node state data", "err", err)
 		}
 
+	case msg.Code == GetAccountRangeMsg:
+		// Decode the account range query and serve it from the state tries
+		var query getAccountRangeData
+		if err := msg.Decode(&query); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if query.Bytes > softResponseLimit {
+			query.Bytes = softResponseLimit
+		}
+		response := new(accountRangeData)
+		if prover, err := state.NewRangeProver(query.Root, pm.chaindb); err == nil {
+			if hashes, accounts, proof, err := prover.AccountRange(query.Origin, query.Limit, query.Bytes); err == nil {
+				response.Hashes, response.Accounts, response.Proof = hashes, accounts, proof
+			}
+		}
+		return p.SendAccountRange(response)
+
+	case msg.Code == AccountRangeMsg:
+		// A range of accounts arrived to one of our previous requests
+		var data accountRangeData
+		if err := msg.Decode(&data); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if err := pm.downloader.DeliverAccountRange(p.id, data.Hashes, data.Accounts, data.Proof); err != nil {
+			log.Debug("Failed to deliver account range", "err", err)
+		}
+
+	case msg.Code == GetStorageRangeMsg:
+		// Decode the storage range query and serve it from the state tries
+		var query getStorageRangeData
+		if err := msg.Decode(&query); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if query.Bytes > softResponseLimit {
+			query.Bytes = softResponseLimit
+		}
+		response := new(storageRangeData)
+		if prover, err := state.NewRangeProver(query.Root, pm.chaindb); err == nil {
+			if hashes, slots, proof, err := prover.StorageRange(query.Account, query.Origin, query.Bytes); err == nil {
+				response.Hashes, response.Slots, response.Proof = hashes, slots, proof
+			}
+		}
+		return p.SendStorageRange(response)
+
+	case msg.Code == StorageRangeMsg:
+		// A range of storage slots arrived to one of our previous requests
+		var data storageRangeData
+		if err := msg.Decode(&data); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if err := pm.downloader.DeliverStorageRange(p.id, data.Hashes, data.Slots, data.Proof); err != nil {
+			log.Debug("Failed to deliver storage range", "err", err)
+		}
+
 	case msg.Code == GetReceiptsMsg:
 		// Decode the retrieval message
 		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
@@ -631,53 +774,176 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 			p.MarkTransaction(tx.Hash())
 		}
-		pm.txpool.AddRemotes(txs)
+		pm.txFetcher.Enqueue(p.id, txs)
 
-	case msg.Code == ProposalMsg:
-		if !pm.validator.Validating() {
+	case msg.Code == NewPooledTransactionHashesMsg:
+		// Transactions were announced, schedule the retrieval of the unknown ones
+		if atomic.LoadUint32(&pm.acceptTxs) == 0 {
 			break
 		}
+		var hashes []common.Hash
+		if err := msg.Decode(&hashes); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		for _, hash := range hashes {
+			p.MarkTransaction(hash)
+		}
+		pm.txFetcher.Notify(p.id, hashes, time.Now())
+
+	case msg.Code == GetPooledTransactionsMsg:
+		// Decode the retrieval message
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		if _, err := msgStream.List(); err != nil {
+			return err
+		}
+		// Gather transactions until the fetch or network limits is reached
+		var (
+			hash  common.Hash
+			bytes int
+			txs   types.Transactions
+		)
+		for bytes < softResponseLimit && len(txs) < maxPooledTxServe {
+			// Retrieve the hash of the next transaction
+			if err := msgStream.Decode(&hash); err == rlp.EOL {
+				break
+			} else if err != nil {
+				return errResp(ErrDecode, "msg %v: %v", msg, err)
+			}
+			// Retrieve the requested transaction, skipping it if no longer pooled
+			if tx := pm.txpool.Get(hash); tx != nil {
+				txs = append(txs, tx)
+				bytes += int(tx.Size())
+			}
+		}
+		return p.SendPooledTransactions(txs)
+
+	case msg.Code == PooledTransactionsMsg:
+		// A batch of transactions arrived to one of our previous requests
+		if atomic.LoadUint32(&pm.acceptTxs) == 0 {
+			break
+		}
+		var txs []*types.Transaction
+		if err := msg.Decode(&txs); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		for i, tx := range txs {
+			if tx == nil {
+				return errResp(ErrDecode, "transaction %d is nil", i)
+			}
+			p.MarkTransaction(tx.Hash())
+		}
+		pm.txFetcher.Enqueue(p.id, txs)
+
+	case msg.Code == ProposalMsg:
 		// Retrieve and decode the propagated proposal
 		var proposal types.Proposal
 		if err := msg.Decode(&proposal); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
-		if err := pm.validator.AddProposal(&proposal); err != nil {
-			// ignore
-			break
+		sender, err := types.ProposalSender(pm.signer, &proposal)
+		if err != nil {
+			return errResp(ErrInvalidSignature, "proposal: %v", err)
 		}
+		hash := proposal.Hash()
+		p.MarkProposal(hash)
 
-	case msg.Code == VoteMsg:
-		if !pm.validator.Validating() {
+		// Only the proposals of validators are processed and relayed
+		if !pm.isValidator(sender) {
+			p.Log().Trace("Discarded proposal of non-validator", "sender", sender)
 			break
 		}
+		// Process and relay every proposal only once
+		if !pm.gossip.markSeen(hash) {
+			break
+		}
+		if pm.validating() {
+			pm.validator.AddProposal(&proposal)
+		}
+		if pm.relayable(proposal.BlockNumber()) {
+			for _, peer := range relayTargets(pm.peers.PeersWithoutProposal(hash)) {
+				peer.SendNewProposal(&proposal)
+			}
+		}
+
+	case msg.Code == VoteMsg:
 		// Retrieve and decode the propagated vote
 		var vote types.Vote
 		if err := msg.Decode(&vote); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
-		if err := pm.validator.AddVote(&vote); err != nil {
-			// ignore
-			break
+		sender, err := types.VoteSender(pm.signer, &vote)
+		if err != nil {
+			return errResp(ErrInvalidSignature, "vote: %v", err)
 		}
-		p.MarkVote(vote.Hash())
+		hash := vote.Hash()
+		p.MarkVote(hash)
 
-	case msg.Code == BlockFragmentMsg:
-		if !pm.validator.Validating() {
+		// Only the votes of validator keys are processed and relayed
+		if !pm.isValidator(sender) {
+			p.Log().Trace("Discarded vote of non-validator", "sender", sender)
+			break
+		}
+		// Process and relay every vote only once
+		if !pm.gossip.markSeen(hash) {
 			break
 		}
+		if pm.validating() {
+			pm.validator.AddVote(&vote)
+		}
+		if pm.relayable(vote.BlockNumber()) {
+			for _, peer := range relayTargets(pm.peers.PeersWithoutVote(hash)) {
+				peer.SendVote(&vote)
+			}
+		}
 
+	case msg.Code == BlockFragmentMsg:
 		// Retrieve and decode the propagated block fragment
 		var request blockFragmentData
 		if err := msg.Decode(&request); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
-		if err := pm.validator.AddBlockFragment(request.BlockNumber, request.Round, request.Data); err != nil {
-			// ignore
+		if request.Data == nil {
+			return errResp(ErrDecode, "block fragment is nil")
+		}
+		hash := request.Data.Proof
+		p.MarkFragment(hash)
+
+		// Process and relay every fragment only once
+		if !pm.gossip.markSeen(hash) {
 			break
 		}
-		p.MarkFragment(request.Data.Proof)
-		pm.validator.AddBlockFragment(request.BlockNumber, request.Round, request.Data)
+		if pm.validating() {
+			pm.validator.AddBlockFragment(request.BlockNumber, request.Round, request.Data)
+		}
+		if pm.relayable(request.BlockNumber) {
+			for _, peer := range relayTargets(pm.peers.PeersWithoutFragment(hash)) {
+				peer.SendBlockFragment(request.BlockNumber, request.Round, request.Data)
+			}
+		}
+
+	case msg.Code == ElectionMsg:
+		// A validator announced its round state, send it the votes it misses
+		var state electionData
+		if err := msg.Decode(&state); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return pm.handleRoundState(p, &state)
+
+	case msg.Code == ProposalPOLMsg:
+		// A validator announced its proof of lock, send it the pre-votes it misses
+		var pol proposalPOLData
+		if err := msg.Decode(&pol); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return pm.handleProposalPOL(p, &pol)
+
+	case msg.Code == ValidatorAnnounceMsg:
+		// Validator announcements arrived, verify, record and relay them
+		var announces []*types.Announce
+		if err := msg.Decode(&announces); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return pm.handleAnnounces(p, announces)
 
 	default:
 		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
@@ -710,16 +976,25 @@ func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
 	}
 }
 
-// BroadcastTx will propagate a transaction to all peers which are not known to
-// already have the given transaction.
+// BroadcastTx will propagate a transaction to a subset of the peers which are
+// not known to already have the given transaction, and announce it to the rest.
+// Peers not supporting announcements always receive the full transaction.
 func (pm *ProtocolManager) BroadcastTx(hash common.Hash, tx *types.Transaction) {
-	// Broadcast transaction to a batch of peers not knowing about it
 	peers := pm.peers.PeersWithoutTx(hash)
-	//FIXME include this again: peers = peers[:int(math.Sqrt(float64(len(peers))))]
+
+	// Send the full transaction to a batch of peers, and only the hash to the others
+	var full, announced int
+	transfer := int(math.Sqrt(float64(len(peers))))
 	for _, peer := range peers {
-		peer.SendTransactions(types.Transactions{tx})
+		if full < transfer || peer.version < kusd4 {
+			peer.SendTransactions(types.Transactions{tx})
+			full++
+			continue
+		}
+		peer.SendPooledTransactionHashes([]common.Hash{hash})
+		announced++
 	}
-	log.Trace("Broadcast transaction", "hash", hash, "recipients", len(peers))
+	log.Trace("Broadcast transaction", "hash", hash, "recipients", full, "announced", announced)
 }
 
 // Mined broadcast loop
@@ -739,10 +1014,13 @@ func (pm *ProtocolManager) proposalBroadcastLoop() {
 	for obj := range pm.proposalSub.Chan() {
 		switch ev := obj.Data.(type) {
 		case core.NewProposalEvent:
-			for _, peer := range pm.peers.Peers() {
+			hash := ev.Proposal.Hash()
+			pm.gossip.markSeen(hash)
+			for _, peer := range pm.peers.PeersWithoutProposal(hash) {
 				peer.SendNewProposal(ev.Proposal)
 			}
 		case core.NewBlockFragmentEvent:
+			pm.gossip.markSeen(ev.Data.Proof)
 			for _, peer := range pm.peers.PeersWithoutFragment(ev.Data.Proof) {
 				peer.SendBlockFragment(ev.BlockNumber, ev.Round, ev.Data)
 			}
@@ -755,6 +1033,7 @@ func (pm *ProtocolManager) voteBroadcastLoop() {
 	for obj := range pm.voteSub.Chan() {
 		switch ev := obj.Data.(type) {
 		case core.NewVoteEvent:
+			pm.gossip.markSeen(ev.Vote.Hash())
 			peers := pm.peers.PeersWithoutVote(ev.Vote.Hash())
 			for _, peer := range peers {
 				peer.SendVote(ev.Vote)
@@ -1,6 +1,7 @@
 package kusd
 
 import (
+	"errors"
 	"math"
 	"math/big"
 	"math/rand"
@@ -8,16 +9,14 @@ import (
 	"time"
 
 	"github.com/kowala-tech/kUSD/common"
-	"github.com/kowala-tech/kUSD/consensus/tendermint"
 	"github.com/kowala-tech/kUSD/core"
 	"github.com/kowala-tech/kUSD/core/state"
 	"github.com/kowala-tech/kUSD/core/types"
-	"github.com/kowala-tech/kUSD/core/vm"
 	"github.com/kowala-tech/kUSD/crypto"
-	"github.com/kowala-tech/kUSD/event"
 	"github.com/kowala-tech/kUSD/kusd/downloader"
 	"github.com/kowala-tech/kUSD/kusddb"
 	"github.com/kowala-tech/kUSD/p2p"
+	"github.com/kowala-tech/kUSD/p2p/discover"
 	"github.com/kowala-tech/kUSD/params"
 )
 
@@ -31,8 +30,9 @@ func TestProtocolCompatibility(t *testing.T) {
 		mode       downloader.SyncMode
 		compatible bool
 	}{
-		{61, downloader.FullSync, true}, {62, downloader.FullSync, true}, {63, downloader.FullSync, true},
-		{61, downloader.FastSync, false}, {62, downloader.FastSync, false}, {63, downloader.FastSync, true},
+		{kusd1, downloader.FullSync, true}, {kusd2, downloader.FullSync, true}, {kusd3, downloader.FullSync, true}, {kusd4, downloader.FullSync, true},
+		{kusd1, downloader.FastSync, true}, {kusd2, downloader.FastSync, true}, {kusd3, downloader.FastSync, true}, {kusd4, downloader.FastSync, true},
+		{kusd1, downloader.SnapSync, true}, {kusd2, downloader.SnapSync, true}, {kusd3, downloader.SnapSync, true}, {kusd4, downloader.SnapSync, true},
 	}
 	// Make sure anything we screw up is restored
 	backup := ProtocolVersions
@@ -52,9 +52,30 @@ func TestProtocolCompatibility(t *testing.T) {
 	}
 }
 
+// Tests that peers of another network are disconnected without a penalty, while
+// invalid data counts against their reputation.
+func TestMisbehaviorPenalty(t *testing.T) {
+	tests := []struct {
+		err     error
+		penalty int
+	}{
+		{errResp(ErrGenesisBlockMismatch, "mismatch"), 0},
+		{errResp(ErrNetworkIdMismatch, "mismatch"), 0},
+		{errResp(ErrProtocolVersionMismatch, "mismatch"), 0},
+		{errResp(ErrDecode, "invalid"), p2p.PenaltyMajor},
+		{errResp(ErrSuspendedPeer, "invalid block"), p2p.PenaltyFatal},
+		{errors.New("disconnected"), 0},
+	}
+	for i, tt := range tests {
+		if penalty := misbehaviorPenalty(tt.err); penalty != tt.penalty {
+			t.Errorf("test %d: penalty mismatch: have %d, want %d", i, penalty, tt.penalty)
+		}
+	}
+}
+
 // Tests that block headers can be retrieved from a remote chain based on user queries.
-func TestGetBlockHeaders62(t *testing.T) { testGetBlockHeaders(t, 62) }
-func TestGetBlockHeaders63(t *testing.T) { testGetBlockHeaders(t, 63) }
+func TestGetBlockHeaders1(t *testing.T) { testGetBlockHeaders(t, kusd1) }
+func TestGetBlockHeaders2(t *testing.T) { testGetBlockHeaders(t, kusd2) }
 
 func testGetBlockHeaders(t *testing.T, protocol int) {
 	pm := newTestProtocolManagerMust(t, downloader.FullSync, downloader.MaxHashFetch+15, nil, nil)
@@ -193,8 +214,8 @@ func testGetBlockHeaders(t *testing.T, protocol int) {
 			headers = append(headers, pm.blockchain.GetBlockByHash(hash).Header())
 		}
 		// Send the hash request and verify the response
-		p2p.Send(peer.app, 0x03, tt.query)
-		if err := p2p.ExpectMsg(peer.app, 0x04, headers); err != nil {
+		p2p.Send(peer.app, GetBlockHeadersMsg, tt.query)
+		if err := p2p.ExpectMsg(peer.app, BlockHeadersMsg, headers); err != nil {
 			t.Errorf("test %d: headers mismatch: %v", i, err)
 		}
 		// If the test used number origins, repeat with hashes as the too
@@ -202,8 +223,8 @@ func testGetBlockHeaders(t *testing.T, protocol int) {
 			if origin := pm.blockchain.GetBlockByNumber(tt.query.Origin.Number); origin != nil {
 				tt.query.Origin.Hash, tt.query.Origin.Number = origin.Hash(), 0
 
-				p2p.Send(peer.app, 0x03, tt.query)
-				if err := p2p.ExpectMsg(peer.app, 0x04, headers); err != nil {
+				p2p.Send(peer.app, GetBlockHeadersMsg, tt.query)
+				if err := p2p.ExpectMsg(peer.app, BlockHeadersMsg, headers); err != nil {
 					t.Errorf("test %d: headers mismatch: %v", i, err)
 				}
 			}
@@ -212,8 +233,8 @@ func testGetBlockHeaders(t *testing.T, protocol int) {
 }
 
 // Tests that block contents can be retrieved from a remote chain based on their hashes.
-func TestGetBlockBodies62(t *testing.T) { testGetBlockBodies(t, 62) }
-func TestGetBlockBodies63(t *testing.T) { testGetBlockBodies(t, 63) }
+func TestGetBlockBodies1(t *testing.T) { testGetBlockBodies(t, kusd1) }
+func TestGetBlockBodies2(t *testing.T) { testGetBlockBodies(t, kusd2) }
 
 func testGetBlockBodies(t *testing.T, protocol int) {
 	pm := newTestProtocolManagerMust(t, downloader.FullSync, downloader.MaxBlockFetch+15, nil, nil)
@@ -262,7 +283,7 @@ func testGetBlockBodies(t *testing.T, protocol int) {
 					block := pm.blockchain.GetBlockByNumber(uint64(num))
 					hashes = append(hashes, block.Hash())
 					if len(bodies) < tt.expected {
-						bodies = append(bodies, &blockBody{Transactions: block.Transactions(), Uncles: block.Uncles()})
+						bodies = append(bodies, &blockBody{Transactions: block.Transactions(), Commit: block.LastCommit()})
 					}
 					break
 				}
@@ -272,19 +293,19 @@ func testGetBlockBodies(t *testing.T, protocol int) {
 			hashes = append(hashes, hash)
 			if tt.available[j] && len(bodies) < tt.expected {
 				block := pm.blockchain.GetBlockByHash(hash)
-				bodies = append(bodies, &blockBody{Transactions: block.Transactions(), Uncles: block.Uncles()})
+				bodies = append(bodies, &blockBody{Transactions: block.Transactions(), Commit: block.LastCommit()})
 			}
 		}
 		// Send the hash request and verify the response
-		p2p.Send(peer.app, 0x05, hashes)
-		if err := p2p.ExpectMsg(peer.app, 0x06, bodies); err != nil {
+		p2p.Send(peer.app, GetBlockBodiesMsg, hashes)
+		if err := p2p.ExpectMsg(peer.app, BlockBodiesMsg, bodies); err != nil {
 			t.Errorf("test %d: bodies mismatch: %v", i, err)
 		}
 	}
 }
 
 // Tests that the node state database can be retrieved based on hashes.
-func TestGetNodeData63(t *testing.T) { testGetNodeData(t, 63) }
+func TestGetNodeData1(t *testing.T) { testGetNodeData(t, kusd1) }
 
 func testGetNodeData(t *testing.T, protocol int) {
 	// Define three accounts to simulate transactions with
@@ -293,7 +314,7 @@ func testGetNodeData(t *testing.T, protocol int) {
 	acc1Addr := crypto.PubkeyToAddress(acc1Key.PublicKey)
 	acc2Addr := crypto.PubkeyToAddress(acc2Key.PublicKey)
 
-	signer := types.HomesteadSigner{}
+	signer := testSigner
 	// Create a chain generator with some simple transactions (blatantly stolen from @fjl/chain_markets_test)
 	generator := func(i int, block *core.BlockGen) {
 		switch i {
@@ -312,14 +333,6 @@ func testGetNodeData(t *testing.T, protocol int) {
 			// Block 3 is empty but was mined by account #2.
 			block.SetCoinbase(acc2Addr)
 			block.SetExtra([]byte("yeehaw"))
-		case 3:
-			// Block 4 includes blocks 2 and 3 as uncle headers (with modified extra data).
-			b2 := block.PrevBlock(1).Header()
-			b2.Extra = []byte("foo")
-			block.AddUncle(b2)
-			b3 := block.PrevBlock(2).Header()
-			b3.Extra = []byte("foo")
-			block.AddUncle(b3)
 		}
 	}
 	// Assemble the test environment
@@ -334,13 +347,13 @@ func testGetNodeData(t *testing.T, protocol int) {
 			hashes = append(hashes, common.BytesToHash(key))
 		}
 	}
-	p2p.Send(peer.app, 0x0d, hashes)
+	p2p.Send(peer.app, GetNodeDataMsg, hashes)
 	msg, err := peer.app.ReadMsg()
 	if err != nil {
 		t.Fatalf("failed to read node data response: %v", err)
 	}
-	if msg.Code != 0x0e {
-		t.Fatalf("response packet code mismatch: have %x, want %x", msg.Code, 0x0c)
+	if msg.Code != NodeDataMsg {
+		t.Fatalf("response packet code mismatch: have %x, want %x", msg.Code, NodeDataMsg)
 	}
 	var data [][]byte
 	if err := msg.Decode(&data); err != nil {
@@ -376,7 +389,7 @@ func testGetNodeData(t *testing.T, protocol int) {
 }
 
 // Tests that the transaction receipts can be retrieved based on hashes.
-func TestGetReceipt63(t *testing.T) { testGetReceipt(t, 63) }
+func TestGetReceipt1(t *testing.T) { testGetReceipt(t, kusd1) }
 
 func testGetReceipt(t *testing.T, protocol int) {
 	// Define three accounts to simulate transactions with
@@ -385,7 +398,7 @@ func testGetReceipt(t *testing.T, protocol int) {
 	acc1Addr := crypto.PubkeyToAddress(acc1Key.PublicKey)
 	acc2Addr := crypto.PubkeyToAddress(acc2Key.PublicKey)
 
-	signer := types.HomesteadSigner{}
+	signer := testSigner
 	// Create a chain generator with some simple transactions (blatantly stolen from @fjl/chain_markets_test)
 	generator := func(i int, block *core.BlockGen) {
 		switch i {
@@ -404,14 +417,6 @@ func testGetReceipt(t *testing.T, protocol int) {
 			// Block 3 is empty but was mined by account #2.
 			block.SetCoinbase(acc2Addr)
 			block.SetExtra([]byte("yeehaw"))
-		case 3:
-			// Block 4 includes blocks 2 and 3 as uncle headers (with modified extra data).
-			b2 := block.PrevBlock(1).Header()
-			b2.Extra = []byte("foo")
-			block.AddUncle(b2)
-			b3 := block.PrevBlock(2).Header()
-			b3.Extra = []byte("foo")
-			block.AddUncle(b3)
 		}
 	}
 	// Assemble the test environment
@@ -428,81 +433,75 @@ func testGetReceipt(t *testing.T, protocol int) {
 		receipts = append(receipts, core.GetBlockReceipts(pm.chaindb, block.Hash(), block.NumberU64()))
 	}
 	// Send the hash request and verify the response
-	p2p.Send(peer.app, 0x0f, hashes)
-	if err := p2p.ExpectMsg(peer.app, 0x10, receipts); err != nil {
+	p2p.Send(peer.app, GetReceiptsMsg, hashes)
+	if err := p2p.ExpectMsg(peer.app, ReceiptsMsg, receipts); err != nil {
 		t.Errorf("receipts mismatch: %v", err)
 	}
 }
 
-// Tests that post eth protocol handshake, DAO fork-enabled clients also execute
-// a DAO "challenge" verifying each others' DAO fork headers to ensure they're on
-// compatible chains.
-func TestDAOChallengeNoVsNo(t *testing.T)       { testDAOChallenge(t, false, false, false) }
-func TestDAOChallengeNoVsPro(t *testing.T)      { testDAOChallenge(t, false, true, false) }
-func TestDAOChallengeProVsNo(t *testing.T)      { testDAOChallenge(t, true, false, false) }
-func TestDAOChallengeProVsPro(t *testing.T)     { testDAOChallenge(t, true, true, false) }
-func TestDAOChallengeNoVsTimeout(t *testing.T)  { testDAOChallenge(t, false, false, true) }
-func TestDAOChallengeProVsTimeout(t *testing.T) { testDAOChallenge(t, true, true, true) }
-
-func testDAOChallenge(t *testing.T, localForked, remoteForked bool, timeout bool) {
-	// Reduce the DAO handshake challenge timeout
-	if timeout {
-		defer func(old time.Duration) { daoChallengeTimeout = old }(daoChallengeTimeout)
-		daoChallengeTimeout = 500 * time.Millisecond
-	}
-	// Create a DAO aware protocol manager
-	var (
-		evmux         = new(event.TypeMux)
-		pow           = tendermint.NewFaker()
-		db, _         = kusddb.NewMemDatabase()
-		config        = &params.ChainConfig{DAOForkBlock: big.NewInt(1), DAOForkSupport: localForked}
-		gspec         = &core.Genesis{Config: config}
-		genesis       = gspec.MustCommit(db)
-		blockchain, _ = core.NewBlockChain(db, config, pow, vm.Config{})
-	)
-	pm, err := NewProtocolManager(config, downloader.FullSync, DefaultConfig.NetworkId, evmux, new(testTxPool), pow, blockchain, db)
-	if err != nil {
-		t.Fatalf("failed to start test protocol manager: %v", err)
-	}
-	pm.Start(1000)
-	defer pm.Stop()
+// Tests that transactions are sent in full to a square root subset of the peers
+// and to all peers not supporting announcements, while announced to the others.
+func TestBroadcastTxAnnounce(t *testing.T) {
+	pm := &ProtocolManager{peers: newPeerSet()}
 
-	// Connect a new peer and check that we receive the DAO challenge
-	peer, _ := newTestPeer("peer", eth63, pm, true)
-	defer peer.close()
+	versions := []int{kusd1, kusd2, kusd3, kusd4, kusd4, kusd4, kusd4, kusd4, kusd4, kusd4, kusd4}
+	pipes := make([]*p2p.MsgPipeRW, len(versions))
+	for i, version := range versions {
+		app, net := p2p.MsgPipe()
+		defer app.Close()
 
-	challenge := &getBlockHeadersData{
-		Origin:  hashOrNumber{Number: config.DAOForkBlock.Uint64()},
-		Amount:  1,
-		Skip:    0,
-		Reverse: false,
+		var id discover.NodeID
+		id[0] = byte(i)
+		if err := pm.peers.Register(newPeer(version, p2p.NewPeer(id, "", nil), net)); err != nil {
+			t.Fatalf("failed to register peer %d: %v", i, err)
+		}
+		pipes[i] = app
 	}
-	if err := p2p.ExpectMsg(peer.app, GetBlockHeadersMsg, challenge); err != nil {
-		t.Fatalf("challenge mismatch: %v", err)
+	tx := newTestTransaction(testBankKey, 0, 0)
+	go pm.BroadcastTx(tx.Hash(), tx)
+
+	// Peers are sent to one by one, so read from all of them concurrently
+	codes := make([]chan uint64, len(pipes))
+	for i, pipe := range pipes {
+		codes[i] = make(chan uint64, 1)
+		go func(pipe *p2p.MsgPipeRW, codes chan uint64) {
+			msg, err := pipe.ReadMsg()
+			if err != nil {
+				close(codes)
+				return
+			}
+			if msg.Code == NewPooledTransactionHashesMsg {
+				var hashes []common.Hash
+				if err := msg.Decode(&hashes); err != nil || len(hashes) != 1 || hashes[0] != tx.Hash() {
+					close(codes)
+					return
+				}
+			}
+			msg.Discard()
+			codes <- msg.Code
+		}(pipe, codes[i])
 	}
-	// Create a block to reply to the challenge if no timeout is simulated
-	if !timeout {
-		blocks, _ := core.GenerateChain(&params.ChainConfig{}, genesis, db, 1, func(i int, block *core.BlockGen) {
-			if remoteForked {
-				block.SetExtra(params.DAOForkBlockExtra)
+	var full, announced int
+	for i := range pipes {
+		select {
+		case code, ok := <-codes[i]:
+			switch {
+			case !ok:
+				t.Fatalf("peer %d: invalid broadcast", i)
+			case code == TxMsg:
+				full++
+			case code == NewPooledTransactionHashesMsg && versions[i] >= kusd4:
+				announced++
+			default:
+				t.Fatalf("peer %d: unexpected message %d for kusd%d", i, code, versions[i])
 			}
-		})
-		if err := p2p.Send(peer.app, BlockHeadersMsg, []*types.Header{blocks[0].Header()}); err != nil {
-			t.Fatalf("failed to answer challenge: %v", err)
+		case <-time.After(time.Second):
+			t.Fatalf("peer %d: broadcast timeout", i)
 		}
-		time.Sleep(100 * time.Millisecond) // Sleep to avoid the verification racing with the drops
-	} else {
-		// Otherwise wait until the test timeout passes
-		time.Sleep(daoChallengeTimeout + 500*time.Millisecond)
 	}
-	// Verify that depending on fork side, the remote peer is maintained or dropped
-	if localForked == remoteForked && !timeout {
-		if peers := pm.peers.Len(); peers != 1 {
-			t.Fatalf("peer count mismatch: have %d, want %d", peers, 1)
-		}
-	} else {
-		if peers := pm.peers.Len(); peers != 0 {
-			t.Fatalf("peer count mismatch: have %d, want %d", peers, 0)
-		}
+	// The first sqrt(11) = 3 peers in iteration order get the full transaction,
+	// any peer below kusd4 beyond them too
+	if full < 3 || full > 6 || full+announced != len(versions) {
+		t.Errorf("broadcast mismatch: %d full, %d announced", full, announced)
 	}
 }
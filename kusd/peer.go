@@ -26,15 +26,19 @@ const (
 	// @TODO (rgeraldes) - fine tune values?
 	maxKnownVotes     = 1024 // Maximum vote hashes to keep in the known list (prevent DOS)
 	maxKnownFragments = 1024 // Maximum vote hashes to keep in the known list (prevent DOS)
+	maxKnownProposals = 1024 // Maximum proposal hashes to keep in the known list (prevent DOS)
+	maxKnownAnnounces = 1024 // Maximum validator announcement hashes to keep in the known list (prevent DOS)
+	maxRoutes         = 1024 // Maximum validators to keep in the route list (prevent DOS)
 	handshakeTimeout  = 5 * time.Second
 )
 
 // PeerInfo represents a short summary of the Kowala sub-protocol metadata known
 // about a connected peer.
 type PeerInfo struct {
-	Version     int      `json:"version"` // Ethereum protocol version negotiated
-	BlockNumber *big.Int `json:"number"`  // Block number of the peer's blockchain
-	Head        string   `json:"head"`    // SHA3 hash of the peer's best owned block
+	Version     int      `json:"version"`             // Ethereum protocol version negotiated
+	BlockNumber *big.Int `json:"number"`              // Block number of the peer's blockchain
+	Head        string   `json:"head"`                // SHA3 hash of the peer's best owned block
+	Validator   string   `json:"validator,omitempty"` // Address of the validator the peer runs, if any
 }
 
 type peer struct {
@@ -53,6 +57,11 @@ type peer struct {
 	knownBlocks    *set.Set // Set of block hashes known to be known by this peer
 	knownVotes     *set.Set // set of vote hashes known to be known by this peer
 	knownFragments *set.Set // set of fragment hashes known to be known by this peer
+	knownProposals *set.Set // set of proposal hashes known to be known by this peer
+	knownAnnounces *set.Set // set of validator announcement hashes known to be known by this peer
+
+	validator common.Address // Address of the validator run by the peer, zero if none
+	routes    *set.Set       // Set of validator addresses reachable through this peer
 }
 
 func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
@@ -67,6 +76,9 @@ func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
 		knownBlocks:    set.New(),
 		knownVotes:     set.New(),
 		knownFragments: set.New(),
+		knownProposals: set.New(),
+		knownAnnounces: set.New(),
+		routes:         set.New(),
 	}
 }
 
@@ -74,11 +86,15 @@ func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
 func (p *peer) Info() *PeerInfo {
 	hash, blockNumber := p.Head()
 
-	return &PeerInfo{
+	info := &PeerInfo{
 		Version:     p.version,
 		BlockNumber: blockNumber,
 		Head:        hash.Hex(),
 	}
+	if validator := p.Validator(); validator != (common.Address{}) {
+		info.Validator = validator.Hex()
+	}
+	return info
 }
 
 // Head retrieves a copy of the current head hash and total difficulty of the
@@ -130,6 +146,56 @@ func (p *peer) MarkFragment(hash common.Hash) {
 	p.knownFragments.Add(hash)
 }
 
+// MarkProposal marks a proposal as known for the peer, ensuring that it will
+// never be propagated to this particular peer.
+func (p *peer) MarkProposal(hash common.Hash) {
+	// If we reached the memory allowance, drop a previously known proposal hash
+	for p.knownProposals.Size() >= maxKnownProposals {
+		p.knownProposals.Pop()
+	}
+	p.knownProposals.Add(hash)
+}
+
+// MarkAnnounce marks a validator announcement as known for the peer, ensuring
+// that it will never be propagated to this particular peer.
+func (p *peer) MarkAnnounce(hash common.Hash) {
+	// If we reached the memory allowance, drop a previously known announcement hash
+	for p.knownAnnounces.Size() >= maxKnownAnnounces {
+		p.knownAnnounces.Pop()
+	}
+	p.knownAnnounces.Add(hash)
+}
+
+// AddRoute marks a validator as reachable through the peer. If the peer runs the
+// validator itself, the peer is marked as a validator too.
+func (p *peer) AddRoute(validator common.Address, direct bool) {
+	// If we reached the memory allowance, drop a previously known route
+	for p.routes.Size() >= maxRoutes {
+		p.routes.Pop()
+	}
+	p.routes.Add(validator)
+
+	if direct {
+		p.lock.Lock()
+		p.validator = validator
+		p.lock.Unlock()
+	}
+}
+
+// Validator returns the address of the validator run by the peer, or the zero
+// address if the peer did not announce itself as a validator.
+func (p *peer) Validator() common.Address {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.validator
+}
+
+// IsRoute returns whether any validator is reachable through the peer.
+func (p *peer) IsRoute() bool {
+	return p.routes.Size() > 0
+}
+
 // MarkTransaction marks a transaction as known for the peer, ensuring that it
 // will never be propagated to this particular peer.
 func (p *peer) MarkTransaction(hash common.Hash) {
@@ -149,6 +215,25 @@ func (p *peer) SendTransactions(txs types.Transactions) error {
 	return p2p.Send(p.rw, TxMsg, txs)
 }
 
+// SendPooledTransactionHashes announces the availability of a number of
+// transactions through a hash notification, so that the peer can retrieve the
+// ones it doesn't know yet.
+func (p *peer) SendPooledTransactionHashes(hashes []common.Hash) error {
+	for _, hash := range hashes {
+		p.knownTxs.Add(hash)
+	}
+	return p2p.Send(p.rw, NewPooledTransactionHashesMsg, hashes)
+}
+
+// SendPooledTransactions sends a batch of pooled transactions, corresponding to
+// the hashes requested.
+func (p *peer) SendPooledTransactions(txs types.Transactions) error {
+	for _, tx := range txs {
+		p.knownTxs.Add(tx.Hash())
+	}
+	return p2p.Send(p.rw, PooledTransactionsMsg, txs)
+}
+
 // SendNewBlockHashes announces the availability of a number of blocks through
 // a hash notification.
 func (p *peer) SendNewBlockHashes(hashes []common.Hash, numbers []uint64) error {
@@ -172,19 +257,43 @@ func (p *peer) SendNewBlock(block *types.Block) error {
 
 // SendNewBlock propagates a proposal to a remote peer.
 func (p *peer) SendNewProposal(proposal *types.Proposal) error {
+	p.knownProposals.Add(proposal.Hash())
 	return p2p.Send(p.rw, ProposalMsg, proposal)
 }
 
 // SendNewBlock propagates a vote to a remote peer.
 func (p *peer) SendVote(vote *types.Vote) error {
+	p.knownVotes.Add(vote.Hash())
 	return p2p.Send(p.rw, VoteMsg, vote)
 }
 
 // SendBlockFragment propagates a block fragment to a remote peer.
 func (p *peer) SendBlockFragment(blockNumber *big.Int, round uint64, data *types.BlockFragment) error {
+	p.knownFragments.Add(data.Proof)
 	return p2p.Send(p.rw, BlockFragmentMsg, blockFragmentData{blockNumber, round, data})
 }
 
+// SendRoundState announces the round state of the local validator to a remote
+// peer, so that it can send the votes and block fragments missing.
+func (p *peer) SendRoundState(state *electionData) error {
+	return p2p.Send(p.rw, ElectionMsg, state)
+}
+
+// SendProposalPOL announces the pre-votes received by the local validator for
+// the locked round of the current proposal to a remote peer.
+func (p *peer) SendProposalPOL(pol *proposalPOLData) error {
+	return p2p.Send(p.rw, ProposalPOLMsg, pol)
+}
+
+// SendValidatorAnnounces propagates a batch of validator announcements to a
+// remote peer.
+func (p *peer) SendValidatorAnnounces(announces []*types.Announce) error {
+	for _, announce := range announces {
+		p.knownAnnounces.Add(announce.Hash())
+	}
+	return p2p.Send(p.rw, ValidatorAnnounceMsg, announces)
+}
+
 // SendBlockHeaders sends a batch of block headers to the remote peer.
 func (p *peer) SendBlockHeaders(headers []*types.Header) error {
 	return p2p.Send(p.rw, BlockHeadersMsg, headers)
@@ -207,6 +316,18 @@ func (p *peer) SendNodeData(data [][]byte) error {
 	return p2p.Send(p.rw, NodeDataMsg, data)
 }
 
+// SendAccountRange sends a range of accounts, corresponding to the ones
+// requested.
+func (p *peer) SendAccountRange(data *accountRangeData) error {
+	return p2p.Send(p.rw, AccountRangeMsg, data)
+}
+
+// SendStorageRange sends a range of storage slots, corresponding to the ones
+// requested.
+func (p *peer) SendStorageRange(data *storageRangeData) error {
+	return p2p.Send(p.rw, StorageRangeMsg, data)
+}
+
 // SendReceiptsRLP sends a batch of transaction receipts, corresponding to the
 // ones requested from an already RLP encoded format.
 func (p *peer) SendReceiptsRLP(receipts []rlp.RawValue) error {
@@ -248,6 +369,27 @@ func (p *peer) RequestNodeData(hashes []common.Hash) error {
 	return p2p.Send(p.rw, GetNodeDataMsg, hashes)
 }
 
+// RequestPooledTransactions fetches a batch of announced transactions from a
+// remote node's transaction pool.
+func (p *peer) RequestPooledTransactions(hashes []common.Hash) error {
+	p.Log().Debug("Fetching batch of pooled transactions", "count", len(hashes))
+	return p2p.Send(p.rw, GetPooledTransactionsMsg, hashes)
+}
+
+// RequestAccountRange fetches a range of the accounts of a state, starting at
+// the given account hash and ending at the first one past limit.
+func (p *peer) RequestAccountRange(root common.Hash, origin common.Hash, limit common.Hash, bytes uint64) error {
+	p.Log().Debug("Fetching range of accounts", "root", root, "origin", origin, "limit", limit, "bytes", bytes)
+	return p2p.Send(p.rw, GetAccountRangeMsg, &getAccountRangeData{Root: root, Origin: origin, Limit: limit, Bytes: bytes})
+}
+
+// RequestStorageRange fetches a range of the storage slots of an account,
+// starting at the given slot hash.
+func (p *peer) RequestStorageRange(root common.Hash, account common.Hash, origin common.Hash, bytes uint64) error {
+	p.Log().Debug("Fetching range of storage slots", "root", root, "account", account, "origin", origin, "bytes", bytes)
+	return p2p.Send(p.rw, GetStorageRangeMsg, &getStorageRangeData{Root: root, Account: account, Origin: origin, Bytes: bytes})
+}
+
 // RequestReceipts fetches a batch of transaction receipts from a remote node.
 func (p *peer) RequestReceipts(hashes []common.Hash) error {
 	p.Log().Debug("Fetching batch of receipts", "count", len(hashes))
@@ -443,6 +585,50 @@ func (ps *peerSet) PeersWithoutFragment(hash common.Hash) []*peer {
 	return list
 }
 
+// PeersWithoutProposal retrieves a list of peers that do not have a given
+// proposal in their set of known hashes.
+func (ps *peerSet) PeersWithoutProposal(hash common.Hash) []*peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		if !p.knownProposals.Has(hash) {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// PeersWithoutAnnounce retrieves a list of peers supporting validator
+// announcements that do not have a given one in their set of known hashes.
+func (ps *peerSet) PeersWithoutAnnounce(hash common.Hash) []*peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		if p.version >= kusd2 && !p.knownAnnounces.Has(hash) {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// PeersWithValidator retrieves a list of peers directly running a validator.
+func (ps *peerSet) PeersWithValidator() []*peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		if p.Validator() != (common.Address{}) {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
 func (ps *peerSet) Peers() []*peer {
 	ps.lock.RLock()
 	defer ps.lock.RUnlock()
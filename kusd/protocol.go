@@ -15,16 +15,19 @@ import (
 // Constants to match up protocol versions and messages
 const (
 	kusd1 = 1
+	kusd2 = 2 // Validator announcements
+	kusd3 = 3 // State ranges
+	kusd4 = 4 // Transaction announcements
 )
 
 // Official short name of the protocol used during capability negotiation.
 var ProtocolName = "kusd"
 
 // Supported versions of the kusd protocol (first is primary).
-var ProtocolVersions = []uint{kusd1}
+var ProtocolVersions = []uint{kusd4, kusd3, kusd2, kusd1}
 
 // Number of implemented message corresponding to different protocol versions.
-var ProtocolLengths = []uint64{21}
+var ProtocolLengths = []uint64{29, 26, 22, 21}
 
 const ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
 
@@ -49,6 +52,20 @@ const (
 	VoteMsg          = 0x12
 	ElectionMsg      = 0x13
 	BlockFragmentMsg = 0x14
+
+	// gossip (kusd2)
+	ValidatorAnnounceMsg = 0x15
+
+	// state ranges (kusd3)
+	GetAccountRangeMsg = 0x16
+	AccountRangeMsg    = 0x17
+	GetStorageRangeMsg = 0x18
+	StorageRangeMsg    = 0x19
+
+	// transaction announcements (kusd4)
+	NewPooledTransactionHashesMsg = 0x1a
+	GetPooledTransactionsMsg      = 0x1b
+	PooledTransactionsMsg         = 0x1c
 )
 
 type errCode int
@@ -63,6 +80,8 @@ const (
 	ErrNoStatusMsg
 	ErrExtraStatusMsg
 	ErrSuspendedPeer
+	ErrInvalidAnnouncement
+	ErrInvalidSignature
 )
 
 func (e errCode) String() string {
@@ -80,12 +99,17 @@ var errorToString = map[int]string{
 	ErrNoStatusMsg:             "No status message",
 	ErrExtraStatusMsg:          "Extra status message",
 	ErrSuspendedPeer:           "Suspended peer",
+	ErrInvalidAnnouncement:     "Invalid validator announcement",
+	ErrInvalidSignature:        "Invalid consensus message signature",
 }
 
 type txPool interface {
 	// AddRemotes should add the given transactions to the pool.
 	AddRemotes([]*types.Transaction) []error
 
+	// Get should return a transaction of the pool, or nil if unknown.
+	Get(hash common.Hash) *types.Transaction
+
 	// Pending should return pending transactions.
 	// The slice should be modifiable by the caller.
 	Pending() (map[common.Address]types.Transactions, error)
@@ -161,7 +185,7 @@ type newBlockData struct {
 
 // blockBody represents the data content of a single block.
 type blockBody struct {
-	Commit       *types.Commit
+	Commit       *types.Commit        `rlp:"nil"` // Commit of the parent block, nil for the first block
 	Transactions []*types.Transaction // Transactions contained within a block
 }
 
@@ -169,19 +193,25 @@ type blockBody struct {
 type blockBodiesData []*blockBody
 
 // @TODO (rgeraldes) - modify name from POL to Locked
-// proposalPOLData is the network packet for the re-proposed proposal message
+// proposalPOLData is the network packet announcing the pre-votes a validator
+// received for the locked round of the current proposal (proof of lock), so
+// that its peers can send the ones it is missing.
 type proposalPOLData struct {
 	BlockNumber *big.Int
-	POLRound    int
+	POLRound    uint64
 	POL         *common.BitArray
 }
 
-// electionData is the network packet that is sent to indicate that a given candidate (block) has seen +2/3 votes
+// electionData is the network packet announcing the round state of a validator:
+// the step of the election round it is in, along with the votes and block
+// fragments it received, so that its peers can send the ones it is missing.
 type electionData struct {
-	Type        types.VoteType
 	BlockNumber *big.Int
-	BlockHash   common.Hash
 	Round       uint64
+	Step        uint8
+	PreVotes    *common.BitArray // Validators whose pre-vote was received
+	PreCommits  *common.BitArray // Validators whose pre-commit was received
+	Fragments   *common.BitArray // Block fragments received, zero sized if the proposal is unknown
 }
 
 // blockFragmentData is the network packet that is sent to let the other validators have a part of the proposed block
@@ -190,3 +220,36 @@ type blockFragmentData struct {
 	Round       uint64
 	Data        *types.BlockFragment
 }
+
+// getAccountRangeData represents a query for a range of the accounts of a state.
+type getAccountRangeData struct {
+	Root   common.Hash // Root of the state to retrieve the accounts of
+	Origin common.Hash // Hash of the first account to retrieve
+	Limit  common.Hash // Hash of the last account to retrieve, the next one proving the range end
+	Bytes  uint64      // Soft limit on the size of the response
+}
+
+// accountRangeData is the network packet for a range of accounts, along with
+// the merkle proofs of its edges. It is empty if the state is unknown.
+type accountRangeData struct {
+	Hashes   []common.Hash // Hashes of the accounts, in ascending order
+	Accounts [][]byte      // RLP encoded accounts
+	Proof    [][]byte      // Trie nodes proving the origin and the last account
+}
+
+// getStorageRangeData represents a query for a range of the storage slots of
+// an account.
+type getStorageRangeData struct {
+	Root    common.Hash // Root of the state the account belongs to
+	Account common.Hash // Hash of the account to retrieve the storage of
+	Origin  common.Hash // Hash of the first slot to retrieve
+	Bytes   uint64      // Soft limit on the size of the response
+}
+
+// storageRangeData is the network packet for a range of storage slots, along
+// with the merkle proofs of its edges. It is empty if the account is unknown.
+type storageRangeData struct {
+	Hashes []common.Hash // Hashes of the slots, in ascending order
+	Slots  [][]byte      // RLP encoded slot values
+	Proof  [][]byte      // Trie nodes proving the origin and the last slot
+}
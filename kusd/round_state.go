@@ -0,0 +1,133 @@
+package kusd
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/kusd/validator"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/rlp"
+)
+
+const (
+	roundStateCheck   = 100 * time.Millisecond // Interval between checks whether the local round state changed
+	roundStateRefresh = time.Second            // Interval after which an unchanged round state is announced again
+)
+
+// newElectionData converts the round state of a validator into its network
+// packet.
+func newElectionData(state *validator.RoundState) *electionData {
+	return &electionData{
+		BlockNumber: state.BlockNumber,
+		Round:       state.Round,
+		Step:        uint8(state.Step),
+		PreVotes:    state.PreVotes,
+		PreCommits:  state.PreCommits,
+		Fragments:   state.Fragments,
+	}
+}
+
+// knownBitArray returns the bit array announced by a remote peer, or nil if the
+// peer announced a zero sized one, meaning that it knows nothing yet.
+func knownBitArray(array *common.BitArray) *common.BitArray {
+	if array.Size() == 0 {
+		return nil
+	}
+	return array
+}
+
+// roundStateLoop announces the round state of the local validator to the peers
+// running validators whenever it changes, so that they can send the consensus
+// messages the local validator is missing.
+func (pm *ProtocolManager) roundStateLoop() {
+	ticker := time.NewTicker(roundStateCheck)
+	defer ticker.Stop()
+
+	var (
+		last     []byte    // Encoding of the last round state announced
+		lastSent time.Time // Time of the last announcement
+	)
+	for {
+		select {
+		case <-ticker.C:
+			state := pm.validator.RoundState()
+			if state == nil {
+				last = nil
+				continue
+			}
+			data := newElectionData(state)
+			enc, err := rlp.EncodeToBytes(data)
+			if err != nil {
+				log.Error("Failed to encode round state", "err", err)
+				continue
+			}
+			if bytes.Equal(enc, last) && time.Since(lastSent) < roundStateRefresh {
+				continue
+			}
+			last, lastSent = enc, time.Now()
+
+			var pol *proposalPOLData
+			if state.POL != nil {
+				pol = &proposalPOLData{BlockNumber: state.BlockNumber, POLRound: state.POLRound, POL: state.POL}
+			}
+			for _, peer := range pm.peers.PeersWithValidator() {
+				peer.SendRoundState(data)
+				if pol != nil {
+					peer.SendProposalPOL(pol)
+				}
+			}
+
+		case <-pm.quitSync:
+			return
+		}
+	}
+}
+
+// handleRoundState processes the round state announced by a remote validator,
+// sending it the votes and block fragments of the round known locally that it
+// is missing.
+func (pm *ProtocolManager) handleRoundState(p *peer, state *electionData) error {
+	if state.BlockNumber == nil || state.PreVotes == nil || state.PreCommits == nil || state.Fragments == nil {
+		return errResp(ErrDecode, "incomplete round state")
+	}
+	if !pm.validating() {
+		return nil
+	}
+	proposal, fragments := pm.validator.MissingFragments(state.BlockNumber, state.Round, knownBitArray(state.Fragments))
+	if proposal != nil && !p.knownProposals.Has(proposal.Hash()) {
+		p.SendNewProposal(proposal)
+	}
+	for _, fragment := range fragments {
+		if !p.knownFragments.Has(fragment.Proof) {
+			p.SendBlockFragment(state.BlockNumber, state.Round, fragment)
+		}
+	}
+	pm.sendMissingVotes(p, pm.validator.MissingVotes(state.BlockNumber, state.Round, types.PreVote, knownBitArray(state.PreVotes)))
+	pm.sendMissingVotes(p, pm.validator.MissingVotes(state.BlockNumber, state.Round, types.PreCommit, knownBitArray(state.PreCommits)))
+	return nil
+}
+
+// handleProposalPOL processes the proof of lock announced by a remote validator,
+// sending it the pre-votes of the locked round known locally that it is missing.
+func (pm *ProtocolManager) handleProposalPOL(p *peer, pol *proposalPOLData) error {
+	if pol.BlockNumber == nil || pol.POL == nil {
+		return errResp(ErrDecode, "incomplete proof of lock")
+	}
+	if !pm.validating() {
+		return nil
+	}
+	pm.sendMissingVotes(p, pm.validator.MissingVotes(pol.BlockNumber, pol.POLRound, types.PreVote, knownBitArray(pol.POL)))
+	return nil
+}
+
+// sendMissingVotes sends a remote peer the votes it is missing and doesn't
+// already know about.
+func (pm *ProtocolManager) sendMissingVotes(p *peer, votes types.Votes) {
+	for _, vote := range votes {
+		if !p.knownVotes.Has(vote.Hash()) {
+			p.SendVote(vote)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package kusd
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/kusd/validator"
+	"github.com/kowala-tech/kUSD/p2p"
+	"github.com/kowala-tech/kUSD/p2p/discover"
+)
+
+// roundStateValidator is a validator mock holding a single pre-vote of the
+// validator at index 0 and a proposal made of a single block fragment.
+type roundStateValidator struct {
+	validator.Validator
+
+	vote     *types.Vote
+	proposal *types.Proposal
+	fragment *types.BlockFragment
+}
+
+func (v *roundStateValidator) Validating() bool { return true }
+
+func (v *roundStateValidator) MissingVotes(blockNumber *big.Int, round uint64, voteType types.VoteType, received *common.BitArray) types.Votes {
+	if voteType != types.PreVote || received.Get(0) {
+		return nil
+	}
+	return types.Votes{v.vote}
+}
+
+func (v *roundStateValidator) MissingFragments(blockNumber *big.Int, round uint64, received *common.BitArray) (*types.Proposal, []*types.BlockFragment) {
+	if received == nil {
+		return v.proposal, []*types.BlockFragment{v.fragment}
+	}
+	if received.Get(0) {
+		return nil, nil
+	}
+	return nil, []*types.BlockFragment{v.fragment}
+}
+
+// Tests that a validator announcing its round state is sent exactly the
+// consensus messages it is missing, and only once.
+func TestRoundStateExchange(t *testing.T) {
+	number := big.NewInt(1)
+	val := &roundStateValidator{
+		vote:     types.NewVote(number, common.Hash{1}, 0, types.PreVote),
+		proposal: types.NewProposal(number, 0, &types.Metadata{NChunks: 1}, 0, common.Hash{}),
+		fragment: &types.BlockFragment{Index: 0, Data: []byte{1}, Proof: common.Hash{2}},
+	}
+	pm := &ProtocolManager{validator: val}
+
+	app, net := p2p.MsgPipe()
+	defer app.Close()
+	p := newPeer(kusd1, p2p.NewPeer(discover.NodeID{1}, "", nil), net)
+
+	received := common.NewBitArray(4)
+	received.Set(0)
+	handled := make(chan error, 1)
+
+	// A validator knowing the pre-vote but not the proposal gets the proposal and its fragments
+	go func() {
+		handled <- pm.handleRoundState(p, &electionData{
+			BlockNumber: number,
+			PreVotes:    received,
+			PreCommits:  new(common.BitArray),
+			Fragments:   new(common.BitArray),
+		})
+	}()
+	for _, code := range []uint64{ProposalMsg, BlockFragmentMsg} {
+		msg, err := app.ReadMsg()
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		if msg.Code != code {
+			t.Fatalf("message code mismatch: have %d, want %d", msg.Code, code)
+		}
+		msg.Discard()
+	}
+	if err := <-handled; err != nil {
+		t.Fatalf("failed to handle round state: %v", err)
+	}
+	// A validator knowing nothing only gets the messages not sent already
+	go func() {
+		handled <- pm.handleRoundState(p, &electionData{
+			BlockNumber: number,
+			PreVotes:    new(common.BitArray),
+			PreCommits:  new(common.BitArray),
+			Fragments:   new(common.BitArray),
+		})
+	}()
+	if err := p2p.ExpectMsg(app, VoteMsg, val.vote); err != nil {
+		t.Fatalf("missing pre-vote not sent: %v", err)
+	}
+	select {
+	case err := <-handled:
+		if err != nil {
+			t.Fatalf("failed to handle round state: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("known consensus messages sent again")
+	}
+	// Incomplete round states are rejected
+	if err := pm.handleRoundState(p, &electionData{BlockNumber: number}); err == nil {
+		t.Errorf("incomplete round state accepted")
+	}
+}
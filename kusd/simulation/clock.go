@@ -0,0 +1,39 @@
+package simulation
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common/mclock"
+)
+
+// skewedClock is a validator clock running ahead or behind the local machine.
+type skewedClock struct {
+	offset int64 // Skew of the clock in nanoseconds, accessed atomically
+}
+
+// Now returns the local time shifted by the skew.
+func (c *skewedClock) Now() mclock.AbsTime {
+	return mclock.Now() + mclock.AbsTime(c.Skew())
+}
+
+// Sleep waits for the duration to elapse.
+func (c *skewedClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// After waits for the duration to elapse. Durations are the same on every
+// clock, only the absolute time is skewed.
+func (c *skewedClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Skew returns the current offset of the clock.
+func (c *skewedClock) Skew() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.offset))
+}
+
+// SetSkew moves the clock by the given offset from the local time.
+func (c *skewedClock) SetSkew(offset time.Duration) {
+	atomic.StoreInt64(&c.offset, int64(offset))
+}
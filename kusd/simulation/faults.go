@@ -0,0 +1,244 @@
+package simulation
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/kusd"
+	"github.com/kowala-tech/kUSD/p2p"
+	"github.com/kowala-tech/kUSD/rlp"
+)
+
+// Faults are the misbehaviours injected into the messages a node sends to its
+// peers. The zero value is a well behaved node.
+type Faults struct {
+	Delay     time.Duration `json:"delay"`     // Latency added to every message
+	Jitter    time.Duration `json:"jitter"`    // Upper bound of the random latency added on top of the delay
+	Loss      float64       `json:"loss"`      // Probability of dropping a gossip or consensus message
+	Byzantine bool          `json:"byzantine"` // Whether the node equivocates, voting for a different block towards half its peers
+}
+
+// errLinkClosed is returned when sending over a link to a disconnected peer.
+var errLinkClosed = errors.New("link closed")
+
+// lossy are the messages that may be lost. The handshake and the sync requests
+// and replies are always delivered, as the protocol drops peers that don't
+// answer instead of retrying.
+var lossy = map[uint64]bool{
+	kusd.NewBlockHashesMsg: true,
+	kusd.TxMsg:             true,
+	kusd.NewBlockMsg:       true,
+	kusd.ProposalMsg:       true,
+	kusd.ProposalPOLMsg:    true,
+	kusd.VoteMsg:           true,
+	kusd.ElectionMsg:       true,
+	kusd.BlockFragmentMsg:  true,
+}
+
+// faultInjector applies the faults of a node to its outgoing messages.
+type faultInjector struct {
+	key     *ecdsa.PrivateKey // Key of the node, signing its equivocating votes
+	signer  types.Signer      // Signer of the chain the node votes on
+	address common.Address    // Address of the validator, only its own votes are equivocated
+
+	faults      Faults
+	rand        *rand.Rand
+	links       int // Number of links opened so far, every other one a twin
+	equivocated int // Number of votes equivocated so far
+	lock        sync.Mutex
+}
+
+func newFaultInjector(key *ecdsa.PrivateKey, chainID *big.Int, seed int64) *faultInjector {
+	return &faultInjector{
+		key:     key,
+		signer:  types.NewAndromedaSigner(chainID),
+		address: crypto.PubkeyToAddress(key.PublicKey),
+		rand:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Faults returns the faults currently injected.
+func (fi *faultInjector) Faults() Faults {
+	fi.lock.Lock()
+	defer fi.lock.Unlock()
+
+	return fi.faults
+}
+
+// SetFaults replaces the faults injected from now on.
+func (fi *faultInjector) SetFaults(faults Faults) {
+	fi.lock.Lock()
+	defer fi.lock.Unlock()
+
+	fi.faults = faults
+}
+
+// twin decides whether the peer of a new link receives the equivocating votes.
+// Links alternate, so that a byzantine node always splits its peers in halves.
+func (fi *faultInjector) twin() bool {
+	fi.lock.Lock()
+	defer fi.lock.Unlock()
+
+	fi.links++
+	return fi.links%2 == 1
+}
+
+// sample decides the fate of a message: how long it's delayed, whether it's
+// lost and whether it has to be equivocated.
+func (fi *faultInjector) sample(code uint64) (time.Duration, bool, bool) {
+	fi.lock.Lock()
+	defer fi.lock.Unlock()
+
+	delay := fi.faults.Delay
+	if fi.faults.Jitter > 0 {
+		delay += time.Duration(fi.rand.Int63n(int64(fi.faults.Jitter)))
+	}
+	lost := lossy[code] && fi.faults.Loss > 0 && fi.rand.Float64() < fi.faults.Loss
+	return delay, lost, fi.faults.Byzantine && code == kusd.VoteMsg
+}
+
+// equivocate replaces a vote of the node with a vote for a different block of
+// the same height, round and type. Votes relayed on behalf of other validators
+// are left untouched.
+func (fi *faultInjector) equivocate(payload []byte) []byte {
+	var vote types.Vote
+	if err := rlp.DecodeBytes(payload, &vote); err != nil {
+		return payload
+	}
+	if from, err := types.VoteSender(fi.signer, &vote); err != nil || from != fi.address {
+		return payload
+	}
+	hash := common.Hash{}
+	if vote.BlockHash() == hash {
+		hash = crypto.Keccak256Hash(vote.BlockNumber().Bytes())
+	}
+	conflict, err := types.SignVote(types.NewVote(vote.BlockNumber(), hash, vote.Round(), vote.Type()), fi.signer, fi.key)
+	if err != nil {
+		return payload
+	}
+	enc, err := rlp.EncodeToBytes(conflict)
+	if err != nil {
+		return payload
+	}
+	fi.lock.Lock()
+	fi.equivocated++
+	fi.lock.Unlock()
+
+	return enc
+}
+
+// Equivocations returns the number of votes equivocated so far.
+func (fi *faultInjector) Equivocations() int {
+	fi.lock.Lock()
+	defer fi.lock.Unlock()
+
+	return fi.equivocated
+}
+
+// delayedMsg is a message waiting for its delivery time.
+type delayedMsg struct {
+	code    uint64
+	payload []byte
+	at      time.Time
+}
+
+// faultyRW is the message pipe towards a single peer, injecting the faults of
+// the local node. Messages are delivered in order by a background goroutine so
+// that a delay on one message holds back the ones sent after it, like a slow
+// link would.
+type faultyRW struct {
+	p2p.MsgReadWriter
+
+	faults *faultInjector
+	twin   bool // Whether the peer receives the equivocating votes of a byzantine node
+
+	queue chan *delayedMsg
+	last  time.Time // Delivery time of the last queued message, keeping the link FIFO
+	fail  error     // First write error of the delivery loop
+	lock  sync.Mutex
+	quit  chan struct{}
+}
+
+func newFaultyRW(rw p2p.MsgReadWriter, faults *faultInjector) *faultyRW {
+	frw := &faultyRW{
+		MsgReadWriter: rw,
+		faults:        faults,
+		twin:          faults.twin(),
+		queue:         make(chan *delayedMsg, 1024),
+		quit:          make(chan struct{}),
+	}
+	go frw.loop()
+	return frw
+}
+
+// WriteMsg implements p2p.MsgWriter, queueing the message unless it's lost.
+func (rw *faultyRW) WriteMsg(msg p2p.Msg) error {
+	payload, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	delay, lost, byzantine := rw.faults.sample(msg.Code)
+	if lost {
+		return nil
+	}
+	if byzantine && rw.twin {
+		payload = rw.faults.equivocate(payload)
+	}
+	rw.lock.Lock()
+	if rw.fail != nil {
+		rw.lock.Unlock()
+		return rw.fail
+	}
+	at := time.Now().Add(delay)
+	if at.Before(rw.last) {
+		at = rw.last
+	}
+	rw.last = at
+	rw.lock.Unlock()
+
+	select {
+	case rw.queue <- &delayedMsg{code: msg.Code, payload: payload, at: at}:
+		return nil
+	case <-rw.quit:
+		return errLinkClosed
+	}
+}
+
+// loop delivers the queued messages once their time is due.
+func (rw *faultyRW) loop() {
+	for {
+		select {
+		case msg := <-rw.queue:
+			if wait := time.Until(msg.at); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-rw.quit:
+					return
+				}
+			}
+			err := rw.MsgReadWriter.WriteMsg(p2p.Msg{Code: msg.code, Size: uint32(len(msg.payload)), Payload: bytes.NewReader(msg.payload)})
+			if err != nil {
+				rw.lock.Lock()
+				rw.fail = err
+				rw.lock.Unlock()
+				return
+			}
+		case <-rw.quit:
+			return
+		}
+	}
+}
+
+// close stops the delivery loop, dropping the messages still in flight.
+func (rw *faultyRW) close() {
+	close(rw.quit)
+}
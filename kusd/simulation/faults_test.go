@@ -0,0 +1,99 @@
+package simulation
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/kusd"
+	"github.com/kowala-tech/kUSD/p2p"
+)
+
+// newTestLink creates a faulty link towards a peer receiving equivocations.
+func newTestLink(t *testing.T, faults Faults) (*faultyRW, *p2p.MsgPipeRW, *faultInjector) {
+	key, _ := crypto.GenerateKey()
+	fi := newFaultInjector(key, big.NewInt(chainID), 1)
+	fi.SetFaults(faults)
+
+	local, remote := p2p.MsgPipe()
+	t.Cleanup(func() { local.Close() })
+
+	return newFaultyRW(local, fi), remote, fi
+}
+
+// Tests that delayed messages are delivered late but in order.
+func TestDelayKeepsOrder(t *testing.T) {
+	rw, remote, _ := newTestLink(t, Faults{Delay: 50 * time.Millisecond, Jitter: 50 * time.Millisecond})
+	defer rw.close()
+
+	start := time.Now()
+	for i := uint(0); i < 10; i++ {
+		if err := p2p.Send(rw, kusd.TxMsg, []uint{i}); err != nil {
+			t.Fatalf("send %d failed: %v", i, err)
+		}
+	}
+	for i := uint(0); i < 10; i++ {
+		if err := p2p.ExpectMsg(remote, kusd.TxMsg, []uint{i}); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("messages delivered too early: %v", elapsed)
+	}
+}
+
+// Tests that losses only hit gossip and consensus messages.
+func TestLossSparesHandshake(t *testing.T) {
+	rw, remote, _ := newTestLink(t, Faults{Loss: 1})
+	defer rw.close()
+
+	if err := p2p.Send(rw, kusd.TxMsg, []uint{1}); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if err := p2p.Send(rw, kusd.StatusMsg, []uint{2}); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if err := p2p.ExpectMsg(remote, kusd.StatusMsg, []uint{2}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests that a byzantine validator equivocates its own votes only.
+func TestEquivocation(t *testing.T) {
+	rw, remote, fi := newTestLink(t, Faults{Byzantine: true})
+	defer rw.close()
+
+	signer := types.NewAndromedaSigner(big.NewInt(chainID))
+	other, _ := crypto.GenerateKey()
+	for i, key := range []*ecdsa.PrivateKey{fi.key, other} {
+		vote, err := types.SignVote(types.NewVote(big.NewInt(5), common.HexToHash("0x01"), 2, types.PreVote), signer, key)
+		if err != nil {
+			t.Fatalf("failed to sign vote: %v", err)
+		}
+		if err := p2p.Send(rw, kusd.VoteMsg, vote); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+		msg, err := remote.ReadMsg()
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		var sent types.Vote
+		if err := msg.Decode(&sent); err != nil {
+			t.Fatalf("invalid vote: %v", err)
+		}
+		from, err := types.VoteSender(signer, &sent)
+		if err != nil || from != crypto.PubkeyToAddress(key.PublicKey) {
+			t.Fatalf("vote %d: sender mismatch: %x, %v", i, from, err)
+		}
+		if sent.BlockNumber().Cmp(vote.BlockNumber()) != 0 || sent.Round() != vote.Round() || sent.Type() != vote.Type() {
+			t.Errorf("vote %d: election changed: have %v, want %v", i, &sent, vote)
+		}
+		if equivocated := sent.BlockHash() != vote.BlockHash(); equivocated != (i == 0) {
+			t.Errorf("vote %d: equivocated %v, want %v", i, equivocated, i == 0)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+// Package simulation runs networks of Kowala validators in memory, injecting
+// network and node faults, to exercise the consensus protocol under adverse
+// conditions.
+//
+// A harness boots the validators of its own genesis block on top of the
+// p2p/simulations framework. Faults are injected per validator: messages it
+// sends may be delayed, lost or, for a byzantine validator, equivocated; its
+// clock may be skewed; and the harness may partition the network or crash and
+// restart validators. Meanwhile the harness records every block committed by
+// every validator, checking that no two validators ever commit different
+// blocks at the same height (safety) and that the chain keeps growing
+// (liveness).
+package simulation
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	sysgenesis "github.com/kowala-tech/kUSD/contracts/network/genesis"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/p2p/discover"
+	"github.com/kowala-tech/kUSD/p2p/simulations"
+	"github.com/kowala-tech/kUSD/p2p/simulations/adapters"
+	"github.com/kowala-tech/kUSD/params"
+)
+
+const (
+	chainID          = 519331 // Chain of the simulated networks
+	validatorDeposit = 100000 // Stake of every genesis validator, the minimum of the network contract
+
+	startTimeout    = time.Minute      // Time the validators get to sync and join the election on start
+	shutdownTimeout = 30 * time.Second // Time the validators get to withdraw from the election on shutdown
+)
+
+// commitRecord is the first block committed at a height.
+type commitRecord struct {
+	hash common.Hash
+	node string
+}
+
+// Harness is a simulated network of validators.
+type Harness struct {
+	network *simulations.Network
+	genesis *core.Genesis
+
+	nodes  []*validatorNode
+	byID   map[discover.NodeID]*validatorNode
+	groups []int // Partition of every validator, all connected validators share one
+
+	sender *ecdsa.PrivateKey // Funded account sending the transactions
+	nonce  uint64
+
+	commits   map[uint64]commitRecord
+	violation error // First safety violation observed
+
+	traceDir string // Directory recording the state machines of the validators, if any
+
+	lock sync.Mutex
+}
+
+// New creates a harness of the given number of validators, all of them voters
+// of the genesis block with the same stake.
+func New(validators int) (*Harness, error) {
+	if validators < 1 {
+		return nil, fmt.Errorf("invalid number of validators: %d", validators)
+	}
+	h := &Harness{
+		byID:    make(map[discover.NodeID]*validatorNode),
+		groups:  make([]int, validators),
+		commits: make(map[uint64]commitRecord),
+	}
+	var err error
+	if h.sender, err = crypto.GenerateKey(); err != nil {
+		return nil, err
+	}
+	voters := make([]sysgenesis.Validator, validators)
+	for i := range voters {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		vn := &validatorNode{
+			name:   fmt.Sprintf("validator%02d", i),
+			key:    key,
+			faults: newFaultInjector(key, big.NewInt(chainID), int64(i)),
+			clock:  new(skewedClock),
+		}
+		h.nodes = append(h.nodes, vn)
+		h.byID[vn.ID()] = vn
+
+		voters[i] = sysgenesis.Validator{Address: crypto.PubkeyToAddress(key.PublicKey), Deposit: big.NewInt(validatorDeposit)}
+	}
+	if h.genesis, err = makeGenesis(voters, crypto.PubkeyToAddress(h.sender.PublicKey)); err != nil {
+		return nil, err
+	}
+	adapter := adapters.NewSimAdapter(adapters.Services{ServiceName: h.newService})
+	h.network = simulations.NewNetwork(adapter, &simulations.NetworkConfig{DefaultService: ServiceName})
+
+	for _, vn := range h.nodes {
+		conf := &adapters.NodeConfig{ID: vn.ID(), PrivateKey: vn.key, Name: vn.name, Services: []string{ServiceName}}
+		if _, err := h.network.NewNodeWithConfig(conf); err != nil {
+			h.network.Shutdown()
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// makeGenesis creates a genesis block registering the validators as voters and
+// funding them along with the sender of the transactions.
+func makeGenesis(validators []sysgenesis.Validator, sender common.Address) (*core.Genesis, error) {
+	genesis := &core.Genesis{
+		Timestamp: uint64(time.Now().Unix()),
+		GasLimit:  4700000,
+		Alloc:     make(core.GenesisAlloc),
+		Config: &params.ChainConfig{
+			ChainID:    big.NewInt(chainID),
+			Tendermint: &params.TendermintConfig{Rewarded: true},
+		},
+		ExtraData: make([]byte, 32),
+	}
+	contracts, err := sysgenesis.SystemContracts(sysgenesis.DefaultOwner, validators...)
+	if err != nil {
+		return nil, err
+	}
+	for addr, account := range contracts {
+		genesis.Alloc[addr] = account
+	}
+	funds := new(big.Int).Lsh(big.NewInt(1), 128)
+	for _, validator := range validators {
+		genesis.Alloc[validator.Address] = core.GenesisAccount{Balance: funds}
+	}
+	genesis.Alloc[sender] = core.GenesisAccount{Balance: funds}
+	return genesis, nil
+}
+
+// Network returns the underlying simulation network, e.g. to serve it over the
+// simulations HTTP API.
+func (h *Harness) Network() *simulations.Network {
+	return h.network
+}
+
+// Validators returns the names of the validators, in index order.
+func (h *Harness) Validators() []string {
+	names := make([]string, len(h.nodes))
+	for i, vn := range h.nodes {
+		names[i] = vn.name
+	}
+	return names
+}
+
+// validator returns the validator of the given node.
+func (h *Harness) validator(id discover.NodeID) *validatorNode {
+	return h.byID[id]
+}
+
+// Start boots all the validators, connects them in a full mesh and sends the
+// first transaction, which the chain waits for before sealing its first block.
+// The first election starts with the transaction, so it's only sent once every
+// validator waits for it.
+func (h *Harness) Start() error {
+	for _, vn := range h.nodes {
+		if err := h.network.Start(vn.ID()); err != nil {
+			return err
+		}
+	}
+	if err := h.reconnect(); err != nil {
+		return err
+	}
+	if err := h.waitValidating(startTimeout); err != nil {
+		return err
+	}
+	return h.SendTransaction()
+}
+
+// waitValidating waits for every running validator to join the election.
+func (h *Harness) waitValidating(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var waiting []string
+		for _, vn := range h.nodes {
+			if s := h.running(vn); s != nil && !s.IsValidating() {
+				waiting = append(waiting, vn.name)
+			}
+		}
+		if len(waiting) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("validators not validating after %v: %s", timeout, strings.Join(waiting, ", "))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Shutdown stops all the validators. They're stopped at once, as each of them
+// withdraws from the election on its way out, which takes the others to commit.
+// Validators stuck in a stalled election are abandoned after a while.
+func (h *Harness) Shutdown() {
+	var wg sync.WaitGroup
+	for _, vn := range h.nodes {
+		if node := h.network.GetNode(vn.ID()); node == nil || !node.Up {
+			continue
+		}
+		wg.Add(1)
+		go func(vn *validatorNode) {
+			defer wg.Done()
+			if err := h.network.Stop(vn.ID()); err != nil {
+				log.Warn("Failed to stop validator", "name", vn.name, "err", err)
+			}
+		}(vn)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		h.network.Shutdown()
+	case <-time.After(shutdownTimeout):
+		log.Warn("Validators stuck in a stalled election, abandoning them")
+	}
+}
+
+// RecordTraces records the consensus state machine of every validator booted
+// from now on into the given directory, to replay it with validator.Replay.
+// A restarted validator overwrites the trace of its previous run.
+func (h *Harness) RecordTraces(dir string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.traceDir = dir
+}
+
+// SetFaults replaces the faults injected into the messages sent by a validator.
+func (h *Harness) SetFaults(index int, faults Faults) {
+	h.nodes[index].faults.SetFaults(faults)
+}
+
+// Equivocations returns the number of votes a byzantine validator equivocated.
+func (h *Harness) Equivocations(index int) int {
+	return h.nodes[index].faults.Equivocations()
+}
+
+// SetSkew moves the clock of a validator ahead or behind the others.
+func (h *Harness) SetSkew(index int, skew time.Duration) {
+	h.nodes[index].clock.SetSkew(skew)
+}
+
+// Crash stops a validator, losing its in-memory chain.
+func (h *Harness) Crash(index int) error {
+	return h.network.Stop(h.nodes[index].ID())
+}
+
+// Restart boots a crashed validator, which syncs again from its partition.
+func (h *Harness) Restart(index int) error {
+	if err := h.network.Start(h.nodes[index].ID()); err != nil {
+		return err
+	}
+	return h.reconnect()
+}
+
+// Partition splits the network into groups of validators, given by index,
+// which only talk among themselves. Validators missing from the groups are
+// isolated.
+func (h *Harness) Partition(groups ...[]int) error {
+	h.lock.Lock()
+	for i := range h.groups {
+		h.groups[i] = len(groups) + i + 1
+	}
+	for group, members := range groups {
+		for _, i := range members {
+			h.groups[i] = group + 1
+		}
+	}
+	h.lock.Unlock()
+
+	for i := range h.nodes {
+		for j := i + 1; j < len(h.nodes); j++ {
+			if !h.connected(i, j) {
+				if err := h.disconnect(i, j); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return h.reconnect()
+}
+
+// Heal reconnects all the validators of a partitioned network.
+func (h *Harness) Heal() error {
+	h.lock.Lock()
+	for i := range h.groups {
+		h.groups[i] = 0
+	}
+	h.lock.Unlock()
+
+	return h.reconnect()
+}
+
+// connected returns whether two validators are in the same partition.
+func (h *Harness) connected(i, j int) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.groups[i] == h.groups[j]
+}
+
+// reconnect connects all the running validators of each partition.
+func (h *Harness) reconnect() error {
+	for i, one := range h.nodes {
+		if !h.network.GetNode(one.ID()).Up {
+			continue
+		}
+		for j := i + 1; j < len(h.nodes); j++ {
+			other := h.nodes[j]
+			if !h.connected(i, j) || !h.network.GetNode(other.ID()).Up {
+				continue
+			}
+			if conn := h.network.GetConn(one.ID(), other.ID()); conn != nil && conn.Up {
+				continue
+			}
+			if err := h.network.Connect(one.ID(), other.ID()); err != nil && !strings.Contains(err.Error(), "already connected") {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// disconnect drops the connection between two validators, if any.
+func (h *Harness) disconnect(i, j int) error {
+	one, other := h.nodes[i].ID(), h.nodes[j].ID()
+	if conn := h.network.GetConn(one, other); conn == nil || !conn.Up {
+		return nil
+	}
+	if err := h.network.Disconnect(one, other); err != nil && !strings.Contains(err.Error(), "already disconnected") {
+		return err
+	}
+	return nil
+}
+
+// running returns the running service of a validator, nil if it's down.
+func (h *Harness) running(vn *validatorNode) *service {
+	node := h.network.GetNode(vn.ID())
+	if node == nil || !node.Up {
+		return nil
+	}
+	sim, ok := node.Node.(*adapters.SimNode)
+	if !ok {
+		return nil
+	}
+	for _, s := range sim.Services() {
+		if s, ok := s.(*service); ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// SendTransaction sends a transfer to the pool of the first running validator.
+// Validators only start the chain once they have a transaction to include.
+func (h *Harness) SendTransaction() error {
+	for _, vn := range h.nodes {
+		s := h.running(vn)
+		if s == nil {
+			continue
+		}
+		h.lock.Lock()
+		nonce := h.nonce
+		h.nonce++
+		h.lock.Unlock()
+
+		to := crypto.PubkeyToAddress(h.sender.PublicKey)
+		tx := types.NewTransaction(nonce, to, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+		tx, err := types.SignTx(tx, types.NewAndromedaSigner(h.genesis.Config.ChainID), h.sender)
+		if err != nil {
+			return err
+		}
+		return s.TxPool().AddLocal(tx)
+	}
+	return fmt.Errorf("no validator running")
+}
+
+// commit records a block committed by a validator, checking it against the
+// blocks the others committed at the same height.
+func (h *Harness) commit(vn *validatorNode, block *types.Block) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	number := block.NumberU64()
+	record, ok := h.commits[number]
+	if !ok {
+		h.commits[number] = commitRecord{hash: block.Hash(), node: vn.name}
+		return
+	}
+	if record.hash != block.Hash() && h.violation == nil {
+		h.violation = fmt.Errorf("conflicting blocks at height %d: %s committed %x, %s committed %x", number, record.node, record.hash, vn.name, block.Hash())
+	}
+}
+
+// CheckSafety returns the first conflicting commit seen in the network, if any.
+func (h *Harness) CheckSafety() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.violation
+}
+
+// Heights returns the head block number of every running validator.
+func (h *Harness) Heights() map[string]uint64 {
+	heights := make(map[string]uint64)
+	for _, vn := range h.nodes {
+		if s := h.running(vn); s != nil {
+			heights[vn.name] = s.BlockChain().CurrentBlock().NumberU64()
+		}
+	}
+	return heights
+}
+
+// WaitHeight waits for every running validator to reach the given height,
+// failing if the network stalls for the whole timeout or breaks safety.
+func (h *Harness) WaitHeight(height uint64, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := h.CheckSafety(); err != nil {
+			return err
+		}
+		heights := h.Heights()
+		done := len(heights) > 0
+		for _, number := range heights {
+			if number < height {
+				done = false
+			}
+		}
+		if done {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("height %d not reached in %v: %s", height, timeout, formatHeights(heights))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// formatHeights renders the heights of the validators sorted by name.
+func formatHeights(heights map[string]uint64) string {
+	names := make([]string, 0, len(heights))
+	for name := range heights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := make([]string, len(names))
+	for i, name := range names {
+		report[i] = fmt.Sprintf("%s=%d", name, heights[name])
+	}
+	return strings.Join(report, " ")
+}
@@ -0,0 +1,128 @@
+package simulation
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+var simulate = flag.Bool("sim", false, "run the consensus simulations, taking minutes")
+
+// startHarness boots a network of validators, stopping it with the test. The
+// simulations run on real timers and only if enabled.
+func startHarness(t *testing.T, validators int) *Harness {
+	if !*simulate {
+		t.Skip("consensus simulations disabled, enable with -sim")
+	}
+	h, err := New(validators)
+	if err != nil {
+		t.Fatalf("failed to create harness: %v", err)
+	}
+	if err := h.Start(); err != nil {
+		h.Shutdown()
+		t.Fatalf("failed to start harness: %v", err)
+	}
+	return h
+}
+
+// Tests that a healthy network commits blocks.
+func TestHealthyNetwork(t *testing.T) {
+	h := startHarness(t, 4)
+	defer h.Shutdown()
+
+	if err := h.WaitHeight(3, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests that a network keeps committing the same blocks with a byzantine
+// validator voting for conflicting blocks towards half its peers.
+func TestByzantineEquivocation(t *testing.T) {
+	h := startHarness(t, 4)
+	defer h.Shutdown()
+
+	h.SetFaults(0, Faults{Byzantine: true})
+	if err := h.WaitHeight(3, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if h.Equivocations(0) == 0 {
+		t.Error("byzantine validator didn't equivocate")
+	}
+}
+
+// Tests that a network keeps committing blocks with validators whose clocks are
+// ahead and behind the others.
+func TestClockSkew(t *testing.T) {
+	h := startHarness(t, 4)
+	defer h.Shutdown()
+
+	h.SetSkew(0, 300*time.Millisecond)
+	h.SetSkew(1, -300*time.Millisecond)
+	if err := h.WaitHeight(3, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests that a network keeps committing blocks, and the same ones, with lossy
+// and slow links.
+func TestUnreliableLinks(t *testing.T) {
+	h := startHarness(t, 4)
+	defer h.Shutdown()
+
+	for i := range h.Validators() {
+		h.SetFaults(i, Faults{Delay: 20 * time.Millisecond, Jitter: 30 * time.Millisecond, Loss: 0.05})
+	}
+	if err := h.WaitHeight(3, 2*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests that a crashed validator catches up with the network once restarted.
+func TestCrashRestart(t *testing.T) {
+	h := startHarness(t, 4)
+	defer h.Shutdown()
+
+	if err := h.WaitHeight(2, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Crash(3); err != nil {
+		t.Fatalf("failed to crash validator: %v", err)
+	}
+	if err := h.Restart(3); err != nil {
+		t.Fatalf("failed to restart validator: %v", err)
+	}
+	if err := h.WaitHeight(4, 2*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests that no conflicting blocks are committed on both sides of a partition,
+// and that the network recovers once healed.
+func TestPartition(t *testing.T) {
+	h := startHarness(t, 4)
+	defer h.Shutdown()
+
+	if err := h.WaitHeight(2, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Partition([]int{0, 1}, []int{2, 3}); err != nil {
+		t.Fatalf("failed to partition network: %v", err)
+	}
+	time.Sleep(10 * time.Second)
+	if err := h.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Heal(); err != nil {
+		t.Fatalf("failed to heal network: %v", err)
+	}
+	heights := h.Heights()
+	var top uint64
+	for _, height := range heights {
+		if height > top {
+			top = height
+		}
+	}
+	if err := h.WaitHeight(top+2, 2*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,239 @@
+package simulation
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/kowala-tech/kUSD/accounts"
+	"github.com/kowala-tech/kUSD/accounts/keystore"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/kusd"
+	"github.com/kowala-tech/kUSD/kusd/downloader"
+	"github.com/kowala-tech/kUSD/node"
+	"github.com/kowala-tech/kUSD/p2p"
+	"github.com/kowala-tech/kUSD/p2p/discover"
+	"github.com/kowala-tech/kUSD/p2p/simulations/adapters"
+	"github.com/kowala-tech/kUSD/rpc"
+)
+
+// ServiceName is the name of the validator service in the simulation adapter.
+const ServiceName = "kusd"
+
+// validatorNode is a validator of the simulated network, outliving the crashes
+// and restarts of its service.
+type validatorNode struct {
+	name   string
+	key    *ecdsa.PrivateKey // Key of both the p2p node and the validator account
+	faults *faultInjector
+	clock  *skewedClock
+}
+
+// ID returns the p2p identity of the validator.
+func (n *validatorNode) ID() discover.NodeID {
+	return discover.PubkeyID(&n.key.PublicKey)
+}
+
+// service is a Kowala full node validating from start up, injecting the faults
+// of its validator into the messages it sends.
+type service struct {
+	*kusd.Kowala
+
+	harness *Harness
+	node    *validatorNode
+	quit    chan struct{}
+}
+
+// newService creates the Kowala service of a validator of the harness.
+func (h *Harness) newService(ctx *adapters.ServiceContext) (node.Service, error) {
+	vn := h.validator(ctx.Config.ID)
+	if vn == nil {
+		return nil, fmt.Errorf("unknown validator %s", ctx.Config.ID)
+	}
+	if err := unlockKey(ctx.NodeContext.AccountManager, vn.key); err != nil {
+		return nil, err
+	}
+	config := kusd.DefaultConfig
+	config.Genesis = h.genesis
+	config.NetworkId = h.genesis.Config.ChainID.Uint64()
+	config.SyncMode = downloader.FullSync
+	config.Coinbase = crypto.PubkeyToAddress(vn.key.PublicKey)
+	config.Deposit = validatorDeposit
+	config.TxPool.Journal = ""
+
+	h.lock.Lock()
+	if h.traceDir != "" {
+		config.ValidatorTrace = filepath.Join(h.traceDir, vn.name+".json")
+	}
+	h.lock.Unlock()
+
+	backend, err := kusd.New(ctx.NodeContext, &config)
+	if err != nil {
+		return nil, err
+	}
+	backend.Validator().SetClock(vn.clock)
+
+	return &service{Kowala: backend, harness: h, node: vn, quit: make(chan struct{})}, nil
+}
+
+// unlockKey imports the validator key into the keystore of the node and unlocks
+// it. The ephemeral keystore of a simulated node is wiped on shutdown, but the
+// account stays cached and unlocked, so a restarted node reuses it.
+func unlockKey(am *accounts.Manager, key *ecdsa.PrivateKey) error {
+	ks := am.Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+
+	account, err := ks.ImportECDSA(key, "")
+	if err != nil {
+		if ks.HasAddress(crypto.PubkeyToAddress(key.PublicKey)) {
+			return nil
+		}
+		return err
+	}
+	return ks.Unlock(account, "")
+}
+
+// Protocols implements node.Service, injecting the faults of the validator into
+// the links to its peers.
+func (s *service) Protocols() []p2p.Protocol {
+	protos := s.Kowala.Protocols()
+	for i := range protos {
+		run := protos[i].Run
+		protos[i].Run = func(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+			frw := newFaultyRW(rw, s.node.faults)
+			defer frw.close()
+			return run(peer, frw)
+		}
+	}
+	return protos
+}
+
+// APIs implements node.Service, adding the fault injection API of the node.
+func (s *service) APIs() []rpc.API {
+	return append(s.Kowala.APIs(), rpc.API{
+		Namespace: "sim",
+		Version:   "1.0",
+		Service:   &PrivateSimAPI{s.harness, s.node},
+	})
+}
+
+// Start implements node.Service, starting the validator once the protocol runs
+// and recording the blocks it commits.
+func (s *service) Start(srvr *p2p.Server) error {
+	if err := s.Kowala.Start(srvr); err != nil {
+		return err
+	}
+	go s.record()
+	return s.StartValidating()
+}
+
+// Stop implements node.Service.
+func (s *service) Stop() error {
+	close(s.quit)
+	return s.Kowala.Stop()
+}
+
+// record reports the blocks committed by the node to the harness.
+func (s *service) record() {
+	events := make(chan core.ChainEvent, 16)
+	sub := s.BlockChain().SubscribeChainEvent(events)
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case ev := <-events:
+			s.harness.commit(s.node, ev.Block)
+		case <-sub.Err():
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// PrivateSimAPI injects faults into a simulated validator. Arguments are given
+// as strings so that they can be passed along from the command line.
+type PrivateSimAPI struct {
+	harness *Harness
+	node    *validatorNode
+}
+
+// Faults returns the faults injected into the validator.
+func (api *PrivateSimAPI) Faults() Faults {
+	return api.node.faults.Faults()
+}
+
+// SetDelay sets the latency of the messages sent by the validator, plus up to
+// a random jitter, e.g. "200ms" and "50ms".
+func (api *PrivateSimAPI) SetDelay(delay, jitter string) error {
+	d, err := time.ParseDuration(delay)
+	if err != nil {
+		return err
+	}
+	var j time.Duration
+	if jitter != "" {
+		if j, err = time.ParseDuration(jitter); err != nil {
+			return err
+		}
+	}
+	if d < 0 || j < 0 {
+		return errors.New("negative delay")
+	}
+	faults := api.node.faults.Faults()
+	faults.Delay, faults.Jitter = d, j
+	api.node.faults.SetFaults(faults)
+	return nil
+}
+
+// SetLoss sets the probability, between 0 and 1, of the validator losing the
+// gossip and consensus messages it sends.
+func (api *PrivateSimAPI) SetLoss(rate string) error {
+	loss, err := strconv.ParseFloat(rate, 64)
+	if err != nil {
+		return err
+	}
+	if loss < 0 || loss > 1 {
+		return fmt.Errorf("loss rate %v out of [0, 1]", loss)
+	}
+	faults := api.node.faults.Faults()
+	faults.Loss = loss
+	api.node.faults.SetFaults(faults)
+	return nil
+}
+
+// SetByzantine toggles the equivocation of the votes of the validator.
+func (api *PrivateSimAPI) SetByzantine(enabled string) error {
+	byzantine, err := strconv.ParseBool(enabled)
+	if err != nil {
+		return err
+	}
+	faults := api.node.faults.Faults()
+	faults.Byzantine = byzantine
+	api.node.faults.SetFaults(faults)
+	return nil
+}
+
+// SetClockSkew moves the clock of the validator ahead or behind the others,
+// e.g. "-300ms".
+func (api *PrivateSimAPI) SetClockSkew(offset string) error {
+	skew, err := time.ParseDuration(offset)
+	if err != nil {
+		return err
+	}
+	api.node.clock.SetSkew(skew)
+	return nil
+}
+
+// CheckSafety returns the first pair of conflicting blocks committed in the
+// whole network, if any.
+func (api *PrivateSimAPI) CheckSafety() error {
+	return api.harness.CheckSafety()
+}
+
+// Heights returns the head block number of every running validator.
+func (api *PrivateSimAPI) Heights() map[string]uint64 {
+	return api.harness.Heights()
+}
@@ -152,6 +152,7 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 		// 10 seconds should be more than enough to sync with a peer before it gets to a forced sync
 		// Mark initial sync done
 		atomic.StoreUint32(&pm.acceptTxs, 1) 
+		atomic.StoreUint32(&pm.synced, 1)
 		pm.eventMux.Post(downloader.DoneEvent{})
 		return
 	}
@@ -162,8 +163,20 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 
 	pHead, pBlockNumber := peer.Head()
 
-	if pBlockNumber.Cmp(blockNumber) <= 0 {
+	// Nothing new to sync, fill in the history skipped by a checkpoint sync instead.
+	// A peer behind us can't vouch for our chain being up to date though, so until
+	// the initial sync is done a peer at our height is synced with all the same:
+	// the downloader checks that it agrees with our chain before reporting the sync
+	// done to the validators waiting for it.
+	switch pBlockNumber.Cmp(blockNumber) {
+	case -1:
+		pm.downloader.Backfill(peer.id)
 		return
+	case 0:
+		if atomic.LoadUint32(&pm.synced) == 1 {
+			pm.downloader.Backfill(peer.id)
+			return
+		}
 	}
 
 	// Otherwise try to sync with the downloader
@@ -171,6 +184,9 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 	if atomic.LoadUint32(&pm.fastSync) == 1 {
 		// Fast sync was explicitly requested, and explicitly granted
 		mode = downloader.FastSync
+		if atomic.LoadUint32(&pm.snapSync) == 1 {
+			mode = downloader.SnapSync
+		}
 	} else if currentBlock.NumberU64() == 0 && pm.blockchain.CurrentFastBlock().NumberU64() > 0 {
 		// The database seems empty as the current block is the genesis. Yet the fast
 		// block is ahead, so fast sync was enabled for this node at a certain point.
@@ -194,6 +210,7 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 		return
 	}
 	atomic.StoreUint32(&pm.acceptTxs, 1) // Mark initial sync done
+	atomic.StoreUint32(&pm.synced, 1)
 	if head := pm.blockchain.CurrentBlock(); head.NumberU64() > 0 {
 		// We've completed a sync cycle, notify all peers of new state. This path is
 		// essential in star-topology networks where a gateway node needs to notify
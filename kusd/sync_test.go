@@ -26,8 +26,8 @@ func TestFastSyncDisabling(t *testing.T) {
 	// Sync up the two peers
 	io1, io2 := p2p.MsgPipe()
 
-	go pmFull.handle(pmFull.newPeer(63, p2p.NewPeer(discover.NodeID{}, "empty", nil), io2))
-	go pmEmpty.handle(pmEmpty.newPeer(63, p2p.NewPeer(discover.NodeID{}, "full", nil), io1))
+	go pmFull.handle(pmFull.newPeer(kusd4, p2p.NewPeer(discover.NodeID{}, "empty", nil), io2))
+	go pmEmpty.handle(pmEmpty.newPeer(kusd4, p2p.NewPeer(discover.NodeID{}, "full", nil), io1))
 
 	time.Sleep(250 * time.Millisecond)
 	pmEmpty.synchronise(pmEmpty.peers.BestPeer())
@@ -37,3 +37,54 @@ func TestFastSyncDisabling(t *testing.T) {
 		t.Fatalf("fast sync not disabled after successful synchronisation")
 	}
 }
+
+// Tests that the initial sync is only done once the chain is synced with a peer
+// not behind it, whether there's anything new to download or not.
+func TestSynchroniseDone(t *testing.T) {
+	tests := []struct {
+		local, remote int
+		validating    bool // Validators accept transactions before the initial sync
+		done          bool
+	}{
+		{local: 0, remote: 0, done: true},
+		{local: 8, remote: 4, done: false},
+		{local: 8, remote: 8, done: true},
+		{local: 8, remote: 8, validating: true, done: true},
+		{local: 4, remote: 8, done: true},
+	}
+	for i, tt := range tests {
+		pmLocal := newTestProtocolManagerMust(t, downloader.FullSync, tt.local, nil, nil)
+		pmRemote := newTestProtocolManagerMust(t, downloader.FullSync, tt.remote, nil, nil)
+		if tt.validating {
+			atomic.StoreUint32(&pmLocal.acceptTxs, 1)
+		}
+
+		io1, io2 := p2p.MsgPipe()
+		go pmRemote.handle(pmRemote.newPeer(kusd4, p2p.NewPeer(discover.NodeID{1}, "local", nil), io2))
+		go pmLocal.handle(pmLocal.newPeer(kusd4, p2p.NewPeer(discover.NodeID{2}, "remote", nil), io1))
+		time.Sleep(250 * time.Millisecond)
+
+		// The multiplexer blocks until the event is delivered, wait for it aside
+		sub := pmLocal.eventMux.Subscribe(downloader.DoneEvent{})
+		delivered := make(chan bool, 1)
+		go func() {
+			_, ok := <-sub.Chan()
+			delivered <- ok
+		}()
+		pmLocal.synchronise(pmLocal.peers.BestPeer())
+		sub.Unsubscribe()
+		done := <-delivered
+
+		if done != tt.done {
+			t.Errorf("test %d: sync done mismatch: have %v, want %v", i, done, tt.done)
+		}
+		if synced := atomic.LoadUint32(&pmLocal.synced) == 1; synced != tt.done {
+			t.Errorf("test %d: synced mismatch: have %v, want %v", i, synced, tt.done)
+		}
+		if head, want := pmLocal.blockchain.CurrentBlock().NumberU64(), uint64(tt.remote); tt.done && head != want {
+			t.Errorf("test %d: head mismatch: have %d, want %d", i, head, want)
+		}
+		pmLocal.Stop()
+		pmRemote.Stop()
+	}
+}
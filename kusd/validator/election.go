@@ -2,8 +2,10 @@ package validator
 
 import (
 	"math/big"
+	"sync"
 	"time"
 
+	"github.com/kowala-tech/kUSD/common"
 	"github.com/kowala-tech/kUSD/core"
 	"github.com/kowala-tech/kUSD/core/types"
 	"github.com/kowala-tech/kUSD/event"
@@ -13,6 +15,7 @@ import (
 type Election struct {
 	blockNumber *big.Int
 	round       uint64
+	step        Step
 
 	validators         *types.ValidatorSet
 	validatorsChecksum [32]byte
@@ -40,11 +43,18 @@ type Election struct {
 // VotingTables represents the voting tables available for each election round
 type VotingTables = [2]*core.VotingTable
 
-func NewVotingTables(eventMux *event.TypeMux, signer types.Signer, electionNumber *big.Int, round uint64, voters *types.ValidatorSet) VotingTables {
-	tables := VotingTables{}
-	tables[0] = core.NewVotingTable(eventMux, signer, electionNumber, round, types.PreVote, voters)
-	tables[1] = core.NewVotingTable(eventMux, signer, electionNumber, round, types.PreCommit, voters)
-	return tables
+func NewVotingTables(eventMux *event.TypeMux, signer types.Signer, electionNumber *big.Int, round uint64, voters *types.ValidatorSet) (VotingTables, error) {
+	var (
+		tables VotingTables
+		err    error
+	)
+	if tables[0], err = core.NewVotingTable(eventMux, signer, electionNumber, round, types.PreVote, voters); err != nil {
+		return tables, err
+	}
+	if tables[1], err = core.NewVotingTable(eventMux, signer, electionNumber, round, types.PreCommit, voters); err != nil {
+		return tables, err
+	}
+	return tables, nil
 }
 
 // VotingSystem records the election votes since round 1
@@ -55,12 +65,14 @@ type VotingSystem struct {
 	votesPerRound  map[uint64]VotingTables
 	signer         types.Signer
 
+	mu sync.Mutex // protects round and votesPerRound, added to by the protocol handlers
+
 	eventMux *event.TypeMux
 }
 
 // NewVotingSystem returns a new voting system
 // @TODO (rgeraldes) - in the future replace eventMux with a subscription method
-func NewVotingSystem(eventMux *event.TypeMux, signer types.Signer, electionNumber *big.Int, voters *types.ValidatorSet) *VotingSystem {
+func NewVotingSystem(eventMux *event.TypeMux, signer types.Signer, electionNumber *big.Int, voters *types.ValidatorSet) (*VotingSystem, error) {
 	system := &VotingSystem{
 		voters:         voters,
 		electionNumber: electionNumber,
@@ -70,26 +82,54 @@ func NewVotingSystem(eventMux *event.TypeMux, signer types.Signer, electionNumbe
 		signer:         signer,
 	}
 
-	system.NewRound()
+	tables, err := NewVotingTables(eventMux, signer, electionNumber, 0, voters)
+	if err != nil {
+		return nil, err
+	}
+	system.votesPerRound[0] = tables
 
-	return system
+	return system, nil
 }
 
+// NewRound starts recording the votes of the next round.
 func (vs *VotingSystem) NewRound() {
-	vs.votesPerRound[vs.round] = NewVotingTables(vs.eventMux, vs.signer, vs.electionNumber, vs.round, vs.voters)
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	vs.round++
+	vs.tables(vs.round)
+}
+
+// tables returns the voting tables of a round, creating them if needed. The
+// votes of the round following the running one are recorded too, as faster
+// validators may already be voting in it.
+func (vs *VotingSystem) tables(round uint64) (VotingTables, bool) {
+	votingTables, ok := vs.votesPerRound[round]
+	if !ok && round <= vs.round+1 {
+		// The voters were accepted by the tables of the first round
+		votingTables, _ = NewVotingTables(vs.eventMux, vs.signer, vs.electionNumber, round, vs.voters)
+		vs.votesPerRound[round], ok = votingTables, true
+	}
+	return votingTables, ok
 }
 
 // Add registers a vote
 func (vs *VotingSystem) Add(vote *types.Vote, local bool) (bool, error) {
 	// @TODO (rgeraldes) - validation
 	votingTable := vs.getVoteSet(vote.Round(), vote.Type())
+	if votingTable == nil {
+		return false, nil
+	}
 	votingTable.Add(vote, local)
 
 	return false, nil
 }
 
 func (vs *VotingSystem) getVoteSet(round uint64, voteType types.VoteType) *core.VotingTable {
-	votingTables, ok := vs.votesPerRound[round]
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	votingTables, ok := vs.tables(round)
 	if !ok {
 		// @TODO (rgeraldes) - critical
 		return nil
@@ -97,3 +137,53 @@ func (vs *VotingSystem) getVoteSet(round uint64, voteType types.VoteType) *core.
 
 	return votingTables[int(voteType)]
 }
+
+// Received returns the bit array of the validators whose vote of the given
+// round and type counted, nil if the round is unknown.
+func (vs *VotingSystem) Received(round uint64, voteType types.VoteType) *common.BitArray {
+	votingTable := vs.getVoteSet(round, voteType)
+	if votingTable == nil {
+		return nil
+	}
+	return votingTable.Received()
+}
+
+// Missing returns the votes of the given round and type that counted locally
+// but aren't set in the received bit array of a remote validator.
+func (vs *VotingSystem) Missing(round uint64, voteType types.VoteType, received *common.BitArray) types.Votes {
+	votingTable := vs.getVoteSet(round, voteType)
+	if votingTable == nil {
+		return nil
+	}
+	return votingTable.Missing(received)
+}
+
+// Majority returns the block hash a 2/3 majority of the validators voted for in
+// the given round and type, false if there's none.
+func (vs *VotingSystem) Majority(round uint64, voteType types.VoteType) (common.Hash, bool) {
+	votingTable := vs.getVoteSet(round, voteType)
+	if votingTable == nil {
+		return common.Hash{}, false
+	}
+	return votingTable.Majority()
+}
+
+// Commit returns the commit of the block pre-committed by a 2/3 majority of the
+// validators in any round, nil if the block didn't gather the majority.
+func (vs *VotingSystem) Commit(blockHash common.Hash) *types.Commit {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	for _, votingTables := range vs.votesPerRound {
+		preCommits := votingTables[int(types.PreCommit)]
+		if winner, ok := preCommits.Majority(); !ok || winner != blockHash {
+			continue
+		}
+		signatures := preCommits.Signatures(blockHash)
+		return &types.Commit{
+			PreCommits:     signatures,
+			FirstPreCommit: signatures[0],
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package validator
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/event"
+)
+
+// Tests that a sub-election only reaches a majority once 2/3 of the validators
+// voted for the same block, not as soon as 2/3 of them voted at all, so that a
+// validator equivocating towards part of the network can't split the vote.
+func TestVotingSystemMajority(t *testing.T) {
+	signer := types.NewAndromedaSigner(big.NewInt(1))
+	keys := make([]*ecdsa.PrivateKey, 4)
+	validators := make([]*types.Validator, len(keys))
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		validators[i] = types.NewValidator(crypto.PubkeyToAddress(keys[i].PublicKey), 100, big.NewInt(0))
+	}
+	mux := new(event.TypeMux)
+	sub := mux.Subscribe(core.NewMajorityEvent{})
+	defer sub.Unsubscribe()
+
+	number := big.NewInt(1)
+	set, err := types.NewValidatorSet(validators)
+	if err != nil {
+		t.Fatalf("failed to create validator set: %v", err)
+	}
+	system, err := NewVotingSystem(mux, signer, number, set)
+	if err != nil {
+		t.Fatalf("failed to create voting system: %v", err)
+	}
+
+	vote := func(i int, hash common.Hash) {
+		vote, err := types.SignVote(types.NewVote(number, hash, 0, types.PreVote), signer, keys[i])
+		if err != nil {
+			t.Fatalf("failed to sign vote: %v", err)
+		}
+		system.Add(vote, false)
+	}
+	block, other := common.HexToHash("0x01"), common.HexToHash("0x02")
+
+	// A quorum split over two blocks is no majority
+	vote(0, block)
+	vote(1, other)
+	vote(2, block)
+	if hash, ok := system.Majority(0, types.PreVote); ok {
+		t.Fatalf("majority for %x with a split vote", hash)
+	}
+	select {
+	case ev := <-sub.Chan():
+		t.Fatalf("majority posted with a split vote: %+v", ev.Data)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// The last vote settles it
+	vote(3, block)
+	if hash, ok := system.Majority(0, types.PreVote); !ok || hash != block {
+		t.Fatalf("majority mismatch: have %x (%v), want %x", hash, ok, block)
+	}
+	select {
+	case ev := <-sub.Chan():
+		majority := ev.Data.(core.NewMajorityEvent)
+		if majority.BlockNumber.Cmp(number) != 0 || majority.Round != 0 || majority.Type != types.PreVote {
+			t.Errorf("majority event mismatch: have %+v", majority)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("majority not posted")
+	}
+}
@@ -0,0 +1,412 @@
+package validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"runtime"
+	"time"
+
+	"github.com/kowala-tech/kUSD/accounts"
+	"github.com/kowala-tech/kUSD/common/mclock"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/event"
+	"github.com/kowala-tech/kUSD/params"
+	"github.com/kowala-tech/kUSD/rlp"
+)
+
+// Transition is a state transition of a replayed state machine.
+type Transition struct {
+	Run    int           // Index of the run of the validator in the trace
+	Time   time.Duration // Time elapsed since the start of the run
+	State  string        // Name of the state entered
+	Number uint64        // Number of the block in election
+	Round  uint64        // Round of the election
+}
+
+// Replay runs the state machine of a validator again, on a simulated clock,
+// from the trace recorded by SetTrace. Every recorded run of the validator is
+// replayed in order, calling report with each state transition.
+//
+// The consensus messages and the answers of the node are fed back at the time
+// they were recorded. Replay fails at the first divergence from the recording:
+// the state machine entering another state, sending another vote, asking the
+// node for something else or timing out when the node answered in time, and
+// the other way around.
+func Replay(trace io.Reader, report func(Transition)) error {
+	runs, err := readTrace(trace)
+	if err != nil {
+		return err
+	}
+	for i, events := range runs {
+		if err := replayRun(i, events, report); err != nil {
+			return fmt.Errorf("run %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// readTrace decodes a trace, splitting it into the runs of the validator.
+func readTrace(trace io.Reader) ([][]*traceEvent, error) {
+	var (
+		runs [][]*traceEvent
+		dec  = json.NewDecoder(trace)
+	)
+	for {
+		ev := new(traceEvent)
+		if err := dec.Decode(ev); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid trace: %v", err)
+		}
+		if ev.Kind == traceStart {
+			if ev.Address == nil || ev.ChainID == nil || ev.Wall == nil {
+				return nil, errors.New("invalid trace: incomplete start event")
+			}
+			runs = append(runs, nil)
+		}
+		if len(runs) == 0 {
+			return nil, errors.New("invalid trace: missing start event")
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], ev)
+	}
+	return runs, nil
+}
+
+// replayer is the world of a replayed state machine, checking its outputs
+// against the recorded ones.
+type replayer struct {
+	val    *validator
+	clock  *mclock.Simulated
+	origin mclock.AbsTime // Recorded time of the start of the run
+
+	inputs  []*traceEvent // Consensus messages and answers of the world
+	outputs []*traceEvent // State transitions and votes sent
+	in, out int           // Positions of the next input and output
+
+	delivered *types.Block // Block assembled from the replayed fragments, awaiting the state machine
+
+	run    int
+	report func(Transition)
+	err    error
+}
+
+// replayRun replays a single run of the validator, starting with the start
+// event.
+func replayRun(run int, events []*traceEvent, report func(Transition)) error {
+	start := events[0]
+	r := &replayer{
+		clock:  new(mclock.Simulated),
+		origin: start.Time,
+		run:    run,
+		report: report,
+	}
+	for _, ev := range events[1:] {
+		switch ev.Kind {
+		case traceState, traceSent:
+			r.outputs = append(r.outputs, ev)
+		default:
+			r.inputs = append(r.inputs, ev)
+		}
+	}
+	r.val = &validator{
+		config:        &params.ChainConfig{ChainID: start.ChainID},
+		signer:        types.NewAndromedaSigner(start.ChainID),
+		eventMux:      new(event.TypeMux),
+		clock:         r.clock,
+		epoch:         *start.Wall,
+		walletAccount: replayAccount{account: accounts.Account{Address: *start.Address}, replayer: r},
+	}
+	r.val.world, r.val.tracer = r, r
+
+	// the state machine exits its goroutine once the trace runs out
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.val.runStates()
+	}()
+	<-done
+
+	if r.err != nil {
+		return r.err
+	}
+	if left := len(r.outputs) - r.out; left > 0 {
+		return fmt.Errorf("replay stopped before %d recorded outputs, next %s", left, describeEvent(r.outputs[r.out]))
+	}
+	return nil
+}
+
+// fail stops the state machine at a divergence.
+func (r *replayer) fail(err error) {
+	r.err = fmt.Errorf("%v: %v", time.Duration(r.clock.Now()), err)
+	runtime.Goexit()
+}
+
+// advance runs the clock up to the recorded time t.
+func (r *replayer) advance(t mclock.AbsTime) {
+	if d := time.Duration(t-r.origin) - time.Duration(r.clock.Now()); d > 0 {
+		r.clock.Run(d)
+	}
+}
+
+// apply feeds a recorded consensus message to the state machine.
+func (r *replayer) apply(ev *traceEvent) {
+	var err error
+	switch ev.Kind {
+	case traceProposal:
+		proposal := new(types.Proposal)
+		if err = rlp.DecodeBytes(ev.Data, proposal); err == nil {
+			err = r.val.AddProposal(proposal)
+		}
+	case traceVote:
+		vote := new(types.Vote)
+		if err = rlp.DecodeBytes(ev.Data, vote); err == nil {
+			err = r.val.AddVote(vote)
+		}
+	case traceFragment:
+		fragment := new(types.BlockFragment)
+		if err = rlp.DecodeBytes(ev.Data, fragment); err == nil {
+			err = r.val.AddBlockFragment(new(big.Int).SetUint64(ev.Number), ev.Round, fragment)
+		}
+	}
+	if err != nil {
+		r.fail(fmt.Errorf("failed to replay %s: %v", ev.Kind, err))
+	}
+}
+
+// isMessage returns whether an event is a consensus message.
+func isMessage(ev *traceEvent) bool {
+	return ev.Kind == traceProposal || ev.Kind == traceVote || ev.Kind == traceFragment
+}
+
+// until feeds the consensus messages recorded up to time t to the state
+// machine, running the clock up to t.
+func (r *replayer) until(t mclock.AbsTime) {
+	for r.in < len(r.inputs) && isMessage(r.inputs[r.in]) && r.inputs[r.in].Time <= t {
+		ev := r.inputs[r.in]
+		r.in++
+		r.advance(ev.Time)
+		r.apply(ev)
+	}
+	r.advance(t)
+}
+
+// peek returns the next answer of the world, which must be of the given kind,
+// without feeding the messages before it.
+func (r *replayer) peek(kind string) *traceEvent {
+	for i := r.in; i < len(r.inputs); i++ {
+		if ev := r.inputs[i]; !isMessage(ev) {
+			if ev.Kind != kind {
+				r.fail(fmt.Errorf("state machine waits for %s, trace has %s", kind, ev.Kind))
+			}
+			return ev
+		}
+	}
+	runtime.Goexit()
+	return nil
+}
+
+// next returns the next answer of the world, which must be of the given kind,
+// after feeding the messages before it.
+func (r *replayer) next(kind string) *traceEvent {
+	ev := r.peek(kind)
+	r.until(ev.Time)
+	r.in++
+	return ev
+}
+
+// wait returns the next answer of the world to a wait with a timeout, along
+// with whether the timer of the state machine expired by then.
+func (r *replayer) wait(kind string, timeout time.Duration) (*traceEvent, bool) {
+	r.until(r.peek(kind).Start)
+	expired := r.clock.After(timeout)
+	ev := r.next(kind)
+	select {
+	case <-expired:
+		return ev, true
+	default:
+		return ev, false
+	}
+}
+
+// decode decodes the RLP data of an event.
+func (r *replayer) decode(ev *traceEvent, val interface{}) {
+	if err := rlp.DecodeBytes(ev.Data, val); err != nil {
+		r.fail(fmt.Errorf("invalid %s: %v", ev.Kind, err))
+	}
+}
+
+// decodeBlock decodes the block of an event, nil if there's none.
+func (r *replayer) decodeBlock(ev *traceEvent) *types.Block {
+	if len(ev.Data) == 0 {
+		return nil
+	}
+	block := new(types.Block)
+	r.decode(ev, block)
+	return block
+}
+
+// trace implements tracer, checking the outputs of the state machine against
+// the recorded ones.
+func (r *replayer) trace(ev *traceEvent) {
+	switch ev.Kind {
+	case traceState:
+		r.report(Transition{Run: r.run, Time: time.Duration(r.clock.Now()), State: ev.State, Number: ev.Number, Round: ev.Round})
+	case traceSent:
+	default:
+		return
+	}
+	if r.out == len(r.outputs) {
+		r.fail(fmt.Errorf("state machine went past the trace with %s", describeEvent(ev)))
+	}
+	want := r.outputs[r.out]
+	r.out++
+	if ev.Kind != want.Kind || ev.State != want.State || ev.Number != want.Number || ev.Round != want.Round || !bytes.Equal(ev.Data, want.Data) {
+		r.fail(fmt.Errorf("diverged with %s, trace has %s", describeEvent(ev), describeEvent(want)))
+	}
+}
+
+// describeEvent renders an output of the state machine.
+func describeEvent(ev *traceEvent) string {
+	if ev.Kind != traceSent {
+		return fmt.Sprintf("%s #%d round %d", ev.State, ev.Number, ev.Round)
+	}
+	vote := new(types.Vote)
+	if err := rlp.DecodeBytes(ev.Data, vote); err != nil {
+		return "invalid vote"
+	}
+	kind := "pre-vote"
+	if vote.Type() == types.PreCommit {
+		kind = "pre-commit"
+	}
+	return fmt.Sprintf("%s #%d round %d for %x", kind, vote.BlockNumber(), vote.Round(), vote.BlockHash())
+}
+
+func (ev *traceEvent) err() error {
+	if ev.Error == "" {
+		return nil
+	}
+	return errors.New(ev.Error)
+}
+
+func (r *replayer) currentBlock() *types.Block {
+	header := new(types.Header)
+	r.decode(r.next(traceHead), header)
+	return types.NewBlockWithHeader(header)
+}
+
+func (r *replayer) isVoter() (bool, error) {
+	ev := r.next(traceVoter)
+	return ev.OK, ev.err()
+}
+
+func (r *replayer) votersChecksum() ([32]byte, error) {
+	var checksum [32]byte
+	ev := r.next(traceChecksum)
+	copy(checksum[:], ev.Data)
+	return checksum, ev.err()
+}
+
+func (r *replayer) loadValidators() (*types.ValidatorSet, error) {
+	ev := r.next(traceValidators)
+	if err := ev.err(); err != nil {
+		return nil, err
+	}
+	var validators []traceValidator
+	r.decode(ev, &validators)
+	return decodeValidators(validators)
+}
+
+func (r *replayer) register() error {
+	return r.next(traceRegister).err()
+}
+
+func (r *replayer) createBlock() *types.Block {
+	return r.decodeBlock(r.next(traceCreated))
+}
+
+// deliver implements world, the block reaches the state machine with the
+// answer to its wait, which must be the recorded one.
+func (r *replayer) deliver(block *types.Block) {
+	r.delivered = block
+}
+
+func (r *replayer) commit(block *types.Block) error {
+	return r.next(traceCommit).err()
+}
+
+func (r *replayer) newElection(parent *types.Block) error {
+	return r.next(traceElection).err()
+}
+
+func (r *replayer) stopElection() {}
+
+// sleep implements world, the state machine computes the duration ahead of the
+// recorded start so it isn't checked.
+func (r *replayer) sleep(d time.Duration) {
+	r.next(traceSleep)
+}
+
+func (r *replayer) waitTransactions() {
+	r.next(traceTransactions)
+}
+
+func (r *replayer) waitBlock(timeout time.Duration) *types.Block {
+	ev, expired := r.wait(traceBlock, timeout)
+	block := r.decodeBlock(ev)
+	switch {
+	case block != nil && expired:
+		r.fail(fmt.Errorf("block %x arrived after the %v timeout", block.Hash(), timeout))
+	case block == nil && !expired:
+		r.fail(fmt.Errorf("block wait ended before the %v timeout", timeout))
+	}
+	delivered := r.delivered
+	r.delivered = nil
+	if block != nil && (delivered == nil || delivered.Hash() != block.Hash()) {
+		r.fail(fmt.Errorf("block %x arrived without its fragments", block.Hash()))
+	}
+	return block
+}
+
+func (r *replayer) waitMajority(voteType types.VoteType, timeout time.Duration) bool {
+	ev, expired := r.wait(traceMajority, timeout)
+	switch {
+	case ev.OK && expired:
+		r.fail(fmt.Errorf("majority reached after the %v timeout", timeout))
+	case !ev.OK && !expired:
+		r.fail(fmt.Errorf("majority wait ended before the %v timeout", timeout))
+	}
+	return ev.OK
+}
+
+// replayAccount is the account of a replayed validator. Proposals are left
+// unsigned, votes carry the signature of the recorded ones so that they count.
+type replayAccount struct {
+	accounts.Wallet
+	account  accounts.Account
+	replayer *replayer
+}
+
+func (a replayAccount) Account() accounts.Account {
+	return a.account
+}
+
+func (a replayAccount) SignProposal(account accounts.Account, proposal *types.Proposal, chainID *big.Int) (*types.Proposal, error) {
+	return proposal, nil
+}
+
+func (a replayAccount) SignVote(account accounts.Account, vote *types.Vote, chainID *big.Int) (*types.Vote, error) {
+	r := a.replayer
+	if r.out == len(r.outputs) || r.outputs[r.out].Kind != traceSent {
+		return vote, nil
+	}
+	recorded := new(types.Vote)
+	if err := rlp.DecodeBytes(r.outputs[r.out].Data, recorded); err != nil || recorded.ProtectedHash(chainID) != vote.ProtectedHash(chainID) {
+		// the divergence shows once the vote is traced
+		return vote, nil
+	}
+	return recorded, nil
+}
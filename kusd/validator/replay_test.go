@@ -0,0 +1,88 @@
+package validator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// Tests that a trace recorded by a validator of a simulated network replays
+// the way the state machine ran, from start up to the third block. The
+// validator proposes the first block and receives the others.
+func TestReplay(t *testing.T) {
+	trace, err := ioutil.ReadFile("testdata/trace.json")
+	if err != nil {
+		t.Fatalf("failed to read trace: %v", err)
+	}
+	for _, kind := range []string{"created", "proposal", "fragment"} {
+		if !bytes.Contains(trace, []byte(`"kind":"`+kind+`"`)) {
+			t.Fatalf("no %s in the trace", kind)
+		}
+	}
+	var transitions []Transition
+	if err := Replay(bytes.NewReader(trace), func(t Transition) { transitions = append(transitions, t) }); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if want := strings.Count(string(trace), `"kind":"state"`); len(transitions) != want {
+		t.Fatalf("transition count mismatch: have %d, want %d", len(transitions), want)
+	}
+	if first := transitions[0]; first.State != "notLoggedInState" || first.Time != 0 {
+		t.Errorf("first transition mismatch: have %+v", first)
+	}
+	var commits uint64
+	for i, transition := range transitions {
+		if i > 0 && transition.Time < transitions[i-1].Time {
+			t.Errorf("transition %d: time went backwards: %v < %v", i, transition.Time, transitions[i-1].Time)
+		}
+		if transition.State == "commitState" {
+			commits++
+			if transition.Number != commits {
+				t.Errorf("transition %d: commit number mismatch: have %d, want %d", i, transition.Number, commits)
+			}
+		}
+	}
+	if commits != 3 {
+		t.Errorf("commit count mismatch: have %d, want 3", commits)
+	}
+}
+
+// Tests that a replay fails once the state machine and the trace disagree, here
+// on a majority given up before the timeout.
+func TestReplayDivergence(t *testing.T) {
+	trace, err := ioutil.ReadFile("testdata/trace.json")
+	if err != nil {
+		t.Fatalf("failed to read trace: %v", err)
+	}
+	tampered := bytes.Replace(trace, []byte(`"kind":"majority","ok":true`), []byte(`"kind":"majority"`), 1)
+	if bytes.Equal(tampered, trace) {
+		t.Fatal("no majority in the trace")
+	}
+	err = Replay(bytes.NewReader(tampered), func(Transition) {})
+	if err == nil || !strings.Contains(err.Error(), "majority wait ended before") {
+		t.Fatalf("divergence mismatch: have %v", err)
+	}
+}
+
+// Tests that a replay fails once a block the validator received from the
+// proposer isn't assembled from the replayed proposal and fragments.
+func TestReplayReceivedBlock(t *testing.T) {
+	trace, err := ioutil.ReadFile("testdata/trace.json")
+	if err != nil {
+		t.Fatalf("failed to read trace: %v", err)
+	}
+	for _, kind := range []string{"proposal", "fragment"} {
+		// drop the first message of the kind received
+		lines := bytes.SplitAfter(trace, []byte("\n"))
+		for i, line := range lines {
+			if bytes.Contains(line, []byte(`"kind":"`+kind+`"`)) {
+				lines = append(lines[:i], lines[i+1:]...)
+				break
+			}
+		}
+		err := Replay(bytes.NewReader(bytes.Join(lines, nil)), func(Transition) {})
+		if err == nil || !strings.Contains(err.Error(), "arrived without its fragments") {
+			t.Errorf("%s dropped: divergence mismatch: have %v", kind, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package validator
+
+import (
+	"math/big"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/types"
+)
+
+// Step represents a step of the consensus state machine within a round
+type Step uint8
+
+const (
+	StepNewRound Step = iota
+	StepPropose
+	StepPreVote
+	StepPreCommit
+	StepCommit
+)
+
+func (step Step) String() string {
+	switch step {
+	case StepNewRound:
+		return "new round"
+	case StepPropose:
+		return "propose"
+	case StepPreVote:
+		return "pre-vote"
+	case StepPreCommit:
+		return "pre-commit"
+	case StepCommit:
+		return "commit"
+	}
+	return "unknown"
+}
+
+// RoundState is a snapshot of the progress of a validator in the current
+// election round, shared with peers so that they can send the consensus
+// messages it is missing.
+type RoundState struct {
+	BlockNumber *big.Int
+	Round       uint64
+	Step        Step
+	PreVotes    *common.BitArray // validators whose pre-vote of the round counted
+	PreCommits  *common.BitArray // validators whose pre-commit of the round counted
+	Fragments   *common.BitArray // block fragments received, nil if the proposal is unknown
+
+	// proof of lock of the proposal: pre-votes received for its locked round,
+	// nil if the proposal is unknown or doesn't carry a lock from a previous round
+	POLRound uint64
+	POL      *common.BitArray
+}
+
+// setStep updates the step of the consensus state machine
+func (val *validator) setStep(step Step) {
+	val.electionMu.Lock()
+	defer val.electionMu.Unlock()
+
+	val.step = step
+}
+
+// RoundState returns the current round state of the validator, nil if it is
+// not validating.
+func (val *validator) RoundState() *RoundState {
+	if !val.Validating() {
+		return nil
+	}
+	val.electionMu.RLock()
+	defer val.electionMu.RUnlock()
+
+	if val.votingSystem == nil {
+		return nil
+	}
+	state := &RoundState{
+		BlockNumber: new(big.Int).Set(val.blockNumber),
+		Round:       val.round,
+		Step:        val.step,
+		PreVotes:    val.votingSystem.Received(val.round, types.PreVote),
+		PreCommits:  val.votingSystem.Received(val.round, types.PreCommit),
+	}
+	if val.blockFragments != nil {
+		state.Fragments = val.blockFragments.Membership()
+	}
+	if val.proposal != nil && val.proposal.LockedRound() < val.round {
+		state.POLRound = val.proposal.LockedRound()
+		state.POL = val.votingSystem.Received(state.POLRound, types.PreVote)
+	}
+	return state
+}
+
+// MissingVotes returns the votes of the current election for the given round
+// and vote type that counted locally, but aren't set in the received bit array
+// of a remote validator.
+func (val *validator) MissingVotes(blockNumber *big.Int, round uint64, voteType types.VoteType, received *common.BitArray) types.Votes {
+	if !val.Validating() {
+		return nil
+	}
+	val.electionMu.RLock()
+	defer val.electionMu.RUnlock()
+
+	if val.votingSystem == nil || val.blockNumber.Cmp(blockNumber) != 0 {
+		return nil
+	}
+	return val.votingSystem.Missing(round, voteType, received)
+}
+
+// MissingFragments returns the block fragments of the current round proposal
+// that aren't set in the received bit array of a remote validator. If the
+// remote validator doesn't know the proposal yet (nil bit array), the proposal
+// is returned along with all the fragments known.
+func (val *validator) MissingFragments(blockNumber *big.Int, round uint64, received *common.BitArray) (*types.Proposal, []*types.BlockFragment) {
+	if !val.Validating() {
+		return nil, nil
+	}
+	val.electionMu.RLock()
+	defer val.electionMu.RUnlock()
+
+	if val.proposal == nil || val.blockFragments == nil || val.blockNumber.Cmp(blockNumber) != 0 || val.round != round {
+		return nil, nil
+	}
+	var proposal *types.Proposal
+	if received == nil {
+		proposal = val.proposal
+	}
+	return proposal, val.blockFragments.Missing(received)
+}
@@ -5,8 +5,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/kowala-tech/kUSD/accounts/abi/bind"
-	"github.com/kowala-tech/kUSD/core"
 	"github.com/kowala-tech/kUSD/core/state"
 	"github.com/kowala-tech/kUSD/core/types"
 	"github.com/kowala-tech/kUSD/log"
@@ -26,60 +24,58 @@ type work struct {
 // stateFn represents a state function
 type stateFn func() stateFn
 
+// The timeouts of the steps of a round grow with the round, so that validators
+// running apart eventually wait long enough for each other.
+func proposeTimeout(round uint64) time.Duration {
+	return time.Duration(params.ProposeDuration+round*params.ProposeDeltaDuration) * time.Millisecond
+}
+
+func preVoteTimeout(round uint64) time.Duration {
+	return time.Duration(params.PreVoteDuration+round*params.PreVoteDeltaDuration) * time.Millisecond
+}
+
+func preCommitTimeout(round uint64) time.Duration {
+	return time.Duration(params.PreCommitDuration+round*params.PreCommitDeltaDuration) * time.Millisecond
+}
+
+// roundStart returns the time a round of the election is scheduled at. The
+// rounds follow each other from the start of the election, each lasting as long
+// as its steps take to time out.
+func (val *validator) roundStart(round uint64) time.Time {
+	start := val.start
+	for r := uint64(0); r < round; r++ {
+		start = start.Add(proposeTimeout(r) + preVoteTimeout(r) + preCommitTimeout(r))
+	}
+	return start
+}
+
+// nextRound returns the round following the running one that is scheduled at
+// the given time, the next one if the validator isn't behind.
+func (val *validator) nextRound(now time.Time) uint64 {
+	round := val.round + 1
+	for !val.roundStart(round + 1).After(now) {
+		round++
+	}
+	return round
+}
+
 // @NOTE (rgeraldes) - initial state
 func (val *validator) notLoggedInState() stateFn {
-	isGenesis, err := val.network.IsGenesisVoter(&bind.CallOpts{}, val.walletAccount.Account().Address)
+	isVoter, err := val.world.isVoter()
 	if err != nil {
 		log.Crit("Failed to verify the voter information", "err", err)
 		return nil
 	}
 
-	// @NOTE (rgeraldes) - sync was already done at this point and by default the investors will be
-	// part of the initial set of validators - no need to make a deposit if the block number is 0
-	// since these validators will be marked as voters from the start
-	if !isGenesis || (isGenesis && val.chain.CurrentBlock().NumberU64() > 0) {
-		// Subscribe events from blockchain
-		chainHeadCh := make(chan core.ChainHeadEvent)
-		chainHeadSub := val.chain.SubscribeChainHeadEvent(chainHeadCh)
-		defer chainHeadSub.Unsubscribe()
-
-		log.Info("Making Deposit")
-		if err := val.makeDeposit(); err != nil {
+	// The validators of the genesis block, and the ones that deposited before a
+	// restart, are voters already
+	if !isVoter {
+		if err := val.world.register(); err != nil {
+			log.Error("Failed to register as a voter", "err", err)
 			return nil
 		}
-
-		log.Info("Waiting confirmation to participate in the consensus")
-	L:
-		for {
-			select {
-			case _, ok := <-chainHeadCh:
-				if !ok {
-					// @TODO (rgeraldes) - log
-					return nil
-				}
-
-				confirmed, err := val.network.IsVoter(&bind.CallOpts{}, val.walletAccount.Account().Address)
-				if err != nil {
-					log.Crit("Failed to verify the voter registration", "err", err)
-				}
-
-				if confirmed {
-					break L
-				}
-			}
-		}
 	} else {
-		// sanity check
-		isVoter, err := val.network.IsVoter(&bind.CallOpts{}, val.walletAccount.Account().Address)
-		if err != nil {
-			log.Crit("Failed to verify the voter information", "err", err)
-			return nil
-		}
-		if !isVoter {
-			log.Crit("Invalid genesis - genesis validator needs to be registered as a voter", "address", val.walletAccount.Account().Address)
-		}
-
-		log.Info("Deposit is not necessary for a genesis validator (first block)")
+		log.Info("Deposit is not necessary for a registered voter")
 	}
 
 	log.Info("Starting validation operation")
@@ -99,53 +95,61 @@ func (val *validator) newElectionState() stateFn {
 		return nil
 	}
 
-	<-time.NewTimer(val.start.Sub(time.Now())).C
+	val.world.sleep(val.start.Sub(val.now()))
 
 	// @NOTE (rgeraldes) - wait for txs - sync genesis validators, round zero for the first block only.
-	if val.blockNumber.Cmp(big.NewInt(1)) == 0 {
-		numTxs, _ := val.backend.TxPool().Stats() //
-		if val.round == 0 && numTxs == 0 {        //!cs.needProofBlock(height)
-			log.Info("Waiting for a TX")
-			txCh := make(chan core.TxPreEvent)
-			txSub := val.backend.TxPool().SubscribeTxPreEvent(txCh)
-			defer txSub.Unsubscribe()
-			<-txCh
-		}
+	if val.blockNumber.Cmp(big.NewInt(1)) == 0 && val.round == 0 { //!cs.needProofBlock(height)
+		val.world.waitTransactions()
+		// the first election starts with its transactions instead
+		val.start = val.now()
 	}
 
 	return val.newRoundState
 }
 
 func (val *validator) newRoundState() stateFn {
-	log.Info("Starting a new voting round", "start time", val.start, "block number", val.blockNumber, "round", val.round)
-
-	// updates the validators weight > proposer
-	val.validators.UpdateWeight()
-
-	if val.round != 0 {
-		val.round++
+	val.electionMu.Lock()
+	// a failed round is followed by the one scheduled next: validators that ran
+	// early wait for it, the ones that fell behind skip the rounds they missed
+	skipped := uint64(0)
+	if val.step != StepNewRound {
+		round := val.nextRound(val.now())
+		skipped = round - val.round - 1
+		for val.round < round {
+			val.round++
+			val.votingSystem.NewRound()
+		}
 		val.proposal = nil
 		val.block = nil
 		val.blockFragments = nil
 	}
+	val.step = StepNewRound
+	val.electionMu.Unlock()
+
+	val.world.sleep(val.roundStart(val.round).Sub(val.now()))
+	log.Info("Starting a new voting round", "start time", val.start, "block number", val.blockNumber, "round", val.round)
+
+	// updates the validators weight > proposer, the rounds skipped included
+	for i := uint64(0); i <= skipped; i++ {
+		val.validators.UpdateWeight()
+	}
 
-	//	val.votes.SetRound(val.round + 1) // also track next round (round+1) to allow round-skipping
 	return val.newProposalState
 }
 
 func (val *validator) newProposalState() stateFn {
-	timeout := time.Duration(params.ProposeDuration+val.round*params.ProposeDeltaDuration) * time.Millisecond
+	val.setStep(StepPropose)
+	timeout := proposeTimeout(val.round)
 
 	if val.isProposer() {
 		log.Info("Proposing a new block")
 		val.propose()
 	} else {
 		log.Info("Waiting for the proposal", "proposer", val.validators.Proposer())
-		select {
-		case block := <-val.blockCh:
+		if block := val.world.waitBlock(timeout); block != nil {
 			val.block = block
 			log.Info("Received the block", "hash", val.block.Hash())
-		case <-time.After(timeout):
+		} else {
 			log.Info("Timeout expired", "duration", timeout)
 		}
 	}
@@ -155,6 +159,7 @@ func (val *validator) newProposalState() stateFn {
 
 func (val *validator) preVoteState() stateFn {
 	log.Info("Pre vote sub-election")
+	val.setStep(StepPreVote)
 	val.preVote()
 
 	return val.preVoteWaitState
@@ -162,12 +167,11 @@ func (val *validator) preVoteState() stateFn {
 
 func (val *validator) preVoteWaitState() stateFn {
 	log.Info("Waiting for a majority in the pre-vote sub-election")
-	timeout := time.Duration(params.PreVoteDuration+val.round*params.PreVoteDeltaDuration) * time.Millisecond
+	timeout := preVoteTimeout(val.round)
 
-	select {
-	case <-val.majority.Chan():
+	if val.world.waitMajority(types.PreVote, timeout) {
 		log.Info("There's a majority in the pre-vote sub-election!")
-	case <-time.After(timeout):
+	} else {
 		log.Info("Timeout expired", "duration", timeout)
 	}
 
@@ -176,6 +180,7 @@ func (val *validator) preVoteWaitState() stateFn {
 
 func (val *validator) preCommitState() stateFn {
 	log.Info("Pre commit sub-election")
+	val.setStep(StepPreCommit)
 	val.preCommit()
 
 	return val.preCommitWaitState
@@ -183,68 +188,46 @@ func (val *validator) preCommitState() stateFn {
 
 func (val *validator) preCommitWaitState() stateFn {
 	log.Info("Waiting for a majority in the pre-commit sub-election")
-	timeout := time.Duration(params.PreCommitDuration+val.round+params.PreCommitDeltaDuration) * time.Millisecond
-	// @TODO (rgeraldes) - move to a post processor state
-	defer val.majority.Unsubscribe()
+	timeout := preCommitTimeout(val.round)
 
-	select {
-	case <-val.majority.Chan():
+	if val.world.waitMajority(types.PreCommit, timeout) {
 		log.Info("There's a majority in the pre-commit sub-election!")
-		if val.block == nil {
-			return val.newRoundState
-		}
-		return val.commitState
-	case <-time.After(timeout):
+	} else {
 		log.Info("Timeout expired", "duration", timeout)
-		// @TODO (rgeraldes) - confirm
+	}
+	// the block is only committed along with the pre-commits of a majority
+	if winner, ok := val.votingSystem.Majority(val.round, types.PreCommit); ok && val.block != nil && winner == val.block.Hash() {
 		return val.commitState
 	}
+	// the network may have committed the block without the validator, which
+	// then joins the next election
+	if head := val.world.currentBlock(); head.Number().Cmp(val.blockNumber) >= 0 {
+		log.Info("The block was committed by the network", "number", head.Number(), "hash", head.Hash())
+		val.world.stopElection()
+		val.lastCommit = val.votingSystem.Commit(head.Hash())
+		return val.newElectionState
+	}
+	return val.newRoundState
 }
 
 func (val *validator) commitState() stateFn {
 	log.Info("Commit state")
+	val.setStep(StepCommit)
+	// @TODO (rgeraldes) - move to a post processor state
+	val.world.stopElection()
 
-	// @TODO (rgeraldes) - replace work with unconfirmed, unjustified?
-
-	block := val.block
-	work := val.work
-	chainDb := val.backend.ChainDb()
-
-	work.state.CommitTo(chainDb, true)
-
-	// update block hash since it is now available and not when
-	// the receipt/log of individual transactions were created
-	for _, r := range val.work.receipts {
-		for _, l := range r.Logs {
-			l.BlockHash = block.Hash()
-		}
-	}
-	for _, log := range val.work.state.Logs() {
-		log.BlockHash = block.Hash()
-	}
-
-	_, err := val.chain.WriteBlockAndState(block, val.work.receipts, val.work.state)
-	if err != nil {
+	if err := val.world.commit(val.block); err != nil {
 		log.Error("Failed writing block to chain", "err", err)
 		return nil
 	}
 
-	// Broadcast the block and announce chain insertion event
-	go val.eventMux.Post(core.NewMinedBlockEvent{Block: block})
-	var (
-		events []interface{}
-		logs   = work.state.Logs()
-	)
-	events = append(events, core.ChainEvent{Block: block, Hash: block.Hash(), Logs: logs})
-	events = append(events, core.ChainHeadEvent{Block: block})
-	val.chain.PostChainEvents(events, logs)
-
 	// election state updates
 	val.commitRound = int(val.round)
+	val.lastCommit = val.votingSystem.Commit(val.block.Hash())
 
 	// @TODO(rgeraldes)
 	// leaves only when it has all the pre commits
-	voter, err := val.network.IsVoter(&bind.CallOpts{}, val.walletAccount.Account().Address)
+	voter, err := val.world.isVoter()
 	if err != nil {
 		log.Crit("Failed to verify if the validator is a voter", "err", err)
 	}
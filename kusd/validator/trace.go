@@ -0,0 +1,256 @@
+package validator
+
+import (
+	"encoding/json"
+	"io"
+	"math/big"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/common/hexutil"
+	"github.com/kowala-tech/kUSD/common/mclock"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/rlp"
+)
+
+// Kinds of the trace events. A trace starts with the identity of the validator
+// and goes on with the consensus messages it received, the answers of its world
+// to the state machine and the outputs of the state machine.
+const (
+	traceStart = "start"
+
+	// consensus messages
+	traceProposal = "proposal"
+	traceVote     = "vote"
+	traceFragment = "fragment"
+
+	// answers of the world
+	traceHead         = "head"
+	traceVoter        = "voter"
+	traceChecksum     = "checksum"
+	traceValidators   = "validators"
+	traceRegister     = "register"
+	traceCreated      = "created"
+	traceCommit       = "commit"
+	traceElection     = "election"
+	traceSleep        = "sleep"
+	traceTransactions = "transactions"
+	traceBlock        = "block"
+	traceMajority     = "majority"
+
+	// outputs of the state machine
+	traceState = "state"
+	traceSent  = "sent"
+)
+
+// traceEvent is an entry of the trace of a state machine, encoded as a line of
+// JSON.
+type traceEvent struct {
+	Time  mclock.AbsTime `json:"t"`               // Time on the clock of the state machine
+	Start mclock.AbsTime `json:"start,omitempty"` // Time the state machine started waiting
+	Kind  string         `json:"kind"`
+
+	Data   hexutil.Bytes `json:"data,omitempty"` // RLP of the message, block, header or validators
+	OK     bool          `json:"ok,omitempty"`
+	Error  string        `json:"error,omitempty"`
+	State  string        `json:"state,omitempty"`
+	Number uint64        `json:"number,omitempty"`
+	Round  uint64        `json:"round,omitempty"`
+
+	// identity of the validator, in the start event
+	Address *common.Address `json:"address,omitempty"`
+	ChainID *big.Int        `json:"chainId,omitempty"`
+	Wall    *time.Time      `json:"wall,omitempty"`
+}
+
+// newTraceEvent creates an event carrying the RLP encoding of data.
+func newTraceEvent(kind string, data interface{}) *traceEvent {
+	ev := &traceEvent{Kind: kind}
+	if v := reflect.ValueOf(data); v.Kind() != reflect.Ptr || !v.IsNil() {
+		enc, err := rlp.EncodeToBytes(data)
+		if err != nil {
+			log.Warn("Failed to encode consensus trace event", "kind", kind, "err", err)
+		}
+		ev.Data = enc
+	}
+	return ev
+}
+
+// newErrorEvent creates an event carrying the outcome of an action.
+func newErrorEvent(kind string, err error) *traceEvent {
+	ev := &traceEvent{Kind: kind}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	return ev
+}
+
+// tracer observes the inputs and outputs of a state machine.
+type tracer interface {
+	trace(ev *traceEvent)
+}
+
+// transition returns the event of the state machine entering a state.
+func (val *validator) transition(state stateFn) *traceEvent {
+	ev := &traceEvent{Kind: traceState, State: stateName(state), Round: val.round}
+	if val.blockNumber != nil {
+		ev.Number = val.blockNumber.Uint64()
+	}
+	return ev
+}
+
+// stateName returns the name of a state function, e.g. "newRoundState".
+func stateName(state stateFn) string {
+	name := runtime.FuncForPC(reflect.ValueOf(state).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// traceValidator is the encoding of a validator in the trace.
+type traceValidator struct {
+	Address   common.Address
+	Deposit   uint64
+	Signers   []common.Address
+	Threshold uint64
+}
+
+// encodeValidators returns the encoding of a validator set in the trace.
+func encodeValidators(validators *types.ValidatorSet) []traceValidator {
+	enc := make([]traceValidator, validators.Size())
+	for i := range enc {
+		validator := validators.AtIndex(i)
+		enc[i] = traceValidator{
+			Address:   validator.Address(),
+			Deposit:   validator.Deposit(),
+			Signers:   validator.Signers(),
+			Threshold: uint64(validator.Threshold()),
+		}
+	}
+	return enc
+}
+
+// decodeValidators restores a validator set from its encoding in the trace.
+func decodeValidators(enc []traceValidator) (*types.ValidatorSet, error) {
+	validators := make([]*types.Validator, len(enc))
+	for i, v := range enc {
+		validators[i] = types.NewMultisigValidator(v.Address, v.Deposit, big.NewInt(0), v.Signers, int(v.Threshold))
+	}
+	return types.NewValidatorSet(validators)
+}
+
+// recorder writes the events of a state machine as lines of JSON.
+type recorder struct {
+	clock mclock.Clock
+	enc   *json.Encoder
+	lock  sync.Mutex
+}
+
+func newRecorder(clock mclock.Clock, w io.Writer) *recorder {
+	return &recorder{clock: clock, enc: json.NewEncoder(w)}
+}
+
+// trace implements tracer, stamping the event with the current time.
+func (r *recorder) trace(ev *traceEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ev.Time = r.clock.Now()
+	if err := r.enc.Encode(ev); err != nil {
+		log.Warn("Failed to record consensus trace event", "kind", ev.Kind, "err", err)
+	}
+}
+
+// recordingWorld records the answers of a world to the state machine.
+type recordingWorld struct {
+	world
+	recorder *recorder
+}
+
+func (w recordingWorld) currentBlock() *types.Block {
+	block := w.world.currentBlock()
+	w.recorder.trace(newTraceEvent(traceHead, block.Header()))
+	return block
+}
+
+func (w recordingWorld) isVoter() (bool, error) {
+	ok, err := w.world.isVoter()
+	ev := newErrorEvent(traceVoter, err)
+	ev.OK = ok
+	w.recorder.trace(ev)
+	return ok, err
+}
+
+func (w recordingWorld) votersChecksum() ([32]byte, error) {
+	checksum, err := w.world.votersChecksum()
+	ev := newErrorEvent(traceChecksum, err)
+	ev.Data = checksum[:]
+	w.recorder.trace(ev)
+	return checksum, err
+}
+
+func (w recordingWorld) loadValidators() (*types.ValidatorSet, error) {
+	validators, err := w.world.loadValidators()
+	ev := newErrorEvent(traceValidators, err)
+	if err == nil {
+		ev.Data, _ = rlp.EncodeToBytes(encodeValidators(validators))
+	}
+	w.recorder.trace(ev)
+	return validators, err
+}
+
+func (w recordingWorld) register() error {
+	err := w.world.register()
+	w.recorder.trace(newErrorEvent(traceRegister, err))
+	return err
+}
+
+func (w recordingWorld) createBlock() *types.Block {
+	block := w.world.createBlock()
+	w.recorder.trace(newTraceEvent(traceCreated, block))
+	return block
+}
+
+func (w recordingWorld) commit(block *types.Block) error {
+	err := w.world.commit(block)
+	w.recorder.trace(newErrorEvent(traceCommit, err))
+	return err
+}
+
+func (w recordingWorld) newElection(parent *types.Block) error {
+	err := w.world.newElection(parent)
+	w.recorder.trace(newErrorEvent(traceElection, err))
+	return err
+}
+
+func (w recordingWorld) sleep(d time.Duration) {
+	ev := &traceEvent{Kind: traceSleep, Start: w.recorder.clock.Now()}
+	w.world.sleep(d)
+	w.recorder.trace(ev)
+}
+
+func (w recordingWorld) waitTransactions() {
+	ev := &traceEvent{Kind: traceTransactions, Start: w.recorder.clock.Now()}
+	w.world.waitTransactions()
+	w.recorder.trace(ev)
+}
+
+func (w recordingWorld) waitBlock(timeout time.Duration) *types.Block {
+	start := w.recorder.clock.Now()
+	block := w.world.waitBlock(timeout)
+	ev := newTraceEvent(traceBlock, block)
+	ev.Start = start
+	w.recorder.trace(ev)
+	return block
+}
+
+func (w recordingWorld) waitMajority(voteType types.VoteType, timeout time.Duration) bool {
+	ev := &traceEvent{Kind: traceMajority, Start: w.recorder.clock.Now()}
+	ev.OK = w.world.waitMajority(voteType, timeout)
+	w.recorder.trace(ev)
+	return ev.OK
+}
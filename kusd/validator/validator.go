@@ -3,9 +3,16 @@ package validator
 import (
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/kowala-tech/kUSD/accounts"
 	"github.com/kowala-tech/kUSD/accounts/abi/bind"
 	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/common/mclock"
 	"github.com/kowala-tech/kUSD/consensus"
 	"github.com/kowala-tech/kUSD/contracts/network"
 	"github.com/kowala-tech/kUSD/core"
@@ -16,10 +23,6 @@ import (
 	"github.com/kowala-tech/kUSD/kusddb"
 	"github.com/kowala-tech/kUSD/log"
 	"github.com/kowala-tech/kUSD/params"
-	"math/big"
-	"sync"
-	"sync/atomic"
-	"time"
 )
 
 var (
@@ -45,11 +48,18 @@ type Validator interface {
 	Validating() bool
 	SetCoinbase(addr common.Address) error
 	SetDeposit(deposit uint64)
+	SetClock(clock mclock.Clock)
+	SetTrace(w io.Writer)
 	Pending() (*types.Block, *state.StateDB)
 	PendingBlock() *types.Block
 	AddProposal(proposal *types.Proposal) error
 	AddVote(vote *types.Vote) error
 	AddBlockFragment(blockNumber *big.Int, round uint64, fragment *types.BlockFragment) error
+	Address() common.Address
+	SignAnnounce(announce *types.Announce) (*types.Announce, error)
+	RoundState() *RoundState
+	MissingVotes(blockNumber *big.Int, round uint64, voteType types.VoteType, received *common.BitArray) types.Votes
+	MissingFragments(blockNumber *big.Int, round uint64, received *common.BitArray) (*types.Proposal, []*types.BlockFragment)
 }
 
 // validator represents a consensus validator
@@ -61,6 +71,14 @@ type validator struct {
 	validating int32
 	deposit    uint64
 
+	clock    mclock.Clock // source of time of the state machine
+	epoch    time.Time    // wall time at epochAbs, wall times derive from the clock
+	epochAbs mclock.AbsTime
+
+	world    world     // chain, contracts and events observed by the state machine
+	tracer   tracer    // recorder of the inputs and transitions, nil if disabled
+	traceOut io.Writer // destination of the recorded traces
+
 	signer types.Signer
 
 	// blockchain
@@ -72,8 +90,13 @@ type validator struct {
 
 	network *network.NetworkContract // validators contract
 
+	lastCommit *types.Commit // pre-commits of the last block committed, carried by the next one
+
 	walletAccount accounts.WalletAccount
 
+	// election state shared with the protocol handlers
+	electionMu sync.RWMutex
+
 	// sync
 	canStart    int32 // can start indicates whether we can start the validation operation
 	shouldStart int32 // should start indicates whether we should start after sync
@@ -95,9 +118,13 @@ func New(walletAccount accounts.WalletAccount, backend Backend, contract *networ
 		eventMux:      eventMux,
 		signer:        types.NewAndromedaSigner(config.ChainID),
 		vmConfig:      vmConfig,
+		clock:         mclock.System{},
+		epoch:         time.Now(),
+		epochAbs:      mclock.Now(),
 		canStart:      0,
 		walletAccount: walletAccount,
 	}
+	validator.world = liveWorld{validator}
 
 	go validator.sync()
 
@@ -151,8 +178,31 @@ func (val *validator) run() {
 		atomic.StoreInt32(&val.running, 0)
 	}()
 
+	var (
+		observed world = liveWorld{val}
+		traced   tracer
+	)
+	if val.traceOut != nil {
+		recorder := newRecorder(val.clock, val.traceOut)
+		address, wall := val.Address(), val.now()
+		recorder.trace(&traceEvent{Kind: traceStart, Address: &address, ChainID: val.config.ChainID, Wall: &wall})
+		observed, traced = recordingWorld{observed, recorder}, recorder
+	}
+	// the protocol handlers read them from their own goroutines
+	val.electionMu.Lock()
+	val.world, val.tracer = observed, traced
+	val.electionMu.Unlock()
+
 	log.Info("Starting the consensus state machine")
+	val.runStates()
+}
+
+// runStates runs the consensus state machine until it stops.
+func (val *validator) runStates() {
 	for state, numTransitions := val.notLoggedInState, 0; state != nil; numTransitions++ {
+		if val.tracer != nil {
+			val.tracer.trace(val.transition(state))
+		}
 		state = state()
 		if val.maxTransitions > 0 && numTransitions == val.maxTransitions {
 			break
@@ -196,6 +246,34 @@ func (val *validator) SetDeposit(deposit uint64) {
 	val.deposit = deposit
 }
 
+// SetClock replaces the source of time of the state machine, which must not be
+// running yet. Wall times keep deriving from the system clock at creation.
+func (val *validator) SetClock(clock mclock.Clock) {
+	val.clock = clock
+}
+
+// SetTrace records the inputs and transitions of the state machine to w, from
+// the next time it starts, so that Replay can run it again.
+func (val *validator) SetTrace(w io.Writer) {
+	val.traceOut = w
+}
+
+// now returns the wall time of the state machine clock.
+func (val *validator) now() time.Time {
+	return val.epoch.Add(time.Duration(val.clock.Now() - val.epochAbs))
+}
+
+// Address returns the address of the account validating.
+func (val *validator) Address() common.Address {
+	return val.walletAccount.Account().Address
+}
+
+// SignAnnounce signs the announcement of the validator with the key of the
+// account validating.
+func (val *validator) SignAnnounce(announce *types.Announce) (*types.Announce, error) {
+	return val.walletAccount.SignAnnounce(val.walletAccount.Account(), announce, val.config.ChainID)
+}
+
 // Pending returns the currently pending block and associated state.
 func (val *validator) Pending() (*types.Block, *state.StateDB) {
 	// @TODO (rgeraldes) - review
@@ -219,7 +297,7 @@ func (val *validator) PendingBlock() *types.Block {
 }
 
 func (val *validator) restoreLastCommit() {
-	checksum, err := val.network.VotersChecksum(&bind.CallOpts{})
+	checksum, err := val.world.votersChecksum()
 	if err != nil {
 		log.Crit("Failed to access the voters checksum", "err", err)
 	}
@@ -230,7 +308,7 @@ func (val *validator) restoreLastCommit() {
 
 	// @TODO (rgeraldes) - we need to request the validator vote weights
 
-	currentBlock := val.chain.CurrentBlock()
+	currentBlock := val.world.currentBlock()
 	if currentBlock.Number().Cmp(big.NewInt(0)) == 0 {
 		return
 	}
@@ -254,9 +332,9 @@ func (val *validator) restoreLastCommit() {
 }
 
 func (val *validator) init() error {
-	parent := val.chain.CurrentBlock()
+	parent := val.world.currentBlock()
 
-	checksum, err := val.network.VotersChecksum(&bind.CallOpts{})
+	checksum, err := val.world.votersChecksum()
 	if err != nil {
 		log.Crit("Failed to access the voters checksum", "err", err)
 	}
@@ -271,8 +349,11 @@ func (val *validator) init() error {
 	// wait until we have transactions
 	start := time.Unix(parent.Time().Int64(), 0)
 	val.start = start.Add(time.Duration(params.BlockTime) * time.Millisecond)
+
+	val.electionMu.Lock()
 	val.blockNumber = parent.Number().Add(parent.Number(), big.NewInt(1))
 	val.round = 0
+	val.step = StepNewRound
 
 	val.proposal = nil
 	val.block = nil
@@ -283,17 +364,17 @@ func (val *validator) init() error {
 	val.commitRound = -1
 
 	// voting system
-	val.votingSystem = NewVotingSystem(val.eventMux, val.signer, val.blockNumber, val.validators)
+	val.votingSystem, err = NewVotingSystem(val.eventMux, val.signer, val.blockNumber, val.validators)
+	val.electionMu.Unlock()
+	if err != nil {
+		log.Crit("Failed to create the voting system", "err", err)
+	}
 
 	// @TODO (rgeraldes) - last validators
 	// val.lastValidators
 
 	// events
-	val.blockCh = make(chan *types.Block)
-	val.majority = val.eventMux.Subscribe(core.NewMajorityEvent{})
-
-	// @TODO (rgeraldes) - review vs go-eth
-	if err = val.makeCurrent(parent); err != nil {
+	if err = val.world.newElection(parent); err != nil {
 		log.Error("Failed to create mining context", "err", err)
 		return nil
 	}
@@ -302,7 +383,9 @@ func (val *validator) init() error {
 }
 
 func (val *validator) isProposer() bool {
-	return val.validators.Proposer() == val.walletAccount.Account().Address
+	// the account may be one of the signer keys of a multisig validator
+	validator := val.validators.GetBySigner(val.walletAccount.Account().Address)
+	return validator != nil && val.validators.Proposer() == validator.Address()
 }
 
 func (val *validator) AddProposal(proposal *types.Proposal) error {
@@ -341,8 +424,15 @@ func (val *validator) AddProposal(proposal *types.Proposal) error {
 		return
 	*/
 
+	val.electionMu.Lock()
 	val.proposal = proposal
 	val.blockFragments = types.NewDataSetFromMeta(proposal.BlockMetadata())
+	traced := val.tracer
+	val.electionMu.Unlock()
+
+	if traced != nil {
+		traced.trace(newTraceEvent(traceProposal, proposal))
+	}
 
 	return nil
 }
@@ -351,6 +441,12 @@ func (val *validator) AddVote(vote *types.Vote) error {
 	if !val.Validating() {
 		return ErrCantVoteNotValidating
 	}
+	val.electionMu.RLock()
+	traced := val.tracer
+	val.electionMu.RUnlock()
+	if traced != nil {
+		traced.trace(newTraceEvent(traceVote, vote))
+	}
 
 	if err := val.addVote(vote); err != nil {
 		switch err {
@@ -360,7 +456,13 @@ func (val *validator) AddVote(vote *types.Vote) error {
 }
 
 func (val *validator) addVote(vote *types.Vote) error {
+	val.electionMu.RLock()
+	defer val.electionMu.RUnlock()
+
 	// @NOTE (rgeraldes) - for now just pre-vote/pre-commit for the current block number
+	if val.votingSystem == nil || vote.BlockNumber().Cmp(val.blockNumber) != 0 {
+		return nil
+	}
 	added, err := val.votingSystem.Add(vote, false)
 	if err != nil {
 		// @TODO (rgeraldes)
@@ -504,15 +606,18 @@ func (val *validator) createProposalBlock() *types.Block {
 		log.Info("Picking a locked block")
 		return val.lockedBlock
 	}
-	return val.createBlock()
+	return val.world.createBlock()
 }
 
 func (val *validator) createBlock() *types.Block {
 	log.Info("Creating a new block")
 	// new block header
 	parent := val.chain.CurrentBlock()
+	if err := val.makeCurrent(parent); err != nil {
+		log.Crit("Failed to create the block state", "err", err)
+	}
 	blockNumber := parent.Number()
-	tstart := time.Now()
+	tstart := val.now()
 	tstamp := tstart.Unix()
 	if parent.Time().Cmp(new(big.Int).SetInt64(tstamp)) >= 0 {
 		tstamp = parent.Time().Int64() + 1
@@ -527,22 +632,14 @@ func (val *validator) createBlock() *types.Block {
 	}
 	val.header = header
 
+	// the genesis block isn't voted on, there's no commit to carry
 	var commit *types.Commit
-
-	// @NOTE (rgeraldes) - temporary
-	first := types.NewVote(blockNumber, parent.Hash(), 0, types.PreCommit)
-
-	if blockNumber.Cmp(big.NewInt(1)) == 0 {
-		commit = &types.Commit{
-			PreCommits:     types.Votes{first},
-			FirstPreCommit: first,
+	if parent.NumberU64() > 0 {
+		if val.lastCommit != nil && val.lastCommit.First().BlockHash() == parent.Hash() {
+			commit = val.lastCommit
+		} else {
+			log.Warn("Missing the commit of the parent block", "number", parent.Number(), "hash", parent.Hash())
 		}
-	} else {
-		commit = &types.Commit{
-			PreCommits:     types.Votes{first},
-			FirstPreCommit: first,
-		}
-		//commit = val.lastCommit.Proof()
 	}
 
 	if err := val.engine.Prepare(val.chain, header); err != nil {
@@ -590,10 +687,13 @@ func (val *validator) propose() {
 		log.Crit("Failed to sign the proposal", "err", err)
 	}
 
+	val.electionMu.Lock()
 	val.proposal = signedProposal
 	val.block = block
+	val.blockFragments = fragments
+	val.electionMu.Unlock()
 
-	val.eventMux.Post(core.NewProposalEvent{Proposal: proposal})
+	val.eventMux.Post(core.NewProposalEvent{Proposal: signedProposal})
 
 	// post block segments events
 	// @TODO(rgeraldes) - review types int/uint
@@ -626,12 +726,10 @@ func (val *validator) preVote() {
 
 func (val *validator) preCommit() {
 	var vote common.Hash
-	// access prevotes
-	winner := common.Hash{}
+	winner, polka := val.votingSystem.Majority(val.round, types.PreVote)
 	switch {
-	// no majority
-	//case !val.hasPolka():
-	// majority pre-voted nil
+	case !polka:
+		log.Debug("No majority in the pre-vote sub-election, voting nil")
 	case winner == common.Hash{}:
 		log.Debug("Majority of validators pre-voted nil")
 		// unlock locked block
@@ -639,13 +737,14 @@ func (val *validator) preCommit() {
 			val.lockedRound = 0
 			val.lockedBlock = nil
 		}
-	case winner == val.lockedBlock.Hash():
+	case val.lockedBlock != nil && winner == val.lockedBlock.Hash():
 		log.Debug("Majority of validators pre-voted the locked block")
 		// update locked block round
 		val.lockedRound = val.round
+		val.block = val.lockedBlock
 		// vote on the pre-vote election winner
 		vote = winner
-	case winner == val.block.Hash():
+	case val.block != nil && winner == val.block.Hash():
 		log.Debug("Majority of validators pre-voted the proposed block")
 		// lock block
 		val.lockedRound = val.round
@@ -674,6 +773,9 @@ func (val *validator) vote(vote *types.Vote) {
 	if err != nil {
 		log.Crit("Failed to sign the vote", "err", err)
 	}
+	if val.tracer != nil {
+		val.tracer.trace(newTraceEvent(traceSent, signedVote))
+	}
 
 	val.votingSystem.Add(signedVote, true)
 }
@@ -682,84 +784,27 @@ func (val *validator) AddBlockFragment(blockNumber *big.Int, round uint64, fragm
 	if !val.Validating() {
 		return ErrCantAddBlockFragmentNotValidating
 	}
-	val.blockFragments.Add(fragment)
+	val.electionMu.RLock()
+	blockFragments, observed, traced := val.blockFragments, val.world, val.tracer
+	val.electionMu.RUnlock()
+	if blockFragments == nil {
+		return nil
+	}
+	blockFragments.Add(fragment)
+
+	if traced != nil {
+		ev := newTraceEvent(traceFragment, fragment)
+		ev.Number, ev.Round = blockNumber.Uint64(), round
+		traced.trace(ev)
+	}
 
 	// @NOTE (rgeraldes) - the whole section needs to be refactored
-	if val.blockFragments.HasAll() {
-		block, err := val.blockFragments.Assemble()
+	if blockFragments.HasAll() {
+		block, err := blockFragments.Assemble()
 		if err != nil {
 			log.Crit("Failed to assemble the block", "err", err)
 		}
-
-		// @TODO (rgeraldes) - refactor ; based on core/blockchain.go (InsertChain)
-		// Start the parallel header verifier
-		nBlocks := 1
-		headers := make([]*types.Header, nBlocks)
-		seals := make([]bool, nBlocks)
-		headers[nBlocks-1] = block.Header()
-		seals[nBlocks-1] = true
-
-		abort, results := val.engine.VerifyHeaders(val.chain, headers, seals)
-		defer close(abort)
-
-		err = <-results
-		if err == nil {
-			err = val.chain.Validator().ValidateBody(block)
-		}
-
-		// @NOTE(rgeraldes) - ignore for now (assume that the block is ok)
-		/*
-			if err != nil {
-				if err == ErrKnownBlock {
-					stats.ignored++
-					continue
-				}
-
-				if err == consensus.ErrFutureBlock {
-					// Allow up to MaxFuture second in the future blocks. If this limit
-					// is exceeded the chain is discarded and processed at a later time
-					// if given.
-					max := big.NewInt(time.Now().Unix() + maxTimeFutureBlocks)
-					if block.Time().Cmp(max) > 0 {
-						return i, fmt.Errorf("future block: %v > %v", block.Time(), max)
-					}
-					bc.futureBlocks.Add(block.Hash(), block)
-					stats.queued++
-					continue
-				}
-
-				if err == consensus.ErrUnknownAncestor && bc.futureBlocks.Contains(block.ParentHash()) {
-					bc.futureBlocks.Add(block.Hash(), block)
-					stats.queued++
-					continue
-				}
-
-				bc.reportBlock(block, nil, err)
-				return i, err
-			}
-		*/
-		parent := val.chain.GetBlock(block.ParentHash(), block.NumberU64()-1)
-
-		// Process block using the parent state as reference point.
-		receipts, _, usedGas, err := val.chain.Processor().Process(block, val.state, val.vmConfig)
-		if err != nil {
-			log.Crit("Failed to process the block", "err", err)
-			//bc.reportBlock(block, receipts, err)
-			//return i, err
-		}
-		val.receipts = receipts
-
-		// Validate the state using the default validator
-		err = val.chain.Validator().ValidateState(block, parent, val.state, receipts, usedGas)
-		if err != nil {
-			log.Crit("Failed to validate the state", "err", err)
-			//bc.reportBlock(block, receipts, err)
-			//return i, err
-		}
-
-		val.block = block
-
-		go func() { val.blockCh <- block }()
+		observed.deliver(block)
 	}
 	return nil
 }
@@ -780,38 +825,45 @@ func (val *validator) makeCurrent(parent *types.Block) error {
 }
 
 func (val *validator) updateValidators(checksum [32]byte, genesis bool) error {
-	count, err := val.network.GetVoterCount(&bind.CallOpts{})
+	// @TODO (rgeraldes) - weight needs to be shared
+	/*
+		if !genesis && val.validators.Contains(validator.Addr) {
+			// old validator
+			old := val.validators.Get(validator.Addr)
+			weight = old.Weight()
+		} else {
+			// new validator
+			weight = big.NewInt(0)
+		}
+	*/
+	validators, err := val.world.loadValidators()
 	if err != nil {
 		return err
 	}
-
+	val.validators = validators
 	val.validatorsChecksum = checksum
+
+	return nil
+}
+
+// LoadValidators retrieves the current validator set from the network contracts.
+func LoadValidators(contract *network.NetworkContractCaller) (*types.ValidatorSet, error) {
+	count, err := contract.GetVoterCount(&bind.CallOpts{})
+	if err != nil {
+		return nil, err
+	}
+
 	validators := make([]*types.Validator, count.Uint64())
 	for i := int64(0); i < count.Int64(); i++ {
-		validator, err := val.network.GetVoterAtIndex(&bind.CallOpts{}, big.NewInt(i))
+		validator, err := contract.GetVoterAtIndex(&bind.CallOpts{}, big.NewInt(i))
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		var weight *big.Int
-		// @TODO (rgeraldes) - weight needs to be shared
-		/*
-			if !genesis && val.validators.Contains(validator.Addr) {
-				// old validator
-				old := val.validators.Get(validator.Addr)
-				weight = old.Weight()
-			} else {
-				// new validator
-				weight = big.NewInt(0)
-			}
-		*/
-		// @TODO (rgeraldes) - remove this statement as soon as the previous one is sorted out
-		weight = big.NewInt(0)
+		// @TODO (rgeraldes) - remove this statement as soon as the weights are shared
+		weight := big.NewInt(0)
 
 		validators[i] = types.NewValidator(validator.Addr, validator.Deposit.Uint64(), weight)
 	}
-	val.validators = types.NewValidatorSet(validators)
-	val.validatorsChecksum = checksum
-
-	return nil
+	return types.NewValidatorSet(validators)
 }
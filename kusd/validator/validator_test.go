@@ -0,0 +1,97 @@
+package validator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common/mclock"
+	"github.com/kowala-tech/kUSD/core/types"
+)
+
+// skewedClock is the system clock moved by a fixed offset.
+type skewedClock struct {
+	mclock.System
+	skew time.Duration
+}
+
+func (c skewedClock) Now() mclock.AbsTime {
+	return c.System.Now() + mclock.AbsTime(c.skew)
+}
+
+func newClockedValidator() *validator {
+	val := &validator{clock: mclock.System{}, epoch: time.Now(), epochAbs: mclock.Now()}
+	val.world = liveWorld{val}
+	return val
+}
+
+// Tests that the wall time of the state machine follows the clock it's given,
+// keeping the skew of the clock.
+func TestSetClockWallTime(t *testing.T) {
+	val := newClockedValidator()
+
+	skew := time.Hour
+	val.SetClock(skewedClock{skew: skew})
+
+	if diff := val.now().Sub(time.Now()) - skew; diff < -time.Second || diff > time.Second {
+		t.Errorf("wall time off by %v from the skewed clock", diff)
+	}
+}
+
+// Tests that the timeouts of the state machine expire on the clock it's given.
+func TestSetClockTimeouts(t *testing.T) {
+	val := newClockedValidator()
+
+	clock := new(mclock.Simulated)
+	val.SetClock(clock)
+	val.blockCh = make(chan *types.Block)
+
+	result := make(chan *types.Block, 1)
+	go func() { result <- val.world.waitBlock(time.Minute) }()
+
+	clock.WaitForTimers(1)
+	clock.Run(time.Minute - time.Millisecond)
+	select {
+	case <-result:
+		t.Fatal("timeout expired early")
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.Run(time.Millisecond)
+	select {
+	case block := <-result:
+		if block != nil {
+			t.Errorf("block mismatch: have %x, want none", block.Hash())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout didn't expire on the clock")
+	}
+}
+
+// Tests that a failed round is followed by the round scheduled next, skipping
+// the rounds a validator fell behind on.
+func TestNextRound(t *testing.T) {
+	val := newClockedValidator()
+	val.start = time.Now()
+
+	tests := []struct {
+		round uint64
+		now   time.Time
+		want  uint64
+	}{
+		{0, val.start.Add(time.Millisecond), 1},          // early, waits for the next round
+		{0, val.roundStart(1).Add(time.Millisecond), 1},  // overran the round by a bit
+		{0, val.roundStart(3).Add(time.Millisecond), 3},  // fell behind
+		{4, val.roundStart(2), 5},                        // ahead of the schedule
+		{1, val.roundStart(2).Add(-time.Millisecond), 2}, // just in time
+	}
+	for i, tt := range tests {
+		val.round = tt.round
+		if round := val.nextRound(tt.now); round != tt.want {
+			t.Errorf("test %d: round mismatch: have %d, want %d", i, round, tt.want)
+		}
+	}
+	for round := uint64(1); round < 5; round++ {
+		if step := val.roundStart(round).Sub(val.roundStart(round - 1)); step != proposeTimeout(round-1)+preVoteTimeout(round-1)+preCommitTimeout(round-1) {
+			t.Errorf("round %d: scheduled %v after the previous one", round, step)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/kowala-tech/kUSD"
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/contracts/network"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/state"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/core/vm/runtime"
+	"github.com/kowala-tech/kUSD/kusddb"
+	"github.com/kowala-tech/kUSD/params"
+)
+
+// stateCaller runs the calls of the contract bindings against the state of a
+// block, leaving the state untouched.
+type stateCaller struct {
+	config  *params.ChainConfig
+	header  *types.Header
+	statedb *state.StateDB
+}
+
+func (c *stateCaller) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return c.statedb.GetCode(contract), nil
+}
+
+func (c *stateCaller) CallContract(ctx context.Context, call kowala.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	ret, _, err := runtime.Call(*call.To, call.Data, &runtime.Config{
+		ChainConfig: c.config,
+		Origin:      call.From,
+		Coinbase:    c.header.Coinbase,
+		BlockNumber: c.header.Number,
+		Time:        c.header.Time,
+		State:       c.statedb.Copy(),
+	})
+	return ret, err
+}
+
+// ValidatorsAt returns the function loading the validator set registered in the
+// state of a block, the validators committing its child.
+func ValidatorsAt(config *params.ChainConfig) core.ValidatorsFn {
+	return func(header *types.Header, statedb *state.StateDB) (*types.ValidatorSet, error) {
+		contracts, err := network.GetContracts(statedb)
+		if err != nil {
+			return nil, err
+		}
+		contract, err := network.NewNetworkContractCaller(contracts.Network, &stateCaller{config, header, statedb})
+		if err != nil {
+			return nil, err
+		}
+		return LoadValidators(contract)
+	}
+}
+
+// ExportCheckpoint returns the checkpoint of a block of the chain, carrying the
+// validator set registered in its state along with the commit of its child.
+func ExportCheckpoint(config *params.ChainConfig, chain *core.BlockChain, number uint64) (*types.Checkpoint, error) {
+	block, grandchild := chain.GetBlockByNumber(number), chain.GetBlockByNumber(number+2)
+	if block == nil || grandchild == nil || grandchild.LastCommit() == nil {
+		return nil, fmt.Errorf("no block #%d with a committed child", number)
+	}
+	statedb, err := chain.StateAt(block.Root())
+	if err != nil {
+		return nil, fmt.Errorf("state of block #%d missing: %v", number, err)
+	}
+	validators, err := ValidatorsAt(config)(block.Header(), statedb)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewCheckpoint(block, validators, grandchild.LastCommit()), nil
+}
+
+// CheckpointValidators returns the function loading the validator set from the
+// state of a checkpoint block, once synchronised into db.
+func CheckpointValidators(config *params.ChainConfig, db kusddb.Database) func(*types.Header) (*types.ValidatorSet, error) {
+	return func(header *types.Header) (*types.ValidatorSet, error) {
+		statedb, err := state.New(header.Root, state.NewDatabase(db))
+		if err != nil {
+			return nil, err
+		}
+		return ValidatorsAt(config)(header, statedb)
+	}
+}
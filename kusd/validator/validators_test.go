@@ -0,0 +1,208 @@
+package validator
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/consensus/tendermint"
+	sysgenesis "github.com/kowala-tech/kUSD/contracts/network/genesis"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/core/vm"
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/event"
+	"github.com/kowala-tech/kUSD/kusd/downloader"
+	"github.com/kowala-tech/kUSD/kusddb"
+	"github.com/kowala-tech/kUSD/params"
+)
+
+// genesisVoterKey is the key of the voter registered by the network contract
+// constructor, 0xd6e579085c82329c89fca7a9f012be59028ed53f.
+var genesisVoterKey, _ = crypto.HexToECDSA("fca939d59ed3b0b69db1faffd2413ae9f6314ae2dc74a9dd2496ab7bdad066f7")
+
+// signCommit returns the commit of a block signed by the given keys.
+func signCommit(t *testing.T, block *types.Block, keys ...*ecdsa.PrivateKey) *types.Commit {
+	signer := types.NewAndromedaSigner(params.TestChainConfig.ChainID)
+	commit := new(types.Commit)
+	for _, key := range keys {
+		vote, err := types.SignVote(types.NewVote(block.Number(), block.Hash(), 0, types.PreCommit), signer, key)
+		if err != nil {
+			t.Fatalf("can't sign vote: %v", err)
+		}
+		commit.PreCommits = append(commit.PreCommits, vote)
+	}
+	commit.FirstPreCommit = commit.PreCommits[0]
+	return commit
+}
+
+// Tests that a block is only imported along with a commit of its parent signed
+// by the validators registered in the network contract.
+func TestCommitVerification(t *testing.T) {
+	config := params.TestChainConfig
+	alloc, err := sysgenesis.SystemContracts(sysgenesis.DefaultOwner)
+	if err != nil {
+		t.Fatalf("can't create system contracts: %v", err)
+	}
+	db, _ := kusddb.NewMemDatabase()
+	genesis := (&core.Genesis{Config: config, Alloc: alloc}).MustCommit(db)
+
+	blocks, _ := core.GenerateChain(config, genesis, db, 2, func(i int, b *core.BlockGen) {
+		if i > 0 {
+			b.SetLastCommit(signCommit(t, b.PrevBlock(-1), genesisVoterKey))
+		}
+	})
+
+	// A pre-commit of the voter carrying the signature of another message
+	sig, err := crypto.Sign(crypto.Keccak256([]byte("forged")), genesisVoterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := types.NewVote(blocks[1].Number(), blocks[1].Hash(), 0, types.PreCommit).WithSignature(types.NewAndromedaSigner(config.ChainID), sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outsider, _ := crypto.GenerateKey()
+	tests := []struct {
+		name   string
+		commit *types.Commit
+		valid  bool
+	}{
+		{"voter key", signCommit(t, blocks[1], genesisVoterKey), true},
+		{"outsider key", signCommit(t, blocks[1], outsider), false},
+		{"bad signature", &types.Commit{PreCommits: types.Votes{forged}, FirstPreCommit: forged}, false},
+	}
+	for _, tt := range tests {
+		db, _ := kusddb.NewMemDatabase()
+		(&core.Genesis{Config: config, Alloc: alloc}).MustCommit(db)
+		chain, err := core.NewBlockChain(db, config, tendermint.NewFaker(), vm.Config{})
+		if err != nil {
+			t.Fatalf("%s: can't create blockchain: %v", tt.name, err)
+		}
+		chain.SetValidator(core.NewCommitValidator(config, chain, chain.Engine(), ValidatorsAt(config)))
+		if _, err := chain.InsertChain(blocks); err != nil {
+			t.Fatalf("%s: can't import blocks: %v", tt.name, err)
+		}
+		child, _ := core.GenerateChain(config, blocks[1], db, 1, func(i int, b *core.BlockGen) {
+			b.SetLastCommit(tt.commit)
+		})
+		_, err = chain.InsertChain(child)
+		if tt.valid && err != nil {
+			t.Errorf("%s: block rejected: %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: block accepted", tt.name)
+		}
+		chain.Stop()
+	}
+}
+
+// Tests that a checkpoint exported from a chain fast syncs an empty node, and
+// that checkpoints carrying validators other than the ones registered in the
+// checkpoint state are rejected once the state is retrieved.
+func TestCheckpointSync(t *testing.T) {
+	config := params.TestChainConfig
+	alloc, err := sysgenesis.SystemContracts(sysgenesis.DefaultOwner)
+	if err != nil {
+		t.Fatalf("can't create system contracts: %v", err)
+	}
+	db, _ := kusddb.NewMemDatabase()
+	genesis := (&core.Genesis{Config: config, Alloc: alloc}).MustCommit(db)
+	chain, err := core.NewBlockChain(db, config, tendermint.NewFaker(), vm.Config{})
+	if err != nil {
+		t.Fatalf("can't create blockchain: %v", err)
+	}
+	defer chain.Stop()
+	chain.SetValidator(core.NewCommitValidator(config, chain, chain.Engine(), ValidatorsAt(config)))
+
+	blocks, _ := core.GenerateChain(config, genesis, db, 8, func(i int, b *core.BlockGen) {
+		if i > 0 {
+			b.SetLastCommit(signCommit(t, b.PrevBlock(-1), genesisVoterKey))
+		}
+	})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("can't import blocks: %v", err)
+	}
+	hc, err := core.NewHeaderChain(db, config, chain.Engine(), func() bool { return false })
+	if err != nil {
+		t.Fatalf("can't create header chain: %v", err)
+	}
+	// Export the checkpoint into a file and read it back
+	exported, err := ExportCheckpoint(config, chain, 3)
+	if err != nil {
+		t.Fatalf("can't export checkpoint: %v", err)
+	}
+	if len(exported.Validators) != 1 || exported.Validators[0].Address != crypto.PubkeyToAddress(genesisVoterKey.PublicKey) {
+		t.Fatalf("exported validators mismatch: have %v", exported.Validators)
+	}
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatalf("can't encode checkpoint: %v", err)
+	}
+	load := func() *types.Checkpoint {
+		cp := new(types.Checkpoint)
+		if err := json.Unmarshal(data, cp); err != nil {
+			t.Fatalf("can't decode checkpoint: %v", err)
+		}
+		return cp
+	}
+	// A forged validator set finalising the child of the checkpoint by itself
+	forger, _ := crypto.GenerateKey()
+	forged := load()
+	forged.Validators = []*types.CheckpointValidator{{
+		Address:   crypto.PubkeyToAddress(forger.PublicKey),
+		Signers:   []common.Address{crypto.PubkeyToAddress(forger.PublicKey)},
+		Threshold: 1,
+	}}
+	forged.Commit = signCommit(t, blocks[3], forger)
+
+	inline, _ := types.ParseCheckpoint(exported.String())
+
+	tests := []struct {
+		name  string
+		cp    *types.Checkpoint
+		valid bool
+	}{
+		{"file", load(), true},
+		{"inline", inline, true},
+		{"forged validators", forged, false},
+	}
+	for _, tt := range tests {
+		localDb, _ := kusddb.NewMemDatabase()
+		(&core.Genesis{Config: config, Alloc: alloc}).MustCommit(localDb)
+		local, err := core.NewBlockChain(localDb, config, tendermint.NewFaker(), vm.Config{})
+		if err != nil {
+			t.Fatalf("%s: can't create blockchain: %v", tt.name, err)
+		}
+		local.SetValidator(core.NewCommitValidator(config, local, local.Engine(), ValidatorsAt(config)))
+
+		dl := downloader.New(downloader.FastSync, localDb, new(event.TypeMux), local, nil, func(string, error) {})
+		dl.SetCheckpoint(tt.cp, types.NewAndromedaSigner(config.ChainID), CheckpointValidators(config, localDb))
+		if err := dl.RegisterPeer("peer", 1, downloader.NewFakePeer("peer", db, hc, dl)); err != nil {
+			t.Fatalf("%s: can't register peer: %v", tt.name, err)
+		}
+		head := chain.CurrentBlock()
+		err = dl.Synchronise("peer", head.Hash(), head.Number(), downloader.FastSync)
+		switch {
+		case tt.valid && err != nil:
+			t.Errorf("%s: sync failed: %v", tt.name, err)
+		case tt.valid:
+			if have := local.CurrentBlock(); have.Hash() != head.Hash() {
+				t.Errorf("%s: head mismatch: have #%d, want #%d", tt.name, have.NumberU64(), head.NumberU64())
+			}
+			if tail := local.HistoryTail(); tail == nil || tail.Hash() != exported.Hash {
+				t.Errorf("%s: history tail mismatch: have %v, want checkpoint", tt.name, tail)
+			}
+		case err == nil:
+			t.Errorf("%s: forged checkpoint accepted", tt.name)
+		case !strings.Contains(err.Error(), types.ErrCheckpointValidatorsMismatch.Error()):
+			t.Errorf("%s: error mismatch: have %v, want %v", tt.name, err, types.ErrCheckpointValidatorsMismatch)
+		case local.CurrentBlock().NumberU64() != 0:
+			t.Errorf("%s: chain anchored at rejected checkpoint", tt.name)
+		}
+		dl.Terminate()
+		local.Stop()
+	}
+}
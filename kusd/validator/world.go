@@ -0,0 +1,218 @@
+package validator
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kowala-tech/kUSD/accounts/abi/bind"
+	"github.com/kowala-tech/kUSD/consensus"
+	"github.com/kowala-tech/kUSD/core"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/log"
+)
+
+var errChainHeadClosed = errors.New("chain head subscription closed")
+
+// world is everything the consensus state machine observes besides the
+// consensus messages: the chain and network contracts it queries and the
+// events it waits for. A running validator observes its node, a replay the
+// trace recorded by one.
+type world interface {
+	// currentBlock returns the head of the chain.
+	currentBlock() *types.Block
+	// isVoter returns whether the validator is a voter.
+	isVoter() (bool, error)
+	// votersChecksum returns the checksum of the current voters.
+	votersChecksum() ([32]byte, error)
+	// loadValidators returns the current validator set.
+	loadValidators() (*types.ValidatorSet, error)
+	// register makes the deposit of the validator and waits until the network
+	// accepts it as a voter.
+	register() error
+	// createBlock creates the block to propose on top of the head of the chain.
+	createBlock() *types.Block
+	// deliver processes a block assembled from the fragments of the proposal and
+	// hands it over to the state machine.
+	deliver(block *types.Block)
+	// commit writes a block to the chain.
+	commit(block *types.Block) error
+
+	// newElection starts receiving the events of the election of the block
+	// following parent, stopElection stops it.
+	newElection(parent *types.Block) error
+	stopElection()
+
+	// sleep waits for the given duration.
+	sleep(d time.Duration)
+	// waitTransactions waits for transactions to include in the first block.
+	waitTransactions()
+	// waitBlock waits for the block of the proposal, nil if it doesn't show up
+	// in time.
+	waitBlock(timeout time.Duration) *types.Block
+	// waitMajority waits for a majority in the sub-election of the running round
+	// for the given vote type, false if there's none in time.
+	waitMajority(voteType types.VoteType, timeout time.Duration) bool
+}
+
+// liveWorld is the world of a running validator.
+type liveWorld struct {
+	*validator
+}
+
+func (w liveWorld) currentBlock() *types.Block {
+	return w.chain.CurrentBlock()
+}
+
+func (w liveWorld) isVoter() (bool, error) {
+	return w.network.IsVoter(&bind.CallOpts{}, w.walletAccount.Account().Address)
+}
+
+func (w liveWorld) votersChecksum() ([32]byte, error) {
+	return w.network.VotersChecksum(&bind.CallOpts{})
+}
+
+func (w liveWorld) loadValidators() (*types.ValidatorSet, error) {
+	return LoadValidators(&w.network.NetworkContractCaller)
+}
+
+func (w liveWorld) register() error {
+	// Subscribe events from blockchain
+	chainHeadCh := make(chan core.ChainHeadEvent)
+	chainHeadSub := w.chain.SubscribeChainHeadEvent(chainHeadCh)
+	defer chainHeadSub.Unsubscribe()
+
+	log.Info("Making Deposit")
+	if err := w.makeDeposit(); err != nil {
+		return err
+	}
+
+	log.Info("Waiting confirmation to participate in the consensus")
+	for {
+		if _, ok := <-chainHeadCh; !ok {
+			return errChainHeadClosed
+		}
+		confirmed, err := w.isVoter()
+		if err != nil {
+			log.Crit("Failed to verify the voter registration", "err", err)
+		}
+		if confirmed {
+			return nil
+		}
+	}
+}
+
+func (w liveWorld) deliver(block *types.Block) {
+	// @TODO (rgeraldes) - refactor ; based on core/blockchain.go (InsertChain)
+	// Start the parallel header verifier
+	nBlocks := 1
+	headers := make([]*types.Header, nBlocks)
+	seals := make([]bool, nBlocks)
+	headers[nBlocks-1] = block.Header()
+	seals[nBlocks-1] = true
+
+	abort, results := w.engine.VerifyHeaders(w.chain, headers, seals)
+	defer close(abort)
+
+	err := <-results
+	if err == nil {
+		err = w.chain.Validator().ValidateBody(block)
+	}
+	if err == nil {
+		err = w.process(block)
+	}
+	if err != nil {
+		// the election times out waiting for a valid block
+		log.Warn("Discarding invalid block", "number", block.Number(), "hash", block.Hash(), "err", err)
+		return
+	}
+
+	blockCh := w.blockCh
+	go func() { blockCh <- block }()
+}
+
+// process processes a block on top of the state of its parent, checking the
+// state it results in.
+func (w liveWorld) process(block *types.Block) error {
+	parent := w.chain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	statedb, err := w.chain.StateAt(parent.Root())
+	if err != nil {
+		return err
+	}
+	receipts, _, usedGas, err := w.chain.Processor().Process(block, statedb, w.vmConfig)
+	if err != nil {
+		return err
+	}
+	return w.chain.Validator().ValidateState(block, parent, statedb, receipts, usedGas)
+}
+
+func (w liveWorld) commit(block *types.Block) error {
+	// the block is processed once again on insertion, whether proposed locally
+	// or delivered, as the state of the work may belong to another round
+	if _, err := w.chain.InsertChain(types.Blocks{block}); err != nil {
+		return err
+	}
+
+	// Broadcast the block
+	go w.eventMux.Post(core.NewMinedBlockEvent{Block: block})
+
+	return nil
+}
+
+func (w liveWorld) newElection(parent *types.Block) error {
+	w.blockCh = make(chan *types.Block)
+	w.majority = w.eventMux.Subscribe(core.NewMajorityEvent{})
+
+	// @TODO (rgeraldes) - review vs go-eth
+	return w.makeCurrent(parent)
+}
+
+func (w liveWorld) stopElection() {
+	w.majority.Unsubscribe()
+}
+
+func (w liveWorld) sleep(d time.Duration) {
+	w.clock.Sleep(d)
+}
+
+func (w liveWorld) waitTransactions() {
+	txCh := make(chan core.TxPreEvent)
+	txSub := w.backend.TxPool().SubscribeTxPreEvent(txCh)
+	defer txSub.Unsubscribe()
+
+	if numTxs, _ := w.backend.TxPool().Stats(); numTxs > 0 {
+		return
+	}
+	log.Info("Waiting for a TX")
+	<-txCh
+}
+
+func (w liveWorld) waitBlock(timeout time.Duration) *types.Block {
+	select {
+	case block := <-w.blockCh:
+		return block
+	case <-w.clock.After(timeout):
+		return nil
+	}
+}
+
+func (w liveWorld) waitMajority(voteType types.VoteType, timeout time.Duration) bool {
+	expired := w.clock.After(timeout)
+	for {
+		select {
+		case ev := <-w.majority.Chan():
+			if ev == nil {
+				return false
+			}
+			// majorities of past rounds may still be queued
+			majority := ev.Data.(core.NewMajorityEvent)
+			if majority.BlockNumber.Cmp(w.blockNumber) == 0 && majority.Round == w.round && majority.Type == voteType {
+				return true
+			}
+		case <-expired:
+			return false
+		}
+	}
+}
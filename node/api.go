@@ -3,6 +3,7 @@ package node
 import (
 	"context"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
@@ -59,6 +60,78 @@ func (api *PrivateAdminAPI) RemovePeer(url string) (bool, error) {
 	return true, nil
 }
 
+// BanPeer bans a remote node, or all nodes from an IP address, from connecting
+// for the given number of seconds, or permanently if no duration is given. The
+// target may be an enode URL, a hex node ID or an IP address.
+func (api *PrivateAdminAPI) BanPeer(target string, seconds *uint64) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	var duration time.Duration
+	if seconds != nil {
+		duration = time.Duration(*seconds) * time.Second
+	}
+	id, ip, err := parseBanTarget(target)
+	if err != nil {
+		return false, err
+	}
+	if ip != nil {
+		server.BanIP(ip, duration)
+	} else {
+		server.BanNode(id, duration)
+	}
+	return true, nil
+}
+
+// UnbanPeer lifts the ban of a remote node or IP address, returning whether the
+// target was banned at all.
+func (api *PrivateAdminAPI) UnbanPeer(target string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	id, ip, err := parseBanTarget(target)
+	if err != nil {
+		return false, err
+	}
+	if ip != nil {
+		return server.UnbanIP(ip), nil
+	}
+	return server.UnbanNode(id), nil
+}
+
+// Bans retrieves the currently active node and IP address bans.
+func (api *PrivateAdminAPI) Bans() ([]*p2p.BanInfo, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.Bans(), nil
+}
+
+// parseBanTarget parses a ban target into either a node ID or an IP address.
+func parseBanTarget(target string) (discover.NodeID, net.IP, error) {
+	if ip := net.ParseIP(target); ip != nil {
+		return discover.NodeID{}, ip, nil
+	}
+	if strings.HasPrefix(target, "enode://") {
+		node, err := discover.ParseNode(target)
+		if err != nil {
+			return discover.NodeID{}, nil, fmt.Errorf("invalid enode: %v", err)
+		}
+		return node.ID, nil, nil
+	}
+	id, err := discover.HexID(target)
+	if err != nil {
+		return discover.NodeID{}, nil, fmt.Errorf("invalid ban target: %v", err)
+	}
+	return id, nil, nil
+}
+
 // PeerEvents creates an RPC subscription which receives peer events from the
 // node's p2p.Server
 func (api *PrivateAdminAPI) PeerEvents(ctx context.Context) (*rpc.Subscription, error) {
@@ -133,7 +206,7 @@ func (api *PrivateAdminAPI) StartRPC(host *string, port *int, cors *string, apis
 		}
 	}
 
-	if err := api.node.startHTTP(fmt.Sprintf("%s:%d", *host, *port), api.node.rpcAPIs, modules, allowedOrigins); err != nil {
+	if err := api.node.startHTTP(fmt.Sprintf("%s:%d", *host, *port), api.node.rpcAPIs, api.node.httpHandlers, modules, allowedOrigins); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/kowala-tech/kUSD/accounts"
+	"github.com/kowala-tech/kUSD/accounts/external"
 	"github.com/kowala-tech/kUSD/accounts/keystore"
 	"github.com/kowala-tech/kUSD/accounts/usbwallet"
 	"github.com/kowala-tech/kUSD/common"
@@ -17,6 +18,7 @@ import (
 	"github.com/kowala-tech/kUSD/log"
 	"github.com/kowala-tech/kUSD/p2p"
 	"github.com/kowala-tech/kUSD/p2p/discover"
+	"github.com/kowala-tech/kUSD/rpc"
 )
 
 const (
@@ -69,6 +71,14 @@ type Config struct {
 	// NoUSB disables hardware wallet monitoring and connectivity.
 	NoUSB bool `toml:",omitempty"`
 
+	// ExternalSigner is the endpoint (IPC path or HTTP/WS URL) of an external signer
+	// daemon holding account keys. If empty, no external signer is used.
+	ExternalSigner string `toml:",omitempty"`
+
+	// ExternalSignerToken is the bearer token (API key or JWT) authenticating
+	// the node to an external signer reached over HTTP.
+	ExternalSignerToken string `toml:",omitempty"`
+
 	// IPCPath is the requested location to place the IPC endpoint. If the path is
 	// a simple file name, it is placed inside the data directory (or on the root
 	// pipe path on Windows), whereas if it's a resolvable path name (absolute or
@@ -119,6 +129,16 @@ type Config struct {
 	// *WARNING* Only set this if the node is running in a trusted network, exposing
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
+
+	// RPCAuthFile is the JSON file holding the JWT secret and the static API keys
+	// the HTTP and websocket RPC clients need to authenticate with, along with the
+	// namespaces and methods each of them may call. Authentication is disabled if
+	// this field is empty.
+	RPCAuthFile string `toml:",omitempty"`
+
+	// RPCLimits bounds the batch length, request size, request rate and number of
+	// subscriptions of the individual HTTP and websocket RPC clients.
+	RPCLimits rpc.Limits `toml:",omitempty"`
 }
 
 // IPCEndpoint resolves an IPC endpoint based on a configured value, taking into
@@ -405,5 +425,12 @@ func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
 			backends = append(backends, trezorhub)
 		}
 	}
+	if conf.ExternalSigner != "" {
+		signer, err := external.NewExternalBackend(conf.ExternalSigner, conf.ExternalSignerToken)
+		if err != nil {
+			return nil, "", fmt.Errorf("error connecting to external signer: %v", err)
+		}
+		backends = append(backends, signer)
+	}
 	return accounts.NewManager(backends...), ephemeral, nil
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -35,8 +36,9 @@ type Node struct {
 	serviceFuncs []ServiceConstructor     // Service constructors (in dependency order)
 	services     map[reflect.Type]Service // Currently running services
 
-	rpcAPIs       []rpc.API   // List of APIs currently provided by the node
-	inprocHandler *rpc.Server // In-process RPC request handler to process the API requests
+	rpcAPIs       []rpc.API               // List of APIs currently provided by the node
+	httpHandlers  map[string]http.Handler // HTTP handlers mounted on the HTTP RPC endpoint, keyed by path
+	inprocHandler *rpc.Server             // In-process RPC request handler to process the API requests
 
 	ipcEndpoint string       // IPC endpoint to listen at (empty = IPC disabled)
 	ipcListener net.Listener // IPC RPC listener socket to serve API requests
@@ -229,8 +231,14 @@ func (n *Node) openDataDir() error {
 func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	// Gather all the possible APIs to surface
 	apis := n.apis()
+	handlers := make(map[string]http.Handler)
 	for _, service := range services {
 		apis = append(apis, service.APIs()...)
+		if service, ok := service.(HTTPService); ok {
+			for path, handler := range service.HTTPHandlers() {
+				handlers[path] = handler
+			}
+		}
 	}
 	// Start the various API endpoints, terminating all in case of errors
 	if err := n.startInProc(apis); err != nil {
@@ -240,7 +248,7 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 		n.stopInProc()
 		return err
 	}
-	if err := n.startHTTP(n.httpEndpoint, apis, n.config.HTTPModules, n.config.HTTPCors); err != nil {
+	if err := n.startHTTP(n.httpEndpoint, apis, handlers, n.config.HTTPModules, n.config.HTTPCors); err != nil {
 		n.stopIPC()
 		n.stopInProc()
 		return err
@@ -253,6 +261,7 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	}
 	// All API endpoints started successfully
 	n.rpcAPIs = apis
+	n.httpHandlers = handlers
 	return nil
 }
 
@@ -341,8 +350,9 @@ func (n *Node) stopIPC() {
 	}
 }
 
-// startHTTP initializes and starts the HTTP RPC endpoint.
-func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors []string) error {
+// startHTTP initializes and starts the HTTP RPC endpoint, mounting the given
+// HTTP handlers next to it.
+func (n *Node) startHTTP(endpoint string, apis []rpc.API, handlers map[string]http.Handler, modules []string, cors []string) error {
 	// Short circuit if the HTTP endpoint isn't being exposed
 	if endpoint == "" {
 		return nil
@@ -353,7 +363,11 @@ func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors
 		whitelist[module] = true
 	}
 	// Register all the APIs exposed by the services
-	handler := rpc.NewServer()
+	auth, err := n.loadAuthenticator()
+	if err != nil {
+		return err
+	}
+	handler := n.newExternalServer(auth)
 	for _, api := range apis {
 		if whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
@@ -363,14 +377,21 @@ func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors
 		}
 	}
 	// All APIs registered, start the HTTP listener
-	var (
-		listener net.Listener
-		err      error
-	)
+	var listener net.Listener
 	if listener, err = net.Listen("tcp", endpoint); err != nil {
 		return err
 	}
-	go rpc.NewHTTPServer(cors, handler).Serve(listener)
+	mux := http.NewServeMux()
+	mux.Handle("/", handler)
+	for path, h := range handlers {
+		if auth != nil {
+			h = auth.Protect(strings.Trim(path, "/"), h)
+		}
+		h = handler.Limit(h)
+		mux.Handle(path, h)
+		log.Debug(fmt.Sprintf("HTTP mounted %T under '%s'", h, path))
+	}
+	go (&http.Server{Handler: rpc.NewCorsHandler(mux, cors)}).Serve(listener)
 	log.Info(fmt.Sprintf("HTTP endpoint opened: http://%s", endpoint))
 
 	// All listeners booted successfully
@@ -381,6 +402,31 @@ func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors
 	return nil
 }
 
+// loadAuthenticator loads the authenticator of the network facing endpoints,
+// returning nil if no authentication file is configured.
+func (n *Node) loadAuthenticator() (*rpc.Authenticator, error) {
+	if n.config.RPCAuthFile == "" {
+		return nil, nil
+	}
+	auth, err := rpc.LoadAuthenticator(n.config.RPCAuthFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load RPC authentication: %v", err)
+	}
+	return auth, nil
+}
+
+// newExternalServer creates an RPC server for the network facing endpoints,
+// enforcing the configured client limits and requiring the clients to
+// authenticate if an authenticator is given.
+func (n *Node) newExternalServer(auth *rpc.Authenticator) *rpc.Server {
+	handler := rpc.NewServer()
+	handler.SetLimits(n.config.RPCLimits)
+	if auth != nil {
+		handler.SetAuthenticator(auth)
+	}
+	return handler
+}
+
 // stopHTTP terminates the HTTP RPC endpoint.
 func (n *Node) stopHTTP() {
 	if n.httpListener != nil {
@@ -407,7 +453,11 @@ func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrig
 		whitelist[module] = true
 	}
 	// Register all the APIs exposed by the services
-	handler := rpc.NewServer()
+	auth, err := n.loadAuthenticator()
+	if err != nil {
+		return err
+	}
+	handler := n.newExternalServer(auth)
 	for _, api := range apis {
 		if exposeAll || whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
@@ -417,10 +467,7 @@ func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrig
 		}
 	}
 	// All APIs registered, start the HTTP listener
-	var (
-		listener net.Listener
-		err      error
-	)
+	var listener net.Listener
 	if listener, err = net.Listen("tcp", endpoint); err != nil {
 		return err
 	}
@@ -477,6 +524,9 @@ func (n *Node) Stop() error {
 	n.services = nil
 	n.server = nil
 
+	// Services stop the multiplexer they share, hand a fresh one to the next run
+	n.eventmux = new(event.TypeMux)
+
 	// Release instance directory lock.
 	if n.instanceDirLock != nil {
 		if err := n.instanceDirLock.Release(); err != nil {
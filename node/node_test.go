@@ -3,12 +3,14 @@ package node
 import (
 	"errors"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/event"
 	"github.com/kowala-tech/kUSD/p2p"
 	"github.com/kowala-tech/kUSD/rpc"
 )
@@ -216,6 +218,45 @@ func TestServiceRestarts(t *testing.T) {
 	}
 }
 
+// Tests that restarted services get a working event multiplexer, even though
+// the previous run stopped the one they shared.
+func TestServiceRestartEventMux(t *testing.T) {
+	stack, err := New(testNodeConfig())
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	var muxes []*event.TypeMux
+	constructor := func(ctx *ServiceContext) (Service, error) {
+		mux := ctx.EventMux
+		muxes = append(muxes, mux)
+
+		return &InstrumentedService{stopHook: mux.Stop}, nil
+	}
+	if err := stack.Register(constructor); err != nil {
+		t.Fatalf("failed to register the service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack: %v", err)
+	}
+	defer stack.Stop()
+
+	if err := stack.Restart(); err != nil {
+		t.Fatalf("failed to restart stack: %v", err)
+	}
+	if len(muxes) != 2 || muxes[0] == muxes[1] {
+		t.Fatalf("multiplexer not replaced on restart: %v", muxes)
+	}
+	if err := muxes[0].Post(struct{}{}); err != event.ErrMuxClosed {
+		t.Errorf("stopped multiplexer error mismatch: have %v, want %v", err, event.ErrMuxClosed)
+	}
+	if err := muxes[1].Post(struct{}{}); err != nil {
+		t.Errorf("failed to post on restarted multiplexer: %v", err)
+	}
+	if stack.EventMux() != muxes[1] {
+		t.Errorf("node multiplexer mismatch: have %p, want %p", stack.EventMux(), muxes[1])
+	}
+}
+
 // Tests that if a service fails to initialize itself, none of the other services
 // will be allowed to even start.
 func TestServiceConstructionAbortion(t *testing.T) {
@@ -557,3 +598,50 @@ func TestAPIGather(t *testing.T) {
 		}
 	}
 }
+
+// httpHandlerService is a service serving a plain HTTP handler.
+type httpHandlerService struct{ NoopService }
+
+func (s *httpHandlerService) HTTPHandlers() map[string]http.Handler {
+	return map[string]http.Handler{
+		"/custom": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}),
+	}
+}
+
+// Tests that the HTTP handlers of services are mounted on the HTTP RPC endpoint.
+func TestHTTPHandlerMount(t *testing.T) {
+	config := testNodeConfig()
+	config.HTTPHost = "127.0.0.1"
+
+	stack, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	if err := stack.Register(func(*ServiceContext) (Service, error) { return new(httpHandlerService), nil }); err != nil {
+		t.Fatalf("failed to register service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack: %v", err)
+	}
+	defer stack.Stop()
+
+	url := "http://" + stack.httpListener.Addr().String()
+	res, err := http.Get(url + "/custom")
+	if err != nil {
+		t.Fatalf("failed to query mounted handler: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusTeapot {
+		t.Errorf("mounted handler status mismatch: have %d, want %d", res.StatusCode, http.StatusTeapot)
+	}
+	// Empty GET requests are health checks of the RPC handler
+	if res, err = http.Get(url); err != nil {
+		t.Fatalf("failed to query RPC handler: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("RPC handler status mismatch: have %d, want %d", res.StatusCode, http.StatusOK)
+	}
+}
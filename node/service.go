@@ -1,6 +1,7 @@
 package node
 
 import (
+	"net/http"
 	"reflect"
 
 	"github.com/kowala-tech/kUSD/accounts"
@@ -80,3 +81,15 @@ type Service interface {
 	// are all terminated.
 	Stop() error
 }
+
+// HTTPService is implemented by services serving plain HTTP handlers besides
+// their RPC APIs. The handlers are mounted on the HTTP RPC endpoint of the node
+// and are subject to its CORS and authentication configuration.
+type HTTPService interface {
+	Service
+
+	// HTTPHandlers retrieves the handlers the service serves, keyed by their path
+	// (e.g. "/graphql"). With authentication enabled, clients need to be granted
+	// the namespace named after the path.
+	HTTPHandlers() map[string]http.Handler
+}
@@ -0,0 +1,217 @@
+// Contains the capture of raw protocol messages for debugging.
+
+package p2p
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/p2p/discover"
+	"github.com/kowala-tech/kUSD/rlp"
+)
+
+// captureMagic starts every capture file, followed by a stream of RLP encoded
+// capture records.
+const captureMagic = "p2pcapture/1\n"
+
+var errNoCapture = errors.New("not a message capture file")
+
+// MsgFilter selects the messages of a protocol with the given code.
+type MsgFilter struct {
+	Protocol string
+	Code     uint64
+}
+
+// CaptureRecord is a message captured from the connection to a peer.
+type CaptureRecord struct {
+	Time     uint64          // Unix time of the capture in nanoseconds
+	Peer     discover.NodeID // Remote end of the connection
+	Inbound  bool            // Whether the message was received from the peer
+	Protocol string          // Name of the protocol the message belongs to
+	Version  uint            // Version of the protocol
+	Code     uint64          // Message code, relative to the protocol
+	Payload  []byte          // RLP encoded message content
+}
+
+// captureFileLimit is the size a capture file grows to before it's rotated, the
+// previous file being kept with a ".1" suffix.
+const captureFileLimit = 256 * 1024 * 1024
+
+// msgCapture writes the messages accepted by its filter to a capture file.
+type msgCapture struct {
+	lock   sync.Mutex
+	path   string
+	file   *os.File
+	size   int64              // bytes written to the current file
+	limit  int64              // size at which the file is rotated
+	filter map[MsgFilter]bool // nil if all messages are captured
+}
+
+// newMsgCapture creates a capture file at the given path, overwriting any file
+// there. An empty filter captures all messages.
+func newMsgCapture(path string, filter []MsgFilter) (*msgCapture, error) {
+	c := &msgCapture{path: path, limit: captureFileLimit}
+	if err := c.create(); err != nil {
+		return nil, err
+	}
+	if len(filter) > 0 {
+		c.filter = make(map[MsgFilter]bool, len(filter))
+		for _, f := range filter {
+			c.filter[f] = true
+		}
+	}
+	return c, nil
+}
+
+// create starts a new capture file.
+func (c *msgCapture) create() error {
+	file, err := os.Create(c.path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(file, captureMagic); err != nil {
+		file.Close()
+		return err
+	}
+	c.file, c.size = file, int64(len(captureMagic))
+	return nil
+}
+
+// rotate moves the capture file aside, replacing the one of an earlier rotation,
+// and starts a new one.
+func (c *msgCapture) rotate() error {
+	if err := c.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(c.path, c.path+".1"); err != nil {
+		return err
+	}
+	return c.create()
+}
+
+// wants reports whether a message of the given protocol and code is captured.
+func (c *msgCapture) wants(proto string, code uint64) bool {
+	return c.filter == nil || c.filter[MsgFilter{proto, code}]
+}
+
+// write appends a record to the capture file.
+func (c *msgCapture) write(rec *CaptureRecord) error {
+	enc, err := rlp.EncodeToBytes(rec)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.size+int64(len(enc)) > c.limit && c.size > int64(len(captureMagic)) {
+		if err := c.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := c.file.Write(enc)
+	c.size += int64(n)
+	return err
+}
+
+func (c *msgCapture) close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.file.Close()
+}
+
+// capturingMsgRW is a wrapper around the message stream of a protocol that
+// captures the messages accepted by the capture filter.
+type capturingMsgRW struct {
+	MsgReadWriter
+	capture *msgCapture
+	peer    discover.NodeID
+	proto   Protocol
+}
+
+func newCapturingMsgRW(rw MsgReadWriter, capture *msgCapture, peer discover.NodeID, proto Protocol) *capturingMsgRW {
+	return &capturingMsgRW{MsgReadWriter: rw, capture: capture, peer: peer, proto: proto}
+}
+
+// ReadMsg reads a message from the underlying stream, capturing it if the
+// filter accepts it.
+func (rw *capturingMsgRW) ReadMsg() (Msg, error) {
+	msg, err := rw.MsgReadWriter.ReadMsg()
+	if err != nil || !rw.capture.wants(rw.proto.Name, msg.Code) {
+		return msg, err
+	}
+	payload, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return msg, err
+	}
+	msg.Payload = bytes.NewReader(payload)
+	rw.write(msg.Code, payload, true)
+	return msg, nil
+}
+
+// WriteMsg writes a message to the underlying stream, capturing it if the
+// filter accepts it and the write succeeded.
+func (rw *capturingMsgRW) WriteMsg(msg Msg) error {
+	if !rw.capture.wants(rw.proto.Name, msg.Code) {
+		return rw.MsgReadWriter.WriteMsg(msg)
+	}
+	payload, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	msg.Payload = bytes.NewReader(payload)
+	if err := rw.MsgReadWriter.WriteMsg(msg); err != nil {
+		return err
+	}
+	rw.write(msg.Code, payload, false)
+	return nil
+}
+
+// write appends a message to the capture.
+func (rw *capturingMsgRW) write(code uint64, payload []byte, inbound bool) {
+	rec := &CaptureRecord{
+		Time:     uint64(time.Now().UnixNano()),
+		Peer:     rw.peer,
+		Inbound:  inbound,
+		Protocol: rw.proto.Name,
+		Version:  rw.proto.Version,
+		Code:     code,
+		Payload:  payload,
+	}
+	// Capture failures are not the fault of the peer, don't disconnect it
+	if err := rw.capture.write(rec); err != nil {
+		log.Warn("Failed to capture message", "proto", rw.proto.Name, "code", code, "err", err)
+	}
+}
+
+// CaptureReader reads the records of a message capture file.
+type CaptureReader struct {
+	stream *rlp.Stream
+}
+
+// NewCaptureReader creates a reader of the capture records in r, checking that
+// it starts with the header of a capture file.
+func NewCaptureReader(r io.Reader) (*CaptureReader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(captureMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != captureMagic {
+		return nil, errNoCapture
+	}
+	return &CaptureReader{stream: rlp.NewStream(br, 0)}, nil
+}
+
+// Next returns the next record of the capture, or io.EOF at its end.
+func (r *CaptureReader) Next() (*CaptureRecord, error) {
+	rec := new(CaptureRecord)
+	if err := r.stream.Decode(rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
@@ -0,0 +1,174 @@
+package p2p
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kowala-tech/kUSD/rlp"
+)
+
+func TestMsgCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "p2p-capture-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "capture")
+	capture, err := newMsgCapture(path, []MsgFilter{{"a", 2}, {"a", 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proto := Protocol{
+		Name:    "a",
+		Version: 3,
+		Length:  5,
+		Run: func(peer *Peer, rw MsgReadWriter) error {
+			// The payload of captured messages must still be readable
+			if err := ExpectMsg(rw, 2, []uint{1}); err != nil {
+				t.Error(err)
+			}
+			if err := ExpectMsg(rw, 3, []uint{2}); err != nil {
+				t.Error(err)
+			}
+			if err := SendItems(rw, 1, "foo"); err != nil {
+				t.Error(err)
+			}
+			return SendItems(rw, 4, "bar")
+		},
+	}
+	fd1, fd2 := net.Pipe()
+	c1 := &conn{fd: fd1, transport: newTestTransport(randomID(), fd1), caps: []Cap{proto.cap()}}
+	c2 := &conn{fd: fd2, transport: newTestTransport(randomID(), fd2), caps: []Cap{proto.cap()}}
+	defer c2.close(errors.New("test done"))
+
+	peer := newPeer(c1, []Protocol{proto})
+	peer.capture = capture
+	errc := make(chan error, 1)
+	go func() {
+		_, err := peer.run()
+		errc <- err
+	}()
+
+	Send(c2, baseProtocolLength+2, []uint{1})
+	Send(c2, baseProtocolLength+3, []uint{2})
+	if err := ExpectMsg(c2, baseProtocolLength+1, []string{"foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExpectMsg(c2, baseProtocolLength+4, []string{"bar"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-errc:
+	case <-time.After(2 * time.Second):
+		t.Fatal("protocol did not return")
+	}
+	if err := capture.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that only the filtered messages were captured
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	r, err := NewCaptureReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		inbound bool
+		code    uint64
+		payload interface{}
+	}{
+		{true, 2, []uint{1}},
+		{false, 4, []string{"bar"}},
+	}
+	for i, w := range want {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		payload, _ := rlp.EncodeToBytes(w.payload)
+		if rec.Peer != peer.ID() || rec.Protocol != "a" || rec.Version != 3 || rec.Inbound != w.inbound || rec.Code != w.code || !reflect.DeepEqual(rec.Payload, payload) {
+			t.Errorf("record %d mismatch: %+v", i, rec)
+		}
+	}
+	if rec, err := r.Next(); err != io.EOF {
+		t.Errorf("unexpected record after end: %+v, %v", rec, err)
+	}
+}
+
+func TestCaptureReaderNoCapture(t *testing.T) {
+	if _, err := NewCaptureReader(strings.NewReader("not a capture")); err != errNoCapture {
+		t.Errorf("wrong error: have %v, want %v", err, errNoCapture)
+	}
+}
+
+func TestMsgCaptureRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "p2p-capture-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "capture")
+	capture, err := newMsgCapture(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rotate the file on every second record
+	rec := &CaptureRecord{Protocol: "a", Payload: make([]byte, 100)}
+	enc, _ := rlp.EncodeToBytes(rec)
+	capture.limit = int64(len(captureMagic) + 2*len(enc))
+
+	for code := uint64(0); code < 5; code++ {
+		rec.Code = code
+		if err := capture.write(rec); err != nil {
+			t.Fatalf("record %d: %v", code, err)
+		}
+	}
+	if err := capture.close(); err != nil {
+		t.Fatal(err)
+	}
+	// The current file holds the last record, the rotated one the two before
+	for file, want := range map[string][]uint64{path: {4}, path + ".1": {2, 3}} {
+		if have := readCaptureCodes(t, file); !reflect.DeepEqual(have, want) {
+			t.Errorf("%s: codes mismatch: have %v, want %v", filepath.Base(file), have, want)
+		}
+	}
+}
+
+func readCaptureCodes(t *testing.T, path string) []uint64 {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	r, err := NewCaptureReader(file)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	var codes []uint64
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return codes
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		codes = append(codes, rec.Code)
+	}
+}
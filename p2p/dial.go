@@ -56,11 +56,15 @@ type dialstate struct {
 	maxDynDials int
 	ntab        discoverTable
 	netrestrict *netutil.Netlist
+	reputation  *reputation               // peer reputation to skip banned nodes, nil if disabled
+	filter      func(*discover.Node) bool // protocol filter on dynamic dial candidates, nil if disabled
+	dns         nodeSource                // DNS node lists, nil if disabled
 
 	lookupRunning bool
 	dialing       map[discover.NodeID]connFlag
 	lookupBuf     []*discover.Node // current discovery lookup results
 	randomNodes   []*discover.Node // filled from Table
+	dnsNodes      []*discover.Node // filled from DNS node lists
 	static        map[discover.NodeID]*dialTask
 	hist          *dialHistory
 
@@ -76,6 +80,11 @@ type discoverTable interface {
 	ReadRandomNodes([]*discover.Node) int
 }
 
+// nodeSource provides dial candidates from outside the discovery table.
+type nodeSource interface {
+	ReadRandomNodes([]*discover.Node) int
+}
+
 // the dial history remembers recent dials.
 type dialHistory []pastDial
 
@@ -120,6 +129,7 @@ func newDialState(static []*discover.Node, bootnodes []*discover.Node, ntab disc
 		dialing:     make(map[discover.NodeID]connFlag),
 		bootnodes:   make([]*discover.Node, len(bootnodes)),
 		randomNodes: make([]*discover.Node, maxdyn/2),
+		dnsNodes:    make([]*discover.Node, maxdyn/2),
 		hist:        new(dialHistory),
 	}
 	copy(s.bootnodes, bootnodes)
@@ -147,7 +157,11 @@ func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now
 
 	var newtasks []task
 	addDial := func(flag connFlag, n *discover.Node) bool {
-		if err := s.checkDial(n, peers); err != nil {
+		err := s.checkDial(n, peers)
+		if err == nil && s.filter != nil && !s.filter(n) {
+			err = errUnwantedNode
+		}
+		if err != nil {
 			log.Trace("Skipping dial candidate", "id", n.ID, "addr", &net.TCPAddr{IP: n.IP, Port: int(n.TCP)}, "err", err)
 			return false
 		}
@@ -207,6 +221,16 @@ func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now
 			}
 		}
 	}
+	// Use nodes from the DNS node lists for half of the remaining
+	// dynamic dials, leaving the rest to discovery lookups.
+	if dnsCandidates := needDynDials / 2; dnsCandidates > 0 && s.dns != nil {
+		n := s.dns.ReadRandomNodes(s.dnsNodes)
+		for i := 0; i < dnsCandidates && i < n; i++ {
+			if addDial(dynDialedConn, s.dnsNodes[i]) {
+				needDynDials--
+			}
+		}
+	}
 	// Create dynamic dials from random lookup results, removing tried
 	// items from the result buffer.
 	i := 0
@@ -239,6 +263,8 @@ var (
 	errAlreadyConnected = errors.New("already connected")
 	errRecentlyDialed   = errors.New("recently dialed")
 	errNotWhitelisted   = errors.New("not contained in netrestrict whitelist")
+	errBannedNode       = errors.New("node is banned")
+	errUnwantedNode     = errors.New("node record rejected by protocols")
 )
 
 func (s *dialstate) checkDial(n *discover.Node, peers map[discover.NodeID]*Peer) error {
@@ -254,6 +280,8 @@ func (s *dialstate) checkDial(n *discover.Node, peers map[discover.NodeID]*Peer)
 		return errNotWhitelisted
 	case s.hist.contains(n.ID):
 		return errRecentlyDialed
+	case s.reputation != nil && s.reputation.banned(n.ID, n.IP, time.Now()):
+		return errBannedNode
 	}
 	return nil
 }
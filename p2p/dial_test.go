@@ -416,6 +416,63 @@ func TestDialStateNetRestrict(t *testing.T) {
 	})
 }
 
+// This test checks that dynamic candidates rejected by the protocol filter are
+// not dialed.
+func TestDialStateFilter(t *testing.T) {
+	table := fakeTable{
+		{ID: uintID(1), IP: net.ParseIP("127.0.0.1")},
+		{ID: uintID(2), IP: net.ParseIP("127.0.0.2")},
+		{ID: uintID(3), IP: net.ParseIP("127.0.0.3")},
+		{ID: uintID(4), IP: net.ParseIP("127.0.0.4")},
+		{ID: uintID(5), IP: net.ParseIP("127.0.0.5")},
+	}
+	dialer := newDialState(nil, nil, table, 10, nil)
+	dialer.filter = func(n *discover.Node) bool {
+		return binary.BigEndian.Uint32(n.ID[:])%2 == 0
+	}
+	runDialTest(t, dialtest{
+		init: dialer,
+		rounds: []round{
+			{
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: table[1]},
+					&dialTask{flags: dynDialedConn, dest: table[3]},
+					&discoverTask{},
+				},
+			},
+		},
+	})
+}
+
+// This test checks that nodes from DNS node lists are used as dynamic dial
+// candidates when the table is empty.
+func TestDialStateDNS(t *testing.T) {
+	lists := fakeTable{
+		{ID: uintID(1), IP: net.ParseIP("127.0.0.1")},
+		{ID: uintID(2), IP: net.ParseIP("127.0.0.2")},
+		{ID: uintID(3), IP: net.ParseIP("127.0.0.3")},
+	}
+	dialer := newDialState(nil, nil, fakeTable{}, 10, nil)
+	dialer.dns = lists
+	runDialTest(t, dialtest{
+		init: dialer,
+		rounds: []round{
+			{
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: lists[0]},
+					&dialTask{flags: dynDialedConn, dest: lists[1]},
+					&dialTask{flags: dynDialedConn, dest: lists[2]},
+					&discoverTask{},
+				},
+			},
+			// Nodes already being dialed are not dialed again.
+			{
+				new: []task{},
+			},
+		},
+	})
+}
+
 // This test checks that static dials are launched.
 func TestDialStateStaticDial(t *testing.T) {
 	wantStatic := []*discover.Node{
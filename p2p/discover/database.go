@@ -40,6 +40,7 @@ type nodeDB struct {
 var (
 	nodeDBVersionKey = []byte("version") // Version of the database to flush if changes
 	nodeDBItemPrefix = []byte("n:")      // Identifier to prefix node entries with
+	nodeDBBanPrefix  = []byte("b:")      // Identifier to prefix peer bans with
 
 	nodeDBDiscoverRoot      = ":discover"
 	nodeDBDiscoverPing      = nodeDBDiscoverRoot + ":lastping"
@@ -282,6 +283,43 @@ func (db *nodeDB) updateFindFails(id NodeID, fails int) error {
 	return db.storeInt64(makeKey(id, nodeDBDiscoverFindFails), int64(fails))
 }
 
+// bans retrieves all the peer bans stored in the database, mapping the banned
+// target to the expiry of the ban. Permanent bans have a zero expiry.
+func (db *nodeDB) bans() map[string]time.Time {
+	it := db.lvl.NewIterator(util.BytesPrefix(nodeDBBanPrefix), nil)
+	defer it.Release()
+
+	bans := make(map[string]time.Time)
+	for it.Next() {
+		expiry, read := binary.Varint(it.Value())
+		if read <= 0 {
+			continue
+		}
+		target := string(it.Key()[len(nodeDBBanPrefix):])
+		if expiry == 0 {
+			bans[target] = time.Time{}
+		} else {
+			bans[target] = time.Unix(expiry, 0)
+		}
+	}
+	return bans
+}
+
+// storeBan persists a peer ban until the given expiry, or forever if the expiry
+// is the zero time.
+func (db *nodeDB) storeBan(target string, expiry time.Time) error {
+	var n int64
+	if !expiry.IsZero() {
+		n = expiry.Unix()
+	}
+	return db.storeInt64(append(nodeDBBanPrefix, target...), n)
+}
+
+// deleteBan removes a peer ban from the database.
+func (db *nodeDB) deleteBan(target string) error {
+	return db.lvl.Delete(append(nodeDBBanPrefix, target...), nil)
+}
+
 // querySeeds retrieves random nodes to be used as potential seed nodes
 // for bootstrapping.
 func (db *nodeDB) querySeeds(n int, maxAge time.Duration) []*Node {
@@ -362,3 +362,31 @@ func TestNodeDBSelfExpiration(t *testing.T) {
 		t.Errorf("self not evacuated")
 	}
 }
+
+func TestNodeDBBans(t *testing.T) {
+	db, _ := newNodeDB("", Version, NodeID{})
+	defer db.close()
+
+	expiry := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	if err := db.storeBan("ip:10.0.0.1", expiry); err != nil {
+		t.Fatalf("failed to store temporary ban: %v", err)
+	}
+	if err := db.storeBan("node:0102", time.Time{}); err != nil {
+		t.Fatalf("failed to store permanent ban: %v", err)
+	}
+	// Bans must survive node expiration
+	if err := db.expireNodes(); err != nil {
+		t.Fatalf("failed to expire nodes: %v", err)
+	}
+	want := map[string]time.Time{"ip:10.0.0.1": expiry, "node:0102": {}}
+	if bans := db.bans(); !reflect.DeepEqual(bans, want) {
+		t.Errorf("bans mismatch: have %v, want %v", bans, want)
+	}
+	if err := db.deleteBan("ip:10.0.0.1"); err != nil {
+		t.Fatalf("failed to delete ban: %v", err)
+	}
+	want = map[string]time.Time{"node:0102": {}}
+	if bans := db.bans(); !reflect.DeepEqual(bans, want) {
+		t.Errorf("bans mismatch after delete: have %v, want %v", bans, want)
+	}
+}
@@ -0,0 +1,130 @@
+// Contains the node record tracking of the discovery table, publishing the
+// signed record of the local node and retrieving the records of remote ones.
+
+package discover
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"net"
+
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/p2p/enr"
+)
+
+var errNoSigner = errors.New("no key to sign the local node record")
+
+// LocalRecord returns a copy of the signed record of the local node, or nil if
+// the table doesn't publish one.
+func (tab *Table) LocalRecord() *enr.Record {
+	tab.recordmu.Lock()
+	defer tab.recordmu.Unlock()
+
+	if tab.record == nil {
+		return nil
+	}
+	record := *tab.record
+	return &record
+}
+
+// SetRecordEntries adds or updates entries in the record of the local node,
+// bumping its sequence number and signing it anew. Remote nodes retrieve the
+// new record the next time they exchange pings with the local node.
+func (tab *Table) SetRecordEntries(entries ...enr.Entry) error {
+	tab.recordmu.Lock()
+	defer tab.recordmu.Unlock()
+
+	if tab.priv == nil {
+		return errNoSigner
+	}
+	var record enr.Record
+	if tab.record != nil {
+		record = *tab.record
+	}
+	for _, entry := range entries {
+		record.Set(entry)
+	}
+	if err := enr.SignV4(&record, tab.priv); err != nil {
+		return err
+	}
+	tab.record = &record
+	return nil
+}
+
+// localSeq returns the sequence number of the local node record.
+func (tab *Table) localSeq() uint64 {
+	tab.recordmu.Lock()
+	defer tab.recordmu.Unlock()
+
+	if tab.record == nil {
+		return 0
+	}
+	return tab.record.Seq()
+}
+
+// Record returns the last known record of a remote node, or nil if the node
+// didn't publish one.
+func (tab *Table) Record(id NodeID) *enr.Record {
+	tab.recordmu.Lock()
+	defer tab.recordmu.Unlock()
+
+	return tab.records[id]
+}
+
+// recordSeq returns the sequence number of the last known record of a remote
+// node, zero if none is known.
+func (tab *Table) recordSeq(id NodeID) uint64 {
+	if record := tab.Record(id); record != nil {
+		return record.Seq()
+	}
+	return 0
+}
+
+// updateRecord retrieves the record of a remote node which advertised the given
+// sequence number, storing it if it's newer than the known one.
+func (tab *Table) updateRecord(id NodeID, addr *net.UDPAddr, seq uint64) {
+	record, err := tab.net.requestENR(id, addr)
+	if err != nil {
+		log.Trace("Node record retrieval failed", "id", id, "addr", addr, "seq", seq, "err", err)
+		return
+	}
+	tab.recordmu.Lock()
+	defer tab.recordmu.Unlock()
+
+	if known := tab.records[id]; known != nil && known.Seq() >= record.Seq() {
+		return
+	}
+	tab.records[id] = record
+}
+
+// deleteRecord forgets the record of a remote node.
+func (tab *Table) deleteRecord(id NodeID) {
+	tab.recordmu.Lock()
+	defer tab.recordmu.Unlock()
+
+	delete(tab.records, id)
+}
+
+// NodeFromRecord creates a node from the public key and endpoint published in
+// a node record. The UDP port is optional as not all nodes run discovery.
+func NodeFromRecord(record *enr.Record) (*Node, error) {
+	var (
+		pubkey enr.Secp256k1
+		ip     enr.IP
+		udp    enr.UDP
+		tcp    enr.TCP
+	)
+	if err := record.Load(&pubkey); err != nil {
+		return nil, err
+	}
+	if err := record.Load(&ip); err != nil {
+		return nil, err
+	}
+	if err := record.Load(&tcp); err != nil {
+		return nil, err
+	}
+	if err := record.Load(&udp); err != nil && !enr.IsNotFound(err) {
+		return nil, err
+	}
+	return NewNode(PubkeyID((*ecdsa.PublicKey)(&pubkey)), net.IP(ip), uint16(udp), uint16(tcp)), nil
+}
@@ -7,6 +7,7 @@
 package discover
 
 import (
+	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/binary"
 	"errors"
@@ -19,6 +20,7 @@ import (
 	"github.com/kowala-tech/kUSD/common"
 	"github.com/kowala-tech/kUSD/crypto"
 	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/p2p/enr"
 )
 
 const (
@@ -40,6 +42,7 @@ type Table struct {
 	buckets [nBuckets]*bucket // index of known nodes by distance
 	nursery []*Node           // bootstrap nodes
 	db      *nodeDB           // database of known nodes
+	hidden  map[NodeID]bool   // nodes never added to the table, so they are never disclosed
 
 	refreshReq chan chan struct{}
 	closeReq   chan struct{}
@@ -53,6 +56,11 @@ type Table struct {
 
 	net  transport
 	self *Node // metadata of the local node
+
+	recordmu sync.Mutex
+	priv     *ecdsa.PrivateKey      // key signing the local node record, nil if not publishing one
+	record   *enr.Record            // signed record of the local node
+	records  map[NodeID]*enr.Record // last known records of remote nodes
 }
 
 type bondproc struct {
@@ -65,9 +73,10 @@ type bondproc struct {
 // it is an interface so we can test without opening lots of UDP
 // sockets and without generating a private key.
 type transport interface {
-	ping(NodeID, *net.UDPAddr) error
+	ping(NodeID, *net.UDPAddr) (uint64, error)
 	waitping(NodeID) error
 	findnode(toid NodeID, addr *net.UDPAddr, target NodeID) ([]*Node, error)
+	requestENR(NodeID, *net.UDPAddr) (*enr.Record, error)
 	close()
 }
 
@@ -86,6 +95,7 @@ func newTable(t transport, ourID NodeID, ourAddr *net.UDPAddr, nodeDBPath string
 		db:         db,
 		self:       NewNode(ourID, ourAddr.IP, uint16(ourAddr.Port), uint16(ourAddr.Port)),
 		bonding:    make(map[NodeID]*bondproc),
+		records:    make(map[NodeID]*enr.Record),
 		bondslots:  make(chan struct{}, maxBondingPingPongs),
 		refreshReq: make(chan chan struct{}),
 		closeReq:   make(chan struct{}),
@@ -107,6 +117,43 @@ func (tab *Table) Self() *Node {
 	return tab.self
 }
 
+// Bans returns the peer bans persisted in the node database, keyed by banned
+// target. Permanent bans have a zero expiry.
+func (tab *Table) Bans() map[string]time.Time {
+	return tab.db.bans()
+}
+
+// StoreBan persists a peer ban in the node database.
+func (tab *Table) StoreBan(target string, expiry time.Time) error {
+	return tab.db.storeBan(target, expiry)
+}
+
+// DeleteBan removes a peer ban from the node database.
+func (tab *Table) DeleteBan(target string) error {
+	return tab.db.deleteBan(target)
+}
+
+// SetHidden marks the given nodes as hidden. Hidden nodes are dropped from the
+// table and never added again, so they are not disclosed to other nodes.
+func (tab *Table) SetHidden(ids []NodeID) {
+	tab.mutex.Lock()
+	defer tab.mutex.Unlock()
+
+	tab.hidden = make(map[NodeID]bool, len(ids))
+	for _, id := range ids {
+		tab.hidden[id] = true
+	}
+	for _, b := range tab.buckets {
+		entries := b.entries[:0]
+		for _, n := range b.entries {
+			if !tab.hidden[n.ID] {
+				entries = append(entries, n)
+			}
+		}
+		b.entries = entries
+	}
+}
+
 // ReadRandomNodes fills the given slice with random nodes from the
 // table. It will not write the same node more than once. The nodes in
 // the slice are copies and can be modified by the caller.
@@ -494,7 +541,8 @@ func (tab *Table) pingpong(w *bondproc, pinged bool, id NodeID, addr *net.UDPAdd
 	defer func() { tab.bondslots <- struct{}{} }()
 
 	// Ping the remote side and wait for a pong.
-	if w.err = tab.ping(id, addr); w.err != nil {
+	seq, err := tab.ping(id, addr)
+	if w.err = err; w.err != nil {
 		close(w.done)
 		return
 	}
@@ -508,14 +556,21 @@ func (tab *Table) pingpong(w *bondproc, pinged bool, id NodeID, addr *net.UDPAdd
 	w.n = NewNode(id, addr.IP, uint16(addr.Port), tcpPort)
 	tab.db.updateNode(w.n)
 	close(w.done)
+
+	// Retrieve the node record if the remote side advertised a new one
+	if seq > tab.recordSeq(id) {
+		go tab.updateRecord(id, addr, seq)
+	}
 }
 
 // ping a remote endpoint and wait for a reply, also updating the node
-// database accordingly.
-func (tab *Table) ping(id NodeID, addr *net.UDPAddr) error {
+// database accordingly. The node record sequence number advertised by the
+// remote side is returned.
+func (tab *Table) ping(id NodeID, addr *net.UDPAddr) (uint64, error) {
 	tab.db.updateLastPing(id, time.Now())
-	if err := tab.net.ping(id, addr); err != nil {
-		return err
+	seq, err := tab.net.ping(id, addr)
+	if err != nil {
+		return 0, err
 	}
 	tab.db.updateLastPong(id, time.Now())
 
@@ -525,7 +580,7 @@ func (tab *Table) ping(id NodeID, addr *net.UDPAddr) error {
 	// so that the search for seed nodes also considers older nodes
 	// that would otherwise be removed by the expiration.
 	tab.db.ensureExpirer()
-	return nil
+	return seq, nil
 }
 
 // add attempts to add the given node its corresponding bucket. If the
@@ -538,6 +593,9 @@ func (tab *Table) add(new *Node) {
 	b := tab.buckets[logdist(tab.self.sha, new.sha)]
 	tab.mutex.Lock()
 	defer tab.mutex.Unlock()
+	if tab.hidden[new.ID] {
+		return
+	}
 	if b.bump(new) {
 		return
 	}
@@ -553,11 +611,14 @@ func (tab *Table) add(new *Node) {
 		// Let go of the mutex so other goroutines can access
 		// the table while we ping the least recently active node.
 		tab.mutex.Unlock()
-		err := tab.ping(oldest.ID, oldest.addr())
+		seq, err := tab.ping(oldest.ID, oldest.addr())
 		tab.mutex.Lock()
 		oldest.contested = false
 		if err == nil {
 			// The node responded, don't replace it.
+			if seq > tab.recordSeq(oldest.ID) {
+				go tab.updateRecord(oldest.ID, oldest.addr(), seq)
+			}
 			return
 		}
 	}
@@ -575,6 +636,9 @@ outer:
 		if n.ID == tab.self.ID {
 			continue // don't add self
 		}
+		if tab.hidden[n.ID] {
+			continue // don't add hidden nodes
+		}
 		bucket := tab.buckets[logdist(tab.self.sha, n.sha)]
 		for i := range bucket.entries {
 			if bucket.entries[i].ID == n.ID {
@@ -599,6 +663,7 @@ func (tab *Table) delete(node *Node) {
 	for i := range bucket.entries {
 		if bucket.entries[i].ID == node.ID {
 			bucket.entries = append(bucket.entries[:i], bucket.entries[i+1:]...)
+			tab.deleteRecord(node.ID)
 			return
 		}
 	}
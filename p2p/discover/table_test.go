@@ -13,6 +13,7 @@ import (
 
 	"github.com/kowala-tech/kUSD/common"
 	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/p2p/enr"
 )
 
 func TestTable_pingReplace(t *testing.T) {
@@ -148,14 +149,17 @@ func (t *pingRecorder) close() {}
 func (t *pingRecorder) waitping(from NodeID) error {
 	return nil // remote always pings
 }
-func (t *pingRecorder) ping(toid NodeID, toaddr *net.UDPAddr) error {
+func (t *pingRecorder) ping(toid NodeID, toaddr *net.UDPAddr) (uint64, error) {
 	t.pinged[toid] = true
 	if t.responding[toid] {
-		return nil
+		return 0, nil
 	} else {
-		return errTimeout
+		return 0, errTimeout
 	}
 }
+func (t *pingRecorder) requestENR(toid NodeID, toaddr *net.UDPAddr) (*enr.Record, error) {
+	panic("requestENR called on pingRecorder")
+}
 
 func TestTable_closest(t *testing.T) {
 	t.Parallel()
@@ -243,6 +247,28 @@ func TestTable_ReadRandomNodesGetAll(t *testing.T) {
 	}
 }
 
+func TestTable_SetHidden(t *testing.T) {
+	tab, _ := newTable(nil, NodeID{}, &net.UDPAddr{}, "")
+	defer tab.Close()
+
+	visible, hidden := nodeAtDistance(tab.self.sha, 200), nodeAtDistance(tab.self.sha, 201)
+	visible.ID, hidden.ID = NodeID{1}, NodeID{2}
+	tab.stuff([]*Node{visible, hidden})
+
+	tab.SetHidden([]NodeID{hidden.ID})
+	if n := tab.len(); n != 1 {
+		t.Fatalf("table size mismatch after hiding: have %d, want %d", n, 1)
+	}
+	tab.stuff([]*Node{hidden})
+	if n := tab.len(); n != 1 {
+		t.Errorf("hidden node re-added to the table")
+	}
+	buf := make([]*Node, 2)
+	if n := tab.ReadRandomNodes(buf); n != 1 || buf[0].ID != visible.ID {
+		t.Errorf("random nodes mismatch: have %v, want %v", buf[:n], visible)
+	}
+}
+
 type closeTest struct {
 	Self   NodeID
 	Target common.Hash
@@ -507,9 +533,12 @@ func (tn *preminedTestnet) findnode(toid NodeID, toaddr *net.UDPAddr, target Nod
 	return result, nil
 }
 
-func (*preminedTestnet) close()                                      {}
-func (*preminedTestnet) waitping(from NodeID) error                  { return nil }
-func (*preminedTestnet) ping(toid NodeID, toaddr *net.UDPAddr) error { return nil }
+func (*preminedTestnet) close()                                                {}
+func (*preminedTestnet) waitping(from NodeID) error                            { return nil }
+func (*preminedTestnet) ping(toid NodeID, toaddr *net.UDPAddr) (uint64, error) { return 0, nil }
+func (*preminedTestnet) requestENR(toid NodeID, toaddr *net.UDPAddr) (*enr.Record, error) {
+	return nil, errTimeout
+}
 
 // mine generates a testnet struct literal with nodes at
 // various distances to the given target.
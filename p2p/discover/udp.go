@@ -11,6 +11,7 @@ import (
 
 	"github.com/kowala-tech/kUSD/crypto"
 	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/p2p/enr"
 	"github.com/kowala-tech/kUSD/p2p/nat"
 	"github.com/kowala-tech/kUSD/p2p/netutil"
 	"github.com/kowala-tech/kUSD/rlp"
@@ -28,6 +29,7 @@ var (
 	errTimeout          = errors.New("RPC timeout")
 	errClockWarp        = errors.New("reply deadline too far in the future")
 	errClosed           = errors.New("socket closed")
+	errNoRecord         = errors.New("no local node record")
 )
 
 // Timeouts
@@ -47,6 +49,8 @@ const (
 	pongPacket
 	findnodePacket
 	neighborsPacket
+	enrRequestPacket
+	enrResponsePacket
 )
 
 // RPC request structures
@@ -55,7 +59,8 @@ type (
 		Version    uint
 		From, To   rpcEndpoint
 		Expiration uint64
-		// Ignore additional fields (for forward compatibility).
+		// The first additional field carries the sender's node record sequence
+		// number, others are ignored (for forward compatibility).
 		Rest []rlp.RawValue `rlp:"tail"`
 	}
 
@@ -68,7 +73,8 @@ type (
 
 		ReplyTok   []byte // This contains the hash of the ping packet.
 		Expiration uint64 // Absolute timestamp at which the packet becomes invalid.
-		// Ignore additional fields (for forward compatibility).
+		// The first additional field carries the sender's node record sequence
+		// number, others are ignored (for forward compatibility).
 		Rest []rlp.RawValue `rlp:"tail"`
 	}
 
@@ -88,6 +94,21 @@ type (
 		Rest []rlp.RawValue `rlp:"tail"`
 	}
 
+	// enrRequest is a query for the sender's node record.
+	enrRequest struct {
+		Expiration uint64
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// reply to enrRequest
+	enrResponse struct {
+		ReplyTok []byte // This contains the hash of the enrRequest packet.
+		Record   enr.Record
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
 	rpcNode struct {
 		IP  net.IP // len 4 for IPv4 or 16 for IPv6
 		UDP uint16 // for discovery protocol
@@ -125,6 +146,23 @@ func (t *udp) nodeFromRPC(sender *net.UDPAddr, rn rpcNode) (*Node, error) {
 	return n, err
 }
 
+// seqToRPC encodes a node record sequence number into the additional fields of
+// a ping or pong packet.
+func seqToRPC(seq uint64) []rlp.RawValue {
+	enc, _ := rlp.EncodeToBytes(seq)
+	return []rlp.RawValue{enc}
+}
+
+// seqFromRPC extracts the node record sequence number from the additional fields
+// of a ping or pong packet, returning zero for nodes not advertising records.
+func seqFromRPC(rest []rlp.RawValue) uint64 {
+	var seq uint64
+	if len(rest) > 0 {
+		rlp.DecodeBytes(rest[0], &seq)
+	}
+	return seq
+}
+
 func nodeToRPC(n *Node) rpcNode {
 	return rpcNode{ID: n.ID, IP: n.IP, UDP: n.UDP, TCP: n.TCP}
 }
@@ -239,6 +277,12 @@ func newUDP(priv *ecdsa.PrivateKey, c conn, natm nat.Interface, nodeDBPath strin
 	}
 	udp.Table = tab
 
+	// Publish the local endpoint in a signed node record
+	tab.priv = priv
+	if err := tab.SetRecordEntries(enr.IP(realaddr.IP), enr.UDP(realaddr.Port), enr.TCP(realaddr.Port)); err != nil {
+		return nil, nil, err
+	}
+
 	go udp.loop()
 	go udp.readLoop()
 	return udp.Table, udp, nil
@@ -250,17 +294,24 @@ func (t *udp) close() {
 	// TODO: wait for the loops to end.
 }
 
-// ping sends a ping message to the given node and waits for a reply.
-func (t *udp) ping(toid NodeID, toaddr *net.UDPAddr) error {
+// ping sends a ping message to the given node and waits for a reply, returning
+// the node record sequence number advertised by the remote node.
+func (t *udp) ping(toid NodeID, toaddr *net.UDPAddr) (uint64, error) {
 	// TODO: maybe check for ReplyTo field in callback to measure RTT
-	errc := t.pending(toid, pongPacket, func(interface{}) bool { return true })
+	var seq uint64
+	errc := t.pending(toid, pongPacket, func(r interface{}) bool {
+		seq = seqFromRPC(r.(*pong).Rest)
+		return true
+	})
 	t.send(toaddr, pingPacket, &ping{
 		Version:    Version,
 		From:       t.ourEndpoint,
 		To:         makeEndpoint(toaddr, 0), // TODO: maybe use known TCP port from DB
 		Expiration: uint64(time.Now().Add(expiration).Unix()),
+		Rest:       seqToRPC(t.localSeq()),
 	})
-	return <-errc
+	err := <-errc
+	return seq, err
 }
 
 func (t *udp) waitping(from NodeID) error {
@@ -293,6 +344,37 @@ func (t *udp) findnode(toid NodeID, toaddr *net.UDPAddr, target NodeID) ([]*Node
 	return nodes, err
 }
 
+// requestENR sends an enrRequest to the given node and waits for its signed
+// node record in reply.
+func (t *udp) requestENR(toid NodeID, toaddr *net.UDPAddr) (*enr.Record, error) {
+	packet, err := encodePacket(t.priv, enrRequestPacket, &enrRequest{
+		Expiration: uint64(time.Now().Add(expiration).Unix()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	hash := packet[:macSize]
+
+	var record *enr.Record
+	errc := t.pending(toid, enrResponsePacket, func(r interface{}) bool {
+		reply := r.(*enrResponse)
+		if !bytes.Equal(reply.ReplyTok, hash) {
+			return false
+		}
+		record = &reply.Record
+		return true
+	})
+	t.write(toaddr, "ENRREQUEST/v4", packet)
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	// Make sure the record belongs to the node we asked
+	if !bytes.Equal(record.NodeAddr(), crypto.Keccak256(toid[:])) {
+		return nil, errors.New("record doesn't match node ID")
+	}
+	return record, nil
+}
+
 // pending adds a reply callback to the pending reply queue.
 // see the documentation of type pending for a detailed explanation.
 func (t *udp) pending(id NodeID, ptype byte, callback func(interface{}) bool) <-chan error {
@@ -448,8 +530,12 @@ func (t *udp) send(toaddr *net.UDPAddr, ptype byte, req packet) error {
 	if err != nil {
 		return err
 	}
-	_, err = t.conn.WriteToUDP(packet, toaddr)
-	log.Trace(">> "+req.name(), "addr", toaddr, "err", err)
+	return t.write(toaddr, req.name(), packet)
+}
+
+func (t *udp) write(toaddr *net.UDPAddr, what string, packet []byte) error {
+	_, err := t.conn.WriteToUDP(packet, toaddr)
+	log.Trace(">> "+what, "addr", toaddr, "err", err)
 	return err
 }
 
@@ -531,6 +617,10 @@ func decodePacket(buf []byte) (packet, NodeID, []byte, error) {
 		req = new(findnode)
 	case neighborsPacket:
 		req = new(neighbors)
+	case enrRequestPacket:
+		req = new(enrRequest)
+	case enrResponsePacket:
+		req = new(enrResponse)
 	default:
 		return nil, fromID, hash, fmt.Errorf("unknown type: %d", ptype)
 	}
@@ -547,11 +637,16 @@ func (req *ping) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byte) er
 		To:         makeEndpoint(from, req.From.TCP),
 		ReplyTok:   mac,
 		Expiration: uint64(time.Now().Add(expiration).Unix()),
+		Rest:       seqToRPC(t.localSeq()),
 	})
 	if !t.handleReply(fromID, pingPacket, req) {
 		// Note: we're ignoring the provided IP address right now
 		go t.bond(true, fromID, from, req.From.TCP)
 	}
+	if seq := seqFromRPC(req.Rest); seq > t.recordSeq(fromID) && t.db.node(fromID) != nil {
+		// A bonded node announced a changed record, fetch it
+		go t.updateRecord(fromID, from, seq)
+	}
 	return nil
 }
 
@@ -618,6 +713,33 @@ func (req *neighbors) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byt
 
 func (req *neighbors) name() string { return "NEIGHBORS/v4" }
 
+func (req *enrRequest) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if expired(req.Expiration) {
+		return errExpired
+	}
+	if t.db.node(fromID) == nil {
+		// No bond exists, don't serve the record for the same reasons
+		// findnode isn't served.
+		return errUnknownNode
+	}
+	record := t.LocalRecord()
+	if record == nil {
+		return errNoRecord
+	}
+	return t.send(from, enrResponsePacket, &enrResponse{ReplyTok: mac, Record: *record})
+}
+
+func (req *enrRequest) name() string { return "ENRREQUEST/v4" }
+
+func (req *enrResponse) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if !t.handleReply(fromID, enrResponsePacket, req) {
+		return errUnsolicitedReply
+	}
+	return nil
+}
+
+func (req *enrResponse) name() string { return "ENRRESPONSE/v4" }
+
 func expired(ts uint64) bool {
 	return time.Unix(int64(ts), 0).Before(time.Now())
 }
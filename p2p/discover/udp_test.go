@@ -36,6 +36,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/kowala-tech/kUSD/common"
 	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/p2p/enr"
 	"github.com/kowala-tech/kUSD/rlp"
 )
 
@@ -135,7 +136,7 @@ func TestUDP_pingTimeout(t *testing.T) {
 
 	toaddr := &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 2222}
 	toid := NodeID{1, 2, 3, 4}
-	if err := test.udp.ping(toid, toaddr); err != errTimeout {
+	if _, err := test.udp.ping(toid, toaddr); err != errTimeout {
 		t.Error("expected timeout error, got", err)
 	}
 }
@@ -271,6 +272,81 @@ func TestUDP_findnode(t *testing.T) {
 	waitNeighbors(expected.entries[maxNeighbors:])
 }
 
+func TestUDP_enrRequest(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	// records aren't served to unbonded nodes.
+	test.packetIn(errUnknownNode, enrRequestPacket, &enrRequest{Expiration: futureExp})
+
+	test.table.db.updateNode(NewNode(
+		PubkeyID(&test.remotekey.PublicKey),
+		test.remoteaddr.IP,
+		uint16(test.remoteaddr.Port),
+		99,
+	))
+	go test.packetIn(nil, enrRequestPacket, &enrRequest{Expiration: futureExp})
+
+	test.waitPacketOut(func(p *enrResponse) {
+		reqhash := test.sent[len(test.sent)-1][:macSize]
+		if !bytes.Equal(p.ReplyTok, reqhash) {
+			t.Errorf("got enrResponse.ReplyTok %x, want %x", p.ReplyTok, reqhash)
+		}
+		if !p.Record.Equal(test.table.LocalRecord()) {
+			t.Errorf("served record doesn't match local record")
+		}
+		if id := test.table.self.ID; !bytes.Equal(p.Record.NodeAddr(), crypto.Keccak256(id[:])) {
+			t.Errorf("served record has wrong node address: got %x", p.Record.NodeAddr())
+		}
+	})
+}
+
+func TestUDP_recordUpdate(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	// ensure there's a fresh bond with the test node, so its
+	// ping doesn't trigger a new bonding process.
+	remoteID := PubkeyID(&test.remotekey.PublicKey)
+	test.table.db.updateNode(NewNode(remoteID, test.remoteaddr.IP, uint16(test.remoteaddr.Port), 99))
+	test.table.db.updateLastPong(remoteID, time.Now())
+
+	var record enr.Record
+	record.SetSeq(5)
+	record.Set(enr.WithEntry("custom", "value"))
+	if err := enr.SignV4(&record, test.remotekey); err != nil {
+		t.Fatal(err)
+	}
+	// the remote side announces a new record in its ping.
+	go test.packetIn(nil, pingPacket, &ping{From: testRemote, To: testLocalAnnounced, Version: Version, Expiration: futureExp, Rest: seqToRPC(record.Seq())})
+
+	test.waitPacketOut(func(p *pong) {
+		if seq := seqFromRPC(p.Rest); seq != test.table.localSeq() {
+			t.Errorf("got pong record seq %d, want %d", seq, test.table.localSeq())
+		}
+	})
+	// the record is requested and delivered.
+	dgram := test.pipe.waitPacketOut()
+	if p, _, _, err := decodePacket(dgram); err != nil {
+		t.Fatalf("sent packet decode error: %v", err)
+	} else if _, ok := p.(*enrRequest); !ok {
+		t.Fatalf("sent packet type mismatch, got: %T, want: *enrRequest", p)
+	}
+	reqhash := dgram[:macSize]
+	test.packetIn(nil, enrResponsePacket, &enrResponse{ReplyTok: reqhash, Record: record})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for test.table.Record(remoteID) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("record was not stored within 2 seconds")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !test.table.Record(remoteID).Equal(&record) {
+		t.Errorf("stored record doesn't match announced record")
+	}
+}
+
 func TestUDP_findnodeMultiReply(t *testing.T) {
 	test := newUDPTest(t)
 	defer test.table.Close()
@@ -0,0 +1,247 @@
+// Package dnsdisc implements node discovery via DNS (EIP-1459). Lists of signed
+// node records are published as DNS TXT records, forming a merkle tree whose
+// root is signed by the publisher, and clients sync them incrementally.
+package dnsdisc
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/p2p/discover"
+)
+
+const retryInterval = time.Minute // Time to wait before retrying a failed tree sync
+
+// Client discovers nodes by querying DNS servers.
+type Client struct {
+	cfg     Config
+	entries *lru.Cache
+
+	mu    sync.Mutex
+	trees map[string]*clientTree // synced trees by domain, including linked ones
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Config holds configuration options for the client.
+type Config struct {
+	Timeout         time.Duration // timeout used for DNS lookups (default 5s)
+	RecheckInterval time.Duration // time between tree root update checks (default 30min)
+	CacheLimit      int           // maximum number of cached records (default 1000)
+	Resolver        Resolver      // the DNS resolver to use (defaults to system DNS)
+}
+
+// Resolver is a DNS resolver that can query TXT records.
+type Resolver interface {
+	LookupTXT(ctx context.Context, domain string) ([]string, error)
+}
+
+func (cfg Config) withDefaults() Config {
+	const (
+		defaultTimeout = 5 * time.Second
+		defaultRecheck = 30 * time.Minute
+		defaultCache   = 1000
+	)
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.RecheckInterval == 0 {
+		cfg.RecheckInterval = defaultRecheck
+	}
+	if cfg.CacheLimit == 0 {
+		cfg.CacheLimit = defaultCache
+	}
+	if cfg.Resolver == nil {
+		cfg.Resolver = new(net.Resolver)
+	}
+	return cfg
+}
+
+// NewClient creates a client syncing the trees at the given enrtree:// URLs.
+func NewClient(cfg Config, urls ...string) (*Client, error) {
+	cfg = cfg.withDefaults()
+	cache, err := lru.New(cfg.CacheLimit)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		cfg:     cfg,
+		entries: cache,
+		trees:   make(map[string]*clientTree),
+		quit:    make(chan struct{}),
+	}
+	for _, url := range urls {
+		loc, err := parseLink(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid enrtree URL %q: %v", url, err)
+		}
+		c.trees[loc.domain] = newClientTree(c, loc)
+	}
+	return c, nil
+}
+
+// SyncTree downloads the entire node tree at the given URL.
+func (c *Client) SyncTree(url string) (*Tree, error) {
+	loc, err := parseLink(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enrtree URL: %v", err)
+	}
+	ct := newClientTree(c, loc)
+	t := &Tree{entries: make(map[string]entry)}
+	if err := ct.syncAll(t.entries); err != nil {
+		return nil, err
+	}
+	t.root = ct.root
+	return t, nil
+}
+
+// Start launches the background syncing of the configured trees.
+func (c *Client) Start() {
+	c.wg.Add(1)
+	go c.loop()
+}
+
+// Stop terminates the background syncing.
+func (c *Client) Stop() {
+	close(c.quit)
+	c.wg.Wait()
+}
+
+// ReadRandomNodes fills the given slice with random nodes from the synced
+// trees. It returns the number of nodes written.
+func (c *Client) ReadRandomNodes(buf []*discover.Node) int {
+	c.mu.Lock()
+	var nodes []*discover.Node
+	for _, ct := range c.trees {
+		nodes = append(nodes, ct.nodes...)
+	}
+	c.mu.Unlock()
+
+	n := 0
+	for _, i := range rand.Perm(len(nodes)) {
+		if n == len(buf) {
+			break
+		}
+		buf[n] = nodes[i]
+		n++
+	}
+	return n
+}
+
+// loop periodically updates the synced trees until the client is stopped.
+func (c *Client) loop() {
+	defer c.wg.Done()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if c.syncTrees() {
+				timer.Reset(c.cfg.RecheckInterval)
+			} else {
+				timer.Reset(retryInterval)
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// syncTrees updates all known trees, adding the ones linked from them. It
+// reports whether all of them were synced successfully.
+func (c *Client) syncTrees() bool {
+	c.mu.Lock()
+	trees := make([]*clientTree, 0, len(c.trees))
+	for _, ct := range c.trees {
+		trees = append(trees, ct)
+	}
+	c.mu.Unlock()
+
+	synced := true
+	for _, ct := range trees {
+		if err := ct.sync(); err != nil {
+			log.Debug("DNS node list sync failed", "tree", ct.loc.domain, "err", err)
+			synced = false
+			continue
+		}
+		c.mu.Lock()
+		for _, loc := range ct.links {
+			if _, ok := c.trees[loc.domain]; !ok {
+				log.Debug("Adding linked DNS node list", "tree", loc.domain, "from", ct.loc.domain)
+				c.trees[loc.domain] = newClientTree(c, loc)
+				synced = false // sync the new tree soon
+			}
+		}
+		c.mu.Unlock()
+	}
+	return synced
+}
+
+// resolveRoot retrieves a root entry via DNS, verifying its signature.
+func (c *Client) resolveRoot(ctx context.Context, loc *linkEntry) (rootEntry, error) {
+	txts, err := c.cfg.Resolver.LookupTXT(ctx, loc.domain)
+	if err != nil {
+		return rootEntry{}, err
+	}
+	for _, txt := range txts {
+		if strings.HasPrefix(txt, rootPrefix) {
+			root, err := parseRoot(txt)
+			if err != nil {
+				return rootEntry{}, nameError{loc.domain, err}
+			}
+			if !root.verifySignature(loc.pubkey) {
+				return rootEntry{}, nameError{loc.domain, entryError{"root", errInvalidSig}}
+			}
+			return root, nil
+		}
+	}
+	return rootEntry{}, nameError{loc.domain, errNoRoot}
+}
+
+// resolveEntry retrieves an entry from the cache or fetches it from the network
+// if it isn't cached.
+func (c *Client) resolveEntry(ctx context.Context, domain, hash string) (entry, error) {
+	cacheKey := domain + ":" + hash
+	if e, ok := c.entries.Get(cacheKey); ok {
+		return e.(entry), nil
+	}
+	e, err := c.doResolveEntry(ctx, domain, hash)
+	if err != nil {
+		return nil, err
+	}
+	c.entries.Add(cacheKey, e)
+	return e, nil
+}
+
+// doResolveEntry fetches an entry via DNS, verifying it against its hash.
+func (c *Client) doResolveEntry(ctx context.Context, domain, hash string) (entry, error) {
+	name := hash + "." + domain
+	txts, err := c.cfg.Resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, txt := range txts {
+		e, err := parseEntry(txt)
+		if err == errUnknownEntry {
+			continue
+		}
+		if err != nil {
+			return nil, nameError{name, err}
+		}
+		if subdomain(e) != hash {
+			return nil, nameError{name, errHashMismatch}
+		}
+		return e, nil
+	}
+	return nil, nameError{name, errNoEntry}
+}
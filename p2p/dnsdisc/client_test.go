@@ -0,0 +1,220 @@
+package dnsdisc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kowala-tech/kUSD/p2p/discover"
+	"github.com/kowala-tech/kUSD/p2p/enr"
+)
+
+// mapResolver is an in-memory DNS resolver serving TXT records from a map,
+// counting the queries it receives.
+type mapResolver struct {
+	lock    sync.Mutex
+	records map[string]string
+	queries int
+}
+
+func newMapResolver(maps ...map[string]string) *mapResolver {
+	mr := &mapResolver{records: make(map[string]string)}
+	mr.add(maps...)
+	return mr
+}
+
+func (mr *mapResolver) add(maps ...map[string]string) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	for _, m := range maps {
+		for k, v := range m {
+			mr.records[k] = v
+		}
+	}
+}
+
+func (mr *mapResolver) count() int {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	return mr.queries
+}
+
+func (mr *mapResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+
+	mr.queries++
+	if record, ok := mr.records[name]; ok {
+		return []string{record}, nil
+	}
+	return nil, errors.New("not found")
+}
+
+// makeTestTree creates and signs a tree, returning it with its URL.
+func makeTestTree(t *testing.T, domain string, seq uint, nodes []*enr.Record, links []string, key *ecdsa.PrivateKey) (*Tree, string) {
+	tree, err := MakeTree(seq, nodes, links)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, err := tree.Sign(key, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree, url
+}
+
+// Tests that a full tree can be downloaded.
+func TestClientSyncTree(t *testing.T) {
+	signer := testKeys(1)[0]
+	nodes := testNodes(testKeys(3 * maxChildren)[1:])
+	tree, url := makeTestTree(t, "n", 1, nodes, nil, signer)
+
+	c, err := NewClient(Config{Resolver: newMapResolver(tree.ToTXT("n"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced, err := c.SyncTree(url)
+	if err != nil {
+		t.Fatal("sync error:", err)
+	}
+	if !reflect.DeepEqual(sortedNodes(synced.Nodes()), sortedNodes(nodes)) {
+		t.Errorf("wrong nodes in synced tree: have %d, want %d", len(synced.Nodes()), len(nodes))
+	}
+	if synced.Seq() != 1 || synced.Signature() != tree.Signature() {
+		t.Errorf("wrong root in synced tree: seq %d, sig %s", synced.Seq(), synced.Signature())
+	}
+}
+
+// Tests that trees signed by another key or containing tampered entries are
+// rejected.
+func TestClientSyncTreeBadData(t *testing.T) {
+	keys := testKeys(3)
+	nodes := testNodes(keys[2:])
+	tree, _ := makeTestTree(t, "n", 1, nodes, nil, keys[0])
+
+	// Sign with the wrong key
+	url := (&linkEntry{"n", &keys[1].PublicKey}).String()
+	c, _ := NewClient(Config{Resolver: newMapResolver(tree.ToTXT("n"))})
+	if _, err := c.SyncTree(url); err == nil {
+		t.Fatal("tree with invalid signature synced")
+	}
+	// Serve an entry at the wrong name
+	url = (&linkEntry{"n", &keys[0].PublicKey}).String()
+	txts := tree.ToTXT("n")
+	for name := range txts {
+		if name != "n" {
+			txts[name] = "enrtree-branch:"
+		}
+	}
+	c, _ = NewClient(Config{Resolver: newMapResolver(txts)})
+	if _, err := c.SyncTree(url); err == nil {
+		t.Fatal("tree with tampered entries synced")
+	}
+}
+
+// Tests that updated trees are synced incrementally, only resolving the entries
+// which changed.
+func TestClientSyncIncremental(t *testing.T) {
+	signer := testKeys(1)[0]
+	nodes := testNodes(testKeys(2 * maxChildren)[1:])
+	tree, url := makeTestTree(t, "n", 1, nodes[:len(nodes)-1], nil, signer)
+
+	resolver := newMapResolver(tree.ToTXT("n"))
+	c, err := NewClient(Config{Resolver: resolver}, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.syncTrees() {
+		t.Fatal("initial sync failed")
+	}
+	full := resolver.count()
+	checkClientNodes(t, c, nodes[:len(nodes)-1])
+
+	// Nothing changed, only the root is checked
+	c.syncTrees()
+	if queries := resolver.count() - full; queries != 1 {
+		t.Fatalf("unchanged tree queries mismatch: have %d, want 1", queries)
+	}
+	// Add a node, unchanged branches are served from the cache
+	tree, _ = makeTestTree(t, "n", 2, nodes, nil, signer)
+	resolver.add(tree.ToTXT("n"))
+
+	before := resolver.count()
+	if !c.syncTrees() {
+		t.Fatal("update sync failed")
+	}
+	if queries := resolver.count() - before; queries >= full {
+		t.Fatalf("update not incremental: %d queries, full sync took %d", queries, full)
+	}
+	checkClientNodes(t, c, nodes)
+}
+
+// Tests that trees linked from a synced tree are synced too.
+func TestClientSyncLinks(t *testing.T) {
+	keys := testKeys(5)
+	nodes := testNodes(keys[2:])
+
+	linked, linkedURL := makeTestTree(t, "linked", 1, nodes[2:], nil, keys[1])
+	tree, url := makeTestTree(t, "n", 1, nodes[:2], []string{linkedURL}, keys[0])
+
+	c, err := NewClient(Config{Resolver: newMapResolver(tree.ToTXT("n"), linked.ToTXT("linked"))}, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.syncTrees() {
+		t.Fatal("linked tree not scheduled for sync")
+	}
+	if !c.syncTrees() {
+		t.Fatal("linked tree sync failed")
+	}
+	checkClientNodes(t, c, nodes)
+}
+
+// Tests that the background sync loop makes nodes available to the dialer.
+func TestClientStart(t *testing.T) {
+	signer := testKeys(1)[0]
+	nodes := testNodes(testKeys(4)[1:])
+	tree, url := makeTestTree(t, "n", 1, nodes, nil, signer)
+
+	c, err := NewClient(Config{Resolver: newMapResolver(tree.ToTXT("n"))}, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	defer c.Stop()
+
+	buf := make([]*discover.Node, len(nodes)+1)
+	deadline := time.Now().Add(2 * time.Second)
+	for c.ReadRandomNodes(buf) != len(nodes) {
+		if time.Now().After(deadline) {
+			t.Fatal("nodes not synced within 2 seconds")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// checkClientNodes verifies that the client serves exactly the given nodes.
+func checkClientNodes(t *testing.T, c *Client, want []*enr.Record) {
+	buf := make([]*discover.Node, len(want)+1)
+	n := c.ReadRandomNodes(buf)
+	if n != len(want) {
+		t.Fatalf("node count mismatch: have %d, want %d", n, len(want))
+	}
+	ids := make(map[discover.NodeID]bool)
+	for _, node := range buf[:n] {
+		ids[node.ID] = true
+	}
+	for _, r := range want {
+		var pubkey enr.Secp256k1
+		r.Load(&pubkey)
+		if id := discover.PubkeyID((*ecdsa.PublicKey)(&pubkey)); !ids[id] {
+			t.Errorf("node %x missing", id[:8])
+		}
+	}
+}
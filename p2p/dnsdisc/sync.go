@@ -0,0 +1,161 @@
+package dnsdisc
+
+import (
+	"context"
+
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/p2p/discover"
+)
+
+// clientTree is a full tree being synced.
+type clientTree struct {
+	c   *Client
+	loc *linkEntry // link to this tree
+
+	root      *rootEntry
+	linkSync  *subtreeSync // in-progress sync of the link subtree, nil if none
+	enrSync   *subtreeSync // in-progress sync of the node subtree, nil if none
+	lastLinks string       // link subtree root of the last completed link sync
+	lastENRs  string       // node subtree root of the last completed node sync
+
+	links []*linkEntry     // trees linked from this one
+	nodes []*discover.Node // nodes in the tree, guarded by the client lock
+}
+
+func newClientTree(c *Client, loc *linkEntry) *clientTree {
+	return &clientTree{c: c, loc: loc}
+}
+
+// sync checks the root of the tree for updates and downloads the subtrees that
+// changed. Entries already known from earlier syncs are served from the cache,
+// so only new ones hit the network. An interrupted sync resumes where it left
+// off.
+func (ct *clientTree) sync() error {
+	if err := ct.updateRoot(); err != nil {
+		return err
+	}
+	if ct.linkSync != nil {
+		if err := ct.linkSync.resolveAll(nil); err != nil {
+			return err
+		}
+		links := make([]*linkEntry, 0, len(ct.linkSync.leaves))
+		for _, e := range ct.linkSync.leaves {
+			links = append(links, e.(*linkEntry))
+		}
+		ct.links = links
+		ct.lastLinks, ct.linkSync = ct.linkSync.root, nil
+	}
+	if ct.enrSync != nil {
+		if err := ct.enrSync.resolveAll(nil); err != nil {
+			return err
+		}
+		nodes := make([]*discover.Node, 0, len(ct.enrSync.leaves))
+		for _, e := range ct.enrSync.leaves {
+			n, err := discover.NodeFromRecord(e.(*enrEntry).node)
+			if err != nil {
+				log.Trace("Skipping DNS listed node", "tree", ct.loc.domain, "err", err)
+				continue
+			}
+			nodes = append(nodes, n)
+		}
+		ct.c.mu.Lock()
+		ct.nodes = nodes
+		ct.c.mu.Unlock()
+
+		ct.lastENRs, ct.enrSync = ct.enrSync.root, nil
+		log.Debug("Synced DNS node list", "tree", ct.loc.domain, "seq", ct.root.seq, "nodes", len(nodes))
+	}
+	return nil
+}
+
+// syncAll downloads the entire tree, storing all entries in the given map.
+func (ct *clientTree) syncAll(dest map[string]entry) error {
+	if err := ct.updateRoot(); err != nil {
+		return err
+	}
+	if err := ct.linkSync.resolveAll(dest); err != nil {
+		return err
+	}
+	return ct.enrSync.resolveAll(dest)
+}
+
+// updateRoot fetches the root of the tree, scheduling the sync of the subtrees
+// which changed since the last completed sync.
+func (ct *clientTree) updateRoot() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ct.c.cfg.Timeout)
+	defer cancel()
+
+	root, err := ct.c.resolveRoot(ctx, ct.loc)
+	if err != nil {
+		return err
+	}
+	if ct.root != nil && root.seq < ct.root.seq {
+		log.Debug("Ignoring outdated DNS node list root", "tree", ct.loc.domain, "seq", root.seq, "known", ct.root.seq)
+		return nil
+	}
+	ct.root = &root
+
+	if root.lroot != ct.lastLinks && (ct.linkSync == nil || ct.linkSync.root != root.lroot) {
+		ct.linkSync = newSubtreeSync(ct.c, ct.loc, root.lroot, true)
+	}
+	if root.eroot != ct.lastENRs && (ct.enrSync == nil || ct.enrSync.root != root.eroot) {
+		ct.enrSync = newSubtreeSync(ct.c, ct.loc, root.eroot, false)
+	}
+	return nil
+}
+
+// subtreeSync is the sync of an ENR or link subtree.
+type subtreeSync struct {
+	c       *Client
+	loc     *linkEntry
+	root    string
+	missing []string // missing tree node hashes
+	link    bool     // true if this sync is for the link tree
+	leaves  []entry  // leaf entries resolved so far
+}
+
+func newSubtreeSync(c *Client, loc *linkEntry, root string, link bool) *subtreeSync {
+	return &subtreeSync{c, loc, root, []string{root}, link, nil}
+}
+
+// resolveAll resolves the missing entries of the subtree until it's complete,
+// storing all resolved entries in dest if it's non-nil.
+func (ts *subtreeSync) resolveAll(dest map[string]entry) error {
+	for len(ts.missing) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), ts.c.cfg.Timeout)
+		hash := ts.missing[0]
+		e, err := ts.resolveNext(ctx, hash)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if dest != nil {
+			dest[hash] = e
+		}
+		ts.missing = ts.missing[1:]
+	}
+	return nil
+}
+
+// resolveNext resolves a single missing entry of the subtree.
+func (ts *subtreeSync) resolveNext(ctx context.Context, hash string) (entry, error) {
+	e, err := ts.c.resolveEntry(ctx, ts.loc.domain, hash)
+	if err != nil {
+		return nil, err
+	}
+	switch e := e.(type) {
+	case *enrEntry:
+		if ts.link {
+			return nil, errENRInLinkTree
+		}
+		ts.leaves = append(ts.leaves, e)
+	case *linkEntry:
+		if !ts.link {
+			return nil, errLinkInENRTree
+		}
+		ts.leaves = append(ts.leaves, e)
+	case *branchEntry:
+		ts.missing = append(ts.missing, e.children...)
+	}
+	return e, nil
+}
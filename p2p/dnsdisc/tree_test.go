@@ -0,0 +1,193 @@
+package dnsdisc
+
+import (
+	"crypto/ecdsa"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/p2p/enr"
+)
+
+// testKeys generates deterministic private keys for tests.
+func testKeys(n int) []*ecdsa.PrivateKey {
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := range keys {
+		seed := make([]byte, 32)
+		seed[0], seed[31] = 1, byte(i+1)
+		keys[i] = crypto.ToECDSAUnsafe(seed)
+	}
+	return keys
+}
+
+// testNodes creates signed node records for the given keys.
+func testNodes(keys []*ecdsa.PrivateKey) []*enr.Record {
+	nodes := make([]*enr.Record, len(keys))
+	for i, key := range keys {
+		var r enr.Record
+		r.Set(enr.IP(net.IPv4(127, 0, 0, byte(i+1))))
+		r.Set(enr.UDP(30303))
+		r.Set(enr.TCP(30303))
+		if err := enr.SignV4(&r, key); err != nil {
+			panic(err)
+		}
+		nodes[i] = &r
+	}
+	return nodes
+}
+
+// sortedNodes returns the encodings of the given records in sorted order.
+func sortedNodes(nodes []*enr.Record) []string {
+	encs := make([]string, len(nodes))
+	for i, n := range nodes {
+		encs[i] = (&enrEntry{n}).String()
+	}
+	sort.Strings(encs)
+	return encs
+}
+
+func TestParseRoot(t *testing.T) {
+	tests := []struct {
+		input string
+		e     rootEntry
+		err   error
+	}{
+		{
+			input: "enrtree-root:v1 e=TO4Q75OQ2N7DX4EOOR7X66A6OM seq=3 sig=N-YY6UB9xD0hFx1Gmnt7v0RfSxch5tKyry2SRDoLx7B4GfPXagwLxQqyf7gAMvApFn_ORwZQekMWa_pXrcGCtw",
+			err:   entryError{"root", errSyntax},
+		},
+		{
+			input: "enrtree-root:v1 e=TO4Q75OQ2N7DX4EOOR7X66A6OM l=TO4Q75OQ2N7DX4EOOR7X66A6OM seq=3 sig=N-YY6UB9xD0hFx1Gmnt7v0RfSxch5tKyry2SRDoLx7B4GfPXagwLxQqyf7gAMvApFn_ORwZQekMWa_pXrcGCtw",
+			err:   entryError{"root", errInvalidSig},
+		},
+	}
+	for i, test := range tests {
+		e, err := parseRoot(test.input)
+		if !reflect.DeepEqual(e, test.e) {
+			t.Errorf("test %d: wrong entry %+v, want %+v", i, e, test.e)
+		}
+		if err != test.err {
+			t.Errorf("test %d: wrong error %q, want %q", i, err, test.err)
+		}
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	testkey := testKeys(1)[0]
+	tests := []struct {
+		input string
+		e     entry
+		err   error
+	}{
+		// Subtrees:
+		{
+			input: "enrtree-branch:1,2",
+			err:   entryError{"branch", errInvalidChild},
+		},
+		{
+			input: "enrtree-branch:AAAAAAAAAAAAAAAA",
+			err:   entryError{"branch", errInvalidChild},
+		},
+		{
+			input: "enrtree-branch:",
+			e:     &branchEntry{},
+		},
+		{
+			input: "enrtree-branch:AAAAAAAAAAAAAAAAAAAAAAAAAA",
+			e:     &branchEntry{[]string{"AAAAAAAAAAAAAAAAAAAAAAAAAA"}},
+		},
+		{
+			input: "enrtree-branch:AAAAAAAAAAAAAAAAAAAAAAAAAA,BBBBBBBBBBBBBBBBBBBBBBBBBB",
+			e:     &branchEntry{[]string{"AAAAAAAAAAAAAAAAAAAAAAAAAA", "BBBBBBBBBBBBBBBBBBBBBBBBBB"}},
+		},
+		// Links
+		{
+			input: (&linkEntry{"nodes.example.org", &testkey.PublicKey}).String(),
+			e:     &linkEntry{"nodes.example.org", &testkey.PublicKey},
+		},
+		{
+			input: "enrtree://nodes.example.org",
+			err:   entryError{"link", errNoPubkey},
+		},
+		{
+			input: "enrtree://AP62DT7WOTEQZGQZOU474PP3KMEGVTTE7A7NPRXKX3DUD57@nodes.example.org",
+			err:   entryError{"link", errBadPubkey},
+		},
+		// ENRs
+		{
+			input: "enr:!!!",
+			err:   entryError{"enr", errInvalidENR},
+		},
+		// Invalid:
+		{input: "", err: errUnknownEntry},
+		{input: "foo", err: errUnknownEntry},
+		{input: "enrtree", err: errUnknownEntry},
+		{input: "enrtree-x=", err: errUnknownEntry},
+	}
+	for i, test := range tests {
+		e, err := parseEntry(test.input)
+		if !reflect.DeepEqual(e, test.e) {
+			t.Errorf("test %d: wrong entry %s, want %s", i, e, test.e)
+		}
+		if !reflect.DeepEqual(err, test.err) {
+			t.Errorf("test %d: wrong error %q, want %q", i, err, test.err)
+		}
+	}
+}
+
+// Tests that a tree survives a signing and TXT record round trip, regardless of
+// its size and the order of the input.
+func TestMakeTree(t *testing.T) {
+	keys := testKeys(2*maxChildren + 3)
+	nodes := testNodes(keys[1:])
+	link := (&linkEntry{"other.example.org", &keys[0].PublicKey}).String()
+
+	tree, err := MakeTree(2, nodes, []string{link})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed := make([]*enr.Record, len(nodes))
+	for i, n := range nodes {
+		reversed[len(nodes)-1-i] = n
+	}
+	tree2, err := MakeTree(2, reversed, []string{link})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tree.ToTXT(""), tree2.ToTXT("")) {
+		t.Fatal("tree depends on the order of its nodes")
+	}
+	if have, want := sortedNodes(tree.Nodes()), sortedNodes(nodes); !reflect.DeepEqual(have, want) {
+		t.Fatalf("tree nodes mismatch: have %d, want %d", len(have), len(want))
+	}
+	if links := tree.Links(); !reflect.DeepEqual(links, []string{link}) {
+		t.Fatalf("tree links mismatch: have %v, want %v", links, []string{link})
+	}
+	// Every entry must fit into a single TXT record
+	for name, txt := range tree.ToTXT("nodes.example.org") {
+		if len(txt) > 370 && name != "nodes.example.org" {
+			t.Errorf("entry %s too big: %d bytes", name, len(txt))
+		}
+	}
+	// Sign the tree and verify the root signature
+	signer := testKeys(1)[0]
+	url, err := tree.Sign(signer, "nodes.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	domain, pubkey, err := ParseURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domain != "nodes.example.org" || pubkey.X.Cmp(signer.X) != 0 || pubkey.Y.Cmp(signer.Y) != 0 {
+		t.Fatalf("tree URL mismatch: %s", url)
+	}
+	if err := tree2.SetSignature(pubkey, tree.Signature()); err != nil {
+		t.Fatalf("signature rejected: %v", err)
+	}
+	if err := tree2.SetSignature(&keys[1].PublicKey, tree.Signature()); err != errInvalidSig {
+		t.Fatalf("foreign signature error mismatch: have %v, want %v", err, errInvalidSig)
+	}
+}
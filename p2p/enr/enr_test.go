@@ -0,0 +1,165 @@
+package enr
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math/rand"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kowala-tech/kUSD/crypto"
+	"github.com/kowala-tech/kUSD/rlp"
+)
+
+var (
+	privkey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	pubkey     = &privkey.PublicKey
+)
+
+var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+func randomString(strlen int) string {
+	b := make([]byte, strlen)
+	rnd.Read(b)
+	return string(b)
+}
+
+// Tests that the IP entry is encoded and decoded correctly.
+func TestGetSetIP(t *testing.T) {
+	ips := []IP{
+		IP(net.ParseIP("192.168.0.3")),
+		IP(net.ParseIP("2001:0db8:85a3:0000:0000:8a2e:0370:7334")),
+	}
+	for _, ip := range ips {
+		var r Record
+		r.Set(ip)
+
+		var ip2 IP
+		if err := r.Load(&ip2); err != nil {
+			t.Fatal(err)
+		}
+		if !net.IP(ip).Equal(net.IP(ip2)) {
+			t.Fatalf("ip mismatch: have %v, want %v", ip2, ip)
+		}
+	}
+}
+
+// Tests that the public key entry survives a compression round trip.
+func TestGetSetSecp256k1(t *testing.T) {
+	var r Record
+	if err := SignV4(&r, privkey); err != nil {
+		t.Fatal(err)
+	}
+	var pk Secp256k1
+	if err := r.Load(&pk); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(crypto.FromECDSAPub(pubkey), crypto.FromECDSAPub((*ecdsa.PublicKey)(&pk))) {
+		t.Fatalf("public key mismatch: have %x, want %x", crypto.FromECDSAPub((*ecdsa.PublicKey)(&pk)), crypto.FromECDSAPub(pubkey))
+	}
+}
+
+// Tests that loading a missing key reports a not found error.
+func TestLoadErrors(t *testing.T) {
+	var r Record
+	r.Set(UDP(30303))
+
+	var tcp TCP
+	if err := r.Load(&tcp); !IsNotFound(err) {
+		t.Fatalf("missing key error mismatch: have %v", err)
+	}
+	var list []uint
+	if err := r.Load(WithEntry("udp", &list)); err == nil || IsNotFound(err) {
+		t.Fatalf("decoding error mismatch: have %v", err)
+	}
+}
+
+// Tests that entries are kept sorted by key regardless of insertion order.
+func TestSortedGetAndSet(t *testing.T) {
+	var r Record
+	for _, key := range []string{"c", "a", "d", "b"} {
+		r.Set(WithEntry(key, uint(1)))
+	}
+	keys := make([]string, len(r.pairs))
+	for i, p := range r.pairs {
+		keys[i] = p.k
+	}
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("key order mismatch: have %v, want %v", keys, want)
+	}
+}
+
+// Tests that signed records survive an encoding round trip and that unsigned
+// ones can't be encoded.
+func TestSignEncodeAndDecode(t *testing.T) {
+	var r Record
+	r.Set(UDP(30303))
+	r.Set(IP(net.IPv4(127, 0, 0, 1)))
+	r.Set(WithEntry("custom", randomString(16)))
+
+	if _, err := rlp.EncodeToBytes(r); err != errEncodeUnsigned {
+		t.Fatalf("unsigned encoding error mismatch: have %v, want %v", err, errEncodeUnsigned)
+	}
+	if err := SignV4(&r, privkey); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := rlp.EncodeToBytes(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r2 Record
+	if err := rlp.DecodeBytes(blob, &r2); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Equal(&r2) || !reflect.DeepEqual(r.pairs, r2.pairs) {
+		t.Fatalf("decoded record mismatch: have %v, want %v", r2.pairs, r.pairs)
+	}
+	if want := crypto.Keccak256(crypto.FromECDSAPub(pubkey)[1:]); !bytes.Equal(r2.NodeAddr(), want) {
+		t.Fatalf("node address mismatch: have %x, want %x", r2.NodeAddr(), want)
+	}
+}
+
+// Tests that modifying a signed record bumps its sequence number and that
+// tampered records are rejected.
+func TestModifyAndTamper(t *testing.T) {
+	var r Record
+	r.Set(UDP(30303))
+	if err := SignV4(&r, privkey); err != nil {
+		t.Fatal(err)
+	}
+	seq := r.Seq()
+
+	r.Set(UDP(30304))
+	if r.Signed() {
+		t.Fatal("modified record still signed")
+	}
+	if r.Seq() != seq+1 {
+		t.Fatalf("sequence number mismatch: have %d, want %d", r.Seq(), seq+1)
+	}
+	if err := SignV4(&r, privkey); err != nil {
+		t.Fatal(err)
+	}
+	blob, _ := rlp.EncodeToBytes(r)
+
+	// Flip a byte in the port value, invalidating the signature
+	tampered := append([]byte{}, blob...)
+	tampered[len(tampered)-1]++
+	var r2 Record
+	if err := rlp.DecodeBytes(tampered, &r2); err != errInvalidSig {
+		t.Fatalf("tampered record error mismatch: have %v, want %v", err, errInvalidSig)
+	}
+}
+
+// Tests that records exceeding the size limit can't be signed.
+func TestRecordTooBig(t *testing.T) {
+	var r Record
+	r.Set(WithEntry("big", randomString(SizeLimit)))
+	if err := SignV4(&r, privkey); err != errTooBig {
+		t.Fatalf("oversized record error mismatch: have %v, want %v", err, errTooBig)
+	}
+	if r.Signed() {
+		t.Fatal("oversized record signed")
+	}
+}
@@ -0,0 +1,92 @@
+package enr
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+
+	"github.com/kowala-tech/kUSD/crypto"
+)
+
+var errInvalidPubkey = errors.New("invalid secp256k1 public key")
+
+// SignV4 signs a record using the v4 scheme.
+func SignV4(r *Record, privkey *ecdsa.PrivateKey) error {
+	// Copy r to avoid modifying it if signing fails.
+	cpy := *r
+	cpy.Set(IDv4)
+	cpy.Set(Secp256k1(privkey.PublicKey))
+
+	sig, err := crypto.Sign(crypto.Keccak256(cpy.signingContent()), privkey)
+	if err != nil {
+		return err
+	}
+	sig = sig[:len(sig)-1] // remove v
+	if err = cpy.sealSignature(sig); err == nil {
+		*r = cpy
+	}
+	return err
+}
+
+// verifyV4 checks a v4 signature over the given content, trying both possible
+// recovery identifiers as the signature doesn't contain one.
+func verifyV4(content, sig []byte, key *Secp256k1) error {
+	if len(sig) != 64 {
+		return errInvalidSig
+	}
+	hash := crypto.Keccak256(content)
+	want := crypto.FromECDSAPub((*ecdsa.PublicKey)(key))
+	for v := byte(0); v < 2; v++ {
+		pub, err := crypto.Ecrecover(hash, append(sig[:64:64], v))
+		if err == nil && string(pub) == string(want) {
+			return nil
+		}
+	}
+	return errInvalidSig
+}
+
+// nodeAddrV4 returns the node address of a v4 identity, the keccak256 hash of
+// the uncompressed public key.
+func nodeAddrV4(key *Secp256k1) []byte {
+	buf := crypto.FromECDSAPub((*ecdsa.PublicKey)(key))
+	return crypto.Keccak256(buf[1:])
+}
+
+// compressPubkey encodes a public key to the 33-byte compressed format.
+func compressPubkey(pubkey *ecdsa.PublicKey) []byte {
+	buf := make([]byte, 33)
+	buf[0] = byte(2 + pubkey.Y.Bit(0))
+	x := pubkey.X.Bytes()
+	copy(buf[33-len(x):], x)
+	return buf
+}
+
+// decompressPubkey parses a public key in the 33-byte compressed format.
+func decompressPubkey(buf []byte) (*ecdsa.PublicKey, error) {
+	if len(buf) != 33 || (buf[0] != 2 && buf[0] != 3) {
+		return nil, errInvalidPubkey
+	}
+	var (
+		curve = crypto.S256()
+		p     = curve.Params().P
+		x     = new(big.Int).SetBytes(buf[1:])
+	)
+	if x.Cmp(p) >= 0 {
+		return nil, errInvalidPubkey
+	}
+	// Solve y^2 = x^3 + 7, the square root exists as p = 3 mod 4.
+	y2 := new(big.Int).Exp(x, big.NewInt(3), p)
+	y2.Add(y2, big.NewInt(7))
+	y2.Mod(y2, p)
+
+	exp := new(big.Int).Add(p, big.NewInt(1))
+	exp.Rsh(exp, 2)
+	y := new(big.Int).Exp(y2, exp, p)
+	if new(big.Int).Exp(y, big.NewInt(2), p).Cmp(y2) != 0 {
+		return nil, errInvalidPubkey
+	}
+	if y.Bit(0) != uint(buf[0]&1) {
+		y.Sub(p, y)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
@@ -3,9 +3,12 @@
 package p2p
 
 import (
+	"fmt"
 	"net"
+	"sync"
 
 	"github.com/kowala-tech/kUSD/metrics"
+	gometrics "github.com/rcrowley/go-metrics"
 )
 
 var (
@@ -53,3 +56,159 @@ func (c *meteredConn) Write(b []byte) (n int, err error) {
 	egressTrafficMeter.Mark(int64(n))
 	return
 }
+
+// msgMeters are the packet and traffic meters of the message codes of a
+// protocol version, indexed by code.
+type msgMeters struct {
+	inPackets, inTraffic   []gometrics.Meter
+	outPackets, outTraffic []gometrics.Meter
+}
+
+var (
+	msgMetersLock sync.Mutex
+	msgMetersSet  = make(map[Cap]*msgMeters)
+)
+
+// protoMeters returns the message meters of a protocol version, registering
+// them on first use.
+func protoMeters(proto Protocol) *msgMeters {
+	msgMetersLock.Lock()
+	defer msgMetersLock.Unlock()
+
+	if m := msgMetersSet[proto.cap()]; m != nil {
+		return m
+	}
+	m := &msgMeters{
+		inPackets:  make([]gometrics.Meter, proto.Length),
+		inTraffic:  make([]gometrics.Meter, proto.Length),
+		outPackets: make([]gometrics.Meter, proto.Length),
+		outTraffic: make([]gometrics.Meter, proto.Length),
+	}
+	for code := range m.inPackets {
+		prefix := fmt.Sprintf("p2p/%s/%d/in/%d", proto.Name, proto.Version, code)
+		m.inPackets[code] = metrics.NewMeter(prefix + "/packets")
+		m.inTraffic[code] = metrics.NewMeter(prefix + "/traffic")
+
+		prefix = fmt.Sprintf("p2p/%s/%d/out/%d", proto.Name, proto.Version, code)
+		m.outPackets[code] = metrics.NewMeter(prefix + "/packets")
+		m.outTraffic[code] = metrics.NewMeter(prefix + "/traffic")
+	}
+	msgMetersSet[proto.cap()] = m
+	return m
+}
+
+// mark marks the packet and traffic meters of a message code in the given
+// direction. Codes outside the protocol are ignored.
+func (m *msgMeters) mark(code uint64, size uint32, ingress bool) {
+	if code >= uint64(len(m.inPackets)) {
+		return
+	}
+	if ingress {
+		m.inPackets[code].Mark(1)
+		m.inTraffic[code].Mark(int64(size))
+	} else {
+		m.outPackets[code].Mark(1)
+		m.outTraffic[code].Mark(int64(size))
+	}
+}
+
+// MsgTraffic counts the messages of a single code exchanged with a peer.
+type MsgTraffic struct {
+	InPackets  uint64 `json:"inPackets"`
+	InBytes    uint64 `json:"inBytes"`
+	OutPackets uint64 `json:"outPackets"`
+	OutBytes   uint64 `json:"outBytes"`
+}
+
+// peerTraffic counts the messages exchanged with a peer by protocol and code.
+type peerTraffic struct {
+	lock sync.Mutex
+	msgs map[string]map[uint64]*MsgTraffic
+}
+
+func newPeerTraffic() *peerTraffic {
+	return &peerTraffic{msgs: make(map[string]map[uint64]*MsgTraffic)}
+}
+
+// add counts a message of the given protocol and code.
+func (t *peerTraffic) add(proto string, code uint64, size uint32, ingress bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	codes := t.msgs[proto]
+	if codes == nil {
+		codes = make(map[uint64]*MsgTraffic)
+		t.msgs[proto] = codes
+	}
+	counts := codes[code]
+	if counts == nil {
+		counts = new(MsgTraffic)
+		codes[code] = counts
+	}
+	if ingress {
+		counts.InPackets++
+		counts.InBytes += uint64(size)
+	} else {
+		counts.OutPackets++
+		counts.OutBytes += uint64(size)
+	}
+}
+
+// snapshot returns a copy of the message counters.
+func (t *peerTraffic) snapshot() map[string]map[uint64]MsgTraffic {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	snap := make(map[string]map[uint64]MsgTraffic, len(t.msgs))
+	for proto, codes := range t.msgs {
+		snap[proto] = make(map[uint64]MsgTraffic, len(codes))
+		for code, counts := range codes {
+			snap[proto][code] = *counts
+		}
+	}
+	return snap
+}
+
+// meteredMsgRW is a wrapper around the message stream of a protocol that meters
+// the messages by code, and counts them for the peer.
+type meteredMsgRW struct {
+	MsgReadWriter
+	proto   Protocol
+	traffic *peerTraffic
+	meters  *msgMeters // nil if metrics are disabled
+}
+
+func newMeteredMsgRW(rw MsgReadWriter, proto Protocol, traffic *peerTraffic) *meteredMsgRW {
+	mrw := &meteredMsgRW{MsgReadWriter: rw, proto: proto, traffic: traffic}
+	if metrics.Enabled {
+		mrw.meters = protoMeters(proto)
+	}
+	return mrw
+}
+
+// ReadMsg reads a message from the underlying stream, accounting for it if the
+// read succeeded.
+func (rw *meteredMsgRW) ReadMsg() (Msg, error) {
+	msg, err := rw.MsgReadWriter.ReadMsg()
+	if err == nil {
+		rw.account(msg, true)
+	}
+	return msg, err
+}
+
+// WriteMsg writes a message to the underlying stream, accounting for it if the
+// write succeeded.
+func (rw *meteredMsgRW) WriteMsg(msg Msg) error {
+	err := rw.MsgReadWriter.WriteMsg(msg)
+	if err == nil {
+		rw.account(msg, false)
+	}
+	return err
+}
+
+func (rw *meteredMsgRW) account(msg Msg, ingress bool) {
+	rw.traffic.add(rw.proto.Name, msg.Code, msg.Size, ingress)
+	if rw.meters != nil {
+		rw.meters.mark(msg.Code, msg.Size, ingress)
+	}
+}
@@ -0,0 +1,43 @@
+package p2p
+
+import (
+	"testing"
+
+	"github.com/kowala-tech/kUSD/metrics"
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+func TestProtoMeters(t *testing.T) {
+	defer func(enabled bool) { metrics.Enabled = enabled }(metrics.Enabled)
+	metrics.Enabled = true
+
+	proto := Protocol{Name: "metertest", Version: 2, Length: 3}
+	m := protoMeters(proto)
+	if protoMeters(proto) != m {
+		t.Fatal("meters of the protocol version not reused")
+	}
+	m.mark(2, 100, true)
+	m.mark(2, 50, true)
+	m.mark(1, 10, false)
+	m.mark(3, 10, true) // outside the protocol
+
+	for name, want := range map[string]int64{
+		"p2p/metertest/2/in/2/packets":  2,
+		"p2p/metertest/2/in/2/traffic":  150,
+		"p2p/metertest/2/out/1/packets": 1,
+		"p2p/metertest/2/out/1/traffic": 10,
+		"p2p/metertest/2/in/1/packets":  0,
+	} {
+		meter, ok := gometrics.DefaultRegistry.Get(name).(gometrics.Meter)
+		if !ok {
+			t.Errorf("%s: meter not registered", name)
+			continue
+		}
+		if have := meter.Count(); have != want {
+			t.Errorf("%s: count mismatch: have %d, want %d", name, have, want)
+		}
+	}
+	if gometrics.DefaultRegistry.Get("p2p/metertest/2/in/3/packets") != nil {
+		t.Error("meter registered for a code outside the protocol")
+	}
+}
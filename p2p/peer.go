@@ -93,6 +93,14 @@ type Peer struct {
 
 	// events receives message send / receive events if set
 	events *event.Feed
+
+	// reputation tracks misbehavior of the peer if set
+	reputation *reputation
+
+	// capture records the messages exchanged with the peer if set
+	capture *msgCapture
+
+	traffic *peerTraffic // message counters by protocol and code
 }
 
 // NewPeer returns a peer for testing purposes.
@@ -139,6 +147,19 @@ func (p *Peer) Disconnect(reason DiscReason) {
 	}
 }
 
+// Misbehaved reports a protocol violation of the peer, raising its misbehavior
+// score by the given penalty. Peers exceeding the ban threshold are banned from
+// reconnecting for a while and disconnected. Trusted peers are exempt.
+func (p *Peer) Misbehaved(penalty int, reason error) {
+	if p.reputation == nil || p.rw.is(trustedConn) {
+		return
+	}
+	p.log.Debug("Peer misbehaved", "penalty", penalty, "reason", reason)
+	if p.reputation.misbehaved(p.ID(), remoteIP(p.RemoteAddr()), penalty, time.Now()) {
+		p.Disconnect(DiscUselessPeer)
+	}
+}
+
 // String implements fmt.Stringer.
 func (p *Peer) String() string {
 	return fmt.Sprintf("Peer %x %v", p.rw.id[:8], p.RemoteAddr())
@@ -154,6 +175,7 @@ func newPeer(conn *conn, protocols []Protocol) *Peer {
 		protoErr: make(chan error, len(protomap)+1), // protocols + pingLoop
 		closed:   make(chan struct{}),
 		log:      log.New("id", conn.id, "conn", conn.flags),
+		traffic:  newPeerTraffic(),
 	}
 	return p
 }
@@ -319,7 +341,10 @@ func (p *Peer) startProtocols(writeStart <-chan struct{}, writeErr chan<- error)
 		proto.closed = p.closed
 		proto.wstart = writeStart
 		proto.werr = writeErr
-		var rw MsgReadWriter = proto
+		var rw MsgReadWriter = newMeteredMsgRW(proto, proto.Protocol, p.traffic)
+		if p.capture != nil {
+			rw = newCapturingMsgRW(rw, p.capture, p.ID(), proto.Protocol)
+		}
 		if p.events != nil {
 			rw = newMsgEventer(rw, p.events, p.ID(), proto.Name)
 		}
@@ -400,6 +425,8 @@ type PeerInfo struct {
 		RemoteAddress string `json:"remoteAddress"` // Remote endpoint of the TCP data connection
 	} `json:"network"`
 	Protocols map[string]interface{} `json:"protocols"` // Sub-protocol specific metadata fields
+
+	Traffic map[string]map[uint64]MsgTraffic `json:"traffic"` // Messages exchanged by protocol and code
 }
 
 // Info gathers and returns a collection of metadata known about a peer.
@@ -415,6 +442,7 @@ func (p *Peer) Info() *PeerInfo {
 		Name:      p.Name(),
 		Caps:      caps,
 		Protocols: make(map[string]interface{}),
+		Traffic:   p.traffic.snapshot(),
 	}
 	info.Network.LocalAddress = p.LocalAddr().String()
 	info.Network.RemoteAddress = p.RemoteAddr().String()
@@ -83,6 +83,18 @@ func (d DiscReason) Error() string {
 	return d.String()
 }
 
+// ProtocolMismatchError is returned by SetupConn if a node has no protocol in
+// common with the server. It carries what the node announced in the protocol
+// handshake, the connection being dropped with DiscUselessPeer.
+type ProtocolMismatchError struct {
+	Name string
+	Caps []Cap
+}
+
+func (e *ProtocolMismatchError) Error() string {
+	return fmt.Sprintf("%v: no protocol in common with %v", DiscUselessPeer, e.Caps)
+}
+
 func discReasonForError(err error) DiscReason {
 	if reason, ok := err.(DiscReason); ok {
 		return reason
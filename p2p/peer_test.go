@@ -104,6 +104,49 @@ func TestPeerProtoEncodeMsg(t *testing.T) {
 	}
 }
 
+func TestPeerTraffic(t *testing.T) {
+	proto := Protocol{
+		Name:   "a",
+		Length: 5,
+		Run: func(peer *Peer, rw MsgReadWriter) error {
+			for i := 0; i < 3; i++ {
+				if err := ExpectMsg(rw, 2, []uint{1}); err != nil {
+					t.Error(err)
+				}
+			}
+			if err := ExpectMsg(rw, 3, []uint{2}); err != nil {
+				t.Error(err)
+			}
+			return SendItems(rw, 1, "foo")
+		},
+	}
+	closer, rw, peer, errc := testPeer([]Protocol{proto})
+	defer closer()
+
+	for i := 0; i < 3; i++ {
+		Send(rw, baseProtocolLength+2, []uint{1})
+	}
+	Send(rw, baseProtocolLength+3, []uint{2})
+	if err := ExpectMsg(rw, baseProtocolLength+1, []string{"foo"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-errc:
+	case <-time.After(2 * time.Second):
+		t.Fatal("protocol did not return")
+	}
+	want := map[string]map[uint64]MsgTraffic{
+		"a": {
+			1: {OutPackets: 1, OutBytes: 5},
+			2: {InPackets: 3, InBytes: 6},
+			3: {InPackets: 1, InBytes: 2},
+		},
+	}
+	if traffic := peer.Info().Traffic; !reflect.DeepEqual(traffic, want) {
+		t.Errorf("traffic mismatch:\nhave %+v\nwant %+v", traffic, want)
+	}
+}
+
 func TestPeerPing(t *testing.T) {
 	closer, rw, _, _ := testPeer(nil)
 	defer closer()
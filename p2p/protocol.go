@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/kowala-tech/kUSD/p2p/discover"
+	"github.com/kowala-tech/kUSD/p2p/enr"
 )
 
 // Protocol represents a P2P subprotocol implementation.
@@ -36,6 +37,16 @@ type Protocol struct {
 	// about a certain peer in the network. If an info retrieval function is set,
 	// but returns nil, it is assumed that the protocol handshake is still running.
 	PeerInfo func(id discover.NodeID) interface{}
+
+	// Attributes contains protocol specific entries published in the node
+	// record of the host node on the discovery network.
+	Attributes []enr.Entry
+
+	// NodeFilter is an optional helper method to check, before dialing it, whether
+	// a discovered node is worth connecting to based on its node record. Nodes
+	// are dialed if any of the protocols accepts them, with protocols without a
+	// filter accepting all of them.
+	NodeFilter func(record *enr.Record) bool
 }
 
 func (p Protocol) cap() Cap {
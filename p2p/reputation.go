@@ -0,0 +1,271 @@
+package p2p
+
+import (
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/p2p/discover"
+)
+
+// Penalties applied to the reputation of misbehaving peers.
+const (
+	PenaltyMinor = 10  // Unexpected but possibly honest behavior (e.g. stale data, timeouts)
+	PenaltyMajor = 50  // Protocol violations (e.g. undecodable messages)
+	PenaltyFatal = 100 // Proven attacks (e.g. invalid blocks), also held against the IP address
+)
+
+const (
+	banThreshold   = 100              // Misbehavior score at which a target gets banned
+	scoreHalfLife  = 10 * time.Minute // Time it takes for a misbehavior score to halve
+	banDuration    = time.Hour        // Duration of the first temporary ban of a target
+	maxTempBans    = 3                // Number of temporary bans after which a ban becomes permanent
+	scoreRetention = 24 * time.Hour   // Time after which idle scores are forgotten
+)
+
+// banStore is the persistent storage of peer bans, implemented by the node
+// database of the discovery table.
+type banStore interface {
+	Bans() map[string]time.Time
+	StoreBan(target string, expiry time.Time) error
+	DeleteBan(target string) error
+}
+
+// BanInfo represents a banned node or IP address.
+type BanInfo struct {
+	Target  string     `json:"target"`  // Banned target, "node:<id>" or "ip:<address>"
+	Expires *time.Time `json:"expires"` // Expiry of the ban, nil for permanent bans
+}
+
+// score tracks the misbehavior of a single node or IP address.
+type score struct {
+	value   float64   // Misbehavior score as of the last update
+	updated time.Time // Time of the last update
+	bans    int       // Number of temporary bans issued so far
+}
+
+// decay returns the misbehavior score at the given time.
+func (s *score) decay(now time.Time) float64 {
+	elapsed := now.Sub(s.updated)
+	if elapsed <= 0 {
+		return s.value
+	}
+	return s.value * math.Pow(0.5, float64(elapsed)/float64(scoreHalfLife))
+}
+
+// reputation tracks the misbehavior of remote peers both by node ID and by IP
+// address, banning targets whose decaying misbehavior score exceeds the ban
+// threshold. Repeated bans escalate in duration, and become permanent once a
+// proven attack pushes a target over the threshold again. IP addresses may be
+// shared by honest nodes, so they are only charged with proven attacks.
+//
+// Only the bans themselves are persisted. The number of temporary bans a target
+// received is kept in memory along with its score, so the escalation starts
+// over after a restart, or once the target stayed unbanned and idle for
+// scoreRetention (24 hours).
+type reputation struct {
+	store  banStore             // Persistent ban storage, nil if bans are kept in memory
+	scores map[string]*score    // Misbehavior scores by target
+	bans   map[string]time.Time // Active bans by target, zero time if permanent
+	swept  time.Time            // Time of the last score cleanup
+	lock   sync.Mutex
+}
+
+// newReputation creates a peer reputation tracker, loading any previously
+// persisted bans from the given store.
+func newReputation(store banStore) *reputation {
+	r := &reputation{
+		store:  store,
+		scores: make(map[string]*score),
+		bans:   make(map[string]time.Time),
+		swept:  time.Now(),
+	}
+	if store != nil {
+		now := time.Now()
+		for target, expiry := range store.Bans() {
+			if !expiry.IsZero() && now.After(expiry) {
+				store.DeleteBan(target)
+				continue
+			}
+			r.bans[target] = expiry
+		}
+	}
+	return r
+}
+
+// nodeTarget returns the reputation target of a node ID.
+func nodeTarget(id discover.NodeID) string {
+	return "node:" + id.String()
+}
+
+// ipTarget returns the reputation target of an IP address.
+func ipTarget(ip net.IP) string {
+	return "ip:" + ip.String()
+}
+
+// targets returns the reputation targets of a remote peer. Unspecified and
+// loopback addresses aren't tracked so local peers don't ban each other.
+func targets(id discover.NodeID, ip net.IP) []string {
+	targets := []string{nodeTarget(id)}
+	if ip != nil && !ip.IsUnspecified() && !ip.IsLoopback() {
+		targets = append(targets, ipTarget(ip))
+	}
+	return targets
+}
+
+// misbehaved records a penalty against a remote peer, returning whether the
+// peer got banned as a result.
+func (r *reputation) misbehaved(id discover.NodeID, ip net.IP, penalty int, now time.Time) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.sweep(now)
+
+	// Only proven attacks are held against the IP address of the peer
+	if penalty < PenaltyFatal {
+		ip = nil
+	}
+	banned := false
+	for _, target := range targets(id, ip) {
+		s := r.scores[target]
+		if s == nil {
+			s = new(score)
+			r.scores[target] = s
+		}
+		s.value, s.updated = s.decay(now)+float64(penalty), now
+		if s.value < banThreshold {
+			continue
+		}
+		// Score exceeded, ban the target with escalating durations
+		s.value, s.bans = 0, s.bans+1
+
+		var expiry time.Time
+		switch {
+		case s.bans <= maxTempBans:
+			expiry = now.Add(banDuration << uint(s.bans-1))
+		case penalty < PenaltyFatal:
+			expiry = now.Add(banDuration << uint(maxTempBans-1))
+		}
+		r.ban(target, expiry)
+		banned = true
+	}
+	return banned
+}
+
+// sweep drops the idle misbehavior scores of targets that aren't banned. The
+// method expects the lock to be held.
+func (r *reputation) sweep(now time.Time) {
+	if now.Sub(r.swept) < scoreHalfLife {
+		return
+	}
+	r.swept = now
+	for target, s := range r.scores {
+		if _, banned := r.bans[target]; !banned && now.Sub(s.updated) > scoreRetention {
+			delete(r.scores, target)
+		}
+	}
+}
+
+// ban bans a target until the given expiry, or permanently if the expiry is the
+// zero time. The method expects the lock to be held.
+func (r *reputation) ban(target string, expiry time.Time) {
+	r.bans[target] = expiry
+	if r.store != nil {
+		if err := r.store.StoreBan(target, expiry); err != nil {
+			log.Warn("Failed to persist peer ban", "target", target, "err", err)
+		}
+	}
+	if expiry.IsZero() {
+		log.Info("Banned peer permanently", "target", target)
+	} else {
+		log.Info("Banned peer", "target", target, "expires", expiry)
+	}
+}
+
+// banTarget bans a target for the given duration, or permanently if the
+// duration is zero.
+func (r *reputation) banTarget(target string, duration time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var expiry time.Time
+	if duration > 0 {
+		expiry = time.Now().Add(duration)
+	}
+	r.ban(target, expiry)
+}
+
+// unban lifts the ban of a target and resets its misbehavior score, returning
+// whether the target was banned at all.
+func (r *reputation) unban(target string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.scores, target)
+	if _, ok := r.bans[target]; !ok {
+		return false
+	}
+	delete(r.bans, target)
+	if r.store != nil {
+		if err := r.store.DeleteBan(target); err != nil {
+			log.Warn("Failed to delete peer ban", "target", target, "err", err)
+		}
+	}
+	return true
+}
+
+// banned returns whether a remote peer is banned either by node ID or by IP
+// address. Expired bans are lifted on the fly.
+func (r *reputation) banned(id discover.NodeID, ip net.IP, now time.Time) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, target := range targets(id, ip) {
+		expiry, ok := r.bans[target]
+		if !ok {
+			continue
+		}
+		if !expiry.IsZero() && now.After(expiry) {
+			delete(r.bans, target)
+			if r.store != nil {
+				r.store.DeleteBan(target)
+			}
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// list returns the active bans, sorted by target.
+func (r *reputation) list(now time.Time) []*BanInfo {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	infos := make([]*BanInfo, 0, len(r.bans))
+	for target, expiry := range r.bans {
+		info := &BanInfo{Target: target}
+		if !expiry.IsZero() {
+			if now.After(expiry) {
+				continue
+			}
+			expires := expiry
+			info.Expires = &expires
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Target < infos[j].Target })
+	return infos
+}
+
+// remoteIP returns the IP address of a remote network address, or nil if the
+// address is not a TCP one.
+func remoteIP(addr net.Addr) net.IP {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.IP
+	}
+	return nil
+}
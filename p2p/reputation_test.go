@@ -0,0 +1,165 @@
+package p2p
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kowala-tech/kUSD/p2p/discover"
+)
+
+// memoryBanStore is an in-memory ban store for testing.
+type memoryBanStore map[string]time.Time
+
+func (s memoryBanStore) Bans() map[string]time.Time {
+	bans := make(map[string]time.Time)
+	for target, expiry := range s {
+		bans[target] = expiry
+	}
+	return bans
+}
+
+func (s memoryBanStore) StoreBan(target string, expiry time.Time) error {
+	s[target] = expiry
+	return nil
+}
+
+func (s memoryBanStore) DeleteBan(target string) error {
+	delete(s, target)
+	return nil
+}
+
+// Tests that misbehavior scores decay over time and that a target only gets
+// banned once its decayed score exceeds the threshold.
+func TestReputationDecay(t *testing.T) {
+	var (
+		rep = newReputation(nil)
+		id  = randomID()
+		ip  = net.IP{10, 0, 0, 1}
+		now = time.Now()
+	)
+	if rep.misbehaved(id, ip, PenaltyMajor, now) {
+		t.Fatalf("peer banned after a single major penalty")
+	}
+	// After a half life the score halves, so another major penalty is not enough
+	now = now.Add(scoreHalfLife)
+	if rep.misbehaved(id, ip, PenaltyMajor, now) {
+		t.Fatalf("peer banned after a decayed major penalty")
+	}
+	// Without decay the next major penalty pushes the score over the threshold
+	if !rep.misbehaved(id, ip, PenaltyMajor, now) {
+		t.Fatalf("peer not banned after exceeding the threshold")
+	}
+	if !rep.banned(id, nil, now) {
+		t.Errorf("node not banned")
+	}
+	// Protocol violations aren't held against the IP address, attacks are
+	if rep.banned(randomID(), ip, now) {
+		t.Errorf("ip banned for protocol violations")
+	}
+	if !rep.misbehaved(randomID(), ip, PenaltyFatal, now) {
+		t.Fatalf("peer not banned by fatal penalty")
+	}
+	if !rep.banned(randomID(), ip, now) {
+		t.Errorf("ip not banned for an attack")
+	}
+	if rep.banned(randomID(), net.IP{10, 0, 0, 2}, now) {
+		t.Errorf("unrelated peer banned")
+	}
+	// Once the ban expires the peer is allowed back in
+	if rep.banned(id, ip, now.Add(banDuration+time.Second)) {
+		t.Errorf("peer still banned after expiry")
+	}
+}
+
+// Tests that repeated bans escalate in duration until they become permanent.
+func TestReputationEscalation(t *testing.T) {
+	var (
+		rep = newReputation(nil)
+		id  = randomID()
+		now = time.Now()
+	)
+	for i := 0; i < maxTempBans; i++ {
+		if !rep.misbehaved(id, nil, PenaltyFatal, now) {
+			t.Fatalf("ban %d: peer not banned by fatal penalty", i)
+		}
+		duration := banDuration << uint(i)
+		if !rep.banned(id, nil, now.Add(duration-time.Second)) {
+			t.Errorf("ban %d: peer unbanned before expiry", i)
+		}
+		now = now.Add(duration + time.Second)
+		if rep.banned(id, nil, now) {
+			t.Errorf("ban %d: peer still banned after expiry", i)
+		}
+	}
+	rep.misbehaved(id, nil, PenaltyFatal, now)
+	if !rep.banned(id, nil, now.Add(100*365*24*time.Hour)) {
+		t.Errorf("peer not banned permanently")
+	}
+}
+
+// Tests that bans for protocol violations other than attacks never become
+// permanent, however often they are repeated.
+func TestReputationEscalationCap(t *testing.T) {
+	var (
+		rep = newReputation(nil)
+		id  = randomID()
+		now = time.Now()
+	)
+	longest := banDuration << uint(maxTempBans-1)
+	for i := 0; i < maxTempBans+2; i++ {
+		rep.misbehaved(id, nil, PenaltyMajor, now)
+		if !rep.misbehaved(id, nil, PenaltyMajor, now) {
+			t.Fatalf("ban %d: peer not banned by major penalties", i)
+		}
+		now = now.Add(longest + time.Second)
+		if rep.banned(id, nil, now) {
+			t.Fatalf("ban %d: peer still banned after the longest ban", i)
+		}
+	}
+}
+
+// Tests that loopback addresses are never banned.
+func TestReputationLoopback(t *testing.T) {
+	rep := newReputation(nil)
+	now := time.Now()
+
+	rep.misbehaved(randomID(), net.IP{127, 0, 0, 1}, PenaltyFatal, now)
+	if rep.banned(randomID(), net.IP{127, 0, 0, 1}, now) {
+		t.Errorf("loopback address banned")
+	}
+}
+
+// Tests that bans are persisted in the ban store and restored from it.
+func TestReputationPersistence(t *testing.T) {
+	var (
+		store = make(memoryBanStore)
+		rep   = newReputation(store)
+		id    = randomID()
+		ip    = net.IP{10, 0, 0, 1}
+	)
+	rep.banTarget(nodeTarget(id), 0)
+	rep.banTarget(ipTarget(ip), time.Hour)
+	store["ip:10.0.0.2"] = time.Now().Add(-time.Second)
+
+	rep = newReputation(store)
+	if !rep.banned(id, nil, time.Now()) {
+		t.Errorf("node ban not restored")
+	}
+	if !rep.banned(discover.NodeID{}, ip, time.Now()) {
+		t.Errorf("ip ban not restored")
+	}
+	if _, ok := store["ip:10.0.0.2"]; ok {
+		t.Errorf("expired ban not dropped from store")
+	}
+	bans := rep.list(time.Now())
+	if len(bans) != 2 {
+		t.Fatalf("ban count mismatch: have %d, want %d", len(bans), 2)
+	}
+	if !rep.unban(nodeTarget(id)) {
+		t.Errorf("node ban not lifted")
+	}
+	if _, ok := store[nodeTarget(id)]; ok {
+		t.Errorf("lifted ban not dropped from store")
+	}
+}
@@ -15,6 +15,8 @@ import (
 	"github.com/kowala-tech/kUSD/log"
 	"github.com/kowala-tech/kUSD/p2p/discover"
 	"github.com/kowala-tech/kUSD/p2p/discv5"
+	"github.com/kowala-tech/kUSD/p2p/dnsdisc"
+	"github.com/kowala-tech/kUSD/p2p/enr"
 	"github.com/kowala-tech/kUSD/p2p/nat"
 	"github.com/kowala-tech/kUSD/p2p/netutil"
 )
@@ -78,6 +80,10 @@ type Config struct {
 	// protocol.
 	BootstrapNodesV5 []*discv5.Node `toml:",omitempty"`
 
+	// DNSNodeLists are enrtree:// URLs of DNS node lists which are synced
+	// in the background and used as additional dial candidates.
+	DNSNodeLists []string `toml:",omitempty"`
+
 	// Static nodes are used as pre-configured connections which are always
 	// maintained and re-connected on disconnects.
 	StaticNodes []*discover.Node
@@ -86,6 +92,16 @@ type Config struct {
 	// allowed to connect, even above the peer limit.
 	TrustedNodes []*discover.Node
 
+	// BehindSentry hides the node behind sentry nodes. If set, the node
+	// disables discovery and only connects to and accepts connections from its
+	// trusted nodes, which act as its sentries towards the public network.
+	BehindSentry bool `toml:",omitempty"`
+
+	// PrivatePeers are the nodes (usually validators) this node acts as a
+	// sentry for. They are always kept connected and trusted, and are never
+	// disclosed to the network through discovery.
+	PrivatePeers []*discover.Node `toml:",omitempty"`
+
 	// Connectivity can be restricted to certain IP networks.
 	// If this option is set to a non-nil value, only hosts which match one of the
 	// IP networks contained in the list are considered.
@@ -123,6 +139,15 @@ type Config struct {
 	// If EnableMsgEvents is set then the server will emit PeerEvents
 	// whenever a message is sent to or received from a peer
 	EnableMsgEvents bool
+
+	// MsgCapture is the path of a file that raw protocol messages are
+	// captured to for debugging. Capture is disabled if empty. The file
+	// is rotated at 256MB, keeping the previous one with a ".1" suffix.
+	MsgCapture string `toml:",omitempty"`
+
+	// MsgCaptureFilter selects the captured messages. All messages are
+	// captured if it's empty.
+	MsgCaptureFilter []MsgFilter `toml:",omitempty"`
 }
 
 // Server manages all peer connections.
@@ -143,6 +168,9 @@ type Server struct {
 	ourHandshake *protoHandshake
 	lastLookup   time.Time
 	DiscV5       *discv5.Network
+	dns          *dnsdisc.Client
+	reputation   *reputation
+	capture      *msgCapture
 
 	// These are for Peers, PeerCount (and nothing else).
 	peerOp     chan peerOpFunc
@@ -281,6 +309,67 @@ func (srv *Server) RemovePeer(node *discover.Node) {
 	}
 }
 
+// BanNode bans the given node from connecting for the specified duration, or
+// permanently if the duration is zero. The node is disconnected if connected.
+func (srv *Server) BanNode(id discover.NodeID, duration time.Duration) {
+	if srv.reputation == nil {
+		return
+	}
+	srv.reputation.banTarget(nodeTarget(id), duration)
+	srv.dropBanned()
+}
+
+// BanIP bans all nodes from the given IP address from connecting for the
+// specified duration, or permanently if the duration is zero. Any such nodes
+// are disconnected if connected.
+func (srv *Server) BanIP(ip net.IP, duration time.Duration) {
+	if srv.reputation == nil {
+		return
+	}
+	srv.reputation.banTarget(ipTarget(ip), duration)
+	srv.dropBanned()
+}
+
+// UnbanNode lifts the ban of the given node, returning whether it was banned.
+func (srv *Server) UnbanNode(id discover.NodeID) bool {
+	if srv.reputation == nil {
+		return false
+	}
+	return srv.reputation.unban(nodeTarget(id))
+}
+
+// UnbanIP lifts the ban of the given IP address, returning whether it was
+// banned.
+func (srv *Server) UnbanIP(ip net.IP) bool {
+	if srv.reputation == nil {
+		return false
+	}
+	return srv.reputation.unban(ipTarget(ip))
+}
+
+// Bans returns the currently active node and IP address bans.
+func (srv *Server) Bans() []*BanInfo {
+	if srv.reputation == nil {
+		return nil
+	}
+	return srv.reputation.list(time.Now())
+}
+
+// dropBanned disconnects all connected peers that are banned.
+func (srv *Server) dropBanned() {
+	select {
+	case srv.peerOp <- func(peers map[discover.NodeID]*Peer) {
+		for _, p := range peers {
+			if !p.rw.is(trustedConn) && srv.reputation.banned(p.ID(), remoteIP(p.RemoteAddr()), time.Now()) {
+				p.Disconnect(DiscUselessPeer)
+			}
+		}
+	}:
+		<-srv.peerOpDone
+	case <-srv.quit:
+	}
+}
+
 // SubscribePeers subscribes the given channel to peer events
 func (srv *Server) SubscribeEvents(ch chan *PeerEvent) event.Subscription {
 	return srv.peerFeed.Subscribe(ch)
@@ -317,6 +406,48 @@ func (srv *Server) makeSelf(listener net.Listener, ntab discoverTable) *discover
 	return ntab.Self()
 }
 
+// SetRecordEntries adds or updates entries in the node record published on the
+// discovery network. It's a no-op if discovery isn't running.
+func (srv *Server) SetRecordEntries(entries ...enr.Entry) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if ntab, ok := srv.ntab.(*discover.Table); ok && srv.running {
+		return ntab.SetRecordEntries(entries...)
+	}
+	return nil
+}
+
+// nodeFilter assembles the node filters of the running protocols into a filter
+// on dynamic dial candidates, checking their records found by discovery. Nodes
+// without a known record are always accepted, leaving it to the protocol
+// handshakes to reject unsuitable ones.
+func (srv *Server) nodeFilter(ntab *discover.Table) func(*discover.Node) bool {
+	var filters []func(*enr.Record) bool
+	for _, p := range srv.Protocols {
+		if p.NodeFilter == nil {
+			// The protocol accepts any node, no point in filtering
+			return nil
+		}
+		filters = append(filters, p.NodeFilter)
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+	return func(n *discover.Node) bool {
+		record := ntab.Record(n.ID)
+		if record == nil {
+			return true
+		}
+		for _, filter := range filters {
+			if filter(record) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // Stop terminates the server and all active peer connections.
 // It blocks until all active connections have been closed.
 func (srv *Server) Stop() {
@@ -365,7 +496,13 @@ func (srv *Server) Start() (err error) {
 	srv.peerOpDone = make(chan struct{})
 
 	// node table
-	if !srv.NoDiscovery {
+	if srv.BehindSentry {
+		if len(srv.TrustedNodes) == 0 {
+			log.Warn("P2P server will be useless, hiding behind sentries but none are trusted")
+		}
+		log.Info("Hiding behind sentry nodes", "sentries", len(srv.TrustedNodes))
+	}
+	if !srv.NoDiscovery && !srv.BehindSentry {
 		ntab, err := discover.ListenUDP(srv.PrivateKey, srv.ListenAddr, srv.NAT, srv.NodeDatabase, srv.NetRestrict)
 		if err != nil {
 			return err
@@ -373,10 +510,34 @@ func (srv *Server) Start() (err error) {
 		if err := ntab.SetFallbackNodes(srv.BootstrapNodes); err != nil {
 			return err
 		}
+		if len(srv.PrivatePeers) > 0 {
+			ids := make([]discover.NodeID, len(srv.PrivatePeers))
+			for i, n := range srv.PrivatePeers {
+				ids[i] = n.ID
+			}
+			ntab.SetHidden(ids)
+		}
+		// publish the protocol attributes in the local node record
+		var attrs []enr.Entry
+		for _, p := range srv.Protocols {
+			attrs = append(attrs, p.Attributes...)
+		}
+		if err := ntab.SetRecordEntries(attrs...); err != nil {
+			return err
+		}
 		srv.ntab = ntab
+
+		if len(srv.DNSNodeLists) > 0 {
+			client, err := dnsdisc.NewClient(dnsdisc.Config{}, srv.DNSNodeLists...)
+			if err != nil {
+				return err
+			}
+			client.Start()
+			srv.dns = client
+		}
 	}
 
-	if srv.DiscoveryV5 {
+	if srv.DiscoveryV5 && !srv.BehindSentry {
 		ntab, err := discv5.ListenUDP(srv.PrivateKey, srv.DiscoveryV5Addr, srv.NAT, "", srv.NetRestrict) //srv.NodeDatabase)
 		if err != nil {
 			return err
@@ -387,11 +548,35 @@ func (srv *Server) Start() (err error) {
 		srv.DiscV5 = ntab
 	}
 
+	// peer reputation, persisted in the node database if discovery is running
+	var bans banStore
+	if ntab, ok := srv.ntab.(*discover.Table); ok {
+		bans = ntab
+	}
+	srv.reputation = newReputation(bans)
+
+	// message capture
+	if srv.MsgCapture != "" {
+		capture, err := newMsgCapture(srv.MsgCapture, srv.MsgCaptureFilter)
+		if err != nil {
+			return err
+		}
+		log.Info("Capturing p2p messages", "file", srv.MsgCapture, "filters", len(srv.MsgCaptureFilter))
+		srv.capture = capture
+	}
+
 	dynPeers := (srv.MaxPeers + 1) / 2
-	if srv.NoDiscovery {
+	if srv.NoDiscovery || srv.BehindSentry {
 		dynPeers = 0
 	}
-	dialer := newDialState(srv.StaticNodes, srv.BootstrapNodes, srv.ntab, dynPeers, srv.NetRestrict)
+	dialer := newDialState(srv.persistentNodes(), srv.BootstrapNodes, srv.ntab, dynPeers, srv.NetRestrict)
+	dialer.reputation = srv.reputation
+	if ntab, ok := srv.ntab.(*discover.Table); ok {
+		dialer.filter = srv.nodeFilter(ntab)
+	}
+	if srv.dns != nil {
+		dialer.dns = srv.dns
+	}
 
 	// handshake
 	srv.ourHandshake = &protoHandshake{Version: baseProtocolVersion, Name: srv.Name, ID: discover.PubkeyID(&srv.PrivateKey.PublicKey)}
@@ -414,6 +599,16 @@ func (srv *Server) Start() (err error) {
 	return nil
 }
 
+// persistentNodes returns the nodes the server keeps connected to at all times.
+// Nodes behind sentries only keep connected to their sentries, while sentries
+// keep connected to their private peers on top of the static nodes.
+func (srv *Server) persistentNodes() []*discover.Node {
+	if srv.BehindSentry {
+		return srv.TrustedNodes
+	}
+	return append(append([]*discover.Node{}, srv.StaticNodes...), srv.PrivatePeers...)
+}
+
 func (srv *Server) startListening() error {
 	// Launch the TCP listener.
 	listener, err := net.Listen("tcp", srv.ListenAddr)
@@ -458,6 +653,9 @@ func (srv *Server) run(dialstate dialer) {
 	for _, n := range srv.TrustedNodes {
 		trusted[n.ID] = true
 	}
+	for _, n := range srv.PrivatePeers {
+		trusted[n.ID] = true
+	}
 
 	// removes t from runningTasks
 	delTask := func(t task) {
@@ -548,6 +746,8 @@ running:
 				if srv.EnableMsgEvents {
 					p.events = &srv.peerFeed
 				}
+				p.reputation = srv.reputation
+				p.capture = srv.capture
 				name := truncateName(c.name)
 				log.Debug("Adding p2p peer", "id", c.id, "name", name, "addr", c.fd.RemoteAddr(), "peers", len(peers)+1)
 				peers[c.id] = p
@@ -575,6 +775,9 @@ running:
 	if srv.ntab != nil {
 		srv.ntab.Close()
 	}
+	if srv.dns != nil {
+		srv.dns.Stop()
+	}
 	if srv.DiscV5 != nil {
 		srv.DiscV5.Close()
 	}
@@ -590,11 +793,17 @@ running:
 		p.log.Trace("<-delpeer (spindown)", "remainingTasks", len(runningTasks))
 		delete(peers, p.ID())
 	}
+	// Stop capturing messages once no peer is left to send them.
+	if srv.capture != nil {
+		if err := srv.capture.close(); err != nil {
+			log.Warn("Failed to close message capture", "err", err)
+		}
+	}
 }
 
 func (srv *Server) protoHandshakeChecks(peers map[discover.NodeID]*Peer, c *conn) error {
 	// Drop connections with no matching protocols.
-	if len(srv.Protocols) > 0 && countMatchingProtocols(srv.Protocols, c.caps) == 0 {
+	if srv.useless(c.caps) {
 		return DiscUselessPeer
 	}
 	// Repeat the encryption handshake checks because the
@@ -602,14 +811,24 @@ func (srv *Server) protoHandshakeChecks(peers map[discover.NodeID]*Peer, c *conn
 	return srv.encHandshakeChecks(peers, c)
 }
 
+// useless reports whether a node announcing the given capabilities has no
+// protocol in common with the server.
+func (srv *Server) useless(caps []Cap) bool {
+	return len(srv.Protocols) > 0 && countMatchingProtocols(srv.Protocols, caps) == 0
+}
+
 func (srv *Server) encHandshakeChecks(peers map[discover.NodeID]*Peer, c *conn) error {
 	switch {
+	case srv.BehindSentry && !c.is(trustedConn):
+		return DiscUselessPeer
 	case !c.is(trustedConn|staticDialedConn) && len(peers) >= srv.MaxPeers:
 		return DiscTooManyPeers
 	case peers[c.id] != nil:
 		return DiscAlreadyConnected
 	case c.id == srv.Self().ID:
 		return DiscSelf
+	case !c.is(trustedConn) && srv.reputation != nil && srv.reputation.banned(c.id, remoteIP(c.fd.RemoteAddr()), time.Now()):
+		return DiscUselessPeer
 	default:
 		return nil
 	}
@@ -681,8 +900,8 @@ func (srv *Server) listenLoop() {
 
 // SetupConn runs the handshakes and attempts to add the connection
 // as a peer. It returns when the connection has been added as a peer
-// or the handshakes have failed.
-func (srv *Server) SetupConn(fd net.Conn, flags connFlag, dialDest *discover.Node) {
+// or the handshakes have failed, reporting the reason of the failure.
+func (srv *Server) SetupConn(fd net.Conn, flags connFlag, dialDest *discover.Node) error {
 	// Prevent leftover pending conns from entering the handshake.
 	srv.lock.Lock()
 	running := srv.running
@@ -690,47 +909,51 @@ func (srv *Server) SetupConn(fd net.Conn, flags connFlag, dialDest *discover.Nod
 	c := &conn{fd: fd, transport: srv.newTransport(fd), flags: flags, cont: make(chan error)}
 	if !running {
 		c.close(errServerStopped)
-		return
+		return errServerStopped
 	}
 	// Run the encryption handshake.
 	var err error
 	if c.id, err = c.doEncHandshake(srv.PrivateKey, dialDest); err != nil {
 		log.Trace("Failed RLPx handshake", "addr", c.fd.RemoteAddr(), "conn", c.flags, "err", err)
 		c.close(err)
-		return
+		return err
 	}
 	clog := log.New("id", c.id, "addr", c.fd.RemoteAddr(), "conn", c.flags)
 	// For dialed connections, check that the remote public key matches.
 	if dialDest != nil && c.id != dialDest.ID {
 		c.close(DiscUnexpectedIdentity)
 		clog.Trace("Dialed identity mismatch", "want", c, dialDest.ID)
-		return
+		return DiscUnexpectedIdentity
 	}
 	if err := srv.checkpoint(c, srv.posthandshake); err != nil {
 		clog.Trace("Rejected peer before protocol handshake", "err", err)
 		c.close(err)
-		return
+		return err
 	}
 	// Run the protocol handshake
 	phs, err := c.doProtoHandshake(srv.ourHandshake)
 	if err != nil {
 		clog.Trace("Failed proto handshake", "err", err)
 		c.close(err)
-		return
+		return err
 	}
 	if phs.ID != c.id {
 		clog.Trace("Wrong devp2p handshake identity", "err", phs.ID)
 		c.close(DiscUnexpectedIdentity)
-		return
+		return DiscUnexpectedIdentity
 	}
 	c.caps, c.name = phs.Caps, phs.Name
 	if err := srv.checkpoint(c, srv.addpeer); err != nil {
 		clog.Trace("Rejected peer", "err", err)
 		c.close(err)
-		return
+		if err == DiscUselessPeer && srv.useless(c.caps) {
+			return &ProtocolMismatchError{Name: c.name, Caps: c.caps}
+		}
+		return err
 	}
 	// If the checks completed successfully, runPeer has now been
 	// launched by run.
+	return nil
 }
 
 func truncateName(s string) string {
@@ -343,6 +343,47 @@ func TestServerAtCap(t *testing.T) {
 
 }
 
+func TestServerBehindSentry(t *testing.T) {
+	sentryID, privateID := randomID(), randomID()
+	srv := &Server{
+		Config: Config{
+			PrivateKey:   newkey(),
+			MaxPeers:     10,
+			NoDial:       true,
+			BehindSentry: true,
+			TrustedNodes: []*discover.Node{{ID: sentryID}},
+			PrivatePeers: []*discover.Node{{ID: privateID}},
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	if srv.ntab != nil {
+		t.Error("discovery running behind sentries")
+	}
+	newconn := func(id discover.NodeID) *conn {
+		fd, _ := net.Pipe()
+		tx := newTestTransport(id, fd)
+		return &conn{fd: fd, transport: tx, flags: inboundConn, id: id, cont: make(chan error)}
+	}
+	// Connections from nodes other than the sentries must be rejected.
+	if err := srv.checkpoint(newconn(randomID()), srv.posthandshake); err != DiscUselessPeer {
+		t.Error("wrong error for public conn:", err)
+	}
+	// Sentries and private peers are trusted and accepted.
+	for _, id := range []discover.NodeID{sentryID, privateID} {
+		c := newconn(id)
+		if err := srv.checkpoint(c, srv.posthandshake); err != nil {
+			t.Errorf("unexpected error for conn %x: %v", id[:8], err)
+		}
+		if !c.is(trustedConn) {
+			t.Errorf("conn %x not trusted", id[:8])
+		}
+	}
+}
+
 func TestServerSetupConn(t *testing.T) {
 	id := randomID()
 	srvkey := newkey()
@@ -353,6 +394,7 @@ func TestServerSetupConn(t *testing.T) {
 		flags     connFlag
 		dialDest  *discover.Node
 
+		wantErr      error // defaults to wantCloseErr
 		wantCloseErr error
 		wantCalls    string
 	}{
@@ -396,9 +438,10 @@ func TestServerSetupConn(t *testing.T) {
 			wantCloseErr: DiscSelf,
 		},
 		{
-			tt:           &setupTransport{id: id, phs: &protoHandshake{ID: id}},
+			tt:           &setupTransport{id: id, phs: &protoHandshake{ID: id, Name: "other", Caps: []Cap{{"other", 1}}}},
 			flags:        inboundConn,
 			wantCalls:    "doEncHandshake,doProtoHandshake,close,",
+			wantErr:      &ProtocolMismatchError{Name: "other", Caps: []Cap{{"other", 1}}},
 			wantCloseErr: DiscUselessPeer,
 		},
 	}
@@ -419,7 +462,14 @@ func TestServerSetupConn(t *testing.T) {
 			}
 		}
 		p1, _ := net.Pipe()
-		srv.SetupConn(p1, test.flags, test.dialDest)
+		err := srv.SetupConn(p1, test.flags, test.dialDest)
+		wantErr := test.wantErr
+		if wantErr == nil {
+			wantErr = test.wantCloseErr
+		}
+		if !reflect.DeepEqual(err, wantErr) {
+			t.Errorf("test %d: error mismatch: got %q, want %q", i, err, wantErr)
+		}
 		if !reflect.DeepEqual(test.tt.closeErr, test.wantCloseErr) {
 			t.Errorf("test %d: close error mismatch: got %q, want %q", i, test.tt.closeErr, test.wantCloseErr)
 		}
@@ -82,7 +82,8 @@ func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 			Dialer:          s,
 			EnableMsgEvents: true,
 		},
-		NoUSB: true,
+		NoUSB:             true,
+		UseLightweightKDF: true,
 	})
 	if err != nil {
 		return nil, err
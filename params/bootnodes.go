@@ -8,6 +8,14 @@ var MainnetBootnodes = []string{}
 // test network.
 var TestnetBootnodes = []string{}
 
+// MainnetDNSLists are the enrtree:// URLs of the DNS node lists of the main
+// Kowala network.
+var MainnetDNSLists = []string{}
+
+// TestnetDNSLists are the enrtree:// URLs of the DNS node lists of the test
+// network.
+var TestnetDNSLists = []string{}
+
 // DiscoveryV5Bootnodes are the enode URLs of the P2P bootstrap nodes for the
 // experimental RLPx v5 topic-discovery network.
 var DiscoveryV5Bootnodes = []string{}
@@ -0,0 +1,212 @@
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common/hexutil"
+)
+
+var (
+	// ErrMissingCredentials is returned if a request to an authenticated endpoint
+	// carries no bearer token.
+	ErrMissingCredentials = errors.New("missing credentials")
+
+	// ErrInvalidCredentials is returned if the bearer token of a request is not a
+	// known API key nor a valid JWT token of a known subject.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// AuthConfig is the format of the file authenticating HTTP and websocket RPC
+// clients. Permissions list the namespaces (e.g. "admin") and the individual
+// methods (e.g. "eth_blockNumber") a client may call.
+type AuthConfig struct {
+	// JWTSecret is the hex encoded HMAC secret verifying HS256 JWT tokens. JWT
+	// authentication is disabled if empty.
+	JWTSecret string `json:"jwtSecret,omitempty"`
+
+	// JWTSubjects maps the subject of JWT tokens to their permissions.
+	JWTSubjects map[string][]string `json:"jwtSubjects,omitempty"`
+
+	// APIKeys maps static API keys to their permissions.
+	APIKeys map[string][]string `json:"apiKeys,omitempty"`
+}
+
+// grantKey is the context key of the grant of authenticated clients.
+type grantKey struct{}
+
+// Grant is the set of namespaces and methods an authenticated client may call.
+type Grant struct {
+	id         string // Identity of the credentials, tracking their request rate
+	namespaces map[string]bool
+	methods    map[string]bool
+}
+
+func newGrant(id string, permissions []string) *Grant {
+	grant := &Grant{
+		id:         id,
+		namespaces: make(map[string]bool),
+		methods:    make(map[string]bool),
+	}
+	for _, permission := range permissions {
+		if strings.Contains(permission, serviceMethodSeparator) {
+			grant.methods[permission] = true
+		} else {
+			grant.namespaces[permission] = true
+		}
+	}
+	return grant
+}
+
+// Allows reports whether the method of the given namespace may be called.
+func (g *Grant) Allows(namespace, method string) bool {
+	return g.namespaces[namespace] || g.methods[namespace+serviceMethodSeparator+method]
+}
+
+// Authenticator verifies the credentials of HTTP and websocket requests, which
+// are passed as a bearer token in the Authorization header.
+type Authenticator struct {
+	secret   []byte            // HMAC secret of the JWT tokens, nil if disabled
+	subjects map[string]*Grant // Permissions of the JWT token subjects
+	keys     map[string]*Grant // Permissions of the static API keys
+}
+
+// NewAuthenticator creates an authenticator from its configuration.
+func NewAuthenticator(config *AuthConfig) (*Authenticator, error) {
+	auth := &Authenticator{
+		subjects: make(map[string]*Grant),
+		keys:     make(map[string]*Grant),
+	}
+	if config.JWTSecret != "" {
+		secret, err := hexutil.Decode(config.JWTSecret)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) < 32 {
+			return nil, errors.New("JWT secret must be at least 32 bytes")
+		}
+		auth.secret = secret
+	}
+	for subject, permissions := range config.JWTSubjects {
+		auth.subjects[subject] = newGrant("jwt:"+subject, permissions)
+	}
+	for key, permissions := range config.APIKeys {
+		auth.keys[key] = newGrant("key:"+key, permissions)
+	}
+	return auth, nil
+}
+
+// LoadAuthenticator creates an authenticator from the JSON configuration file
+// at path.
+func LoadAuthenticator(path string) (*Authenticator, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := new(AuthConfig)
+	if err := json.Unmarshal(blob, config); err != nil {
+		return nil, err
+	}
+	return NewAuthenticator(config)
+}
+
+// Authenticate checks the bearer token of the request, returning the namespaces
+// and methods it grants access to.
+func (a *Authenticator) Authenticate(r *http.Request) (*Grant, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, ErrMissingCredentials
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+
+	if grant, ok := a.keys[token]; ok {
+		return grant, nil
+	}
+	if a.secret == nil || strings.Count(token, ".") != 2 {
+		return nil, ErrInvalidCredentials
+	}
+	subject, err := a.verifyJWT(token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	grant, ok := a.subjects[subject]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return grant, nil
+}
+
+// Protect wraps an HTTP handler served next to the RPC endpoints, only letting
+// through the clients granted the given namespace.
+func (a *Authenticator) Protect(namespace string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grant, err := a.Authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !grant.namespaces[namespace] {
+			http.Error(w, fmt.Sprintf("namespace %s not permitted", namespace), http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// jwtHeader is the header of the supported JWT tokens.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// jwtClaims are the verified claims of JWT tokens.
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+}
+
+// verifyJWT checks the HS256 signature and the validity period of a JWT token,
+// returning its subject.
+func (a *Authenticator) verifyJWT(token string, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return "", ErrInvalidCredentials
+	}
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return "", ErrInvalidCredentials
+	}
+	var claims jwtClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return "", ErrInvalidCredentials
+	}
+	if claims.ExpiresAt != 0 && now.Unix() >= claims.ExpiresAt {
+		return "", errors.New("token expired")
+	}
+	if claims.NotBefore != 0 && now.Unix() < claims.NotBefore {
+		return "", errors.New("token not yet valid")
+	}
+	return claims.Subject, nil
+}
+
+// decodeJWTSegment decodes a base64url encoded JSON segment of a JWT token.
+func decodeJWTSegment(segment string, v interface{}) error {
+	blob, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(blob, v)
+}
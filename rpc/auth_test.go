@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kowala-tech/kUSD/common/hexutil"
+)
+
+var testJWTSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// makeJWT creates an HS256 JWT token with the given claims.
+func makeJWT(secret []byte, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Tests that HTTP requests are authenticated and only dispatched to the granted
+// namespaces and methods.
+func TestHTTPAuthentication(t *testing.T) {
+	auth, err := NewAuthenticator(&AuthConfig{
+		JWTSecret:   hexutil.Encode(testJWTSecret),
+		JWTSubjects: map[string][]string{"ops": {"test"}},
+		APIKeys:     map[string][]string{"monitor": {"test_rets"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+	server := newTestServer("test", new(Service))
+	server.SetAuthenticator(auth)
+	defer server.Stop()
+
+	expired := time.Now().Add(-time.Minute).Unix()
+	tests := []struct {
+		token  string
+		method string
+		code   int    // expected HTTP status code
+		result string // expected substring of the response
+	}{
+		{"", "test_rets", http.StatusUnauthorized, ErrMissingCredentials.Error()},
+		{"unknown", "test_rets", http.StatusUnauthorized, ErrInvalidCredentials.Error()},
+		{"monitor", "test_rets", http.StatusOK, `"result":""`},
+		{"monitor", "test_noArgsRets", http.StatusOK, "is not permitted"},
+		{makeJWT(testJWTSecret, map[string]interface{}{"sub": "ops"}), "test_noArgsRets", http.StatusOK, `"result":null`},
+		{makeJWT(testJWTSecret, map[string]interface{}{"sub": "ops", "exp": expired}), "test_rets", http.StatusUnauthorized, "token expired"},
+		{makeJWT(testJWTSecret, map[string]interface{}{"sub": "dev"}), "test_rets", http.StatusUnauthorized, ErrInvalidCredentials.Error()},
+		{makeJWT([]byte("wrong secret, wrong secret, wrong"), map[string]interface{}{"sub": "ops"}), "test_rets", http.StatusUnauthorized, ErrInvalidCredentials.Error()},
+	}
+	for i, tt := range tests {
+		body := `{"jsonrpc":"2.0","id":1,"method":"` + tt.method + `","params":[]}`
+		req := httptest.NewRequest("POST", "http://url.com", strings.NewReader(body))
+		req.Header.Set("content-type", contentType)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+
+		if rec.Code != tt.code {
+			t.Errorf("test %d: status code mismatch: have %d, want %d", i, rec.Code, tt.code)
+		}
+		if !strings.Contains(rec.Body.String(), tt.result) {
+			t.Errorf("test %d: response mismatch: have %q, want %q", i, rec.Body.String(), tt.result)
+		}
+	}
+}
+
+// Tests that HTTP clients authenticate through the bearer token set as header.
+func TestHTTPClientAuthentication(t *testing.T) {
+	auth, err := NewAuthenticator(&AuthConfig{
+		APIKeys: map[string][]string{"monitor": {"test"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+	server := newTestServer("test", new(Service))
+	server.SetAuthenticator(auth)
+	defer server.Stop()
+
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+
+	client, err := DialHTTP(httpsrv.URL)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	var result Result
+	if err := client.Call(&result, "test_echo", "hello", 10, &Args{"world"}); err == nil {
+		t.Fatal("unauthenticated call succeeded")
+	}
+	client.SetHeader("Authorization", "Bearer monitor")
+	if err := client.Call(&result, "test_echo", "hello", 10, &Args{"world"}); err != nil {
+		t.Fatalf("authenticated call failed: %v", err)
+	}
+	if want := (Result{"hello", 10, &Args{"world"}}); !reflect.DeepEqual(result, want) {
+		t.Errorf("result mismatch: have %v, want %v", result, want)
+	}
+}
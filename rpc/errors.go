@@ -48,3 +48,19 @@ type shutdownError struct{}
 func (e *shutdownError) ErrorCode() int { return -32000 }
 
 func (e *shutdownError) Error() string { return "server is shutting down" }
+
+// issued when an authenticated client calls a method it was not granted
+type unauthorizedError struct{ service, method string }
+
+func (e *unauthorizedError) ErrorCode() int { return -32001 }
+
+func (e *unauthorizedError) Error() string {
+	return fmt.Sprintf("The method %s%s%s is not permitted", e.service, serviceMethodSeparator, e.method)
+}
+
+// issued when a client exceeds one of the configured resource limits
+type limitExceededError struct{ message string }
+
+func (e *limitExceededError) ErrorCode() int { return -32005 }
+
+func (e *limitExceededError) Error() string { return e.message }
@@ -27,6 +27,7 @@ var nullAddr, _ = net.ResolveTCPAddr("tcp", "127.0.0.1:0")
 type httpConn struct {
 	client    *http.Client
 	req       *http.Request
+	headerMu  sync.Mutex // Protects the headers of req, set after dialing
 	closeOnce sync.Once
 	closed    chan struct{}
 }
@@ -64,6 +65,19 @@ func DialHTTP(endpoint string) (*Client, error) {
 	})
 }
 
+// SetHeader adds a custom HTTP header to the requests of the client, e.g. the
+// bearer token of an endpoint requiring authentication. It has no effect on
+// clients not connected over HTTP.
+func (c *Client) SetHeader(key, value string) {
+	if !c.isHTTP {
+		return
+	}
+	hc := c.writeConn.(*httpConn)
+	hc.headerMu.Lock()
+	hc.req.Header.Set(key, value)
+	hc.headerMu.Unlock()
+}
+
 func (c *Client) sendHTTP(ctx context.Context, op *requestOp, msg interface{}) error {
 	hc := c.writeConn.(*httpConn)
 	respBody, err := hc.doRequest(ctx, msg)
@@ -102,6 +116,12 @@ func (hc *httpConn) doRequest(ctx context.Context, msg interface{}) (io.ReadClos
 		return nil, err
 	}
 	req := hc.req.WithContext(ctx)
+	hc.headerMu.Lock()
+	req.Header = make(http.Header, len(hc.req.Header))
+	for key, values := range hc.req.Header {
+		req.Header[key] = values
+	}
+	hc.headerMu.Unlock()
 	req.Body = ioutil.NopCloser(bytes.NewReader(body))
 	req.ContentLength = int64(len(body))
 
@@ -127,7 +147,7 @@ func (t *httpReadWriteNopCloser) Close() error {
 //
 // Deprecated: Server implements http.Handler
 func NewHTTPServer(cors []string, srv *Server) *http.Server {
-	return &http.Server{Handler: newCorsHandler(srv, cors)}
+	return &http.Server{Handler: NewCorsHandler(srv, cors)}
 }
 
 // ServeHTTP serves JSON-RPC requests over HTTP.
@@ -136,28 +156,48 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" && r.ContentLength == 0 && r.URL.RawQuery == "" {
 		return
 	}
-	if code, err := validateRequest(r); err != nil {
+	maxSize := srv.maxRequestSize()
+	if code, err := validateRequest(r, maxSize); err != nil {
+		if code == http.StatusRequestEntityTooLarge {
+			sizeLimitCounter.Inc(1)
+			w.Header().Set("content-type", contentType)
+			w.WriteHeader(code)
+			codec := NewJSONCodec(&httpReadWriteNopCloser{r.Body, w})
+			codec.Write(codec.CreateErrorResponse(nil, &limitExceededError{err.Error()}))
+			return
+		}
 		http.Error(w, err.Error(), code)
 		return
 	}
+	ctx := context.Background()
+	var grant *Grant
+	if srv.auth != nil {
+		var err error
+		if grant, err = srv.auth.Authenticate(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		ctx = context.WithValue(ctx, grantKey{}, grant)
+	}
+	ctx = context.WithValue(ctx, clientKey{}, clientID(r, grant))
 	// All checks passed, create a codec that reads direct from the request body
 	// untilEOF and writes the response to w and order the server to process a
 	// single request.
-	codec := NewJSONCodec(&httpReadWriteNopCloser{r.Body, w})
+	codec := NewJSONCodec(&httpReadWriteNopCloser{http.MaxBytesReader(w, r.Body, maxSize), w})
 	defer codec.Close()
 
 	w.Header().Set("content-type", contentType)
-	srv.ServeSingleRequest(codec, OptionMethodInvocation)
+	srv.serveRequest(ctx, codec, true, OptionMethodInvocation)
 }
 
 // validateRequest returns a non-zero response code and error message if the
 // request is invalid.
-func validateRequest(r *http.Request) (int, error) {
+func validateRequest(r *http.Request, maxSize int64) (int, error) {
 	if r.Method == "PUT" || r.Method == "DELETE" {
 		return http.StatusMethodNotAllowed, errors.New("method not allowed")
 	}
-	if r.ContentLength > maxHTTPRequestContentLength {
-		err := fmt.Errorf("content length too large (%d>%d)", r.ContentLength, maxHTTPRequestContentLength)
+	if r.ContentLength > maxSize {
+		err := fmt.Errorf("content length too large (%d>%d)", r.ContentLength, maxSize)
 		return http.StatusRequestEntityTooLarge, err
 	}
 	mt, _, err := mime.ParseMediaType(r.Header.Get("content-type"))
@@ -168,10 +208,12 @@ func validateRequest(r *http.Request) (int, error) {
 	return 0, nil
 }
 
-func newCorsHandler(srv *Server, allowedOrigins []string) http.Handler {
+// NewCorsHandler wraps an HTTP handler served on the HTTP RPC endpoint with the
+// CORS configuration of the endpoint.
+func NewCorsHandler(h http.Handler, allowedOrigins []string) http.Handler {
 	// disable CORS support if user has not specified a custom CORS configuration
 	if len(allowedOrigins) == 0 {
-		return srv
+		return h
 	}
 
 	c := cors.New(cors.Options{
@@ -180,5 +222,5 @@ func newCorsHandler(srv *Server, allowedOrigins []string) http.Handler {
 		MaxAge:         600,
 		AllowedHeaders: []string{"*"},
 	})
-	return c.Handler(srv)
+	return c.Handler(h)
 }
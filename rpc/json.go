@@ -67,6 +67,7 @@ type jsonCodec struct {
 	encMu  sync.Mutex         // guards e
 	e      *json.Encoder      // encodes responses
 	rw     io.ReadWriteCloser // connection
+	limit  *requestLimiter    // bounds the size of requests, nil if unbounded
 }
 
 func (err *jsonError) Error() string {
@@ -87,6 +88,16 @@ func NewJSONCodec(rwc io.ReadWriteCloser) ServerCodec {
 	return &jsonCodec{closed: make(chan interface{}), d: d, e: json.NewEncoder(rwc), rw: rwc}
 }
 
+// newLimitedJSONCodec creates a JSON-RPC codec rejecting requests larger than
+// limit bytes read from the stream connection.
+func newLimitedJSONCodec(rwc io.ReadWriteCloser, limit int64) ServerCodec {
+	limiter := &requestLimiter{r: rwc, limit: limit}
+
+	d := json.NewDecoder(limiter)
+	d.UseNumber()
+	return &jsonCodec{closed: make(chan interface{}), d: d, e: json.NewEncoder(rwc), rw: rwc, limit: limiter}
+}
+
 // isBatch returns true when the first non-whitespace characters is '['
 func isBatch(msg json.RawMessage) bool {
 	for _, c := range msg {
@@ -108,8 +119,15 @@ func (c *jsonCodec) ReadRequestHeaders() ([]rpcRequest, bool, Error) {
 
 	var incomingMsg json.RawMessage
 	if err := c.d.Decode(&incomingMsg); err != nil {
+		if err == errRequestTooLarge {
+			sizeLimitCounter.Inc(1)
+			return nil, false, &limitExceededError{fmt.Sprintf("request too large (max %d bytes)", c.limit.limit)}
+		}
 		return nil, false, &invalidRequestError{err.Error()}
 	}
+	if c.limit != nil {
+		c.limit.reset()
+	}
 
 	if isBatch(incomingMsg) {
 		return parseBatchRequest(incomingMsg)
@@ -0,0 +1,223 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kowala-tech/kUSD/metrics"
+)
+
+var (
+	batchLimitCounter        = metrics.NewCounter("rpc/limits/batch")         // Batches rejected for their length
+	sizeLimitCounter         = metrics.NewCounter("rpc/limits/size")          // Requests rejected for their body size
+	rateLimitCounter         = metrics.NewCounter("rpc/limits/rate")          // Requests rejected for exceeding the client rate
+	subscriptionLimitCounter = metrics.NewCounter("rpc/limits/subscriptions") // Subscriptions rejected for exceeding the connection cap
+)
+
+// limiterSweepInterval is the interval at which idle clients are dropped from
+// the rate limiter.
+const limiterSweepInterval = time.Minute
+
+// errRequestTooLarge is returned by a request limiter once the request being
+// read exceeds the size limit.
+var errRequestTooLarge = errors.New("request too large")
+
+// Limits bounds the resources a single client may consume. Zero values leave the
+// respective resource unlimited, except for MaxRequestSize which falls back to
+// the default HTTP request size limit.
+type Limits struct {
+	MaxBatchSize     int     // Maximum number of requests in a batch
+	MaxRequestSize   int64   // Maximum size of HTTP request bodies and websocket requests in bytes
+	RequestRate      float64 // Requests per second a client (API key or IP address) may issue
+	RequestBurst     int     // Requests a client may issue at once, defaults to the rate
+	MaxSubscriptions int     // Maximum number of subscriptions per connection
+}
+
+// clientKey is the context key of the identity rate limits are tracked by.
+type clientKey struct{}
+
+// clientID identifies the client of an HTTP or websocket request for the rate
+// limiter. Authenticated clients are tracked by their credentials so that they
+// share their quota across addresses, others by their IP address.
+func clientID(r *http.Request, grant *Grant) string {
+	if grant != nil {
+		return grant.id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// requestLimiter bounds the data read from a stream connection for a single
+// request. The codec resets it once a request is decoded. As the decoder reads
+// ahead, the start of the next request may be counted against the previous one.
+type requestLimiter struct {
+	r     io.Reader
+	limit int64 // Maximum number of bytes read for a request
+	read  int64 // Bytes read since the last request was decoded
+}
+
+func (l *requestLimiter) Read(p []byte) (int, error) {
+	if l.read >= l.limit {
+		return 0, errRequestTooLarge
+	}
+	if left := l.limit - l.read; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	return n, err
+}
+
+// reset starts counting the bytes of the next request.
+func (l *requestLimiter) reset() {
+	l.read = 0
+}
+
+// bucket is the token bucket of a single client.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter enforces the request rate of individual clients using a token
+// bucket per client.
+type rateLimiter struct {
+	rate  float64 // Tokens added to the buckets per second
+	burst float64 // Capacity of the buckets
+
+	buckets map[string]*bucket
+	swept   time.Time
+	lock    sync.Mutex
+}
+
+// newRateLimiter creates a rate limiter allowing rate requests per second with
+// bursts of up to burst requests.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow reports whether the client may issue n requests at the given time,
+// consuming n tokens if so. Batches larger than the burst size are never
+// allowed.
+func (l *rateLimiter) allow(client string, n int, now time.Time) bool {
+	if float64(n) > l.burst {
+		return false
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if now.Sub(l.swept) > limiterSweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[client] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.updated = now
+
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// refill returns the tokens in the bucket at the given time.
+func (l *rateLimiter) refill(b *bucket, now time.Time) float64 {
+	return math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+}
+
+// sweep drops the buckets which filled up again, as they are equivalent to
+// those of unseen clients.
+func (l *rateLimiter) sweep(now time.Time) {
+	for client, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+	l.swept = now
+}
+
+// SetLimits bounds the resources a single client may consume. It must be called
+// before serving any requests.
+func (s *Server) SetLimits(limits Limits) {
+	s.limits = limits
+	if limits.RequestRate > 0 {
+		s.limiter = newRateLimiter(limits.RequestRate, limits.RequestBurst)
+	}
+}
+
+// maxRequestSize returns the maximum size of HTTP request bodies and websocket
+// requests.
+func (s *Server) maxRequestSize() int64 {
+	if s.limits.MaxRequestSize > 0 {
+		return s.limits.MaxRequestSize
+	}
+	return maxHTTPRequestContentLength
+}
+
+// checkLimits verifies that a (batch) request read from the connection of the
+// given context is within the configured limits.
+func (s *Server) checkLimits(ctx context.Context, reqs []*serverRequest, batch bool) Error {
+	if batch && s.limits.MaxBatchSize > 0 && len(reqs) > s.limits.MaxBatchSize {
+		batchLimitCounter.Inc(1)
+		return &limitExceededError{fmt.Sprintf("batch too large (%d>%d)", len(reqs), s.limits.MaxBatchSize)}
+	}
+	if s.limiter != nil {
+		if len(reqs) > int(s.limiter.burst) {
+			batchLimitCounter.Inc(1)
+			return &limitExceededError{fmt.Sprintf("batch exceeds the request burst (%d>%d)", len(reqs), int(s.limiter.burst))}
+		}
+		if client, ok := ctx.Value(clientKey{}).(string); ok && !s.limiter.allow(client, len(reqs), time.Now()) {
+			rateLimitCounter.Inc(int64(len(reqs)))
+			return &limitExceededError{"request rate limit exceeded"}
+		}
+	}
+	return nil
+}
+
+// Limit wraps an HTTP handler served next to the RPC endpoints, enforcing the
+// request size and rate limits of the server on its requests. Requests count
+// against the same client quota as the RPC calls.
+func (s *Server) Limit(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		maxSize := s.maxRequestSize()
+		if r.ContentLength > maxSize {
+			sizeLimitCounter.Inc(1)
+			http.Error(w, fmt.Sprintf("content length too large (%d>%d)", r.ContentLength, maxSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if s.limiter != nil {
+			var grant *Grant
+			if s.auth != nil {
+				grant, _ = s.auth.Authenticate(r)
+			}
+			if !s.limiter.allow(clientID(r, grant), 1, time.Now()) {
+				rateLimitCounter.Inc(1)
+				http.Error(w, "request rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+		h.ServeHTTP(w, r)
+	})
+}
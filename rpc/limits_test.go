@@ -0,0 +1,174 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+// Tests that HTTP requests exceeding the batch, size and rate limits are
+// rejected with JSON-RPC errors.
+func TestHTTPLimits(t *testing.T) {
+	server := newTestServer("test", new(Service))
+	server.SetLimits(Limits{MaxBatchSize: 2, MaxRequestSize: 256, RequestRate: 0.001, RequestBurst: 3})
+	defer server.Stop()
+
+	call := `{"jsonrpc":"2.0","id":1,"method":"test_rets","params":[]}`
+	tests := []struct {
+		addr   string
+		body   string
+		code   int    // expected HTTP status code
+		result string // expected substring of the response
+	}{
+		{"1.1.1.1:1000", "[" + call + "," + call + "]", http.StatusOK, `"result":""`},
+		{"1.1.1.1:1000", "[" + call + "," + call + "," + call + "]", http.StatusOK, "batch too large"},
+		{"1.1.1.1:1000", call + strings.Repeat(" ", 256), http.StatusRequestEntityTooLarge, "content length too large"},
+		{"1.1.1.1:2000", call, http.StatusOK, `"result":""`},
+		{"1.1.1.1:3000", call, http.StatusOK, "rate limit exceeded"},
+		{"2.2.2.2:1000", call, http.StatusOK, `"result":""`},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", "http://url.com", strings.NewReader(tt.body))
+		req.Header.Set("content-type", contentType)
+		req.RemoteAddr = tt.addr
+
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+
+		if rec.Code != tt.code {
+			t.Errorf("test %d: status code mismatch: have %d, want %d", i, rec.Code, tt.code)
+		}
+		if !strings.Contains(rec.Body.String(), tt.result) {
+			t.Errorf("test %d: response mismatch: have %q, want %q", i, rec.Body.String(), tt.result)
+		}
+		if tt.code == http.StatusOK && !strings.Contains(rec.Body.String(), `"jsonrpc":"2.0"`) {
+			t.Errorf("test %d: response is not a JSON-RPC message: %q", i, rec.Body.String())
+		}
+	}
+}
+
+// Tests that a batch is charged a token per request against the client rate,
+// and that batches larger than the burst are rejected.
+func TestBatchRateLimit(t *testing.T) {
+	server := newTestServer("test", new(Service))
+	server.SetLimits(Limits{RequestRate: 0.001, RequestBurst: 2})
+	defer server.Stop()
+
+	call := `{"jsonrpc":"2.0","id":1,"method":"test_rets","params":[]}`
+	tests := []struct {
+		body   string
+		result string // expected substring of the response
+	}{
+		{"[" + call + "," + call + "," + call + "]", "batch exceeds the request burst"},
+		{"[" + call + "," + call + "]", `"result":""`},
+		{call, "rate limit exceeded"},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", "http://url.com", strings.NewReader(tt.body))
+		req.Header.Set("content-type", contentType)
+		req.RemoteAddr = "1.1.1.1:1000"
+
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+
+		if !strings.Contains(rec.Body.String(), tt.result) {
+			t.Errorf("test %d: response mismatch: have %q, want %q", i, rec.Body.String(), tt.result)
+		}
+	}
+}
+
+// Tests that websocket requests exceeding the request size limit are rejected
+// with a JSON-RPC error.
+func TestWebsocketRequestSize(t *testing.T) {
+	server := newTestServer("test", new(Service))
+	server.SetLimits(Limits{MaxRequestSize: 256})
+	defer server.Stop()
+
+	httpsrv := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	defer httpsrv.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(httpsrv.URL, "http"), "", "http://localhost")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	tests := []struct {
+		arg    string
+		result string // expected substring of the response
+	}{
+		{"small", `"result":{"String":"small"`},
+		{strings.Repeat("a", 256), "request too large"},
+	}
+	for i, tt := range tests {
+		call := `{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["` + tt.arg + `",1,{"S":"x"}]}`
+		if err := websocket.Message.Send(conn, call); err != nil {
+			t.Fatalf("test %d: failed to send request: %v", i, err)
+		}
+		var resp string
+		if err := websocket.Message.Receive(conn, &resp); err != nil {
+			t.Fatalf("test %d: failed to read response: %v", i, err)
+		}
+		if !strings.Contains(resp, tt.result) {
+			t.Errorf("test %d: response mismatch: have %q, want %q", i, resp, tt.result)
+		}
+	}
+}
+
+// Tests that HTTP handlers mounted next to the RPC endpoints are subject to the
+// size and rate limits of the server.
+func TestHTTPHandlerLimits(t *testing.T) {
+	server := newTestServer("test", new(Service))
+	server.SetLimits(Limits{MaxRequestSize: 256, RequestRate: 0.001, RequestBurst: 2})
+	defer server.Stop()
+
+	handler := server.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	tests := []struct {
+		addr string
+		body string
+		code int // expected HTTP status code
+	}{
+		{"1.1.1.1:1000", "{}", http.StatusOK},
+		{"1.1.1.1:1000", strings.Repeat(" ", 257), http.StatusRequestEntityTooLarge},
+		{"1.1.1.1:2000", "{}", http.StatusOK},
+		{"1.1.1.1:3000", "{}", http.StatusTooManyRequests},
+		{"2.2.2.2:1000", "{}", http.StatusOK},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", "http://url.com/graphql", strings.NewReader(tt.body))
+		req.RemoteAddr = tt.addr
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.code {
+			t.Errorf("test %d: status code mismatch: have %d, want %d", i, rec.Code, tt.code)
+		}
+	}
+}
+
+// Tests that connections can't create more subscriptions than permitted.
+func TestSubscriptionLimit(t *testing.T) {
+	server := newTestServer("eth", new(NotificationTestService))
+	server.SetLimits(Limits{MaxSubscriptions: 2})
+	defer server.Stop()
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Subscribe(context.Background(), "eth", make(chan int), "someSubscription", 0, 0); err != nil {
+			t.Fatalf("subscription %d failed: %v", i, err)
+		}
+	}
+	_, err := client.Subscribe(context.Background(), "eth", make(chan int), "someSubscription", 0, 0)
+	if err == nil || !strings.Contains(err.Error(), "too many subscriptions") {
+		t.Fatalf("excess subscription error mismatch: have %v", err)
+	}
+}
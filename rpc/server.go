@@ -109,7 +109,7 @@ func (s *Server) RegisterName(name string, rcvr interface{}) error {
 // If singleShot is true it will process a single request, otherwise it will handle
 // requests until the codec returns an error when reading a request (in most cases
 // an EOF). It executes requests in parallel when singleShot is false.
-func (s *Server) serveRequest(codec ServerCodec, singleShot bool, options CodecOption) error {
+func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, singleShot bool, options CodecOption) error {
 	var pend sync.WaitGroup
 
 	defer func() {
@@ -124,7 +124,7 @@ func (s *Server) serveRequest(codec ServerCodec, singleShot bool, options CodecO
 		s.codecsMu.Unlock()
 	}()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	// if the codec supports notification include a notifier that callbacks can use
@@ -143,7 +143,7 @@ func (s *Server) serveRequest(codec ServerCodec, singleShot bool, options CodecO
 
 	// test if the server is ordered to stop
 	for atomic.LoadInt32(&s.run) == 1 {
-		reqs, batch, err := s.readRequest(codec)
+		reqs, batch, err := s.readRequest(ctx, codec)
 		if err != nil {
 			// If a parsing error occurred, send an error
 			if err.Error() != "EOF" {
@@ -170,6 +170,18 @@ func (s *Server) serveRequest(codec ServerCodec, singleShot bool, options CodecO
 			}
 			return nil
 		}
+		// reject requests exceeding the resource limits of the client
+		if err := s.checkLimits(ctx, reqs, batch); err != nil {
+			if batch {
+				codec.Write(codec.CreateErrorResponse(nil, err))
+			} else {
+				codec.Write(codec.CreateErrorResponse(&reqs[0].id, err))
+			}
+			if singleShot {
+				return nil
+			}
+			continue
+		}
 		// If a single shot request is executing, run and return immediately
 		if singleShot {
 			if batch {
@@ -199,14 +211,21 @@ func (s *Server) serveRequest(codec ServerCodec, singleShot bool, options CodecO
 // stopped. In either case the codec is closed.
 func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
 	defer codec.Close()
-	s.serveRequest(codec, false, options)
+	s.serveRequest(context.Background(), codec, false, options)
 }
 
 // ServeSingleRequest reads and processes a single RPC request from the given codec. It will not
 // close the codec unless a non-recoverable error has occurred. Note, this method will return after
 // a single request has been processed!
 func (s *Server) ServeSingleRequest(codec ServerCodec, options CodecOption) {
-	s.serveRequest(codec, true, options)
+	s.serveRequest(context.Background(), codec, true, options)
+}
+
+// SetAuthenticator requires HTTP and websocket clients to authenticate, only
+// allowing them to call the namespaces and methods they were granted. It must
+// be called before serving any requests.
+func (s *Server) SetAuthenticator(auth *Authenticator) {
+	s.auth = auth
 }
 
 // Stop will stop reading new requests, wait for stopPendingRequestTimeout to allow pending requests to finish,
@@ -261,6 +280,10 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 	}
 
 	if req.callb.isSubscribe {
+		if notifier, ok := NotifierFromContext(ctx); ok && s.limits.MaxSubscriptions > 0 && notifier.count() >= s.limits.MaxSubscriptions {
+			subscriptionLimitCounter.Inc(1)
+			return codec.CreateErrorResponse(&req.id, &limitExceededError{fmt.Sprintf("too many subscriptions (max %d)", s.limits.MaxSubscriptions)}), nil
+		}
 		subid, err := s.createSubscription(ctx, codec, req)
 		if err != nil {
 			return codec.CreateErrorResponse(&req.id, &callbackError{err.Error()}), nil
@@ -357,12 +380,14 @@ func (s *Server) execBatch(ctx context.Context, codec ServerCodec, requests []*s
 
 // readRequest requests the next (batch) request from the codec. It will return the collection
 // of requests, an indication if the request was a batch, the invalid request identifier and an
-// error when the request could not be read/parsed.
-func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error) {
+// error when the request could not be read/parsed. Requests of authenticated clients for
+// methods they were not granted are rejected.
+func (s *Server) readRequest(ctx context.Context, codec ServerCodec) ([]*serverRequest, bool, Error) {
 	reqs, batch, err := codec.ReadRequestHeaders()
 	if err != nil {
 		return nil, batch, err
 	}
+	grant, _ := ctx.Value(grantKey{}).(*Grant)
 
 	requests := make([]*serverRequest, len(reqs))
 
@@ -387,6 +412,17 @@ func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error)
 			continue
 		}
 
+		if grant != nil {
+			method := r.method
+			if r.isPubSub {
+				method = strings.TrimPrefix(subscribeMethodSuffix, serviceMethodSeparator)
+			}
+			if !grant.Allows(r.service, method) {
+				requests[i] = &serverRequest{id: r.id, err: &unauthorizedError{r.service, method}}
+				continue
+			}
+		}
+
 		if svc, ok = s.services[r.service]; !ok { // rpc method isn't available
 			requests[i] = &serverRequest{id: r.id, err: &methodNotFoundError{r.service, r.method}}
 			continue
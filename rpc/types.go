@@ -54,6 +54,9 @@ type subscriptions map[string]*callback  // collection of subscription callbacks
 // Server represents a RPC server
 type Server struct {
 	services serviceRegistry
+	auth     *Authenticator // Authenticator of HTTP and websocket clients, nil if disabled
+	limits   Limits         // Resource limits of individual clients
+	limiter  *rateLimiter   // Request rate limiter of HTTP and websocket clients, nil if disabled
 
 	run      int32
 	codecsMu sync.Mutex
@@ -20,11 +20,39 @@ import (
 //
 // allowedOrigins should be a comma-separated list of allowed origin URLs.
 // To allow connections with any origin, pass "*".
+//
+// If the server has an authenticator, the credentials are checked during the
+// websocket upgrade and the connection is restricted to the granted methods.
 func (srv *Server) WebsocketHandler(allowedOrigins []string) http.Handler {
+	validateOrigin := wsHandshakeValidator(allowedOrigins)
 	return websocket.Server{
-		Handshake: wsHandshakeValidator(allowedOrigins),
+		Handshake: func(cfg *websocket.Config, req *http.Request) error {
+			if err := validateOrigin(cfg, req); err != nil {
+				return err
+			}
+			if srv.auth != nil {
+				if _, err := srv.auth.Authenticate(req); err != nil {
+					log.Warn("Rejected unauthenticated WS-RPC connection", "err", err)
+					return err
+				}
+			}
+			return nil
+		},
 		Handler: func(conn *websocket.Conn) {
-			srv.ServeCodec(NewJSONCodec(conn), OptionMethodInvocation|OptionSubscriptions)
+			ctx := context.Background()
+			var grant *Grant
+			if srv.auth != nil {
+				var err error
+				if grant, err = srv.auth.Authenticate(conn.Request()); err != nil {
+					conn.Close()
+					return
+				}
+				ctx = context.WithValue(ctx, grantKey{}, grant)
+			}
+			ctx = context.WithValue(ctx, clientKey{}, clientID(conn.Request(), grant))
+			codec := newLimitedJSONCodec(conn, srv.maxRequestSize())
+			defer codec.Close()
+			srv.serveRequest(ctx, codec, false, OptionMethodInvocation|OptionSubscriptions)
 		},
 	}
 }
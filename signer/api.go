@@ -0,0 +1,189 @@
+// Package signer implements a standalone signing service holding the keys of
+// Kowala accounts away from the node, guarding validator keys against double
+// signing consensus messages.
+package signer
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/kowala-tech/kUSD/accounts"
+	"github.com/kowala-tech/kUSD/accounts/keystore"
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/common/hexutil"
+	"github.com/kowala-tech/kUSD/core/types"
+	"github.com/kowala-tech/kUSD/log"
+	"github.com/kowala-tech/kUSD/rlp"
+)
+
+// Version is the version of the signer RPC API, reported to the clients.
+const Version = "1.0.0"
+
+// Namespace is the RPC namespace the signer API is exposed under.
+const Namespace = "account"
+
+var (
+	// errChainIDMismatch is returned if a signing request targets a different
+	// chain than the one the signer was configured for.
+	errChainIDMismatch = errors.New("chain id mismatch")
+
+	// ErrTxRefused is returned if a transaction wasn't approved for signing.
+	ErrTxRefused = errors.New("transaction refused")
+)
+
+// TxApprover approves the transactions the signer is requested to sign. Unlike
+// consensus messages, any transaction signed moves the funds of the account.
+type TxApprover interface {
+	// ApproveTx returns nil if account may sign tx for the chain chainID.
+	ApproveTx(account common.Address, tx *types.Transaction, chainID *big.Int) error
+}
+
+// TxApproverFunc is an adapter to allow the use of ordinary functions as
+// transaction approvers.
+type TxApproverFunc func(account common.Address, tx *types.Transaction, chainID *big.Int) error
+
+// ApproveTx calls f(account, tx, chainID).
+func (f TxApproverFunc) ApproveTx(account common.Address, tx *types.Transaction, chainID *big.Int) error {
+	return f(account, tx, chainID)
+}
+
+// SignerAPI is the RPC API exposed by the signer under the Namespace namespace.
+// Transactions and consensus messages are exchanged in their RLP encoding.
+type SignerAPI struct {
+	ks       *keystore.KeyStore
+	policy   *Policy
+	approver TxApprover
+	chainID  *big.Int
+}
+
+// NewSignerAPI creates a signer API signing with the unlocked accounts of ks.
+// Transactions are only signed once approved by approver, all of them are
+// refused if it's nil. If chainID is non-nil, requests for other chains are
+// refused.
+func NewSignerAPI(ks *keystore.KeyStore, policy *Policy, approver TxApprover, chainID *big.Int) *SignerAPI {
+	return &SignerAPI{ks: ks, policy: policy, approver: approver, chainID: chainID}
+}
+
+// Version returns the version of the signer API.
+func (api *SignerAPI) Version(ctx context.Context) (string, error) {
+	return Version, nil
+}
+
+// List returns the accounts the signer is able to sign with.
+func (api *SignerAPI) List(ctx context.Context) ([]common.Address, error) {
+	addrs := make([]common.Address, 0, len(api.ks.Accounts()))
+	for _, account := range api.ks.Accounts() {
+		addrs = append(addrs, account.Address)
+	}
+	return addrs, nil
+}
+
+// SignTransaction signs the RLP encoded transaction with the given account.
+func (api *SignerAPI) SignTransaction(ctx context.Context, addr common.Address, data hexutil.Bytes, chainID *hexutil.Big) (hexutil.Bytes, error) {
+	id, err := api.checkChainID(chainID)
+	if err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(data, tx); err != nil {
+		return nil, err
+	}
+	if api.approver == nil {
+		return nil, ErrTxRefused
+	}
+	if err := api.approver.ApproveTx(addr, tx, id); err != nil {
+		log.Warn("Refused to sign transaction", "account", addr, "hash", tx.Hash(), "err", err)
+		return nil, err
+	}
+	signed, err := api.ks.SignTx(accounts.Account{Address: addr}, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Signed transaction", "account", addr, "hash", signed.Hash())
+	return rlp.EncodeToBytes(signed)
+}
+
+// SignVote signs the RLP encoded consensus vote with the given account, unless
+// the account already signed a conflicting or a later consensus message.
+func (api *SignerAPI) SignVote(ctx context.Context, addr common.Address, data hexutil.Bytes, chainID *hexutil.Big) (hexutil.Bytes, error) {
+	id, err := api.checkChainID(chainID)
+	if err != nil {
+		return nil, err
+	}
+	vote := new(types.Vote)
+	if err := rlp.DecodeBytes(data, vote); err != nil {
+		return nil, err
+	}
+	var signed *types.Vote
+	err = api.policy.AllowVote(addr, vote, id, func() (err error) {
+		signed, err = api.ks.SignVote(accounts.Account{Address: addr}, vote, id)
+		return err
+	})
+	if err != nil {
+		log.Warn("Refused to sign vote", "account", addr, "number", vote.BlockNumber(), "round", vote.Round(), "type", vote.Type(), "err", err)
+		return nil, err
+	}
+	log.Info("Signed vote", "account", addr, "number", vote.BlockNumber(), "round", vote.Round(), "type", vote.Type())
+	return rlp.EncodeToBytes(signed)
+}
+
+// SignProposal signs the RLP encoded block proposal with the given account,
+// unless the account already signed a conflicting or a later consensus message.
+func (api *SignerAPI) SignProposal(ctx context.Context, addr common.Address, data hexutil.Bytes, chainID *hexutil.Big) (hexutil.Bytes, error) {
+	id, err := api.checkChainID(chainID)
+	if err != nil {
+		return nil, err
+	}
+	proposal := new(types.Proposal)
+	if err := rlp.DecodeBytes(data, proposal); err != nil {
+		return nil, err
+	}
+	var signed *types.Proposal
+	err = api.policy.AllowProposal(addr, proposal, id, func() (err error) {
+		signed, err = api.ks.SignProposal(accounts.Account{Address: addr}, proposal, id)
+		return err
+	})
+	if err != nil {
+		log.Warn("Refused to sign proposal", "account", addr, "number", proposal.BlockNumber(), "round", proposal.Round(), "err", err)
+		return nil, err
+	}
+	log.Info("Signed proposal", "account", addr, "number", proposal.BlockNumber(), "round", proposal.Round())
+	return rlp.EncodeToBytes(signed)
+}
+
+// SignAnnounce signs the RLP encoded validator announcement with the given
+// account. Announcements only advertise the node a validator runs on, they
+// can't be used to equivocate and aren't subject to the signing policy.
+func (api *SignerAPI) SignAnnounce(ctx context.Context, addr common.Address, data hexutil.Bytes, chainID *hexutil.Big) (hexutil.Bytes, error) {
+	id, err := api.checkChainID(chainID)
+	if err != nil {
+		return nil, err
+	}
+	announce := new(types.Announce)
+	if err := rlp.DecodeBytes(data, announce); err != nil {
+		return nil, err
+	}
+	if announce.Address() != addr {
+		return nil, errors.New("announcement of another account")
+	}
+	signed, err := api.ks.SignAnnounce(accounts.Account{Address: addr}, announce, id)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Signed validator announcement", "account", addr, "timestamp", announce.Timestamp())
+	return rlp.EncodeToBytes(signed)
+}
+
+// checkChainID ensures the requested chain id matches the configured one, if
+// any, and returns it in its plain form.
+func (api *SignerAPI) checkChainID(chainID *hexutil.Big) (*big.Int, error) {
+	if chainID == nil {
+		return nil, errors.New("missing chain id")
+	}
+	id := (*big.Int)(chainID)
+	if api.chainID != nil && api.chainID.Cmp(id) != 0 {
+		return nil, errChainIDMismatch
+	}
+	return id, nil
+}
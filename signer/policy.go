@@ -0,0 +1,189 @@
+package signer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/types"
+)
+
+var (
+	// ErrConflictingSignature is returned if a consensus message is requested
+	// to be signed for a height, round and step that the account already signed
+	// a different message for.
+	ErrConflictingSignature = errors.New("conflicting consensus message already signed")
+
+	// ErrRegression is returned if a consensus message is requested to be signed
+	// for a height, round and step preceding the last one signed by the account.
+	ErrRegression = errors.New("consensus message precedes the last signed one")
+)
+
+// step is the position of a consensus message within a consensus round.
+type step uint8
+
+const (
+	stepProposal step = iota + 1
+	stepPreVote
+	stepPreCommit
+)
+
+// voteStep maps a vote type to its step within the consensus round.
+func voteStep(typ types.VoteType) (step, error) {
+	switch typ {
+	case types.PreVote:
+		return stepPreVote, nil
+	case types.PreCommit:
+		return stepPreCommit, nil
+	}
+	return 0, fmt.Errorf("invalid vote type %d", typ)
+}
+
+// signState is the last consensus message signed by an account.
+type signState struct {
+	Height *big.Int    `json:"height"`
+	Round  uint64      `json:"round"`
+	Step   step        `json:"step"`
+	Hash   common.Hash `json:"hash"` // Protected hash of the signed message
+}
+
+// cmp compares the height, round and step of the state with the given ones.
+func (s *signState) cmp(height *big.Int, round uint64, step step) int {
+	if c := s.Height.Cmp(height); c != 0 {
+		return c
+	}
+	switch {
+	case s.Round < round:
+		return -1
+	case s.Round > round:
+		return 1
+	case s.Step < step:
+		return -1
+	case s.Step > step:
+		return 1
+	}
+	return 0
+}
+
+// Policy guards the validator keys held by the signer against double signing.
+// It tracks the last consensus message signed by every account and only allows
+// signing messages that follow it, or the very same message again.
+//
+// The tracked state is persisted after every update, so that the protection
+// survives restarts of the signer.
+type Policy struct {
+	path  string                        // File to persist the signing state into (empty = memory only)
+	state map[common.Address]*signState // Last consensus message signed by each account
+	lock  sync.Mutex
+}
+
+// NewPolicy creates a double signing guard, loading any previously persisted
+// signing state from path. An empty path keeps the state in memory only.
+func NewPolicy(path string) (*Policy, error) {
+	p := &Policy{
+		path:  path,
+		state: make(map[common.Address]*signState),
+	}
+	if path == "" {
+		return p, nil
+	}
+	blob, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return p, nil
+	case err != nil:
+		return nil, err
+	}
+	if err := json.Unmarshal(blob, &p.state); err != nil {
+		return nil, fmt.Errorf("corrupt signing state %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// AllowVote runs sign if account may sign the given vote, and once signed
+// records the vote as the last signed consensus message. Nothing is recorded if
+// sign fails, so the vote can be retried.
+func (p *Policy) AllowVote(account common.Address, vote *types.Vote, chainID *big.Int, sign func() error) error {
+	step, err := voteStep(vote.Type())
+	if err != nil {
+		return err
+	}
+	return p.allow(account, vote.BlockNumber(), vote.Round(), step, vote.ProtectedHash(chainID), sign)
+}
+
+// AllowProposal runs sign if account may sign the given proposal, and once
+// signed records the proposal as the last signed consensus message. Nothing is
+// recorded if sign fails, so the proposal can be retried.
+func (p *Policy) AllowProposal(account common.Address, proposal *types.Proposal, chainID *big.Int, sign func() error) error {
+	return p.allow(account, proposal.BlockNumber(), proposal.Round(), stepProposal, proposal.ProtectedHash(chainID), sign)
+}
+
+func (p *Policy) allow(account common.Address, height *big.Int, round uint64, step step, hash common.Hash, sign func() error) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	prev, ok := p.state[account]
+	if ok {
+		switch prev.cmp(height, round, step) {
+		case 1:
+			return ErrRegression
+		case 0:
+			if prev.Hash != hash {
+				return ErrConflictingSignature
+			}
+			return sign()
+		}
+	}
+	if err := sign(); err != nil {
+		return err
+	}
+	p.state[account] = &signState{
+		Height: new(big.Int).Set(height),
+		Round:  round,
+		Step:   step,
+		Hash:   hash,
+	}
+	// Never hand out a signature that would be forgotten on restart
+	if err := p.persist(); err != nil {
+		if prev == nil {
+			delete(p.state, account)
+		} else {
+			p.state[account] = prev
+		}
+		return err
+	}
+	return nil
+}
+
+// persist atomically writes the signing state to disk.
+func (p *Policy) persist() error {
+	if p.path == "" {
+		return nil
+	}
+	blob, err := json.MarshalIndent(p.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(p.path), "."+filepath.Base(p.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(blob); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	return os.Rename(tmp.Name(), p.path)
+}
@@ -0,0 +1,112 @@
+package signer
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kowala-tech/kUSD/common"
+	"github.com/kowala-tech/kUSD/core/types"
+)
+
+var (
+	testAccount = common.HexToAddress("0x01")
+	testChainID = big.NewInt(1)
+)
+
+// sign is a signing step that always succeeds.
+func sign() error { return nil }
+
+// Tests that the policy only allows signing consensus messages in order, and
+// refuses conflicting messages for the same height, round and step.
+func TestPolicyDoubleSigning(t *testing.T) {
+	policy, _ := NewPolicy("")
+
+	prevote := types.NewVote(big.NewInt(10), common.Hash{0x01}, 1, types.PreVote)
+	if err := policy.AllowVote(testAccount, prevote, testChainID, sign); err != nil {
+		t.Fatalf("first vote refused: %v", err)
+	}
+	// Signing the very same vote again is harmless
+	if err := policy.AllowVote(testAccount, prevote, testChainID, sign); err != nil {
+		t.Fatalf("repeated vote refused: %v", err)
+	}
+	// Voting for a different block in the same height, round and step isn't
+	conflict := types.NewVote(big.NewInt(10), common.Hash{0x02}, 1, types.PreVote)
+	if err := policy.AllowVote(testAccount, conflict, testChainID, sign); err != ErrConflictingSignature {
+		t.Fatalf("conflicting vote error mismatch: have %v, want %v", err, ErrConflictingSignature)
+	}
+	// Other accounts are tracked separately
+	if err := policy.AllowVote(common.HexToAddress("0x02"), conflict, testChainID, sign); err != nil {
+		t.Fatalf("other account vote refused: %v", err)
+	}
+	// Later steps are allowed, earlier ones aren't
+	precommit := types.NewVote(big.NewInt(10), common.Hash{0x02}, 1, types.PreCommit)
+	if err := policy.AllowVote(testAccount, precommit, testChainID, sign); err != nil {
+		t.Fatalf("pre-commit refused: %v", err)
+	}
+	if err := policy.AllowVote(testAccount, prevote, testChainID, sign); err != ErrRegression {
+		t.Fatalf("regressing vote error mismatch: have %v, want %v", err, ErrRegression)
+	}
+	proposal := types.NewProposal(big.NewInt(10), 1, &types.Metadata{}, -1, common.Hash{})
+	if err := policy.AllowProposal(testAccount, proposal, testChainID, sign); err != ErrRegression {
+		t.Fatalf("regressing proposal error mismatch: have %v, want %v", err, ErrRegression)
+	}
+	proposal = types.NewProposal(big.NewInt(10), 2, &types.Metadata{}, -1, common.Hash{})
+	if err := policy.AllowProposal(testAccount, proposal, testChainID, sign); err != nil {
+		t.Fatalf("next round proposal refused: %v", err)
+	}
+}
+
+// Tests that the signing state survives restarts.
+func TestPolicyPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kusdsigner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signstate.json")
+
+	policy, err := NewPolicy(path)
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+	vote := types.NewVote(big.NewInt(10), common.Hash{0x01}, 0, types.PreCommit)
+	if err := policy.AllowVote(testAccount, vote, testChainID, sign); err != nil {
+		t.Fatalf("vote refused: %v", err)
+	}
+	if policy, err = NewPolicy(path); err != nil {
+		t.Fatalf("failed to reload policy: %v", err)
+	}
+	conflict := types.NewVote(big.NewInt(10), common.Hash{0x02}, 0, types.PreCommit)
+	if err := policy.AllowVote(testAccount, conflict, testChainID, sign); err != ErrConflictingSignature {
+		t.Fatalf("conflicting vote error mismatch: have %v, want %v", err, ErrConflictingSignature)
+	}
+}
+
+// Tests that a consensus message is only recorded once signed, so that a failed
+// signing doesn't block retrying it, nor signing a different one instead.
+func TestPolicyFailedSign(t *testing.T) {
+	policy, _ := NewPolicy("")
+
+	failure := errors.New("keystore failure")
+	vote := types.NewVote(big.NewInt(10), common.Hash{0x01}, 0, types.PreVote)
+	if err := policy.AllowVote(testAccount, vote, testChainID, func() error { return failure }); err != failure {
+		t.Fatalf("failed signing error mismatch: have %v, want %v", err, failure)
+	}
+	other := types.NewVote(big.NewInt(10), common.Hash{0x02}, 0, types.PreVote)
+	if err := policy.AllowVote(testAccount, other, testChainID, sign); err != nil {
+		t.Fatalf("vote after failed signing refused: %v", err)
+	}
+	// Refused messages aren't signed at all
+	signed := false
+	err := policy.AllowVote(testAccount, vote, testChainID, func() error {
+		signed = true
+		return nil
+	})
+	if err != ErrConflictingSignature || signed {
+		t.Fatalf("conflicting vote mismatch: have %v (signed %v), want %v", err, signed, ErrConflictingSignature)
+	}
+}
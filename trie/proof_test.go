@@ -4,6 +4,7 @@ import (
 	"bytes"
 	crand "crypto/rand"
 	mrand "math/rand"
+	"sort"
 	"testing"
 	"time"
 
@@ -83,6 +84,186 @@ func mutateByte(b []byte) {
 	}
 }
 
+// sortedEntries returns the entries of a random trie sorted by key.
+func sortedEntries(vals map[string]*kv) []*kv {
+	entries := make([]*kv, 0, len(vals))
+	for _, kv := range vals {
+		entries = append(entries, kv)
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+	return entries
+}
+
+// rangeProof returns the edge proofs of a range of entries.
+func rangeProof(t *testing.T, trie *Trie, first, last []byte) *kusddb.MemDatabase {
+	proof, _ := kusddb.NewMemDatabase()
+	if err := trie.Prove(first, 0, proof); err != nil {
+		t.Fatalf("failed to prove the first key: %v", err)
+	}
+	if err := trie.Prove(last, 0, proof); err != nil {
+		t.Fatalf("failed to prove the last key: %v", err)
+	}
+	return proof
+}
+
+// rangeKeys splits a range of entries into its keys and values.
+func rangeKeys(entries []*kv) (keys [][]byte, values [][]byte) {
+	for _, kv := range entries {
+		keys = append(keys, kv.k)
+		values = append(values, kv.v)
+	}
+	return keys, values
+}
+
+// Tests that random ranges of a trie are proven with their edge proofs.
+func TestRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	for i := 0; i < 100; i++ {
+		start := mrand.Intn(len(entries))
+		end := mrand.Intn(len(entries)-start) + start + 1
+
+		keys, values := rangeKeys(entries[start:end])
+		proof := rangeProof(t, trie, keys[0], keys[len(keys)-1])
+		more, err := VerifyRangeProof(trie.Hash(), keys[0], keys[len(keys)-1], keys, values, proof)
+		if err != nil {
+			t.Fatalf("range %d-%d: failed to verify: %v", start, end, err)
+		}
+		if more != (end < len(entries)) {
+			t.Fatalf("range %d-%d: more flag mismatch: have %v, want %v", start, end, more, end < len(entries))
+		}
+	}
+}
+
+// Tests that ranges are proven with edge proofs of non-existent keys.
+func TestRangeProofWithNonExistentProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	for i := 0; i < 100; i++ {
+		start := mrand.Intn(len(entries)-1) + 1
+		end := mrand.Intn(len(entries)-start) + start + 1
+
+		// Decrease the first key and increase the last one, keeping them off the trie
+		first := common.CopyBytes(entries[start].k)
+		if first[len(first)-1] == 0 {
+			continue
+		}
+		first[len(first)-1]--
+		if bytes.Equal(first, entries[start-1].k) {
+			continue
+		}
+		last := common.CopyBytes(entries[end-1].k)
+		if end < len(entries) {
+			if last[len(last)-1] == 0xff {
+				continue
+			}
+			last[len(last)-1]++
+			if bytes.Equal(last, entries[end].k) {
+				continue
+			}
+		} else {
+			last = bytes.Repeat([]byte{0xff}, len(last))
+		}
+		keys, values := rangeKeys(entries[start:end])
+		proof := rangeProof(t, trie, first, last)
+		if _, err := VerifyRangeProof(trie.Hash(), first, last, keys, values, proof); err != nil {
+			t.Fatalf("range %d-%d: failed to verify: %v", start, end, err)
+		}
+	}
+	// The full range with a zero origin must verify as well
+	keys, values := rangeKeys(entries)
+	first := make([]byte, 32)
+	proof := rangeProof(t, trie, first, keys[len(keys)-1])
+	more, err := VerifyRangeProof(trie.Hash(), first, keys[len(keys)-1], keys, values, proof)
+	if err != nil {
+		t.Fatalf("full range: failed to verify: %v", err)
+	}
+	if more {
+		t.Fatalf("full range: more elements reported")
+	}
+}
+
+// Tests that tampered ranges are rejected.
+func TestBadRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	for i := 0; i < 100; i++ {
+		start := mrand.Intn(len(entries) - 2)
+		end := mrand.Intn(len(entries)-start-2) + start + 3
+
+		keys, values := rangeKeys(entries[start:end])
+		first, last := keys[0], keys[len(keys)-1]
+		proof := rangeProof(t, trie, first, last)
+
+		index := mrand.Intn(len(keys))
+		switch mrand.Intn(4) {
+		case 0: // Modified value
+			values[index] = randBytes(20)
+		case 1: // Dropped element in the middle
+			if index == 0 || index == len(keys)-1 {
+				index = len(keys) / 2
+			}
+			keys = append(keys[:index:index], keys[index+1:]...)
+			values = append(values[:index:index], values[index+1:]...)
+		case 2: // Out of order elements
+			if index == len(keys)-1 {
+				index--
+			}
+			keys[index], keys[index+1] = keys[index+1], keys[index]
+			values[index], values[index+1] = values[index+1], values[index]
+		case 3: // Deleted element
+			values[index] = nil
+		}
+		if _, err := VerifyRangeProof(trie.Hash(), first, last, keys, values, proof); err == nil {
+			t.Fatalf("range %d-%d: tampered range accepted", start, end)
+		}
+	}
+}
+
+// Tests that single element ranges and whole tries without proofs are verified.
+func TestSingleAndFullRangeProof(t *testing.T) {
+	trie, vals := randomTrie(1024)
+	entries := sortedEntries(vals)
+
+	for _, index := range []int{0, len(entries) / 2, len(entries) - 1} {
+		keys, values := rangeKeys(entries[index : index+1])
+		proof := rangeProof(t, trie, keys[0], keys[0])
+		more, err := VerifyRangeProof(trie.Hash(), keys[0], keys[0], keys, values, proof)
+		if err != nil {
+			t.Fatalf("element %d: failed to verify: %v", index, err)
+		}
+		if more != (index < len(entries)-1) {
+			t.Fatalf("element %d: more flag mismatch: have %v", index, more)
+		}
+	}
+	keys, values := rangeKeys(entries)
+	if _, err := VerifyRangeProof(trie.Hash(), nil, nil, keys, values, nil); err != nil {
+		t.Fatalf("failed to verify the whole trie: %v", err)
+	}
+	if _, err := VerifyRangeProof(trie.Hash(), nil, nil, keys[1:], values[1:], nil); err == nil {
+		t.Fatalf("partial trie accepted as whole")
+	}
+}
+
+// Tests that an empty range is only accepted past the last element.
+func TestEmptyRangeProof(t *testing.T) {
+	trie, vals := randomTrie(1024)
+	entries := sortedEntries(vals)
+
+	last := bytes.Repeat([]byte{0xff}, 32)
+	proof, _ := kusddb.NewMemDatabase()
+	trie.Prove(last, 0, proof)
+	if _, err := VerifyRangeProof(trie.Hash(), last, nil, nil, nil, proof); err != nil {
+		t.Fatalf("empty range past the last element rejected: %v", err)
+	}
+	first := entries[len(entries)/2].k
+	proof, _ = kusddb.NewMemDatabase()
+	trie.Prove(first, 0, proof)
+	if _, err := VerifyRangeProof(trie.Hash(), first, nil, nil, nil, proof); err == nil {
+		t.Fatalf("empty range with remaining elements accepted")
+	}
+}
+
 func BenchmarkProve(b *testing.B) {
 	trie, vals := randomTrie(100)
 	var keys []string